@@ -0,0 +1,307 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bench benchmarks the plugins on standard corpora, so that their
+// performance can be tracked across the versions of the plugins and of the
+// plugin SDK. Each corpus is a replay bundle of representative events of a
+// plugin, stored in testdata/<plugin>.jsonl.gz. The benchmarks are run with:
+//
+//	go test -run '^$' -bench . -benchmem
+//
+// Along with the usual metrics, they report the events processed per second
+// (events/s), the bytes of the payloads of the events processed per second
+// (bytes/s), the time spent per field extraction (ns/extract), and the
+// number of heap allocations per event (allocs/event). The CPU and memory
+// profiles of a benchmark are written with the usual flags, and can be
+// viewed as flame graphs with go tool pprof -http:
+//
+//	go test -run '^$' -bench Extract/okta -cpuprofile cpu.pprof -memprofile mem.pprof
+//	go tool pprof -http :8080 cpu.pprof
+//
+// The Extract benchmarks call the plugins directly, while the ExtractAsync
+// ones call the C symbols of the SDK like Falco does, with and without the
+// async extraction optimization, whose gain they measure.
+package bench
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/replay"
+)
+
+// batchSize is the number of events produced with each NextBatch call
+const batchSize = 128
+
+// Extractor is a plugin supporting the field extraction capability
+type Extractor interface {
+	Fields() []sdk.FieldEntry
+	Extract(req sdk.ExtractRequest, evt sdk.EventReader) error
+}
+
+// Corpus returns the events of the corpus of a plugin
+func Corpus(tb testing.TB, plugin string) [][]byte {
+	tb.Helper()
+	f, err := os.Open(filepath.Join("testdata", plugin+replay.Ext))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+	r, err := replay.NewReader(f)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer r.Close()
+
+	var res [][]byte
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return res
+		}
+		if err != nil {
+			tb.Fatal(err)
+		}
+		res = append(res, e.Data)
+	}
+}
+
+// Extract benchmarks the extraction of all the fields of a plugin that don't
+// require an argument, plus the given requests, one event of the corpus
+// after the other. An operation is the extraction of all the fields from an
+// event. The errors are ignored, as some fields are not available in every
+// event.
+func Extract(b *testing.B, p Extractor, corpus [][]byte) {
+	var reqs []*extractRequest
+	for id, e := range p.Fields() {
+		if e.Arg.IsRequired {
+			continue
+		}
+		reqs = append(reqs, &extractRequest{
+			fieldID:   uint64(id),
+			fieldType: fieldType(e.Type),
+			field:     e.Name,
+			isList:    e.IsList,
+		})
+	}
+
+	evt := &event{}
+	measure(b, len(reqs), func() (bytes int64) {
+		for i := 0; i < b.N; i++ {
+			// each event has a new number, so that the plugins parse it
+			// instead of reusing what they cached for the previous one
+			evt.num = uint64(i + 1)
+			evt.data = corpus[i%len(corpus)]
+			bytes += int64(len(evt.data))
+			for _, req := range reqs {
+				p.Extract(req, evt)
+			}
+		}
+		return bytes
+	})
+}
+
+// Source benchmarks the production of the events of a plugin. An operation
+// is the production of an event, and the event stream is opened again each
+// time the end of the stream is reached.
+func Source(b *testing.B, p sdk.PluginState, open func() (source.Instance, error)) {
+	batch := newEventWriters(batchSize)
+	measure(b, 0, func() (bytes int64) {
+		var inst source.Instance
+		for n := 0; n < b.N; {
+			if inst == nil {
+				var err error
+				if inst, err = open(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			count, err := inst.NextBatch(p, batch)
+			n += count
+			for i := 0; i < count; i++ {
+				bytes += int64(batch.evts[i].data.Len())
+			}
+			switch err {
+			case nil, sdk.ErrTimeout:
+			case sdk.ErrEOF:
+				if c, ok := inst.(sdk.Closer); ok {
+					c.Close()
+				}
+				inst = nil
+			default:
+				b.Fatal(err)
+			}
+		}
+		if c, ok := inst.(sdk.Closer); ok && inst != nil {
+			c.Close()
+		}
+		return bytes
+	})
+}
+
+// measure runs a benchmark loop processing b.N events, returning the bytes
+// of their payloads, and reports the custom metrics of the benchmarks
+func measure(b *testing.B, extractsPerEvent int, loop func() int64) {
+	var before, after runtime.MemStats
+	b.ReportAllocs()
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	bytes := loop()
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+
+	elapsed := b.Elapsed()
+	b.ReportMetric(float64(b.N)/elapsed.Seconds(), "events/s")
+	b.ReportMetric(float64(bytes)/elapsed.Seconds(), "bytes/s")
+	if extractsPerEvent > 0 {
+		b.ReportMetric(float64(elapsed.Nanoseconds())/float64(b.N*extractsPerEvent), "ns/extract")
+	}
+	b.ReportMetric(float64(after.Mallocs-before.Mallocs)/float64(b.N), "allocs/event")
+}
+
+func fieldType(t string) uint32 {
+	switch t {
+	case "uint64":
+		return sdk.FieldTypeUint64
+	case "reltime":
+		return sdk.FieldTypeRelTime
+	case "abstime":
+		return sdk.FieldTypeAbsTime
+	case "bool":
+		return sdk.FieldTypeBool
+	case "ipaddr":
+		return sdk.FieldTypeIPAddr
+	case "ipnet":
+		return sdk.FieldTypeIPNet
+	default:
+		return sdk.FieldTypeCharBuf
+	}
+}
+
+// extractRequest implements sdk.ExtractRequest and discards the values
+type extractRequest struct {
+	fieldID    uint64
+	fieldType  uint32
+	field      string
+	argKey     string
+	argIndex   uint64
+	argPresent bool
+	isList     bool
+}
+
+func (r *extractRequest) FieldID() uint64 {
+	return r.fieldID
+}
+
+func (r *extractRequest) FieldType() uint32 {
+	return r.fieldType
+}
+
+func (r *extractRequest) Field() string {
+	return r.field
+}
+
+func (r *extractRequest) ArgKey() string {
+	return r.argKey
+}
+
+func (r *extractRequest) ArgIndex() uint64 {
+	return r.argIndex
+}
+
+func (r *extractRequest) ArgPresent() bool {
+	return r.argPresent
+}
+
+func (r *extractRequest) IsList() bool {
+	return r.isList
+}
+
+func (r *extractRequest) SetValue(v interface{}) {
+	// do nothing
+}
+
+func (r *extractRequest) SetPtr(unsafe.Pointer) {
+	// do nothing
+}
+
+// event implements sdk.EventReader
+type event struct {
+	num  uint64
+	data []byte
+}
+
+func (e *event) EventNum() uint64 {
+	return e.num
+}
+
+func (e *event) Timestamp() uint64 {
+	return 0
+}
+
+func (e *event) Reader() io.ReadSeeker {
+	return bytes.NewReader(e.data)
+}
+
+// eventWriters implements sdk.EventWriters in Go memory
+type eventWriters struct {
+	evts []*eventWriter
+}
+
+func newEventWriters(size int) *eventWriters {
+	res := &eventWriters{}
+	for i := 0; i < size; i++ {
+		res.evts = append(res.evts, &eventWriter{})
+	}
+	return res
+}
+
+func (w *eventWriters) Get(eventIndex int) sdk.EventWriter {
+	return w.evts[eventIndex]
+}
+
+func (w *eventWriters) Len() int {
+	return len(w.evts)
+}
+
+func (w *eventWriters) ArrayPtr() unsafe.Pointer {
+	return nil
+}
+
+func (w *eventWriters) Free() {
+	// do nothing
+}
+
+type eventWriter struct {
+	data bytes.Buffer
+}
+
+func (w *eventWriter) Writer() io.Writer {
+	w.data.Reset()
+	return &w.data
+}
+
+func (w *eventWriter) SetTimestamp(value uint64) {
+	// do nothing
+}
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bench
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/plugins/cloudtrail/pkg/cloudtrail"
+	"github.com/falcosecurity/plugins/plugins/gcpaudit/pkg/gcpaudit"
+	"github.com/falcosecurity/plugins/plugins/github/pkg/github"
+	jsonplugin "github.com/falcosecurity/plugins/plugins/json/pkg/json"
+	"github.com/falcosecurity/plugins/plugins/k8saudit/pkg/k8saudit"
+	"github.com/falcosecurity/plugins/plugins/okta/pkg/okta"
+)
+
+func BenchmarkExtract(b *testing.B) {
+	oktaPlugin := &okta.Plugin{}
+	if err := oktaPlugin.Init("{}"); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bench := range []struct {
+		corpus string
+		plugin Extractor
+	}{
+		{"cloudtrail", &cloudtrail.Plugin{}},
+		{"gcpaudit", &gcpaudit.Plugin{}},
+		{"github", &github.Plugin{}},
+		{"json", &jsonplugin.Plugin{}},
+		{"k8saudit", &k8saudit.Plugin{}},
+		{"okta", oktaPlugin},
+	} {
+		b.Run(bench.corpus, func(b *testing.B) {
+			Extract(b, bench.plugin, Corpus(b, bench.corpus))
+		})
+	}
+}
+
+// BenchmarkExtractAsync compares the extraction through the C symbols of
+// the SDK with and without the async extraction optimization, e.g.:
+//
+//	go test -run '^$' -bench ExtractAsync -cpu 4
+func BenchmarkExtractAsync(b *testing.B) {
+	for _, bench := range []struct {
+		corpus string
+		plugin CPlugin
+	}{
+		{"github", &github.Plugin{}},
+		{"json", &jsonplugin.Plugin{}},
+	} {
+		for _, async := range []bool{false, true} {
+			name := bench.corpus + "/sync"
+			if async {
+				name = bench.corpus + "/async"
+			}
+			b.Run(name, func(b *testing.B) {
+				ExtractC(b, bench.plugin, Corpus(b, bench.corpus), async)
+			})
+		}
+	}
+}
+
+func BenchmarkSource(b *testing.B) {
+	b.Run("cloudtrail", func(b *testing.B) {
+		var records []json.RawMessage
+		for _, e := range Corpus(b, "cloudtrail") {
+			records = append(records, e)
+		}
+		data, err := json.Marshal(map[string]interface{}{"Records": records})
+		if err != nil {
+			b.Fatal(err)
+		}
+		dir := b.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "trail.json"), data, 0644); err != nil {
+			b.Fatal(err)
+		}
+
+		p := &cloudtrail.Plugin{}
+		if err := p.Init("{}"); err != nil {
+			b.Fatal(err)
+		}
+		defer p.Destroy()
+		Source(b, p, func() (source.Instance, error) {
+			return p.Open(dir)
+		})
+	})
+
+	b.Run("k8saudit", func(b *testing.B) {
+		data := bytes.Join(Corpus(b, "k8saudit"), []byte("\n"))
+		p := &k8saudit.Plugin{}
+		if err := p.Init("{}"); err != nil {
+			b.Fatal(err)
+		}
+		defer p.Destroy()
+		Source(b, p, func() (source.Instance, error) {
+			return p.OpenReader(io.NopCloser(bytes.NewReader(data)))
+		})
+	})
+}
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bench
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+
+// the structs of plugin_api.h used by plugin_extract_fields, with the same
+// layout, so that the SDK can be called like the plugin framework does
+typedef struct
+{
+	void *res;
+	uint64_t res_len;
+	uint32_t field_id;
+	const char *field;
+	const char *arg_key;
+	uint64_t arg_index;
+	uint32_t arg_present;
+	uint32_t ftype;
+	uint32_t flist;
+} bench_extract_field;
+
+typedef struct
+{
+	const void *evt;
+	uint64_t evtnum;
+	const char *evtsrc;
+} bench_event_input;
+
+typedef struct
+{
+	void *owner;
+	void *get_owner_last_error;
+	uint32_t num_fields;
+	bench_extract_field *fields;
+	// the table reader vtable, unused by the SDK
+	void *table_reader[8];
+} bench_extract_input;
+
+// defined by the extract package of the SDK
+extern int32_t plugin_extract_fields(void *s, const void *evt, const void *in);
+
+// bench_extract extracts the fields one by one from n events, cycling
+// through the given ones, like the filter checks of Falco do
+static void bench_extract(uintptr_t s, void **evts, uint32_t num_evts, bench_extract_field *fields, uint32_t num_fields, uint64_t n, uint64_t first_num)
+{
+	bench_event_input evt = {0};
+	bench_extract_input in = {0};
+	evt.evtsrc = "";
+	in.num_fields = 1;
+	for (uint64_t i = 0; i < n; i++)
+	{
+		evt.evt = evts[i % num_evts];
+		evt.evtnum = first_num + i;
+		for (uint32_t f = 0; f < num_fields; f++)
+		{
+			in.fields = &fields[f];
+			plugin_extract_fields((void *)s, &evt, &in);
+		}
+	}
+}
+*/
+import "C"
+import (
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/cgo"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/symbols/extract"
+)
+
+// CPlugin is a plugin whose fields can be extracted through the C symbols
+// of the SDK, like Extractor
+type CPlugin interface {
+	Extractor
+	sdk.ExtractRequests
+	sdk.LastError
+}
+
+// ExtractC benchmarks the extraction of the same fields as Extract, but
+// calling the plugin_extract_fields symbol of the SDK from C for each field,
+// like the plugin framework does. The benchmark includes the cost of the
+// C -> Go calls, and of the synchronization with the workers of the async
+// extraction optimization if async is true, so that both can be compared.
+// The async extraction requires at least 2 CPUs, and is skipped otherwise.
+func ExtractC(b *testing.B, p CPlugin, corpus [][]byte, async bool) {
+	if async && (runtime.NumCPU() < 2 || runtime.GOMAXPROCS(0) < 2) {
+		b.Skip("the async extraction requires at least 2 CPUs")
+	}
+	p.SetExtractRequests(sdk.NewExtractRequestPool())
+	defer p.ExtractRequests().Free()
+	h := cgo.NewHandle(p)
+	defer h.Delete()
+
+	// the events are written once in C memory, as the framework does
+	maxLen := 0
+	for _, e := range corpus {
+		if len(e) > maxLen {
+			maxLen = len(e)
+		}
+	}
+	evts, err := sdk.NewEventWriters(int64(len(corpus)), int64(maxLen))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer evts.Free()
+	for i, e := range corpus {
+		if _, err := evts.Get(i).Writer().Write(e); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	var names []*C.char
+	var fields []C.bench_extract_field
+	for id, e := range p.Fields() {
+		if e.Arg.IsRequired {
+			continue
+		}
+		name := C.CString(e.Name)
+		names = append(names, name)
+		f := C.bench_extract_field{
+			field_id: C.uint32_t(id),
+			field:    name,
+			ftype:    C.uint32_t(fieldType(e.Type)),
+		}
+		if e.IsList {
+			f.flist = 1
+		}
+		fields = append(fields, f)
+	}
+	defer func() {
+		for _, name := range names {
+			C.free(unsafe.Pointer(name))
+		}
+	}()
+	cFields := (*C.bench_extract_field)(C.malloc(C.size_t(len(fields)) * C.size_t(unsafe.Sizeof(C.bench_extract_field{}))))
+	defer C.free(unsafe.Pointer(cFields))
+	copy(unsafe.Slice(cFields, len(fields)), fields)
+
+	extract.SetAsync(async)
+	extract.StartAsync(h)
+	defer extract.StopAsync(h)
+
+	var bytes int64
+	for i := 0; i < b.N; i++ {
+		bytes += int64(len(corpus[i%len(corpus)]))
+	}
+	measure(b, len(fields), func() int64 {
+		C.bench_extract(C.uintptr_t(h), (*unsafe.Pointer)(evts.ArrayPtr()), C.uint32_t(len(corpus)), cFields, C.uint32_t(len(fields)), C.uint64_t(b.N), 1)
+		return bytes
+	})
+}
@@ -0,0 +1,198 @@
+module github.com/falcosecurity/plugins/bench
+
+go 1.22
+
+require (
+	github.com/falcosecurity/plugin-sdk-go v0.7.4
+	github.com/falcosecurity/plugins/plugins/cloudtrail v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/plugins/gcpaudit v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/plugins/github v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/plugins/json v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/plugins/k8saudit v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/plugins/okta v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/replay v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/fsnotify/fsnotify v1.6.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+)
+
+require (
+	cloud.google.com/go v0.115.0 // indirect
+	cloud.google.com/go/auth v0.5.1 // indirect
+	cloud.google.com/go/auth/oauth2adapt v0.2.2 // indirect
+	cloud.google.com/go/compute/metadata v0.3.0 // indirect
+	cloud.google.com/go/iam v1.1.8 // indirect
+	cloud.google.com/go/pubsub v1.38.0 // indirect
+	github.com/alecthomas/jsonschema v0.0.0-20220216202328-9eeeec9d044b // indirect
+	github.com/aws/aws-sdk-go-v2 v1.26.1 // indirect
+	github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream v1.6.2 // indirect
+	github.com/aws/aws-sdk-go-v2/config v1.27.11 // indirect
+	github.com/aws/aws-sdk-go-v2/credentials v1.17.11 // indirect
+	github.com/aws/aws-sdk-go-v2/feature/ec2/imds v1.16.1 // indirect
+	github.com/aws/aws-sdk-go-v2/feature/s3/manager v1.16.15 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/configsources v1.3.5 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.6.5 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/ini v1.8.0 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/v4a v1.3.5 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/accept-encoding v1.11.2 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/checksum v1.3.7 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/presigned-url v1.11.7 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/s3shared v1.17.5 // indirect
+	github.com/aws/aws-sdk-go-v2/service/s3 v1.53.1 // indirect
+	github.com/aws/aws-sdk-go-v2/service/sqs v1.31.4 // indirect
+	github.com/aws/aws-sdk-go-v2/service/sso v1.20.5 // indirect
+	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.23.4 // indirect
+	github.com/aws/aws-sdk-go-v2/service/sts v1.28.6 // indirect
+	github.com/aws/smithy-go v1.20.2 // indirect
+	github.com/bahlo/generic-list-go v0.2.0 // indirect
+	github.com/bluele/gcache v0.0.2 // indirect
+	github.com/buger/jsonparser v1.1.1 // indirect
+	github.com/falcosecurity/plugins/shared/go/aws/s3sqs v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/backoff v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/batch v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/bufpool v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/checkpoint v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/compress v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/debugserver v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/dedup v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/dlq v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/errkind v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/health v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/httpclient v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/intern v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/jsoncache v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/metrics v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/multishard v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/mux v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/pagination v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/proto v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/ratelimit v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/reload v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/secrets v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/tail v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/tenant v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/webhook/cloudevents v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/webhook/queue v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/webhook/server v0.0.0-00010101000000-000000000000 // indirect
+	github.com/felixge/httpsnoop v1.0.4 // indirect
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
+	github.com/golang/protobuf v1.5.4 // indirect
+	github.com/google/go-github v17.0.0+incompatible // indirect
+	github.com/google/go-querystring v1.1.0 // indirect
+	github.com/google/s2a-go v0.1.7 // indirect
+	github.com/googleapis/enterprise-certificate-proxy v0.3.2 // indirect
+	github.com/googleapis/gax-go/v2 v2.12.4 // indirect
+	github.com/iancoleman/orderedmap v0.3.0 // indirect
+	github.com/invopop/jsonschema v0.12.0 // indirect
+	github.com/itchyny/gojq v0.12.13 // indirect
+	github.com/itchyny/timefmt-go v0.1.5 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/mailru/easyjson v0.7.7 // indirect
+	github.com/sethvargo/go-password v0.3.0 // indirect
+	github.com/valyala/fastjson v1.6.4 // indirect
+	github.com/wk8/go-ordered-map/v2 v2.1.8 // indirect
+	go.opencensus.io v0.24.0 // indirect
+	go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc v0.49.0 // indirect
+	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.49.0 // indirect
+	go.opentelemetry.io/otel v1.24.0 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+	go.opentelemetry.io/otel/trace v1.24.0 // indirect
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/oauth2 v0.21.0 // indirect
+	golang.org/x/sync v0.7.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	golang.org/x/time v0.5.0 // indirect
+	google.golang.org/api v0.184.0 // indirect
+	google.golang.org/genproto v0.0.0-20240610135401-a8a62080eff3 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20240604185151-ef581f913117 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240604185151-ef581f913117 // indirect
+	google.golang.org/grpc v1.64.1 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/falcosecurity/plugins/plugins/cloudtrail => ../plugins/cloudtrail
+
+replace github.com/falcosecurity/plugins/plugins/gcpaudit => ../plugins/gcpaudit
+
+replace github.com/falcosecurity/plugins/plugins/github => ../plugins/github
+
+replace github.com/falcosecurity/plugins/plugins/json => ../plugins/json
+
+replace github.com/falcosecurity/plugins/plugins/k8saudit => ../plugins/k8saudit
+
+replace github.com/falcosecurity/plugins/plugins/okta => ../plugins/okta
+
+replace github.com/falcosecurity/plugins/shared/go/aws/cloudwatchlogs => ../shared/go/aws/cloudwatchlogs
+
+replace github.com/falcosecurity/plugins/shared/go/aws/session => ../shared/go/aws/session
+
+replace github.com/falcosecurity/plugins/shared/go/batch => ../shared/go/batch
+
+replace github.com/falcosecurity/plugins/shared/go/bufpool => ../shared/go/bufpool
+
+replace github.com/falcosecurity/plugins/shared/go/debugserver => ../shared/go/debugserver
+
+replace github.com/falcosecurity/plugins/shared/go/fuzz => ../shared/go/fuzz
+
+replace github.com/falcosecurity/plugins/shared/go/golden => ../shared/go/golden
+
+replace github.com/falcosecurity/plugins/shared/go/intern => ../shared/go/intern
+
+replace github.com/falcosecurity/plugins/shared/go/jsoncache => ../shared/go/jsoncache
+
+replace github.com/falcosecurity/plugins/shared/go/loader => ../shared/go/loader
+
+replace github.com/falcosecurity/plugins/shared/go/replay => ../shared/go/replay
+
+replace github.com/falcosecurity/plugins/shared/go/webhook/queue => ../shared/go/webhook/queue
+
+replace github.com/falcosecurity/plugins/shared/go/webhook/cloudevents => ../shared/go/webhook/cloudevents
+
+replace github.com/falcosecurity/plugins/shared/go/proto => ../shared/go/proto
+
+replace github.com/falcosecurity/plugins/shared/go/secrets => ../shared/go/secrets
+
+replace github.com/falcosecurity/plugins/shared/go/health => ../shared/go/health
+
+replace github.com/falcosecurity/plugins/shared/go/metrics => ../shared/go/metrics
+
+replace github.com/falcosecurity/plugins/shared/go/reload => ../shared/go/reload
+
+replace github.com/falcosecurity/plugins/shared/go/errkind => ../shared/go/errkind
+
+replace github.com/falcosecurity/plugins/shared/go/tenant => ../shared/go/tenant
+
+replace github.com/falcosecurity/plugins/shared/go/webhook/server => ../shared/go/webhook/server
+
+replace github.com/falcosecurity/plugins/shared/go/aws/s3sqs => ../shared/go/aws/s3sqs
+
+replace github.com/falcosecurity/plugins/shared/go/checkpoint => ../shared/go/checkpoint
+
+replace github.com/falcosecurity/plugins/shared/go/ratelimit => ../shared/go/ratelimit
+
+replace github.com/falcosecurity/plugins/shared/go/httpclient => ../shared/go/httpclient
+
+replace github.com/falcosecurity/plugins/shared/go/tail => ../shared/go/tail
+
+replace github.com/falcosecurity/plugins/shared/go/compress => ../shared/go/compress
+
+replace github.com/falcosecurity/plugins/shared/go/dlq => ../shared/go/dlq
+
+replace github.com/falcosecurity/plugins/shared/go/dedup => ../shared/go/dedup
+
+replace github.com/falcosecurity/plugins/shared/go/multishard => ../shared/go/multishard
+
+replace github.com/falcosecurity/plugins/shared/go/pagination => ../shared/go/pagination
+
+replace github.com/falcosecurity/plugins/shared/go/backoff => ../shared/go/backoff
+
+replace github.com/falcosecurity/plugins/shared/go/conformance => ../shared/go/conformance
+
+replace github.com/falcosecurity/plugins/shared/go/mux => ../shared/go/mux
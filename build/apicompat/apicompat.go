@@ -0,0 +1,289 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/falcosecurity/plugins/registry"
+	"github.com/falcosecurity/plugins/shared/go/loader"
+	"github.com/spf13/pflag"
+)
+
+const sdkModule = "github.com/falcosecurity/plugin-sdk-go"
+
+// falcoReleases are the Falco releases along with the plugin API version
+// they implement, in release order. A release is added here each time it
+// bumps the plugin API version, and the later releases are assumed to
+// implement at least the version of the last one.
+var falcoReleases = []struct {
+	falco string
+	api   string
+}{
+	{"0.31.0", "1.0.0"},
+	{"0.32.0", "1.0.0"},
+	{"0.33.0", "2.0.0"},
+	{"0.34.0", "2.0.0"},
+	{"0.35.0", "3.0.0"},
+}
+
+var rgxAPIVersion = regexp.MustCompile(`#define\s+PLUGIN_API_VERSION_(MAJOR|MINOR|PATCH)\s+(\d+)`)
+
+var (
+	rootDir  string
+	minFalco string
+)
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(1)
+}
+
+// version is a plugin API version
+type version [3]uint64
+
+func parseVersion(s string) (version, error) {
+	var v version
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+func (v version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// supports tells whether a framework implementing the API version v can
+// load a plugin requiring the API version req, with the same rule as the
+// plugin loader of Falco
+func (v version) supports(req version) bool {
+	if v[0] != req[0] {
+		return false
+	}
+	return v[1] > req[1] || (v[1] == req[1] && v[2] >= req[2])
+}
+
+// sdkVersion returns the version of plugin-sdk-go required by the Go module
+// in dir, and the plugin API version it implements, read from its headers
+func sdkVersion(dir string) (string, version, error) {
+	cmd := exec.Command("go", "list", "-m", "-json", sdkModule)
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", version{}, fmt.Errorf("listing %s: %s", sdkModule, err.Error())
+	}
+	var mod struct {
+		Version string
+		Dir     string
+		Replace *struct {
+			Version string
+			Dir     string
+		}
+	}
+	if err := json.Unmarshal(out, &mod); err != nil {
+		return "", version{}, err
+	}
+	if mod.Replace != nil {
+		mod.Version, mod.Dir = mod.Replace.Version, mod.Replace.Dir
+	}
+	if mod.Dir == "" {
+		return "", version{}, fmt.Errorf("%s %s is not downloaded, run go mod download", sdkModule, mod.Version)
+	}
+	header, err := ioutil.ReadFile(filepath.Join(mod.Dir, "pkg", "sdk", "plugin_api.h"))
+	if err != nil {
+		return "", version{}, err
+	}
+	var v version
+	found := 0
+	for _, m := range rgxAPIVersion.FindAllSubmatch(header, -1) {
+		n, _ := strconv.ParseUint(string(m[2]), 10, 32)
+		switch string(m[1]) {
+		case "MAJOR":
+			v[0] = n
+		case "MINOR":
+			v[1] = n
+		case "PATCH":
+			v[2] = n
+		}
+		found++
+	}
+	if found != 3 {
+		return "", version{}, fmt.Errorf("plugin API version not found in the headers of %s %s", sdkModule, mod.Version)
+	}
+	return mod.Version, v, nil
+}
+
+// compatibleReleases returns the Falco releases able to load a plugin
+// requiring the given API version, and whether the releases later than the
+// known ones are expected to load it too
+func compatibleReleases(req version) ([]string, bool) {
+	var res []string
+	supported := false
+	for _, r := range falcoReleases {
+		api, err := parseVersion(r.api)
+		if err != nil {
+			fail(err)
+		}
+		supported = api.supports(req)
+		if supported {
+			res = append(res, r.falco)
+		}
+	}
+	return res, supported
+}
+
+// report collects the compatibility and the violations found for a plugin
+type report struct {
+	name string
+	info []string
+	errs []string
+}
+
+func (r *report) errorf(format string, args ...interface{}) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func check(path string) *report {
+	r := &report{name: path}
+	info, err := loader.LoadInfo(path)
+	if err != nil {
+		r.errorf("load failed: %s", err.Error())
+		return r
+	}
+	r.name = info.Name
+	req, err := parseVersion(info.RequiredAPIVersion)
+	if err != nil {
+		r.errorf("required API version: %s", err.Error())
+		return r
+	}
+	r.info = append(r.info, fmt.Sprintf("requires plugin API %s", req))
+
+	// the required API version of the Go plugins must be implemented by
+	// the SDK they are built with
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+		sdkVer, sdkAPI, err := sdkVersion(dir)
+		if err != nil {
+			r.errorf("%s", err.Error())
+		} else {
+			r.info = append(r.info, fmt.Sprintf("built with %s %s implementing plugin API %s", sdkModule, sdkVer, sdkAPI))
+			if !sdkAPI.supports(req) {
+				r.errorf("required API version %s is not implemented by %s %s", req, sdkModule, sdkVer)
+			}
+		}
+	}
+
+	if e, ok := registry.Lookup(info.Name); ok && e.RequiredAPIVersion != "" && e.RequiredAPIVersion != req.String() {
+		r.errorf("required API version %s, %s in the registry package", req, e.RequiredAPIVersion)
+	}
+
+	releases, later := compatibleReleases(req)
+	switch {
+	case len(releases) == 0:
+		r.errorf("not compatible with any known Falco release, add the releases implementing plugin API %s to the tool if any", req)
+	case later:
+		r.info = append(r.info, fmt.Sprintf("compatible with Falco %s and later", strings.Join(releases, ", ")))
+	default:
+		r.info = append(r.info, fmt.Sprintf("compatible with Falco %s only", strings.Join(releases, ", ")))
+	}
+	if minFalco != "" {
+		ok := false
+		for _, rel := range releases {
+			ok = ok || rel == minFalco
+		}
+		if !ok {
+			r.errorf("not compatible with Falco %s", minFalco)
+		}
+	}
+	return r
+}
+
+func main() {
+	pflag.StringVarP(&rootDir, "root", "r", ".", "Root directory of the repository, used to find the plugins.")
+	pflag.StringVar(&minFalco, "min-falco", "", "Falco release the plugins must be compatible with, e.g. 0.35.0.")
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [plugin.so...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Reports the Falco releases the plugins are compatible with, according to their required plugin API\n")
+		fmt.Fprintf(os.Stderr, "version, and checks that it is consistent with the plugin-sdk-go version they are built with.\n")
+		fmt.Fprintf(os.Stderr, "By default, all the plugins built in <root>/plugins are checked.\n\n")
+		pflag.PrintDefaults()
+	}
+	pflag.Parse()
+
+	if minFalco != "" {
+		known := false
+		for _, r := range falcoReleases {
+			known = known || r.falco == minFalco
+		}
+		if !known {
+			fail(fmt.Errorf("unknown Falco release %s", minFalco))
+		}
+	}
+
+	paths := pflag.Args()
+	if len(paths) == 0 {
+		var err error
+		paths, err = filepath.Glob(filepath.Join(rootDir, "plugins", "*", "lib*.so"))
+		if err != nil {
+			fail(err)
+		}
+		sort.Strings(paths)
+	}
+	if len(paths) == 0 {
+		fail(fmt.Errorf("no plugin found in %s, build them first", filepath.Join(rootDir, "plugins")))
+	}
+
+	failed := 0
+	for _, path := range paths {
+		r := check(path)
+		status := "PASS"
+		if len(r.errs) > 0 {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Printf("%s %s\n", status, r.name)
+		for _, i := range r.info {
+			fmt.Printf("  %s\n", i)
+		}
+		for _, e := range r.errs {
+			fmt.Printf("  - %s\n", e)
+		}
+	}
+	if failed > 0 {
+		fail(fmt.Errorf("%d/%d plugins have API version mismatches", failed, len(paths)))
+	}
+}
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected version
+		err      bool
+	}{
+		{"3.0.0", version{3, 0, 0}, false},
+		{"2.10.4", version{2, 10, 4}, false},
+		{"3.0", version{}, true},
+		{"3.0.0.1", version{}, true},
+		{"3.x.0", version{}, true},
+		{"3.-1.0", version{}, true},
+		{"", version{}, true},
+	}
+	for _, test := range tests {
+		v, err := parseVersion(test.s)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.s, err.Error())
+		} else if v != test.expected || v.String() != test.s {
+			t.Errorf("%s: expected %v, got %v", test.s, test.expected, v)
+		}
+	}
+}
+
+func TestSupports(t *testing.T) {
+	tests := []struct {
+		framework, required string
+		expected            bool
+	}{
+		{"3.0.0", "3.0.0", true},
+		{"3.1.0", "3.0.5", true},
+		{"3.0.5", "3.0.4", true},
+		{"3.0.4", "3.0.5", false},
+		{"3.0.0", "3.1.0", false},
+		{"3.0.0", "2.0.0", false},
+		{"2.0.0", "3.0.0", false},
+	}
+	for _, test := range tests {
+		f, _ := parseVersion(test.framework)
+		r, _ := parseVersion(test.required)
+		if f.supports(r) != test.expected {
+			t.Errorf("%s supporting %s: expected %v", test.framework, test.required, test.expected)
+		}
+	}
+}
+
+func TestCompatibleReleases(t *testing.T) {
+	tests := []struct {
+		required string
+		releases string
+		later    bool
+	}{
+		{"1.0.0", "0.31.0, 0.32.0", false},
+		{"2.0.0", "0.33.0, 0.34.0", false},
+		{"3.0.0", "0.35.0", true},
+		// no known release implements a newer minor version
+		{"3.1.0", "", false},
+		{"4.0.0", "", false},
+	}
+	for _, test := range tests {
+		req, _ := parseVersion(test.required)
+		releases, later := compatibleReleases(req)
+		if strings.Join(releases, ", ") != test.releases || later != test.later {
+			t.Errorf("%s: expected %s (later: %v), got %v (later: %v)", test.required, test.releases, test.later, releases, later)
+		}
+	}
+}
+
+func TestSDKVersion(t *testing.T) {
+	// the SDK required by this module, which is downloaded to build it
+	ver, api, err := sdkVersion(".")
+	if err != nil {
+		t.Skipf("the SDK is not available: %s", err.Error())
+	}
+	if !strings.HasPrefix(ver, "v") || api[0] == 0 {
+		t.Errorf("expected the version of the SDK and its API, got %s %s", ver, api)
+	}
+	if _, _, err := sdkVersion(t.TempDir()); err == nil {
+		t.Error("expected an error outside of a module")
+	}
+}
+
+func TestCheckLoadFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "libmissing.so")
+	r := check(path)
+	if r.name != path || len(r.errs) != 1 || !strings.HasPrefix(r.errs[0], "load failed: ") {
+		t.Errorf("expected a load failure, got %+v", r)
+	}
+}
@@ -0,0 +1,15 @@
+module github.com/falcosecurity/plugins/build/apicompat
+
+go 1.17
+
+require (
+	github.com/falcosecurity/plugins/registry v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/loader v0.0.0-00010101000000-000000000000
+	github.com/spf13/pflag v1.0.5
+)
+
+require github.com/falcosecurity/plugin-sdk-go v0.7.3 // indirect
+
+replace github.com/falcosecurity/plugins/registry => ../../registry
+
+replace github.com/falcosecurity/plugins/shared/go/loader => ../../shared/go/loader
@@ -0,0 +1,442 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugins/build/registry/pkg/registry"
+	"github.com/falcosecurity/plugins/shared/go/golden"
+	"github.com/falcosecurity/plugins/shared/go/loader"
+)
+
+var (
+	fieldNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]+(\.[a-zA-Z0-9_]+)+$`)
+	semverRegexp    = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+	secretRegexp    = regexp.MustCompile(`(?i)(token|secret|password)s?$`)
+	fieldTypes      = map[string]bool{
+		"string":  true,
+		"uint64":  true,
+		"bool":    true,
+		"reltime": true,
+		"abstime": true,
+		"ipaddr":  true,
+		"ipnet":   true,
+	}
+	fieldProperties = map[string]bool{
+		"hidden":       true,
+		"info":         true,
+		"conversation": true,
+	}
+)
+
+// checkRegistry checks that the plugin is registered, and that what it
+// reports matches its registry entry
+func checkRegistry(t *target, reg *registry.Registry) {
+	p, r := t.plugin, t.report
+	if !semverRegexp.MatchString(p.Version) {
+		r.errorf("version %q is not a valid semver", p.Version)
+	}
+	if t.entry == nil {
+		r.errorf("plugin is not registered in the registry")
+		return
+	}
+	if t.entry.Reserved {
+		r.errorf("plugin uses a reserved registry entry")
+	}
+
+	sourcing := t.entry.Capabilities.Sourcing
+	if p.HasCapSourcing() != sourcing.Supported {
+		r.errorf("sourcing capability is %t, but %t in the registry", p.HasCapSourcing(), sourcing.Supported)
+	}
+	if p.HasCapSourcing() {
+		if p.ID == 0 {
+			r.errorf("sourcing plugins must have a non-zero ID")
+		}
+		if uint(p.ID) != sourcing.ID {
+			r.errorf("ID is %d, but %d in the registry", p.ID, sourcing.ID)
+		}
+		if p.EventSource != sourcing.Source {
+			r.errorf("event source is %q, but %q in the registry", p.EventSource, sourcing.Source)
+		}
+		for _, s := range reg.ReservedSources {
+			if p.EventSource == s {
+				r.errorf("event source %q is reserved", s)
+			}
+		}
+	}
+	if p.HasCapExtraction() != t.entry.Capabilities.Extraction.Supported {
+		r.errorf("extraction capability is %t, but %t in the registry", p.HasCapExtraction(), t.entry.Capabilities.Extraction.Supported)
+	}
+}
+
+// checkFields checks the definition of the fields supported by the plugin
+func checkFields(t *target) {
+	names := map[string]bool{}
+	for _, f := range t.plugin.Fields {
+		r := t.report
+		if names[f.Name] {
+			r.errorf("field %s is defined more than once", f.Name)
+		}
+		names[f.Name] = true
+		if !fieldNameRegexp.MatchString(f.Name) {
+			r.errorf("field %q has an invalid name", f.Name)
+		}
+		if !fieldTypes[f.Type] {
+			r.errorf("field %s has an invalid type %q", f.Name, f.Type)
+		}
+		if len(f.Desc) == 0 {
+			r.errorf("field %s has no description", f.Name)
+		}
+		if f.Arg.IsKey && f.Arg.IsIndex {
+			r.errorf("field %s has an argument both key and index", f.Name)
+		}
+		if f.Arg.IsRequired && !f.Arg.IsKey && !f.Arg.IsIndex {
+			r.errorf("field %s requires an argument that is neither key nor index", f.Name)
+		}
+		for _, prop := range f.Properties {
+			if !fieldProperties[prop] {
+				r.errorf("field %s has an invalid property %q", f.Name, prop)
+			}
+		}
+	}
+}
+
+// checkInit checks that the plugin accepts the init configs valid for its
+// json schema, and leaves it initialized with the defaults of its schema.
+// Like in Falco, the configs are supposed to be validated against the
+// schema before init, so the invalid ones are not checked. It returns false
+// if the plugin cannot be initialized.
+func checkInit(t *target) bool {
+	p, r := t.plugin, t.report
+	schema := p.InitSchema()
+	if len(schema) == 0 {
+		if err := p.Init(""); err != nil {
+			r.errorf("init with an empty config failed: %s", err.Error())
+			return false
+		}
+		return true
+	}
+
+	props, err := schemaProperties(schema)
+	if err != nil {
+		r.errorf("init schema is invalid: %s", err.Error())
+	}
+	defaults := map[string]interface{}{}
+	for name, prop := range props {
+		if v, ok := prop["default"]; ok {
+			defaults[name] = v
+		}
+		// secrets must be marked so that they're never echoed back
+		if secretRegexp.MatchString(name) && prop["writeOnly"] != true {
+			r.errorf("init property %s looks like a secret but is not writeOnly", name)
+		}
+	}
+
+	// each property is set alone to a value allowed by the schema, which
+	// must be accepted as well
+	for _, name := range sortedKeys(props) {
+		value, ok := validValue(props[name])
+		if !ok {
+			continue
+		}
+		config := mustMarshal(map[string]interface{}{name: value})
+		if err := p.Init(config); err != nil {
+			r.errorf("init with the config %s allowed by the schema failed: %s", config, err.Error())
+			continue
+		}
+		p.Destroy()
+	}
+
+	if err := p.Init(mustMarshal(defaults)); err != nil {
+		r.errorf("init with the defaults of the schema failed: %s", err.Error())
+		return false
+	}
+	return true
+}
+
+// schemaProperties returns the properties described by a json schema of an
+// object, following the reference to its definition if any
+func schemaProperties(schema string) (map[string]map[string]interface{}, error) {
+	var root map[string]interface{}
+	if err := json.Unmarshal([]byte(schema), &root); err != nil {
+		return nil, err
+	}
+	obj := root
+	if ref, ok := root["$ref"].(string); ok {
+		obj = nil
+		for _, key := range []string{"definitions", "$defs"} {
+			defs, _ := root[key].(map[string]interface{})
+			if def, ok := defs[strings.TrimPrefix(ref, "#/"+key+"/")].(map[string]interface{}); ok {
+				obj = def
+			}
+		}
+		if obj == nil {
+			return nil, fmt.Errorf("reference %s is not defined", ref)
+		}
+	}
+	if obj["type"] != "object" {
+		return nil, fmt.Errorf("schema does not describe a json object")
+	}
+
+	res := map[string]map[string]interface{}{}
+	props, _ := obj["properties"].(map[string]interface{})
+	for name, v := range props {
+		if prop, ok := v.(map[string]interface{}); ok {
+			res[name] = prop
+		}
+	}
+	return res, nil
+}
+
+// validValue returns the smallest json value allowed by the schema of a
+// property, if its type is known
+func validValue(prop map[string]interface{}) (interface{}, bool) {
+	if enum, ok := prop["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0], true
+	}
+	switch prop["type"] {
+	case "string":
+		return "", true
+	case "integer", "number":
+		if min, ok := prop["minimum"]; ok {
+			return min, true
+		}
+		return 0, true
+	case "boolean":
+		return false, true
+	case "object":
+		return map[string]interface{}{}, true
+	case "array":
+		return []interface{}{}, true
+	}
+	return nil, false
+}
+
+// loadEvents returns the payloads of the golden corpus of the plugin, and
+// the ones of the events generated by opening the plugin with the given
+// open params, if any
+func loadEvents(t *target, params string) ([][]byte, error) {
+	var res [][]byte
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(t.path), "pkg", "*", "testdata", "golden", "*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		if strings.HasSuffix(f, golden.Ext) {
+			continue
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, data)
+	}
+
+	if len(params) == 0 {
+		return res, nil
+	}
+	p := t.plugin
+	if err := p.Open(params); err != nil {
+		return res, err
+	}
+	defer p.Close()
+	deadline := time.Now().Add(10 * time.Second)
+	for n := 0; n < maxEvents && time.Now().Before(deadline); {
+		evts, err := p.NextBatch(uint64(n + 1))
+		if err == sdk.ErrTimeout {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		if err != nil && err != loader.ErrEOF {
+			return res, err
+		}
+		for _, e := range evts {
+			res = append(res, append([]byte{}, e.Data...))
+			n++
+		}
+		if err == loader.ErrEOF {
+			break
+		}
+	}
+	return res, nil
+}
+
+// checkEvents checks that the string representation of the events is
+// consistent and doesn't alter the values extracted from them
+func checkEvents(t *target, events [][]byte) {
+	p, r := t.plugin, t.report
+	if !p.HasCapSourcing() && p.HasCapExtraction() && t.entry != nil && len(t.entry.Capabilities.Extraction.Sources) > 0 {
+		p.SetEventSource(t.entry.Capabilities.Extraction.Sources[0])
+	}
+	var fields []*loader.Field
+	for _, f := range p.Fields {
+		if !f.Arg.IsRequired {
+			if lf, err := p.ParseField(f.Name); err == nil {
+				fields = append(fields, lf)
+			}
+		}
+	}
+
+	for i, data := range events {
+		evt := p.NewEvent(uint64(i+1), time.Unix(0, 0), data)
+		// the corpora also hold malformed payloads, on which extraction
+		// is expected to fail
+		before, extractErr := p.Extract(evt, fields)
+		str := p.EventToString(evt)
+		if str != p.EventToString(evt) {
+			r.errorf("event #%d: string representation is not deterministic", evt.Num)
+		}
+		if !utf8.ValidString(str) {
+			r.errorf("event #%d: string representation is not valid utf-8", evt.Num)
+		}
+		if err := checkRoundTrip(data, str); err != nil {
+			r.errorf("event #%d: %s", evt.Num, err.Error())
+		}
+		if p.HasCapExtraction() && extractErr == nil {
+			after, err := p.Extract(evt, fields)
+			if err == nil && !reflect.DeepEqual(before, after) {
+				r.errorf("event #%d: string representation alters the extracted values", evt.Num)
+			}
+		}
+		evt.Free()
+	}
+}
+
+// checkRoundTrip checks that a string representation in json of a json
+// payload holds the same json value. The string representations in other
+// forms, e.g. summaries of the payload, are not checked.
+func checkRoundTrip(data []byte, str string) error {
+	var payload, repr interface{}
+	if json.Unmarshal(data, &payload) != nil {
+		return nil
+	}
+	if _, ok := payload.(map[string]interface{}); !ok {
+		return nil
+	}
+	if json.Unmarshal([]byte(str), &repr) != nil {
+		return nil
+	}
+	if !reflect.DeepEqual(payload, repr) {
+		return fmt.Errorf("string representation in json does not round-trip to the payload")
+	}
+	return nil
+}
+
+// checkUniqueness checks that the names and IDs of the plugins are unique
+func checkUniqueness(targets []*target) {
+	names := map[string]string{}
+	ids := map[uint32]string{}
+	for _, t := range targets {
+		p := t.plugin
+		if other, ok := names[p.Name]; ok {
+			t.report.errorf("name is also used by %s", other)
+		}
+		names[p.Name] = t.path
+		if p.HasCapSourcing() && p.ID != 0 {
+			if other, ok := ids[p.ID]; ok {
+				t.report.errorf("ID %d is also used by %s", p.ID, other)
+			}
+			ids[p.ID] = p.Name
+		}
+	}
+}
+
+// checkOverlaps checks that the plugins extracting from a same event
+// source don't define the same fields. The sourcing plugins of a same
+// event source are alternatives of each other, so they can share fields.
+func checkOverlaps(targets []*target) {
+	for i, a := range targets {
+		for _, b := range targets[i+1:] {
+			if a.plugin.HasCapSourcing() && b.plugin.HasCapSourcing() &&
+				a.plugin.EventSource == b.plugin.EventSource {
+				continue
+			}
+			if !sourcesOverlap(extractSources(a), extractSources(b)) {
+				continue
+			}
+			for _, fa := range a.plugin.Fields {
+				for _, fb := range b.plugin.Fields {
+					if fa.Name == fb.Name {
+						b.report.errorf("field %s is also defined by %s", fb.Name, a.plugin.Name)
+					}
+				}
+			}
+		}
+	}
+}
+
+// extractSources returns the event sources a plugin extracts fields from,
+// or nil if it extracts from all of them
+func extractSources(t *target) []string {
+	if !t.plugin.HasCapExtraction() {
+		return []string{}
+	}
+	if t.entry != nil && len(t.entry.Capabilities.Extraction.Sources) > 0 {
+		return t.entry.Capabilities.Extraction.Sources
+	}
+	if t.plugin.HasCapSourcing() {
+		return []string{t.plugin.EventSource}
+	}
+	return nil
+}
+
+func sourcesOverlap(a, b []string) bool {
+	if a == nil {
+		return len(b) != 0 || b == nil
+	}
+	if b == nil {
+		return len(a) != 0
+	}
+	for _, sa := range a {
+		for _, sb := range b {
+			if sa == sb {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]map[string]interface{}) []string {
+	var res []string
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func mustMarshal(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/falcosecurity/plugins/build/registry/pkg/registry"
+	"github.com/falcosecurity/plugins/shared/go/loader"
+	"github.com/spf13/pflag"
+)
+
+var (
+	rootDir      string
+	registryPath string
+	openParams   []string
+	maxEvents    int
+)
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(1)
+}
+
+// report collects the violations found for a plugin
+type report struct {
+	name string
+	errs []string
+}
+
+func (r *report) errorf(format string, args ...interface{}) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+// target is a plugin under check, along with its registry entry and the
+// events used to exercise it
+type target struct {
+	path   string
+	plugin *loader.Plugin
+	entry  *registry.Plugin
+	report *report
+}
+
+func main() {
+	pflag.StringVarP(&rootDir, "root", "r", ".", "Root directory of the repository, used to find the plugins and their test corpora.")
+	pflag.StringVar(&registryPath, "registry", "", "File path to the plugin registry (default: <root>/registry.yaml).")
+	pflag.StringArrayVarP(&openParams, "open", "o", nil, "Open params used to generate events with a sourcing plugin, in the form <plugin>=<params>. Can be repeated.")
+	pflag.IntVarP(&maxEvents, "max-events", "n", 20, "Number of events generated with each plugin opened with --open.")
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [plugin.so...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Checks that the plugins follow the rules of the registry and of the plugin API.\n")
+		fmt.Fprintf(os.Stderr, "By default, all the plugins built in <root>/plugins are checked.\n\n")
+		pflag.PrintDefaults()
+	}
+	pflag.Parse()
+
+	if len(registryPath) == 0 {
+		registryPath = filepath.Join(rootDir, "registry.yaml")
+	}
+	reg, err := registry.LoadRegistryFromFile(registryPath)
+	if err != nil {
+		fail(err)
+	}
+
+	params := map[string]string{}
+	for _, o := range openParams {
+		kv := strings.SplitN(o, "=", 2)
+		if len(kv) != 2 {
+			fail(fmt.Errorf("invalid --open value, expected <plugin>=<params>: %s", o))
+		}
+		params[kv[0]] = kv[1]
+	}
+
+	paths := pflag.Args()
+	if len(paths) == 0 {
+		paths, err = filepath.Glob(filepath.Join(rootDir, "plugins", "*", "lib*.so"))
+		if err != nil {
+			fail(err)
+		}
+		sort.Strings(paths)
+	}
+	if len(paths) == 0 {
+		fail(fmt.Errorf("no plugin found in %s, build them first", filepath.Join(rootDir, "plugins")))
+	}
+
+	var targets []*target
+	var reports []*report
+	for _, path := range paths {
+		r := &report{name: path}
+		reports = append(reports, r)
+		p, err := loader.LoadPlugin(path)
+		if err != nil {
+			r.errorf("load failed: %s", err.Error())
+			continue
+		}
+		defer p.Unload()
+		r.name = p.Name
+		targets = append(targets, &target{
+			path:   path,
+			plugin: p,
+			entry:  findEntry(reg, p.Name),
+			report: r,
+		})
+	}
+
+	for _, t := range targets {
+		checkRegistry(t, reg)
+		checkFields(t)
+		if !checkInit(t) {
+			continue
+		}
+		events, err := loadEvents(t, params[t.plugin.Name])
+		if err != nil {
+			t.report.errorf("generating events failed: %s", err.Error())
+		}
+		checkEvents(t, events)
+	}
+	checkUniqueness(targets)
+	checkOverlaps(targets)
+
+	failed := 0
+	for _, r := range reports {
+		if len(r.errs) == 0 {
+			fmt.Printf("PASS %s\n", r.name)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL %s\n", r.name)
+		for _, e := range r.errs {
+			fmt.Printf("  - %s\n", e)
+		}
+	}
+	if failed > 0 {
+		fail(fmt.Errorf("%d/%d plugins are not conformant", failed, len(reports)))
+	}
+}
+
+func findEntry(reg *registry.Registry, name string) *registry.Plugin {
+	for i := range reg.Plugins {
+		if reg.Plugins[i].Name == name {
+			return &reg.Plugins[i]
+		}
+	}
+	return nil
+}
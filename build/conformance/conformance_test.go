@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugins/build/registry/pkg/registry"
+	"github.com/falcosecurity/plugins/shared/go/loader"
+)
+
+func newTarget(p *loader.Plugin, entry *registry.Plugin) *target {
+	return &target{path: p.Name, plugin: p, entry: entry, report: &report{name: p.Name}}
+}
+
+// hasError tells whether one of the errors of the report contains s
+func hasError(r *report, s string) bool {
+	for _, e := range r.errs {
+		if strings.Contains(e, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCheckFields(t *testing.T) {
+	tests := []struct {
+		field    sdk.FieldEntry
+		expected string
+	}{
+		{sdk.FieldEntry{Name: "test.valid", Type: "string", Desc: "d"}, ""},
+		{sdk.FieldEntry{Name: "test.arg", Type: "uint64", Desc: "d", Arg: sdk.FieldEntryArg{IsRequired: true, IsIndex: true}, Properties: []string{"hidden"}}, ""},
+		{sdk.FieldEntry{Name: "test", Type: "string", Desc: "d"}, "has an invalid name"},
+		{sdk.FieldEntry{Name: "test.a-b", Type: "string", Desc: "d"}, "has an invalid name"},
+		{sdk.FieldEntry{Name: "test.type", Type: "int", Desc: "d"}, `has an invalid type "int"`},
+		{sdk.FieldEntry{Name: "test.desc", Type: "string"}, "has no description"},
+		{sdk.FieldEntry{Name: "test.both", Type: "string", Desc: "d", Arg: sdk.FieldEntryArg{IsKey: true, IsIndex: true}}, "both key and index"},
+		{sdk.FieldEntry{Name: "test.required", Type: "string", Desc: "d", Arg: sdk.FieldEntryArg{IsRequired: true}}, "neither key nor index"},
+		{sdk.FieldEntry{Name: "test.prop", Type: "string", Desc: "d", Properties: []string{"secret"}}, `invalid property "secret"`},
+	}
+	for _, test := range tests {
+		tg := newTarget(&loader.Plugin{Name: "test", Fields: []sdk.FieldEntry{test.field}}, nil)
+		checkFields(tg)
+		if len(test.expected) == 0 && len(tg.report.errs) > 0 {
+			t.Errorf("%s: expected no error, got %v", test.field.Name, tg.report.errs)
+		}
+		if len(test.expected) > 0 && (len(tg.report.errs) != 1 || !hasError(tg.report, test.expected)) {
+			t.Errorf("%s: expected the error %q, got %v", test.field.Name, test.expected, tg.report.errs)
+		}
+	}
+
+	f := sdk.FieldEntry{Name: "test.dup", Type: "string", Desc: "d"}
+	tg := newTarget(&loader.Plugin{Name: "test", Fields: []sdk.FieldEntry{f, f}}, nil)
+	checkFields(tg)
+	if !hasError(tg.report, "defined more than once") {
+		t.Errorf("expected the duplicate field to be reported, got %v", tg.report.errs)
+	}
+}
+
+func TestCheckRegistry(t *testing.T) {
+	reg := &registry.Registry{}
+	tg := newTarget(&loader.Plugin{Name: "test", Version: "0.1"}, nil)
+	checkRegistry(tg, reg)
+	if !hasError(tg.report, `version "0.1" is not a valid semver`) || !hasError(tg.report, "not registered") {
+		t.Errorf("expected the version and the registration to be reported, got %v", tg.report.errs)
+	}
+
+	entry := &registry.Plugin{Name: "test", Reserved: true}
+	entry.Capabilities.Sourcing.Supported = true
+	tg = newTarget(&loader.Plugin{Name: "test", Version: "0.1.0-rc1+build"}, entry)
+	checkRegistry(tg, reg)
+	expected := []string{
+		"plugin uses a reserved registry entry",
+		"sourcing capability is false, but true in the registry",
+	}
+	if !reflect.DeepEqual(tg.report.errs, expected) {
+		t.Errorf("expected %v, got %v", expected, tg.report.errs)
+	}
+}
+
+func TestCheckUniqueness(t *testing.T) {
+	a := newTarget(&loader.Plugin{Name: "a"}, nil)
+	b := newTarget(&loader.Plugin{Name: "b"}, nil)
+	c := newTarget(&loader.Plugin{Name: "a"}, nil)
+	c.path = "other/liba.so"
+	checkUniqueness([]*target{a, b, c})
+	if len(a.report.errs) != 0 || len(b.report.errs) != 0 || !reflect.DeepEqual(c.report.errs, []string{"name is also used by a"}) {
+		t.Errorf("expected the duplicate name to be reported once, got %v %v %v", a.report.errs, b.report.errs, c.report.errs)
+	}
+}
+
+func TestSchemaProperties(t *testing.T) {
+	tests := []struct {
+		schema   string
+		expected []string
+		err      bool
+	}{
+		{`{"type":"object","properties":{"a":{"type":"string"},"b":{"type":"integer"},"c":1}}`, []string{"a", "b"}, false},
+		{`{"$ref":"#/definitions/C","definitions":{"C":{"type":"object","properties":{"a":{}}}}}`, []string{"a"}, false},
+		{`{"$ref":"#/$defs/C","$defs":{"C":{"type":"object","properties":{"a":{}}}}}`, []string{"a"}, false},
+		{`{"$ref":"#/definitions/D","definitions":{"C":{"type":"object"}}}`, nil, true},
+		{`{"type":"array"}`, nil, true},
+		{`{`, nil, true},
+	}
+	for _, test := range tests {
+		props, err := schemaProperties(test.schema)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.schema)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.schema, err.Error())
+		} else if names := sortedKeys(props); !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%s: expected the properties %v, got %v", test.schema, test.expected, names)
+		}
+	}
+}
+
+func TestValidValue(t *testing.T) {
+	tests := []struct {
+		prop     map[string]interface{}
+		expected interface{}
+		ok       bool
+	}{
+		{map[string]interface{}{"type": "string", "enum": []interface{}{"b", "a"}}, "b", true},
+		{map[string]interface{}{"type": "string"}, "", true},
+		{map[string]interface{}{"type": "integer", "minimum": 5.0}, 5.0, true},
+		{map[string]interface{}{"type": "number"}, 0, true},
+		{map[string]interface{}{"type": "boolean"}, false, true},
+		{map[string]interface{}{"type": "object"}, map[string]interface{}{}, true},
+		{map[string]interface{}{"type": "array"}, []interface{}{}, true},
+		{map[string]interface{}{"type": []interface{}{"string", "null"}}, nil, false},
+		{map[string]interface{}{}, nil, false},
+	}
+	for _, test := range tests {
+		v, ok := validValue(test.prop)
+		if ok != test.ok || !reflect.DeepEqual(v, test.expected) {
+			t.Errorf("%v: expected %v (%v), got %v (%v)", test.prop, test.expected, test.ok, v, ok)
+		}
+	}
+}
+
+func TestCheckRoundTrip(t *testing.T) {
+	tests := []struct {
+		data, str string
+		err       bool
+	}{
+		{`{"a":1,"b":[true]}`, `{"b":[true],"a":1.0}`, false},
+		{`{"a":1}`, `{"a":2}`, true},
+		// the other representations are not checked
+		{`{"a":1}`, `a=1`, false},
+		{`[1]`, `[2]`, false},
+		{`not json`, `{}`, false},
+	}
+	for _, test := range tests {
+		if err := checkRoundTrip([]byte(test.data), test.str); (err != nil) != test.err {
+			t.Errorf("%s as %s: expected an error: %v, got %v", test.data, test.str, test.err, err)
+		}
+	}
+}
+
+func TestSourcesOverlap(t *testing.T) {
+	tests := []struct {
+		a, b     []string
+		expected bool
+	}{
+		{nil, nil, true},
+		{nil, []string{"a"}, true},
+		{[]string{"a"}, nil, true},
+		{nil, []string{}, false},
+		{[]string{}, nil, false},
+		{[]string{"a", "b"}, []string{"c", "b"}, true},
+		{[]string{"a"}, []string{"b"}, false},
+	}
+	for _, test := range tests {
+		if sourcesOverlap(test.a, test.b) != test.expected {
+			t.Errorf("%#v and %#v: expected %v", test.a, test.b, test.expected)
+		}
+	}
+}
+
+func TestLoadEvents(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "plugins", "test")
+	golden := filepath.Join(dir, "pkg", "test", "testdata", "golden")
+	if err := os.MkdirAll(golden, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"b": "2", "a": "1", "a.golden": "{}"} {
+		if err := os.WriteFile(filepath.Join(golden, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the payloads of the corpus are read in order, without the expected
+	// values
+	tg := newTarget(&loader.Plugin{Name: "test"}, nil)
+	tg.path = filepath.Join(dir, "libtest.so")
+	events, err := loadEvents(tg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || string(events[0]) != "1" || string(events[1]) != "2" {
+		t.Errorf("expected the payloads of the corpus, got %q", events)
+	}
+}
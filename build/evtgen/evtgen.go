@@ -0,0 +1,211 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+var (
+	formatName string
+	count      uint64
+	rate       float64
+	batchSize  int
+	outputPath string
+	wrap       bool
+	targetURL  string
+	secret     string
+	insecure   bool
+	seed       int64
+)
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(1)
+}
+
+func main() {
+	pflag.StringVarP(&formatName, "format", "f", "", "Format of the generated events, one of: "+strings.Join(formatNames(), ", ")+".")
+	pflag.Uint64VarP(&count, "count", "n", 100, "Number of events to generate, 0 for no limit.")
+	pflag.Float64VarP(&rate, "rate", "r", 0, "Number of events generated per second, 0 for no limit.")
+	pflag.IntVarP(&batchSize, "batch", "b", 1, "Number of events written in each line or sent in each request, if the format supports batches.")
+	pflag.StringVarP(&outputPath, "output", "o", "", "File to write the events to, one per line (default: stdout).")
+	pflag.BoolVarP(&wrap, "wrap", "w", false, "Write the batches of events in the envelope received by the plugin (e.g. the Records of a CloudTrail file) instead of one event per line.")
+	pflag.StringVarP(&targetURL, "url", "u", "", "URL of a plugin webhook endpoint to send the events to instead of writing them.")
+	pflag.StringVarP(&secret, "secret", "s", "", "Secret authenticating the requests sent with --url, if the format supports it.")
+	pflag.BoolVar(&insecure, "insecure", false, "Skip the verification of the TLS certificate of --url.")
+	pflag.Int64Var(&seed, "seed", 1, "Seed of the random values, which are the same across runs for a given seed.")
+	pflag.Parse()
+
+	f, ok := formats[formatName]
+	if !ok {
+		pflag.Usage()
+		os.Exit(1)
+	}
+	if batchSize < 1 || (f.envelope == nil && batchSize > 1) {
+		fail(fmt.Errorf("batch size must be 1 for format %s, and at least 1 otherwise", formatName))
+	}
+
+	var w writer
+	if len(targetURL) > 0 {
+		w = newHTTPWriter(f)
+	} else {
+		out := os.Stdout
+		if len(outputPath) > 0 {
+			file, err := os.Create(outputPath)
+			if err != nil {
+				fail(err)
+			}
+			defer file.Close()
+			out = file
+		}
+		fw := &fileWriter{format: f, out: bufio.NewWriter(out)}
+		defer fw.out.Flush()
+		w = fw
+	}
+
+	if err := generate(f, w); err != nil {
+		fail(err)
+	}
+}
+
+// writer outputs a batch of events
+type writer interface {
+	write(items []json.RawMessage, header http.Header) error
+}
+
+// generate produces the events in batches, and paces the batches to
+// match the requested rate
+func generate(f *format, w writer) error {
+	g := newGenerator(seed)
+	var period time.Duration
+	if rate > 0 {
+		period = time.Duration(float64(time.Second) * float64(batchSize) / rate)
+	}
+
+	start := time.Now()
+	items := make([]json.RawMessage, 0, batchSize)
+	for n, batch := uint64(0), 0; count == 0 || n < count; batch++ {
+		if period > 0 {
+			time.Sleep(time.Until(start.Add(period * time.Duration(batch))))
+		}
+		items = items[:0]
+		var header http.Header
+		for len(items) < batchSize && (count == 0 || n < count) {
+			evt, h := f.sample(g)
+			data, err := json.Marshal(evt)
+			if err != nil {
+				return err
+			}
+			items = append(items, data)
+			header = h
+			n++
+		}
+		if err := w.write(items, header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileWriter writes the events one per line, or one batch per line
+// when wrapped in the envelope of the format
+type fileWriter struct {
+	format *format
+	out    *bufio.Writer
+}
+
+func (fw *fileWriter) write(items []json.RawMessage, header http.Header) error {
+	if wrap && fw.format.envelope != nil {
+		data, err := json.Marshal(fw.format.envelope(items))
+		if err != nil {
+			return err
+		}
+		items = []json.RawMessage{data}
+	}
+	for _, item := range items {
+		if _, err := fw.out.Write(item); err != nil {
+			return err
+		}
+		if err := fw.out.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// httpWriter sends each batch of events to a plugin webhook endpoint
+type httpWriter struct {
+	format *format
+	client *http.Client
+}
+
+func newHTTPWriter(f *format) *httpWriter {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: insecure}
+	return &httpWriter{
+		format: f,
+		client: &http.Client{Timeout: 30 * time.Second, Transport: transport},
+	}
+}
+
+func (hw *httpWriter) write(items []json.RawMessage, header http.Header) error {
+	body := []byte(items[0])
+	if hw.format.envelope != nil {
+		var err error
+		body, err = json.Marshal(hw.format.envelope(items))
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, targetURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(secret) > 0 && hw.format.sign != nil {
+		hw.format.sign(req, body, secret)
+	}
+
+	resp, err := hw.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response from %s: %s", targetURL, resp.Status)
+	}
+	return nil
+}
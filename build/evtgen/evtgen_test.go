@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// recorder records the batches of events written
+type recorder struct {
+	batches [][]json.RawMessage
+	headers []http.Header
+}
+
+func (r *recorder) write(items []json.RawMessage, header http.Header) error {
+	r.batches = append(r.batches, append([]json.RawMessage{}, items...))
+	r.headers = append(r.headers, header)
+	return nil
+}
+
+// setFlags sets the flags of the tool for the duration of a test
+func setFlags(t *testing.T, n uint64, batch int, w bool, url, s string) {
+	oldCount, oldBatch, oldWrap, oldURL, oldSecret := count, batchSize, wrap, targetURL, secret
+	count, batchSize, wrap, targetURL, secret = n, batch, w, url, s
+	t.Cleanup(func() {
+		count, batchSize, wrap, targetURL, secret = oldCount, oldBatch, oldWrap, oldURL, oldSecret
+	})
+}
+
+func TestSamples(t *testing.T) {
+	// the fields used by the rules of each plugin are generated
+	keys := map[string][]string{
+		"cloudtrail": {"eventID", "eventName", "eventSource", "eventTime", "userIdentity"},
+		"k8saudit":   {"auditID", "verb", "objectRef", "user", "stageTimestamp"},
+		"gcpaudit":   {"protoPayload", "resource", "timestamp", "logName"},
+		"okta":       {"uuid", "eventType", "published", "actor", "client"},
+		"github":     {"repository", "sender", "action", "webhook_type"},
+	}
+	for _, name := range formatNames() {
+		f := formats[name]
+		g := newGenerator(1)
+		for i := 0; i < 100; i++ {
+			evt, _ := f.sample(g)
+			for _, key := range keys[name] {
+				if _, ok := evt[key]; !ok {
+					t.Errorf("%s: expected the key %s in %v", name, key, evt)
+				}
+			}
+			if _, err := json.Marshal(evt); err != nil {
+				t.Errorf("%s: %s", name, err.Error())
+			}
+		}
+	}
+	if len(keys) != len(formats) {
+		t.Errorf("expected %d formats, got %v", len(keys), formatNames())
+	}
+}
+
+func TestSeed(t *testing.T) {
+	// the random values are the same for a given seed, apart from the
+	// timestamps
+	ids := func(seed int64) []string {
+		g := newGenerator(seed)
+		var res []string
+		for i := 0; i < 10; i++ {
+			evt, _ := formats["cloudtrail"].sample(g)
+			res = append(res, evt["eventID"].(string)+evt["eventName"].(string))
+		}
+		return res
+	}
+	a, b, c := ids(1), ids(1), ids(2)
+	if strings.Join(a, ",") != strings.Join(b, ",") {
+		t.Errorf("expected the same events for the same seed, got %v and %v", a, b)
+	}
+	if strings.Join(a, ",") == strings.Join(c, ",") {
+		t.Errorf("expected different events for different seeds, got %v", a)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	setFlags(t, 5, 2, false, "", "")
+	r := &recorder{}
+	if err := generate(formats["github"], r); err != nil {
+		t.Fatal(err)
+	}
+
+	// the last batch is partial, and the headers of the events are kept
+	if len(r.batches) != 3 || len(r.batches[0]) != 2 || len(r.batches[2]) != 1 {
+		t.Errorf("expected 3 batches of 2, 2 and 1 events, got %d", len(r.batches))
+	}
+	for i, h := range r.headers {
+		if h.Get("X-GitHub-Event") == "" || h.Get("X-GitHub-Delivery") == "" {
+			t.Errorf("batch %d: expected the github headers, got %v", i, h)
+		}
+	}
+}
+
+func TestFileWriter(t *testing.T) {
+	items := []json.RawMessage{json.RawMessage(`{"a":1}`), json.RawMessage(`{"b":2}`)}
+	tests := []struct {
+		format   string
+		wrap     bool
+		expected string
+	}{
+		{"cloudtrail", false, "{\"a\":1}\n{\"b\":2}\n"},
+		{"cloudtrail", true, "{\"Records\":[{\"a\":1},{\"b\":2}]}\n"},
+		// the formats without envelope are never wrapped
+		{"gcpaudit", true, "{\"a\":1}\n{\"b\":2}\n"},
+	}
+	for _, test := range tests {
+		setFlags(t, 0, 1, test.wrap, "", "")
+		var b bytes.Buffer
+		fw := &fileWriter{format: formats[test.format], out: bufio.NewWriter(&b)}
+		if err := fw.write(items, nil); err != nil {
+			t.Fatal(err)
+		}
+		fw.out.Flush()
+		if b.String() != test.expected {
+			t.Errorf("%s (wrap: %v): expected %q, got %q", test.format, test.wrap, test.expected, b.String())
+		}
+	}
+}
+
+func TestHTTPWriter(t *testing.T) {
+	var body []byte
+	var header http.Header
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	// the github requests are signed with the secret
+	setFlags(t, 1, 1, false, srv.URL, "secret")
+	items := []json.RawMessage{json.RawMessage(`{"a":1}`)}
+	hw := newHTTPWriter(formats["github"])
+	if err := hw.write(items, http.Header{"X-Github-Event": {"member"}}); err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	if string(body) != `{"a":1}` || header.Get("X-Hub-Signature-256") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("expected the signed payload, got %s %v", body, header)
+	}
+	if header.Get("X-GitHub-Event") != "member" || header.Get("Content-Type") != "application/json" {
+		t.Errorf("expected the headers of the event, got %v", header)
+	}
+
+	// the okta requests carry the batch in their envelope, and the secret
+	// in the Authorization header
+	items = append(items, json.RawMessage(`{"b":2}`))
+	if err := newHTTPWriter(formats["okta"]).write(items, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `"data":{"events":[{"a":1},{"b":2}]}`) || header.Get("Authorization") != "secret" {
+		t.Errorf("expected the events in the envelope, got %s %v", body, header)
+	}
+
+	status = http.StatusUnauthorized
+	if err := hw.write(items, nil); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected the error status to be returned, got %v", err)
+	}
+}
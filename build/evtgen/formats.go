@@ -0,0 +1,452 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+type object = map[string]interface{}
+
+// format generates the payloads of the events of a plugin
+type format struct {
+	// sample returns a random payload, along with the http headers to send
+	// it with
+	sample func(g *generator) (object, http.Header)
+	// envelope wraps a batch of payloads in the body of a request sent to the
+	// plugin, nil if each request carries a single payload
+	envelope func(items []json.RawMessage) object
+	// sign authenticates a request with a secret, nil if not supported
+	sign func(req *http.Request, body []byte, secret string)
+}
+
+var formats = map[string]*format{
+	"cloudtrail": {
+		sample: cloudtrailSample,
+		envelope: func(items []json.RawMessage) object {
+			return object{"Records": items}
+		},
+	},
+	"k8saudit": {
+		sample: k8sauditSample,
+		envelope: func(items []json.RawMessage) object {
+			return object{"kind": "EventList", "apiVersion": "audit.k8s.io/v1", "items": items}
+		},
+	},
+	"gcpaudit": {
+		sample: gcpauditSample,
+	},
+	"okta": {
+		sample: oktaSample,
+		envelope: func(items []json.RawMessage) object {
+			return object{
+				"eventType":          "com.okta.event_hook",
+				"eventTypeVersion":   "1.0",
+				"cloudEventsVersion": "0.1",
+				"source":             "https://example.okta.com/api/v1/eventHooks",
+				"contentType":        "application/json",
+				"data":               object{"events": items},
+			}
+		},
+		sign: func(req *http.Request, body []byte, secret string) {
+			req.Header.Set("Authorization", secret)
+		},
+	},
+	"github": {
+		sample: githubSample,
+		sign: func(req *http.Request, body []byte, secret string) {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write(body)
+			req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		},
+	},
+}
+
+func formatNames() []string {
+	var res []string
+	for name := range formats {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// generator picks the random values of the payloads, and is deterministic
+// for a given seed apart from the timestamps
+type generator struct {
+	rnd *rand.Rand
+}
+
+func newGenerator(seed int64) *generator {
+	return &generator{rnd: rand.New(rand.NewSource(seed))}
+}
+
+func (g *generator) pick(values ...string) string {
+	return values[g.rnd.Intn(len(values))]
+}
+
+func (g *generator) chance(percent int) bool {
+	return g.rnd.Intn(100) < percent
+}
+
+func (g *generator) hex(n int) string {
+	b := make([]byte, (n+1)/2)
+	g.rnd.Read(b)
+	return hex.EncodeToString(b)[:n]
+}
+
+func (g *generator) uuid() string {
+	s := g.hex(32)
+	return fmt.Sprintf("%s-%s-%s-%s-%s", s[0:8], s[8:12], s[12:16], s[16:20], s[20:32])
+}
+
+func (g *generator) ip() string {
+	// addresses of the documentation ranges (RFC 5737)
+	return fmt.Sprintf("%s.%d", g.pick("192.0.2", "198.51.100", "203.0.113"), 1+g.rnd.Intn(254))
+}
+
+var (
+	userNames  = []string{"alice", "bob", "carol", "dave", "eve", "mallory"}
+	userAgents = []string{
+		"aws-cli/2.15.30 Python/3.11.8 Linux/6.5.0 exe/x86_64.ubuntu.22",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Safari/537.36",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:123.0) Gecko/20100101 Firefox/123.0",
+		"terraform-provider-aws/5.40.0 (+https://registry.terraform.io/providers/hashicorp/aws)",
+	}
+)
+
+func cloudtrailSample(g *generator) (object, http.Header) {
+	type call struct {
+		source, name string
+		readOnly     bool
+		params       object
+	}
+	bucket := g.pick("logs", "backups", "website", "data-lake")
+	calls := []call{
+		{"s3.amazonaws.com", "GetObject", true, object{"bucketName": bucket, "key": "reports/" + g.hex(8) + ".csv"}},
+		{"s3.amazonaws.com", "PutObject", false, object{"bucketName": bucket, "key": "uploads/" + g.hex(8)}},
+		{"s3.amazonaws.com", "PutBucketPublicAccessBlock", false, object{"bucketName": bucket}},
+		{"s3.amazonaws.com", "DeleteBucket", false, object{"bucketName": bucket}},
+		{"iam.amazonaws.com", "CreateUser", false, object{"userName": g.pick(userNames...) + "-" + g.hex(4)}},
+		{"iam.amazonaws.com", "CreateAccessKey", false, object{"userName": g.pick(userNames...)}},
+		{"iam.amazonaws.com", "AttachUserPolicy", false, object{"userName": g.pick(userNames...), "policyArn": "arn:aws:iam::aws:policy/AdministratorAccess"}},
+		{"ec2.amazonaws.com", "RunInstances", false, object{"instanceType": g.pick("t3.micro", "m5.large", "p3.2xlarge")}},
+		{"ec2.amazonaws.com", "DescribeInstances", true, nil},
+		{"ec2.amazonaws.com", "AuthorizeSecurityGroupIngress", false, object{"groupId": "sg-" + g.hex(17)}},
+		{"cloudtrail.amazonaws.com", "StopLogging", false, object{"name": "management-events"}},
+		{"signin.amazonaws.com", "ConsoleLogin", false, nil},
+	}
+	c := calls[g.rnd.Intn(len(calls))]
+	account := g.pick("123456789012", "210987654321")
+	user := g.pick(userNames...)
+	region := g.pick("us-east-1", "us-west-2", "eu-west-1", "ap-southeast-2")
+
+	res := object{
+		"eventVersion": "1.08",
+		"userIdentity": object{
+			"type":        "IAMUser",
+			"principalId": "AIDA" + strings.ToUpper(g.hex(16)),
+			"arn":         fmt.Sprintf("arn:aws:iam::%s:user/%s", account, user),
+			"accountId":   account,
+			"accessKeyId": "AKIA" + strings.ToUpper(g.hex(16)),
+			"userName":    user,
+		},
+		"eventTime":          time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		"eventSource":        c.source,
+		"eventName":          c.name,
+		"awsRegion":          region,
+		"sourceIPAddress":    g.ip(),
+		"userAgent":          g.pick(userAgents...),
+		"requestParameters":  c.params,
+		"responseElements":   nil,
+		"requestID":          strings.ToUpper(g.hex(16)),
+		"eventID":            g.uuid(),
+		"readOnly":           c.readOnly,
+		"eventType":          "AwsApiCall",
+		"managementEvent":    true,
+		"recipientAccountId": account,
+		"eventCategory":      "Management",
+	}
+	if c.name == "ConsoleLogin" {
+		res["eventType"] = "AwsConsoleSignIn"
+		res["responseElements"] = object{"ConsoleLogin": g.pick("Success", "Success", "Failure")}
+		res["additionalEventData"] = object{"MFAUsed": g.pick("Yes", "No")}
+	} else if g.chance(10) {
+		res["errorCode"] = "AccessDenied"
+		res["errorMessage"] = fmt.Sprintf("User: %s is not authorized to perform: %s", res["userIdentity"].(object)["arn"], c.name)
+	}
+	return res, nil
+}
+
+func k8sauditSample(g *generator) (object, http.Header) {
+	namespace := g.pick("default", "kube-system", "monitoring", "payments")
+	resource := g.pick("pods", "pods", "secrets", "configmaps", "deployments", "clusterrolebindings")
+	verb := g.pick("get", "list", "create", "update", "patch", "delete")
+	name := resource[:len(resource)-1] + "-" + g.hex(5)
+	group := ""
+	if resource == "deployments" {
+		group = "apps"
+	} else if resource == "clusterrolebindings" {
+		group = "rbac.authorization.k8s.io"
+		namespace = ""
+	}
+
+	objectRef := object{"resource": resource, "name": name, "apiVersion": "v1"}
+	if group != "" {
+		objectRef["apiGroup"] = group
+	}
+	uri := "/api/v1/"
+	if group != "" {
+		uri = "/apis/" + group + "/v1/"
+	}
+	if namespace != "" {
+		objectRef["namespace"] = namespace
+		uri += "namespaces/" + namespace + "/"
+	}
+	uri += resource
+	if verb != "list" && verb != "create" {
+		uri += "/" + name
+	}
+
+	code := 200
+	if verb == "create" {
+		code = 201
+	}
+	decision := "allow"
+	if g.chance(5) {
+		code = 403
+		decision = "forbid"
+	}
+
+	now := time.Now().UTC()
+	res := object{
+		"kind":       "Event",
+		"apiVersion": "audit.k8s.io/v1",
+		"level":      "RequestResponse",
+		"auditID":    g.uuid(),
+		"stage":      "ResponseComplete",
+		"requestURI": uri,
+		"verb":       verb,
+		"user": object{
+			"username": g.pick("kubernetes-admin", "system:serviceaccount:kube-system:replicaset-controller", g.pick(userNames...)+"@example.com"),
+			"groups":   []string{"system:authenticated"},
+		},
+		"sourceIPs":                []string{g.ip()},
+		"userAgent":                g.pick("kubectl/v1.29.2 (linux/amd64) kubernetes/4b8e819", "kube-controller-manager/v1.29.2 (linux/amd64) kubernetes/4b8e819"),
+		"objectRef":                objectRef,
+		"responseStatus":           object{"metadata": object{}, "code": code},
+		"requestReceivedTimestamp": now.Format("2006-01-02T15:04:05.000000Z"),
+		"stageTimestamp":           now.Add(time.Millisecond * time.Duration(1+g.rnd.Intn(50))).Format("2006-01-02T15:04:05.000000Z"),
+		"annotations": object{
+			"authorization.k8s.io/decision": decision,
+			"authorization.k8s.io/reason":   "",
+		},
+	}
+	if resource == "pods" && verb == "create" {
+		res["requestObject"] = object{
+			"kind":       "Pod",
+			"apiVersion": "v1",
+			"metadata":   object{"name": name, "namespace": namespace},
+			"spec": object{
+				"hostNetwork": g.chance(10),
+				"containers": []object{{
+					"name":            "main",
+					"image":           g.pick("nginx:1.25", "busybox:1.36", "docker.io/library/alpine:3.19"),
+					"securityContext": object{"privileged": g.chance(10)},
+				}},
+			},
+		}
+	}
+	return res, nil
+}
+
+func gcpauditSample(g *generator) (object, http.Header) {
+	type call struct {
+		service, method, resourceType string
+		labels                        object
+	}
+	project := g.pick("prod-123456", "staging-654321")
+	bucket := g.pick("logs", "backups", "website")
+	calls := []call{
+		{"storage.googleapis.com", "storage.buckets.create", "gcs_bucket", object{"bucket_name": bucket, "location": "us-central1"}},
+		{"storage.googleapis.com", "storage.setIamPermissions", "gcs_bucket", object{"bucket_name": bucket, "location": "us-central1"}},
+		{"compute.googleapis.com", "v1.compute.instances.insert", "gce_instance", object{"instance_id": fmt.Sprint(g.rnd.Int63()), "zone": "us-central1-a"}},
+		{"compute.googleapis.com", "v1.compute.firewalls.insert", "gce_firewall_rule", object{"firewall_rule_id": fmt.Sprint(g.rnd.Int63())}},
+		{"iam.googleapis.com", "google.iam.admin.v1.CreateServiceAccountKey", "service_account", object{"email_id": "ci@" + project + ".iam.gserviceaccount.com", "unique_id": fmt.Sprint(g.rnd.Int63())}},
+		{"logging.googleapis.com", "google.logging.v2.ConfigServiceV2.DeleteSink", "logging_sink", object{"name": "audit-export"}},
+	}
+	c := calls[g.rnd.Intn(len(calls))]
+	c.labels["project_id"] = project
+	user := g.pick(userNames...) + "@example.com"
+
+	return object{
+		"protoPayload": object{
+			"@type":              "type.googleapis.com/google.cloud.audit.AuditLog",
+			"status":             object{},
+			"authenticationInfo": object{"principalEmail": user},
+			"requestMetadata": object{
+				"callerIp":                g.ip(),
+				"callerSuppliedUserAgent": g.pick(userAgents...),
+			},
+			"serviceName":  c.service,
+			"methodName":   c.method,
+			"resourceName": fmt.Sprintf("projects/%s/%s", project, g.hex(8)),
+			"authorizationInfo": []object{{
+				"permission": c.method,
+				"granted":    true,
+			}},
+		},
+		"insertId":         g.hex(12),
+		"resource":         object{"type": c.resourceType, "labels": c.labels},
+		"timestamp":        time.Now().UTC().Format(time.RFC3339Nano),
+		"severity":         "NOTICE",
+		"logName":          fmt.Sprintf("projects/%s/logs/cloudaudit.googleapis.com%%2Factivity", project),
+		"receiveTimestamp": time.Now().UTC().Format(time.RFC3339Nano),
+	}, nil
+}
+
+func oktaSample(g *generator) (object, http.Header) {
+	type event struct {
+		typ, legacy, message string
+	}
+	events := []event{
+		{"user.session.start", "core.user_auth.login_success", "User login to Okta"},
+		{"user.authentication.sso", "app.auth.sso", "User single sign on to app"},
+		{"user.mfa.factor.deactivate", "core.user.factor.deactivate", "Reset factor for user"},
+		{"user.account.privilege.grant", "core.user.admin_privilege.granted", "Grant user privilege"},
+		{"system.api_token.create", "api.token.create", "Create API token"},
+		{"policy.lifecycle.update", "", "Update policy"},
+	}
+	e := events[g.rnd.Intn(len(events))]
+	user := g.pick(userNames...)
+	result := "SUCCESS"
+	if g.chance(10) {
+		result = "FAILURE"
+	}
+
+	return object{
+		"uuid":            g.uuid(),
+		"published":       time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		"eventType":       e.typ,
+		"version":         "0",
+		"legacyEventType": e.legacy,
+		"displayMessage":  e.message,
+		"severity":        "INFO",
+		"actor": object{
+			"id":          "00u" + g.hex(17),
+			"type":        "User",
+			"alternateId": user + "@example.com",
+			"displayName": title(user),
+		},
+		"client": object{
+			"userAgent": object{
+				"rawUserAgent": g.pick(userAgents[1:]...),
+				"os":           g.pick("Mac OS X", "Windows 10", "Linux"),
+				"browser":      g.pick("CHROME", "FIREFOX"),
+			},
+			"zone":      "null",
+			"device":    "Computer",
+			"ipAddress": g.ip(),
+			"geographicalContext": object{
+				"city":        g.pick("Paris", "Berlin", "Denver"),
+				"state":       g.pick("Ile-de-France", "Berlin", "Colorado"),
+				"country":     g.pick("France", "Germany", "United States"),
+				"postalCode":  fmt.Sprintf("%05d", g.rnd.Intn(100000)),
+				"geolocation": object{"lat": 40 + g.rnd.Float64()*10, "lon": g.rnd.Float64() * 10},
+			},
+		},
+		"outcome":     object{"result": result, "reason": nil},
+		"transaction": object{"type": "WEB", "id": g.hex(24)},
+		"authenticationContext": object{
+			"externalSessionId": "102" + g.hex(22),
+		},
+		"securityContext": object{
+			"asNumber": 64496 + g.rnd.Intn(16),
+			"asOrg":    "example",
+			"isp":      "example isp",
+			"domain":   "example.com",
+			"isProxy":  false,
+		},
+		"target": []object{{
+			"id":          "00u" + g.hex(17),
+			"type":        "User",
+			"alternateId": g.pick(userNames...) + "@example.com",
+			"displayName": title(g.pick(userNames...)),
+		}},
+	}, nil
+}
+
+func githubSample(g *generator) (object, http.Header) {
+	org := g.pick("example-org", "example-labs")
+	repo := g.pick("api", "frontend", "infra", "docs")
+	repository := object{
+		"id":        g.rnd.Int31(),
+		"name":      repo,
+		"full_name": org + "/" + repo,
+		"private":   g.chance(70),
+		"owner":     object{"login": org, "type": "Organization"},
+		"html_url":  fmt.Sprintf("https://github.com/%s/%s", org, repo),
+	}
+	res := object{
+		"repository":   repository,
+		"organization": object{"login": org},
+		"sender":       object{"login": g.pick(userNames...), "type": "User"},
+	}
+
+	var typ string
+	switch g.rnd.Intn(4) {
+	case 0:
+		typ = "member"
+		res["action"] = g.pick("added", "edited", "removed")
+		res["member"] = object{"login": g.pick(userNames...), "type": "User"}
+		res["changes"] = object{"permission": object{"to": g.pick("read", "write", "admin")}}
+	case 1:
+		typ = "repository"
+		res["action"] = g.pick("publicized", "privatized", "deleted", "archived")
+	case 2:
+		typ = "meta"
+		res["action"] = "deleted"
+		res["hook_id"] = g.rnd.Int31()
+		res["hook"] = object{"type": "Repository", "id": res["hook_id"], "name": "web"}
+	default:
+		typ = "deploy_key"
+		res["action"] = g.pick("created", "deleted")
+		res["key"] = object{"id": g.rnd.Int31(), "title": "ci", "read_only": g.chance(50)}
+	}
+	// the plugin sets the type of the webhook from the header, so it's
+	// also added to the payload to get the same events in files
+	res["webhook_type"] = typ
+
+	header := http.Header{}
+	header.Set("X-GitHub-Event", typ)
+	header.Set("X-GitHub-Delivery", g.uuid())
+	return res, header
+}
+
+func title(s string) string {
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,339 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugins/shared/go/loader"
+	"github.com/falcosecurity/plugins/shared/go/replay"
+	"github.com/falcosecurity/plugins/shared/go/rules"
+	"github.com/spf13/pflag"
+)
+
+var (
+	pluginPath     string
+	initConfig     string
+	openParams     string
+	inputPath      string
+	extractorPaths []string
+	rulesPaths     []string
+	duration       time.Duration
+	maxEvents      uint64
+	batchSize      int
+)
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(1)
+}
+
+// check is a field reference of a rule condition, extracted by the plugin
+// defining the field
+type check struct {
+	plugin *loader.Plugin
+	field  []*loader.Field
+}
+
+// stats holds the measures taken during the simulation
+type stats struct {
+	events      uint64
+	extractions uint64
+	elapsed     time.Duration
+	busy        time.Duration
+	batches     []time.Duration
+	evts        []time.Duration
+}
+
+func main() {
+	pflag.StringVarP(&pluginPath, "plugin", "p", "", "File path to the plugin shared library.")
+	pflag.StringVarP(&initConfig, "config", "c", "", "Init config of the plugin, or @<path> to read it from a file.")
+	pflag.StringVarP(&openParams, "open-params", "o", "", "Open params of the plugin.")
+	pflag.StringVarP(&inputPath, "input", "i", "", "Replay bundle whose events are replayed in a loop, instead of opening the plugin event stream.")
+	pflag.StringArrayVarP(&extractorPaths, "extractor", "x", nil, "File path to another plugin extracting fields from the events, e.g. the json plugin. Can be repeated.")
+	pflag.StringArrayVarP(&rulesPaths, "rules", "r", nil, "Falco rules file whose conditions determine the fields extracted from each event. Can be repeated.")
+	pflag.DurationVarP(&duration, "duration", "d", 30*time.Second, "Duration of the simulation, 0 for no limit.")
+	pflag.Uint64VarP(&maxEvents, "max-events", "n", 0, "Number of events after which to stop, 0 for no limit.")
+	pflag.IntVar(&batchSize, "batch-size", int(sdk.DefaultBatchSize), "Number of events of the batches replayed from --input.")
+	pflag.Parse()
+
+	if len(pluginPath) == 0 || len(rulesPaths) == 0 {
+		pflag.Usage()
+		os.Exit(1)
+	}
+	if strings.HasPrefix(initConfig, "@") {
+		b, err := ioutil.ReadFile(initConfig[1:])
+		if err != nil {
+			fail(err)
+		}
+		initConfig = string(b)
+	}
+
+	plugin, err := loader.LoadPlugin(pluginPath)
+	if err != nil {
+		fail(err)
+	}
+	defer plugin.Unload()
+	if err := plugin.Init(initConfig); err != nil {
+		fail(fmt.Errorf("init failed: %s", err.Error()))
+	}
+
+	var input []replay.Event
+	if len(inputPath) > 0 {
+		if input, err = readInput(plugin); err != nil {
+			fail(err)
+		}
+	} else if !plugin.HasCapSourcing() {
+		fail(fmt.Errorf("plugin %s doesn't support the event sourcing capability, use --input", plugin.Name))
+	}
+
+	plugins := []*loader.Plugin{plugin}
+	for _, path := range extractorPaths {
+		p, err := loader.LoadPlugin(path)
+		if err != nil {
+			fail(err)
+		}
+		defer p.Unload()
+		if err := p.Init(""); err != nil {
+			fail(fmt.Errorf("%s: init failed: %s", p.Name, err.Error()))
+		}
+		p.SetEventSource(plugin.EventSource)
+		plugins = append(plugins, p)
+	}
+
+	ruleset, err := rules.Load(rulesPaths...)
+	if err != nil {
+		fail(err)
+	}
+	checks := resolveChecks(ruleset, plugin.EventSource, plugins)
+	fmt.Printf("rules:              %d (source %s)\n", len(ruleset.BySource(plugin.EventSource)), plugin.EventSource)
+	fmt.Printf("extractions/event:  %d\n", len(checks))
+
+	var s *stats
+	if input != nil {
+		s = simulateInput(plugin, input, checks)
+	} else {
+		s, err = simulateOpen(plugin, checks)
+		if err != nil {
+			fail(err)
+		}
+	}
+	printStats(s)
+}
+
+// readInput reads the events of the replay bundle
+func readInput(p *loader.Plugin) ([]replay.Event, error) {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r, err := replay.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if len(r.Header().EventSource) > 0 && !p.HasCapSourcing() {
+		p.SetEventSource(r.Header().EventSource)
+	}
+
+	var res []replay.Event
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("%s holds no event", inputPath)
+	}
+	return res, nil
+}
+
+// resolveChecks returns the field references of the rules of the event
+// source that are supported by the plugins, in the order in which Falco
+// extracts them
+func resolveChecks(ruleset *rules.Ruleset, source string, plugins []*loader.Plugin) []check {
+	var res []check
+	unknown := map[string]bool{}
+	for _, r := range ruleset.BySource(source) {
+		cond, err := ruleset.Parse(r.Condition)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: rule %s is skipped: %s\n", r.Name, err.Error())
+			continue
+		}
+		for _, name := range rules.Fields(cond) {
+			var c *check
+			reason := "not supported by the plugins"
+			for _, p := range plugins {
+				f, err := p.ParseField(name)
+				if err == nil {
+					c = &check{plugin: p, field: []*loader.Field{f}}
+					break
+				}
+				if !strings.HasSuffix(err.Error(), "is not supported by the plugin") {
+					reason = err.Error()
+				}
+			}
+			if c == nil {
+				if !unknown[name] {
+					fmt.Fprintf(os.Stderr, "warning: field %s is not extracted: %s\n", name, reason)
+					unknown[name] = true
+				}
+				continue
+			}
+			res = append(res, *c)
+		}
+	}
+	return res
+}
+
+// process extracts the fields of the checks from an event, one field at a
+// time like Falco does, and returns the time it took
+func process(e *loader.Event, checks []check, s *stats) time.Duration {
+	start := time.Now()
+	for _, c := range checks {
+		c.plugin.Extract(e, c.field)
+	}
+	d := time.Since(start)
+	s.events++
+	s.extractions += uint64(len(checks))
+	s.evts = append(s.evts, d)
+	return d
+}
+
+// simulateOpen consumes the event stream of the plugin, until the duration
+// expires, the maximum number of events is reached, the end of the stream
+// is reached, or the simulation is interrupted
+func simulateOpen(p *loader.Plugin, checks []check) (*stats, error) {
+	if err := p.Open(openParams); err != nil {
+		return nil, fmt.Errorf("open failed: %s", err.Error())
+	}
+	defer p.Close()
+
+	s := &stats{}
+	stop := stopper()
+	start := time.Now()
+	for !stop(s) {
+		t := time.Now()
+		evts, err := p.NextBatch(s.events + 1)
+		if err == sdk.ErrTimeout {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		if err != nil && err != loader.ErrEOF {
+			return nil, fmt.Errorf("next batch failed: %s", err.Error())
+		}
+		d := time.Since(t)
+		s.busy += d
+		s.batches = append(s.batches, d)
+		for i := 0; i < len(evts) && (maxEvents == 0 || s.events < maxEvents); i++ {
+			s.busy += process(&evts[i], checks, s)
+		}
+		if err == loader.ErrEOF {
+			break
+		}
+	}
+	s.elapsed = time.Since(start)
+	return s, nil
+}
+
+// simulateInput replays the events of the input in batches, in a loop
+// until the duration expires, the maximum number of events is reached, or
+// the simulation is interrupted
+func simulateInput(p *loader.Plugin, input []replay.Event, checks []check) *stats {
+	var evts []*loader.Event
+	for _, e := range input {
+		evt := p.NewEvent(0, e.Timestamp, e.Data)
+		defer evt.Free()
+		evts = append(evts, evt)
+	}
+
+	s := &stats{}
+	stop := stopper()
+	start := time.Now()
+	for i := 0; !stop(s); {
+		for n := 0; n < batchSize && (maxEvents == 0 || s.events < maxEvents); n++ {
+			e := evts[i%len(evts)]
+			e.Num = s.events + 1
+			s.busy += process(e, checks, s)
+			i++
+		}
+	}
+	s.elapsed = time.Since(start)
+	return s
+}
+
+// stopper returns a function telling whether the simulation must stop
+func stopper() func(s *stats) bool {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	var deadline <-chan time.Time
+	if duration > 0 {
+		deadline = time.After(duration)
+	}
+	return func(s *stats) bool {
+		if maxEvents > 0 && s.events >= maxEvents {
+			return true
+		}
+		select {
+		case <-interrupt:
+			return true
+		case <-deadline:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+func printStats(s *stats) {
+	fmt.Printf("events:             %d\n", s.events)
+	fmt.Printf("duration:           %s\n", s.elapsed.Round(time.Millisecond))
+	if s.events == 0 {
+		return
+	}
+	fmt.Printf("event rate:         %.0f events/s\n", float64(s.events)/s.elapsed.Seconds())
+	fmt.Printf("sustainable rate:   %.0f events/s\n", float64(s.events)/s.busy.Seconds())
+	if len(s.batches) > 0 {
+		fmt.Printf("events/batch:       %.1f\n", float64(s.events)/float64(len(s.batches)))
+		fmt.Printf("next batch latency: %s\n", percentiles(s.batches))
+	}
+	fmt.Printf("event latency:      %s\n", percentiles(s.evts))
+}
+
+func percentiles(d []time.Duration) string {
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	p := func(q float64) time.Duration {
+		return d[int(q*float64(len(d)-1))]
+	}
+	return fmt.Sprintf("p50=%s p90=%s p99=%s p99.9=%s max=%s", p(0.5), p(0.9), p(0.99), p(0.999), d[len(d)-1])
+}
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/falcosecurity/plugins/shared/go/loader"
+	"github.com/falcosecurity/plugins/shared/go/replay"
+)
+
+// writeBundle writes a replay bundle holding the given events, and sets
+// it as the input of the simulation for the duration of a test
+func writeBundle(t *testing.T, events ...replay.Event) {
+	path := filepath.Join(t.TempDir(), "bundle.jsonl.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := replay.NewWriter(f, replay.Header{Plugin: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range events {
+		if err := w.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	old := inputPath
+	inputPath = path
+	t.Cleanup(func() { inputPath = old })
+}
+
+func TestReadInput(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	writeBundle(t, replay.Event{Timestamp: ts, Data: []byte(`{"a":1}`)}, replay.Event{Timestamp: ts.Add(time.Second), Data: []byte("b")})
+	events, err := readInput(&loader.Plugin{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || string(events[0].Data) != `{"a":1}` || !events[1].Timestamp.Equal(ts.Add(time.Second)) {
+		t.Errorf("expected the events of the bundle, got %v", events)
+	}
+
+	writeBundle(t)
+	if _, err := readInput(&loader.Plugin{}); err == nil || !strings.HasSuffix(err.Error(), "holds no event") {
+		t.Errorf("expected an error with an empty bundle, got %v", err)
+	}
+	inputPath = filepath.Join(t.TempDir(), "missing")
+	if _, err := readInput(&loader.Plugin{}); err == nil {
+		t.Error("expected an error with a missing bundle")
+	}
+}
+
+func TestStopper(t *testing.T) {
+	oldDuration, oldMax := duration, maxEvents
+	defer func() { duration, maxEvents = oldDuration, oldMax }()
+
+	duration, maxEvents = 0, 10
+	stop := stopper()
+	if stop(&stats{events: 9}) || !stop(&stats{events: 10}) {
+		t.Error("expected the simulation to stop at the maximum number of events")
+	}
+
+	duration, maxEvents = 20*time.Millisecond, 0
+	stop = stopper()
+	if stop(&stats{events: 1000}) {
+		t.Error("expected the simulation to go on without maximum number of events")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if !stop(&stats{}) {
+		t.Error("expected the simulation to stop once the duration expired")
+	}
+}
+
+func TestProcess(t *testing.T) {
+	s := &stats{}
+	process(&loader.Event{}, nil, s)
+	process(&loader.Event{}, nil, s)
+	if s.events != 2 || s.extractions != 0 || len(s.evts) != 2 {
+		t.Errorf("expected the events to be counted, got %+v", s)
+	}
+}
+
+func TestPercentiles(t *testing.T) {
+	var d []time.Duration
+	for i := 1000; i > 0; i-- {
+		d = append(d, time.Duration(i)*time.Millisecond)
+	}
+	expected := "p50=500ms p90=900ms p99=990ms p99.9=999ms max=1s"
+	if p := percentiles(d); p != expected {
+		t.Errorf("expected %s, got %s", expected, p)
+	}
+	if p := percentiles([]time.Duration{time.Second}); p != "p50=1s p90=1s p99=1s p99.9=1s max=1s" {
+		t.Errorf("expected a single measure, got %s", p)
+	}
+}
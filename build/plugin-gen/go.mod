@@ -0,0 +1,5 @@
+module github.com/falcosecurity/plugins/build/plugin-gen
+
+go 1.17
+
+require github.com/spf13/pflag v1.0.5
@@ -0,0 +1,254 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	kindSource    = "source"
+	kindExtractor = "extractor"
+	kindBoth      = "both"
+)
+
+// devPluginID is the ID reserved by the registry for the development of
+// the sourcing plugins, until an actual one is requested
+const devPluginID = 999
+
+var (
+	// the same rules as the registry
+	nameRegexp   = regexp.MustCompile(`^[a-z]+[a-z0-9-_]*$`)
+	sourceRegexp = regexp.MustCompile(`^[a-z]+[a-z0-9_]*$`)
+)
+
+//go:embed templates
+var templates embed.FS
+
+// files maps the templates to the path of the files they generate in the
+// directory of the plugin, where PKG is replaced by the name of its package
+var files = []struct {
+	template string
+	path     string
+	// the file is only generated for the plugins extracting fields
+	extraction bool
+}{
+	{template: "go.mod.tmpl", path: "go.mod"},
+	{template: "Makefile.tmpl", path: "Makefile"},
+	{template: "README.md.tmpl", path: "README.md"},
+	{template: "main.go.tmpl", path: "plugin/PKG.go"},
+	{template: "plugin.go.tmpl", path: "pkg/PKG/PKG.go"},
+	{template: "plugin_test.go.tmpl", path: "pkg/PKG/PKG_test.go"},
+	{template: "event.json.tmpl", path: "pkg/PKG/testdata/golden/01-event.json", extraction: true},
+	{template: "event.json.golden.tmpl", path: "pkg/PKG/testdata/golden/01-event.json.golden", extraction: true},
+}
+
+// sharedModules are the shared modules required by the generated plugins
+var sharedModules = []string{"fieldschema", "golden"}
+
+// plugin is the data the templates are rendered with
+type plugin struct {
+	Name        string
+	Package     string
+	ID          uint32
+	Source      string
+	Sources     []string
+	Prefix      string
+	Description string
+	Sourcing    bool
+	Extraction  bool
+	Year        int
+	// Shared is the relative path of shared/go from the plugin directory
+	Shared string
+}
+
+var (
+	name        string
+	kind        string
+	id          uint32
+	eventSource string
+	sources     []string
+	description string
+	outputDir   string
+	rootDir     string
+	tidy        bool
+)
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(1)
+}
+
+func main() {
+	pflag.StringVarP(&name, "name", "n", "", "Name of the plugin, also the name of its directory.")
+	pflag.StringVarP(&kind, "kind", "k", kindBoth, "Capabilities of the plugin, one of: source, extractor, both.")
+	pflag.Uint32Var(&id, "id", devPluginID, "ID of the sourcing plugin, the one reserved for development until an actual one is registered.")
+	pflag.StringVar(&eventSource, "source", "", "Event source of the sourcing plugin (default: the name of the plugin).")
+	pflag.StringSliceVar(&sources, "sources", nil, "Event sources the fields of an extractor-only plugin are extracted from (default: all).")
+	pflag.StringVarP(&description, "description", "d", "", "Description of the plugin.")
+	pflag.StringVarP(&outputDir, "output", "o", "plugins", "Directory in which the directory of the plugin is created.")
+	pflag.StringVar(&rootDir, "root", ".", "Root of the plugins repository, whose shared modules are required by the plugin.")
+	pflag.BoolVar(&tidy, "tidy", true, "Run go mod tidy in the generated plugin.")
+	pflag.Parse()
+
+	p, err := newPlugin()
+	if err != nil {
+		fail(err)
+	}
+	dir := filepath.Join(outputDir, name)
+	if _, err := os.Stat(dir); err == nil {
+		fail(fmt.Errorf("%s already exists", dir))
+	}
+	if p.Shared, err = sharedPath(dir); err != nil {
+		fail(err)
+	}
+	if err := generate(p, dir); err != nil {
+		fail(err)
+	}
+	if tidy {
+		cmd := exec.Command("go", "mod", "tidy")
+		cmd.Dir = dir
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fail(fmt.Errorf("go mod tidy: %s", err.Error()))
+		}
+	}
+	fmt.Printf("plugin %s generated in %s, build it with: make -C %s\n", name, dir, dir)
+	if p.Sourcing && p.ID == devPluginID {
+		fmt.Printf("the ID %d is reserved for development, an actual one must be requested in registry.yaml\n", devPluginID)
+	}
+	fmt.Println("the plugin must be added to registry.yaml before it passes the conformance checks")
+}
+
+// newPlugin validates the flags and returns the data of the plugin
+func newPlugin() (*plugin, error) {
+	if !nameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("invalid plugin name %q, must match %s", name, nameRegexp.String())
+	}
+	p := &plugin{
+		Name:        name,
+		Package:     strings.NewReplacer("-", "", "_", "").Replace(name),
+		Prefix:      strings.Replace(name, "-", "_", -1),
+		Description: description,
+		Year:        time.Now().Year(),
+	}
+	if len(p.Description) == 0 {
+		p.Description = "Falco plugin " + name
+	}
+	switch kind {
+	case kindSource:
+		p.Sourcing = true
+	case kindExtractor:
+		p.Extraction = true
+	case kindBoth:
+		p.Sourcing, p.Extraction = true, true
+	default:
+		return nil, fmt.Errorf("invalid kind %q, must be one of: source, extractor, both", kind)
+	}
+
+	if p.Sourcing {
+		if id == 0 {
+			return nil, fmt.Errorf("the plugin ID 0 is reserved")
+		}
+		p.ID = id
+		p.Source = eventSource
+		if len(p.Source) == 0 {
+			p.Source = p.Prefix
+		}
+		if !sourceRegexp.MatchString(p.Source) {
+			return nil, fmt.Errorf("invalid event source %q, must match %s", p.Source, sourceRegexp.String())
+		}
+		if len(sources) > 0 {
+			return nil, fmt.Errorf("--sources only applies to the extractor-only plugins")
+		}
+	} else {
+		if pflag.CommandLine.Changed("id") || len(eventSource) > 0 {
+			return nil, fmt.Errorf("--id and --source only apply to the sourcing plugins")
+		}
+		p.Sources = sources
+	}
+	return p, nil
+}
+
+// sharedPath returns the path of the shared modules relative to the
+// directory of the plugin, for the replace directives of its go.mod
+func sharedPath(dir string) (string, error) {
+	shared, err := filepath.Abs(filepath.Join(rootDir, "shared", "go"))
+	if err != nil {
+		return "", err
+	}
+	for _, m := range sharedModules {
+		if _, err := os.Stat(filepath.Join(shared, m, "go.mod")); err != nil {
+			return "", fmt.Errorf("shared module %s not found, --root must be the root of the plugins repository: %s", m, err.Error())
+		}
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(abs, shared)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// generate renders the templates of the files of the plugin in dir
+func generate(p *plugin, dir string) error {
+	tmpl, err := template.ParseFS(templates, "templates/*.tmpl")
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.extraction && !p.Extraction {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, f.template, p); err != nil {
+			return err
+		}
+		data := buf.Bytes()
+		path := filepath.Join(dir, strings.Replace(f.path, "PKG", p.Package, -1))
+		if strings.HasSuffix(path, ".go") {
+			if data, err = format.Source(data); err != nil {
+				return fmt.Errorf("%s: %s", f.template, err.Error())
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
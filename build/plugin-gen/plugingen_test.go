@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// setFlags sets the flags of the tool for the duration of a test
+func setFlags(t *testing.T, n, k string, i uint32, src string, srcs []string) {
+	oldName, oldKind, oldID, oldSource, oldSources := name, kind, id, eventSource, sources
+	name, kind, id, eventSource, sources = n, k, i, src, srcs
+	t.Cleanup(func() {
+		name, kind, id, eventSource, sources = oldName, oldKind, oldID, oldSource, oldSources
+	})
+}
+
+func TestNewPlugin(t *testing.T) {
+	tests := []struct {
+		name, kind string
+		id         uint32
+		source     string
+		sources    []string
+		expected   plugin
+		err        string
+	}{
+		{"my-plugin", kindBoth, devPluginID, "", nil, plugin{Name: "my-plugin", Package: "myplugin", Prefix: "my_plugin", ID: devPluginID, Source: "my_plugin", Sourcing: true, Extraction: true}, ""},
+		{"src", kindSource, 42, "custom", nil, plugin{Name: "src", Package: "src", Prefix: "src", ID: 42, Source: "custom", Sourcing: true}, ""},
+		{"ext_a", kindExtractor, devPluginID, "", []string{"aws_cloudtrail"}, plugin{Name: "ext_a", Package: "exta", Prefix: "ext_a", Sources: []string{"aws_cloudtrail"}, Extraction: true}, ""},
+		{"My", kindBoth, devPluginID, "", nil, plugin{}, "invalid plugin name"},
+		{"1a", kindBoth, devPluginID, "", nil, plugin{}, "invalid plugin name"},
+		{"a", "other", devPluginID, "", nil, plugin{}, "invalid kind"},
+		{"a", kindSource, 0, "", nil, plugin{}, "ID 0 is reserved"},
+		{"a", kindSource, devPluginID, "a-b", nil, plugin{}, "invalid event source"},
+		{"a", kindSource, devPluginID, "", []string{"b"}, plugin{}, "--sources only applies"},
+		{"a", kindExtractor, devPluginID, "b", nil, plugin{}, "--id and --source only apply"},
+	}
+	for _, test := range tests {
+		setFlags(t, test.name, test.kind, test.id, test.source, test.sources)
+		p, err := newPlugin()
+		if len(test.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected the error %q, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+			continue
+		}
+		test.expected.Description = "Falco plugin " + test.name
+		test.expected.Year = p.Year
+		if !reflect.DeepEqual(*p, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, *p)
+		}
+	}
+}
+
+func TestSharedPath(t *testing.T) {
+	old := rootDir
+	defer func() { rootDir = old }()
+	rootDir = "../.."
+	root, _ := filepath.Abs(rootDir)
+	if p, err := sharedPath(filepath.Join(root, "plugins", "test")); err != nil || p != "../../shared/go" {
+		t.Errorf("expected the shared modules relatively to the plugin, got %s (%v)", p, err)
+	}
+	rootDir = t.TempDir()
+	if _, err := sharedPath("plugins/test"); err == nil || !strings.Contains(err.Error(), "--root must be the root") {
+		t.Errorf("expected an error outside of the repository, got %v", err)
+	}
+}
+
+// TestGenerate checks that the plugins generated for each kind build and
+// pass their own tests, with the modules of the local cache
+func TestGenerate(t *testing.T) {
+	old := rootDir
+	defer func() { rootDir = old }()
+	rootDir = "../.."
+	for _, k := range []string{kindSource, kindExtractor, kindBoth} {
+		setFlags(t, "gen-"+k, k, devPluginID, "", nil)
+		p, err := newPlugin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := filepath.Join(t.TempDir(), p.Name)
+		if p.Shared, err = sharedPath(dir); err != nil {
+			t.Fatal(err)
+		}
+		if err := generate(p, dir); err != nil {
+			t.Fatalf("%s: %s", k, err.Error())
+		}
+
+		var generated []string
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				rel, _ := filepath.Rel(dir, path)
+				generated = append(generated, filepath.ToSlash(rel))
+			}
+			return err
+		})
+		sort.Strings(generated)
+		var expected []string
+		for _, f := range files {
+			if !f.extraction || p.Extraction {
+				expected = append(expected, strings.Replace(f.path, "PKG", p.Package, -1))
+			}
+		}
+		sort.Strings(expected)
+		if strings.Join(generated, ",") != strings.Join(expected, ",") {
+			t.Errorf("%s: expected the files %v, got %v", k, expected, generated)
+		}
+
+		if testing.Short() {
+			continue
+		}
+		for _, args := range [][]string{{"mod", "tidy"}, {"vet", "./..."}, {"test", "./..."}} {
+			cmd := exec.Command("go", args...)
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "GOPROXY=off", "GOFLAGS=-mod=mod")
+			out, err := cmd.CombinedOutput()
+			if err != nil && args[0] == "mod" {
+				t.Skipf("the modules required by the plugin are not in the cache: %s", out)
+			}
+			if err != nil {
+				t.Errorf("%s: go %s failed: %s", k, strings.Join(args, " "), out)
+			}
+		}
+	}
+}
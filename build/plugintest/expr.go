@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/falcosecurity/plugins/shared/go/loader"
+	"github.com/falcosecurity/plugins/shared/go/rules"
+)
+
+// exprFilter evaluates a condition in the Falco filter syntax against the
+// events, with the values of the fields extracted by the plugin
+type exprFilter struct {
+	cond   rules.Node
+	names  []string
+	fields []*loader.Field
+	// the number of events evaluated and of the ones matching
+	evaluated, matched uint64
+}
+
+// newExprFilter parses a condition, whose macros and lists can be the ones
+// of the given rules files, and resolves its fields with the plugin
+func newExprFilter(p *loader.Plugin, expr string, rulesPaths []string) (*exprFilter, error) {
+	ruleset, err := rules.Load(rulesPaths...)
+	if err != nil {
+		return nil, err
+	}
+	cond, err := ruleset.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression: %s", err.Error())
+	}
+	f := &exprFilter{cond: cond}
+	seen := map[string]bool{}
+	for _, name := range rules.Fields(cond) {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		field, err := p.ParseField(name)
+		if err != nil {
+			return nil, err
+		}
+		f.names = append(f.names, name)
+		f.fields = append(f.fields, field)
+	}
+	return f, nil
+}
+
+// match returns true if an event satisfies the condition. Like in Falco,
+// a check on a field that has no value is false, unless negated.
+func (f *exprFilter) match(p *loader.Plugin, e *loader.Event) (bool, error) {
+	values, err := p.Extract(e, f.fields)
+	if err != nil {
+		return false, fmt.Errorf("extract failed on event #%d: %s", e.Num, err.Error())
+	}
+	byName := make(map[string][]string, len(f.names))
+	for i, name := range f.names {
+		byName[name] = values[i]
+	}
+	f.evaluated++
+	ok := rules.Eval(f.cond, func(name string) ([]string, bool) {
+		v := byName[name]
+		return v, v != nil
+	})
+	if ok {
+		f.matched++
+	}
+	return ok, nil
+}
+
+// check prints the number of events matching the condition, and fails if
+// it is out of the expected bounds, a negative max being no bound
+func (f *exprFilter) check(min uint64, max int64) error {
+	fmt.Printf("%d/%d events matched\n", f.matched, f.evaluated)
+	if f.matched < min {
+		return fmt.Errorf("expected at least %d matching events", min)
+	}
+	if max >= 0 && f.matched > uint64(max) {
+		return fmt.Errorf("expected at most %d matching events", max)
+	}
+	return nil
+}
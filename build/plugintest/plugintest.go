@@ -0,0 +1,275 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugins/shared/go/loader"
+	"github.com/spf13/pflag"
+)
+
+const inputMaxLineSize = 16 * 1024 * 1024
+
+var (
+	pluginPath  string
+	initConfig  string
+	openParams  string
+	inputPath   string
+	eventSource string
+	fieldNames  []string
+	maxEvents   uint64
+	timeout     time.Duration
+	maxDataLen  int
+	expr        string
+	rulesPaths  []string
+	minMatches  uint64
+	maxMatches  int64
+)
+
+// filter selects the events printed, if an expression is given
+var filter *exprFilter
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(1)
+}
+
+func main() {
+	pflag.StringVarP(&pluginPath, "plugin", "p", "", "File path to the plugin shared library.")
+	pflag.StringVarP(&initConfig, "config", "c", "", "Init config of the plugin, or @<path> to read it from a file.")
+	pflag.StringVarP(&openParams, "open-params", "o", "", "Open params of the plugin.")
+	pflag.StringVarP(&inputPath, "input", "i", "", "File with one event payload per line to extract from, instead of opening the plugin event stream.")
+	pflag.StringVarP(&eventSource, "source", "s", "", "Event source of the payloads read from --input (default: the one of the plugin).")
+	pflag.StringArrayVarP(&fieldNames, "field", "f", nil, "Field to extract, e.g. foo.bar or foo.bar[arg]. Can be repeated (default: all the fields that don't require an argument).")
+	pflag.Uint64VarP(&maxEvents, "max-events", "n", 10, "Number of events after which to stop, 0 for no limit.")
+	pflag.DurationVarP(&timeout, "timeout", "t", 0, "Duration after which to stop, 0 for no limit.")
+	pflag.IntVar(&maxDataLen, "max-data-len", 512, "Number of bytes of the event payloads to print, 0 for no limit.")
+	pflag.StringVarP(&expr, "expr", "e", "", "Condition in the Falco filter syntax on the fields of the plugin, e.g. 'foo.bar = x and foo.baz exists'. Only the events matching it are printed.")
+	pflag.StringArrayVarP(&rulesPaths, "rules", "r", nil, "Rules file whose macros and lists can be referenced by --expr. Can be repeated.")
+	pflag.Uint64Var(&minMatches, "min-matches", 0, "Minimum number of events matching --expr, below which the tool fails.")
+	pflag.Int64Var(&maxMatches, "max-matches", -1, "Maximum number of events matching --expr, above which the tool fails, -1 for no limit.")
+	pflag.Parse()
+
+	if len(pluginPath) == 0 {
+		pflag.Usage()
+		os.Exit(1)
+	}
+	if strings.HasPrefix(initConfig, "@") {
+		b, err := ioutil.ReadFile(initConfig[1:])
+		if err != nil {
+			fail(err)
+		}
+		initConfig = string(b)
+	}
+
+	plugin, err := loader.LoadPlugin(pluginPath)
+	if err != nil {
+		fail(err)
+	}
+	defer plugin.Unload()
+	printInfo(plugin)
+
+	if err := plugin.Init(initConfig); err != nil {
+		fail(fmt.Errorf("init failed: %s", err.Error()))
+	}
+
+	fields, err := parseFields(plugin)
+	if err != nil {
+		fail(err)
+	}
+	if len(expr) > 0 {
+		if !plugin.HasCapExtraction() {
+			fail(fmt.Errorf("--expr requires a plugin with the field extraction capability"))
+		}
+		if filter, err = newExprFilter(plugin, expr, rulesPaths); err != nil {
+			fail(err)
+		}
+	}
+
+	if len(inputPath) > 0 {
+		if len(eventSource) > 0 {
+			plugin.SetEventSource(eventSource)
+		}
+		err = extractInput(plugin, fields)
+	} else {
+		err = extractOpen(plugin, fields)
+	}
+	if err != nil {
+		fail(err)
+	}
+	if filter != nil {
+		if err := filter.check(minMatches, maxMatches); err != nil {
+			fail(err)
+		}
+	}
+}
+
+func printInfo(p *loader.Plugin) {
+	fmt.Printf("name:          %s\n", p.Name)
+	fmt.Printf("version:       %s\n", p.Version)
+	fmt.Printf("id:            %d\n", p.ID)
+	fmt.Printf("event source:  %s\n", p.EventSource)
+	fmt.Printf("sourcing:      %t\n", p.HasCapSourcing())
+	fmt.Printf("extraction:    %t (%d fields)\n", p.HasCapExtraction(), len(p.Fields))
+	fmt.Println()
+}
+
+func parseFields(p *loader.Plugin) ([]*loader.Field, error) {
+	if !p.HasCapExtraction() {
+		return nil, nil
+	}
+	var res []*loader.Field
+	if len(fieldNames) == 0 {
+		for _, entry := range p.Fields {
+			if !entry.Arg.IsRequired {
+				fieldNames = append(fieldNames, entry.Name)
+			}
+		}
+	}
+	for _, name := range fieldNames {
+		f, err := p.ParseField(name)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, f)
+	}
+	return res, nil
+}
+
+// extractOpen opens the plugin event stream, and prints its events along
+// with the fields extracted from them
+func extractOpen(p *loader.Plugin, fields []*loader.Field) error {
+	if err := p.Open(openParams); err != nil {
+		return fmt.Errorf("open failed: %s", err.Error())
+	}
+	defer p.Close()
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	num := uint64(1)
+	for maxEvents == 0 || num <= maxEvents {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return nil
+		}
+		evts, err := p.NextBatch(num)
+		if err == sdk.ErrTimeout {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		if err != nil && err != loader.ErrEOF {
+			return fmt.Errorf("next batch failed: %s", err.Error())
+		}
+		for i := range evts {
+			if maxEvents > 0 && num > maxEvents {
+				return nil
+			}
+			if err := printEvent(p, &evts[i], fields); err != nil {
+				return err
+			}
+			num++
+		}
+		if err == loader.ErrEOF {
+			fmt.Println("EOF")
+			return nil
+		}
+	}
+	return nil
+}
+
+// extractInput reads the event payloads from the input file, and prints
+// the fields extracted from them
+func extractInput(p *loader.Plugin, fields []*loader.Field) error {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), inputMaxLineSize)
+	num := uint64(1)
+	for scanner.Scan() && (maxEvents == 0 || num <= maxEvents) {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		evt := p.NewEvent(num, time.Now(), line)
+		err := printEvent(p, evt, fields)
+		evt.Free()
+		if err != nil {
+			return err
+		}
+		num++
+	}
+	return scanner.Err()
+}
+
+// printEvent prints an event along with the fields extracted from it,
+// unless it doesn't match the expression
+func printEvent(p *loader.Plugin, e *loader.Event, fields []*loader.Field) error {
+	if filter != nil {
+		ok, err := filter.match(p, e)
+		if err != nil || !ok {
+			return err
+		}
+	}
+	str := p.EventToString(e)
+	if len(str) == 0 {
+		str = string(e.Data)
+	}
+	if maxDataLen > 0 && len(str) > maxDataLen {
+		end := maxDataLen
+		for end > 0 && !utf8.RuneStart(str[end]) {
+			end--
+		}
+		str = str[:end] + "..."
+	}
+	fmt.Printf("#%d %s %s\n", e.Num, e.Timestamp.UTC().Format(time.RFC3339Nano), str)
+
+	values, err := p.Extract(e, fields)
+	if err != nil {
+		return fmt.Errorf("extract failed on event #%d: %s", e.Num, err.Error())
+	}
+	for i, f := range fields {
+		name := f.Name
+		if f.HasArg {
+			name = fmt.Sprintf("%s[%s]", f.Name, f.Arg)
+		}
+		switch {
+		case values[i] == nil:
+			fmt.Printf("  %s = <NA>\n", name)
+		case f.Entry.IsList:
+			fmt.Printf("  %s = (%s)\n", name, strings.Join(values[i], ","))
+		default:
+			fmt.Printf("  %s = %s\n", name, values[i][0])
+		}
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/falcosecurity/plugins/shared/go/loader"
+)
+
+var (
+	dummyOnce sync.Once
+	dummyPath string
+	dummyErr  error
+	dummyDir  string
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if len(dummyDir) > 0 {
+		os.RemoveAll(dummyDir)
+	}
+	os.Exit(code)
+}
+
+// loadDummy builds the dummy plugin once, and returns it loaded and
+// initialized. The plugins can't be unloaded from the test process, whose
+// Go runtime can't be stopped.
+func loadDummy(t *testing.T) *loader.Plugin {
+	dummyOnce.Do(func() {
+		if dummyDir, dummyErr = ioutil.TempDir("", "plugintest"); dummyErr != nil {
+			return
+		}
+		dummyPath = filepath.Join(dummyDir, "libdummy.so")
+		cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", dummyPath, "./plugin")
+		cmd.Dir = "../../plugins/dummy"
+		if out, err := cmd.CombinedOutput(); err != nil {
+			dummyErr = fmt.Errorf("%s: %s", err.Error(), out)
+		}
+	})
+	if dummyErr != nil {
+		t.Skipf("the dummy plugin can't be built: %s", dummyErr.Error())
+	}
+	p, err := loader.LoadPlugin(dummyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(`{"jitter":0}`); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Destroy)
+	return p
+}
+
+// capture returns what f prints on the standard output
+func capture(t *testing.T, f func() error) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	out := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		out <- b
+	}()
+	err = f()
+	os.Stdout = stdout
+	w.Close()
+	res := string(<-out)
+	if err != nil {
+		t.Fatalf("%s\n%s", err.Error(), res)
+	}
+	return res
+}
+
+// setFlags sets the flags of the tool for the duration of a test
+func setFlags(t *testing.T, params, input string, fields []string, n uint64) {
+	oldParams, oldInput, oldFields, oldMax, oldFilter := openParams, inputPath, fieldNames, maxEvents, filter
+	openParams, inputPath, fieldNames, maxEvents, filter = params, input, fields, n, nil
+	t.Cleanup(func() {
+		openParams, inputPath, fieldNames, maxEvents, filter = oldParams, oldInput, oldFields, oldMax, oldFilter
+	})
+}
+
+func TestExtractOpen(t *testing.T) {
+	p := loadDummy(t)
+	setFlags(t, `{"start":1,"maxEvents":3}`, "", []string{"dummy.value", "dummy.divisible[2]"}, 10)
+	fields, err := parseFields(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := capture(t, func() error { return extractOpen(p, fields) })
+
+	// the events are printed with their fields until the end of the
+	// stream, the sample being incremented before each event
+	for _, expected := range []string{"#1 ", "  dummy.value = 2\n  dummy.divisible[2] = 1\n", "#3 ", "  dummy.value = 4\n", "EOF\n"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "#4 ") {
+		t.Errorf("expected 3 events, got:\n%s", out)
+	}
+
+	// the number of events is limited
+	setFlags(t, `{"start":1,"maxEvents":0}`, "", []string{"dummy.value"}, 2)
+	fields, _ = parseFields(p)
+	out = capture(t, func() error { return extractOpen(p, fields) })
+	if !strings.Contains(out, "#2 ") || strings.Contains(out, "#3 ") || strings.Contains(out, "EOF") {
+		t.Errorf("expected 2 events, got:\n%s", out)
+	}
+}
+
+func TestExtractInput(t *testing.T) {
+	p := loadDummy(t)
+	path := filepath.Join(t.TempDir(), "input")
+	if err := ioutil.WriteFile(path, []byte("5\n\n  7 \n9\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setFlags(t, "", path, nil, 2)
+	fields, err := parseFields(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// all the fields without argument are extracted by default, and the
+	// blank lines are skipped
+	out := capture(t, func() error { return extractInput(p, fields) })
+	for _, expected := range []string{"#1 ", "  dummy.value = 5\n", "  dummy.strvalue = 5\n", "#2 ", "  dummy.value = 7\n"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "#3 ") || strings.Contains(out, "dummy.divisible") {
+		t.Errorf("expected 2 events without the fields requiring an argument, got:\n%s", out)
+	}
+
+	setFlags(t, "", path, []string{"dummy.unknown"}, 0)
+	if _, err := parseFields(p); err == nil {
+		t.Error("expected an error with an unknown field")
+	}
+}
+
+func TestExprFilter(t *testing.T) {
+	p := loadDummy(t)
+	rules := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := ioutil.WriteFile(rules, []byte("- list: odd\n  items: [1, 3, 5]\n- macro: is_odd\n  condition: dummy.value in (odd)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setFlags(t, `{"start":1,"maxEvents":5}`, "", []string{"dummy.value"}, 0)
+	fields, _ := parseFields(p)
+	var err error
+	if filter, err = newExprFilter(p, "is_odd and dummy.value > 1", []string{rules}); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the matching events are printed
+	out := capture(t, func() error { return extractOpen(p, fields) })
+	if strings.Count(out, "#") != 2 || !strings.Contains(out, "#2 ") || !strings.Contains(out, "#4 ") {
+		t.Errorf("expected the events 2 and 4, got:\n%s", out)
+	}
+	if filter.evaluated != 5 || filter.matched != 2 {
+		t.Errorf("expected 2 of 5 events to match, got %d of %d", filter.matched, filter.evaluated)
+	}
+
+	if _, err := newExprFilter(p, "dummy.value >", nil); err == nil || !strings.HasPrefix(err.Error(), "invalid expression") {
+		t.Errorf("expected an error with an invalid expression, got %v", err)
+	}
+	if _, err := newExprFilter(p, "dummy.unknown = 1", nil); err == nil {
+		t.Error("expected an error with an unknown field")
+	}
+}
+
+func TestCheckMatches(t *testing.T) {
+	tests := []struct {
+		min uint64
+		max int64
+		ok  bool
+	}{
+		{0, -1, true},
+		{2, 2, true},
+		{3, -1, false},
+		{0, 1, false},
+	}
+	f := &exprFilter{evaluated: 5, matched: 2}
+	for _, test := range tests {
+		var err error
+		out := capture(t, func() error {
+			err = f.check(test.min, test.max)
+			return nil
+		})
+		if (err == nil) != test.ok || out != "2/5 events matched\n" {
+			t.Errorf("min %d max %d: expected ok: %v, got %v %q", test.min, test.max, test.ok, err, out)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/loader"
+	"github.com/olekukonko/tablewriter"
+)
+
+const (
+	defaultIndexTag = "PLUGINS-FIELDS-INDEX"
+)
+
+// indexRow is a field of the index, along with the plugin extracting it
+type indexRow struct {
+	plugin string
+	cols   []string
+}
+
+func indexRenderSources(p *loader.Plugin) string {
+	info := p.Info()
+	if p.HasCapSourcing() {
+		return "`" + info.EventSource + "`"
+	}
+	if len(info.ExtractEventSources) == 0 {
+		return "All"
+	}
+	var res []string
+	for _, s := range info.ExtractEventSources {
+		res = append(res, "`"+s+"`")
+	}
+	return strings.Join(res, ", ")
+}
+
+// indexEditor substitutes the index tag with a table of the fields of all
+// the plugins, sorted by name, each linking to the README of its plugin
+// relative to the edited file
+func indexEditor(plugins []*loader.Plugin, paths []string, file, s string) (string, error) {
+	var rows []*indexRow
+	for i, p := range plugins {
+		if !p.HasCapExtraction() {
+			continue
+		}
+		readme := filepath.Join(filepath.Dir(paths[i]), "README.md")
+		link, err := filepath.Rel(filepath.Dir(file), readme)
+		if err != nil {
+			return "", err
+		}
+		name := p.Info().Name
+		sources := indexRenderSources(p)
+		for _, f := range p.Fields() {
+			typ := "`" + f.Type + "`"
+			if f.IsList {
+				typ = "`" + f.Type + " (list)`"
+			}
+			rows = append(rows, &indexRow{
+				plugin: name,
+				cols: []string{
+					"`" + f.Name + "`",
+					typ,
+					fieldsRenderArgRow(&f.Arg),
+					fmt.Sprintf("[%s](%s)", name, filepath.ToSlash(link)),
+					sources,
+					f.Desc,
+				},
+			})
+		}
+	}
+	// the fields shared by plugins, like the ones of k8saudit, are listed
+	// once for each of them
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].cols[0] != rows[j].cols[0] {
+			return rows[i].cols[0] < rows[j].cols[0]
+		}
+		return rows[i].plugin < rows[j].plugin
+	})
+
+	var buf bytes.Buffer
+	table := tablewriter.NewWriter(&buf)
+	table.SetHeader([]string{"Name", "Type", "Arg", "Plugin", "Event Sources", "Description"})
+	table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+	table.SetCenterSeparator("|")
+	table.SetRowSeparator("-")
+	table.SetAutoWrapText(false)
+	for _, r := range rows {
+		table.Append(r.cols)
+	}
+	table.Render()
+	return replateTag(s, indexTag, buf.String())
+}
@@ -28,9 +28,11 @@ import (
 )
 
 var (
-	pluginPath string
-	readmePath string
-	fieldsTag  string
+	pluginPaths []string
+	readmePath  string
+	fieldsTag   string
+	index       bool
+	indexTag    string
 )
 
 type EditorFunc func(*loader.Plugin, string) (string, error)
@@ -75,27 +77,55 @@ func editFile(plugin *loader.Plugin, path string, editors ...EditorFunc) error {
 	return ioutil.WriteFile(path, ([]byte)(edited), 0)
 }
 
+// editIndex substitutes the index tag of a file with the fields of all
+// the plugins
+func editIndex(plugins []*loader.Plugin, paths []string, path string) error {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	edited, err := indexEditor(plugins, paths, path, string(bytes))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, ([]byte)(edited), 0)
+}
+
 func main() {
-	pflag.StringVarP(&pluginPath, "plugin", "p", "", "File path to the plugin shared library.")
+	pflag.StringArrayVarP(&pluginPaths, "plugin", "p", nil, "File path to the plugin shared library. Can be repeated with --index.")
 	pflag.StringVarP(&readmePath, "file", "f", "", "File path to the README file to be edited.")
 	pflag.StringVar(&fieldsTag, "fields-tag", defaultFieldsTag, "Tag to substitute with the plugin fields table.\nIn the file, formatted as \"<!-- TAG -->\\n...\\n<!-- /TAG -->\".")
+	pflag.BoolVar(&index, "index", false, "Substitute the index tag with the fields of all the plugins instead of the fields tag with the ones of a plugin.")
+	pflag.StringVar(&indexTag, "index-tag", defaultIndexTag, "Tag to substitute with the index of the fields of all the plugins, with --index.")
 	pflag.Parse()
-	if len(pluginPath) == 0 {
+	if len(pluginPaths) == 0 {
 		fail(fmt.Errorf("must specify a plugin path with the -p option"))
 	}
+	if len(pluginPaths) > 1 && !index {
+		fail(fmt.Errorf("must specify a single plugin path without the --index option"))
+	}
 	if len(readmePath) == 0 {
 		fail(fmt.Errorf("must specify a file path with the -f option"))
 	}
 
-	// load plugin
-	plugin, err := loader.NewPlugin(pluginPath)
-	if err != nil {
-		fail(err)
+	// load plugins
+	var plugins []*loader.Plugin
+	for _, path := range pluginPaths {
+		plugin, err := loader.NewPlugin(path)
+		if err != nil {
+			fail(err)
+		}
+		defer plugin.Unload()
+		plugins = append(plugins, plugin)
 	}
-	defer plugin.Unload()
 
 	// use plugin info to edit readme file
-	err = editFile(plugin, readmePath, fieldsEditor)
+	var err error
+	if index {
+		err = editIndex(plugins, pluginPaths, readmePath)
+	} else {
+		err = editFile(plugins[0], readmePath, fieldsEditor)
+	}
 	if err != nil {
 		fail(err)
 	}
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// defaultScrub lists the fields scrubbed by default for the event sources
+// of the plugins of this repository, which identify people or hosts
+var defaultScrub = map[string][]string{
+	"aws_cloudtrail": {
+		"/sourceIPAddress",
+		"/userIdentity/arn",
+		"/userIdentity/principalId",
+		"/userIdentity/userName",
+		"/userIdentity/accessKeyId",
+		"/userIdentity/sessionContext/sessionIssuer/arn",
+		"/userIdentity/sessionContext/sessionIssuer/principalId",
+		"/userIdentity/sessionContext/sessionIssuer/userName",
+	},
+	"k8s_audit": {
+		"/sourceIPs",
+		"/user/username",
+		"/user/uid",
+		"/impersonatedUser/username",
+		"/impersonatedUser/uid",
+	},
+	"gcp_auditlog": {
+		"/protoPayload/authenticationInfo/principalEmail",
+		"/protoPayload/requestMetadata/callerIp",
+	},
+	"okta": {
+		"/actor/alternateId",
+		"/actor/displayName",
+		"/client/ipAddress",
+		"/request/ipChain",
+		"/target/*/alternateId",
+		"/target/*/displayName",
+	},
+	"github": {
+		"/sender/login",
+		"/pusher/name",
+		"/pusher/email",
+		"/commits/*/author",
+		"/commits/*/committer",
+	},
+}
@@ -0,0 +1,14 @@
+module github.com/falcosecurity/plugins/build/record
+
+go 1.17
+
+require (
+	github.com/falcosecurity/plugin-sdk-go v0.7.4
+	github.com/falcosecurity/plugins/shared/go/loader v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/replay v0.0.0-00010101000000-000000000000
+	github.com/spf13/pflag v1.0.5
+)
+
+replace github.com/falcosecurity/plugins/shared/go/loader => ../../shared/go/loader
+
+replace github.com/falcosecurity/plugins/shared/go/replay => ../../shared/go/replay
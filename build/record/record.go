@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugins/shared/go/loader"
+	"github.com/falcosecurity/plugins/shared/go/replay"
+	"github.com/spf13/pflag"
+)
+
+var (
+	pluginPath     string
+	initConfig     string
+	openParams     string
+	outputPath     string
+	duration       time.Duration
+	maxEvents      uint64
+	scrubPointers  []string
+	noDefaultScrub bool
+)
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(1)
+}
+
+func main() {
+	pflag.StringVarP(&pluginPath, "plugin", "p", "", "File path to the source plugin shared library.")
+	pflag.StringVarP(&initConfig, "config", "c", "", "Init config of the plugin, or @<path> to read it from a file.")
+	pflag.StringVarP(&openParams, "open-params", "o", "", "Open params of the plugin.")
+	pflag.StringVarP(&outputPath, "output", "w", "", "File to write the bundle to (default: <event source>-<time>"+replay.Ext+").")
+	pflag.DurationVarP(&duration, "duration", "d", time.Minute, "Duration of the recording, 0 for no limit.")
+	pflag.Uint64VarP(&maxEvents, "max-events", "n", 0, "Number of events after which to stop, 0 for no limit.")
+	pflag.StringArrayVarP(&scrubPointers, "scrub", "s", nil, "JSON pointer of a field to scrub from the payloads, in which * matches any key or index, e.g. /target/*/alternateId. Can be repeated.")
+	pflag.BoolVar(&noDefaultScrub, "no-default-scrub", false, "Don't scrub the fields identifying people or hosts in the payloads of the event sources of this repository.")
+	pflag.Parse()
+
+	if len(pluginPath) == 0 {
+		pflag.Usage()
+		os.Exit(1)
+	}
+	if strings.HasPrefix(initConfig, "@") {
+		b, err := ioutil.ReadFile(initConfig[1:])
+		if err != nil {
+			fail(err)
+		}
+		initConfig = string(b)
+	}
+
+	plugin, err := loader.LoadPlugin(pluginPath)
+	if err != nil {
+		fail(err)
+	}
+	defer plugin.Unload()
+	if !plugin.HasCapSourcing() {
+		fail(fmt.Errorf("plugin %s doesn't support the event sourcing capability", plugin.Name))
+	}
+	if err := plugin.Init(initConfig); err != nil {
+		fail(fmt.Errorf("init failed: %s", err.Error()))
+	}
+
+	if !noDefaultScrub {
+		scrubPointers = append(defaultScrub[plugin.EventSource], scrubPointers...)
+	}
+	scrubber, err := replay.NewScrubber(scrubPointers)
+	if err != nil {
+		fail(err)
+	}
+
+	if len(outputPath) == 0 {
+		outputPath = fmt.Sprintf("%s-%s%s", plugin.EventSource, time.Now().UTC().Format("20060102T150405Z"), replay.Ext)
+	}
+	count, err := record(plugin, scrubber)
+	if err != nil {
+		fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "recorded %d events in %s\n", count, outputPath)
+}
+
+// record writes the events of the plugin event stream to the bundle, until
+// the duration expires, the maximum number of events is reached, the end of
+// the stream is reached, or the recording is interrupted
+func record(p *loader.Plugin, s *replay.Scrubber) (uint64, error) {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	w, err := replay.NewWriter(file, replay.Header{
+		Plugin:        p.Name,
+		PluginVersion: p.Version,
+		PluginID:      p.ID,
+		EventSource:   p.EventSource,
+		RecordedAt:    time.Now().UTC(),
+		Scrubbed:      scrubPointers,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := p.Open(openParams); err != nil {
+		return 0, fmt.Errorf("open failed: %s", err.Error())
+	}
+	defer p.Close()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	var deadline <-chan time.Time
+	if duration > 0 {
+		deadline = time.After(duration)
+	}
+
+	num := uint64(0)
+	for maxEvents == 0 || num < maxEvents {
+		select {
+		case <-interrupt:
+			return num, w.Close()
+		case <-deadline:
+			return num, w.Close()
+		default:
+		}
+
+		evts, err := p.NextBatch(num + 1)
+		if err == sdk.ErrTimeout {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		if err != nil && err != loader.ErrEOF {
+			w.Close()
+			return num, fmt.Errorf("next batch failed: %s", err.Error())
+		}
+		for _, e := range evts {
+			if maxEvents > 0 && num >= maxEvents {
+				break
+			}
+			if werr := w.Write(replay.Event{Timestamp: e.Timestamp, Data: s.Scrub(e.Data)}); werr != nil {
+				return num, werr
+			}
+			num++
+		}
+		if err == loader.ErrEOF {
+			break
+		}
+	}
+	return num, w.Close()
+}
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/falcosecurity/plugins/shared/go/loader"
+	"github.com/falcosecurity/plugins/shared/go/replay"
+)
+
+// loadDummy builds the dummy plugin, and returns it loaded and
+// initialized. The plugins can't be unloaded from the test process, whose
+// Go runtime can't be stopped.
+func loadDummy(t *testing.T) *loader.Plugin {
+	path := filepath.Join(t.TempDir(), "libdummy.so")
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", path, "./plugin")
+	cmd.Dir = "../../plugins/dummy"
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("the dummy plugin can't be built: %s: %s", err.Error(), out)
+	}
+	p, err := loader.LoadPlugin(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(`{"jitter":0}`); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Destroy)
+	return p
+}
+
+// readBundle returns the header and the events of a bundle
+func readBundle(t *testing.T, path string) (replay.Header, []replay.Event) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := replay.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var res []replay.Event
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return r.Header(), res
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, e)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	p := loadDummy(t)
+	oldParams, oldOutput, oldMax, oldScrub := openParams, outputPath, maxEvents, scrubPointers
+	defer func() { openParams, outputPath, maxEvents, scrubPointers = oldParams, oldOutput, oldMax, oldScrub }()
+	outputPath = filepath.Join(t.TempDir(), "bundle"+replay.Ext)
+	scrubPointers = []string{"/sample"}
+	scrubber, err := replay.NewScrubber(scrubPointers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		params   string
+		max      uint64
+		expected int
+	}{
+		// the recording stops at the end of the stream
+		{`{"start":1,"maxEvents":3}`, 0, 3},
+		{`{"start":1,"maxEvents":0}`, 5, 5},
+	}
+	for _, test := range tests {
+		openParams, maxEvents = test.params, test.max
+		n, err := record(p, scrubber)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, events := readBundle(t, outputPath)
+		if n != uint64(test.expected) || len(events) != test.expected {
+			t.Errorf("%s: expected %d events, got %d recorded and %d read", test.params, test.expected, n, len(events))
+			continue
+		}
+		if h.Plugin != "dummy" || h.EventSource != "dummy" || h.PluginID != p.ID || strings.Join(h.Scrubbed, ",") != "/sample" {
+			t.Errorf("%s: unexpected header %+v", test.params, h)
+		}
+
+		// the payloads that are not json are left as they are
+		for i, e := range events {
+			if string(e.Data) != fmt.Sprint(i+2) {
+				t.Errorf("%s: expected the sample of the event %d, got %s", test.params, i, e.Data)
+			}
+			if e.Timestamp.IsZero() {
+				t.Errorf("%s: expected the timestamp of the event %d", test.params, i)
+			}
+		}
+	}
+
+	outputPath = filepath.Join(t.TempDir(), "missing", "bundle")
+	if _, err := record(p, scrubber); err == nil {
+		t.Error("expected an error with an invalid output")
+	}
+}
+
+func TestDefaultScrub(t *testing.T) {
+	for source, pointers := range defaultScrub {
+		if _, err := replay.NewScrubber(pointers); err != nil {
+			t.Errorf("%s: %s", source, err.Error())
+		}
+	}
+
+	// the default fields of the event source are scrubbed at any depth of
+	// the wildcards
+	s, _ := replay.NewScrubber(defaultScrub["okta"])
+	data := string(s.Scrub([]byte(`{"actor":{"alternateId":"alice@example.com"},"target":[{"alternateId":"bob@example.com"},{"id":"1"}],"eventType":"user.session.start"}`)))
+	if strings.Contains(data, "example.com") || !strings.Contains(data, `"eventType":"user.session.start"`) || !strings.Contains(data, `"id":"1"`) {
+		t.Errorf("expected the people to be scrubbed, got %s", data)
+	}
+}
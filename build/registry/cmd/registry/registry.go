@@ -50,15 +50,16 @@ func main() {
 		options.WithOutput(out),
 	)
 
+	var checkPlugins []string
 	checkCmd := &cobra.Command{
-		Use:                   "check <filename>",
-		Short:                 "Verify the correctness of a plugin registry YAML file",
-		Args:                  cobra.ExactArgs(1),
-		DisableFlagsInUseLine: true,
+		Use:   "check <filename>",
+		Short: "Verify the correctness of a plugin registry YAML file",
+		Args:  cobra.ExactArgs(1),
 		RunE: func(c *cobra.Command, args []string) error {
-			return check.DoCheck(args[0])
+			return check.DoCheck(args[0], checkPlugins...)
 		},
 	}
+	checkCmd.Flags().StringSliceVar(&checkPlugins, "plugin", nil, "Path of a compiled plugin to cross-check with its registry entry, can be repeated.")
 
 	var tableSubFileName string
 	var tableSubTab string
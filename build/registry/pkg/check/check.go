@@ -1,12 +1,23 @@
 package check
 
-import "github.com/falcosecurity/plugins/build/registry/pkg/registry"
+import (
+	"errors"
 
-// DoCheck loads the registry.yaml file from disk and validates it.
-func DoCheck(fileName string) error {
+	"github.com/falcosecurity/plugins/build/registry/pkg/registry"
+)
+
+// DoCheck loads the registry.yaml file from disk and validates it. The
+// given compiled plugins, if any, are loaded and cross-checked with their
+// entries, so that the inconsistencies are found before Falco refuses to
+// load them.
+func DoCheck(fileName string, plugins ...string) error {
 	registry, err := registry.LoadRegistryFromFile(fileName)
 	if err != nil {
 		return err
 	}
-	return registry.Validate()
+	errs := []error{registry.Validate()}
+	for _, path := range plugins {
+		errs = append(errs, checkPlugin(registry, path))
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package check
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/blang/semver"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/loader"
+
+	"github.com/falcosecurity/plugins/build/registry/pkg/registry"
+)
+
+// checkPlugin cross-checks the Info() of a compiled plugin with its entry
+// in the registry, after checking that the plugin is valid like Falco does
+// when loading it
+func checkPlugin(reg *registry.Registry, path string) error {
+	plugin, err := loader.NewPlugin(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer plugin.Unload()
+	p := plugin.Info()
+
+	var errs []error
+	errorf := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s (%s): %s", p.Name, path, fmt.Sprintf(format, args...)))
+	}
+	if err := plugin.Validate(); err != nil {
+		errorf("plugin is not valid: %s", err.Error())
+	}
+	if _, err := semver.Parse(p.Version); err != nil {
+		errorf("version '%s' is not a valid semver: %s", p.Version, err.Error())
+	}
+	if _, err := semver.Parse(p.RequiredAPIVersion); err != nil {
+		errorf("required API version '%s' is not a valid semver: %s", p.RequiredAPIVersion, err.Error())
+	}
+
+	var entry *registry.Plugin
+	for i := range reg.Plugins {
+		if reg.Plugins[i].Name == p.Name {
+			entry = &reg.Plugins[i]
+			break
+		}
+	}
+	if entry == nil {
+		errorf("plugin is not registered")
+		return errors.Join(errs...)
+	}
+	if entry.Reserved {
+		errorf("plugin uses a reserved entry")
+	}
+
+	sourcing := entry.Capabilities.Sourcing
+	if plugin.HasCapSourcing() != sourcing.Supported {
+		errorf("sourcing capability is %t, but %t in the registry", plugin.HasCapSourcing(), sourcing.Supported)
+	} else if plugin.HasCapSourcing() {
+		if uint(p.ID) != sourcing.ID {
+			errorf("ID is %d, but %d in the registry", p.ID, sourcing.ID)
+		}
+		if p.EventSource != sourcing.Source {
+			errorf("event source is '%s', but '%s' in the registry", p.EventSource, sourcing.Source)
+		}
+	}
+	if plugin.HasCapExtraction() != entry.Capabilities.Extraction.Supported {
+		errorf("extraction capability is %t, but %t in the registry", plugin.HasCapExtraction(), entry.Capabilities.Extraction.Supported)
+	}
+	return errors.Join(errs...)
+}
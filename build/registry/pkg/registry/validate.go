@@ -18,7 +18,9 @@ limitations under the License.
 package registry
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"regexp"
 )
 
@@ -49,7 +51,48 @@ func (s *SourcingCapability) validate(usedIDs map[uint]bool, forbiddenSources ma
 	return nil
 }
 
-// Validates returns nil if the Registry is valid, and an error otherwise.
+func (e *ExtractionCapability) validate() error {
+	if e.Supported {
+		for _, s := range e.Sources {
+			if !rgxSource.MatchString(s) {
+				return fmt.Errorf("extraction source name does follow the naming convention: '%s'", s)
+			}
+		}
+	}
+	return nil
+}
+
+// validateFields checks that the fields required for the plugins that are
+// not reserved are set, and that the URLs are valid
+func (p *Plugin) validateFields() error {
+	if p.Reserved {
+		return nil
+	}
+	var errs []error
+	for _, f := range [][2]string{
+		{"description", p.Description},
+		{"authors", p.Authors},
+		{"contact", p.Contact},
+		{"url", p.URL},
+		{"license", p.License},
+	} {
+		if f[1] == "" {
+			errs = append(errs, fmt.Errorf("plugin '%s' has no %s", p.Name, f[0]))
+		}
+	}
+	for _, f := range [][2]string{{"url", p.URL}, {"rules_url", p.RulesURL}} {
+		if f[1] == "" {
+			continue
+		}
+		if u, err := url.Parse(f[1]); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("plugin '%s' has an invalid %s: '%s'", p.Name, f[0], f[1]))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validates returns nil if the Registry is valid, and an error otherwise,
+// joining all the constraints violated by its entries.
 // For more details regarding which constraints are checked for validation,
 // refer to: https://github.com/falcosecurity/plugins#registering-a-new-plugin
 func (r *Registry) Validate() error {
@@ -58,20 +101,41 @@ func (r *Registry) Validate() error {
 		forbiddenSources[s] = true
 	}
 
+	var errs []error
 	ids := make(map[uint]bool)
 	names := make(map[string]bool)
 	for _, p := range r.Plugins {
 		if !rgxName.MatchString(p.Name) {
-			return fmt.Errorf("plugin name does follow the naming convention: '%s'", p.Name)
+			errs = append(errs, fmt.Errorf("plugin name does follow the naming convention: '%s'", p.Name))
 		}
 		if _, ok := names[p.Name]; ok {
-			return fmt.Errorf("plugin name is not unique: '%s'", p.Name)
+			errs = append(errs, fmt.Errorf("plugin name is not unique: '%s'", p.Name))
 		}
 		if err := p.Capabilities.Sourcing.validate(ids, forbiddenSources); err != nil {
-			return err
+			errs = append(errs, err)
+		}
+		if err := p.Capabilities.Extraction.validate(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := p.validateFields(); err != nil {
+			errs = append(errs, err)
 		}
 		names[p.Name] = true
 	}
 
-	return nil
+	// the source of a plugin can't be the name of another plugin with
+	// another source, which would be ambiguous in the rules
+	for _, p := range r.Plugins {
+		s := p.Capabilities.Sourcing
+		if !s.Supported || s.ID == 0 || s.Source == p.Name {
+			continue
+		}
+		for _, other := range r.Plugins {
+			if other.Name == s.Source && other.Capabilities.Sourcing.Source != s.Source {
+				errs = append(errs, fmt.Errorf("source name of plugin '%s' collides with the name of plugin '%s': '%s'", p.Name, other.Name, s.Source))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
 }
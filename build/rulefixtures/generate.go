@@ -0,0 +1,418 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/falcosecurity/plugins/shared/go/loader"
+	"github.com/falcosecurity/plugins/shared/go/rules"
+)
+
+const (
+	// maxAlternatives is the maximum number of the ways to satisfy a
+	// condition that are tried
+	maxAlternatives = 64
+	// marker is the value set in the payloads to find the JSON pointers
+	// from which the fields are extracted
+	marker       = "fixturemarker"
+	numberMarker = "918273645"
+)
+
+// timestamp is the timestamp of the generated events
+var timestamp = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// literal is a check that must be true or false
+type literal struct {
+	check *rules.Check
+	want  bool
+}
+
+// field is a field referenced by the rules, along with the plugin
+// extracting it
+type field struct {
+	plugin *loader.Plugin
+	field  []*loader.Field
+}
+
+// base is a payload from which the fixtures are derived, along with the
+// JSON pointers of the fields learned from it
+type base struct {
+	payload interface{}
+	values  map[string][]string
+	ptrs    map[string][]string
+}
+
+// generator generates the payloads satisfying or not the conditions of the
+// rules, by changing the values of the fields they reference in the base
+// payloads
+type generator struct {
+	source *loader.Plugin
+	fields map[string]*field
+	bases  []*base
+	known  map[string][]hint
+	num    uint64
+}
+
+func newBase(payload interface{}) *base {
+	return &base{
+		payload: payload,
+		values:  map[string][]string{},
+		ptrs:    map[string][]string{},
+	}
+}
+
+// dnf returns the conjunctions of literals making the condition true or
+// false, i.e. its disjunctive normal form, up to maxAlternatives of them
+func dnf(n rules.Node, want bool) [][]literal {
+	switch n := n.(type) {
+	case *rules.Check:
+		return [][]literal{{{check: n, want: want}}}
+	case *rules.Not:
+		return dnf(n.Child, !want)
+	case *rules.And:
+		if want {
+			return product(n.Children, want)
+		}
+		return union(n.Children, want)
+	case *rules.Or:
+		if want {
+			return union(n.Children, want)
+		}
+		return product(n.Children, want)
+	}
+	return nil
+}
+
+// union returns the alternatives of any of the nodes
+func union(nodes []rules.Node, want bool) [][]literal {
+	var res [][]literal
+	for _, c := range nodes {
+		for _, alt := range dnf(c, want) {
+			if len(res) >= maxAlternatives {
+				return res
+			}
+			res = append(res, alt)
+		}
+	}
+	return res
+}
+
+// product returns the alternatives of all the nodes at once
+func product(nodes []rules.Node, want bool) [][]literal {
+	res := [][]literal{{}}
+	for _, c := range nodes {
+		var next [][]literal
+		for _, alt := range dnf(c, want) {
+			for _, prev := range res {
+				if len(next) >= maxAlternatives {
+					break
+				}
+				conj := append(append([]literal{}, prev...), alt...)
+				next = append(next, conj)
+			}
+		}
+		res = next
+	}
+	return res
+}
+
+// satisfies returns true if the values of a field, nil if the field is
+// missing, give the wanted result to all the literals
+func satisfies(lits []literal, values []string) bool {
+	for _, l := range lits {
+		if (values != nil && l.check.Match(values)) != l.want {
+			return false
+		}
+	}
+	return true
+}
+
+// candidates returns the values that may satisfy the literals of a field
+func candidates(lits []literal) []string {
+	var res []string
+	for _, l := range lits {
+		c := l.check
+		switch c.Op {
+		case "=", "==", "!=":
+			res = append(res, c.Values[0])
+		case "in", "intersects":
+			res = append(res, c.Values...)
+		case "pmatch":
+			for _, v := range c.Values {
+				res = append(res, v, strings.TrimSuffix(v, "/")+"/fixture")
+			}
+		case "startswith", "bstartswith":
+			res = append(res, c.Values[0]+"fixture", c.Values[0])
+		case "endswith":
+			res = append(res, "fixture"+c.Values[0])
+		case "contains", "icontains", "bcontains":
+			res = append(res, "fixture-"+c.Values[0])
+		case "glob", "iglob":
+			res = append(res, strings.NewReplacer("*", "fixture", "?", "x").Replace(c.Values[0]))
+		case "<", "<=", ">", ">=":
+			if n, err := strconv.ParseFloat(c.Values[0], 64); err == nil {
+				res = append(res, formatNumber(n-1), formatNumber(n), formatNumber(n+1))
+			}
+		}
+	}
+	return append(res, "fixture", "0", "1")
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// group returns the literals of each field of a conjunction, in the order
+// of the fields
+func group(conj []literal) ([]string, map[string][]literal) {
+	var names []string
+	res := map[string][]literal{}
+	for _, l := range conj {
+		if _, ok := res[l.check.Field]; !ok {
+			names = append(names, l.check.Field)
+		}
+		res[l.check.Field] = append(res[l.check.Field], l)
+	}
+	return names, res
+}
+
+// extract extracts the given fields from a payload. The missing fields
+// have nil values.
+func (g *generator) extract(data []byte, names []string) map[string][]string {
+	g.num++
+	evt := g.source.NewEvent(g.num, timestamp, data)
+	defer evt.Free()
+	res := map[string][]string{}
+	for _, name := range names {
+		f := g.fields[name]
+		values, err := f.plugin.Extract(evt, f.field)
+		if err == nil && values[0] != nil {
+			res[name] = values[0]
+		} else {
+			res[name] = nil
+		}
+	}
+	return res
+}
+
+// eval evaluates a condition on a payload
+func (g *generator) eval(n rules.Node, data []byte) bool {
+	values := g.extract(data, unique(rules.Fields(n)))
+	return rules.Eval(n, func(name string) ([]string, bool) {
+		v := values[name]
+		return v, v != nil
+	})
+}
+
+// learn finds the JSON pointers from which the given fields are extracted
+// in a base payload, by setting a marker in each of its values in turn
+func (g *generator) learn(b *base, names []string) {
+	var missing []string
+	for _, name := range names {
+		if _, ok := b.ptrs[name]; !ok {
+			missing = append(missing, name)
+			b.ptrs[name] = nil
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	for name, v := range g.extract(encode(b.payload), missing) {
+		b.values[name] = v
+	}
+
+	// the fields missing from the payload can't be found in its values
+	var present []string
+	for _, name := range missing {
+		if b.values[name] != nil {
+			present = append(present, name)
+		}
+	}
+	for _, l := range leaves(b.payload, "", nil) {
+		if len(present) == 0 {
+			break
+		}
+		var value interface{} = marker
+		switch v := l.value.(type) {
+		case json.Number:
+			value = json.Number(numberMarker)
+		case bool:
+			value = !v
+		}
+		payload := clone(b.payload)
+		if set(payload, l.ptr, value) != nil {
+			continue
+		}
+		for name, values := range g.extract(encode(payload), present) {
+			if strings.Join(values, "\n") == strings.Join(b.values[name], "\n") {
+				continue
+			}
+			_, isBool := l.value.(bool)
+			if isBool || strings.Contains(strings.Join(values, "\n"), marker) ||
+				strings.Contains(strings.Join(values, "\n"), numberMarker) {
+				b.ptrs[name] = append(b.ptrs[name], l.ptr)
+			}
+		}
+	}
+
+	// the arguments of fields like json.value[/foo/bar] are pointers
+	for _, name := range missing {
+		if len(b.ptrs[name]) > 0 {
+			continue
+		}
+		if i := strings.Index(name, "[/"); i > 0 && strings.HasSuffix(name, "]") {
+			b.ptrs[name] = []string{name[i+1 : len(name)-1]}
+		}
+	}
+}
+
+// pointers returns the JSON pointers of a field learned from the first base
+// payload holding it, or the hinted one if none does
+func (g *generator) pointers(name string) []hint {
+	if res, ok := g.known[name]; ok {
+		return res
+	}
+	var res []hint
+	for _, b := range g.bases {
+		g.learn(b, []string{name})
+		for _, ptr := range b.ptrs[name] {
+			like, _ := get(b.payload, ptr)
+			res = append(res, hint{ptr: ptr, like: like})
+		}
+		if len(res) > 0 {
+			break
+		}
+	}
+	if h, ok := hints[g.source.EventSource][name]; ok && len(res) == 0 {
+		res = append(res, h)
+	}
+	g.known[name] = res
+	return res
+}
+
+// realize returns a payload derived from a base payload in which the
+// literals of a conjunction hold, and checks that it gives the wanted
+// result to the condition
+func (g *generator) realize(b *base, n rules.Node, conj []literal, want bool) ([]byte, bool) {
+	names, lits := group(conj)
+	g.learn(b, names)
+	payload := clone(b.payload)
+	obj, ok := payload.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	for _, name := range names {
+		if satisfies(lits[name], b.values[name]) {
+			continue
+		}
+		// the pointers of the fields missing from the base are the ones
+		// learned from another base
+		var ptrs []hint
+		for _, ptr := range b.ptrs[name] {
+			like, _ := get(b.payload, ptr)
+			ptrs = append(ptrs, hint{ptr: ptr, like: like})
+		}
+		if len(ptrs) == 0 {
+			if ptrs = g.pointers(name); len(ptrs) == 0 {
+				return nil, false
+			}
+		}
+		var value *string
+		for _, c := range candidates(lits[name]) {
+			if satisfies(lits[name], []string{c}) {
+				value = &c
+				break
+			}
+		}
+		if value == nil {
+			if !satisfies(lits[name], nil) {
+				return nil, false
+			}
+			for _, h := range ptrs {
+				remove(obj, h.ptr)
+			}
+			continue
+		}
+		for _, h := range ptrs {
+			if set(obj, h.ptr, typed(*value, h.like)) != nil {
+				return nil, false
+			}
+		}
+	}
+
+	data := encode(obj)
+	if g.eval(n, data) != want {
+		return nil, false
+	}
+	return data, true
+}
+
+// generate returns the payloads triggering a rule, and the ones not
+// triggering it that differ the least from them
+func (g *generator) generate(n rules.Node, max int) (trigger, noTrigger [][]byte) {
+	seen := map[string]bool{}
+	for _, alt := range dnf(n, true) {
+		if len(trigger) >= max {
+			break
+		}
+		for _, b := range g.bases {
+			if data, ok := g.realize(b, n, alt, true); ok {
+				if !seen[string(data)] {
+					seen[string(data)] = true
+					trigger = append(trigger, data)
+				}
+				break
+			}
+		}
+	}
+
+	alts := dnf(n, false)
+	for _, t := range trigger {
+		payload, _ := decode(t)
+		b := newBase(payload)
+		for _, alt := range alts {
+			if len(noTrigger) >= max {
+				return
+			}
+			if data, ok := g.realize(b, n, alt, false); ok && !seen[string(data)] {
+				seen[string(data)] = true
+				noTrigger = append(noTrigger, data)
+			}
+		}
+	}
+	return
+}
+
+func unique(names []string) []string {
+	seen := map[string]bool{}
+	var res []string
+	for _, n := range names {
+		if !seen[n] {
+			seen[n] = true
+			res = append(res, n)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
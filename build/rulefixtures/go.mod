@@ -0,0 +1,24 @@
+module github.com/falcosecurity/plugins/build/rulefixtures
+
+go 1.17
+
+require (
+	github.com/falcosecurity/plugins/shared/go/golden v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/loader v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/replay v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/rules v0.0.0-00010101000000-000000000000
+	github.com/spf13/pflag v1.0.5
+)
+
+require (
+	github.com/falcosecurity/plugin-sdk-go v0.7.3 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+)
+
+replace github.com/falcosecurity/plugins/shared/go/golden => ../../shared/go/golden
+
+replace github.com/falcosecurity/plugins/shared/go/loader => ../../shared/go/loader
+
+replace github.com/falcosecurity/plugins/shared/go/replay => ../../shared/go/replay
+
+replace github.com/falcosecurity/plugins/shared/go/rules => ../../shared/go/rules
@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import "encoding/json"
+
+// hint is the JSON pointer from which a field is extracted, along with a
+// value having the JSON type expected there
+type hint struct {
+	ptr  string
+	like interface{}
+}
+
+// hints lists the JSON pointers of the fields of the event sources of the
+// plugins of this repository that are missing from their golden corpora,
+// and thus can't be learned from them
+var hints = map[string]map[string]hint{
+	"k8s_audit": {
+		"ka.target.subresource":       {"/objectRef/subresource", ""},
+		"ka.req.binding.role":         {"/requestObject/roleRef/name", ""},
+		"ka.req.configmap.obj":        {"/requestObject/data", ""},
+		"ka.req.pod.host_ipc":         {"/requestObject/spec/hostIPC", false},
+		"ka.req.pod.host_network":     {"/requestObject/spec/hostNetwork", false},
+		"ka.req.pod.host_pid":         {"/requestObject/spec/hostPID", false},
+		"ka.req.pod.volumes.hostpath": {"/requestObject/spec/volumes/0/hostPath/path", ""},
+		"ka.req.pod.fs_group":         {"/requestObject/spec/securityContext/fsGroup", json.Number("0")},
+		"ka.req.role.rules.resources": {"/requestObject/rules/0/resources/0", ""},
+		"ka.req.role.rules.verbs":     {"/requestObject/rules/0/verbs/0", ""},
+		"ka.req.service.type":         {"/requestObject/spec/type", ""},
+	},
+}
@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// decode decodes a json payload, keeping the numbers as they are
+func decode(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var res interface{}
+	if err := dec.Decode(&res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func encode(v interface{}) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		panic(err)
+	}
+	return bytes.TrimSpace(buf.Bytes())
+}
+
+func clone(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			res[k] = clone(e)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, e := range v {
+			res[i] = clone(e)
+		}
+		return res
+	}
+	return v
+}
+
+// leaf is a scalar value of a payload, along with its JSON pointer
+type leaf struct {
+	ptr   string
+	value interface{}
+}
+
+// leaves returns the scalar values of a payload, in a stable order
+func leaves(v interface{}, ptr string, res []leaf) []leaf {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			res = leaves(v[k], ptr+"/"+escape(k), res)
+		}
+	case []interface{}:
+		for i, e := range v {
+			res = leaves(e, ptr+"/"+strconv.Itoa(i), res)
+		}
+	default:
+		res = append(res, leaf{ptr: ptr, value: v})
+	}
+	return res
+}
+
+func escape(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func unescape(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+}
+
+// get returns the value at the JSON pointer
+func get(root interface{}, ptr string) (interface{}, bool) {
+	if len(ptr) == 0 {
+		return root, true
+	}
+	cur := root
+	for _, tok := range strings.Split(ptr[1:], "/") {
+		switch c := cur.(type) {
+		case map[string]interface{}:
+			v, ok := c[unescape(tok)]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []interface{}:
+			i, err := strconv.Atoi(tok)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			cur = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// set sets the value at the JSON pointer, creating the missing objects and
+// arrays on its way. The root must be an object.
+func set(root interface{}, ptr string, value interface{}) error {
+	if !strings.HasPrefix(ptr, "/") {
+		return fmt.Errorf("invalid JSON pointer %q", ptr)
+	}
+	_, err := setIn(root, strings.Split(ptr[1:], "/"), value)
+	return err
+}
+
+func setIn(cur interface{}, toks []string, value interface{}) (interface{}, error) {
+	if len(toks) == 0 {
+		return value, nil
+	}
+	idx, err := strconv.Atoi(toks[0])
+	if cur == nil {
+		if err == nil && idx >= 0 {
+			cur = []interface{}{}
+		} else {
+			cur = map[string]interface{}{}
+		}
+	}
+	switch c := cur.(type) {
+	case map[string]interface{}:
+		key := unescape(toks[0])
+		v, err := setIn(c[key], toks[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		c[key] = v
+		return c, nil
+	case []interface{}:
+		if err != nil || idx < 0 {
+			return nil, fmt.Errorf("invalid array index %q", toks[0])
+		}
+		for len(c) <= idx {
+			c = append(c, nil)
+		}
+		v, err := setIn(c[idx], toks[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		c[idx] = v
+		return c, nil
+	}
+	return nil, fmt.Errorf("cannot set a member of a scalar value")
+}
+
+// remove removes the member at the JSON pointer, if any. The elements of
+// the arrays are set to null instead, so that the other pointers stay
+// valid.
+func remove(root interface{}, ptr string) {
+	i := strings.LastIndex(ptr, "/")
+	if i < 0 {
+		return
+	}
+	parent, ok := get(root, ptr[:i])
+	if !ok {
+		return
+	}
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		delete(p, unescape(ptr[i+1:]))
+	case []interface{}:
+		if idx, err := strconv.Atoi(ptr[i+1:]); err == nil && idx >= 0 && idx < len(p) {
+			p[idx] = nil
+		}
+	}
+}
+
+// typed returns a value to store in a payload, with the JSON type of the
+// value it replaces, or the given default type if there is none
+func typed(s string, like interface{}) interface{} {
+	switch like.(type) {
+	case json.Number:
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return json.Number(s)
+		}
+	case bool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return s
+}
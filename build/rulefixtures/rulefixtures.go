@@ -0,0 +1,281 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/falcosecurity/plugins/shared/go/golden"
+	"github.com/falcosecurity/plugins/shared/go/loader"
+	"github.com/falcosecurity/plugins/shared/go/replay"
+	"github.com/falcosecurity/plugins/shared/go/rules"
+	"github.com/spf13/pflag"
+)
+
+var (
+	pluginPath     string
+	initConfig     string
+	extractorPaths []string
+	rulesPaths     []string
+	basePaths      []string
+	outputDir      string
+	ruleNames      []string
+	maxFixtures    int
+)
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(1)
+}
+
+func main() {
+	pflag.StringVarP(&pluginPath, "plugin", "p", "", "File path to the plugin shared library.")
+	pflag.StringVarP(&initConfig, "config", "c", "", "Init config of the plugin, or @<path> to read it from a file.")
+	pflag.StringArrayVarP(&extractorPaths, "extractor", "x", nil, "File path to another plugin extracting fields from the events, e.g. the json plugin. Can be repeated.")
+	pflag.StringArrayVarP(&rulesPaths, "rules", "r", nil, "Falco rules file to generate fixtures for. Can be repeated.")
+	pflag.StringArrayVarP(&basePaths, "base", "b", nil, "JSON payload or replay bundle from which the fixtures are derived. Can be repeated (default: the golden corpus of the plugin).")
+	pflag.StringVarP(&outputDir, "output", "w", "fixtures", "Directory to write the fixtures to.")
+	pflag.StringArrayVar(&ruleNames, "rule", nil, "Name of a rule to generate fixtures for. Can be repeated (default: all the rules of the event source of the plugin).")
+	pflag.IntVarP(&maxFixtures, "max-fixtures", "n", 4, "Maximum number of triggering and non-triggering events generated for each rule.")
+	pflag.Parse()
+
+	if len(pluginPath) == 0 || len(rulesPaths) == 0 {
+		pflag.Usage()
+		os.Exit(1)
+	}
+	if strings.HasPrefix(initConfig, "@") {
+		b, err := ioutil.ReadFile(initConfig[1:])
+		if err != nil {
+			fail(err)
+		}
+		initConfig = string(b)
+	}
+
+	plugin, err := loader.LoadPlugin(pluginPath)
+	if err != nil {
+		fail(err)
+	}
+	defer plugin.Unload()
+	if err := plugin.Init(initConfig); err != nil {
+		fail(fmt.Errorf("init failed: %s", err.Error()))
+	}
+	plugins := []*loader.Plugin{plugin}
+	for _, path := range extractorPaths {
+		p, err := loader.LoadPlugin(path)
+		if err != nil {
+			fail(err)
+		}
+		defer p.Unload()
+		if err := p.Init(""); err != nil {
+			fail(fmt.Errorf("%s: init failed: %s", p.Name, err.Error()))
+		}
+		p.SetEventSource(plugin.EventSource)
+		plugins = append(plugins, p)
+	}
+
+	g := &generator{source: plugin, fields: map[string]*field{}, known: map[string][]hint{}}
+	if g.bases, err = loadBases(); err != nil {
+		fail(err)
+	}
+	if len(g.bases) == 0 {
+		fail(fmt.Errorf("no JSON base payload found, use --base"))
+	}
+
+	ruleset, err := rules.Load(rulesPaths...)
+	if err != nil {
+		fail(err)
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		fail(err)
+	}
+
+	selected := map[string]bool{}
+	for _, name := range ruleNames {
+		selected[name] = true
+	}
+	for _, r := range ruleset.BySource(plugin.EventSource) {
+		if len(selected) > 0 && !selected[r.Name] {
+			continue
+		}
+		cond, err := ruleset.Parse(r.Condition)
+		if err == nil {
+			err = resolveFields(g, plugins, cond)
+		}
+		if err != nil {
+			fmt.Printf("SKIP %s: %s\n", r.Name, err.Error())
+			continue
+		}
+
+		trigger, noTrigger := g.generate(cond, maxFixtures)
+		if len(trigger) == 0 {
+			fmt.Printf("SKIP %s: no triggering event could be derived from the base payloads\n", r.Name)
+			continue
+		}
+		slug := slugify(r.Name)
+		if err := write(plugin, filepath.Join(outputDir, slug+".trigger"+replay.Ext), trigger); err != nil {
+			fail(err)
+		}
+		if err := write(plugin, filepath.Join(outputDir, slug+".no-trigger"+replay.Ext), noTrigger); err != nil {
+			fail(err)
+		}
+		fmt.Printf("OK   %s: %d triggering, %d non-triggering\n", r.Name, len(trigger), len(noTrigger))
+	}
+}
+
+// resolveFields finds the plugins extracting the fields of a condition
+func resolveFields(g *generator, plugins []*loader.Plugin, cond rules.Node) error {
+	for _, name := range rules.Fields(cond) {
+		if _, ok := g.fields[name]; ok {
+			continue
+		}
+		err := fmt.Errorf("field %s is not supported by the plugins", name)
+		for _, p := range plugins {
+			f, perr := p.ParseField(name)
+			if perr == nil {
+				g.fields[name] = &field{plugin: p, field: []*loader.Field{f}}
+				err = nil
+				break
+			}
+			if !strings.HasSuffix(perr.Error(), "is not supported by the plugin") {
+				err = perr
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadBases reads the base payloads. By default, they are the ones of the
+// golden corpus of the plugin.
+func loadBases() ([]*base, error) {
+	paths := basePaths
+	if len(paths) == 0 {
+		files, err := filepath.Glob(filepath.Join(filepath.Dir(pluginPath), "pkg", "*", "testdata", "golden", "*"))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if !strings.HasSuffix(f, golden.Ext) {
+				paths = append(paths, f)
+			}
+		}
+		sort.Strings(paths)
+	}
+
+	var res []*base
+	for _, path := range paths {
+		var payloads [][]byte
+		if strings.HasSuffix(path, replay.Ext) {
+			evts, err := readBundle(path)
+			if err != nil {
+				return nil, err
+			}
+			payloads = evts
+		} else {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			payloads = [][]byte{data}
+		}
+		// the payloads that are not JSON objects, e.g. the malformed ones
+		// of the golden corpora, can't be derived
+		for _, data := range payloads {
+			if payload, err := decode(data); err == nil {
+				if _, ok := payload.(map[string]interface{}); ok {
+					res = append(res, newBase(payload))
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+func readBundle(path string) ([][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r, err := replay.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var res [][]byte
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, e.Data)
+	}
+}
+
+// write writes the payloads to a replay bundle
+func write(p *loader.Plugin, path string, payloads [][]byte) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w, err := replay.NewWriter(file, replay.Header{
+		Plugin:        p.Name,
+		PluginVersion: p.Version,
+		PluginID:      p.ID,
+		EventSource:   p.EventSource,
+		RecordedAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	for i, data := range payloads {
+		if err := w.Write(replay.Event{Timestamp: timestamp.Add(time.Duration(i) * time.Second), Data: data}); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// slugify returns a file name for a rule name
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
@@ -0,0 +1,261 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/falcosecurity/plugins/shared/go/loader"
+	"github.com/falcosecurity/plugins/shared/go/rules"
+)
+
+// parse parses a condition without macros nor lists
+func parse(t *testing.T, cond string) rules.Node {
+	r, err := rules.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := r.Parse(cond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// literals returns the literals of the alternatives, e.g. [a = 1 !b = 2]
+func literals(alts [][]literal) []string {
+	var res []string
+	for _, alt := range alts {
+		var s []string
+		for _, l := range alt {
+			prefix := ""
+			if !l.want {
+				prefix = "!"
+			}
+			s = append(s, prefix+l.check.Field+" "+l.check.Op+" "+strings.Join(l.check.Values, ","))
+		}
+		res = append(res, strings.Join(s, " & "))
+	}
+	return res
+}
+
+func TestDNF(t *testing.T) {
+	n := parse(t, "a.x = 1 and (a.y = 2 or not a.z = 3)")
+	if res := literals(dnf(n, true)); !reflect.DeepEqual(res, []string{"a.x = 1 & a.y = 2", "a.x = 1 & !a.z = 3"}) {
+		t.Errorf("unexpected alternatives making the condition true: %v", res)
+	}
+	if res := literals(dnf(n, false)); !reflect.DeepEqual(res, []string{"!a.x = 1", "!a.y = 2 & a.z = 3"}) {
+		t.Errorf("unexpected alternatives making the condition false: %v", res)
+	}
+
+	// the alternatives are bounded
+	var conds []string
+	for i := 0; i < 10; i++ {
+		conds = append(conds, "(a.x = 1 or a.y = 2)")
+	}
+	if res := dnf(parse(t, strings.Join(conds, " and ")), true); len(res) != maxAlternatives {
+		t.Errorf("expected %d alternatives, got %d", maxAlternatives, len(res))
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	tests := []struct {
+		cond     string
+		want     bool
+		expected string
+	}{
+		{"a.x = foo", true, "foo"},
+		{"a.x in (foo, bar)", true, "foo"},
+		{"a.x in (foo, bar)", false, "fixture"},
+		{"a.x startswith /etc", true, "/etcfixture"},
+		{"a.x endswith .sh", true, "fixture.sh"},
+		{"a.x contains foo", true, "fixture-foo"},
+		{"a.x glob /tmp/*.sh", true, "/tmp/fixture.sh"},
+		{"a.x pmatch (/etc)", true, "/etc"},
+		{"a.x > 10", true, "11"},
+		{"a.x < 10", true, "9"},
+		{"a.x >= 1.5", true, "1.5"},
+	}
+	for _, test := range tests {
+		lits := dnf(parse(t, test.cond), test.want)[0]
+		var value string
+		for _, c := range candidates(lits) {
+			if satisfies(lits, []string{c}) {
+				value = c
+				break
+			}
+		}
+		if value != test.expected {
+			t.Errorf("%s (%v): expected the candidate %s, got %s", test.cond, test.want, test.expected, value)
+		}
+	}
+
+	// a missing field only satisfies the negated checks
+	if satisfies(dnf(parse(t, "a.x = 1"), true)[0], nil) || !satisfies(dnf(parse(t, "a.x = 1"), false)[0], nil) {
+		t.Error("expected a missing field to make the checks false")
+	}
+}
+
+func TestPointers(t *testing.T) {
+	payload, err := decode([]byte(`{"a":{"b~c":[1,{"d/e":true}]},"f":"x"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ptrs []string
+	for _, l := range leaves(payload, "", nil) {
+		ptrs = append(ptrs, l.ptr)
+	}
+	if !reflect.DeepEqual(ptrs, []string{"/a/b~0c/0", "/a/b~0c/1/d~1e", "/f"}) {
+		t.Errorf("unexpected leaves %v", ptrs)
+	}
+	if v, ok := get(payload, "/a/b~0c/1/d~1e"); !ok || v != true {
+		t.Errorf("expected the escaped pointer to be found, got %v", v)
+	}
+	for _, ptr := range []string{"/a/b~0c/2", "/a/x", "/f/g", "/a/b~0c/-1"} {
+		if _, ok := get(payload, ptr); ok {
+			t.Errorf("%s: expected no value", ptr)
+		}
+	}
+
+	// the missing objects and arrays are created, and the arrays grow
+	c := clone(payload)
+	for ptr, v := range map[string]interface{}{"/a/b~0c/3/g": "y", "/h/0/i": json.Number("1"), "/f": false} {
+		if err := set(c, ptr, v); err != nil {
+			t.Errorf("%s: %s", ptr, err.Error())
+		}
+	}
+	expected := `{"a":{"b~c":[1,{"d/e":true},null,{"g":"y"}]},"f":false,"h":[{"i":1}]}`
+	if s := string(encode(c)); s != expected {
+		t.Errorf("expected %s, got %s", expected, s)
+	}
+	if s := string(encode(payload)); s != `{"a":{"b~c":[1,{"d/e":true}]},"f":"x"}` {
+		t.Errorf("expected the cloned payload to be left as it is, got %s", s)
+	}
+	for _, ptr := range []string{"a", "/f/x", "/a/b~0c/x"} {
+		if err := set(payload, ptr, 1); err == nil {
+			t.Errorf("%s: expected an error", ptr)
+		}
+	}
+
+	// the elements of the arrays are set to null, to keep the indexes
+	remove(c, "/a/b~0c/0")
+	remove(c, "/h")
+	remove(c, "/x/y")
+	if s := string(encode(c)); s != `{"a":{"b~c":[null,{"d/e":true},null,{"g":"y"}]},"f":false}` {
+		t.Errorf("unexpected payload after removal %s", s)
+	}
+}
+
+func TestTyped(t *testing.T) {
+	tests := []struct {
+		s        string
+		like     interface{}
+		expected interface{}
+	}{
+		{"1", json.Number("0"), json.Number("1")},
+		{"x", json.Number("0"), "x"},
+		{"true", false, true},
+		{"x", false, "x"},
+		{"1", "", "1"},
+		{"1", nil, "1"},
+	}
+	for _, test := range tests {
+		if v := typed(test.s, test.like); v != test.expected {
+			t.Errorf("%s like %#v: expected %#v, got %#v", test.s, test.like, test.expected, v)
+		}
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Create Privileged Pod":         "create-privileged-pod",
+		"  AWS -- Console Login (MFA)!": "aws-console-login-mfa",
+		"K8s_Secret.Get":                "k8s-secret-get",
+	}
+	for name, expected := range tests {
+		if s := slugify(name); s != expected {
+			t.Errorf("%s: expected %s, got %s", name, expected, s)
+		}
+	}
+}
+
+// TestGenerate derives fixtures from a base payload with the fields of the
+// json plugin, whose arguments are the JSON pointers of the values
+func TestGenerate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "libjson.so")
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", path, "./plugin")
+	cmd.Dir = "../../plugins/json"
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("the json plugin can't be built: %s: %s", err.Error(), out)
+	}
+	p, err := loader.LoadPlugin(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(""); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Destroy()
+
+	payload, _ := decode([]byte(`{"user":{"name":"bob"},"verb":"get","code":200}`))
+	g := &generator{source: p, fields: map[string]*field{}, bases: []*base{newBase(payload)}, known: map[string][]hint{}}
+	cond := parse(t, "json.value[/verb] in (create, update) and json.value[/user/name] != system and not json.value[/code] >= 400")
+	if err := resolveFields(g, []*loader.Plugin{p}, cond); err != nil {
+		t.Fatal(err)
+	}
+	trigger, noTrigger := g.generate(cond, 4)
+
+	// the values of the fields are changed in place with their type, and
+	// the non-triggering events each break one of the checks
+	expected := []string{`{"code":200,"user":{"name":"bob"},"verb":"create"}`}
+	if len(trigger) != 1 || string(trigger[0]) != expected[0] {
+		t.Errorf("expected the triggering events %s, got %q", expected, trigger)
+	}
+	expected = []string{
+		`{"code":200,"user":{"name":"bob"},"verb":"fixture"}`,
+		`{"code":200,"user":{"name":"system"},"verb":"create"}`,
+		`{"code":400,"user":{"name":"bob"},"verb":"create"}`,
+	}
+	if len(noTrigger) != len(expected) {
+		t.Errorf("expected the non-triggering events %s, got %q", expected, noTrigger)
+	}
+	for i := 0; i < len(noTrigger) && i < len(expected); i++ {
+		if string(noTrigger[i]) != expected[i] {
+			t.Errorf("expected the non-triggering event %s, got %s", expected[i], noTrigger[i])
+		}
+	}
+	for _, data := range trigger {
+		if !g.eval(cond, data) {
+			t.Errorf("expected %s to trigger the rule", data)
+		}
+	}
+	for _, data := range noTrigger {
+		if g.eval(cond, data) {
+			t.Errorf("expected %s not to trigger the rule", data)
+		}
+	}
+
+	if err := resolveFields(g, []*loader.Plugin{p}, parse(t, "other.field = 1")); err == nil {
+		t.Error("expected an error with a field not supported by the plugins")
+	}
+}
@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package itest
+
+import (
+	"context"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/testcontainers/testcontainers-go"
+	tckafka "github.com/testcontainers/testcontainers-go/modules/kafka"
+	"github.com/testcontainers/testcontainers-go/modules/localstack"
+)
+
+const (
+	localstackImage = "localstack/localstack:3.4"
+	kafkaImage      = "confluentinc/confluent-local:7.5.0"
+
+	// localstackHost resolves to the loopback address, and lets the S3
+	// clients use virtual-hosted style bucket addressing with localstack
+	localstackHost   = "s3.localhost.localstack.cloud"
+	localstackRegion = "us-east-1"
+)
+
+// RequireDocker skips the test if docker is not available
+func RequireDocker(t *testing.T) {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+}
+
+// RequireCommands skips the test if any of the given commands is not
+// installed
+func RequireCommands(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s is not installed", name)
+		}
+	}
+}
+
+func terminate(t *testing.T, c testcontainers.Container) {
+	t.Cleanup(func() {
+		if err := c.Terminate(context.Background()); err != nil {
+			t.Errorf("failed to terminate container: %s", err.Error())
+		}
+	})
+}
+
+// Localstack is a running localstack container emulating S3 and SQS
+type Localstack struct {
+	Endpoint string
+	S3       *s3.Client
+	SQS      *sqs.Client
+}
+
+// StartLocalstack starts a localstack container, which is terminated at
+// the end of the test, and points the AWS clients of the plugins to it
+// through the environment variables of the test
+func StartLocalstack(t *testing.T) *Localstack {
+	t.Helper()
+	RequireDocker(t)
+	ctx := context.Background()
+	c, err := localstack.RunContainer(ctx, testcontainers.WithImage(localstackImage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	terminate(t, c)
+
+	port, err := c.MappedPort(ctx, "4566/tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := "http://" + net.JoinHostPort(localstackHost, port.Port())
+	t.Setenv("AWS_ENDPOINT_URL", endpoint)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", localstackRegion)
+
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(localstackRegion),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("test", "test", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.BaseEndpoint = aws.String(endpoint)
+	return &Localstack{
+		Endpoint: endpoint,
+		S3:       s3.NewFromConfig(cfg),
+		SQS:      sqs.NewFromConfig(cfg),
+	}
+}
+
+// CreateBucket creates a S3 bucket
+func (l *Localstack) CreateBucket(t *testing.T, bucket string) {
+	t.Helper()
+	_, err := l.S3.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// PutObject uploads a S3 object
+func (l *Localstack) PutObject(t *testing.T, bucket, key string, data []byte) {
+	t.Helper()
+	_, err := l.S3.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   strings.NewReader(string(data)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// CreateQueue creates a SQS queue, and returns its URL
+func (l *Localstack) CreateQueue(t *testing.T, name string) string {
+	t.Helper()
+	out, err := l.SQS.CreateQueue(context.Background(), &sqs.CreateQueueInput{QueueName: aws.String(name)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aws.ToString(out.QueueUrl)
+}
+
+// SendMessage sends a message to a SQS queue
+func (l *Localstack) SendMessage(t *testing.T, queueURL, body string) {
+	t.Helper()
+	_, err := l.SQS.SendMessage(context.Background(), &sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueURL),
+		MessageBody: aws.String(body),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// StartKafka starts a single broker Kafka container, which is terminated
+// at the end of the test, and returns the addresses of its brokers
+func StartKafka(t *testing.T) []string {
+	t.Helper()
+	RequireDocker(t)
+	ctx := context.Background()
+	c, err := tckafka.RunContainer(ctx, testcontainers.WithImage(kafkaImage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	terminate(t, c)
+
+	brokers, err := c.Brokers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return brokers
+}
+
+// FreePort returns a TCP port that is free on the host
+func FreePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	res, _ := strconv.Atoi(port)
+	return res
+}
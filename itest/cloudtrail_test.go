@@ -0,0 +1,145 @@
+//go:build itest
+
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package itest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/falcosecurity/plugins/plugins/cloudtrail/pkg/cloudtrail"
+	"net/url"
+)
+
+const (
+	ctBucket    = "itest-cloudtrail"
+	ctQueue     = "itest-cloudtrail"
+	ctAccountID = "123456789012"
+	ctTimeout   = time.Minute
+)
+
+// ctFile returns the key and the gzipped content of a CloudTrail file,
+// with the given number of records
+func ctFile(t *testing.T, day, num, records int) (string, []byte) {
+	t.Helper()
+	var file struct {
+		Records []map[string]interface{}
+	}
+	for i := 0; i < records; i++ {
+		file.Records = append(file.Records, map[string]interface{}{
+			"eventVersion": "1.08",
+			"eventID":      fmt.Sprintf("%02d-%02d-%04d", day, num, i),
+			"eventTime":    fmt.Sprintf("2024-01-%02dT00:00:%02dZ", day, i%60),
+			"eventSource":  "s3.amazonaws.com",
+			"eventName":    "GetObject",
+			"awsRegion":    "us-east-1",
+			"userIdentity": map[string]interface{}{
+				"type":      "IAMUser",
+				"userName":  fmt.Sprintf("user-%d", i),
+				"accountId": ctAccountID,
+			},
+			"sourceIPAddress": "192.0.2.1",
+		})
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+
+	key := fmt.Sprintf("AWSLogs/%s/CloudTrail/us-east-1/2024/01/%02d/%s_CloudTrail_us-east-1_202401%02dT0000Z_%04d.json.gz",
+		ctAccountID, day, ctAccountID, day, num)
+	return key, buf.Bytes()
+}
+
+func TestCloudTrailS3(t *testing.T) {
+	ls := StartLocalstack(t)
+	ls.CreateBucket(t, ctBucket)
+
+	// enough files to require several rounds of concurrent downloads, and
+	// to list the keys of several days
+	const files, records = 12, 50
+	for i := 0; i < files; i++ {
+		key, data := ctFile(t, 1+i%3, i, records)
+		ls.PutObject(t, ctBucket, key, data)
+	}
+
+	p := &cloudtrail.Plugin{}
+	Init(t, p, `{"s3DownloadConcurrency":4}`)
+	evts := Open(t, p, "s3://"+ctBucket+"/AWSLogs/"+ctAccountID+"/").Drain(t, ctTimeout)
+	if len(evts) != files*records {
+		t.Fatalf("got %d events, expected %d", len(evts), files*records)
+	}
+
+	ids := make(map[interface{}]bool)
+	for _, evt := range evts {
+		ids[Extract(t, p, evt, "ct.id")] = true
+		if v := Extract(t, p, evt, "ct.name"); v != "GetObject" {
+			t.Errorf("event #%d: unexpected ct.name %v", evt.Num, v)
+		}
+		if v := Extract(t, p, evt, "ct.user.accountid"); v != ctAccountID {
+			t.Errorf("event #%d: unexpected ct.user.accountid %v", evt.Num, v)
+		}
+	}
+	if len(ids) != files*records {
+		t.Errorf("got %d distinct events, expected %d", len(ids), files*records)
+	}
+}
+
+func TestCloudTrailSQS(t *testing.T) {
+	ls := StartLocalstack(t)
+	ls.CreateBucket(t, ctBucket)
+	queueURL := ls.CreateQueue(t, ctQueue)
+
+	// one notification sent by CloudTrail, and one by S3, whose keys are
+	// URL encoded
+	const records = 20
+	key1, data1 := ctFile(t, 1, 1, records)
+	key2, data2 := ctFile(t, 2, 2, records)
+	ls.PutObject(t, ctBucket, key1, data1)
+	ls.PutObject(t, ctBucket, key2, data2)
+	ls.SendMessage(t, queueURL, fmt.Sprintf(`{"s3Bucket":%q,"s3ObjectKey":[%q]}`, ctBucket, key1))
+
+	p := &cloudtrail.Plugin{}
+	Init(t, p, `{}`)
+	s := Open(t, p, "sqs://"+ctQueue)
+	evts := s.Collect(t, records, ctTimeout)
+
+	ls.SendMessage(t, queueURL, fmt.Sprintf(`{"Records":[{"s3":{"bucket":{"name":%q},"object":{"key":%q}}}]}`,
+		ctBucket, url.QueryEscape(key2)))
+	evts = append(evts, s.Collect(t, records, ctTimeout)...)
+	if len(evts) != 2*records {
+		t.Fatalf("got %d events, expected %d", len(evts), 2*records)
+	}
+	for i, evt := range evts {
+		if v := Extract(t, p, evt, "ct.user"); v != fmt.Sprintf("user-%d", i%records) {
+			t.Errorf("event #%d: unexpected ct.user %v", evt.Num, v)
+		}
+	}
+
+	// the messages are deleted once received
+	s.Idle(t, 5*time.Second)
+}
@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package itest
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+)
+
+// eventWriters implements sdk.EventWriters in Go memory, so that the
+// events produced by the plugins can be read back
+type eventWriters struct {
+	evts []*eventWriter
+}
+
+func newEventWriters(size int) *eventWriters {
+	res := &eventWriters{}
+	for i := 0; i < size; i++ {
+		res.evts = append(res.evts, &eventWriter{})
+	}
+	return res
+}
+
+func (w *eventWriters) Get(eventIndex int) sdk.EventWriter {
+	return w.evts[eventIndex]
+}
+
+func (w *eventWriters) Len() int {
+	return len(w.evts)
+}
+
+func (w *eventWriters) ArrayPtr() unsafe.Pointer {
+	return nil
+}
+
+func (w *eventWriters) Free() {
+	// do nothing
+}
+
+type eventWriter struct {
+	data bytes.Buffer
+	ts   uint64
+}
+
+func (w *eventWriter) Writer() io.Writer {
+	w.data.Reset()
+	return &w.data
+}
+
+func (w *eventWriter) SetTimestamp(value uint64) {
+	w.ts = value
+}
+
+// Extract extracts a field from an event, e.g. foo.bar or foo.bar[arg],
+// and returns its value, or nil if the field is not available. The test
+// fails if the plugin doesn't export the field or returns an error.
+func Extract(t *testing.T, p Extractor, evt *Event, field string) interface{} {
+	t.Helper()
+	name, arg := field, ""
+	hasArg := false
+	if i := strings.Index(field, "["); i > 0 && strings.HasSuffix(field, "]") {
+		name, arg, hasArg = field[:i], field[i+1:len(field)-1], true
+	}
+
+	for id, e := range p.Fields() {
+		if e.Name != name {
+			continue
+		}
+		req := &extractRequest{fieldID: uint64(id), field: name, isList: e.IsList}
+		req.fieldType = fieldType(e.Type)
+		if hasArg {
+			req.argPresent = true
+			req.argKey = arg
+			if e.Arg.IsIndex {
+				idx, err := strconv.ParseUint(arg, 10, 64)
+				if err != nil {
+					t.Fatalf("invalid index argument of field %s: %s", field, err.Error())
+				}
+				req.argIndex = idx
+			}
+		}
+		if err := p.Extract(req, evt); err != nil {
+			t.Fatalf("extracting %s from event #%d failed: %s", field, evt.Num, err.Error())
+		}
+		return req.value
+	}
+	t.Fatalf("unknown field %s", field)
+	return nil
+}
+
+func fieldType(t string) uint32 {
+	switch t {
+	case "uint64":
+		return sdk.FieldTypeUint64
+	case "reltime":
+		return sdk.FieldTypeRelTime
+	case "abstime":
+		return sdk.FieldTypeAbsTime
+	case "bool":
+		return sdk.FieldTypeBool
+	case "ipaddr":
+		return sdk.FieldTypeIPAddr
+	case "ipnet":
+		return sdk.FieldTypeIPNet
+	default:
+		return sdk.FieldTypeCharBuf
+	}
+}
+
+// extractRequest implements sdk.ExtractRequest and stores the extracted value
+type extractRequest struct {
+	fieldID    uint64
+	fieldType  uint32
+	field      string
+	argKey     string
+	argIndex   uint64
+	argPresent bool
+	isList     bool
+	value      interface{}
+}
+
+func (r *extractRequest) FieldID() uint64 {
+	return r.fieldID
+}
+
+func (r *extractRequest) FieldType() uint32 {
+	return r.fieldType
+}
+
+func (r *extractRequest) Field() string {
+	return r.field
+}
+
+func (r *extractRequest) ArgKey() string {
+	return r.argKey
+}
+
+func (r *extractRequest) ArgIndex() uint64 {
+	return r.argIndex
+}
+
+func (r *extractRequest) ArgPresent() bool {
+	return r.argPresent
+}
+
+func (r *extractRequest) IsList() bool {
+	return r.isList
+}
+
+func (r *extractRequest) SetValue(v interface{}) {
+	r.value = v
+}
+
+func (r *extractRequest) SetPtr(unsafe.Pointer) {
+	// do nothing
+}
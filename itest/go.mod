@@ -0,0 +1,211 @@
+module github.com/falcosecurity/plugins/itest
+
+go 1.22.2
+
+require (
+	github.com/aws/aws-sdk-go-v2 v1.26.1
+	github.com/aws/aws-sdk-go-v2/config v1.27.11
+	github.com/aws/aws-sdk-go-v2/credentials v1.17.11
+	github.com/aws/aws-sdk-go-v2/service/s3 v1.53.1
+	github.com/aws/aws-sdk-go-v2/service/sqs v1.31.4
+	github.com/falcosecurity/plugin-sdk-go v0.7.4
+	github.com/falcosecurity/plugins/plugins/cloudtrail v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/plugins/k8saudit v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/plugins/kafka v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/plugins/otlp v0.0.0-00010101000000-000000000000
+	github.com/segmentio/kafka-go v0.4.47
+	github.com/testcontainers/testcontainers-go v0.33.0
+	github.com/testcontainers/testcontainers-go/modules/kafka v0.33.0
+	github.com/testcontainers/testcontainers-go/modules/localstack v0.33.0
+	go.opentelemetry.io/proto/otlp v1.3.1
+	google.golang.org/grpc v1.64.1
+	google.golang.org/protobuf v1.34.2
+)
+
+require (
+	github.com/bluele/gcache v0.0.2 // indirect
+	github.com/bufbuild/protocompile v0.14.1 // indirect
+	github.com/falcosecurity/plugins/shared/go/batch v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/errkind v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/health v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/metrics v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/mux v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/reload v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/secrets v0.0.0-00010101000000-000000000000 // indirect
+	github.com/fsnotify/fsnotify v1.6.0 // indirect
+	github.com/golang/snappy v0.0.4 // indirect
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.20.0 // indirect
+	github.com/linkedin/goavro/v2 v2.13.1 // indirect
+	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
+	github.com/xdg-go/scram v1.1.2 // indirect
+	github.com/xdg-go/stringprep v1.0.4 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20240513163218-0867130af1f8 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240610135401-a8a62080eff3 // indirect
+)
+
+require (
+	dario.cat/mergo v1.0.0 // indirect
+	github.com/Azure/go-ansiterm v0.0.0-20230124172434-306776ec8161 // indirect
+	github.com/Microsoft/go-winio v0.6.2 // indirect
+	github.com/alecthomas/jsonschema v0.0.0-20220216202328-9eeeec9d044b // indirect
+	github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream v1.6.2 // indirect
+	github.com/aws/aws-sdk-go-v2/feature/ec2/imds v1.16.1 // indirect
+	github.com/aws/aws-sdk-go-v2/feature/s3/manager v1.16.15 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/configsources v1.3.5 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.6.5 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/ini v1.8.0 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/v4a v1.3.5 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/accept-encoding v1.11.2 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/checksum v1.3.7 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/presigned-url v1.11.7 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/s3shared v1.17.5 // indirect
+	github.com/aws/aws-sdk-go-v2/service/sso v1.20.5 // indirect
+	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.23.4 // indirect
+	github.com/aws/aws-sdk-go-v2/service/sts v1.28.6 // indirect
+	github.com/aws/smithy-go v1.20.2 // indirect
+	github.com/bahlo/generic-list-go v0.2.0 // indirect
+	github.com/buger/jsonparser v1.1.1 // indirect
+	github.com/cenkalti/backoff/v4 v4.3.0 // indirect
+	github.com/containerd/containerd v1.7.18 // indirect
+	github.com/containerd/log v0.1.0 // indirect
+	github.com/containerd/platforms v0.2.1 // indirect
+	github.com/cpuguy83/dockercfg v0.3.1 // indirect
+	github.com/distribution/reference v0.6.0 // indirect
+	github.com/docker/docker v27.1.1+incompatible // indirect
+	github.com/docker/go-connections v0.5.0 // indirect
+	github.com/docker/go-units v0.5.0 // indirect
+	github.com/falcosecurity/plugins/plugins/okta v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/aws/s3sqs v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/bufpool v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/checkpoint v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/compress v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/debugserver v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/dedup v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/dlq v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/httpclient v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/intern v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/jsoncache v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/kafka/consumer v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/multishard v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/proto v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/ratelimit v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/schemaregistry v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/tail v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/tenant v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/webhook/cloudevents v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/webhook/queue v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/webhook/server v0.0.0-00010101000000-000000000000 // indirect
+	github.com/felixge/httpsnoop v1.0.4 // indirect
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/go-ole/go-ole v1.3.0 // indirect
+	github.com/gogo/protobuf v1.3.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/iancoleman/orderedmap v0.3.0 // indirect
+	github.com/invopop/jsonschema v0.12.0 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/lufia/plan9stats v0.0.0-20240513124658-fba389f38bae // indirect
+	github.com/magiconair/properties v1.8.7 // indirect
+	github.com/mailru/easyjson v0.7.7 // indirect
+	github.com/moby/docker-image-spec v1.3.1 // indirect
+	github.com/moby/patternmatcher v0.6.0 // indirect
+	github.com/moby/sys/sequential v0.5.0 // indirect
+	github.com/moby/sys/user v0.1.0 // indirect
+	github.com/moby/term v0.5.0 // indirect
+	github.com/morikuni/aec v1.0.0 // indirect
+	github.com/opencontainers/go-digest v1.0.0 // indirect
+	github.com/opencontainers/image-spec v1.1.0 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/power-devops/perfstat v0.0.0-20240221224432-82ca36839d55 // indirect
+	github.com/shirou/gopsutil/v3 v3.24.5 // indirect
+	github.com/shoenig/go-m1cpu v0.1.6 // indirect
+	github.com/sirupsen/logrus v1.9.3 // indirect
+	github.com/tklauser/go-sysconf v0.3.14 // indirect
+	github.com/tklauser/numcpus v0.8.0 // indirect
+	github.com/valyala/fastjson v1.6.4 // indirect
+	github.com/wk8/go-ordered-map/v2 v2.1.8 // indirect
+	github.com/yusufpapurcu/wmi v1.2.4 // indirect
+	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.52.0 // indirect
+	go.opentelemetry.io/otel v1.27.0 // indirect
+	go.opentelemetry.io/otel/metric v1.27.0 // indirect
+	go.opentelemetry.io/otel/trace v1.27.0 // indirect
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/mod v0.18.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/falcosecurity/plugins/plugins/cloudtrail => ../plugins/cloudtrail
+
+replace github.com/falcosecurity/plugins/plugins/k8saudit => ../plugins/k8saudit
+
+replace github.com/falcosecurity/plugins/plugins/kafka => ../plugins/kafka
+
+replace github.com/falcosecurity/plugins/plugins/okta => ../plugins/okta
+
+replace github.com/falcosecurity/plugins/shared/go/batch => ../shared/go/batch
+
+replace github.com/falcosecurity/plugins/shared/go/bufpool => ../shared/go/bufpool
+
+replace github.com/falcosecurity/plugins/shared/go/debugserver => ../shared/go/debugserver
+
+replace github.com/falcosecurity/plugins/shared/go/fuzz => ../shared/go/fuzz
+
+replace github.com/falcosecurity/plugins/shared/go/golden => ../shared/go/golden
+
+replace github.com/falcosecurity/plugins/shared/go/intern => ../shared/go/intern
+
+replace github.com/falcosecurity/plugins/shared/go/jsoncache => ../shared/go/jsoncache
+
+replace github.com/falcosecurity/plugins/shared/go/webhook/queue => ../shared/go/webhook/queue
+
+replace github.com/falcosecurity/plugins/shared/go/webhook/cloudevents => ../shared/go/webhook/cloudevents
+
+replace github.com/falcosecurity/plugins/plugins/otlp => ../plugins/otlp
+
+replace github.com/falcosecurity/plugins/shared/go/proto => ../shared/go/proto
+
+replace github.com/falcosecurity/plugins/shared/go/secrets => ../shared/go/secrets
+
+replace github.com/falcosecurity/plugins/shared/go/health => ../shared/go/health
+
+replace github.com/falcosecurity/plugins/shared/go/metrics => ../shared/go/metrics
+
+replace github.com/falcosecurity/plugins/shared/go/reload => ../shared/go/reload
+
+replace github.com/falcosecurity/plugins/shared/go/errkind => ../shared/go/errkind
+
+replace github.com/falcosecurity/plugins/shared/go/webhook/server => ../shared/go/webhook/server
+
+replace github.com/falcosecurity/plugins/shared/go/tenant => ../shared/go/tenant
+
+replace github.com/falcosecurity/plugins/shared/go/aws/s3sqs => ../shared/go/aws/s3sqs
+
+replace github.com/falcosecurity/plugins/shared/go/kafka/consumer => ../shared/go/kafka/consumer
+
+replace github.com/falcosecurity/plugins/shared/go/checkpoint => ../shared/go/checkpoint
+
+replace github.com/falcosecurity/plugins/shared/go/ratelimit => ../shared/go/ratelimit
+
+replace github.com/falcosecurity/plugins/shared/go/httpclient => ../shared/go/httpclient
+
+replace github.com/falcosecurity/plugins/shared/go/tail => ../shared/go/tail
+
+replace github.com/falcosecurity/plugins/shared/go/compress => ../shared/go/compress
+
+replace github.com/falcosecurity/plugins/shared/go/dlq => ../shared/go/dlq
+
+replace github.com/falcosecurity/plugins/shared/go/schemaregistry => ../shared/go/schemaregistry
+
+replace github.com/falcosecurity/plugins/shared/go/dedup => ../shared/go/dedup
+
+replace github.com/falcosecurity/plugins/shared/go/multishard => ../shared/go/multishard
+
+replace github.com/falcosecurity/plugins/shared/go/conformance => ../shared/go/conformance
+
+replace github.com/falcosecurity/plugins/shared/go/mux => ../shared/go/mux
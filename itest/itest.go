@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package itest runs the plugins end to end against emulated backends, such
+// as localstack, Kafka, kind clusters and fake webhook senders. The tests
+// drive the real ingestion loop of the plugins, from Init and Open to
+// NextBatch, and assert the number of events and the values extracted from
+// them. They require docker, and are only built with the itest tag:
+//
+//	go test -tags itest -v -timeout 30m ./...
+package itest
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+)
+
+const (
+	// batchSize is the number of events produced with each NextBatch call
+	batchSize = 128
+
+	// pollInterval is the delay before calling NextBatch again after a
+	// timeout, like Falco does when no event is available
+	pollInterval = 10 * time.Millisecond
+)
+
+// Source is a plugin supporting the event sourcing capability
+type Source interface {
+	Init(config string) error
+	Open(params string) (source.Instance, error)
+}
+
+// Extractor is a plugin supporting the field extraction capability
+type Extractor interface {
+	Fields() []sdk.FieldEntry
+	Extract(req sdk.ExtractRequest, evt sdk.EventReader) error
+}
+
+// Event is an event produced by a plugin
+type Event struct {
+	Num  uint64
+	Time time.Time
+	Data []byte
+}
+
+func (e *Event) EventNum() uint64 {
+	return e.Num
+}
+
+func (e *Event) Timestamp() uint64 {
+	return uint64(e.Time.UnixNano())
+}
+
+func (e *Event) Reader() io.ReadSeeker {
+	return bytes.NewReader(e.Data)
+}
+
+// Init initializes a plugin, and destroys it at the end of the test
+func Init(t *testing.T, p Source, config string) {
+	t.Helper()
+	if err := p.Init(config); err != nil {
+		t.Fatalf("init failed: %s", err.Error())
+	}
+	if d, ok := p.(sdk.Destroyer); ok {
+		t.Cleanup(d.Destroy)
+	}
+}
+
+// Stream is an open event stream of a plugin
+type Stream struct {
+	plugin   Source
+	instance source.Instance
+	batch    *eventWriters
+	num      uint64
+	eof      bool
+	closed   bool
+}
+
+// Open opens an event stream of an initialized plugin, and closes it at the
+// end of the test
+func Open(t *testing.T, p Source, params string) *Stream {
+	t.Helper()
+	inst, err := p.Open(params)
+	if err != nil {
+		t.Fatalf("open failed: %s", err.Error())
+	}
+	s := &Stream{plugin: p, instance: inst, batch: newEventWriters(batchSize)}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close closes the event stream, e.g. to open a new one in the test
+func (s *Stream) Close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if c, ok := s.instance.(sdk.Closer); ok {
+		c.Close()
+	}
+}
+
+// next calls NextBatch once, and returns the events it produced
+func (s *Stream) next() ([]*Event, error) {
+	count, err := s.instance.NextBatch(s.plugin, s.batch)
+	res := make([]*Event, 0, count)
+	for i := 0; i < count; i++ {
+		s.num++
+		w := s.batch.evts[i]
+		res = append(res, &Event{
+			Num:  s.num,
+			Time: time.Unix(0, int64(w.ts)),
+			Data: append([]byte(nil), w.data.Bytes()...),
+		})
+	}
+	if err == sdk.ErrEOF {
+		s.eof = true
+	}
+	return res, err
+}
+
+// Collect calls NextBatch until at least n events are produced, and fails
+// the test if the end of the stream is reached or the timeout expires before
+func (s *Stream) Collect(t *testing.T, n int, timeout time.Duration) []*Event {
+	t.Helper()
+	var res []*Event
+	deadline := time.Now().Add(timeout)
+	for len(res) < n {
+		if s.eof {
+			t.Fatalf("end of stream: got %d events, expected %d", len(res), n)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout after %s: got %d events, expected %d", timeout, len(res), n)
+		}
+		evts, err := s.next()
+		res = append(res, evts...)
+		switch err {
+		case nil, sdk.ErrEOF:
+		case sdk.ErrTimeout:
+			time.Sleep(pollInterval)
+		default:
+			t.Fatalf("next batch failed: %s", err.Error())
+		}
+	}
+	return res
+}
+
+// Drain calls NextBatch until the end of the stream, and fails the test if
+// the timeout expires before
+func (s *Stream) Drain(t *testing.T, timeout time.Duration) []*Event {
+	t.Helper()
+	var res []*Event
+	deadline := time.Now().Add(timeout)
+	for !s.eof {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout after %s: got %d events before the end of stream", timeout, len(res))
+		}
+		evts, err := s.next()
+		res = append(res, evts...)
+		switch err {
+		case nil, sdk.ErrEOF:
+		case sdk.ErrTimeout:
+			time.Sleep(pollInterval)
+		default:
+			t.Fatalf("next batch failed: %s", err.Error())
+		}
+	}
+	return res
+}
+
+// Find calls NextBatch until an event matches the given function, and fails
+// the test if the end of the stream is reached or the timeout expires before
+func (s *Stream) Find(t *testing.T, timeout time.Duration, match func(*Event) bool) *Event {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !s.eof {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout after %s: no matching event", timeout)
+		}
+		evts, err := s.next()
+		for _, evt := range evts {
+			if match(evt) {
+				return evt
+			}
+		}
+		switch err {
+		case nil, sdk.ErrEOF:
+		case sdk.ErrTimeout:
+			time.Sleep(pollInterval)
+		default:
+			t.Fatalf("next batch failed: %s", err.Error())
+		}
+	}
+	t.Fatal("end of stream: no matching event")
+	return nil
+}
+
+// Idle calls NextBatch for the given duration, and fails the test if any
+// event is produced, e.g. after a rejected webhook request
+func (s *Stream) Idle(t *testing.T, d time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(d)
+	for !s.eof && time.Now().Before(deadline) {
+		evts, err := s.next()
+		if len(evts) > 0 {
+			t.Fatalf("got %d unexpected events", len(evts))
+		}
+		if err != nil && err != sdk.ErrTimeout && err != sdk.ErrEOF {
+			t.Fatalf("next batch failed: %s", err.Error())
+		}
+		time.Sleep(pollInterval)
+	}
+}
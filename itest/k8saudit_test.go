@@ -0,0 +1,184 @@
+//go:build itest
+
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package itest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/falcosecurity/plugins/plugins/k8saudit/pkg/k8saudit"
+)
+
+const k8sTimeout = time.Minute
+
+// k8sEventList returns an EventList of audit events, like the ones sent by
+// the webhook backend of the API server
+func k8sEventList(t *testing.T, batch, size int) []byte {
+	t.Helper()
+	list := map[string]interface{}{
+		"kind":       "EventList",
+		"apiVersion": "audit.k8s.io/v1",
+	}
+	var items []interface{}
+	for i := 0; i < size; i++ {
+		items = append(items, map[string]interface{}{
+			"kind":                     "Event",
+			"apiVersion":               "audit.k8s.io/v1",
+			"level":                    "Request",
+			"auditID":                  fmt.Sprintf("%04d-%04d", batch, i),
+			"stage":                    "ResponseComplete",
+			"verb":                     "create",
+			"requestURI":               "/api/v1/namespaces/itest/configmaps",
+			"user":                     map[string]interface{}{"username": "itest"},
+			"objectRef":                map[string]interface{}{"resource": "configmaps", "namespace": "itest", "name": fmt.Sprintf("cm-%d", i)},
+			"responseStatus":           map[string]interface{}{"code": 201},
+			"requestReceivedTimestamp": "2024-01-01T00:00:00.000000Z",
+			"stageTimestamp":           "2024-01-01T00:00:00.100000Z",
+		})
+	}
+	list["items"] = items
+	data, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestK8sAuditWebhook(t *testing.T) {
+	endpoint := fmt.Sprintf("http://127.0.0.1:%d/k8s-audit", FreePort(t))
+	p := &k8saudit.Plugin{}
+	Init(t, p, `{"webhookMaxBatchSize":65536}`)
+	s := Open(t, p, strings.Replace(endpoint, "127.0.0.1", "", 1))
+	wh := NewWebhook(t, endpoint, k8sTimeout)
+
+	const batches, size = 10, 25
+	for i := 0; i < batches; i++ {
+		if code := wh.Send(t, k8sEventList(t, i, size), nil); code != http.StatusOK {
+			t.Fatalf("batch %d: unexpected status code %d", i, code)
+		}
+	}
+	evts := s.Collect(t, batches*size, k8sTimeout)
+	if len(evts) != batches*size {
+		t.Fatalf("got %d events, expected %d", len(evts), batches*size)
+	}
+	ids := make(map[interface{}]bool)
+	for _, evt := range evts {
+		ids[Extract(t, p, evt, "ka.auditid")] = true
+		if v := Extract(t, p, evt, "ka.target.resource"); v != "configmaps" {
+			t.Errorf("event #%d: unexpected ka.target.resource %v", evt.Num, v)
+		}
+		if v := Extract(t, p, evt, "ka.user.name"); v != "itest" {
+			t.Errorf("event #%d: unexpected ka.user.name %v", evt.Num, v)
+		}
+	}
+	if len(ids) != batches*size {
+		t.Errorf("got %d distinct events, expected %d", len(ids), batches*size)
+	}
+
+	// invalid requests are refused, and malformed payloads are dropped
+	if code := wh.Send(t, k8sEventList(t, 0, 1000), nil); code != http.StatusBadRequest {
+		t.Errorf("oversized batch: unexpected status code %d", code)
+	}
+	if code := wh.Send(t, []byte(`{"kind":"EventList","items":[{"kind":"Event"}]}`), nil); code != http.StatusOK {
+		t.Errorf("malformed event: unexpected status code %d", code)
+	}
+	if code := wh.Send(t, []byte(`not json`), nil); code != http.StatusOK {
+		t.Errorf("malformed batch: unexpected status code %d", code)
+	}
+	s.Idle(t, 2*time.Second)
+}
+
+func TestK8sAuditWebhookCloudEvents(t *testing.T) {
+	endpoint := fmt.Sprintf("http://127.0.0.1:%d/k8s-audit", FreePort(t))
+	p := &k8saudit.Plugin{}
+	Init(t, p, `{"webhookMaxBatchSize":65536}`)
+	s := Open(t, p, strings.Replace(endpoint, "127.0.0.1", "", 1))
+	wh := NewWebhook(t, endpoint, k8sTimeout)
+
+	// the same batches, in binary and structured content modes
+	const size = 5
+	if code := wh.Send(t, k8sEventList(t, 0, size), BinaryCloudEvent("binary", "io.k8s.audit")); code != http.StatusOK {
+		t.Fatalf("binary mode: unexpected status code %d", code)
+	}
+	body, header := CloudEvent(t, "structured", "io.k8s.audit", k8sEventList(t, 1, size))
+	if code := wh.Send(t, body, header); code != http.StatusOK {
+		t.Fatalf("structured mode: unexpected status code %d", code)
+	}
+	evts := s.Collect(t, 2*size, k8sTimeout)
+	if len(evts) != 2*size {
+		t.Fatalf("got %d events, expected %d", len(evts), 2*size)
+	}
+	for _, evt := range evts {
+		id := "binary"
+		if strings.HasPrefix(Extract(t, p, evt, "ka.auditid").(string), "0001-") {
+			id = "structured"
+		}
+		for field, expected := range map[string]string{
+			"ce.specversion":            "1.0",
+			"ce.id":                     id,
+			"ce.source":                 "/itest",
+			"ce.type":                   "io.k8s.audit",
+			"ce.extension[traceparent]": "00-" + id,
+			"ka.target.resource":        "configmaps",
+		} {
+			if v := Extract(t, p, evt, field); v != expected {
+				t.Errorf("event #%d: unexpected %s %v", evt.Num, field, v)
+			}
+		}
+	}
+
+	// invalid envelopes are refused
+	body, header = CloudEvent(t, "", "io.k8s.audit", k8sEventList(t, 2, size))
+	if code := wh.Send(t, body, header); code != http.StatusBadRequest {
+		t.Errorf("missing id: unexpected status code %d", code)
+	}
+	s.Idle(t, 2*time.Second)
+}
+
+func TestK8sAuditKind(t *testing.T) {
+	RequireDocker(t)
+	RequireCommands(t, "kind", "kubectl")
+	port := FreePort(t)
+	p := &k8saudit.Plugin{}
+	Init(t, p, `{}`)
+	s := Open(t, p, fmt.Sprintf("http://:%d/k8s-audit", port))
+
+	k := StartKind(t, "falco-itest", fmt.Sprintf("http://%s:%d/k8s-audit", DockerHostAddress(t), port))
+	k.Kubectl(t, "create", "namespace", "falco-itest")
+	k.Kubectl(t, "create", "configmap", "falco-itest", "--namespace", "falco-itest", "--from-literal", "key=value")
+
+	evt := s.Find(t, k8sTimeout, func(evt *Event) bool {
+		return Extract(t, p, evt, "ka.target.namespace") == "falco-itest" &&
+			Extract(t, p, evt, "ka.target.resource") == "configmaps"
+	})
+	if v := Extract(t, p, evt, "ka.verb"); v != "create" {
+		t.Errorf("unexpected ka.verb %v", v)
+	}
+	if v := Extract(t, p, evt, "ka.target.name"); v != "falco-itest" {
+		t.Errorf("unexpected ka.target.name %v", v)
+	}
+	if v := Extract(t, p, evt, "ka.user.name"); v != "kubernetes-admin" {
+		t.Errorf("unexpected ka.user.name %v", v)
+	}
+}
@@ -0,0 +1,151 @@
+//go:build itest
+
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package itest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/falcosecurity/plugins/plugins/kafka/pkg/kafka"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const (
+	kafkaTopic      = "itest"
+	kafkaPartitions = 4
+	kafkaTimeout    = 2 * time.Minute
+)
+
+// kafkaConfig returns the init config of the plugin
+func kafkaConfig(t *testing.T, brokers []string) string {
+	t.Helper()
+	data, err := json.Marshal(kafka.PluginConfig{
+		Brokers:   brokers,
+		GroupId:   "itest",
+		Topics:    []string{kafkaTopic},
+		Consumers: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// kafkaWrite writes messages whose value is <key>:<seq>, spread over a few
+// keys, and thus over the partitions of the topic
+func kafkaWrite(t *testing.T, brokers []string, from, to int) {
+	t.Helper()
+	w := &kafkago.Writer{
+		Addr:     kafkago.TCP(brokers...),
+		Topic:    kafkaTopic,
+		Balancer: &kafkago.Hash{},
+	}
+	defer w.Close()
+
+	var msgs []kafkago.Message
+	for i := from; i < to; i++ {
+		key := fmt.Sprintf("key-%d", i%kafkaPartitions)
+		msgs = append(msgs, kafkago.Message{
+			Key:   []byte(key),
+			Value: []byte(fmt.Sprintf("%s:%d", key, i)),
+		})
+	}
+	if err := w.WriteMessages(context.Background(), msgs...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// kafkaCheck fails the test if the events of a key are not in order, and
+// returns the sequence numbers of the events
+func kafkaCheck(t *testing.T, evts []*Event) map[int]bool {
+	t.Helper()
+	res := make(map[int]bool)
+	last := make(map[string]int)
+	for _, evt := range evts {
+		parts := strings.SplitN(string(evt.Data), ":", 2)
+		seq, err := strconv.Atoi(parts[len(parts)-1])
+		if len(parts) != 2 || err != nil {
+			t.Fatalf("event #%d: unexpected data %q", evt.Num, evt.Data)
+		}
+		if prev, ok := last[parts[0]]; ok && seq < prev {
+			t.Errorf("event #%d: %s received after %d", evt.Num, evt.Data, prev)
+		}
+		last[parts[0]] = seq
+		res[seq] = true
+	}
+	return res
+}
+
+func TestKafka(t *testing.T) {
+	brokers := StartKafka(t)
+	conn, err := kafkago.Dial("tcp", brokers[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.CreateTopics(kafkago.TopicConfig{
+		Topic:             kafkaTopic,
+		NumPartitions:     kafkaPartitions,
+		ReplicationFactor: 1,
+	})
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const count = 500
+	kafkaWrite(t, brokers, 0, count)
+	p := &kafka.Plugin{}
+	Init(t, p, kafkaConfig(t, brokers))
+	s := Open(t, p, "")
+	seqs := kafkaCheck(t, s.Collect(t, count, kafkaTimeout))
+	if len(seqs) != count {
+		t.Fatalf("got %d distinct events, expected %d", len(seqs), count)
+	}
+	s.Close()
+	p.Destroy()
+
+	// the offsets of the consumed messages are committed, so that a new
+	// consumer of the group only receives the new ones. The last message
+	// of a partition can be received again if the stream was closed before
+	// its offset was committed.
+	kafkaWrite(t, brokers, count, 2*count)
+	p = &kafka.Plugin{}
+	Init(t, p, kafkaConfig(t, brokers))
+	s = Open(t, p, "")
+	seqs = make(map[int]bool)
+	again := 0
+	s.Find(t, kafkaTimeout, func(evt *Event) bool {
+		for seq := range kafkaCheck(t, []*Event{evt}) {
+			if seq < count {
+				again++
+			}
+			seqs[seq] = true
+		}
+		return len(seqs)-again == count
+	})
+	if again > kafkaPartitions {
+		t.Errorf("%d messages received again", again)
+	}
+}
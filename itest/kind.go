@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package itest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const kindCreateTimeout = 5 * time.Minute
+
+// auditPolicy logs the metadata of every request, except the noisy read
+// only requests of the control plane
+const auditPolicy = `apiVersion: audit.k8s.io/v1
+kind: Policy
+omitStages:
+  - RequestReceived
+rules:
+  - level: None
+    verbs: ["get", "list", "watch"]
+  - level: Request
+`
+
+const auditWebhookConfig = `apiVersion: v1
+kind: Config
+clusters:
+  - name: falco
+    cluster:
+      server: %s
+contexts:
+  - name: default
+    context:
+      cluster: falco
+      user: ""
+current-context: default
+users: []
+`
+
+// the audit directory is mounted in the kind node, and then in the API
+// server static pod
+const kindConfig = `kind: Cluster
+apiVersion: kind.x-k8s.io/v1alpha4
+nodes:
+  - role: control-plane
+    extraMounts:
+      - hostPath: %s
+        containerPath: /etc/kubernetes/audit
+        readOnly: true
+    kubeadmConfigPatches:
+      - |
+        kind: ClusterConfiguration
+        apiServer:
+          extraArgs:
+            audit-policy-file: /etc/kubernetes/audit/policy.yaml
+            audit-webhook-config-file: /etc/kubernetes/audit/webhook.yaml
+            audit-webhook-batch-max-wait: 1s
+          extraVolumes:
+            - name: audit
+              hostPath: /etc/kubernetes/audit
+              mountPath: /etc/kubernetes/audit
+              readOnly: true
+              pathType: Directory
+`
+
+// Kind is a running kind cluster
+type Kind struct {
+	Name       string
+	Kubeconfig string
+}
+
+// StartKind creates a kind cluster sending its audit events to a webhook
+// endpoint, which is deleted at the end of the test. The endpoint must be
+// reachable from the kind node container, see DockerHostAddress.
+func StartKind(t *testing.T, name, auditWebhookURL string) *Kind {
+	t.Helper()
+	RequireDocker(t)
+	RequireCommands(t, "kind", "kubectl")
+
+	dir := t.TempDir()
+	auditDir := filepath.Join(dir, "audit")
+	writeFile(t, filepath.Join(auditDir, "policy.yaml"), auditPolicy)
+	writeFile(t, filepath.Join(auditDir, "webhook.yaml"), fmt.Sprintf(auditWebhookConfig, auditWebhookURL))
+	writeFile(t, filepath.Join(dir, "kind.yaml"), fmt.Sprintf(kindConfig, auditDir))
+
+	k := &Kind{Name: name, Kubeconfig: filepath.Join(dir, "kubeconfig")}
+	ctx, cancel := context.WithTimeout(context.Background(), kindCreateTimeout)
+	defer cancel()
+	t.Cleanup(func() {
+		run(t, context.Background(), "kind", "delete", "cluster", "--name", k.Name, "--kubeconfig", k.Kubeconfig)
+	})
+	run(t, ctx, "kind", "create", "cluster", "--name", k.Name, "--config", filepath.Join(dir, "kind.yaml"),
+		"--kubeconfig", k.Kubeconfig, "--wait", "2m")
+	return k
+}
+
+// Kubectl runs a kubectl command against the cluster, and returns its output
+func (k *Kind) Kubectl(t *testing.T, args ...string) string {
+	t.Helper()
+	return run(t, context.Background(), "kubectl", append([]string{"--kubeconfig", k.Kubeconfig}, args...)...)
+}
+
+// DockerHostAddress returns the address of the host on the default docker
+// bridge network, which is reachable from the containers of every network
+func DockerHostAddress(t *testing.T) string {
+	t.Helper()
+	RequireDocker(t)
+	out := run(t, context.Background(), "docker", "network", "inspect", "bridge",
+		"--format", "{{range .IPAM.Config}}{{.Gateway}}{{end}}")
+	if len(out) == 0 {
+		t.Fatal("can't find the gateway of the docker bridge network")
+	}
+	return out
+}
+
+func run(t *testing.T, ctx context.Context, name string, args ...string) string {
+	t.Helper()
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s %s failed: %s\n%s", name, strings.Join(args, " "), err.Error(), out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
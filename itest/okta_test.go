@@ -0,0 +1,171 @@
+//go:build itest
+
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package itest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/falcosecurity/plugins/plugins/okta/pkg/okta"
+)
+
+const (
+	oktaSecret  = "itest-secret"
+	oktaTimeout = 30 * time.Second
+)
+
+// oktaHookPayload returns an Event Hook request body, like the ones sent by
+// Okta
+func oktaHookPayload(t *testing.T, batch, size int) []byte {
+	t.Helper()
+	var events []interface{}
+	for i := 0; i < size; i++ {
+		events = append(events, map[string]interface{}{
+			"uuid":      fmt.Sprintf("%04d-%04d", batch, i),
+			"published": "2024-01-01T00:00:00.000Z",
+			"eventType": "user.session.start",
+			"severity":  "INFO",
+			"actor": map[string]interface{}{
+				"id":          "00u1",
+				"type":        "User",
+				"alternateId": "itest@example.com",
+				"displayName": "itest",
+			},
+			"client":  map[string]interface{}{"ipAddress": "192.0.2.1"},
+			"outcome": map[string]interface{}{"result": "SUCCESS"},
+		})
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"eventType":          "com.okta.event_hook",
+		"eventTypeVersion":   "1.0",
+		"cloudEventsVersion": "0.1",
+		"data":               map[string]interface{}{"events": events},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestOktaEventHook(t *testing.T) {
+	endpoint := fmt.Sprintf("http://127.0.0.1:%d/okta", FreePort(t))
+	p := &okta.Plugin{}
+	Init(t, p, fmt.Sprintf(`{"event_hook_secret":%q}`, oktaSecret))
+	s := Open(t, p, endpoint)
+	wh := NewWebhook(t, endpoint, oktaTimeout)
+
+	// one-time verification of the endpoint
+	req, _ := http.NewRequest(http.MethodGet, endpoint, nil)
+	req.Header.Set("X-Okta-Verification-Challenge", "itest-challenge")
+	resp, err := wh.Client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var verification map[string]string
+	err = json.NewDecoder(resp.Body).Decode(&verification)
+	resp.Body.Close()
+	if err != nil || verification["verification"] != "itest-challenge" {
+		t.Fatalf("unexpected verification response: %v %v", verification, err)
+	}
+
+	// requests authenticated with the secret, as sent by Okta, or with a
+	// signature, as sent by proxies
+	const batches, size = 10, 20
+	for i := 0; i < batches; i++ {
+		body := oktaHookPayload(t, i, size)
+		header := http.Header{"Authorization": {oktaSecret}}
+		if i%2 == 1 {
+			header = http.Header{"X-Okta-Signature": {SignHMAC(oktaSecret, body)}}
+		}
+		if code := wh.Send(t, body, header); code != http.StatusOK {
+			t.Fatalf("batch %d: unexpected status code %d", i, code)
+		}
+	}
+	evts := s.Collect(t, batches*size, oktaTimeout)
+	if len(evts) != batches*size {
+		t.Fatalf("got %d events, expected %d", len(evts), batches*size)
+	}
+	for _, evt := range evts {
+		if v := Extract(t, p, evt, "okta.evt.type"); v != "user.session.start" {
+			t.Errorf("event #%d: unexpected okta.evt.type %v", evt.Num, v)
+		}
+		if v := Extract(t, p, evt, "okta.actor.name"); v != "itest" {
+			t.Errorf("event #%d: unexpected okta.actor.name %v", evt.Num, v)
+		}
+		if v := Extract(t, p, evt, "okta.client.ip"); v != "192.0.2.1" {
+			t.Errorf("event #%d: unexpected okta.client.ip %v", evt.Num, v)
+		}
+	}
+
+	// unauthenticated requests are refused
+	body := oktaHookPayload(t, batches, size)
+	for _, header := range []http.Header{
+		nil,
+		{"Authorization": {"wrong"}},
+		{"X-Okta-Signature": {SignHMAC("wrong", body)}},
+	} {
+		if code := wh.Send(t, body, header); code != http.StatusUnauthorized {
+			t.Errorf("unexpected status code %d with headers %v", code, header)
+		}
+	}
+	s.Idle(t, 2*time.Second)
+}
+
+func TestOktaEventHookCloudEvents(t *testing.T) {
+	endpoint := fmt.Sprintf("http://127.0.0.1:%d/okta", FreePort(t))
+	p := &okta.Plugin{}
+	Init(t, p, fmt.Sprintf(`{"event_hook_secret":%q}`, oktaSecret))
+	s := Open(t, p, endpoint)
+	wh := NewWebhook(t, endpoint, oktaTimeout)
+
+	// the same payloads, in binary and structured content modes
+	const size = 5
+	header := BinaryCloudEvent("binary", "com.okta.event_hook")
+	header.Set("Authorization", oktaSecret)
+	if code := wh.Send(t, oktaHookPayload(t, 0, size), header); code != http.StatusOK {
+		t.Fatalf("binary mode: unexpected status code %d", code)
+	}
+	body, header := CloudEvent(t, "structured", "com.okta.event_hook", oktaHookPayload(t, 1, size))
+	header.Set("Authorization", oktaSecret)
+	if code := wh.Send(t, body, header); code != http.StatusOK {
+		t.Fatalf("structured mode: unexpected status code %d", code)
+	}
+	evts := s.Collect(t, 2*size, oktaTimeout)
+	if len(evts) != 2*size {
+		t.Fatalf("got %d events, expected %d", len(evts), 2*size)
+	}
+	ids := make(map[interface{}]int)
+	for _, evt := range evts {
+		ids[Extract(t, p, evt, "ce.id")]++
+		if v := Extract(t, p, evt, "ce.type"); v != "com.okta.event_hook" {
+			t.Errorf("event #%d: unexpected ce.type %v", evt.Num, v)
+		}
+		if v := Extract(t, p, evt, "okta.evt.type"); v != "user.session.start" {
+			t.Errorf("event #%d: unexpected okta.evt.type %v", evt.Num, v)
+		}
+	}
+	if ids["binary"] != size || ids["structured"] != size {
+		t.Errorf("unexpected ce.id values %v", ids)
+	}
+	s.Idle(t, 2*time.Second)
+}
@@ -0,0 +1,136 @@
+//go:build itest
+
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package itest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/falcosecurity/plugins/plugins/otlp/pkg/otlp"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+const otlpTimeout = 30 * time.Second
+
+// otlpRequest returns an export request of log records, like the ones sent
+// by the OpenTelemetry SDKs and collectors
+func otlpRequest(service string, size int) *collogspb.ExportLogsServiceRequest {
+	str := func(s string) *commonpb.AnyValue {
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s}}
+	}
+	var records []*logspb.LogRecord
+	for i := 0; i < size; i++ {
+		records = append(records, &logspb.LogRecord{
+			TimeUnixNano:   uint64(time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC).UnixNano()),
+			SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_WARN,
+			Body:           str(fmt.Sprintf("record %d", i)),
+			Attributes:     []*commonpb.KeyValue{{Key: "user.id", Value: str("itest")}},
+			TraceId:        bytes.Repeat([]byte{0xab}, 16),
+		})
+	}
+	return &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource:  &resourcepb.Resource{Attributes: []*commonpb.KeyValue{{Key: "service.name", Value: str(service)}}},
+			ScopeLogs: []*logspb.ScopeLogs{{LogRecords: records}},
+		}},
+	}
+}
+
+func TestOTLPReceiver(t *testing.T) {
+	grpcPort, httpPort := FreePort(t), FreePort(t)
+	p := &otlp.Plugin{}
+	Init(t, p, `{}`)
+	s := Open(t, p, fmt.Sprintf("grpc://127.0.0.1:%d,http://127.0.0.1:%d", grpcPort, httpPort))
+	endpoint := fmt.Sprintf("http://127.0.0.1:%d/v1/logs", httpPort)
+	wh := NewWebhook(t, endpoint, otlpTimeout)
+
+	// OTLP/gRPC
+	conn, err := grpc.NewClient(fmt.Sprintf("127.0.0.1:%d", grpcPort), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	const size = 10
+	ctx, cancel := context.WithTimeout(context.Background(), otlpTimeout)
+	defer cancel()
+	if _, err := collogspb.NewLogsServiceClient(conn).Export(ctx, otlpRequest("grpc", size)); err != nil {
+		t.Fatal(err)
+	}
+
+	// OTLP/HTTP, in gzipped protobuf and in JSON with hex encoded IDs
+	b, err := proto.Marshal(otlpRequest("protobuf", size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(b)
+	w.Close()
+	header := http.Header{"Content-Type": {"application/x-protobuf"}, "Content-Encoding": {"gzip"}}
+	if code := wh.Send(t, gz.Bytes(), header); code != http.StatusOK {
+		t.Fatalf("protobuf: unexpected status code %d", code)
+	}
+	body := []byte(`{"resourceLogs":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"json"}}]},"scopeLogs":[{"logRecords":[{"timeUnixNano":"1704067200000000000","severityNumber":13,"body":{"stringValue":"record"},"attributes":[{"key":"user.id","value":{"stringValue":"itest"}}],"traceId":"abababababababababababababababab"}]}]}]}`)
+	if code := wh.Send(t, body, nil); code != http.StatusOK {
+		t.Fatalf("json: unexpected status code %d", code)
+	}
+
+	evts := s.Collect(t, 2*size+1, otlpTimeout)
+	if len(evts) != 2*size+1 {
+		t.Fatalf("got %d events, expected %d", len(evts), 2*size+1)
+	}
+	services := map[interface{}]int{}
+	for _, evt := range evts {
+		services[Extract(t, p, evt, "otel.service.name")]++
+		for field, expected := range map[string]interface{}{
+			"otel.severity":        "WARN",
+			"otel.severity.number": uint64(13),
+			"otel.attr[user.id]":   "itest",
+			"otel.trace_id":        "abababababababababababababababab",
+		} {
+			if v := Extract(t, p, evt, field); v != expected {
+				t.Errorf("event #%d: unexpected %s %v", evt.Num, field, v)
+			}
+		}
+	}
+	if services["grpc"] != size || services["protobuf"] != size || services["json"] != 1 {
+		t.Errorf("unexpected otel.service.name values %v", services)
+	}
+
+	// invalid requests are refused
+	if code := wh.Send(t, []byte(`not json`), nil); code != http.StatusBadRequest {
+		t.Errorf("malformed request: unexpected status code %d", code)
+	}
+	if code := wh.Send(t, body, http.Header{"Content-Type": {"text/plain"}}); code != http.StatusUnsupportedMediaType {
+		t.Errorf("wrong content type: unexpected status code %d", code)
+	}
+	s.Idle(t, 2*time.Second)
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package itest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Webhook sends requests to the webhook endpoint opened by a plugin, like
+// the upstream services would do
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhook waits until the webhook endpoint accepts connections, which
+// happens in the background after the plugin opened its event stream
+func NewWebhook(t *testing.T, endpoint string, timeout time.Duration) *Webhook {
+	t.Helper()
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", u.Host, time.Second)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("webhook endpoint %s not available: %s", endpoint, err.Error())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return &Webhook{URL: endpoint, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Send posts a JSON body with the given headers, and returns the status
+// code of the response. The content type is application/json unless set in
+// the headers.
+func (w *Webhook) Send(t *testing.T, body []byte, header http.Header) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.StatusCode
+}
+
+// SignHMAC returns the hex encoded HMAC-SHA256 of a body signed with a
+// secret, in the sha256=<hex> format of the signature headers
+func SignHMAC(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// CloudEvent wraps a JSON body in a CloudEvents envelope in structured
+// content mode, and returns it along with the content type to send it with
+func CloudEvent(t *testing.T, id, typ string, data []byte) ([]byte, http.Header) {
+	t.Helper()
+	body, err := json.Marshal(map[string]interface{}{
+		"specversion": "1.0",
+		"id":          id,
+		"source":      "/itest",
+		"type":        typ,
+		"traceparent": "00-" + id,
+		"data":        json.RawMessage(data),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body, http.Header{"Content-Type": {"application/cloudevents+json"}}
+}
+
+// BinaryCloudEvent returns the headers sending a JSON body as a CloudEvent
+// in binary content mode
+func BinaryCloudEvent(id, typ string) http.Header {
+	return http.Header{
+		"Ce-Specversion": {"1.0"},
+		"Ce-Id":          {id},
+		"Ce-Source":      {"/itest"},
+		"Ce-Type":        {typ},
+		"Ce-Traceparent": {"00-" + id},
+	}
+}
@@ -3,7 +3,6 @@ module github.com/falcosecurity/plugins/plugins/cloudtrail
 go 1.21
 
 require (
-	github.com/aws/aws-lambda-go v1.47.0
 	github.com/aws/aws-sdk-go-v2 v1.26.1
 	github.com/aws/aws-sdk-go-v2/config v1.27.11
 	github.com/aws/aws-sdk-go-v2/feature/s3/manager v1.16.15
@@ -11,10 +10,28 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/sqs v1.31.4
 	github.com/aws/smithy-go v1.20.2
 	github.com/falcosecurity/plugin-sdk-go v0.7.3
+	github.com/falcosecurity/plugins/shared/go/aws/s3sqs v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/compress v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/conformance v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/debugserver v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/dlq v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/errkind v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/fuzz v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/golden v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/health v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/intern v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/jsoncache v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/metrics v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/secrets v0.0.0-00010101000000-000000000000
 	github.com/invopop/jsonschema v0.12.0
 	github.com/valyala/fastjson v1.6.4
 )
 
+require (
+	github.com/klauspost/compress v1.17.9 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+)
+
 require (
 	github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream v1.6.2 // indirect
 	github.com/aws/aws-sdk-go-v2/credentials v1.17.11 // indirect
@@ -32,8 +49,37 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/sts v1.28.6 // indirect
 	github.com/bahlo/generic-list-go v0.2.0 // indirect
 	github.com/buger/jsonparser v1.1.1 // indirect
+	github.com/falcosecurity/plugins/shared/go/mux v0.0.0-00010101000000-000000000000 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/wk8/go-ordered-map/v2 v2.1.8 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/falcosecurity/plugins/shared/go/jsoncache => ../../shared/go/jsoncache
+
+replace github.com/falcosecurity/plugins/shared/go/debugserver => ../../shared/go/debugserver
+
+replace github.com/falcosecurity/plugins/shared/go/intern => ../../shared/go/intern
+
+replace github.com/falcosecurity/plugins/shared/go/golden => ../../shared/go/golden
+
+replace github.com/falcosecurity/plugins/shared/go/fuzz => ../../shared/go/fuzz
+
+replace github.com/falcosecurity/plugins/shared/go/secrets => ../../shared/go/secrets
+
+replace github.com/falcosecurity/plugins/shared/go/health => ../../shared/go/health
+
+replace github.com/falcosecurity/plugins/shared/go/metrics => ../../shared/go/metrics
+
+replace github.com/falcosecurity/plugins/shared/go/errkind => ../../shared/go/errkind
+
+replace github.com/falcosecurity/plugins/shared/go/aws/s3sqs => ../../shared/go/aws/s3sqs
+
+replace github.com/falcosecurity/plugins/shared/go/dlq => ../../shared/go/dlq
+
+replace github.com/falcosecurity/plugins/shared/go/compress => ../../shared/go/compress
+
+replace github.com/falcosecurity/plugins/shared/go/conformance => ../../shared/go/conformance
+
+replace github.com/falcosecurity/plugins/shared/go/mux => ../../shared/go/mux
@@ -19,9 +19,12 @@ package cloudtrail
 
 import (
 	"context"
+	"errors"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/smithy-go"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
 )
 
 // PluginConfigAWS contains configuration options for the AWS SDK.
@@ -66,3 +69,21 @@ func (p *PluginConfigAWS) ConfigAWS() (aws.Config, error) {
 	ctx := context.Background()
 	return config.LoadDefaultConfig(ctx, opts...)
 }
+
+// awsErrorKind returns the category of an error returned by the AWS SDK,
+// from its error code when it's an API error
+func awsErrorKind(err error) errkind.Kind {
+	var aErr smithy.APIError
+	if errors.As(err, &aErr) {
+		switch aErr.ErrorCode() {
+		case "AccessDenied", "AccessDeniedException", "ExpiredToken", "ExpiredTokenException",
+			"InvalidAccessKeyId", "InvalidClientTokenId", "SignatureDoesNotMatch", "UnrecognizedClientException":
+			return errkind.Auth
+		case "Throttling", "ThrottlingException", "SlowDown", "RequestLimitExceeded":
+			return errkind.RateLimited
+		case "NoSuchBucket", "AWS.SimpleQueueService.NonExistentQueue", "QueueDoesNotExist":
+			return errkind.Config
+		}
+	}
+	return errkind.Of(err)
+}
@@ -26,11 +26,10 @@ limitations under the License.
 package cloudtrail
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
-	"math"
+	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
@@ -38,6 +37,14 @@ import (
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/symbols/extract"
 	_ "github.com/falcosecurity/plugin-sdk-go/pkg/sdk/symbols/progress"
+	"github.com/falcosecurity/plugins/shared/go/debugserver"
+	"github.com/falcosecurity/plugins/shared/go/dlq"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/intern"
+	"github.com/falcosecurity/plugins/shared/go/jsoncache"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	"github.com/falcosecurity/plugins/shared/go/secrets"
 	"github.com/invopop/jsonschema"
 	"github.com/valyala/fastjson"
 )
@@ -55,11 +62,16 @@ const (
 // This is the global plugin state, identifying an instance of this plugin
 type Plugin struct {
 	plugins.BasePlugin
-	jparser     fastjson.Parser
-	jdata       *fastjson.Value
-	jdataEvtnum uint64 // The event number jdata refers to. Used to know when we can skip the unmarshaling.
-	Config      PluginConfig
-	ConfigAWS   aws.Config
+	jcache    jsoncache.Cache // Caches the json of the last event, so that it's parsed once for all the extractions.
+	jdata     *fastjson.Value
+	strs      intern.Pool // Interns the string values repeated across events.
+	Config    PluginConfig
+	ConfigAWS aws.Config
+
+	debugServer *debugserver.Server
+	health      *health.Server
+	metrics     *metrics.Metrics
+	deadLetter  dlq.Sink
 }
 
 func (p *Plugin) Info() *plugins.Info {
@@ -86,15 +98,15 @@ func (p *Plugin) InitSchema() *sdk.SchemaInfo {
 	return nil
 }
 
-func (p *Plugin) Init(cfg string) error {
-	// initialize state
-	p.jdataEvtnum = math.MaxUint64
-
+func (p *Plugin) Init(cfg string) (err error) {
 	// Set config default values and read the passed one, if available.
 	// Since we provide a schema through InitSchema(), the framework
 	// guarantees that the config is always well-formed json.
 	p.Config.Reset()
 	json.Unmarshal([]byte(cfg), &p.Config)
+	if err := secrets.Resolve(&p.Config); err != nil {
+		return err
+	}
 
 	// create an AWS config from the given plugin config
 	awsCfg, err := p.Config.AWS.ConfigAWS()
@@ -105,10 +117,84 @@ func (p *Plugin) Init(cfg string) error {
 
 	// enable/disable async extraction optimazion (enabled by default)
 	extract.SetAsync(p.Config.UseAsync)
+
+	// the framework doesn't call Destroy when Init fails, so the servers
+	// started before a failure are stopped here
+	defer func() {
+		if err != nil {
+			p.Destroy()
+		}
+	}()
+
+	// start the optional pprof and expvar server
+	if len(p.Config.DebugAddress) > 0 {
+		srv, err := debugserver.Start(p.Config.DebugAddress)
+		if err != nil {
+			return err
+		}
+		p.debugServer = srv
+	}
+
+	// start the optional health server
+	if len(p.Config.HealthAddress) > 0 {
+		srv, err := health.Start(p.Config.HealthAddress, p.Config.HealthPath)
+		if err != nil {
+			return err
+		}
+		p.health = srv
+	}
+
+	// start the optional metrics endpoint
+	if len(p.Config.MetricsAddress) > 0 {
+		m, err := metrics.Start(p.Config.MetricsAddress, p.Config.MetricsPath, PluginName)
+		if err != nil {
+			return err
+		}
+		p.metrics = m
+	}
+
+	// open the sink of the records that can't be parsed, which are
+	// counted in the metrics when they are dropped
+	sink, err := dlq.Open(p.Config.DeadLetter, dlq.Options{
+		Plugin:  PluginName,
+		Counter: p.metrics,
+		AWS:     &p.ConfigAWS,
+		Logf: func(format string, v ...interface{}) {
+			log.Printf("[%s] "+format+"\n", append([]interface{}{PluginName}, v...)...)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	p.deadLetter = sink
 	return nil
 }
 
+func (p *Plugin) Destroy() {
+	if p.deadLetter != nil {
+		p.deadLetter.Close()
+		p.deadLetter = nil
+	}
+	if p.debugServer != nil {
+		p.debugServer.Close()
+		p.debugServer = nil
+	}
+	if p.health != nil {
+		p.health.Close()
+		p.health = nil
+	}
+	if p.metrics != nil {
+		p.metrics.Close()
+		p.metrics = nil
+	}
+}
+
 func (p *Plugin) Open(params string) (source.Instance, error) {
+	params, err := secrets.ExpandEnv(params)
+	if err != nil {
+		return nil, errkind.Count(errkind.New(errkind.Config, err), p.metrics)
+	}
+
 	// Allocate the context struct for this open instance
 	oCtx := &PluginInstance{
 		config:    p.Config,
@@ -116,7 +202,6 @@ func (p *Plugin) Open(params string) (source.Instance, error) {
 	}
 
 	// Perform the open
-	var err error
 	if len(params) >= 5 && params[:5] == "s3://" {
 		err = oCtx.openS3(params)
 	} else if len(params) >= 6 && params[:6] == "sqs://" {
@@ -126,9 +211,14 @@ func (p *Plugin) Open(params string) (source.Instance, error) {
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, errkind.Count(err, p.metrics)
 	}
 
+	// the files and the queue have been listed successfully
+	oCtx.tracker = p.health.Track()
+	oCtx.tracker.SetConnected(true)
+	oCtx.metrics = p.metrics
+	oCtx.deadLetter = p.deadLetter
 	return oCtx, nil
 }
 
@@ -141,26 +231,34 @@ func (o *PluginInstance) NextBatch(pState sdk.PluginState, evts sdk.EventWriters
 			break
 		}
 	}
+	if n > 0 {
+		o.tracker.Event()
+	}
+	if err != nil && err != sdk.ErrTimeout && err != sdk.ErrEOF {
+		o.tracker.Error()
+		o.metrics.UpstreamError()
+		err = errkind.Count(err, o.metrics)
+	}
 	return n, err
 }
 
+func (o *PluginInstance) Close() {
+	o.closeMappedFile()
+	o.closeRecordDecoder()
+	o.tracker.Close()
+}
+
 func (o *PluginInstance) Progress(pState sdk.PluginState) (float64, string) {
 	pd := float64(o.curFileNum) / float64(len(o.files))
 	return pd, fmt.Sprintf("%.2f%% - %v/%v files", pd*100, o.curFileNum, len(o.files))
 }
 
-// todo: optimize this to cache by event number
 func (p *Plugin) String(evt sdk.EventReader) (string, error) {
 	var src string
 	var user string
 	var err error
 
-	data, err := io.ReadAll(evt.Reader())
-	if err != nil {
-		return "", err
-	}
-
-	p.jdata, err = p.jparser.ParseBytes(data)
+	p.jdata, err = p.jcache.Get(evt.EventNum(), evt.Reader())
 	if err != nil {
 		return "", fmt.Errorf("<invalid JSON: %s>" + err.Error())
 	}
@@ -192,12 +290,12 @@ func (p *Plugin) String(evt sdk.EventReader) (string, error) {
 		}
 	}
 
-	present, user := getUser(p.jdata)
+	present, user := getUser(p.jdata, &p.strs)
 	if present && user != "" {
 		user = " " + user
 	}
 
-	info := getEvtInfo(p.jdata)
+	info := getEvtInfo(p.jdata, &p.strs)
 
 	return fmt.Sprintf("%s%s %s %s %s",
 		region,
@@ -213,26 +311,15 @@ func (p *Plugin) Fields() []sdk.FieldEntry {
 }
 
 func (p *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
+	if p.metrics != nil {
+		defer p.metrics.ObserveExtraction(time.Now())
+	}
 	// Decode the json, but only if we haven't done it yet for this event
-	if evt.EventNum() != p.jdataEvtnum {
-		// Read the event data
-		data, err := io.ReadAll(evt.Reader())
-		if err != nil {
-			return err
-		}
-
-		// Maybe temp--remove trailing null bytes from string
-		data = bytes.Trim(data, "\x00")
-
-		// For this plugin, events are always strings
-		evtStr := string(data)
-
-		p.jdata, err = p.jparser.Parse(evtStr)
-		if err != nil {
-			// Not a json file, so not present.
-			return err
-		}
-		p.jdataEvtnum = evt.EventNum()
+	var err error
+	p.jdata, err = p.jcache.Get(evt.EventNum(), evt.Reader())
+	if err != nil {
+		// Not a json file, so not present.
+		return err
 	}
 
 	// Extract the field value
@@ -241,7 +328,7 @@ func (p *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
 	if req.FieldType() == sdk.FieldTypeUint64 {
 		present, value = getfieldU64(p.jdata, req.Field())
 	} else {
-		present, value = getfieldStr(p.jdata, req.Field())
+		present, value = getfieldStr(p.jdata, req.Field(), &p.strs)
 	}
 	if present {
 		req.SetValue(value)
@@ -17,14 +17,26 @@ limitations under the License.
 
 package cloudtrail
 
+import (
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+)
+
 // Struct for plugin init config
 type PluginConfig struct {
 	S3DownloadConcurrency int             `json:"s3DownloadConcurrency" jsonschema:"title=S3 download concurrency,description=Controls the number of background goroutines used to download S3 files (Default: 32),default=32"`
 	S3Interval            string          `json:"s3Interval" jsonschema:"title=S3 log interval,description=Download log files over the specified interval (Default: no interval),default="`
 	SQSDelete             bool            `json:"sqsDelete" jsonschema:"title=Delete SQS messages,description=If true then the plugin will delete SQS messages from the queue immediately after receiving them (Default: true),default=true"`
 	UseAsync              bool            `json:"useAsync" jsonschema:"title=Use async extraction,description=If true then async extraction optimization is enabled (Default: true),default=true"`
-	UseS3SNS              bool            `json:"useS3SNS" jsonschema:"title=Use S3 SNS,description=If true then the plugin will expect SNS messages to originate from S3 instead of directly from Cloudtrail (Default: false),default=false"`
+	UseS3SNS              bool            `json:"useS3SNS" jsonschema:"title=Use S3 SNS,description=Deprecated and ignored since the plugin detects automatically whether the notifications originate from S3 or directly from Cloudtrail (Default: false),default=false"`
 	S3AccountList         string          `json:"s3AccountList" jsonschema:"title=S3 account list,description=A comma separated list of account IDs for organizational Cloudtrails (Default: no account IDs),default="`
+	UseMmap               bool            `json:"useMmap" jsonschema:"title=Use mmap,description=If true then the local files are mapped in memory instead of being read into the heap (Default: false),default=false"`
+	DebugAddress          string          `json:"debugAddress" jsonschema:"title=Debug address,description=Loopback address (e.g. localhost:6060) of an HTTP server exposing the pprof and expvar endpoints of the plugin (Default: empty for disabled),default="`
+	HealthAddress         string          `json:"healthAddress" jsonschema:"title=Health address,description=Address (e.g. :8081) of an HTTP server exposing the health and readiness endpoints of the plugin (Default: empty for disabled),default="`
+	HealthPath            string          `json:"healthPath" jsonschema:"title=Health path,description=Path of the health endpoint. The readiness endpoint is served under <path>/ready (Default: /healthz),default=/healthz"`
+	MetricsAddress        string          `json:"metricsAddress" jsonschema:"title=Metrics address,description=Address (e.g. :9090) of the Prometheus endpoint shared by the plugins of the Falco process configured with the same address (Default: empty for disabled),default="`
+	MetricsPath           string          `json:"metricsPath" jsonschema:"title=Metrics path,description=Path of the Prometheus endpoint (Default: /metrics),default=/metrics"`
+	DeadLetter            string          `json:"deadLetter" jsonschema:"title=Dead-letter sink,description=Sink of the records that can't be parsed: the absolute path of a local file or s3://bucket/prefix or drop (Default: empty for dropped),default="`
 	AWS                   PluginConfigAWS `json:"aws"`
 }
 
@@ -36,5 +48,12 @@ func (p *PluginConfig) Reset() {
 	p.UseAsync = true
 	p.UseS3SNS = false
 	p.S3AccountList = ""
+	p.UseMmap = false
+	p.DebugAddress = ""
+	p.HealthAddress = ""
+	p.HealthPath = health.DefaultPath
+	p.MetricsAddress = ""
+	p.MetricsPath = metrics.DefaultPath
+	p.DeadLetter = ""
 	p.AWS.Reset()
 }
@@ -22,6 +22,7 @@ import (
 	"strings"
 
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugins/shared/go/intern"
 	"github.com/valyala/fastjson"
 )
 
@@ -99,7 +100,7 @@ var supportedFields = []sdk.FieldEntry{
 	{Type: "string", Name: "ecr.imagetag", Display: "Image Tag", Desc: "the tag of the image specified in the request."},
 }
 
-func getUser(jdata *fastjson.Value) (bool, string) {
+func getUser(jdata *fastjson.Value, strs *intern.Pool) (bool, string) {
 	jutype := jdata.GetStringBytes("userIdentity", "type")
 
 	if jutype == nil {
@@ -112,17 +113,17 @@ func getUser(jdata *fastjson.Value) (bool, string) {
 	case "Root", "IAMUser":
 		jun := jdata.GetStringBytes("userIdentity", "userName")
 		if jun != nil {
-			return true, string(jun)
+			return true, strs.Bytes(jun)
 		}
 	case "AWSService":
 		jun := jdata.GetStringBytes("userIdentity", "invokedBy")
 		if jun != nil {
-			return true, string(jun)
+			return true, strs.Bytes(jun)
 		}
 	case "AssumedRole":
 		jun := jdata.GetStringBytes("userIdentity", "sessionContext", "sessionIssuer", "userName")
 		if jun != nil {
-			return true, string(jun)
+			return true, strs.Bytes(jun)
 		}
 		return true, "AssumedRole"
 	case "AWSAccount":
@@ -136,7 +137,7 @@ func getUser(jdata *fastjson.Value) (bool, string) {
 	return false, "<NA>"
 }
 
-func getEvtInfo(jdata *fastjson.Value) string {
+func getEvtInfo(jdata *fastjson.Value, strs *intern.Pool) string {
 	var present bool
 	var evtuser string
 	var evtsrcip string
@@ -148,29 +149,29 @@ func getEvtInfo(jdata *fastjson.Value) string {
 
 	// Start the info field "who" (ct.user), "where" (ct.srcip), and "what" (ct.name)
 	// along with read/write and error status.
-	present, evtuser = getfieldStr(jdata, "ct.user")
+	present, evtuser = getfieldStr(jdata, "ct.user", strs)
 	if !present {
 		return "<invalid cloudtrail event: userIdentity field missing>"
 	}
 
-	present, evtsrcip = getfieldStr(jdata, "ct.srcip")
+	present, evtsrcip = getfieldStr(jdata, "ct.srcip", strs)
 	if !present {
 		return "<invalid cloudtrail event: eventSource field missing>"
 	}
 
 	errsymbol = ""
-	present, _ = getfieldStr(jdata, "ct.error")
+	present, _ = getfieldStr(jdata, "ct.error", strs)
 	if present {
 		errsymbol = "!"
 	}
 
 	rwsymbol = "←"
-	present, evtreadonly = getfieldStr(jdata, "ct.readonly")
+	present, evtreadonly = getfieldStr(jdata, "ct.readonly", strs)
 	if present && evtreadonly == "false" {
 		rwsymbol = "→"
 	}
 
-	present, evtname = getfieldStr(jdata, "ct.name")
+	present, evtname = getfieldStr(jdata, "ct.name", strs)
 	if !present {
 		return "<invalid cloudtrail event: eventName field missing>"
 	}
@@ -201,25 +202,25 @@ func getEvtInfo(jdata *fastjson.Value) string {
 		info += fmt.Sprintf(" Size=%v", u64val)
 	}
 
-	present, val := getfieldStr(jdata, "s3.uri")
+	present, val := getfieldStr(jdata, "s3.uri", strs)
 	if present {
 		info += fmt.Sprintf(" URI=%s", val)
 		return info
 	}
 
-	present, val = getfieldStr(jdata, "s3.bucket")
+	present, val = getfieldStr(jdata, "s3.bucket", strs)
 	if present {
 		info += fmt.Sprintf(" Bucket=%s", val)
 		return info
 	}
 
-	present, val = getfieldStr(jdata, "s3.key")
+	present, val = getfieldStr(jdata, "s3.key", strs)
 	if present {
 		info += fmt.Sprintf(" Key=%s", val)
 		return info
 	}
 
-	present, val = getfieldStr(jdata, "ct.request.host")
+	present, val = getfieldStr(jdata, "ct.request.host", strs)
 	if present {
 		info += fmt.Sprintf(" Host=%s", val)
 		return info
@@ -228,7 +229,9 @@ func getEvtInfo(jdata *fastjson.Value) string {
 	return info
 }
 
-func getfieldStr(jdata *fastjson.Value, field string) (bool, string) {
+// getfieldStr returns the value of a string field. The values that repeat
+// across events, like the event names or the users, are interned in strs.
+func getfieldStr(jdata *fastjson.Value, field string, strs *intern.Pool) (bool, string) {
 	var res string
 
 	// Go should do binary search here:
@@ -246,7 +249,7 @@ func getfieldStr(jdata *fastjson.Value, field string) (bool, string) {
 		if val == nil {
 			return false, ""
 		} else {
-			res = string(val)
+			res = strs.Bytes(val)
 		}
 	case "ct.errormessage":
 		val := jdata.GetStringBytes("errorMessage")
@@ -268,7 +271,7 @@ func getfieldStr(jdata *fastjson.Value, field string) (bool, string) {
 		if val == nil {
 			return false, ""
 		} else {
-			res = string(val)
+			res = strs.Bytes(val)
 		}
 	case "ct.shortsrc":
 		val := jdata.GetStringBytes("eventSource")
@@ -276,7 +279,7 @@ func getfieldStr(jdata *fastjson.Value, field string) (bool, string) {
 		if val == nil {
 			return false, ""
 		} else {
-			res = string(val)
+			res = strs.Bytes(val)
 		}
 
 		if len(res) > len(".amazonaws.com") {
@@ -290,10 +293,10 @@ func getfieldStr(jdata *fastjson.Value, field string) (bool, string) {
 		if val == nil {
 			return false, ""
 		} else {
-			res = string(val)
+			res = strs.Bytes(val)
 		}
 	case "ct.user":
-		present, res := getUser(jdata)
+		present, res := getUser(jdata, strs)
 		if !present {
 			return false, ""
 		}
@@ -301,11 +304,11 @@ func getfieldStr(jdata *fastjson.Value, field string) (bool, string) {
 	case "ct.user.accountid":
 		val := jdata.GetStringBytes("userIdentity", "accountId")
 		if val != nil {
-			res = string(val)
+			res = strs.Bytes(val)
 		} else {
 			val := jdata.GetStringBytes("recipientAccountId")
 			if val != nil {
-				res = string(val)
+				res = strs.Bytes(val)
 			}
 		}
 	case "ct.user.identitytype":
@@ -313,7 +316,7 @@ func getfieldStr(jdata *fastjson.Value, field string) (bool, string) {
 		if val == nil {
 			return false, ""
 		} else {
-			res = string(val)
+			res = strs.Bytes(val)
 		}
 	case "ct.user.principalid":
 		val := jdata.GetStringBytes("userIdentity", "principalId")
@@ -327,14 +330,14 @@ func getfieldStr(jdata *fastjson.Value, field string) (bool, string) {
 		if val == nil {
 			return false, ""
 		} else {
-			res = string(val)
+			res = strs.Bytes(val)
 		}
 	case "ct.region":
 		val := jdata.GetStringBytes("awsRegion")
 		if val == nil {
 			return false, ""
 		} else {
-			res = string(val)
+			res = strs.Bytes(val)
 		}
 	case "ct.response.subnetid":
 		val := jdata.GetStringBytes("responseElements", "subnetId")
@@ -453,17 +456,17 @@ func getfieldStr(jdata *fastjson.Value, field string) (bool, string) {
 		if val == nil {
 			return false, ""
 		} else {
-			res = string(val)
+			res = strs.Bytes(val)
 		}
 	case "ct.useragent":
 		val := jdata.GetStringBytes("userAgent")
 		if val == nil {
 			return false, ""
 		} else {
-			res = string(val)
+			res = strs.Bytes(val)
 		}
 	case "ct.info":
-		res = getEvtInfo(jdata)
+		res = getEvtInfo(jdata, strs)
 	case "ct.managementevent":
 		ro := jdata.GetBool("managementEvent")
 		if ro {
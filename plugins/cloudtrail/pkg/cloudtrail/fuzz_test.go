@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudtrail
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/falcosecurity/plugins/shared/go/aws/s3sqs"
+	"github.com/falcosecurity/plugins/shared/go/fuzz"
+	"github.com/falcosecurity/plugins/shared/go/golden"
+)
+
+func FuzzExtract(f *testing.F) {
+	fuzz.AddDir(f, "testdata/golden", golden.Ext)
+	fuzz.Extract(f, &Plugin{})
+}
+
+// FuzzRecordDecoder fuzzes the decoding of the content of the CloudTrail
+// files, which is gzipped here rather than fuzzed in compressed form
+func FuzzRecordDecoder(f *testing.F) {
+	f.Add([]byte(`{"Records":[{"eventName":"a"},{"eventName":"b"}]}`))
+	f.Add([]byte(`{"Other":{"Records":[]},"Records":[1,"a",null]}`))
+	f.Add([]byte(`{"Records":{}}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write(data)
+		w.Close()
+
+		oCtx := &PluginInstance{}
+		defer oCtx.closeRecordDecoder()
+		if err := oCtx.openRecordDecoder(&buf); err != nil {
+			return
+		}
+		for {
+			if _, err := oCtx.nextRecord(); err != nil {
+				return
+			}
+		}
+	})
+}
+
+func FuzzExtractRecordStrings(f *testing.F) {
+	f.Add([]byte("{\n  \"Records\": [\n    {\"eventName\": \"a\"},\n    {\"eventName\": \"b\"}\n  ]\n}"))
+	f.Add([]byte("}}{{"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var res [][]byte
+		extractRecordStrings(data, &res)
+	})
+}
+
+func FuzzParseSQSMessage(f *testing.F) {
+	f.Add([]byte(`{"Records":[{"s3":{"bucket":{"name":"b"},"object":{"key":"k"}}}]}`))
+	f.Add([]byte(`{"s3Bucket":"b","s3ObjectKey":["k1","k2"]}`))
+	f.Add([]byte(`{"Type":"Notification","Message":"{\"s3Bucket\":\"b\",\"s3ObjectKey\":[\"k\"]}"}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		s3sqs.ParseMessage(data)
+	})
+}
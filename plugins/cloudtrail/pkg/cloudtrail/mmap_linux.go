@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudtrail
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mmapReleaseSize is the amount of consumed data after which the pages of
+// a mapped file are released, so that the resident memory stays bounded
+// while reading very large files
+const mmapReleaseSize = 64 * 1024 * 1024
+
+// mappedFile is a local file mapped in memory in read-only mode
+type mappedFile struct {
+	data     []byte
+	released int
+}
+
+func openMappedFile(name string) (*mappedFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := st.Size()
+	if size == 0 {
+		return &mappedFile{}, nil
+	}
+	if int64(int(size)) != size {
+		return nil, fmt.Errorf(PluginName+" plugin error: file %s is too large to be mapped", name)
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	// the file is scanned once from start to end
+	syscall.Madvise(data, syscall.MADV_SEQUENTIAL)
+	return &mappedFile{data: data}, nil
+}
+
+func (m *mappedFile) Bytes() []byte {
+	return m.data
+}
+
+// release drops the pages mapped before the given offset from memory,
+// once enough data has been consumed since the last release
+func (m *mappedFile) release(offset int) {
+	if offset-m.released < mmapReleaseSize {
+		return
+	}
+	pageSize := os.Getpagesize()
+	end := offset - offset%pageSize
+	if end > m.released {
+		syscall.Madvise(m.data[m.released:end], syscall.MADV_DONTNEED)
+		m.released = end
+	}
+}
+
+func (m *mappedFile) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(m.data)
+	m.data = nil
+	return err
+}
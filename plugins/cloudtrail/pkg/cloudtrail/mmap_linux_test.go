@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudtrail
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMappedFileRelease(t *testing.T) {
+	// a sparse file holding a marker in each page
+	path := filepath.Join(t.TempDir(), "large")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := 3*mmapReleaseSize + 100
+	if err := f.Truncate(int64(size)); err != nil {
+		t.Fatal(err)
+	}
+	pageSize := os.Getpagesize()
+	marker := func(off int) []byte { return []byte(fmt.Sprintf("page %d", off/pageSize)) }
+	for off := 0; off < size; off += 1024 * pageSize {
+		f.WriteAt(marker(off), int64(off))
+	}
+	f.Close()
+
+	m, err := openMappedFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	tests := []struct {
+		offset   int
+		released int
+	}{
+		{mmapReleaseSize - 1, 0},
+		// the pages before the offset are released, the one holding it
+		// is kept
+		{mmapReleaseSize + pageSize + 10, mmapReleaseSize + pageSize},
+		{2*mmapReleaseSize + pageSize - 1, mmapReleaseSize + pageSize},
+		{2*mmapReleaseSize + pageSize, 2*mmapReleaseSize + pageSize},
+		// less than the release size was consumed since the last release
+		{size, 2*mmapReleaseSize + pageSize},
+	}
+	for _, test := range tests {
+		m.release(test.offset)
+		if m.released != test.released {
+			t.Errorf("offset %d: expected %d bytes released, got %d", test.offset, test.released, m.released)
+		}
+	}
+
+	// the released pages are read again from the file if needed
+	for off := 0; off < size; off += 1024 * pageSize {
+		if !bytes.HasPrefix(m.Bytes()[off:], marker(off)) {
+			t.Fatalf("expected the marker of the offset %d", off)
+		}
+	}
+}
+
+// TestNextEventRelease checks that the events read from a mapped file larger
+// than the release size are the same as the ones read in memory, while its
+// pages are released
+func TestNextEventRelease(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the file is larger than the release size")
+	}
+	records := goldenRecords(t)
+	var large [][]byte
+	for size := 0; size < mmapReleaseSize*3/2; {
+		for i, r := range records {
+			// the records are padded to span the pages, and numbered to
+			// be told apart
+			r = bytes.Replace(r, []byte("{"), []byte(fmt.Sprintf(`{"padding":"%s","n":%d,`, strings.Repeat("x", 4096), len(large)+i)), 1)
+			large = append(large, r)
+			size += len(r)
+		}
+	}
+	dir := t.TempDir()
+	plain, gzipped := writeTrail(t, dir, "trail", large)
+	os.Remove(gzipped)
+
+	data, timestamps := readEvents(t, dir, false)
+	if len(data) != len(large) {
+		t.Fatalf("expected %d events, got %d", len(large), len(data))
+	}
+
+	oCtx := &PluginInstance{}
+	oCtx.config.UseMmap = true
+	if err := oCtx.openLocal(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer oCtx.closeMappedFile()
+	evt := &testEvent{}
+	for i := 0; i < len(data); i++ {
+		if err := oCtx.nextEvent(evt); err != nil {
+			t.Fatalf("event %d: %s", i, err.Error())
+		}
+		if evt.data.String() != data[i] || evt.timestamp != timestamps[i] {
+			t.Fatalf("event %d: expected the event read in memory", i)
+		}
+		// the data before the current record is released once it
+		// reaches the release size
+		offset := len(oCtx.mappedFile.Bytes()) - cap(oCtx.evtJSONStrings[i])
+		if oCtx.mappedFile.released > offset || (offset >= mmapReleaseSize+os.Getpagesize() && oCtx.mappedFile.released == 0) {
+			t.Fatalf("event %d at offset %d: unexpected release of %d bytes", i, offset, oCtx.mappedFile.released)
+		}
+	}
+	if oCtx.mappedFile.released == 0 {
+		t.Errorf("expected the pages of %s to be released", plain)
+	}
+}
@@ -0,0 +1,49 @@
+//go:build !linux
+
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudtrail
+
+import (
+	"os"
+)
+
+// mappedFile falls back to reading the whole file in memory on the
+// platforms where mapping is not supported
+type mappedFile struct {
+	data []byte
+}
+
+func openMappedFile(name string) (*mappedFile, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &mappedFile{data: data}, nil
+}
+
+func (m *mappedFile) Bytes() []byte {
+	return m.data
+}
+
+func (m *mappedFile) release(offset int) {}
+
+func (m *mappedFile) Close() error {
+	m.data = nil
+	return nil
+}
@@ -19,12 +19,13 @@ package cloudtrail
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -32,7 +33,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -43,6 +43,12 @@ import (
 
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/aws/s3sqs"
+	"github.com/falcosecurity/plugins/shared/go/compress"
+	"github.com/falcosecurity/plugins/shared/go/dlq"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
 )
 
 type OpenMode int
@@ -61,6 +67,7 @@ type listOrigin struct {
 
 type fileInfo struct {
 	name         string
+	bucket       string // the S3 bucket of the file, if not local
 	isCompressed bool
 }
 
@@ -76,11 +83,6 @@ type s3State struct {
 	curBuf                int
 }
 
-type snsMessage struct {
-	Bucket string   `json:"s3Bucket"`
-	Keys   []string `json:"s3ObjectKey"`
-}
-
 // This is the open state, identifying an open instance reading cloudtrail files from
 // a local directory or from a remote S3 bucket (either direct or via a SQS queue)
 type PluginInstance struct {
@@ -93,10 +95,17 @@ type PluginInstance struct {
 	curFileNum         uint32
 	evtJSONStrings     [][]byte
 	evtJSONListPos     int
+	gzReader           *compress.Reader
+	recordDec          *json.Decoder
+	recordBuf          json.RawMessage
+	mappedFile         *mappedFile
 	s3                 s3State
 	sqsClient          *sqs.Client
 	queueURL           string
 	nextJParser        fastjson.Parser
+	tracker            *health.Tracker
+	metrics            *metrics.Metrics
+	deadLetter         dlq.Sink
 }
 
 var dlErrChan chan error
@@ -119,11 +128,11 @@ func (oCtx *PluginInstance) openLocal(params string) error {
 	oCtx.cloudTrailFilesDir = params
 
 	if len(oCtx.cloudTrailFilesDir) == 0 {
-		return fmt.Errorf(PluginName + " plugin error: missing input directory argument")
+		return errkind.Errorf(errkind.Config, PluginName + " plugin error: missing input directory argument")
 	}
 
 	if !dirExists(oCtx.cloudTrailFilesDir) {
-		return fmt.Errorf(PluginName+" plugin error: cannot open %s", oCtx.cloudTrailFilesDir)
+		return errkind.Errorf(errkind.Config, PluginName+" plugin error: cannot open %s", oCtx.cloudTrailFilesDir)
 	}
 
 	err := filepath.Walk(oCtx.cloudTrailFilesDir, func(path string, info os.FileInfo, err error) error {
@@ -144,7 +153,7 @@ func (oCtx *PluginInstance) openLocal(params string) error {
 		return err
 	}
 	if len(oCtx.files) == 0 {
-		return fmt.Errorf(PluginName + " plugin error: no json files found in " + oCtx.cloudTrailFilesDir)
+		return errkind.Errorf(errkind.Config, PluginName + " plugin error: no json files found in " + oCtx.cloudTrailFilesDir)
 	}
 
 	return nil
@@ -218,7 +227,7 @@ func (oCtx *PluginInstance) listKeys(params listOrigin, startTS string, endTS st
 				continue
 			}
 
-			var fi fileInfo = fileInfo{name: *path, isCompressed: isCompressed}
+			var fi fileInfo = fileInfo{name: *path, bucket: oCtx.s3.bucket, isCompressed: isCompressed}
 			oCtx.files = append(oCtx.files, fi)
 		}
 	}
@@ -229,7 +238,7 @@ func (oCtx *PluginInstance) openS3(input string) error {
 	oCtx.openMode = s3Mode
 
 	if oCtx.config.S3DownloadConcurrency < 1 {
-		return fmt.Errorf(PluginName + " invalid S3DownloadConcurrency: \"%d\"", oCtx.config.S3DownloadConcurrency)
+		return errkind.Errorf(errkind.Config, PluginName + " invalid S3DownloadConcurrency: \"%d\"", oCtx.config.S3DownloadConcurrency)
 	}
 
 	// remove the initial "s3://"
@@ -257,14 +266,14 @@ func (oCtx *PluginInstance) openS3(input string) error {
 
 	startTime, endTime, err := ParseInterval(oCtx.config.S3Interval)
 	if err != nil {
-		return fmt.Errorf(PluginName + " invalid interval: \"%s\": %s", oCtx.config.S3Interval, err.Error())
+		return errkind.Errorf(errkind.Config, PluginName + " invalid interval: \"%s\": %s", oCtx.config.S3Interval, err.Error())
 
 	}
 
 	s3AccountList := oCtx.config.S3AccountList
 	accountListRE := regexp.MustCompile(`^(?: *\d{12} *,?)*$`)
 	if (! accountListRE.MatchString(s3AccountList)) {
-		return fmt.Errorf(PluginName + " invalid account list: \"%s\"", oCtx.config.S3AccountList)
+		return errkind.Errorf(errkind.Config, PluginName + " invalid account list: \"%s\"", oCtx.config.S3AccountList)
 }
 
 	// CloudTrail logs have the format
@@ -294,7 +303,7 @@ func (oCtx *PluginInstance) openS3(input string) error {
 			// build intervalPrefixList by using the provided S3AccountList
 			accountListArray := strings.Split(s3AccountList , ",")
 			if len(accountListArray) <= 0 {
-				return fmt.Errorf(PluginName + " invalid account list: \"%s\"", oCtx.config.S3AccountList)
+				return errkind.Errorf(errkind.Config, PluginName + " invalid account list: \"%s\"", oCtx.config.S3AccountList)
 			}
 			for i := range accountListArray {
 				accountListArray[i] = strings.TrimSpace(accountListArray[i])
@@ -316,15 +325,15 @@ func (oCtx *PluginInstance) openS3(input string) error {
 					// Try friendlier error sources first.
 					var aErr smithy.APIError
 					if errors.As(err, &aErr) {
-						return fmt.Errorf(PluginName + " plugin error: %s: %s", aErr.ErrorCode(), aErr.ErrorMessage())
+						return errkind.Errorf(awsErrorKind(err), PluginName + " plugin error: %s: %s", aErr.ErrorCode(), aErr.ErrorMessage())
 					}
 
 					var oErr *smithy.OperationError
 					if errors.As(err, &oErr) {
-						return fmt.Errorf(PluginName + " plugin error: %s: %s", oErr.Service(), oErr.Unwrap())
+						return errkind.Errorf(awsErrorKind(err), PluginName + " plugin error: %s: %s", oErr.Service(), oErr.Unwrap())
 					}
 
-					return fmt.Errorf(PluginName + " plugin error: failed to list accounts: " + err.Error())
+					return errkind.Errorf(awsErrorKind(err), PluginName + " plugin error: failed to list accounts: " + err.Error())
 				}
 				for _, commonPrefix := range page.CommonPrefixes {
 					path := commonPrefix.Prefix
@@ -372,7 +381,7 @@ func (oCtx *PluginInstance) openS3(input string) error {
 			if !endTime.IsZero() {
 				endTS = endTime.Format(startAfterFormat)
 				if endTS < startTS {
-					return fmt.Errorf(PluginName + " start time %s must be less than end time %s", startTime.Format(RFC3339Simple), endTime.Format(RFC3339Simple))
+					return errkind.Errorf(errkind.Config, PluginName + " start time %s must be less than end time %s", startTime.Format(RFC3339Simple), endTime.Format(RFC3339Simple))
 				}
 			}
 		}
@@ -398,15 +407,15 @@ func (oCtx *PluginInstance) openS3(input string) error {
 				// Try friendlier error sources first.
 				var aErr smithy.APIError
 				if errors.As(err, &aErr) {
-					return fmt.Errorf(PluginName + " plugin error: %s: %s", aErr.ErrorCode(), aErr.ErrorMessage())
+					return errkind.Errorf(awsErrorKind(err), PluginName + " plugin error: %s: %s", aErr.ErrorCode(), aErr.ErrorMessage())
 				}
 
 				var oErr *smithy.OperationError
 				if errors.As(err, &oErr) {
-					return fmt.Errorf(PluginName + " plugin error: %s: %s", oErr.Service(), oErr.Unwrap())
+					return errkind.Errorf(awsErrorKind(err), PluginName + " plugin error: %s: %s", oErr.Service(), oErr.Unwrap())
 				}
 
-				return fmt.Errorf(PluginName + " plugin error: failed to list objects: " + err.Error())
+				return errkind.Errorf(awsErrorKind(err), PluginName + " plugin error: failed to list objects: " + err.Error())
 			}
 		default:
 		}
@@ -429,7 +438,7 @@ func (oCtx *PluginInstance) getMoreSQSFiles() error {
 	msgResult, err := oCtx.sqsClient.ReceiveMessage(ctx, input)
 
 	if err != nil {
-		return err
+		return errkind.New(awsErrorKind(err), err)
 	}
 
 	if len(msgResult.Messages) == 0 {
@@ -446,91 +455,28 @@ func (oCtx *PluginInstance) getMoreSQSFiles() error {
 		_, err = oCtx.sqsClient.DeleteMessage(ctx, delInput)
 
 		if err != nil {
-			return err
+			return errkind.New(awsErrorKind(err), err)
 		}
 	}
 
-	// The SQS message is just a SNS notification noting that new
-	// cloudtrail file(s) are available in the s3 bucket. Download
-	// those files.
-
-	var sqsMsg map[string]interface{}
-
-	err = json.Unmarshal([]byte(*msgResult.Messages[0].Body), &sqsMsg)
+	// The SQS message is a notification noting that new cloudtrail
+	// file(s) are available in one or more s3 buckets. Download those files.
+	objects, err := s3sqs.ParseMessage([]byte(*msgResult.Messages[0].Body))
 
 	if err != nil {
-		return err
+		return errkind.New(errkind.Parse, err)
 	}
 
-	messageType, ok := sqsMsg["Type"]
-	if !ok {
-		return fmt.Errorf("received SQS message that did not have a Type property")
-	}
-
-	if messageType.(string) != "Notification" {
-		return fmt.Errorf("received SQS message that was not a SNS Notification")
-	}
-
-	if oCtx.config.UseS3SNS {
-		// Process SNS message coming from S3
-		var (
-			s3Event    events.S3Event
-			s3Init     bool
-			lastBucket string
-		)
-
-		err = json.Unmarshal([]byte(sqsMsg["Message"].(string)), &s3Event)
-
-		if err != nil {
+	for _, obj := range objects {
+		// initS3 only creates the client once
+		if err := oCtx.initS3(); err != nil {
 			return err
 		}
 
-		for _, record := range s3Event.Records {
-
-			// init s3 and set bucket changes
-			if !s3Init || record.S3.Bucket.Name != lastBucket {
-				oCtx.s3.bucket = record.S3.Bucket.Name
-
-				// only init s3 once
-				if !s3Init {
-					if err := oCtx.initS3(); err != nil {
-						return err
-					}
-					s3Init = true
-				}
-			}
-
-			isCompressed := strings.HasSuffix(record.S3.Object.Key, ".json.gz")
-
-			oCtx.files = append(oCtx.files, fileInfo{name: record.S3.Object.Key, isCompressed: isCompressed})
-
-			lastBucket = record.S3.Bucket.Name
-		}
+		isCompressed := strings.HasSuffix(obj.Key, ".json.gz")
 
-		return nil
-	}
-
-	var notification snsMessage
-
-	err = json.Unmarshal([]byte(sqsMsg["Message"].(string)), &notification)
-
-	if err != nil {
-		return err
-	}
-
-	// The notification contains a bucket and a list of keys that
-	// contain new cloudtrail files.
-	oCtx.s3.bucket = notification.Bucket
-
-	if err := oCtx.initS3(); err != nil {
-		return err
-	}
-
-	for _, key := range notification.Keys {
-
-		isCompressed := strings.HasSuffix(key, ".json.gz")
-
-		oCtx.files = append(oCtx.files, fileInfo{name: key, isCompressed: isCompressed})
+		// the objects can be in different buckets, so each file keeps its own
+		oCtx.files = append(oCtx.files, fileInfo{name: obj.Key, bucket: obj.Bucket, isCompressed: isCompressed})
 	}
 
 	return nil
@@ -556,15 +502,15 @@ func (oCtx *PluginInstance) openSQS(input string) error {
 	return oCtx.getMoreSQSFiles()
 }
 
-func (oCtx *PluginInstance) s3Download(downloader *manager.Downloader, name string, dloadSlotNum int) {
+func (oCtx *PluginInstance) s3Download(downloader *manager.Downloader, file fileInfo, dloadSlotNum int) {
 	defer oCtx.s3.DownloadWg.Done()
 
 	ctx := context.Background()
 	buff := manager.NewWriteAtBuffer(nil)
 	_, err := downloader.Download(ctx, buff,
 		&s3.GetObjectInput{
-			Bucket: &oCtx.s3.bucket,
-			Key:    &name,
+			Bucket: &file.bucket,
+			Key:    &file.name,
 		})
 	if err != nil {
 		dlErrChan <- err
@@ -586,7 +532,7 @@ func (oCtx *PluginInstance) readNextFileS3() ([]byte, error) {
 	oCtx.s3.nFilledBufs = min(oCtx.config.S3DownloadConcurrency, len(oCtx.files)-k)
 	for j, f := range oCtx.files[k : k+oCtx.s3.nFilledBufs] {
 		oCtx.s3.DownloadWg.Add(1)
-		go oCtx.s3Download(oCtx.s3.downloader, f.name, j)
+		go oCtx.s3Download(oCtx.s3.downloader, f, j)
 	}
 	oCtx.s3.DownloadWg.Wait()
 
@@ -606,6 +552,74 @@ func readFileLocal(fileName string) ([]byte, error) {
 	return ioutil.ReadFile(fileName)
 }
 
+// closeMappedFile unmaps the local file being read, if any
+func (oCtx *PluginInstance) closeMappedFile() {
+	if oCtx.mappedFile != nil {
+		oCtx.mappedFile.Close()
+		oCtx.mappedFile = nil
+	}
+}
+
+// openRecordDecoder starts decoding the records of a compressed file, and
+// moves the decoder right into the "Records" array. The compression format
+// is detected from the content rather than the file name.
+func (oCtx *PluginInstance) openRecordDecoder(r io.Reader) error {
+	var err error
+	oCtx.gzReader, err = compress.NewReader(r, nil)
+	if err != nil {
+		return err
+	}
+	oCtx.recordDec = json.NewDecoder(oCtx.gzReader)
+
+	if tok, err := oCtx.recordDec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf(PluginName + " plugin error: unexpected file format")
+	}
+	for oCtx.recordDec.More() {
+		key, err := oCtx.recordDec.Token()
+		if err != nil {
+			return err
+		}
+		if key == "Records" {
+			if tok, err := oCtx.recordDec.Token(); err != nil {
+				return err
+			} else if tok != json.Delim('[') {
+				return fmt.Errorf(PluginName + " plugin error: unexpected file format")
+			}
+			return nil
+		}
+		// skip the value of any other key
+		var skip json.RawMessage
+		if err := oCtx.recordDec.Decode(&skip); err != nil {
+			return err
+		}
+	}
+	return io.EOF
+}
+
+// nextRecord returns the next record of the gzipped file being decoded,
+// or io.EOF once all of them have been read. The returned data is only
+// valid until the next call.
+func (oCtx *PluginInstance) nextRecord() ([]byte, error) {
+	if !oCtx.recordDec.More() {
+		return nil, io.EOF
+	}
+	if err := oCtx.recordDec.Decode(&oCtx.recordBuf); err != nil {
+		return nil, err
+	}
+	return oCtx.recordBuf, nil
+}
+
+// closeRecordDecoder stops decoding the records of the gzipped file, if any
+func (oCtx *PluginInstance) closeRecordDecoder() {
+	if oCtx.gzReader != nil {
+		oCtx.gzReader.Close()
+		oCtx.gzReader = nil
+	}
+	oCtx.recordDec = nil
+}
+
 func extractRecordStrings(jsonStr []byte, res *[][]byte) {
 	indentation := 0
 	var entryStart int
@@ -628,6 +642,23 @@ func extractRecordStrings(jsonStr []byte, res *[][]byte) {
 	}
 }
 
+// writeDeadLetter routes a record of the current file that can't be parsed
+// to the dead-letter sink of the plugin, if any
+func (oCtx *PluginInstance) writeDeadLetter(data []byte, reason string) {
+	if oCtx.deadLetter == nil {
+		return
+	}
+	file := oCtx.files[oCtx.curFileNum-1]
+	src := file.name
+	if oCtx.openMode != fileMode {
+		src = "s3://" + file.bucket + "/" + src
+	}
+	err := oCtx.deadLetter.Write(dlq.Record{Source: src, Reason: reason, Data: data})
+	if err != nil {
+		log.Printf("[%s] can't write dead letter: %s\n", PluginName, err.Error())
+	}
+}
+
 // nextEvent is the core event production function.
 func (oCtx *PluginInstance) nextEvent(evt sdk.EventWriter) error {
 	var evtData []byte
@@ -635,7 +666,7 @@ func (oCtx *PluginInstance) nextEvent(evt sdk.EventWriter) error {
 	var err error
 
 	// Only open the next file once we're sure that the content of the previous one has been full consumed
-	if oCtx.evtJSONListPos >= len(oCtx.evtJSONStrings) {
+	if oCtx.evtJSONListPos >= len(oCtx.evtJSONStrings) && oCtx.recordDec == nil {
 		// Open the next file and bring its content into memeory
 		if oCtx.curFileNum >= uint32(len(oCtx.files)) {
 
@@ -660,58 +691,87 @@ func (oCtx *PluginInstance) nextEvent(evt sdk.EventWriter) error {
 		file := oCtx.files[oCtx.curFileNum]
 		oCtx.curFileNum++
 
+		// The records of the previous file have all been consumed
+		oCtx.closeMappedFile()
+
 		switch oCtx.openMode {
 		case s3Mode, sqsMode:
 			tmpStr, err = oCtx.readNextFileS3()
 		case fileMode:
-			tmpStr, err = readFileLocal(file.name)
+			if oCtx.config.UseMmap {
+				oCtx.mappedFile, err = openMappedFile(file.name)
+				if err == nil {
+					tmpStr = oCtx.mappedFile.Bytes()
+				}
+			} else {
+				tmpStr, err = readFileLocal(file.name)
+			}
 		}
 		if err != nil {
 			return err
 		}
 
-		// The file can be gzipped. If it is, we unzip it.
+		oCtx.evtJSONStrings = nil
+		oCtx.evtJSONListPos = 0
+
+		// The file can be gzipped. If it is, the records are decoded
+		// while it's being unzipped, so that the whole decompressed
+		// content, which can be very large, is never kept in memory.
 		if file.isCompressed {
-			gr, err := gzip.NewReader(bytes.NewBuffer(tmpStr))
-			if err != nil {
-				return sdk.ErrTimeout
-			}
-			defer gr.Close()
-			zdata, err := ioutil.ReadAll(gr)
+			err = oCtx.openRecordDecoder(bytes.NewReader(tmpStr))
 			if err != nil {
+				oCtx.closeRecordDecoder()
 				return sdk.ErrTimeout
 			}
-			tmpStr = zdata
+		} else {
+			// Cloudtrail files have the following format:
+			// {"Records":[
+			//	{<evt1>},
+			//	{<evt2>},
+			//	...
+			// ]}
+			// Here, we split the file content into substrings, one per event.
+			// We do this instead of unmarshaling the whole file because this allows
+			// us to pass the original json of each event to the engine without an
+			// additional marshaling, making things much faster.
+			extractRecordStrings(tmpStr, &(oCtx.evtJSONStrings))
 		}
-
-		// Cloudtrail files have the following format:
-		// {"Records":[
-		//	{<evt1>},
-		//	{<evt2>},
-		//	...
-		// ]}
-		// Here, we split the file content into substrings, one per event.
-		// We do this instead of unmarshaling the whole file because this allows
-		// us to pass the original json of each event to the engine without an
-		// additional marshaling, making things much faster.
-		oCtx.evtJSONStrings = nil
-		extractRecordStrings(tmpStr, &(oCtx.evtJSONStrings))
-
-		oCtx.evtJSONListPos = 0
 	}
 
 	// Extract the next record
 	var cr *fastjson.Value
-	if len(oCtx.evtJSONStrings) != 0 {
+	if oCtx.recordDec != nil {
+		evtData, err = oCtx.nextRecord()
+		if err != nil {
+			// The end of the file, or json not in the expected
+			// format. Either way, we're done with this file.
+			oCtx.closeRecordDecoder()
+			return sdk.ErrTimeout
+		}
+		cr, err = oCtx.nextJParser.ParseBytes(evtData)
+		if err != nil {
+			// Not json? Just skip this event.
+			oCtx.writeDeadLetter(evtData, err.Error())
+			return sdk.ErrTimeout
+		}
+	} else if len(oCtx.evtJSONStrings) != 0 {
 		evtData = oCtx.evtJSONStrings[oCtx.evtJSONListPos]
-		cr, err = oCtx.nextJParser.Parse(string(evtData))
+		cr, err = oCtx.nextJParser.ParseBytes(evtData)
 		if err != nil {
 			// Not json? Just skip this event.
 			oCtx.evtJSONListPos++
+			oCtx.writeDeadLetter(evtData, err.Error())
 			return sdk.ErrTimeout
 		}
 
 		oCtx.evtJSONListPos++
+
+		// The records are slices of the mapped file, so the capacity
+		// of the current one gives its offset in the file. The data
+		// before it has been consumed and can be released.
+		if oCtx.mappedFile != nil {
+			oCtx.mappedFile.release(len(oCtx.mappedFile.Bytes()) - cap(evtData))
+		}
 	} else {
 		// Json not int the expected format. Just skip this event.
 		return sdk.ErrTimeout
@@ -722,6 +782,7 @@ func (oCtx *PluginInstance) nextEvent(evt sdk.EventWriter) error {
 	timeVal := cr.GetStringBytes("eventTime")
 
 	if timeVal == nil {
+		oCtx.writeDeadLetter(evtData, "missing eventTime")
 		return sdk.ErrTimeout
 	}
 
@@ -733,6 +794,7 @@ func (oCtx *PluginInstance) nextEvent(evt sdk.EventWriter) error {
 		//
 		// We assume this is just some spurious data and we continue
 		//
+		oCtx.writeDeadLetter(evtData, err.Error())
 		return sdk.ErrTimeout
 	}
 	evt.SetTimestamp(uint64(t1.UnixNano()))
@@ -743,6 +805,7 @@ func (oCtx *PluginInstance) nextEvent(evt sdk.EventWriter) error {
 	typeVal := cr.GetStringBytes("eventType")
 
 	if typeVal == nil {
+		oCtx.writeDeadLetter(evtData, "missing eventType")
 		return sdk.ErrTimeout
 	}
 
@@ -758,6 +821,7 @@ func (oCtx *PluginInstance) nextEvent(evt sdk.EventWriter) error {
 	} else if n < len(evtData) {
 		return fmt.Errorf("cloudwatch message too long: %d, but %d were written", len(evtData), n)
 	}
+	oCtx.metrics.Ingested(n, t1)
 
 	return nil
 }
@@ -0,0 +1,276 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudtrail
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+)
+
+// testEvent is an event written by nextEvent
+type testEvent struct {
+	data      bytes.Buffer
+	timestamp uint64
+}
+
+func (e *testEvent) Writer() io.Writer {
+	e.data.Reset()
+	return &e.data
+}
+
+func (e *testEvent) SetTimestamp(value uint64) {
+	e.timestamp = value
+}
+
+// goldenRecords returns the records of the golden corpus, as indented in
+// their files
+func goldenRecords(t *testing.T) [][]byte {
+	files, err := filepath.Glob("testdata/golden/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res [][]byte
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, bytes.TrimSpace(data))
+	}
+	if len(res) == 0 {
+		t.Fatal("expected the records of the golden corpus")
+	}
+	return res
+}
+
+// writeTrail writes a CloudTrail file holding the records in dir, along
+// with its gzipped version
+func writeTrail(t *testing.T, dir, name string, records [][]byte) (plain, gzipped string) {
+	var b bytes.Buffer
+	b.WriteString("{\"Records\": [\n")
+	for i, r := range records {
+		if i > 0 {
+			b.WriteString(",\n")
+		}
+		b.Write(r)
+	}
+	b.WriteString("\n]}\n")
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(b.Bytes())
+	w.Close()
+
+	plain, gzipped = filepath.Join(dir, name+".json"), filepath.Join(dir, "gz", name+".json.gz")
+	if err := os.MkdirAll(filepath.Dir(gzipped), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(plain, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(gzipped, gz.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return plain, gzipped
+}
+
+// decodeRecords returns the records decoded from a gzipped file
+func decodeRecords(t *testing.T, path string) [][]byte {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	oCtx := &PluginInstance{}
+	defer oCtx.closeRecordDecoder()
+	if err := oCtx.openRecordDecoder(f); err != nil {
+		t.Fatal(err)
+	}
+	var res [][]byte
+	for {
+		r, err := oCtx.nextRecord()
+		if err == io.EOF {
+			return res
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, append([]byte{}, r...))
+	}
+}
+
+// readEvents returns the data and timestamps of the events read from the
+// files of dir
+func readEvents(t *testing.T, dir string, useMmap bool) (data []string, timestamps []uint64) {
+	oCtx := &PluginInstance{}
+	oCtx.config.UseMmap = useMmap
+	if err := oCtx.openLocal(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer oCtx.closeMappedFile()
+	defer oCtx.closeRecordDecoder()
+	evt := &testEvent{}
+	for {
+		err := oCtx.nextEvent(evt)
+		if err == sdk.ErrEOF {
+			return
+		}
+		if err == sdk.ErrTimeout {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, evt.data.String())
+		timestamps = append(timestamps, evt.timestamp)
+	}
+}
+
+func equalRecords(a, b [][]byte) error {
+	if len(a) != len(b) {
+		return fmt.Errorf("expected %d records, got %d", len(a), len(b))
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return fmt.Errorf("record %d: expected %s, got %s", i, a[i], b[i])
+		}
+	}
+	return nil
+}
+
+func TestRecordsEquivalence(t *testing.T) {
+	records := goldenRecords(t)
+	plain, gzipped := writeTrail(t, t.TempDir(), "trail", records)
+
+	// the records are split from the file read in memory
+	data, err := readFileLocal(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var split [][]byte
+	extractRecordStrings(data, &split)
+	if err := equalRecords(records, split); err != nil {
+		t.Errorf("read file: %s", err.Error())
+	}
+
+	// the same records are split from the mapped file
+	m, err := openMappedFile(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if !bytes.Equal(m.Bytes(), data) {
+		t.Error("expected the mapped file to hold the content of the file")
+	}
+	var mapped [][]byte
+	extractRecordStrings(m.Bytes(), &mapped)
+	if err := equalRecords(records, mapped); err != nil {
+		t.Errorf("mapped file: %s", err.Error())
+	}
+
+	// the same records are decoded from the gzipped file
+	if err := equalRecords(records, decodeRecords(t, gzipped)); err != nil {
+		t.Errorf("gzipped file: %s", err.Error())
+	}
+}
+
+func TestNextEventEquivalence(t *testing.T) {
+	dir := t.TempDir()
+	records := goldenRecords(t)
+	writeTrail(t, dir, "trail", records)
+
+	// the events are the same whether the files are read, mapped or
+	// decompressed
+	data, timestamps := readEvents(t, dir, false)
+	if len(data) != 2*len(records) {
+		t.Fatalf("expected %d events, got %d", 2*len(records), len(data))
+	}
+	mapped, mappedTimestamps := readEvents(t, dir, true)
+	if strings.Join(data, "\n") != strings.Join(mapped, "\n") || fmt.Sprint(timestamps) != fmt.Sprint(mappedTimestamps) {
+		t.Error("expected the same events with the mapped files")
+	}
+
+	// the plain file is walked first, and its events are the same as the
+	// ones of the gzipped file
+	n := len(records)
+	if strings.Join(data[:n], "\n") != strings.Join(data[n:], "\n") || fmt.Sprint(timestamps[:n]) != fmt.Sprint(timestamps[n:]) {
+		t.Error("expected the same events from the plain and the gzipped files")
+	}
+	for i, r := range records {
+		if data[i] != string(r) {
+			t.Errorf("event %d: expected %s, got %s", i, r, data[i])
+		}
+	}
+}
+
+func TestRecordDecoderFormat(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected []string
+		err      bool
+	}{
+		{`{"Records":[{"a":1},{"b":"}"}]}`, []string{`{"a":1}`, `{"b":"}"}`}, false},
+		// the other keys are skipped
+		{`{"Other":{"Records":[{"c":1}]},"Records":[{"a":1}]}`, []string{`{"a":1}`}, false},
+		{`{"Records":[]}`, nil, false},
+		{`{"Other":1}`, nil, true},
+		{`{"Records":{}}`, nil, true},
+		{`[]`, nil, true},
+	}
+	for _, test := range tests {
+		var gz bytes.Buffer
+		w := gzip.NewWriter(&gz)
+		w.Write([]byte(test.content))
+		w.Close()
+
+		oCtx := &PluginInstance{}
+		err := oCtx.openRecordDecoder(&gz)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.content)
+			}
+			oCtx.closeRecordDecoder()
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.content, err.Error())
+			continue
+		}
+		var records []string
+		for {
+			r, err := oCtx.nextRecord()
+			if err != nil {
+				break
+			}
+			records = append(records, string(r))
+		}
+		oCtx.closeRecordDecoder()
+		if strings.Join(records, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("%s: expected %v, got %v", test.content, test.expected, records)
+		}
+	}
+}
@@ -5,5 +5,15 @@ go 1.15
 require (
 	github.com/alecthomas/jsonschema v0.0.0-20220216202328-9eeeec9d044b
 	github.com/falcosecurity/plugin-sdk-go v0.7.4
+	github.com/falcosecurity/plugins/shared/go/conformance v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/eventencoder v0.0.0-00010101000000-000000000000
 	github.com/iancoleman/orderedmap v0.3.0 // indirect
 )
+
+replace github.com/falcosecurity/plugins/shared/go/eventencoder => ../../shared/go/eventencoder
+
+replace github.com/falcosecurity/plugins/shared/go/proto => ../../shared/go/proto
+
+replace github.com/falcosecurity/plugins/shared/go/conformance => ../../shared/go/conformance
+
+replace github.com/falcosecurity/plugins/shared/go/mux => ../../shared/go/mux
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dummy
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+)
+
+// benchmarkInstance is an instance filling every slot of each batch with the
+// same fixed-size payload, without randomization, pacing nor logging, to
+// measure the upper bound of the throughput of the plugin framework
+type benchmarkInstance struct {
+	source.BaseInstance
+	payload   []byte
+	remaining uint64
+	maxEvents uint64
+}
+
+// newBenchmarkInstance returns an instance returning maxEvents events whose
+// payload is the sample 1 zero-padded to the given size, so that the fields
+// can still be extracted
+func newBenchmarkInstance(size int, maxEvents uint64) *benchmarkInstance {
+	if size < 1 {
+		size = 1
+	}
+	payload := append(bytes.Repeat([]byte{'0'}, size-1), '1')
+	return &benchmarkInstance{payload: payload, remaining: maxEvents, maxEvents: maxEvents}
+}
+
+func (b *benchmarkInstance) NextBatch(pState sdk.PluginState, evts sdk.EventWriters) (int, error) {
+	if b.remaining == 0 {
+		return 0, sdk.ErrEOF
+	}
+	n := evts.Len()
+	if uint64(n) > b.remaining {
+		n = int(b.remaining)
+	}
+
+	// the events of a batch share the same timestamp
+	ts := uint64(time.Now().UnixNano())
+	for i := 0; i < n; i++ {
+		evt := evts.Get(i)
+		if _, err := evt.Writer().Write(b.payload); err != nil {
+			return i, err
+		}
+		evt.SetTimestamp(ts)
+	}
+	b.remaining -= uint64(n)
+	return n, nil
+}
+
+func (b *benchmarkInstance) Progress(pState sdk.PluginState) (float64, string) {
+	return progress(b.maxEvents-b.remaining, b.maxEvents)
+}
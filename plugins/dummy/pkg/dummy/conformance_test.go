@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dummy
+
+import (
+	"testing"
+
+	"github.com/falcosecurity/plugins/shared/go/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func() conformance.Plugin { return &Plugin{} }, conformance.Options{
+		BadOpenParams: []string{"{", `{"ratePerSecond":-1}`, `{"file":"/nonexistent/samples"}`},
+	})
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dummy
+
+import (
+	"math"
+	"math/rand"
+)
+
+// distribution draws the random jitter added to a sample, between 0 and
+// the configured jitter for the bounded distributions
+type distribution func(r *rand.Rand, jitter uint64) uint64
+
+// zipfExponent is the exponent of the Zipf distribution, which must be
+// greater than 1
+const zipfExponent = 1.5
+
+var distributions = map[string]distribution{
+	// uniform in [0:jitter]
+	"uniform": func(r *rand.Rand, jitter uint64) uint64 {
+		return uint64(r.Int63n(int64(jitter + 1)))
+	},
+	// normal with a mean of jitter/2 and a standard deviation of jitter/6,
+	// bounded to [0:jitter]
+	"gaussian": func(r *rand.Rand, jitter uint64) uint64 {
+		v := math.Round(r.NormFloat64()*float64(jitter)/6 + float64(jitter)/2)
+		return uint64(math.Max(0, math.Min(float64(jitter), v)))
+	},
+	// Zipf in [0:jitter], where small values are the most frequent
+	"zipf": func(r *rand.Rand, jitter uint64) uint64 {
+		if jitter == 0 {
+			return 0
+		}
+		return rand.NewZipf(r, zipfExponent, 1, jitter).Uint64()
+	},
+	// exponential with a mean of jitter/2, like the uniform one, but
+	// unbounded so that large values are drawn from time to time
+	"exponential": func(r *rand.Rand, jitter uint64) uint64 {
+		return uint64(math.Round(r.ExpFloat64() * float64(jitter) / 2))
+	},
+}
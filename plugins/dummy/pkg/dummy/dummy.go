@@ -21,15 +21,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
 	"math/rand"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/alecthomas/jsonschema"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/symbols/extract"
 )
 
 const (
@@ -41,21 +46,75 @@ const (
 	PluginEventSource        = "dummy"
 )
 
+// rateMaxWait is the longest an instance with a rate or a duty cycle waits
+// for its next event before returning the events of the batch
+const rateMaxWait = 30 * time.Millisecond
+
 type PluginConfig struct {
 	// This reflects potential internal state for the plugin. In
 	// this case, the plugin is configured with a jitter.
 	Jitter uint64 `json:"jitter" jsonschema:"title=Sample jitter,description=A random amount added to the sample of each event (Default: 10),default=10"`
+	// The shape of the random amounts added to the samples.
+	Distribution string `json:"distribution" jsonschema:"title=Jitter distribution,description=Distribution of the random amounts added to the samples: uniform or gaussian or zipf or exponential (Default: uniform),enum=uniform,enum=gaussian,enum=zipf,enum=exponential,default=uniform"`
+	// The jitters are drawn from a fixed seed if set, so that the
+	// stream of events can be reproduced.
+	Seed int64 `json:"seed" jsonschema:"title=Random seed,description=Seed of the random jitters for reproducible streams of events (Default: 0 for a seed based on the current time),default=0"`
+	// The events are bare samples unless a payload template is set.
+	PayloadTemplate string `json:"payloadTemplate" jsonschema:"title=Payload template,description=Go text/template rendering the JSON payload of each event from its .Sample and .Counter and .Delta and .Timestamp (Default: empty for the bare sample),default="`
+	// The samples are ASCII strings unless another encoding is set, to
+	// test the handling of the non-text payloads.
+	Encoding string `json:"encoding" jsonschema:"title=Sample encoding,description=Encoding of the samples in the payload of the events: text or binary (8 little-endian bytes) or blob (binary followed by random bytes) or msgpack or protobuf (records of the sample and the counter) (Default: text),enum=text,enum=binary,enum=blob,enum=msgpack,enum=protobuf,default=text"`
+	BlobSize uint32 `json:"blobSize" jsonschema:"title=Blob size,description=Number of random bytes following the sample with the blob encoding (Default: 32),default=32"`
+	// Faults are deliberately injected to test the error paths of the
+	// framework, each with the given probability.
+	FaultErrorRate        float64 `json:"faultErrorRate" jsonschema:"title=Error fault rate,description=Probability of returning an error instead of an event (Default: 0),default=0"`
+	FaultTimeoutRate      float64 `json:"faultTimeoutRate" jsonschema:"title=Timeout fault rate,description=Probability of returning a timeout instead of an event (Default: 0),default=0"`
+	FaultEOFRate          float64 `json:"faultEOFRate" jsonschema:"title=EOF fault rate,description=Probability of ending the event stream instead of returning an event (Default: 0),default=0"`
+	FaultMalformedRate    float64 `json:"faultMalformedRate" jsonschema:"title=Malformed fault rate,description=Probability of returning an event with a malformed payload (Default: 0),default=0"`
+	FaultExtractErrorRate float64 `json:"faultExtractErrorRate" jsonschema:"title=Extraction fault rate,description=Probability of failing the extraction of a field (Default: 0),default=0"`
+	// The timestamps of some events are skewed to test the ordering of
+	// the events in the framework.
+	TimestampSkewRate float64 `json:"timestampSkewRate" jsonschema:"title=Timestamp skew rate,description=Probability of skewing the timestamp of an event into the past or the future (Default: 0),default=0"`
+	TimestampMaxSkew  uint64  `json:"timestampMaxSkew" jsonschema:"title=Timestamp max skew,description=Maximum skew of the timestamps in seconds (Default: 60),default=60"`
+	// The events are grouped into simulated sessions if enabled, to test
+	// the stateful rule patterns.
+	Sessions             bool   `json:"sessions" jsonschema:"title=Sessions,description=If true then the events are grouped into sessions made of an open event and activity events and a close event sharing a session ID in their payload (Default: false),default=false"`
+	SessionMaxActivities uint64 `json:"sessionMaxActivities" jsonschema:"title=Session max activities,description=Maximum number of activity events of a session (Default: 3),default=3"`
+	SessionConcurrency   uint32 `json:"sessionConcurrency" jsonschema:"title=Session concurrency,description=Number of sessions open at the same time whose events are interleaved (Default: 1),default=1"`
+	// The events are returned in bursts separated by idle periods if both
+	// durations are set.
+	BurstMs uint64 `json:"burstMs" jsonschema:"title=Burst duration,description=Duration in milliseconds of the bursts during which the events are returned (Default: 0 for no duty cycle),default=0"`
+	IdleMs  uint64 `json:"idleMs" jsonschema:"title=Idle duration,description=Duration in milliseconds of the idle periods between the bursts during which no event is returned (Default: 0 for no duty cycle),default=0"`
+	// The benchmark mode measures the throughput of the framework.
+	Benchmark            bool   `json:"benchmark" jsonschema:"title=Benchmark,description=If true then every slot of the batches is filled with a fixed-size payload without randomization nor logging (Default: false),default=false"`
+	BenchmarkPayloadSize uint32 `json:"benchmarkPayloadSize" jsonschema:"title=Benchmark payload size,description=Size in bytes of the payload of the events in benchmark mode (Default: 8),default=8"`
+	// The async extraction optimization of the SDK can be disabled
+	// if it causes issues in a given environment.
+	UseAsync bool `json:"useAsync" jsonschema:"title=Use async extraction,description=If true then async extraction optimization is enabled (Default: true),default=true"`
 }
 
 type PluginOpenParams struct {
-	Start     uint64 `json:"start" jsonschema:"title=Start value,description=The starting value of the sample (Default: 1),default=1"`
-	MaxEvents uint64 `json:"maxEvents" jsonschema:"title=Max num events,description=The number of events to return before returning EOF (Default: 20),default=20"`
+	Start uint64 `json:"start" jsonschema:"title=Start value,description=The starting value of the sample (Default: 1),default=1"`
+	// The number of events is nil unless set, since the default depends on
+	// the source of the samples.
+	MaxEvents *uint64 `json:"maxEvents" jsonschema:"title=Max num events,description=The number of events to return before returning EOF or 0 to never return EOF (Default: 20),default=20"`
+	// The events are returned as fast as possible unless a rate is set.
+	RatePerSecond float64 `json:"ratePerSecond" jsonschema:"title=Rate per second,description=The number of events returned per second (Default: 0 for unlimited),default=0"`
+	// The samples are generated unless a file of samples is replayed.
+	File string `json:"file" jsonschema:"title=Samples file,description=Path of a file of pre-recorded samples replayed line by line instead of generating them (Default: empty),default="`
+	Loop bool   `json:"loop" jsonschema:"title=Loop,description=If true then the samples file is replayed from its start once its end is reached (Default: false),default=false"`
 }
 
 type Plugin struct {
 	plugins.BasePlugin
 	// Will be used to randomize samples
 	rand *rand.Rand
+	// Draws the random amounts added to the samples
+	distribution distribution
+	// Draws the faults to inject
+	faults *faultInjector
+	// Renders the JSON payload of the events, if configured
+	payload *template.Template
 	// Contains the init configuration values
 	config PluginConfig
 	// Contains the open params configuration
@@ -64,11 +123,22 @@ type Plugin struct {
 
 func (p *PluginConfig) setDefault() {
 	p.Jitter = 10
+	p.Distribution = "uniform"
+	p.Encoding = encodingText
+	p.BlobSize = 32
+	p.TimestampMaxSkew = 60
+	p.SessionMaxActivities = 3
+	p.SessionConcurrency = 1
+	p.BenchmarkPayloadSize = 8
+	p.UseAsync = true
 }
 
 func (p *PluginOpenParams) setDefault() {
 	p.Start = 1
-	p.MaxEvents = 20
+	p.MaxEvents = nil
+	p.RatePerSecond = 0
+	p.File = ""
+	p.Loop = false
 }
 
 func (m *Plugin) Info() *plugins.Info {
@@ -84,8 +154,8 @@ func (m *Plugin) Info() *plugins.Info {
 
 func (p *Plugin) InitSchema() *sdk.SchemaInfo {
 	reflector := jsonschema.Reflector{
-		RequiredFromJSONSchemaTags: true, // all properties are optional by default
-		AllowAdditionalProperties:  true, // unrecognized properties don't cause a parsing failures
+		RequiredFromJSONSchemaTags: true,  // all properties are optional by default
+		AllowAdditionalProperties:  false, // unrecognized properties are rejected
 	}
 	if schema, err := reflector.Reflect(&PluginConfig{}).MarshalJSON(); err == nil {
 		return &sdk.SchemaInfo{
@@ -96,18 +166,54 @@ func (p *Plugin) InitSchema() *sdk.SchemaInfo {
 }
 
 func (p *Plugin) Init(cfg string) error {
-	// initialize state
-	p.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
-
-	// The format of cfg is a json object with a single param
-	// "jitter", e.g. {"jitter": 10}
+	// The format of cfg is a json object, e.g. {"jitter": 10}
 	// Empty configs are allowed, in which case the default is used.
-	// Since we provide a schema through InitSchema(), the framework
-	// guarantees that the config is always well-formed json.
+	// Since we provide a schema through InitSchema(), the frameworks
+	// supporting it validate the config against it. It's validated here
+	// too for the other ones, rejecting the wrong types and unknown keys.
 	p.config.setDefault()
 	if len(cfg) != 0 {
-		json.Unmarshal([]byte(cfg), &p.config)
+		dec := json.NewDecoder(strings.NewReader(cfg))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&p.config); err != nil {
+			return fmt.Errorf("invalid init config: %s", err.Error())
+		}
+	}
+
+	// initialize state
+	seed := p.config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	p.rand = rand.New(rand.NewSource(seed))
+	p.faults = newFaultInjector(seed)
+	payloadTemplate := p.config.PayloadTemplate
+	if len(payloadTemplate) == 0 && p.config.Sessions {
+		payloadTemplate = sessionPayloadTemplate
+	}
+	if len(payloadTemplate) > 0 {
+		t, err := parsePayloadTemplate(payloadTemplate, p.rand)
+		if err != nil {
+			return fmt.Errorf("invalid payload template: %s", err.Error())
+		}
+		p.payload = t
+	}
+	p.distribution = distributions[p.config.Distribution]
+	if p.distribution == nil {
+		return fmt.Errorf("unknown jitter distribution: %s", p.config.Distribution)
 	}
+	switch p.config.Encoding {
+	case encodingText:
+	case encodingBinary, encodingBlob, encodingMsgPack, encodingProtobuf:
+		if p.payload != nil || p.config.Benchmark {
+			return fmt.Errorf("the %s encoding can't be used with a payload template nor sessions nor the benchmark mode", p.config.Encoding)
+		}
+	default:
+		return fmt.Errorf("unknown sample encoding: %s", p.config.Encoding)
+	}
+
+	// enable/disable async extraction optimazion (enabled by default)
+	extract.SetAsync(p.config.UseAsync)
 	return nil
 }
 
@@ -115,6 +221,18 @@ func (p *Plugin) Destroy() {
 	// nothing to do here
 }
 
+// openParamsPresets are the canned open params listed for discovery
+var openParamsPresets = []sdk.OpenParam{
+	{Value: `{"start": 1, "maxEvents": 20}`, Desc: "Default run: 20 events"},
+	{Value: `{"start": 1, "maxEvents": 100}`, Desc: "Small run: 100 events"},
+	{Value: `{"start": 1, "maxEvents": 10000000}`, Desc: "Soak: 10 million events"},
+	{Value: `{"start": 1, "maxEvents": 60000, "ratePerSecond": 1000}`, Desc: "Load: 1000 events per second for a minute"},
+}
+
+func (p *Plugin) OpenParams() ([]sdk.OpenParam, error) {
+	return openParamsPresets, nil
+}
+
 func (p *Plugin) Open(prms string) (source.Instance, error) {
 
 	p.openParams.setDefault()
@@ -123,31 +241,180 @@ func (p *Plugin) Open(prms string) (source.Instance, error) {
 			return nil, fmt.Errorf("wrong open params format: %s", err.Error())
 		}
 	}
+	if p.openParams.RatePerSecond < 0 {
+		return nil, fmt.Errorf("ratePerSecond must be positive: %v", p.openParams.RatePerSecond)
+	}
+
+	// Unless a number of events is set, the samples of a file are replayed
+	// until its end, or forever if looping, and the benchmarks run forever.
+	// A number of 0 events never ends the stream either.
+	maxEvents := uint64(20)
+	if p.openParams.MaxEvents != nil {
+		maxEvents = *p.openParams.MaxEvents
+	} else if len(p.openParams.File) > 0 || p.config.Benchmark {
+		maxEvents = math.MaxUint64
+	}
+	if maxEvents == 0 {
+		maxEvents = math.MaxUint64
+	}
+	if p.config.Benchmark {
+		return newBenchmarkInstance(int(p.config.BenchmarkPayloadSize), maxEvents), nil
+	}
+
+	var samples *sampleReader
+	if len(p.openParams.File) > 0 {
+		if p.binary() {
+			return nil, fmt.Errorf("samples files can't be replayed with the %s encoding", p.config.Encoding)
+		}
+		var err error
+		samples, err = openSamples(p.openParams.File, p.openParams.Loop)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var sessions *sessionSimulator
+	if p.config.Sessions {
+		sessions = newSessionSimulator(p.rand, p.config.SessionMaxActivities, int(p.config.SessionConcurrency))
+	}
 
 	evt_counter := uint64(0)
 	sample := p.openParams.Start
-	maxEvents := p.openParams.MaxEvents
+	rate := p.openParams.RatePerSecond
+	cycle := dutyCycle{
+		burst: time.Duration(p.config.BurstMs) * time.Millisecond,
+		idle:  time.Duration(p.config.IdleMs) * time.Millisecond,
+	}
+	start := time.Now()
+	var buf []byte
+	records := newRecordEncoder(p.config.Encoding)
 	pull := func(ctx context.Context, evt sdk.EventWriter) error {
 		if evt_counter >= uint64(maxEvents) {
 			return sdk.ErrEOF
 		}
-		evt_counter++
 
-		// Increment sample by 1, also add a jitter of [0:jitter]
-		sample += 1 + uint64(p.rand.Int63n(int64(p.config.Jitter+1)))
+		// With a duty cycle, no event is returned during the idle periods.
+		// The partial batch is flushed after a short wait instead.
+		if wait := cycle.idleFor(time.Since(start)); wait > 0 {
+			if wait > rateMaxWait {
+				wait = rateMaxWait
+			}
+			select {
+			case <-ctx.Done():
+				return sdk.ErrEOF
+			case <-time.After(wait):
+			}
+			return sdk.ErrTimeout
+		}
 
-		// The representation of a dummy event is the sample as a string.
-		str := fmt.Sprintf("%d", sample)
+		// With a rate, the n-th event is due n/rate seconds of bursts after
+		// the open. Until then, the partial batch is flushed after a short wait.
+		if rate > 0 {
+			due := start.Add(cycle.wallTime(time.Duration(float64(evt_counter) / rate * float64(time.Second))))
+			if wait := time.Until(due); wait > 0 {
+				if wait > rateMaxWait {
+					wait = rateMaxWait
+				}
+				select {
+				case <-ctx.Done():
+					return sdk.ErrEOF
+				case <-time.After(wait):
+				}
+				if time.Now().Before(due) {
+					return sdk.ErrTimeout
+				}
+			}
+		}
+		// The faults are injected instead of the next event
+		if p.faults.inject(p.config.FaultErrorRate) {
+			return fmt.Errorf("injected fault after %d events", evt_counter)
+		}
+		if p.faults.inject(p.config.FaultTimeoutRate) {
+			return sdk.ErrTimeout
+		}
+		if p.faults.inject(p.config.FaultEOFRate) {
+			return sdk.ErrEOF
+		}
+		evt_counter++
 
 		// It is not mandatory to set the Timestamp of the event (it
 		// would be filled in by the framework if set to uint_max),
 		// but it's a good practice.
-		evt.SetTimestamp(uint64(time.Now().UnixNano()))
+		// The timestamp is skewed for some of the events, if configured.
+		now := time.Now()
+		if p.faults.inject(p.config.TimestampSkewRate) {
+			now = now.Add(p.faults.skew(time.Duration(p.config.TimestampMaxSkew) * time.Second))
+		}
+		evt.SetTimestamp(uint64(now.UnixNano()))
+
+		// The representation of a dummy event is the sample as a string,
+		// or the JSON payload rendered from the template if configured,
+		// which is appended to a reused buffer to avoid allocations.
+		// The replayed samples are returned as they were recorded.
+		if samples != nil {
+			line, err := samples.next()
+			if err == io.EOF {
+				return sdk.ErrEOF
+			}
+			if err != nil {
+				return err
+			}
+			buf = append(buf[:0], line...)
+		} else {
+			// Increment sample by 1, also add a jitter drawn from the
+			// configured distribution, by default uniform in [0:jitter]
+			delta := 1 + p.distribution(p.rand, p.config.Jitter)
+			sample += delta
+
+			if p.payload != nil {
+				data := &payloadData{
+					Sample:    sample,
+					Counter:   evt_counter,
+					Delta:     delta,
+					Timestamp: now,
+				}
+				if sessions != nil {
+					data.Session, data.SessionEvent = sessions.next()
+				}
+				var err error
+				buf, err = renderPayload(buf[:0], p.payload, data)
+				if err != nil {
+					return err
+				}
+			} else if records != nil {
+				buf = appendRecord(buf[:0], records, sample, evt_counter, delta)
+			} else {
+				buf = appendSample(buf[:0], sample, p.config.Encoding, p.rand, int(p.config.BlobSize))
+			}
+		}
+
+		if p.faults.inject(p.config.FaultMalformedRate) {
+			buf = append(buf[:0], malformedPayload...)
+		}
 
-		_, err := evt.Writer().Write([]byte(str))
+		_, err := evt.Writer().Write(buf)
 		return err
 	}
-	return source.NewPullInstance(pull)
+	return source.NewPullInstance(pull,
+		source.WithInstanceClose(func() {
+			if samples != nil {
+				samples.Close()
+			}
+		}),
+		source.WithInstanceProgress(func() (float64, string) {
+			return progress(evt_counter, maxEvents)
+		}),
+	)
+}
+
+// progress returns the share of the maxEvents events returned so far. The
+// instances without a number of events only report the events returned.
+func progress(count, maxEvents uint64) (float64, string) {
+	if maxEvents == math.MaxUint64 {
+		return 0, fmt.Sprintf("%v events", count)
+	}
+	pd := float64(count) / float64(maxEvents)
+	return pd, fmt.Sprintf("%.2f%% - %v/%v events", pd*100, count, maxEvents)
 }
 
 // todo: optimize this to cache by event number
@@ -156,7 +423,27 @@ func (m *Plugin) String(evt sdk.EventReader) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if m.record() {
+		rec, err := decodeRecord(evtBytes)
+		if err != nil {
+			return "", err
+		}
+		return string(rec.AppendJSON(nil)), nil
+	}
+	if m.binary() {
+		sample, err := decodeSample(evtBytes)
+		if err != nil {
+			return "", err
+		}
+		if len(evtBytes) > sampleSize {
+			return fmt.Sprintf("{\"sample\": \"%d\", \"blob\": \"%x\"}", sample, evtBytes[sampleSize:]), nil
+		}
+		return fmt.Sprintf("{\"sample\": \"%d\"}", sample), nil
+	}
 	evtStr := string(evtBytes)
+	if isPayload(evtBytes) {
+		return evtStr, nil
+	}
 
 	// The string representation of an event is a json object with the sample
 	return fmt.Sprintf("{\"sample\": \"%s\"}", evtStr), nil
@@ -180,15 +467,66 @@ func (m *Plugin) Fields() []sdk.FieldEntry {
 			Name: "dummy.strvalue",
 			Desc: "The sample value in the event, as a string",
 		},
+		{
+			Type: "uint64",
+			Name: "dummy.counter",
+			Desc: "The number of the event in its event stream, from the counter of the record or JSON payload of the event",
+		},
+		{
+			Type: "uint64",
+			Name: "dummy.delta",
+			Desc: "The increment of the sample value since the previous event, from the delta of the record or JSON payload of the event",
+		},
+		{
+			Type: "uint64",
+			Name: "dummy.bucket",
+			Desc: "The sample value modulo the provided number of buckets",
+			Arg:  sdk.FieldEntryArg{IsRequired: true, IsIndex: true},
+		},
+		{
+			Type: "string",
+			Name: "dummy.json",
+			Desc: "The value of the provided key in the JSON payload of the event, e.g. dummy.json[user] or dummy.json[user.name] for a nested key",
+			Arg:  sdk.FieldEntryArg{IsRequired: true, IsKey: true},
+		},
 	}
 }
 
 func (m *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
+	if m.faults.inject(m.config.FaultExtractErrorRate) {
+		return fmt.Errorf("injected fault extracting %s from event %d", req.Field(), evt.EventNum())
+	}
 	evtBytes, err := ioutil.ReadAll(evt.Reader())
 	if err != nil {
 		return err
 	}
-	evtStr := string(evtBytes)
+
+	// these fields don't depend on the sample of the event
+	switch req.FieldID() {
+	case 3: // dummy.counter
+		return m.extractUint(req, evtBytes, "counter")
+	case 4: // dummy.delta
+		return m.extractUint(req, evtBytes, "delta")
+	case 6: // dummy.json
+		if !req.ArgPresent() {
+			return fmt.Errorf("'dummy.json' field requires an argument, but no argument is provided")
+		}
+		if m.binary() {
+			return nil
+		}
+		if value, ok := payloadValue(evtBytes, req.ArgKey()); ok {
+			req.SetValue(value)
+		}
+		return nil
+	}
+
+	evtStr, err := m.decodeSample(evtBytes)
+	if err == errNoValue {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 	evtVal, err := strconv.Atoi(evtStr)
 	if err != nil {
 		return err
@@ -196,14 +534,10 @@ func (m *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
 
 	switch req.FieldID() {
 	case 0: // dummy.divisible
-
-		if !req.ArgPresent() {
-			return fmt.Errorf("'dummy.divisible' field requires an argument, but no argument is provided")
+		if !req.ArgPresent() || req.ArgIndex() == 0 {
+			return fmt.Errorf("'dummy.divisible' field requires a non-zero argument")
 		}
-
-		divisor := req.ArgIndex()
-
-		if uint64(evtVal)%divisor == 0 {
+		if uint64(evtVal)%req.ArgIndex() == 0 {
 			req.SetValue(uint64(1))
 		} else {
 			req.SetValue(uint64(0))
@@ -212,9 +546,28 @@ func (m *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
 		req.SetValue(uint64(evtVal))
 	case 2: // dummy.strvalue
 		req.SetValue(evtStr)
+	case 5: // dummy.bucket
+		if !req.ArgPresent() || req.ArgIndex() == 0 {
+			return fmt.Errorf("'dummy.bucket' field requires a non-zero argument")
+		}
+		req.SetValue(uint64(evtVal) % req.ArgIndex())
 	default:
 		return fmt.Errorf("no known field: %s", req.Field())
 	}
 
 	return nil
 }
+
+// extractUint sets the value of a field from the property of an event with
+// the given key, if any
+func (m *Plugin) extractUint(req sdk.ExtractRequest, evtBytes []byte, key string) error {
+	v, err := m.decodeUint(evtBytes, key)
+	if err == errNoValue {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	req.SetValue(v)
+	return nil
+}
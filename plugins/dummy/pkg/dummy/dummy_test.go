@@ -0,0 +1,923 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dummy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+)
+
+type testEventReader struct {
+	num  uint64
+	data []byte
+}
+
+func (t *testEventReader) EventNum() uint64 {
+	return t.num
+}
+
+func (t *testEventReader) Timestamp() uint64 {
+	return 0
+}
+
+func (t *testEventReader) Reader() io.ReadSeeker {
+	return bytes.NewReader(t.data)
+}
+
+type testEventWriter struct {
+	data bytes.Buffer
+	ts   uint64
+}
+
+func (t *testEventWriter) Writer() io.Writer {
+	t.data.Reset()
+	return &t.data
+}
+
+func (t *testEventWriter) SetTimestamp(value uint64) {
+	t.ts = value
+}
+
+type testEventWriters struct {
+	evts []*testEventWriter
+}
+
+func (t *testEventWriters) Get(eventIndex int) sdk.EventWriter {
+	return t.evts[eventIndex]
+}
+
+func (t *testEventWriters) Len() int {
+	return len(t.evts)
+}
+
+func (t *testEventWriters) ArrayPtr() unsafe.Pointer {
+	return nil
+}
+
+func (t *testEventWriters) Free() {
+	// do nothing
+}
+
+type testExtractRequest struct {
+	fieldID    uint64
+	fieldType  uint32
+	field      string
+	argKey     string
+	argIndex   uint64
+	argPresent bool
+	value      interface{}
+}
+
+func (t *testExtractRequest) FieldID() uint64 {
+	return t.fieldID
+}
+
+func (t *testExtractRequest) FieldType() uint32 {
+	return t.fieldType
+}
+
+func (t *testExtractRequest) Field() string {
+	return t.field
+}
+
+func (t *testExtractRequest) ArgKey() string {
+	return t.argKey
+}
+
+func (t *testExtractRequest) ArgIndex() uint64 {
+	return t.argIndex
+}
+
+func (t *testExtractRequest) ArgPresent() bool {
+	return t.argPresent
+}
+
+func (t *testExtractRequest) IsList() bool {
+	return false
+}
+
+func (t *testExtractRequest) SetValue(v interface{}) {
+	t.value = v
+}
+
+func (t *testExtractRequest) SetPtr(unsafe.Pointer) {
+	// do nothing
+}
+
+// newTestPlugin returns a plugin initialized with the given config
+func newTestPlugin(t *testing.T, cfg string) *Plugin {
+	p := &Plugin{}
+	if err := p.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Destroy)
+	return p
+}
+
+// openTestInstance opens an instance of the plugin with the given params
+func openTestInstance(t *testing.T, p *Plugin, params string) source.Instance {
+	inst, err := p.Open(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if c, ok := inst.(sdk.Closer); ok {
+			c.Close()
+		}
+	})
+	return inst
+}
+
+// nextEvents returns up to n events of an instance, and whether the end of
+// its stream was reached
+func nextEvents(t *testing.T, p *Plugin, inst source.Instance, n int) ([][]byte, bool) {
+	evts := &testEventWriters{}
+	for i := 0; i < 8; i++ {
+		evts.evts = append(evts.evts, &testEventWriter{})
+	}
+	var res [][]byte
+	for len(res) < n {
+		count, err := inst.NextBatch(p, evts)
+		for i := 0; i < count; i++ {
+			res = append(res, append([]byte(nil), evts.evts[i].data.Bytes()...))
+		}
+		switch err {
+		case nil, sdk.ErrTimeout:
+		case sdk.ErrEOF:
+			return res, true
+		default:
+			t.Fatal(err)
+		}
+	}
+	return res[:n], false
+}
+
+// readEvents returns up to n events of a new instance opened with params
+func readEvents(t *testing.T, p *Plugin, params string, n int) ([][]byte, bool) {
+	return nextEvents(t, p, openTestInstance(t, p, params), n)
+}
+
+func TestSeed(t *testing.T) {
+	for _, dist := range []string{"uniform", "gaussian", "zipf", "exponential"} {
+		cfg := fmt.Sprintf(`{"seed": 42, "jitter": 1000, "distribution": %q}`, dist)
+		a, _ := readEvents(t, newTestPlugin(t, cfg), `{"maxEvents": 50}`, 50)
+		b, _ := readEvents(t, newTestPlugin(t, cfg), `{"maxEvents": 50}`, 50)
+		if len(a) != 50 || len(b) != 50 {
+			t.Fatalf("%s: expected 50 events, got %d and %d", dist, len(a), len(b))
+		}
+		for i := range a {
+			if !bytes.Equal(a[i], b[i]) {
+				t.Fatalf("%s: event %d differs with the same seed: %s and %s", dist, i, a[i], b[i])
+			}
+		}
+	}
+
+	a, _ := readEvents(t, newTestPlugin(t, `{"seed": 42, "jitter": 1000}`), `{"maxEvents": 50}`, 50)
+	b, _ := readEvents(t, newTestPlugin(t, `{"seed": 43, "jitter": 1000}`), `{"maxEvents": 50}`, 50)
+	if bytes.Equal(bytes.Join(a, nil), bytes.Join(b, nil)) {
+		t.Error("expected another stream with another seed")
+	}
+}
+
+// extractField extracts a field from an event, without argument
+func extractField(p *Plugin, field string, evt sdk.EventReader) (interface{}, error) {
+	return extractFieldArg(p, field, nil, evt)
+}
+
+// extractFieldArg extracts a field from an event, with an index argument
+// if arg is an uint64 or a key argument if it is a string
+func extractFieldArg(p *Plugin, field string, arg interface{}, evt sdk.EventReader) (interface{}, error) {
+	for i, f := range p.Fields() {
+		if f.Name != field {
+			continue
+		}
+		req := &testExtractRequest{fieldID: uint64(i), field: field}
+		if f.Type == "string" {
+			req.fieldType = sdk.FieldTypeCharBuf
+		} else {
+			req.fieldType = sdk.FieldTypeUint64
+		}
+		switch a := arg.(type) {
+		case uint64:
+			req.argIndex = a
+			req.argPresent = true
+		case string:
+			req.argKey = a
+			req.argPresent = true
+		}
+		err := p.Extract(req, evt)
+		return req.value, err
+	}
+	return nil, fmt.Errorf("unknown field %s", field)
+}
+
+func TestPayloadTemplate(t *testing.T) {
+	cfg := `{"seed": 1, "jitter": 0, "payloadTemplate": "{\"sample\": {{.Sample}}, \"counter\": {{.Counter}}, \"user\": {{json (randString 8)}}}"}`
+	p := newTestPlugin(t, cfg)
+	evts, eof := readEvents(t, p, `{"start": 10, "maxEvents": 3}`, 4)
+	if !eof || len(evts) != 3 {
+		t.Fatalf("expected 3 events, got %d (%v)", len(evts), eof)
+	}
+	for i, evt := range evts {
+		var payload struct {
+			Sample  uint64
+			Counter uint64
+			User    string
+		}
+		if err := json.Unmarshal(evt, &payload); err != nil {
+			t.Fatalf("expected a json payload, got %s", evt)
+		}
+		if payload.Sample != uint64(11+i) || payload.Counter != uint64(i+1) || len(payload.User) != 8 {
+			t.Errorf("unexpected payload %s", evt)
+		}
+
+		// the payloads are their own representation
+		s, err := p.String(&testEventReader{num: uint64(i + 1), data: evt})
+		if err != nil || s != string(evt) {
+			t.Errorf("expected %s, got %s (%v)", evt, s, err)
+		}
+		v, err := extractField(p, "dummy.value", &testEventReader{num: uint64(i + 1), data: evt})
+		if err != nil || v != payload.Sample {
+			t.Errorf("expected sample %d, got %v (%v)", payload.Sample, v, err)
+		}
+	}
+
+	// the sample of a payload is optional
+	v, err := extractField(p, "dummy.value", &testEventReader{num: 1, data: []byte(`{"user": "a"}`)})
+	if err != nil || v != nil {
+		t.Errorf("expected no value, got %v (%v)", v, err)
+	}
+}
+
+func TestPayloadTemplateErrors(t *testing.T) {
+	if err := (&Plugin{}).Init(`{"payloadTemplate": "{{.Sample"}`); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+
+	// the rendered payloads must be valid JSON
+	p := newTestPlugin(t, `{"payloadTemplate": "{{.Sample}} {"}`)
+	inst := openTestInstance(t, p, `{}`)
+	evts := &testEventWriters{evts: []*testEventWriter{{}}}
+	if _, err := inst.NextBatch(p, evts); err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Errorf("expected an invalid JSON error, got %v", err)
+	}
+}
+
+func TestRate(t *testing.T) {
+	p := newTestPlugin(t, `{}`)
+	if _, err := p.Open(`{"ratePerSecond": -1}`); err == nil {
+		t.Error("expected an error for a negative rate")
+	}
+
+	// the n-th event is due n/rate seconds after the open
+	start := time.Now()
+	evts, eof := readEvents(t, p, `{"maxEvents": 10, "ratePerSecond": 200}`, 11)
+	if elapsed := time.Since(start); !eof || len(evts) != 10 || elapsed < 45*time.Millisecond {
+		t.Errorf("expected 10 events in at least 45ms, got %d in %s (%v)", len(evts), elapsed, eof)
+	}
+
+	// the events returned before the next one is due are flushed
+	inst := openTestInstance(t, p, `{"ratePerSecond": 10}`)
+	batch := &testEventWriters{}
+	for i := 0; i < 8; i++ {
+		batch.evts = append(batch.evts, &testEventWriter{})
+	}
+	start = time.Now()
+	n, err := inst.NextBatch(p, batch)
+	if n != 1 || err != sdk.ErrTimeout {
+		t.Errorf("expected a partial batch of 1 event, got %d (%v)", n, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second/10 {
+		t.Errorf("expected the batch to be flushed before the next event, got %s", elapsed)
+	}
+}
+
+func TestSamplesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "samples.txt")
+	if err := ioutil.WriteFile(path, []byte("5\n\n  7 \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	samples := func(evts [][]byte) string {
+		return string(bytes.Join(evts, []byte(",")))
+	}
+	p := newTestPlugin(t, `{}`)
+
+	// without a number of events, the file is replayed to its end
+	evts, eof := readEvents(t, p, fmt.Sprintf(`{"file": %q}`, path), 10)
+	if !eof || samples(evts) != "5,7" {
+		t.Errorf("expected samples 5,7 and EOF, got %s (%v)", samples(evts), eof)
+	}
+
+	// the looped file is replayed from its start
+	evts, eof = readEvents(t, p, fmt.Sprintf(`{"file": %q, "loop": true, "maxEvents": 5}`, path), 10)
+	if !eof || samples(evts) != "5,7,5,7,5" {
+		t.Errorf("expected samples 5,7,5,7,5 and EOF, got %s (%v)", samples(evts), eof)
+	}
+	evts, eof = readEvents(t, p, fmt.Sprintf(`{"file": %q, "loop": true}`, path), 9)
+	if eof || samples(evts) != "5,7,5,7,5,7,5,7,5" {
+		t.Errorf("expected the samples to loop, got %s (%v)", samples(evts), eof)
+	}
+
+	// the default number of events of the generated samples is only
+	// applied to the files when it's set explicitly
+	evts, eof = readEvents(t, p, fmt.Sprintf(`{"file": %q, "loop": true, "maxEvents": 20}`, path), 30)
+	if !eof || len(evts) != 20 {
+		t.Errorf("expected 20 events and EOF, got %d (%v)", len(evts), eof)
+	}
+	if evts, eof := readEvents(t, p, `{}`, 30); !eof || len(evts) != 20 {
+		t.Errorf("expected 20 generated events and EOF, got %d (%v)", len(evts), eof)
+	}
+
+	// a file without samples can't be looped
+	empty := filepath.Join(t.TempDir(), "empty.txt")
+	if err := ioutil.WriteFile(empty, []byte("\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if evts, eof := readEvents(t, p, fmt.Sprintf(`{"file": %q, "loop": true}`, empty), 1); !eof || len(evts) != 0 {
+		t.Errorf("expected an empty stream, got %d events (%v)", len(evts), eof)
+	}
+
+	if _, err := p.Open(`{"file": "/nonexistent/samples.txt"}`); err == nil {
+		t.Error("expected an error for a missing samples file")
+	}
+
+	// the binary samples can't be replayed
+	p = newTestPlugin(t, `{"encoding": "binary"}`)
+	if _, err := p.Open(fmt.Sprintf(`{"file": %q}`, path)); err == nil {
+		t.Error("expected an error replaying a file with the binary encoding")
+	}
+}
+
+func TestDistributions(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for name, dist := range distributions {
+		var sum uint64
+		for i := 0; i < 10000; i++ {
+			v := dist(r, 100)
+			if v > 100 && name != "exponential" {
+				t.Fatalf("%s: expected a value in [0:100], got %d", name, v)
+			}
+			sum += v
+		}
+		mean := float64(sum) / 10000
+		switch name {
+		case "uniform", "gaussian", "exponential":
+			if mean < 45 || mean > 55 {
+				t.Errorf("%s: expected a mean of about 50, got %v", name, mean)
+			}
+		case "zipf":
+			if mean > 10 {
+				t.Errorf("%s: expected mostly small values, got a mean of %v", name, mean)
+			}
+		}
+		if dist(r, 0) != 0 {
+			t.Errorf("%s: expected no jitter with a jitter of 0", name)
+		}
+	}
+
+	if err := (&Plugin{}).Init(`{"distribution": "poisson"}`); err == nil {
+		t.Error("expected an error for an unknown distribution")
+	}
+}
+
+func TestFaults(t *testing.T) {
+	batch := func(p *Plugin) (int, error) {
+		evts := &testEventWriters{evts: []*testEventWriter{{}, {}}}
+		return openTestInstance(t, p, `{}`).NextBatch(p, evts)
+	}
+	if _, err := batch(newTestPlugin(t, `{"faultErrorRate": 1}`)); err == nil || !strings.Contains(err.Error(), "injected fault") {
+		t.Errorf("expected an injected error, got %v", err)
+	}
+	if n, err := batch(newTestPlugin(t, `{"faultTimeoutRate": 1}`)); n != 0 || err != sdk.ErrTimeout {
+		t.Errorf("expected a timeout, got %d events (%v)", n, err)
+	}
+	if n, err := batch(newTestPlugin(t, `{"faultEOFRate": 1}`)); n != 0 || err != sdk.ErrEOF {
+		t.Errorf("expected an EOF, got %d events (%v)", n, err)
+	}
+
+	p := newTestPlugin(t, `{"faultMalformedRate": 1}`)
+	evts, _ := readEvents(t, p, `{"maxEvents": 2}`, 2)
+	for _, evt := range evts {
+		if !bytes.Equal(evt, malformedPayload) {
+			t.Errorf("expected a malformed payload, got %q", evt)
+		}
+		if _, err := extractField(p, "dummy.value", &testEventReader{num: 1, data: evt}); err == nil {
+			t.Error("expected an error extracting from a malformed payload")
+		}
+	}
+
+	p = newTestPlugin(t, `{"faultExtractErrorRate": 1}`)
+	if _, err := extractField(p, "dummy.value", &testEventReader{num: 1, data: []byte("2")}); err == nil {
+		t.Error("expected an injected extraction error")
+	}
+
+	// the faults are drawn with the given probability
+	f := newFaultInjector(1)
+	var count int
+	for i := 0; i < 10000; i++ {
+		if f.inject(0.25) {
+			count++
+		}
+	}
+	if count < 2300 || count > 2700 {
+		t.Errorf("expected about 2500 faults, got %d", count)
+	}
+}
+
+func TestTimestampSkew(t *testing.T) {
+	timestamps := func(cfg string) []time.Time {
+		p := newTestPlugin(t, cfg)
+		evts := &testEventWriters{}
+		for i := 0; i < 8; i++ {
+			evts.evts = append(evts.evts, &testEventWriter{})
+		}
+		n, err := openTestInstance(t, p, `{}`).NextBatch(p, evts)
+		if n != 8 || err != nil {
+			t.Fatalf("expected 8 events, got %d (%v)", n, err)
+		}
+		var res []time.Time
+		for _, evt := range evts.evts {
+			res = append(res, time.Unix(0, int64(evt.ts)))
+		}
+		return res
+	}
+
+	for _, ts := range timestamps(`{}`) {
+		if d := time.Since(ts); d < 0 || d > time.Second {
+			t.Errorf("expected a current timestamp, got %s", ts)
+		}
+	}
+	var skewed int
+	for _, ts := range timestamps(`{"seed": 1, "timestampSkewRate": 1, "timestampMaxSkew": 3600}`) {
+		d := time.Since(ts)
+		if d < -time.Hour || d > time.Hour+time.Second {
+			t.Errorf("expected a timestamp skewed by an hour at most, got %s", ts)
+		}
+		if d < -time.Second || d > time.Second {
+			skewed++
+		}
+	}
+	if skewed == 0 {
+		t.Error("expected skewed timestamps")
+	}
+
+	f := newFaultInjector(1)
+	if f.skew(0) != 0 {
+		t.Error("expected no skew without a max skew")
+	}
+	var past, future bool
+	for i := 0; i < 1000; i++ {
+		s := f.skew(time.Minute)
+		if s < -time.Minute || s > time.Minute {
+			t.Fatalf("expected a skew of a minute at most, got %s", s)
+		}
+		past = past || s < 0
+		future = future || s > 0
+	}
+	if !past || !future {
+		t.Error("expected skews into both the past and the future")
+	}
+}
+
+func TestBenchmarkMode(t *testing.T) {
+	p := newTestPlugin(t, `{"benchmark": true, "benchmarkPayloadSize": 4}`)
+	evts := &testEventWriters{}
+	for i := 0; i < 8; i++ {
+		evts.evts = append(evts.evts, &testEventWriter{})
+	}
+
+	// every slot of the batches is filled
+	inst := openTestInstance(t, p, `{"maxEvents": 10}`)
+	for _, expected := range []int{8, 2} {
+		n, err := inst.NextBatch(p, evts)
+		if n != expected || err != nil {
+			t.Fatalf("expected %d events, got %d (%v)", expected, n, err)
+		}
+		for _, evt := range evts.evts[:n] {
+			if evt.data.String() != "0001" || evt.ts == 0 {
+				t.Errorf("expected a fixed payload with a timestamp, got %q at %d", evt.data.String(), evt.ts)
+			}
+		}
+	}
+	if n, err := inst.NextBatch(p, evts); n != 0 || err != sdk.ErrEOF {
+		t.Errorf("expected EOF, got %d events (%v)", n, err)
+	}
+
+	// without a number of events, the benchmark runs forever
+	if evts, eof := readEvents(t, p, `{}`, 1000); eof || len(evts) != 1000 {
+		t.Errorf("expected 1000 events without EOF, got %d (%v)", len(evts), eof)
+	}
+}
+
+func BenchmarkBenchmarkMode(b *testing.B) {
+	p := &Plugin{}
+	if err := p.Init(`{"benchmark": true}`); err != nil {
+		b.Fatal(err)
+	}
+	defer p.Destroy()
+	inst, err := p.Open(`{}`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	evts := &testEventWriters{}
+	for i := 0; i < int(sdk.DefaultBatchSize); i++ {
+		evts.evts = append(evts.evts, &testEventWriter{})
+	}
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		if _, err := inst.NextBatch(p, evts); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N)*float64(len(evts.evts))/time.Since(start).Seconds(), "events/s")
+}
+
+func TestExtractFields(t *testing.T) {
+	p := newTestPlugin(t, `{}`)
+	payload := []byte(`{"sample": 12, "user": {"name": "alice", "id": 7}}`)
+	tests := []struct {
+		field    string
+		arg      interface{}
+		data     []byte
+		expected interface{}
+	}{
+		{"dummy.divisible", uint64(3), []byte("12"), uint64(1)},
+		{"dummy.divisible", uint64(5), []byte("12"), uint64(0)},
+		{"dummy.counter", nil, []byte("12"), nil},
+		{"dummy.bucket", uint64(5), []byte("12"), uint64(2)},
+		{"dummy.bucket", uint64(1), []byte("12"), uint64(0)},
+		{"dummy.bucket", uint64(5), payload, uint64(2)},
+		{"dummy.json", "user.name", payload, "alice"},
+		{"dummy.json", "user.id", payload, "7"},
+		{"dummy.json", "user", payload, `{"name": "alice", "id": 7}`},
+		{"dummy.json", "user.email", payload, nil},
+		{"dummy.json", "user", []byte("12"), nil},
+	}
+	for _, test := range tests {
+		v, err := extractFieldArg(p, test.field, test.arg, &testEventReader{num: 4, data: test.data})
+		if err != nil {
+			t.Errorf("%s[%v]: %s", test.field, test.arg, err.Error())
+		} else if v != test.expected {
+			t.Errorf("%s[%v]: expected %v, got %v", test.field, test.arg, test.expected, v)
+		}
+	}
+
+	// the arguments of 0 are rejected, instead of dividing by zero
+	for _, field := range []string{"dummy.divisible", "dummy.bucket"} {
+		_, err := extractFieldArg(p, field, uint64(0), &testEventReader{num: 1, data: []byte("12")})
+		if err == nil || !strings.Contains(err.Error(), "non-zero argument") {
+			t.Errorf("%s[0]: expected an error, got %v", field, err)
+		}
+	}
+	if _, err := extractField(p, "dummy.json", &testEventReader{num: 1, data: payload}); err == nil {
+		t.Error("expected an error for a json field without key")
+	}
+}
+
+func TestExtractCounterDelta(t *testing.T) {
+	// the counter and the delta are read from the payload of the events
+	// only, whatever the event numbers and the order of the extractions
+	tests := []struct {
+		name    string
+		cfg     string
+		data    []byte
+		counter interface{}
+		delta   interface{}
+	}{
+		{"sample", `{}`, []byte("12"), nil, nil},
+		{"json", `{}`, []byte(`{"sample": 12, "counter": 3, "delta": 5}`), uint64(3), uint64(5)},
+		{"json without counter", `{}`, []byte(`{"sample": 12}`), nil, nil},
+		{"binary", `{"encoding": "binary"}`, []byte{12, 0, 0, 0, 0, 0, 0, 0}, nil, nil},
+	}
+	for _, test := range tests {
+		p := newTestPlugin(t, test.cfg)
+		for i := 0; i < 2; i++ {
+			evt := &testEventReader{num: uint64(10 - i), data: test.data}
+			counter, err := extractField(p, "dummy.counter", evt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			delta, err := extractField(p, "dummy.delta", evt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counter != test.counter || delta != test.delta {
+				t.Errorf("%s: expected the counter %v and the delta %v, got %v and %v", test.name, test.counter, test.delta, counter, delta)
+			}
+		}
+	}
+
+	// the generated payloads carry the counter and the delta of each event
+	for _, cfg := range []string{
+		`{"seed": 1, "jitter": 0, "payloadTemplate": "{\"counter\": {{.Counter}}, \"delta\": {{.Delta}}}"}`,
+		`{"seed": 1, "jitter": 0, "sessions": true}`,
+		`{"seed": 1, "jitter": 0, "encoding": "msgpack"}`,
+		`{"seed": 1, "jitter": 0, "encoding": "protobuf"}`,
+	} {
+		p := newTestPlugin(t, cfg)
+		evts, _ := readEvents(t, p, `{"maxEvents": 3}`, 3)
+		for i := len(evts) - 1; i >= 0; i-- {
+			evt := &testEventReader{num: 1, data: evts[i]}
+			counter, err := extractField(p, "dummy.counter", evt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			delta, err := extractField(p, "dummy.delta", evt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counter != uint64(i+1) || delta != uint64(1) {
+				t.Errorf("%s: expected the counter %d and the delta 1, got %v and %v", cfg, i+1, counter, delta)
+			}
+		}
+	}
+}
+
+func TestOpenParams(t *testing.T) {
+	p := newTestPlugin(t, `{}`)
+	presets, err := p.OpenParams()
+	if err != nil || len(presets) == 0 {
+		t.Fatalf("expected presets, got %d (%v)", len(presets), err)
+	}
+	for _, preset := range presets {
+		if len(preset.Desc) == 0 {
+			t.Errorf("expected a description for %s", preset.Value)
+		}
+		openTestInstance(t, p, preset.Value)
+	}
+}
+
+func TestInitConfig(t *testing.T) {
+	for _, cfg := range []string{
+		`{"jitter": "10"}`,
+		`{"jitter": -1}`,
+		`{"jiter": 10}`,
+		`{"jitter": 10`,
+	} {
+		if err := (&Plugin{}).Init(cfg); err == nil || !strings.Contains(err.Error(), "invalid init config") {
+			t.Errorf("%s: expected an invalid init config error, got %v", cfg, err)
+		}
+	}
+	newTestPlugin(t, ``)
+	newTestPlugin(t, `{"jitter": 5, "seed": 1}`)
+
+	var schema struct {
+		Definitions map[string]struct {
+			AdditionalProperties *bool `json:"additionalProperties"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal([]byte((&Plugin{}).InitSchema().Schema), &schema); err != nil {
+		t.Fatal(err)
+	}
+	def, ok := schema.Definitions["PluginConfig"]
+	if !ok || def.AdditionalProperties == nil || *def.AdditionalProperties {
+		t.Error("expected the schema to reject the additional properties")
+	}
+}
+
+func TestProgress(t *testing.T) {
+	pd, s := progress(5, 20)
+	if pd != 0.25 || s != "25.00% - 5/20 events" {
+		t.Errorf("unexpected progress: %v, %s", pd, s)
+	}
+	pd, s = progress(5, math.MaxUint64)
+	if pd != 0 || s != "5 events" {
+		t.Errorf("unexpected progress: %v, %s", pd, s)
+	}
+
+	p := newTestPlugin(t, `{}`)
+	inst := openTestInstance(t, p, `{"maxEvents": 32}`)
+	if evts, _ := nextEvents(t, p, inst, 8); len(evts) != 8 {
+		t.Fatalf("expected 8 events, got %d", len(evts))
+	}
+	if pd, _ := inst.(sdk.Progresser).Progress(p); pd != 0.25 {
+		t.Errorf("expected a progress of 0.25, got %v", pd)
+	}
+
+	// with 0 events, the stream never ends and only counts its events
+	p = newTestPlugin(t, `{"seed": 1}`)
+	inst = openTestInstance(t, p, `{"maxEvents": 0}`)
+	if evts, eof := nextEvents(t, p, inst, 96); eof || len(evts) != 96 {
+		t.Fatalf("expected 96 events without EOF, got %d (%v)", len(evts), eof)
+	}
+	pd, s = inst.(sdk.Progresser).Progress(p)
+	if pd != 0 || s != "96 events" {
+		t.Errorf("unexpected progress: %v, %s", pd, s)
+	}
+
+	p = newTestPlugin(t, `{"benchmark": true}`)
+	inst = openTestInstance(t, p, `{"maxEvents": 16}`)
+	nextEvents(t, p, inst, 8)
+	if pd, _ := inst.(sdk.Progresser).Progress(p); pd != 0.5 {
+		t.Errorf("expected a progress of 0.5, got %v", pd)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	p := newTestPlugin(t, `{"seed": 1, "sessions": true, "sessionMaxActivities": 4, "sessionConcurrency": 3}`)
+	evts, _ := readEvents(t, p, `{"maxEvents": 500}`, 500)
+	open := map[string]int{}
+	var closed int
+	for _, evt := range evts {
+		var payload struct {
+			Session string
+			Type    string
+			Counter uint64
+		}
+		if err := json.Unmarshal(evt, &payload); err != nil {
+			t.Fatalf("expected a json payload, got %s", evt)
+		}
+		activities, ok := open[payload.Session]
+		switch payload.Type {
+		case sessionOpen:
+			if ok {
+				t.Fatalf("session %s opened twice", payload.Session)
+			}
+			open[payload.Session] = 0
+			if len(open) > 3 {
+				t.Fatalf("expected 3 sessions open at most, got %d", len(open))
+			}
+		case sessionActivity:
+			if !ok || activities == 4 {
+				t.Fatalf("unexpected activity of session %s: %s", payload.Session, evt)
+			}
+			open[payload.Session]++
+		case sessionClose:
+			if !ok {
+				t.Fatalf("session %s closed without being open", payload.Session)
+			}
+			delete(open, payload.Session)
+			closed++
+		default:
+			t.Fatalf("unexpected session event %s", evt)
+		}
+	}
+	if closed < 50 {
+		t.Errorf("expected at least 50 complete sessions, got %d", closed)
+	}
+}
+
+func TestDutyCycle(t *testing.T) {
+	ms := time.Millisecond
+	var none dutyCycle
+	if none.idleFor(5*ms) != 0 || none.wallTime(5*ms) != 5*ms {
+		t.Error("expected no effect without a duty cycle")
+	}
+	if (dutyCycle{burst: 10 * ms}).enabled() {
+		t.Error("expected a duty cycle without idle period to be disabled")
+	}
+
+	d := dutyCycle{burst: 10 * ms, idle: 30 * ms}
+	idle := map[time.Duration]time.Duration{
+		0:       0,
+		9 * ms:  0,
+		10 * ms: 30 * ms,
+		25 * ms: 15 * ms,
+		39 * ms: 1 * ms,
+		40 * ms: 0,
+		55 * ms: 25 * ms,
+	}
+	for elapsed, expected := range idle {
+		if res := d.idleFor(elapsed); res != expected {
+			t.Errorf("idleFor(%s): expected %s, got %s", elapsed, expected, res)
+		}
+	}
+	wall := map[time.Duration]time.Duration{
+		0:       0,
+		5 * ms:  5 * ms,
+		10 * ms: 40 * ms,
+		15 * ms: 45 * ms,
+		25 * ms: 85 * ms,
+	}
+	for active, expected := range wall {
+		if res := d.wallTime(active); res != expected {
+			t.Errorf("wallTime(%s): expected %s, got %s", active, expected, res)
+		}
+	}
+
+	// no event is returned once the burst is over
+	p := newTestPlugin(t, `{"burstMs": 10, "idleMs": 10000}`)
+	inst := openTestInstance(t, p, `{"maxEvents": 0}`)
+	evts := &testEventWriters{evts: []*testEventWriter{{}, {}, {}, {}}}
+	start := time.Now()
+	for {
+		n, err := inst.NextBatch(p, evts)
+		if err != nil && err != sdk.ErrTimeout {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("expected the burst to end")
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 10*ms {
+		t.Errorf("expected a burst of 10ms, got %s", elapsed)
+	}
+}
+
+func TestEncodings(t *testing.T) {
+	for _, encoding := range []string{encodingText, encodingBinary, encodingBlob, encodingMsgPack, encodingProtobuf} {
+		t.Run(encoding, func(t *testing.T) {
+			p := newTestPlugin(t, fmt.Sprintf(`{"seed": 1, "jitter": 0, "encoding": %q, "blobSize": 4}`, encoding))
+			evts, eof := readEvents(t, p, `{"start": 1, "maxEvents": 3}`, 4)
+			if !eof || len(evts) != 3 {
+				t.Fatalf("expected 3 events, got %d (%v)", len(evts), eof)
+			}
+			for i, evt := range evts {
+				evt := &testEventReader{num: uint64(i + 1), data: evt}
+				v, err := extractField(p, "dummy.strvalue", evt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sample := v.(string)
+				if expected := fmt.Sprint(i + 2); sample != expected {
+					t.Errorf("expected sample %s, got %s", expected, sample)
+				}
+
+				s, err := p.String(evt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var obj map[string]interface{}
+				if err := json.Unmarshal([]byte(s), &obj); err != nil {
+					t.Fatalf("expected a json string, got %s", s)
+				}
+				if fmt.Sprint(obj["sample"]) != sample {
+					t.Errorf("expected sample %s in %s", sample, s)
+				}
+				switch encoding {
+				case encodingBinary:
+					if len(evt.data) != sampleSize {
+						t.Errorf("expected %d bytes, got %d", sampleSize, len(evt.data))
+					}
+				case encodingBlob:
+					if len(evt.data) != sampleSize+4 || len(obj["blob"].(string)) != 8 {
+						t.Errorf("expected a blob of 4 bytes, got %d bytes and %s", len(evt.data), s)
+					}
+				case encodingMsgPack, encodingProtobuf:
+					if fmt.Sprint(obj["counter"]) != fmt.Sprint(i+1) {
+						t.Errorf("expected counter %d in %s", i+1, s)
+					}
+				}
+				if encoding != encodingText {
+					if v, err := extractFieldArg(p, "dummy.json", "sample", evt); err != nil || v != nil {
+						t.Errorf("expected no json value in a binary payload, got %v (%v)", v, err)
+					}
+				}
+			}
+		})
+	}
+
+	// the binary samples must be complete
+	p := newTestPlugin(t, `{"encoding": "binary"}`)
+	if _, err := extractField(p, "dummy.value", &testEventReader{num: 1, data: []byte{1, 2, 3}}); err == nil {
+		t.Error("expected an error for a truncated binary sample")
+	}
+	if _, err := p.String(&testEventReader{num: 1, data: []byte{1}}); err == nil {
+		t.Error("expected an error formatting a truncated binary sample")
+	}
+
+	for _, cfg := range []string{
+		`{"encoding": "base64"}`,
+		`{"encoding": "binary", "payloadTemplate": "{}"}`,
+		`{"encoding": "blob", "sessions": true}`,
+		`{"encoding": "binary", "benchmark": true}`,
+		`{"encoding": "msgpack", "payloadTemplate": "{}"}`,
+		`{"encoding": "protobuf", "benchmark": true}`,
+	} {
+		if err := (&Plugin{}).Init(cfg); err == nil {
+			t.Errorf("%s: expected an error", cfg)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dummy
+
+import "time"
+
+// dutyCycle alternates bursts, during which the events are returned, and
+// idle periods, during which none is returned
+type dutyCycle struct {
+	burst time.Duration
+	idle  time.Duration
+}
+
+func (d dutyCycle) enabled() bool {
+	return d.burst > 0 && d.idle > 0
+}
+
+// idleFor returns the time left until the next burst, given the time elapsed
+// since the first one started, or 0 during a burst
+func (d dutyCycle) idleFor(elapsed time.Duration) time.Duration {
+	if !d.enabled() {
+		return 0
+	}
+	phase := elapsed % (d.burst + d.idle)
+	if phase < d.burst {
+		return 0
+	}
+	return d.burst + d.idle - phase
+}
+
+// wallTime returns the time elapsed since the first burst started once the
+// bursts lasted the given active time, skipping the idle periods between them
+func (d dutyCycle) wallTime(active time.Duration) time.Duration {
+	if !d.enabled() {
+		return active
+	}
+	return (active/d.burst)*(d.burst+d.idle) + active%d.burst
+}
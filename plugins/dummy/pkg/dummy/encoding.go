@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dummy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+
+	"github.com/falcosecurity/plugins/shared/go/eventencoder"
+)
+
+// The encodings of the samples in the payload of the events
+const (
+	// the sample as an ASCII decimal string
+	encodingText = "text"
+	// the sample as 8 raw little-endian bytes
+	encodingBinary = "binary"
+	// the binary sample followed by random bytes
+	encodingBlob = "blob"
+	// a msgpack record with the sample, the counter and the delta, see
+	// eventencoder
+	encodingMsgPack = "msgpack"
+	// a protobuf record with the sample, the counter and the delta, see
+	// eventencoder
+	encodingProtobuf = "protobuf"
+)
+
+// errNoValue is returned when decoding a property that an event doesn't
+// have, in which case the field is extracted without value
+var errNoValue = errors.New("no value")
+
+// sampleSize is the size of the binary-encoded samples
+const sampleSize = 8
+
+// appendSample appends a sample with the given encoding to buf. The random
+// bytes of the blobs are drawn from r.
+func appendSample(buf []byte, sample uint64, encoding string, r *rand.Rand, blobSize int) []byte {
+	switch encoding {
+	case encodingBinary, encodingBlob:
+		var b [sampleSize]byte
+		binary.LittleEndian.PutUint64(b[:], sample)
+		buf = append(buf, b[:]...)
+		if encoding == encodingBlob {
+			for i := 0; i < blobSize; i++ {
+				buf = append(buf, byte(r.Intn(256)))
+			}
+		}
+		return buf
+	default:
+		return strconv.AppendUint(buf, sample, 10)
+	}
+}
+
+// newRecordEncoder returns the encoder of the records of the given
+// encoding, or nil if its events aren't records
+func newRecordEncoder(encoding string) *eventencoder.Encoder {
+	format, err := eventencoder.ParseFormat(encoding)
+	if err != nil {
+		return nil
+	}
+	e, _ := eventencoder.NewEncoder(format)
+	return e
+}
+
+// appendRecord appends the record of a sample encoded with e to buf
+func appendRecord(buf []byte, e *eventencoder.Encoder, sample, counter, delta uint64) []byte {
+	e.Reset()
+	e.Uint("sample", sample)
+	e.Uint("counter", counter)
+	e.Uint("delta", delta)
+	return e.AppendTo(buf)
+}
+
+// decodeRecord returns the record of a record-encoded event
+func decodeRecord(evt []byte) (*eventencoder.Record, error) {
+	rec, _, err := eventencoder.Decode(evt)
+	return rec, err
+}
+
+// decodeSample returns the sample of a binary-encoded event
+func decodeSample(evt []byte) (uint64, error) {
+	if len(evt) < sampleSize {
+		return 0, fmt.Errorf("binary sample of %d bytes is too short, expected %d", len(evt), sampleSize)
+	}
+	return binary.LittleEndian.Uint64(evt), nil
+}
+
+// binary returns true if the samples are binary-encoded
+func (m *Plugin) binary() bool {
+	return m.config.Encoding != encodingText
+}
+
+// record returns true if the events are records encoded with eventencoder
+func (m *Plugin) record() bool {
+	return m.config.Encoding == encodingMsgPack || m.config.Encoding == encodingProtobuf
+}
+
+// decodeSample returns the sample of an event as a string, or errNoValue
+// if its record or JSON payload has none
+func (m *Plugin) decodeSample(evtBytes []byte) (string, error) {
+	var sample uint64
+	var err error
+	switch {
+	case m.record() || (!m.binary() && isPayload(evtBytes)):
+		// the sample of a record or JSON payload is optional
+		sample, err = m.decodeUint(evtBytes, "sample")
+	case m.binary():
+		sample, err = decodeSample(evtBytes)
+	default:
+		return string(evtBytes), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(sample, 10), nil
+}
+
+// decodeUint returns the property of an event with the given key, if it's
+// a record or a JSON payload, or errNoValue otherwise
+func (m *Plugin) decodeUint(evtBytes []byte, key string) (uint64, error) {
+	if m.record() {
+		rec, err := decodeRecord(evtBytes)
+		if err != nil {
+			return 0, err
+		}
+		if v, ok := rec.Uint(key); ok {
+			return v, nil
+		}
+	} else if !m.binary() && isPayload(evtBytes) {
+		if v, ok := payloadUint(evtBytes, key); ok {
+			return v, nil
+		}
+	}
+	return 0, errNoValue
+}
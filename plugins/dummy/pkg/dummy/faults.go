@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dummy
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// malformedPayload is the payload of the events injected as malformed, which
+// is neither a sample nor JSON
+var malformedPayload = []byte("\xffmalformed{")
+
+// faultInjector draws the faults deliberately injected in the event stream
+// and the extractions, from its own random source so that the stream of
+// samples stays the same with a fixed seed
+type faultInjector struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newFaultInjector(seed int64) *faultInjector {
+	return &faultInjector{rand: rand.New(rand.NewSource(seed))}
+}
+
+// inject returns true if a fault with the given probability is injected
+func (f *faultInjector) inject(probability float64) bool {
+	if probability <= 0 {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rand.Float64() < probability
+}
+
+// skew returns a random duration in [-max:max], to skew a timestamp into
+// the past or the future
+func (f *faultInjector) skew(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return time.Duration(f.rand.Int63n(2*int64(max)+1)) - max
+}
@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dummy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const payloadLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// payloadData is the data the payload template of the events is rendered with
+type payloadData struct {
+	// The sample value of the event
+	Sample uint64
+	// The number of the event in the opened instance, starting at 1
+	Counter uint64
+	// The increment of the sample since the previous event, or since the
+	// start value for the first one
+	Delta uint64
+	// The time of the event
+	Timestamp time.Time
+	// The ID of the simulated session of the event, if enabled
+	Session string
+	// The type of the event in its session: open, activity or close
+	SessionEvent string
+}
+
+// parsePayloadTemplate parses the template of the JSON payload of the
+// events. The random functions draw from the given source, so that the
+// payloads are reproducible with a fixed seed.
+func parsePayloadTemplate(text string, r *rand.Rand) (*template.Template, error) {
+	return template.New("payload").Funcs(template.FuncMap{
+		// randString returns a random alphanumeric string of n characters
+		"randString": func(n int) string {
+			b := make([]byte, n)
+			for i := range b {
+				b[i] = payloadLetters[r.Intn(len(payloadLetters))]
+			}
+			return string(b)
+		},
+		// randInt returns a random integer in [0,n)
+		"randInt": func(n int) int {
+			return r.Intn(n)
+		},
+		// randChoice returns one of its arguments at random
+		"randChoice": func(values ...interface{}) interface{} {
+			return values[r.Intn(len(values))]
+		},
+		// json returns the JSON encoding of a value, e.g. a quoted string
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+}
+
+// renderPayload appends the JSON payload of an event rendered with the
+// given template to buf
+func renderPayload(buf []byte, t *template.Template, data *payloadData) ([]byte, error) {
+	w := bytes.NewBuffer(buf)
+	if err := t.Execute(w, data); err != nil {
+		return nil, err
+	}
+	if !json.Valid(w.Bytes()) {
+		return nil, fmt.Errorf("payload template rendered invalid JSON: %s", w.String())
+	}
+	return w.Bytes(), nil
+}
+
+// isPayload returns true if an event is a JSON payload rendered from the
+// template, rather than a bare sample value
+func isPayload(evt []byte) bool {
+	return len(evt) > 0 && evt[0] == '{'
+}
+
+// payloadUint returns the unsigned integer property of the JSON payload of
+// an event with the given key, if any
+func payloadUint(evt []byte, key string) (uint64, bool) {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(evt, &payload); err != nil {
+		return 0, false
+	}
+	var n json.Number
+	if err := json.Unmarshal(payload[key], &n); err != nil {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(n.String(), 10, 64)
+	return v, err == nil
+}
+
+// payloadValue returns the value of the given key of the JSON payload of an
+// event, where the dots separate the keys of the nested objects. The strings
+// are returned unquoted, and the other values as JSON.
+func payloadValue(evt []byte, key string) (string, bool) {
+	if !isPayload(evt) {
+		return "", false
+	}
+	value := json.RawMessage(evt)
+	for _, k := range strings.Split(key, ".") {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(value, &obj); err != nil {
+			return "", false
+		}
+		v, ok := obj[k]
+		if !ok {
+			return "", false
+		}
+		value = v
+	}
+	var str string
+	if err := json.Unmarshal(value, &str); err == nil {
+		return str, true
+	}
+	return string(value), true
+}
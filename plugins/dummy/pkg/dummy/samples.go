@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dummy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+)
+
+// sampleReader reads the pre-recorded samples of a file line by line,
+// starting over at the end of the file if looping
+type sampleReader struct {
+	file    *os.File
+	scanner *bufio.Scanner
+	loop    bool
+	// The number of samples read since the file was last started over
+	read uint64
+}
+
+func openSamples(path string, loop bool) (*sampleReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &sampleReader{file: f, loop: loop}
+	r.rewind()
+	return r, nil
+}
+
+func (r *sampleReader) rewind() {
+	r.scanner = bufio.NewScanner(r.file)
+	r.scanner.Buffer(nil, int(sdk.DefaultEvtSize))
+	r.read = 0
+}
+
+// next returns the next sample of the file, skipping the empty lines, or
+// io.EOF at the end of the file if not looping
+func (r *sampleReader) next() ([]byte, error) {
+	for {
+		for r.scanner.Scan() {
+			line := bytes.TrimSpace(r.scanner.Bytes())
+			if len(line) > 0 {
+				r.read++
+				return line, nil
+			}
+		}
+		if err := r.scanner.Err(); err != nil {
+			return nil, err
+		}
+		// a file without samples can't be looped
+		if !r.loop || r.read == 0 {
+			return nil, io.EOF
+		}
+		if _, err := r.file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		r.rewind()
+	}
+}
+
+func (r *sampleReader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dummy
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// The types of the events of a simulated session
+const (
+	sessionOpen     = "open"
+	sessionActivity = "activity"
+	sessionClose    = "close"
+)
+
+// sessionPayloadTemplate is the payload of the events of the simulated
+// sessions unless a payload template is set
+const sessionPayloadTemplate = `{"session": {{json .Session}}, "type": {{json .SessionEvent}}, "sample": {{.Sample}}, "counter": {{.Counter}}, "delta": {{.Delta}}}`
+
+// openSession is a simulated session not closed yet
+type openSession struct {
+	id        string
+	remaining uint64
+}
+
+// sessionSimulator groups the events into simulated sessions, each made of
+// an "open" event, a random number of "activity" events and a "close"
+// event, all sharing the ID of the session. Up to concurrency sessions are
+// open at the same time, in which case their events are interleaved.
+type sessionSimulator struct {
+	rand          *rand.Rand
+	maxActivities uint64
+	concurrency   int
+	count         uint64
+	open          []*openSession
+}
+
+func newSessionSimulator(r *rand.Rand, maxActivities uint64, concurrency int) *sessionSimulator {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &sessionSimulator{rand: r, maxActivities: maxActivities, concurrency: concurrency}
+}
+
+// next returns the session ID and the type of the next event
+func (s *sessionSimulator) next() (string, string) {
+	if len(s.open) < s.concurrency {
+		s.count++
+		session := &openSession{
+			id:        fmt.Sprintf("session-%d", s.count),
+			remaining: uint64(s.rand.Int63n(int64(s.maxActivities) + 1)),
+		}
+		s.open = append(s.open, session)
+		return session.id, sessionOpen
+	}
+	i := s.rand.Intn(len(s.open))
+	session := s.open[i]
+	if session.remaining > 0 {
+		session.remaining--
+		return session.id, sessionActivity
+	}
+	s.open = append(s.open[:i], s.open[i+1:]...)
+	return session.id, sessionClose
+}
@@ -6,16 +6,30 @@ require (
 	cloud.google.com/go/pubsub v1.38.0
 	github.com/alecthomas/jsonschema v0.0.0-20220216202328-9eeeec9d044b
 	github.com/falcosecurity/plugin-sdk-go v0.7.4
+	github.com/falcosecurity/plugins/shared/go/backoff v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/conformance v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/debugserver v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/errkind v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/fuzz v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/golden v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/health v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/jsoncache v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/metrics v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/secrets v0.0.0-00010101000000-000000000000
 	github.com/valyala/fastjson v1.6.4
 	google.golang.org/api v0.184.0
+	google.golang.org/grpc v1.64.1
 )
 
+require gopkg.in/yaml.v2 v2.4.0 // indirect
+
 require (
 	cloud.google.com/go v0.115.0 // indirect
 	cloud.google.com/go/auth v0.5.1 // indirect
 	cloud.google.com/go/auth/oauth2adapt v0.2.2 // indirect
 	cloud.google.com/go/compute/metadata v0.3.0 // indirect
 	cloud.google.com/go/iam v1.1.8 // indirect
+	github.com/falcosecurity/plugins/shared/go/mux v0.0.0-00010101000000-000000000000 // indirect
 	github.com/felixge/httpsnoop v1.0.4 // indirect
 	github.com/go-logr/logr v1.4.1 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
@@ -41,6 +55,27 @@ require (
 	google.golang.org/genproto v0.0.0-20240610135401-a8a62080eff3 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20240604185151-ef581f913117 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240604185151-ef581f913117 // indirect
-	google.golang.org/grpc v1.64.1 // indirect
 	google.golang.org/protobuf v1.34.2 // indirect
 )
+
+replace github.com/falcosecurity/plugins/shared/go/jsoncache => ../../shared/go/jsoncache
+
+replace github.com/falcosecurity/plugins/shared/go/debugserver => ../../shared/go/debugserver
+
+replace github.com/falcosecurity/plugins/shared/go/golden => ../../shared/go/golden
+
+replace github.com/falcosecurity/plugins/shared/go/fuzz => ../../shared/go/fuzz
+
+replace github.com/falcosecurity/plugins/shared/go/secrets => ../../shared/go/secrets
+
+replace github.com/falcosecurity/plugins/shared/go/health => ../../shared/go/health
+
+replace github.com/falcosecurity/plugins/shared/go/metrics => ../../shared/go/metrics
+
+replace github.com/falcosecurity/plugins/shared/go/errkind => ../../shared/go/errkind
+
+replace github.com/falcosecurity/plugins/shared/go/backoff => ../../shared/go/backoff
+
+replace github.com/falcosecurity/plugins/shared/go/conformance => ../../shared/go/conformance
+
+replace github.com/falcosecurity/plugins/shared/go/mux => ../../shared/go/mux
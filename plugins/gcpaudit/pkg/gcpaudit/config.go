@@ -19,6 +19,10 @@ package gcpaudit
 
 import (
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins"
+	"github.com/falcosecurity/plugins/shared/go/debugserver"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/jsoncache"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
 	"github.com/valyala/fastjson"
 )
 
@@ -26,9 +30,12 @@ type Plugin struct {
 	plugins.BasePlugin
 	Config PluginConfig
 
-	lastEventNum uint64
-	jparser      fastjson.Parser
-	jdata        *fastjson.Value
+	jcache jsoncache.Cache
+	jdata  *fastjson.Value
+
+	debugServer *debugserver.Server
+	health      *health.Server
+	metrics     *metrics.Metrics
 }
 
 type PluginConfig struct {
@@ -37,6 +44,11 @@ type PluginConfig struct {
 	NumGoroutines          int    `json:"num_goroutines" jsonschema:"title=Num Goroutines,description=The number of goroutines that each datastructure along the Receive path will spawn (Default: 10),default=10"`
 	MaxOutstandingMessages int    `json:"max_outstanding_messages" jsonschema:"title=Max Outstanding Messages,description=The maximum number of unprocessed messages (Default: 1000),default=1000"`
 	UseAsync               bool   `json:"useAsync" jsonschema:"title=Use async extraction,description=If true then async extraction optimization is enabled (Default: true),default=true"`
+	DebugAddress           string `json:"debugAddress" jsonschema:"title=Debug address,description=Loopback address (e.g. localhost:6060) of an HTTP server exposing the pprof and expvar endpoints of the plugin (Default: empty for disabled),default="`
+	HealthAddress          string `json:"healthAddress" jsonschema:"title=Health address,description=Address (e.g. :8081) of an HTTP server exposing the health and readiness endpoints of the plugin (Default: empty for disabled),default="`
+	HealthPath             string `json:"healthPath" jsonschema:"title=Health path,description=Path of the health endpoint. The readiness endpoint is served under <path>/ready (Default: /healthz),default=/healthz"`
+	MetricsAddress         string `json:"metricsAddress" jsonschema:"title=Metrics address,description=Address (e.g. :9090) of the Prometheus endpoint shared by the plugins of the Falco process configured with the same address (Default: empty for disabled),default="`
+	MetricsPath            string `json:"metricsPath" jsonschema:"title=Metrics path,description=Path of the Prometheus endpoint (Default: /metrics),default=/metrics"`
 }
 
 // Reset sets the configuration to its default values
@@ -45,4 +57,7 @@ func (p *PluginConfig) Reset() {
 	p.CredentialsFile = ""
 	p.NumGoroutines = 10
 	p.MaxOutstandingMessages = 1000
+	p.UseAsync = true
+	p.HealthPath = health.DefaultPath
+	p.MetricsPath = metrics.DefaultPath
 }
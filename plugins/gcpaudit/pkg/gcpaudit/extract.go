@@ -19,7 +19,7 @@ package gcpaudit
 
 import (
 	"fmt"
-	"io"
+	"time"
 
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
 )
@@ -49,21 +49,22 @@ func (p *Plugin) Fields() []sdk.FieldEntry {
 		{Type: "string", Name: "gcp.resourceName", Display: "Resource Name", Desc: "GCP resource name"},
 		{Type: "string", Name: "gcp.resourceType", Display: "Resource Type", Desc: "GCP resource type"},
 		{Type: "string", Name: "gcp.storage.bucket", Display: "Bucket Name", Desc: "GCP bucket name"},
+		{Type: "string", Name: "gcp.resource.labels", Display: "Resource Label", Desc: "Value of a GCP resource label, e.g. gcp.resource.labels[project_id]", Arg: sdk.FieldEntryArg{IsRequired: true, IsKey: true}},
+		{Type: "string", Name: "gcp.iam.delta.action", Display: "IAM Delta Actions", Desc: "Actions (ADD or REMOVE) of the IAM policy binding changes", IsList: true},
+		{Type: "string", Name: "gcp.iam.delta.role", Display: "IAM Delta Roles", Desc: "Roles of the IAM policy binding changes, e.g. roles/owner", IsList: true},
+		{Type: "string", Name: "gcp.iam.delta.member", Display: "IAM Delta Members", Desc: "Members of the IAM policy binding changes, e.g. user:foo@example.com", IsList: true},
 	}
 }
 
 func (p *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
-	if evt.EventNum() != p.lastEventNum {
-		evtBytes, err := io.ReadAll(evt.Reader())
-		if err != nil {
-			return err
-		}
-		evtString := string(evtBytes)
-		p.jdata, err = p.jparser.Parse(evtString)
-		if err != nil {
-			return err
-		}
-		p.lastEventNum = evt.EventNum()
+	if p.metrics != nil {
+		defer p.metrics.ObserveExtraction(time.Now())
+	}
+	// the event is parsed once for all the fields extracted from it
+	var err error
+	p.jdata, err = p.jcache.Get(evt.EventNum(), evt.Reader())
+	if err != nil {
+		return err
 	}
 
 	switch req.Field() {
@@ -231,9 +232,40 @@ func (p *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
 			req.SetValue(string(bucket))
 		}
 
+	case "gcp.resource.labels":
+		label := p.jdata.Get("resource", "labels").GetStringBytes(req.ArgKey())
+		if label != nil {
+			req.SetValue(string(label))
+		}
+
+	case "gcp.iam.delta.action":
+		req.SetValue(p.bindingDeltasField("action"))
+
+	case "gcp.iam.delta.role":
+		req.SetValue(p.bindingDeltasField("role"))
+
+	case "gcp.iam.delta.member":
+		req.SetValue(p.bindingDeltasField("member"))
+
 	default:
 		return fmt.Errorf("unknown field: %s", req.Field())
 	}
 
 	return nil
 }
+
+// bindingDeltasField returns the values of a field of all the IAM policy
+// binding changes, which are located in the serviceData for most of the
+// services and in the metadata for BigQuery datasets
+func (p *Plugin) bindingDeltasField(field string) []string {
+	res := []string{}
+	for _, path := range [][]string{
+		{"protoPayload", "serviceData", "policyDelta", "bindingDeltas"},
+		{"protoPayload", "metadata", "datasetChange", "bindingDeltas"},
+	} {
+		for _, delta := range p.jdata.GetArray(path...) {
+			res = append(res, string(delta.GetStringBytes(field)))
+		}
+	}
+	return res
+}
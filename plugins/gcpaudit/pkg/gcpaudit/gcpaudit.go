@@ -19,10 +19,13 @@ package gcpaudit
 
 import (
 	"context"
-	"fmt"
+	"time"
 
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	"github.com/falcosecurity/plugins/shared/go/secrets"
 )
 
 const (
@@ -46,28 +49,45 @@ func (p *Plugin) Info() *plugins.Info {
 }
 
 func (p *Plugin) Open(params string) (source.Instance, error) {
+	params, err := secrets.ExpandEnv(params)
+	if err != nil {
+		return nil, errkind.Count(errkind.New(errkind.Config, err), p.metrics)
+	}
 	if params == "" {
-		return nil, fmt.Errorf("no subscriptionID provided")
+		return nil, errkind.Count(errkind.Errorf(errkind.Config, "no subscriptionID provided"), p.metrics)
 	}
 
 	subscriptionID := params
 	ctx, cancel := context.WithCancel(context.Background())
-	eventsC, errC := p.pullMsgsSync(ctx, subscriptionID)
+	tracker := p.health.Track()
+	eventsC, errC := p.pullMsgsSync(ctx, subscriptionID, tracker)
 
 	pushEventC := make(chan source.PushEvent)
+	// the channels of pullMsgsSync are closed by its own goroutine
 	go func() {
-		defer close(eventsC)
 		for {
 			select {
 			case messages := <-eventsC:
+				tracker.Event()
 				pushEventC <- source.PushEvent{Data: messages}
+				p.metrics.Ingested(len(messages), time.Time{})
 
 			case e := <-errC:
-				pushEventC <- source.PushEvent{Err: e}
+				tracker.SetConnected(false)
+				tracker.Error()
+				p.metrics.UpstreamError()
+				pushEventC <- source.PushEvent{Err: errkind.Count(e, p.metrics)}
 				return
 			}
 		}
 	}()
 
-	return source.NewPushInstance(pushEventC, source.WithInstanceClose(cancel))
+	inst, err := source.NewPushInstance(pushEventC, source.WithInstanceClose(func() {
+		cancel()
+		tracker.Close()
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return metrics.Instance(inst, p.metrics), nil
 }
@@ -22,6 +22,11 @@ import (
 
 	"github.com/alecthomas/jsonschema"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/symbols/extract"
+	"github.com/falcosecurity/plugins/shared/go/debugserver"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	"github.com/falcosecurity/plugins/shared/go/secrets"
 )
 
 func (p *Plugin) InitSchema() *sdk.SchemaInfo {
@@ -38,6 +43,66 @@ func (p *Plugin) InitSchema() *sdk.SchemaInfo {
 }
 
 // initialize state
-func (p *Plugin) Init(cfg string) error {
-	return json.Unmarshal([]byte(cfg), &p.Config)
+func (p *Plugin) Init(cfg string) (err error) {
+	p.Config.Reset()
+	if err := json.Unmarshal([]byte(cfg), &p.Config); err != nil {
+		return err
+	}
+	if err := secrets.Resolve(&p.Config); err != nil {
+		return err
+	}
+
+	// enable/disable async extraction optimazion (enabled by default)
+	extract.SetAsync(p.Config.UseAsync)
+
+	// the framework doesn't call Destroy when Init fails, so the servers
+	// started before a failure are stopped here
+	defer func() {
+		if err != nil {
+			p.Destroy()
+		}
+	}()
+
+	// start the optional pprof and expvar server
+	if len(p.Config.DebugAddress) > 0 {
+		srv, err := debugserver.Start(p.Config.DebugAddress)
+		if err != nil {
+			return err
+		}
+		p.debugServer = srv
+	}
+
+	// start the optional health server
+	if len(p.Config.HealthAddress) > 0 {
+		srv, err := health.Start(p.Config.HealthAddress, p.Config.HealthPath)
+		if err != nil {
+			return err
+		}
+		p.health = srv
+	}
+
+	// start the optional metrics endpoint
+	if len(p.Config.MetricsAddress) > 0 {
+		m, err := metrics.Start(p.Config.MetricsAddress, p.Config.MetricsPath, PluginName)
+		if err != nil {
+			return err
+		}
+		p.metrics = m
+	}
+	return nil
+}
+
+func (p *Plugin) Destroy() {
+	if p.debugServer != nil {
+		p.debugServer.Close()
+		p.debugServer = nil
+	}
+	if p.health != nil {
+		p.health.Close()
+		p.health = nil
+	}
+	if p.metrics != nil {
+		p.metrics.Close()
+		p.metrics = nil
+	}
 }
@@ -26,10 +26,15 @@ import (
 
 	"cloud.google.com/go/pubsub"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugins/shared/go/backoff"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/health"
 	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-func (p *Plugin) pullMsgsSync(ctx context.Context, subscriptionID string) (chan []byte, chan error) {
+func (p *Plugin) pullMsgsSync(ctx context.Context, subscriptionID string, tracker *health.Tracker) (chan []byte, chan error) {
 	var clientOptions []option.ClientOption
 	if len(p.Config.CredentialsFile) > 0 {
 		clientOptions = append(clientOptions, option.WithCredentialsFile(p.Config.CredentialsFile))
@@ -44,30 +49,35 @@ func (p *Plugin) pullMsgsSync(ctx context.Context, subscriptionID string) (chan
 		// create pubsub client
 		client, err := pubsub.NewClient(ctx, p.Config.ProjectID, clientOptions...)
 		if err != nil {
-			errC <- err
+			errC <- errkind.New(pubsubErrorKind(err), err)
 			return
 		}
 
-		// attempt subscribing with exponential backoff
+		// attempt subscribing with exponential backoff, the plugin being
+		// reported as disconnected while the breaker is open after
+		// repeated quota errors
 		sub := client.Subscription(subscriptionID)
 		sub.ReceiveSettings.MaxOutstandingMessages = p.Config.MaxOutstandingMessages
 		sub.ReceiveSettings.NumGoroutines = p.Config.NumGoroutines
-		maxRetries := 3
-		retryDelay := time.Second
-		for retries := 0; retries < maxRetries; retries++ {
-			err = performPubSubOperation(sub, ctx, eventC)
-			if err == nil {
-				// Operation succeeded, break out of the loop
-				return
-			} else if isQuotaExceededError(err) {
-				// Quota exceeded, wait for backoff duration and retry
-				fmt.Printf("[gcpaudit] pubsub receive quota exceeded, retrying in %s\n", retryDelay.String())
-				time.Sleep(retryDelay)
-				retryDelay *= 2 // exponential backoff
-			} else {
-				errC <- err
-				return
-			}
+		breaker := backoff.NewBreaker(pubsubBreakerThreshold, pubsubBreakerCooldown, func(s backoff.State) {
+			tracker.SetConnected(s != backoff.Open)
+		})
+		// Receive blocks as long as the subscription is consumed
+		tracker.SetConnected(true)
+		err = backoff.Retry(ctx, backoff.Options{
+			Breaker:   breaker,
+			Retryable: isQuotaExceededError,
+			OnRetry: func(err error, delay time.Duration) {
+				qErr := errkind.Errorf(errkind.RateLimited, "pubsub receive quota exceeded")
+				fmt.Printf("[gcpaudit] %s, retrying in %s\n", errkind.Count(qErr, p.metrics), delay.String())
+				tracker.Error()
+				p.metrics.UpstreamError()
+			},
+		}, func(ctx context.Context) error {
+			return performPubSubOperation(sub, ctx, eventC)
+		})
+		if err != nil && ctx.Err() == nil {
+			errC <- errkind.New(pubsubErrorKind(err), err)
 		}
 
 	}()
@@ -75,10 +85,38 @@ func (p *Plugin) pullMsgsSync(ctx context.Context, subscriptionID string) (chan
 	return eventC, errC
 }
 
+const (
+	// pubsubBreakerThreshold is the number of consecutive quota errors
+	// after which the subscription isn't received for a cooldown period
+	pubsubBreakerThreshold = 3
+	// pubsubBreakerCooldown is the cooldown period of the breaker
+	pubsubBreakerCooldown = 5 * time.Minute
+)
+
 func isQuotaExceededError(err error) bool {
 	return strings.Contains(err.Error(), "quota exceeded")
 }
 
+// pubsubErrorKind returns the category of an error returned by Pub/Sub, from
+// its gRPC status code
+func pubsubErrorKind(err error) errkind.Kind {
+	s, ok := status.FromError(err)
+	if !ok {
+		return errkind.Of(err)
+	}
+	switch s.Code() {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return errkind.Auth
+	case codes.ResourceExhausted:
+		return errkind.RateLimited
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal:
+		return errkind.Unavailable
+	case codes.NotFound, codes.InvalidArgument, codes.FailedPrecondition:
+		return errkind.Config
+	}
+	return errkind.Of(err)
+}
+
 func performPubSubOperation(subscription *pubsub.Subscription, ctx context.Context, eventC chan []byte) error {
 	return subscription.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
 		eventC <- msg.Data
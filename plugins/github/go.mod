@@ -4,16 +4,90 @@ go 1.22
 
 require (
 	github.com/alecthomas/jsonschema v0.0.0-20220216202328-9eeeec9d044b
+	github.com/aws/aws-sdk-go-v2 v1.26.1
+	github.com/aws/aws-sdk-go-v2/config v1.27.11
+	github.com/aws/aws-sdk-go-v2/service/s3 v1.53.1
 	github.com/falcosecurity/plugin-sdk-go v0.7.4
+	github.com/falcosecurity/plugins/shared/go/batch v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/conformance v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/debugserver v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/errkind v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/fuzz v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/golden v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/health v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/httpclient v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/jsoncache v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/metrics v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/pagination v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/reload v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/secrets v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/tenant v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/webhook/cloudevents v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/webhook/queue v0.0.0-00010101000000-000000000000
 	github.com/google/go-github v17.0.0+incompatible
 	github.com/sethvargo/go-password v0.3.0
 	github.com/valyala/fastjson v1.6.4
 	golang.org/x/oauth2 v0.21.0
 )
 
+require gopkg.in/yaml.v2 v2.4.0 // indirect
+
 require (
+	github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream v1.6.2 // indirect
+	github.com/aws/aws-sdk-go-v2/credentials v1.17.11 // indirect
+	github.com/aws/aws-sdk-go-v2/feature/ec2/imds v1.16.1 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/configsources v1.3.5 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.6.5 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/ini v1.8.0 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/v4a v1.3.5 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/accept-encoding v1.11.2 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/checksum v1.3.7 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/presigned-url v1.11.7 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/s3shared v1.17.5 // indirect
+	github.com/aws/aws-sdk-go-v2/service/sso v1.20.5 // indirect
+	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.23.4 // indirect
+	github.com/aws/aws-sdk-go-v2/service/sts v1.28.6 // indirect
+	github.com/aws/smithy-go v1.20.2 // indirect
+	github.com/falcosecurity/plugins/shared/go/mux v0.0.0-00010101000000-000000000000 // indirect
+	github.com/falcosecurity/plugins/shared/go/ratelimit v0.0.0-00010101000000-000000000000 // indirect
 	github.com/google/go-cmp v0.6.0 // indirect
 	github.com/google/go-querystring v1.1.0 // indirect
 	github.com/iancoleman/orderedmap v0.3.0 // indirect
 	github.com/stretchr/testify v1.9.0 // indirect
 )
+
+replace github.com/falcosecurity/plugins/shared/go/jsoncache => ../../shared/go/jsoncache
+
+replace github.com/falcosecurity/plugins/shared/go/webhook/queue => ../../shared/go/webhook/queue
+
+replace github.com/falcosecurity/plugins/shared/go/debugserver => ../../shared/go/debugserver
+
+replace github.com/falcosecurity/plugins/shared/go/batch => ../../shared/go/batch
+
+replace github.com/falcosecurity/plugins/shared/go/golden => ../../shared/go/golden
+
+replace github.com/falcosecurity/plugins/shared/go/fuzz => ../../shared/go/fuzz
+
+replace github.com/falcosecurity/plugins/shared/go/webhook/cloudevents => ../../shared/go/webhook/cloudevents
+
+replace github.com/falcosecurity/plugins/shared/go/secrets => ../../shared/go/secrets
+
+replace github.com/falcosecurity/plugins/shared/go/health => ../../shared/go/health
+
+replace github.com/falcosecurity/plugins/shared/go/metrics => ../../shared/go/metrics
+
+replace github.com/falcosecurity/plugins/shared/go/reload => ../../shared/go/reload
+
+replace github.com/falcosecurity/plugins/shared/go/errkind => ../../shared/go/errkind
+
+replace github.com/falcosecurity/plugins/shared/go/tenant => ../../shared/go/tenant
+
+replace github.com/falcosecurity/plugins/shared/go/httpclient => ../../shared/go/httpclient
+
+replace github.com/falcosecurity/plugins/shared/go/pagination => ../../shared/go/pagination
+
+replace github.com/falcosecurity/plugins/shared/go/ratelimit => ../../shared/go/ratelimit
+
+replace github.com/falcosecurity/plugins/shared/go/conformance => ../../shared/go/conformance
+
+replace github.com/falcosecurity/plugins/shared/go/mux => ../../shared/go/mux
@@ -0,0 +1,488 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	"github.com/falcosecurity/plugins/shared/go/pagination"
+	"github.com/valyala/fastjson"
+)
+
+const (
+	auditLogType        = "audit_log"
+	auditLogMaxLineSize = 4 * 1024 * 1024
+	// auditLogMaxRetries is the number of polls after which a file that
+	// can't be read is skipped, so that it doesn't block the stream
+	auditLogMaxRetries = 5
+	// auditLogLayout is the layout of the hour directories where GitHub
+	// streams the audit log files, under the prefix of the store
+	auditLogLayout = "2006/01/02/15/"
+	// auditLogLateness is how long the hour directories are listed again
+	// after their hour, since the files can be uploaded late and then come
+	// before the files already read in lexicographic order
+	auditLogLateness = 2 * time.Hour
+)
+
+// auditLogStore is a storage where GitHub Enterprise streams its audit log.
+// The names of the files are relative to the prefix of the store.
+type auditLogStore interface {
+	// list returns the names of the files starting with the given prefix,
+	// in lexicographic order
+	list(ctx context.Context, prefix string) ([]string, error)
+	// get opens a file for reading
+	get(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// auditLogPrefix returns the prefix of a store as a directory
+func auditLogPrefix(prefix string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
+}
+
+// s3AuditLogStore reads the audit log streamed to an AWS S3 bucket
+type s3AuditLogStore struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func newS3AuditLogStore(u *url.URL, region string) (*s3AuditLogStore, error) {
+	var opts []func(*config.LoadOptions) error
+	if len(region) > 0 {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &s3AuditLogStore{
+		client: s3.NewFromConfig(cfg),
+		bucket: u.Host,
+		prefix: auditLogPrefix(strings.TrimPrefix(u.Path, "/")),
+	}, nil
+}
+
+func (s *s3AuditLogStore) list(ctx context.Context, prefix string) ([]string, error) {
+	var res []string
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: awssdk.String(s.bucket),
+		Prefix: awssdk.String(s.prefix + prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			res = append(res, strings.TrimPrefix(*obj.Key, s.prefix))
+		}
+	}
+	return res, nil
+}
+
+func (s *s3AuditLogStore) get(ctx context.Context, name string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: awssdk.String(s.bucket),
+		Key:    awssdk.String(s.prefix + name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// azureAuditLogStore reads the audit log streamed to an Azure Blob Storage
+// container, authenticating with a SAS token through the REST API
+type azureAuditLogStore struct {
+	client    *http.Client
+	container string
+	prefix    string
+	sasToken  string
+}
+
+func newAzureAuditLogStore(u *url.URL, sasToken string) (*azureAuditLogStore, error) {
+	path := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if path[0] == "" {
+		return nil, errkind.Errorf(errkind.Config, "[%s] missing container name in %s", PluginName, u.String())
+	}
+	res := &azureAuditLogStore{
+		client:    &http.Client{Timeout: 5 * time.Minute},
+		container: fmt.Sprintf("https://%s.blob.core.windows.net/%s", u.Host, path[0]),
+		sasToken:  strings.TrimPrefix(sasToken, "?"),
+	}
+	if len(path) > 1 {
+		res.prefix = auditLogPrefix(path[1])
+	}
+	return res, nil
+}
+
+func (a *azureAuditLogStore) do(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errkind.Errorf(errkind.FromStatus(resp.StatusCode), "unable to fetch data from Azure Blob Storage, status: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+func (a *azureAuditLogStore) list(ctx context.Context, prefix string) ([]string, error) {
+	query := url.Values{}
+	query.Set("restype", "container")
+	query.Set("comp", "list")
+	query.Set("prefix", a.prefix+prefix)
+	req, err := http.NewRequestWithContext(ctx, "GET", a.container+"?"+query.Encode()+"&"+a.sasToken, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// the pages are chained by the marker returned in each of them
+	var res []string
+	opts := pagination.Options{Mode: pagination.Cursor, CursorParam: "marker"}
+	err = pagination.All(ctx, a.client, req, opts, func(resp *http.Response) (pagination.Page, error) {
+		var page struct {
+			Blobs []struct {
+				Name string `xml:"Name"`
+			} `xml:"Blobs>Blob"`
+			NextMarker string `xml:"NextMarker"`
+		}
+		if err := xml.NewDecoder(resp.Body).Decode(&page); err != nil {
+			return pagination.Page{}, err
+		}
+		for _, blob := range page.Blobs {
+			res = append(res, strings.TrimPrefix(blob.Name, a.prefix))
+		}
+		return pagination.Page{Items: len(page.Blobs), Cursor: page.NextMarker}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list Azure Blob Storage container: %w", err)
+	}
+	return res, nil
+}
+
+func (a *azureAuditLogStore) get(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := a.do(ctx, a.container+"/"+url.PathEscape(a.prefix+name)+"?"+a.sasToken)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// newAuditLogStore returns the audit log store matching the open params, which
+// are either s3://<bucket>/<prefix> or azblob://<account>/<container>/<prefix>
+func (p *Plugin) newAuditLogStore(params string) (auditLogStore, error) {
+	u, err := url.Parse(params)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "s3":
+		return newS3AuditLogStore(u, p.config.AuditLogAWSRegion)
+	case "azblob":
+		sasToken, err := readToken(p.config.SecretsDir, "GITHUB_PLUGIN_AZURE_SAS_TOKEN", "azure.sas.token")
+		if err != nil {
+			return nil, err
+		}
+		return newAzureAuditLogStore(u, sasToken)
+	}
+	return nil, errkind.Errorf(errkind.Config, "[%s] audit log scheme %s is not supported", PluginName, u.Scheme)
+}
+
+// isAuditLogParams returns true if the open params point to the storage of
+// a GitHub Enterprise audit log stream instead of listing repositories
+func isAuditLogParams(params string) bool {
+	return strings.HasPrefix(params, "s3://") || strings.HasPrefix(params, "azblob://")
+}
+
+// isAuditLogFatal returns true if an error of the audit log store can't be
+// solved by retrying, such as a missing bucket or invalid credentials
+func isAuditLogFatal(err error) bool {
+	kind := errkind.Of(err)
+	return kind == errkind.Config || kind == errkind.Auth
+}
+
+// openAuditLog opens an event stream reading the audit log streamed by GitHub
+// Enterprise to a storage
+func (p *Plugin) openAuditLog(params string) (source.Instance, error) {
+	store, err := p.newAuditLogStore(strings.TrimSpace(params))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	evtC := make(chan source.PushEvent)
+	interval := time.Duration(p.config.AuditLogInterval) * time.Second
+	tracker := p.healthServer.Track()
+	go func() {
+		defer close(evtC)
+		readAuditLog(ctx, store, interval, evtC, tracker, p.metrics)
+	}()
+
+	return source.NewPushInstance(
+		evtC,
+		source.WithInstanceContext(ctx),
+		source.WithInstanceClose(func() {
+			cancel()
+			tracker.Close()
+		}),
+	)
+}
+
+// isAuditLogLayout returns true if the names of the files listed from a store
+// are in the hour directories where GitHub streams the audit log
+func isAuditLogLayout(names []string) bool {
+	for _, name := range names {
+		if len(name) < len(auditLogLayout) {
+			return false
+		}
+		if _, err := time.Parse(auditLogLayout, name[:len(auditLogLayout)]); err != nil {
+			return false
+		}
+	}
+	return len(names) > 0
+}
+
+// listAuditLog lists the files of a store. The whole store is listed until
+// its files are known to be in the hour directories of GitHub, and then only
+// the hour directories where files can still be uploaded since the last
+// listing, so that the late files are found without listing the whole store.
+func listAuditLog(ctx context.Context, store auditLogStore, listed, now time.Time) ([]string, error) {
+	if listed.IsZero() {
+		return store.list(ctx, "")
+	}
+	var res []string
+	for h := listed.Add(-auditLogLateness).Truncate(time.Hour); !h.After(now); h = h.Add(time.Hour) {
+		names, err := store.list(ctx, h.UTC().Format(auditLogLayout))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, names...)
+	}
+	return res, nil
+}
+
+// readAuditLog sends the events of the audit log files of a store until ctx
+// is canceled. The files already present are read first, then the store is
+// polled for new files at each interval. The files are read in lexicographic
+// order, and the files read are remembered as long as they are listed, so
+// that the files uploaded late are read when they appear. The transient
+// errors of the store are retried at the next poll, from the line where the
+// reading stopped, and only the configuration and authentication errors end
+// the reading.
+func readAuditLog(ctx context.Context, store auditLogStore, interval time.Duration, evtC chan<- source.PushEvent, tracker *health.Tracker, m *metrics.Metrics) {
+	// failed reports an error of the store, and returns true if the
+	// reading must be ended
+	failed := func(err error) bool {
+		if ctx.Err() != nil {
+			return true
+		}
+		tracker.Error()
+		m.UpstreamError()
+		err = errkind.Count(err, m)
+		if !isAuditLogFatal(err) {
+			log.Printf("[%s] %s, retrying at the next poll\n", PluginName, err.Error())
+			return false
+		}
+		tracker.SetConnected(false)
+		select {
+		case evtC <- source.PushEvent{Err: err}:
+		case <-ctx.Done():
+		}
+		return true
+	}
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	var listed time.Time      // time of the last listing of the hour directories
+	seen := map[string]bool{} // files read, until they are no longer listed
+	resume := ""              // file that failed to be read
+	skip := 0                 // lines of the resumed file already sent
+	retries := 0              // polls that failed to read the resumed file
+	for {
+		now := time.Now()
+		names, err := listAuditLog(ctx, store, listed, now)
+		if err != nil && failed(err) {
+			return
+		}
+		if err == nil {
+			tracker.SetConnected(true)
+			if !listed.IsZero() || isAuditLogLayout(names) {
+				listed = now
+			}
+			listing := make(map[string]bool, len(names))
+			for _, name := range names {
+				listing[name] = true
+			}
+			for name := range seen {
+				if !listing[name] {
+					delete(seen, name)
+				}
+			}
+		}
+		for _, name := range names {
+			if seen[name] {
+				continue
+			}
+			lines, failures := 0, 0
+			if name == resume {
+				lines, failures = skip, retries
+			}
+			n, err := pushAuditLogFile(ctx, store, name, lines, evtC, m)
+			if ctx.Err() != nil {
+				return
+			}
+			// a corrupted file is skipped, since reading it again would
+			// fail the same way, and so is a file failing at each poll
+			if err != nil && errkind.Of(err) != errkind.Parse && (failures < auditLogMaxRetries || isAuditLogFatal(err)) {
+				if failed(err) {
+					return
+				}
+				resume, skip, retries = name, n, failures+1
+				break
+			}
+			if err != nil {
+				log.Printf("[%s] skipping the rest of audit log file %s: %s\n", PluginName, name, errkind.Count(err, m).Error())
+			}
+			tracker.Event()
+			seen[name] = true
+			if name == resume {
+				resume, skip, retries = "", 0, 0
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			timer.Reset(interval)
+		}
+	}
+}
+
+// pushAuditLogFile reads an audit log file, which is gzipped or not, and
+// sends each of the JSON lines it contains as an event, after skipping the
+// given number of lines already sent. Only the invalid lines are skipped, to
+// not stop the whole stream on a malformed entry. The events sent are
+// recorded in the given metrics, if any. The number of lines read is returned
+// along with the error, so that the reading can be resumed, and the errors of
+// a corrupted file are reported as parse errors.
+func pushAuditLogFile(ctx context.Context, store auditLogStore, name string, skip int, c chan<- source.PushEvent, m *metrics.Metrics) (int, error) {
+	body, err := store.get(ctx, name)
+	if err != nil {
+		return skip, err
+	}
+	defer body.Close()
+
+	// detect compression from the content, since the file extensions
+	// don't always reflect it
+	reader := bufio.NewReader(body)
+	var r io.Reader = reader
+	if magic, err := reader.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return skip, auditLogFileError(err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var jparser fastjson.Parser
+	var arena fastjson.Arena
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), auditLogMaxLineSize)
+	lines := 0
+	for scanner.Scan() {
+		lines++
+		if lines <= skip {
+			continue
+		}
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		jdata, err := jparser.ParseBytes(line)
+		if err != nil {
+			log.Printf("[%s] skipping invalid audit log entry in %s: %s\n", PluginName, name, err.Error())
+			continue
+		}
+
+		// timestamps are in milliseconds since epoch
+		ts := jdata.GetInt64("@timestamp")
+		if ts == 0 {
+			ts = jdata.GetInt64("created_at")
+		}
+		timestamp := time.Now()
+		if ts > 0 {
+			timestamp = time.UnixMilli(ts)
+		}
+
+		jdata.Set("webhook_type", arena.NewString(auditLogType))
+		data := jdata.MarshalTo(nil)
+		arena.Reset()
+		select {
+		case c <- source.PushEvent{Data: data, Timestamp: timestamp}:
+			m.Ingested(len(data), timestamp)
+		case <-ctx.Done():
+			return lines, nil
+		}
+	}
+	if lines < skip {
+		lines = skip
+	}
+	return lines, auditLogFileError(scanner.Err())
+}
+
+// auditLogFileError categorizes the errors of a corrupted audit log file as
+// parse errors, and leaves the other read errors as they are
+func auditLogFileError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, bufio.ErrTooLong), errors.Is(err, gzip.ErrHeader), errors.Is(err, gzip.ErrChecksum):
+		return errkind.New(errkind.Parse, err)
+	}
+	return err
+}
@@ -0,0 +1,382 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/health"
+)
+
+// failingReader returns an error after reading the content of a file
+type failingReader struct {
+	io.Reader
+	err error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.Reader.Read(p)
+	if err == io.EOF {
+		err = f.err
+	}
+	return n, err
+}
+
+// fakeAuditLogStore is an in-memory store whose calls can be made to fail
+type fakeAuditLogStore struct {
+	mu      sync.Mutex
+	files   map[string]string
+	listErr []error // returned by the next calls to list
+	getErr  []error // returned while reading the next files
+	listed  []string
+}
+
+func (s *fakeAuditLogStore) list(ctx context.Context, prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listed = append(s.listed, prefix)
+	if len(s.listErr) > 0 {
+		err := s.listErr[0]
+		s.listErr = s.listErr[1:]
+		return nil, err
+	}
+	var res []string
+	for name := range s.files {
+		if strings.HasPrefix(name, prefix) {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (s *fakeAuditLogStore) get(ctx context.Context, name string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.getErr) > 0 {
+		err := s.getErr[0]
+		s.getErr = s.getErr[1:]
+		// the first line is read before the error
+		first := strings.SplitAfterN(s.files[name], "\n", 2)[0]
+		return ioutil.NopCloser(&failingReader{Reader: strings.NewReader(first), err: err}), nil
+	}
+	return ioutil.NopCloser(strings.NewReader(s.files[name])), nil
+}
+
+func (s *fakeAuditLogStore) add(name, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = content
+}
+
+// prefixes returns the prefixes listed so far
+func (s *fakeAuditLogStore) prefixes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.listed...)
+}
+
+// readAuditLogEvents runs readAuditLog until n events or an error are
+// received, and returns the actions of the events
+func readAuditLogEvents(t *testing.T, store auditLogStore, n int) ([]string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	evtC := make(chan source.PushEvent)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		readAuditLog(ctx, store, 10*time.Millisecond, evtC, (*health.Server)(nil).Track(), nil)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	var actions []string
+	timeout := time.After(5 * time.Second)
+	for len(actions) < n {
+		select {
+		case evt := <-evtC:
+			if evt.Err != nil {
+				return actions, evt.Err
+			}
+			action := string(evt.Data)
+			action = action[strings.Index(action, `"action":"`)+10:]
+			actions = append(actions, action[:strings.Index(action, `"`)])
+		case <-timeout:
+			t.Fatalf("timed out after %d events", len(actions))
+		}
+	}
+	return actions, nil
+}
+
+func TestReadAuditLogRetry(t *testing.T) {
+	store := &fakeAuditLogStore{
+		files: map[string]string{
+			"1.json": "{\"action\":\"a\"}\n{\"action\":\"b\"}\n",
+			"2.json": "{\"action\":\"c\"}\n",
+		},
+		listErr: []error{errkind.Errorf(errkind.Unavailable, "list failed")},
+		getErr:  []error{errors.New("connection reset")},
+	}
+	actions, err := readAuditLogEvents(t, store, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the file is resumed after the lines already sent
+	if strings.Join(actions, ",") != "a,b,c" {
+		t.Errorf("expected events a,b,c, got %v", actions)
+	}
+}
+
+func TestReadAuditLogPoll(t *testing.T) {
+	store := &fakeAuditLogStore{files: map[string]string{"1.json": "{\"action\":\"a\"}\n"}}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		store.add("2.json", "not json\n{\"action\":\"b\"}\n")
+	}()
+	actions, err := readAuditLogEvents(t, store, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(actions, ",") != "a,b" {
+		t.Errorf("expected events a,b, got %v", actions)
+	}
+}
+
+func TestReadAuditLogFatal(t *testing.T) {
+	store := &fakeAuditLogStore{
+		files:   map[string]string{"1.json": "{\"action\":\"a\"}\n"},
+		listErr: []error{errkind.Errorf(errkind.Auth, "access denied")},
+	}
+	if _, err := readAuditLogEvents(t, store, 1); errkind.Of(err) != errkind.Auth {
+		t.Errorf("expected an auth error, got %v", err)
+	}
+}
+
+func TestReadAuditLogLate(t *testing.T) {
+	// the files of the current hour directory, the first one being uploaded
+	// after the second one was read
+	hour := time.Now().UTC().Format(auditLogLayout)
+	store := &fakeAuditLogStore{files: map[string]string{hour + "2.json.gz": "{\"action\":\"b\"}\n"}}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		store.add(hour+"1.json.gz", "{\"action\":\"a\"}\n")
+	}()
+	actions, err := readAuditLogEvents(t, store, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(actions, ",") != "b,a" {
+		t.Errorf("expected events b,a, got %v", actions)
+	}
+
+	// the whole store is listed first, and then only the recent hour
+	// directories
+	prefixes := store.prefixes()
+	if len(prefixes) < 2 || prefixes[0] != "" {
+		t.Fatalf("expected the whole store to be listed first, got %q", prefixes)
+	}
+	for _, prefix := range prefixes[1:] {
+		h, err := time.Parse(auditLogLayout, prefix)
+		if err != nil || time.Since(h) > auditLogLateness+2*time.Hour {
+			t.Errorf("expected a recent hour directory to be listed, got %q", prefix)
+		}
+	}
+}
+
+func TestListAuditLog(t *testing.T) {
+	store := &fakeAuditLogStore{files: map[string]string{
+		"2024/01/01/07/a.json.gz": "",
+		"2024/01/01/08/a.json.gz": "",
+		"2024/01/01/08/b.json.gz": "",
+		"2024/01/01/12/a.json.gz": "",
+	}}
+	now := time.Date(2024, 1, 1, 12, 5, 0, 0, time.UTC)
+	names, err := listAuditLog(context.Background(), store, time.Time{}, now)
+	if err != nil || len(names) != 4 || store.prefixes()[0] != "" {
+		t.Errorf("expected the whole store to be listed, got %v (%v)", names, err)
+	}
+
+	// the hour directories are listed from the lateness before the last
+	// listing until now, in order
+	store.listed = nil
+	listed := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	names, err = listAuditLog(context.Background(), store, listed, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "2024/01/01/08/a.json.gz,2024/01/01/08/b.json.gz,2024/01/01/12/a.json.gz" {
+		t.Errorf("unexpected files %v", names)
+	}
+	expected := "2024/01/01/08/,2024/01/01/09/,2024/01/01/10/,2024/01/01/11/,2024/01/01/12/"
+	if prefixes := strings.Join(store.prefixes(), ","); prefixes != expected {
+		t.Errorf("expected the prefixes %s, got %s", expected, prefixes)
+	}
+
+	store.listErr = []error{errors.New("list failed")}
+	if _, err := listAuditLog(context.Background(), store, listed, now); err == nil {
+		t.Error("expected the listing to fail")
+	}
+}
+
+func TestIsAuditLogLayout(t *testing.T) {
+	tests := []struct {
+		names    []string
+		expected bool
+	}{
+		{[]string{"2024/01/01/00/a.json.gz", "2024/12/31/23/b.json.gz"}, true},
+		{[]string{"2024/01/01/00/a.json.gz", "other/b.json.gz"}, false},
+		{[]string{"2024/01/01/24/a.json.gz"}, false},
+		{[]string{"2024/01/01"}, false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if res := isAuditLogLayout(test.names); res != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.names, test.expected, res)
+		}
+	}
+}
+
+func TestS3AuditLogStore(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/bucket" && r.URL.Query().Get("list-type") == "2":
+			if prefix := r.URL.Query().Get("prefix"); prefix != "audit/2024/01/01/10/" {
+				t.Errorf("unexpected prefix %s", prefix)
+			}
+			// the listing is paginated
+			if r.URL.Query().Get("continuation-token") == "" {
+				fmt.Fprint(w, `<ListBucketResult><IsTruncated>true</IsTruncated><NextContinuationToken>next</NextContinuationToken>`+
+					`<Contents><Key>audit/2024/01/01/10/a.json.gz</Key></Contents></ListBucketResult>`)
+				return
+			}
+			fmt.Fprint(w, `<ListBucketResult><IsTruncated>false</IsTruncated>`+
+				`<Contents><Key>audit/2024/01/01/10/b.json.gz</Key></Contents></ListBucketResult>`)
+		case r.URL.Path == "/bucket/audit/2024/01/01/10/a.json.gz":
+			fmt.Fprint(w, "content")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	store := &s3AuditLogStore{
+		client: s3.New(s3.Options{
+			Region:       "us-east-1",
+			BaseEndpoint: awssdk.String(srv.URL),
+			UsePathStyle: true,
+			Credentials:  awssdk.AnonymousCredentials{},
+			HTTPClient:   srv.Client(),
+		}),
+		bucket: "bucket",
+		prefix: auditLogPrefix("audit"),
+	}
+	names, err := store.list(context.Background(), "2024/01/01/10/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "2024/01/01/10/a.json.gz,2024/01/01/10/b.json.gz" {
+		t.Errorf("expected the names relative to the prefix, got %v", names)
+	}
+	body, err := store.get(context.Background(), names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	if b, _ := ioutil.ReadAll(body); string(b) != "content" {
+		t.Errorf("unexpected content %s", b)
+	}
+}
+
+func TestAzureAuditLogStore(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("sig") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch {
+		case r.URL.Path == "/container" && r.URL.Query().Get("comp") == "list":
+			if prefix := r.URL.Query().Get("prefix"); prefix != "audit/2024/01/01/10/" {
+				t.Errorf("unexpected prefix %s", prefix)
+			}
+			// the listing is paginated
+			if r.URL.Query().Get("marker") == "" {
+				fmt.Fprint(w, `<EnumerationResults><Blobs><Blob><Name>audit/2024/01/01/10/a.json.gz</Name></Blob></Blobs>`+
+					`<NextMarker>next</NextMarker></EnumerationResults>`)
+				return
+			}
+			fmt.Fprint(w, `<EnumerationResults><Blobs><Blob><Name>audit/2024/01/01/10/b.json.gz</Name></Blob></Blobs>`+
+				`<NextMarker></NextMarker></EnumerationResults>`)
+		case r.URL.Path == "/container/audit/2024/01/01/10/a.json.gz":
+			fmt.Fprint(w, "content")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse("azblob://account/container/audit")
+	store, err := newAzureAuditLogStore(u, "?sig=token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.container != "https://account.blob.core.windows.net/container" || store.prefix != "audit/" {
+		t.Errorf("unexpected store %s %s", store.container, store.prefix)
+	}
+	store.client = srv.Client()
+	store.container = srv.URL + "/container"
+
+	names, err := store.list(context.Background(), "2024/01/01/10/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "2024/01/01/10/a.json.gz,2024/01/01/10/b.json.gz" {
+		t.Errorf("expected the names relative to the prefix, got %v", names)
+	}
+	body, err := store.get(context.Background(), names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	if b, _ := ioutil.ReadAll(body); string(b) != "content" {
+		t.Errorf("unexpected content %s", b)
+	}
+
+	// the authentication errors are reported as such
+	store.sasToken = "sig=other"
+	if _, err := store.list(context.Background(), ""); !isAuditLogFatal(err) {
+		t.Errorf("expected a fatal error, got %v", err)
+	}
+}
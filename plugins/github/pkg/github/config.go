@@ -20,15 +20,37 @@ package github
 import (
 	"os"
 	"path/filepath"
+
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/httpclient"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	"github.com/falcosecurity/plugins/shared/go/webhook/queue"
 )
 
 // PluginConfig represents a configuration of the GitHub plugin
 type PluginConfig struct {
-	Token              string `json:"token" jsonschema:"title=Personal access token,description=The GitHub personal access token to use. You can create a token at this page: https://github.com/settings/tokens. The token needs full repo scope."`
-	WebsocketServerURL string `json:"websocketServerURL" jsonschema:"title=WebSocket server URL,description=The URL of the server where the plugin will run, i.e. the public accessible address of this machine."`
-	SecretsDir         string `json:"secretsDir" jsonschema:"title=Secrets directory,description=The directory where the secrets required by the plugin are stored. Unless the github token is provided by environment variable, it must be stored in a file named github.token in this directory. In addition, when the webhook server uses HTTPs, server.key and server.crt must be in this directory too. (Default: ~/.ghplugin),default=~/.ghplugin"`
-	UseHTTPs           bool   `json:"useHTTPs" jsonschema:"title=Use HTTPS,description=if this parameter is set to true, then the webhook webserver listening at WebsocketServerURL will use HTTPS. In that case, server.key and server.crt must be present in the secrets directory, or the plugin will fail to load. If the parameter is set to false, the webhook webserver will be plain HTTP. Use HTTP only for testing or when the plugin is behind a proxy that handles encryption."`
-	UseAsync           bool   `json:"useAsync" jsonschema:"title=Use async extraction,description=If true then async extraction optimization is enabled. (Default: false),default=false"`
+	Token              string              `json:"token" secret:"true" jsonschema:"title=Personal access token,description=The GitHub personal access token to use. You can create a token at this page: https://github.com/settings/tokens. The token needs full repo scope.,writeOnly=true"`
+	WebsocketServerURL string              `json:"websocketServerURL" jsonschema:"title=WebSocket server URL,description=The URL of the server where the plugin will run, i.e. the public accessible address of this machine."`
+	SecretsDir         string              `json:"secretsDir" jsonschema:"title=Secrets directory,description=The directory where the secrets required by the plugin are stored. Unless the github token is provided by environment variable, it must be stored in a file named github.token in this directory. In addition, when the webhook server uses HTTPs, server.key and server.crt must be in this directory too. (Default: ~/.ghplugin),default=~/.ghplugin"`
+	UseHTTPs           bool                `json:"useHTTPs" jsonschema:"title=Use HTTPS,description=if this parameter is set to true, then the webhook webserver listening at WebsocketServerURL will use HTTPS. In that case, server.key and server.crt must be present in the secrets directory, or the plugin will fail to load. If the parameter is set to false, the webhook webserver will be plain HTTP. Use HTTP only for testing or when the plugin is behind a proxy that handles encryption."`
+	UseAsync           bool                `json:"useAsync" jsonschema:"title=Use async extraction,description=If true then async extraction optimization is enabled. (Default: true),default=true"`
+	WebhookSecrets     []string            `json:"webhookSecrets" secret:"true" reload:"true" jsonschema:"title=Webhook secrets,description=List of secrets accepted when verifying the signature of the webhook messages. The first one is used when installing the webhooks. Useful to rotate the secrets without losing messages. If empty a random secret is generated at each start. (Default: empty),writeOnly=true"`
+	FetchDiffs         bool                `json:"fetchDiffs" jsonschema:"title=Fetch diffs,description=If true then the diff of each push is fetched from the GitHub API and scanned for committed secrets. The diffs are fetched with the token stored in github.diff.token in the secrets directory or in the GITHUB_PLUGIN_DIFF_TOKEN environment variable if any and with the main token otherwise. (Default: true),default=true"`
+	AppID              int64               `json:"appID" jsonschema:"title=GitHub App ID,description=The ID of the GitHub App to authenticate as instead of using a personal access token. (Default: 0 for no App),default=0"`
+	AppInstallationID  int64               `json:"appInstallationID" jsonschema:"title=GitHub App installation ID,description=The ID of the installation of the GitHub App in the organization or account to monitor. Required when appID is set."`
+	AppPrivateKeyFile  string              `json:"appPrivateKeyFile" jsonschema:"title=GitHub App private key file,description=The path of the PEM encoded private key of the GitHub App. (Default: github.app.pem in the secrets directory)"`
+	AuditLogInterval   uint64              `json:"auditLogInterval" jsonschema:"title=Audit log polling interval,description=When reading the audit log streamed by GitHub Enterprise to a storage this is the delay in seconds between two listings of the new files. (Default: 60),default=60"`
+	AuditLogAWSRegion  string              `json:"auditLogAWSRegion" jsonschema:"title=Audit log AWS region,description=When reading the audit log streamed by GitHub Enterprise to AWS S3 this overrides the AWS region of the environment. (Default: empty)"`
+	WebhookQueueSize   uint64              `json:"webhookQueueSize" jsonschema:"title=Webhook queue size,description=Maximum number of webhook messages waiting to be consumed. (Default: 128),default=128,minimum=1"`
+	WebhookOverflow    string              `json:"webhookOverflow" jsonschema:"title=Webhook queue overflow policy,enum=block,enum=drop_oldest,enum=reject,description=What to do with the incoming webhook messages when the queue is full: block waits for room and drop_oldest drops the oldest queued message while reject answers with 429 Too Many Requests. (Default: block),default=block"`
+	OrgWebhookSecrets  map[string][]string `json:"orgWebhookSecrets" secret:"true" reload:"true" jsonschema:"title=Per-organization webhook secrets,description=Lists of secrets accepted when verifying the signature of the webhook messages indexed by organization or owner name. They take precedence over webhookSecrets for the repositories of that organization. (Default: empty),writeOnly=true"`
+	DebugAddress       string              `json:"debugAddress" jsonschema:"title=Debug address,description=Loopback address (e.g. localhost:6060) of an HTTP server exposing the pprof and expvar endpoints of the plugin. (Default: empty for disabled)"`
+	HealthAddress      string              `json:"healthAddress" jsonschema:"title=Health address,description=Address (e.g. :8081) of an HTTP server exposing the health and readiness endpoints of the plugin. (Default: empty for disabled)"`
+	HealthPath         string              `json:"healthPath" jsonschema:"title=Health path,description=Path of the health endpoint. The readiness endpoint is served under <path>/ready. (Default: /healthz),default=/healthz"`
+	MetricsAddress     string              `json:"metricsAddress" jsonschema:"title=Metrics address,description=Address (e.g. :9090) of the Prometheus endpoint shared by the plugins of the Falco process configured with the same address. (Default: empty for disabled)"`
+	MetricsPath        string              `json:"metricsPath" jsonschema:"title=Metrics path,description=Path of the Prometheus endpoint. (Default: /metrics),default=/metrics"`
+	HTTP               httpclient.Config   `json:"http" jsonschema:"title=HTTP client,description=Proxy and TLS and timeout and retries of the calls to the GitHub API"`
+	ReloadFile         string              `json:"reloadFile" jsonschema:"title=Reload file,description=Path of a json file holding the settings applied again at runtime each time it changes: webhookSecrets and orgWebhookSecrets. The secrets the webhooks were installed with remain accepted. (Default: empty for disabled)"`
 }
 
 // Reset sets the configuration to its default values
@@ -36,5 +58,12 @@ func (p *PluginConfig) Reset() {
 	homeDir, _ := os.UserHomeDir()
 	p.SecretsDir = filepath.Join(homeDir, ".ghplugin")
 	p.UseHTTPs = true
-	p.UseAsync = false
+	p.UseAsync = true
+	p.FetchDiffs = true
+	p.AuditLogInterval = 60
+	p.WebhookQueueSize = 128
+	p.WebhookOverflow = string(queue.PolicyBlock)
+	p.HealthPath = health.DefaultPath
+	p.MetricsPath = metrics.DefaultPath
+	p.HTTP.Reset()
 }
@@ -19,15 +19,17 @@ package github
 
 import (
 	"fmt"
-	"io/ioutil"
+	"time"
 
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugins/shared/go/tenant"
+	"github.com/falcosecurity/plugins/shared/go/webhook/cloudevents"
 	"github.com/valyala/fastjson"
 )
 
 // Return the fields supported for extraction.
 func (p *Plugin) Fields() []sdk.FieldEntry {
-	return []sdk.FieldEntry{
+	return append([]sdk.FieldEntry{
 		{Type: "string", Name: "github.type", Display: "Message Type", Desc: "Message type, e.g. 'star' or 'repository'."},
 		{Type: "string", Name: "github.action", Display: "Action Type", Desc: "The github event action. This field typically qualifies the github.type field. For example, a message of type 'star' can have action 'created' or 'deleted'."},
 		{Type: "string", Name: "github.user", Display: "User", Desc: "Name of the user that triggered the event."},
@@ -45,10 +47,20 @@ func (p *Plugin) Fields() []sdk.FieldEntry {
 		{Type: "string", Name: "github.diff.committed_secrets.files", Display: "Secret Files", Desc: "For push messages, if one of the commits includes one or more secrets (AWS keys, github tokens...), this field contains the names of the files in which each of the secrets was committed, as a comma separated list."},
 		{Type: "string", Name: "github.diff.committed_secrets.lines", Display: "Secret Lines", Desc: "For push messages, if one of the commits includes one or more secrets (AWS keys, github tokens...), this field contains the file line positions of the committed secrets, as a comma separated list."},
 		{Type: "string", Name: "github.diff.committed_secrets.links", Display: "Secret Links", Desc: "For push messages, if one of the commits includes one or more secrets (AWS keys, github tokens...), this field contains the github source code link for each of the committed secrets, as a comma separated list."},
+		{Type: "string", Name: "github.diff.has_secret", Display: "Contains Secret", Desc: "For push messages, 'true' if the diff of one of the commits contains a secret, 'false' otherwise. Not available if the diffs are not fetched (see the fetchDiffs init parameter)."},
+		{Type: "string", Name: "github.diff.secret.type", IsList: true, Display: "Secret Types", Desc: "For push messages, the list of the types of the secrets committed in the diff of the commits (e.g. aws_access_key, github_personal_access_token)."},
+		{Type: "string", Name: "github.diff.file", IsList: true, Display: "Diff Files", Desc: "For push messages, the list of the files changed in the diff of the commits."},
 		{Type: "string", Name: "github.workflow.has_miners", Display: "Workflow Has Miner", Desc: "For workflow_run messages, 'true' if the a miner has been detected in the workflow definition file."},
 		{Type: "string", Name: "github.workflow.miners.type", Display: "Workflow Miner Type", Desc: "For workflow_run messages, if one or more miners is detected in the workflow definition file, this field contains the type of each of the detected miner, as a comma separated list (e.g. xmrig, stratum)."},
 		{Type: "string", Name: "github.workflow.filename", Display: "Workflow File", Desc: "For workflow_run messages, the name of the workflow definition file."},
-	}
+		{Type: "string", Name: "github.audit.actor", Display: "Audit Actor", Desc: "For audit_log messages, the user that performed the action."},
+		{Type: "string", Name: "github.audit.actor_ip", Display: "Audit Actor IP", Desc: "For audit_log messages, the IP address of the user that performed the action."},
+		{Type: "string", Name: "github.audit.org", Display: "Audit Organization", Desc: "For audit_log messages, the organization affected by the action."},
+		{Type: "string", Name: "github.audit.repo", Display: "Audit Repository", Desc: "For audit_log messages, the repository affected by the action, e.g. 'falcosecurity/falco'."},
+		{Type: "string", Name: "github.remote_addr", Display: "Remote Address", Desc: "For signature_verification_failed messages, the address of the client that sent the message whose signature could not be verified."},
+		{Type: "string", Name: "github.delivery.type", Display: "Delivery Type", Desc: "For signature_verification_failed messages, the type of the message whose signature could not be verified, e.g. 'push'."},
+		{Type: "string", Name: "github.tenant", Display: "Tenant", Desc: "Name of the tenant whose repository the message comes from, for the instances opened with a list of tenants."},
+	}, cloudevents.Fields()...)
 }
 
 func getMatchField(jdata *fastjson.Value, matchField string, fType string) (bool, string) {
@@ -150,7 +162,7 @@ func getfieldStr(jdata *fastjson.Value, field string) (bool, string) {
 				res = res[0 : len(res)-1]
 			}
 		}
-	case "github.diff.has_secrets":
+	case "github.diff.has_secrets", "github.diff.has_secret":
 		flist := jdata.GetArray("files")
 		if flist == nil {
 			break
@@ -207,6 +219,24 @@ func getfieldStr(jdata *fastjson.Value, field string) (bool, string) {
 		return getMinerTypes(jdata)
 	case "github.workflow.filename":
 		res = string(jdata.Get("workflow", "path").GetStringBytes())
+	case "github.audit.actor":
+		res = string(jdata.GetStringBytes("actor"))
+	case "github.audit.actor_ip":
+		res = string(jdata.GetStringBytes("actor_ip"))
+	case "github.audit.org":
+		res = string(jdata.GetStringBytes("org"))
+	case "github.audit.repo":
+		res = string(jdata.GetStringBytes("repo"))
+	case "github.remote_addr":
+		res = string(jdata.GetStringBytes("remote_addr"))
+	case "github.delivery.type":
+		res = string(jdata.Get("delivery", "type").GetStringBytes())
+	case "github.tenant":
+		name := jdata.GetStringBytes(tenant.Key)
+		if name == nil {
+			return false, ""
+		}
+		res = string(name)
 	default:
 		return false, ""
 	}
@@ -214,28 +244,61 @@ func getfieldStr(jdata *fastjson.Value, field string) (bool, string) {
 	return true, res
 }
 
+func getfieldList(jdata *fastjson.Value, field string) (bool, []string) {
+	flist := jdata.GetArray("files")
+	if flist == nil {
+		return false, nil
+	}
+
+	res := []string{}
+	switch field {
+	case "github.diff.secret.type":
+		types := map[string]bool{}
+		for _, file := range flist {
+			for _, cinfo := range file.GetArray("matches") {
+				t := string(cinfo.Get("desc").GetStringBytes())
+				if !types[t] {
+					types[t] = true
+					res = append(res, t)
+				}
+			}
+		}
+	case "github.diff.file":
+		for _, file := range flist {
+			res = append(res, string(file.Get("name").GetStringBytes()))
+		}
+	default:
+		return false, nil
+	}
+
+	return true, res
+}
+
 // Extract a field value from an event.
 func (p *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
+	if p.metrics != nil {
+		defer p.metrics.ObserveExtraction(time.Now())
+	}
 	// Decode the json, but only if we haven't done it yet for this event
-	if evt.EventNum() != p.jdataEvtnum {
-		// Read the event data
-		data, err := ioutil.ReadAll(evt.Reader())
-		if err != nil {
-			return err
-		}
-
-		// For this plugin, events are always strings
-		evtStr := string(data)
+	var err error
+	p.jdata, err = p.jcache.Get(evt.EventNum(), evt.Reader())
+	if err != nil {
+		// Not a json file, so not present.
+		return err
+	}
 
-		p.jdata, err = p.jparser.Parse(evtStr)
-		if err != nil {
-			// Not a json file, so not present.
-			return err
+	// Extract the field value
+	if cloudevents.IsField(req.Field()) {
+		return cloudevents.Extract(req, p.jdata)
+	}
+	if req.IsList() {
+		present, values := getfieldList(p.jdata, req.Field())
+		if present {
+			req.SetValue(values)
 		}
-		p.jdataEvtnum = evt.EventNum()
+		return nil
 	}
 
-	// Extract the field value
 	present, value := getfieldStr(p.jdata, req.Field())
 	if present {
 		req.SetValue(value)
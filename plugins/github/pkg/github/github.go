@@ -20,15 +20,25 @@ package github
 import (
 	"context"
 	"encoding/json"
-	"math"
+	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"sync/atomic"
 
 	"github.com/alecthomas/jsonschema"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/symbols/extract"
+	"github.com/falcosecurity/plugins/shared/go/batch"
+	"github.com/falcosecurity/plugins/shared/go/debugserver"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/jsoncache"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	"github.com/falcosecurity/plugins/shared/go/reload"
+	"github.com/falcosecurity/plugins/shared/go/secrets"
+	"github.com/falcosecurity/plugins/shared/go/webhook/queue"
 	"github.com/google/go-github/github"
 	"github.com/valyala/fastjson"
 	"golang.org/x/oauth2"
@@ -79,13 +89,29 @@ type githubHookInfo struct {
 	id    int64
 }
 
+// githubTenant is one of the tenants listed in the open parameters, whose
+// repositories are accessed with their own token
+type githubTenant struct {
+	Name  string `json:"name"`
+	Token string `json:"token" secret:"true"`
+	Repos string `json:"repos"`
+
+	tc     *http.Client
+	client *github.Client
+}
+
 // Plugin represent the GithHub plugin
 type Plugin struct {
 	plugins.BasePlugin
-	jparser     fastjson.Parser
-	jdata       *fastjson.Value
-	jdataEvtnum uint64 // The event number jdata refers to. Used to know when we can skip the unmarshaling.
-	config      PluginConfig
+	jcache jsoncache.Cache // Caches the json of the last event, so that it's parsed once for all the extractions.
+	jdata  *fastjson.Value
+	config PluginConfig
+
+	debugServer  *debugserver.Server
+	healthServer *health.Server
+	metrics      *metrics.Metrics
+	reloaded     atomic.Value // Holds the *PluginConfig with the reloaded settings.
+	reloader     *reload.Watcher
 }
 
 // PluginInstance represents an opened instance of the plugin,
@@ -94,11 +120,23 @@ type PluginInstance struct {
 	source.BaseInstance
 	whURL          string
 	whSrv          *http.Server
-	whSrvChan      chan []byte
+	whQueue        *queue.Queue
+	whErrC         chan []byte
+	sigFailures    sigFailures
+	whPending      []byte
 	whSecret       string
+	whOrgSecrets   map[string][]string
+	whConfig       *atomic.Value
 	ghOauth        oauthContext
 	installedHooks []githubHookInfo
+	tenants        map[string]*githubTenant // by repository owner
 	ghClient       *github.Client
+	ghDiffClient   *http.Client
+	fetchDiffs     bool
+	isApp          bool
+	batchSizer     batch.Sizer
+	tracker        *health.Tracker
+	metrics        *metrics.Metrics
 }
 
 // Return the plugin info to the framework.
@@ -120,7 +158,16 @@ func (p *Plugin) InitSchema() *sdk.SchemaInfo {
 		AllowAdditionalProperties:  true, // unrecognized properties don't cause a parsing failures
 	}
 
-	if schema, err := reflector.Reflect(&PluginConfig{}).MarshalJSON(); err == nil {
+	// the writeOnly tag is only supported for strings, so the lists of
+	// secrets are marked here
+	s := reflector.Reflect(&PluginConfig{})
+	for _, name := range []string{"webhookSecrets", "orgWebhookSecrets"} {
+		if prop, ok := s.Definitions["PluginConfig"].Properties.Get(name); ok {
+			prop.(*jsonschema.Type).WriteOnly = true
+		}
+	}
+
+	if schema, err := s.MarshalJSON(); err == nil {
 		return &sdk.SchemaInfo{
 			Schema: string(schema),
 		}
@@ -130,15 +177,18 @@ func (p *Plugin) InitSchema() *sdk.SchemaInfo {
 }
 
 // Initialize the plugin state.
-func (p *Plugin) Init(cfg string) error {
-	// initialize state
-	p.jdataEvtnum = math.MaxUint64
-
+func (p *Plugin) Init(cfg string) (err error) {
 	// Set config default values and read the passed one, if available.
 	// Since we provide a schema through InitSchema(), the framework
 	// guarantees that the config is always well-formed json.
 	p.config.Reset()
 	json.Unmarshal([]byte(cfg), &p.config)
+	if err := secrets.Resolve(&p.config); err != nil {
+		return err
+	}
+	if p.config.WebhookQueueSize < 1 {
+		return fmt.Errorf("[%s] webhookQueueSize must be greater than 0", PluginName)
+	}
 
 	// If there's a ~ at the beginning of the secrets directory, try to resolve it to make life easier for the user
 	secretsDir := p.config.SecretsDir
@@ -150,5 +200,85 @@ func (p *Plugin) Init(cfg string) error {
 
 	// enable/disable async extraction optimazion (enabled by default)
 	extract.SetAsync(p.config.UseAsync)
+
+	// the framework doesn't call Destroy when Init fails, so the servers
+	// started before a failure are stopped here
+	defer func() {
+		if err != nil {
+			p.Destroy()
+		}
+	}()
+
+	// apply the reloadable settings, and watch them if a file is set
+	p.reloaded.Store(&p.config)
+	if len(p.config.ReloadFile) > 0 {
+		w, err := reload.Watch(p.config.ReloadFile, p.reload, func(format string, v ...interface{}) {
+			log.Printf("[%s] "+format+"\n", append([]interface{}{PluginName}, v...)...)
+		})
+		if err != nil {
+			return err
+		}
+		p.reloader = w
+	}
+
+	// start the optional pprof and expvar server
+	if len(p.config.DebugAddress) > 0 {
+		srv, err := debugserver.Start(p.config.DebugAddress)
+		if err != nil {
+			return err
+		}
+		p.debugServer = srv
+	}
+
+	// start the optional health server
+	if len(p.config.HealthAddress) > 0 {
+		srv, err := health.Start(p.config.HealthAddress, p.config.HealthPath)
+		if err != nil {
+			return err
+		}
+		p.healthServer = srv
+	}
+
+	// start the optional metrics endpoint
+	if len(p.config.MetricsAddress) > 0 {
+		m, err := metrics.Start(p.config.MetricsAddress, p.config.MetricsPath, PluginName)
+		if err != nil {
+			return err
+		}
+		p.metrics = m
+	}
 	return nil
 }
+
+// reload applies the reloadable settings of the reload file on top of the
+// init config, so that removing one of them restores its init value
+func (p *Plugin) reload(data []byte) error {
+	cfg := p.config
+	if err := reload.Decode(data, &cfg); err != nil {
+		return err
+	}
+	if err := secrets.Resolve(&cfg); err != nil {
+		return err
+	}
+	p.reloaded.Store(&cfg)
+	return nil
+}
+
+func (p *Plugin) Destroy() {
+	if p.reloader != nil {
+		p.reloader.Close()
+		p.reloader = nil
+	}
+	if p.debugServer != nil {
+		p.debugServer.Close()
+		p.debugServer = nil
+	}
+	if p.healthServer != nil {
+		p.healthServer.Close()
+		p.healthServer = nil
+	}
+	if p.metrics != nil {
+		p.metrics.Close()
+		p.metrics = nil
+	}
+}
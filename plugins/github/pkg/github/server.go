@@ -19,23 +19,42 @@ package github
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/tenant"
+	"github.com/falcosecurity/plugins/shared/go/webhook/cloudevents"
 	"github.com/google/go-github/github"
 	"github.com/valyala/fastjson"
 )
 
-const apiDownloadBufSize = 16 * 1024 * 1024
+const (
+	apiDownloadBufSize    = 16 * 1024 * 1024
+	signatureFailureType  = "signature_verification_failed"
+	whQueueReportInterval = 10 * time.Second
+	// sigFailureInterval is the shortest time between two events of
+	// signature_verification_failed, the failures in between are counted
+	// in the next one
+	sigFailureInterval = 10 * time.Second
+	// whBatchWait is how long a batch waits for more webhook messages
+	// once it has received its first one, if its target size is not reached
+	whBatchWait = 10 * time.Millisecond
+)
 
 var (
 	rgxHunkShort = regexp.MustCompile(`^@@ -(?:\d+)(?:,\d+)? \+(\d+)(?:,\d+)? @@.*`)
@@ -86,7 +105,7 @@ func scanDiffPatch(patch string, onAddition func(lineNum uint64, line string)) e
 
 func scanDiff(oCtx *PluginInstance, repo string, refs string, diffFiles *[]diffFileInfo) error {
 	// Issue the compare request
-	resp, err := oCtx.ghOauth.tc.Get("https://api.github.com/repos/" + repo + "/compare/" + refs)
+	resp, err := oCtx.diffClient(repoOwner(repo)).Get("https://api.github.com/repos/" + repo + "/compare/" + refs)
 	if err != nil {
 		return err
 	}
@@ -155,7 +174,7 @@ func scanWorkFlowYaml(oCtx *PluginInstance, fileName string, repoName string, wo
 	fileUrl := "https://api.github.com/repos/" + repoName + "/contents/" + fileName
 
 	// Issue the compare request
-	resp, err := oCtx.ghOauth.tc.Get(fileUrl)
+	resp, err := oCtx.httpClient(repoOwner(repoName)).Get(fileUrl)
 	if err != nil {
 		return err
 	}
@@ -212,15 +231,221 @@ func scanWorkFlowYaml(oCtx *PluginInstance, fileName string, repoName string, wo
 	return nil
 }
 
+// webhookPayload returns the json payload of a webhook message body,
+// which depends on the content type of the message
+func webhookPayload(r *http.Request, body []byte) []byte {
+	if r.Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil
+		}
+		return []byte(form.Get("payload"))
+	}
+	return body
+}
+
+// webhookOwner returns the organization or the repository owner a webhook
+// message claims to come from. The payload is not verified yet, so this must
+// only be used to select the secrets to verify it with.
+func webhookOwner(payload []byte) string {
+	var jparser fastjson.Parser
+	jdata, err := jparser.ParseBytes(payload)
+	if err != nil {
+		return ""
+	}
+	if org := jdata.Get("organization", "login").GetStringBytes(); org != nil {
+		return string(org)
+	}
+	return string(jdata.Get("repository", "owner", "login").GetStringBytes())
+}
+
+// validateHook verifies the signature of a webhook message body against all
+// the secrets accepted for its organization, and returns its json payload.
+// The secrets the webhooks were installed with are always accepted, along
+// with the ones currently configured, which can be reloaded. The secrets of
+// an organization take precedence over the global ones, which are not
+// accepted for its messages.
+func validateHook(r *http.Request, body []byte, oCtx *PluginInstance) ([]byte, error) {
+	var err error
+	cfg := oCtx.whConfig.Load().(*PluginConfig)
+	owner := webhookOwner(webhookPayload(r, body))
+	var secrets []string
+	if orgSecrets := cfg.OrgWebhookSecrets[owner]; owner != "" && len(orgSecrets) > 0 {
+		secrets = appendMissing(nil, oCtx.hookSecret(owner))
+		secrets = appendMissing(secrets, orgSecrets...)
+	} else {
+		secrets = appendMissing(nil, oCtx.whSecret, oCtx.hookSecret(owner))
+		secrets = appendMissing(secrets, cfg.WebhookSecrets...)
+	}
+
+	for _, secret := range secrets {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		var payload []byte
+		payload, err = github.ValidatePayload(r, []byte(secret))
+		if err == nil {
+			return payload, nil
+		}
+	}
+	return webhookPayload(r, body), err
+}
+
+// appendMissing appends the values that are not in the list yet
+func appendMissing(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, s := range list {
+			if s == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// sigFailures throttles the events of signature_verification_failed, so
+// that unauthenticated clients can't flood the event source
+type sigFailures struct {
+	mu         sync.Mutex
+	last       time.Time
+	suppressed uint64
+}
+
+// allow tells whether an event can be sent for a failure happening at the
+// given time, and returns the number of failures suppressed since the last
+// event if so
+func (s *sigFailures) allow(now time.Time) (bool, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.last.IsZero() && now.Sub(s.last) < sigFailureInterval {
+		s.suppressed++
+		return false, 0
+	}
+	suppressed := s.suppressed
+	s.last, s.suppressed = now, 0
+	return true, suppressed
+}
+
+// signatureFailureEvent builds the json of the event sent when the signature
+// of a webhook message can't be verified, along with the number of the
+// failures suppressed since the previous one. The identity fields of the
+// original message are copied as they are, so they can't be trusted.
+func signatureFailureEvent(r *http.Request, payload []byte, suppressed uint64) []byte {
+	jmap := map[string]interface{}{}
+	var orig map[string]interface{}
+	if json.Unmarshal(payload, &orig) == nil {
+		for _, k := range []string{"repository", "organization", "sender"} {
+			if v, ok := orig[k]; ok {
+				jmap[k] = v
+			}
+		}
+	}
+	jmap["webhook_type"] = signatureFailureType
+	jmap["remote_addr"] = r.RemoteAddr
+	jmap["suppressed_failures"] = suppressed
+	jmap["delivery"] = map[string]interface{}{
+		"id":   github.DeliveryID(r),
+		"type": github.WebHookType(r),
+	}
+	res, err := json.Marshal(jmap)
+	if err != nil {
+		return errorMessage(err)
+	}
+	return res
+}
+
+// cloudEventRequest returns a copy of a webhook request whose body is the
+// data of a CloudEvent, with the headers GitHub would have sent it with. The
+// signature headers of the original request are kept, so the data is
+// verified as if it was sent by GitHub directly, and the webhook type is
+// the last segment of the CloudEvent type if the header is missing, e.g.
+// push for dev.knative.source.github.push.
+func cloudEventRequest(r *http.Request, m cloudevents.Message) *http.Request {
+	res := r.Clone(r.Context())
+	contentType := "application/json"
+	if strings.HasPrefix(m.Envelope.DataContentType, "application/x-www-form-urlencoded") {
+		contentType = "application/x-www-form-urlencoded"
+	}
+	res.Header.Set("Content-Type", contentType)
+	if github.WebHookType(res) == "" {
+		res.Header.Set("X-GitHub-Event", m.Envelope.Type[strings.LastIndex(m.Envelope.Type, ".")+1:])
+	}
+	if github.DeliveryID(res) == "" {
+		res.Header.Set("X-GitHub-Delivery", m.Envelope.ID)
+	}
+	return res
+}
+
 func handleHook(w http.ResponseWriter, r *http.Request, oCtx *PluginInstance) {
-	payload, err := github.ValidatePayload(r, []byte(oCtx.whSecret))
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		// oCtx.whSrvChan <- []byte("E " + err.Error())
-		log.Printf("[%s] signature check failed, skipping message from %s.\n", PluginName, r.RemoteAddr)
+		putErrorMessage(oCtx, errorMessage(errkind.New(errkind.Parse, err)))
 		return
 	}
 
-	defer r.Body.Close()
+	// the messages can be wrapped in CloudEvents envelopes, which are
+	// added to their json
+	msgs, err := cloudevents.Decode(r, body)
+	if err != nil {
+		cErr := errkind.Errorf(errkind.Parse, "invalid cloudevent, skipping message from %s: %s", r.RemoteAddr, err.Error())
+		log.Printf("[%s] %s\n", PluginName, errkind.Count(cErr, oCtx.metrics))
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var accepted [][]byte
+	authorized := true
+	for _, m := range msgs {
+		var msg []byte
+		var ok bool
+		if m.Envelope == nil {
+			msg, ok = handleHookMessage(r, m.Data, nil, oCtx)
+		} else {
+			msg, ok = handleHookMessage(cloudEventRequest(r, m), m.Data, m.Envelope, oCtx)
+		}
+		authorized = authorized && ok
+		if msg != nil {
+			accepted = append(accepted, msg)
+		}
+	}
+	// the messages of a request are queued all together or rejected all
+	// together, so that a rejected request can be retried without
+	// duplicates
+	if !oCtx.whQueue.PushAll(accepted) {
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+	if !authorized {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}
+}
+
+// handleHookMessage returns the message of the event source built from a
+// webhook message, or nil if there is none, e.g. because of an error which
+// is sent apart. It returns false if the signature of the message can't be
+// verified, in which case a throttled signature_verification_failed event
+// is pushed in its place.
+func handleHookMessage(r *http.Request, body []byte, envelope *cloudevents.Envelope, oCtx *PluginInstance) ([]byte, bool) {
+	payload, err := validateHook(r, body, oCtx)
+	if err != nil {
+		errkind.Count(errkind.Errorf(errkind.Auth, "signature check failed, skipping message from %s", r.RemoteAddr), oCtx.metrics)
+		ok, suppressed := oCtx.sigFailures.allow(time.Now())
+		if !ok {
+			return nil, false
+		}
+		log.Printf("[%s] signature check failed, skipping message from %s (%d more failures suppressed)\n", PluginName, r.RemoteAddr, suppressed)
+		msg, err := cloudevents.Embed(signatureFailureEvent(r, payload, suppressed), envelope)
+		if err != nil {
+			putErrorMessage(oCtx, errorMessage(errkind.New(errkind.Parse, err)))
+			return nil, false
+		}
+		oCtx.whQueue.Push(msg)
+		return nil, false
+	}
 
 	// GitHub's webhook messages encode the webhook type as a http header instead of
 	// putting it in the json, which is very unfortunate because it forces us to
@@ -234,8 +459,8 @@ func handleHook(w http.ResponseWriter, r *http.Request, oCtx *PluginInstance) {
 	err = json.Unmarshal(payload, &jmap)
 	if err != nil {
 		// Not a json file, return an error.
-		oCtx.whSrvChan <- []byte("E " + err.Error())
-		return
+		putErrorMessage(oCtx, errorMessage(errkind.New(errkind.Parse, err)))
+		return nil, true
 	}
 
 	whType := github.WebHookType(r)
@@ -244,7 +469,7 @@ func handleHook(w http.ResponseWriter, r *http.Request, oCtx *PluginInstance) {
 	// it to look for secrets that the author might have committed.
 	// If we find any committed secret, we add its information to a new section in the webhook
 	// json, so that the extractors can have easy access to it.
-	if whType == "push" {
+	if whType == "push" && oCtx.fetchDiffs {
 		// If a branch is being created or deleted, a push event is sent before create or delete events.
 		// So we extract the before and after commit IDs. If either is null, then it means that a branch
 		// is being created or deleted.
@@ -257,8 +482,8 @@ func handleHook(w http.ResponseWriter, r *http.Request, oCtx *PluginInstance) {
 				cmpStr := cmpIfc.(string)
 				refsStart := strings.LastIndex(cmpStr, "/")
 				if refsStart < 5 || len(cmpStr)-refsStart < 5 {
-					oCtx.whSrvChan <- []byte("E malformed compare field in push json: " + cmpStr)
-					return
+					putErrorMessage(oCtx, errorMessage(errkind.Errorf(errkind.Parse, "malformed compare field in push json: %s", cmpStr)))
+					return nil, true
 				}
 				refsStr := cmpStr[refsStart+1:]
 
@@ -272,8 +497,8 @@ func handleHook(w http.ResponseWriter, r *http.Request, oCtx *PluginInstance) {
 						// Make the diff request and analyze it
 						err := scanDiff(oCtx, repoFullName, refsStr, &diffFiles)
 						if err != nil {
-							oCtx.whSrvChan <- []byte("E " + err.Error())
-							return
+							putErrorMessage(oCtx, errorMessage(errkind.New(githubErrorKind(err), err)))
+							return nil, true
 						}
 
 						// Add the results to the webhook json
@@ -306,12 +531,28 @@ func handleHook(w http.ResponseWriter, r *http.Request, oCtx *PluginInstance) {
 	}
 
 	jmap["webhook_type"] = whType
+	if t := oCtx.tenants[webhookOwner(payload)]; t != nil {
+		jmap[tenant.Key] = t.Name
+	}
+	if envelope != nil {
+		jmap[cloudevents.Key] = envelope
+	}
 	jsonString, err := json.Marshal(jmap)
 	if err != nil {
-		jsonString = []byte("E " + err.Error())
+		putErrorMessage(oCtx, errorMessage(err))
+		return nil, true
 	}
+	return jsonString, true
+}
 
-	oCtx.whSrvChan <- jsonString
+// putErrorMessage sends an error message to the event source, waiting for
+// it to be consumed unless the instance is closed. The errors are kept out
+// of the webhook queue, whose overflow policy could drop them.
+func putErrorMessage(oCtx *PluginInstance, msg []byte) {
+	select {
+	case oCtx.whErrC <- msg:
+	case <-oCtx.whQueue.Done():
+	}
 }
 
 func fileExists(fname string) bool {
@@ -327,7 +568,26 @@ func notifyError(oCtx *PluginInstance, err error) {
 		oCtx.whSrv.Shutdown(context.Background())
 	}
 	oCtx.whSrv = nil
-	oCtx.whSrvChan <- []byte("E " + err.Error())
+	putErrorMessage(oCtx, errorMessage(err))
+}
+
+// errorMessage returns the message sent to the event source to return an
+// error, starting with an 'E' followed by the category of the error
+func errorMessage(err error) []byte {
+	kind, msg := errkind.Of(err), err.Error()
+	if e, ok := err.(*errkind.Error); ok {
+		msg = e.Err.Error()
+	}
+	return []byte("E " + string(kind) + " " + msg)
+}
+
+// parseErrorMessage returns the error of a message built by errorMessage
+func parseErrorMessage(msg []byte) error {
+	fields := strings.SplitN(string(msg[2:]), " ", 2)
+	if len(fields) < 2 {
+		return fmt.Errorf("%s", msg[2:])
+	}
+	return errkind.Errorf(errkind.Kind(fields[0]), "%s", fields[1])
 }
 
 func server(p *Plugin, oCtx *PluginInstance) {
@@ -342,7 +602,7 @@ func server(p *Plugin, oCtx *PluginInstance) {
 
 	if isHttps {
 		if !(fileExists(crtName) && fileExists(keyName)) {
-			err := fmt.Errorf("[%s] webhook webserver is configured to use HTTPs, but either %s or %s can't be found. Either provide the secrets, or set the UseHTTPs init parameter to false", PluginName, keyName, crtName)
+			err := errkind.Errorf(errkind.Config, "[%s] webhook webserver is configured to use HTTPs, but either %s or %s can't be found. Either provide the secrets, or set the UseHTTPs init parameter to false", PluginName, keyName, crtName)
 			notifyError(oCtx, err)
 		}
 	}
@@ -368,7 +628,7 @@ func server(p *Plugin, oCtx *PluginInstance) {
 	}
 
 	if err != nil {
-		notifyError(oCtx, err)
+		notifyError(oCtx, errkind.New(errkind.Config, err))
 		return
 	}
 }
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/falcosecurity/plugins/shared/go/webhook/queue"
+)
+
+func TestValidateHookOrgSecrets(t *testing.T) {
+	body := `{"organization":{"login":"org"}}`
+	sign := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	cfg := &PluginConfig{
+		WebhookSecrets:    []string{"global2"},
+		OrgWebhookSecrets: map[string][]string{"org": {"org2"}},
+	}
+	var whConfig atomic.Value
+	whConfig.Store(cfg)
+	oCtx := &PluginInstance{
+		whSecret:     "global",
+		whOrgSecrets: map[string][]string{"org": {"org1"}},
+		whConfig:     &whConfig,
+	}
+
+	tests := map[string]bool{
+		"org1":    true,  // installed with
+		"org2":    true,  // configured for the organization
+		"global":  false, // global secrets are not accepted for the organization
+		"global2": false,
+	}
+	for secret, valid := range tests {
+		r := httptest.NewRequest("POST", "/webhook", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-Hub-Signature", sign(secret))
+		if _, err := validateHook(r, []byte(body), oCtx); (err == nil) != valid {
+			t.Errorf("secret %s: expected valid %v, got error %v", secret, valid, err)
+		}
+	}
+
+	// the global secrets are accepted for the other owners
+	cfg.OrgWebhookSecrets = nil
+	oCtx.whOrgSecrets = nil
+	r := httptest.NewRequest("POST", "/webhook", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Hub-Signature", sign("global2"))
+	if _, err := validateHook(r, []byte(body), oCtx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSigFailures(t *testing.T) {
+	var s sigFailures
+	now := time.Now()
+	if ok, n := s.allow(now); !ok || n != 0 {
+		t.Fatalf("expected the first failure to be sent, got %v (%d)", ok, n)
+	}
+	for i := 0; i < 5; i++ {
+		if ok, _ := s.allow(now.Add(time.Second)); ok {
+			t.Fatal("expected the failure to be suppressed")
+		}
+	}
+	if ok, n := s.allow(now.Add(sigFailureInterval)); !ok || n != 5 {
+		t.Errorf("expected 5 suppressed failures, got %v (%d)", ok, n)
+	}
+}
+
+func TestHandleHookBatch(t *testing.T) {
+	data := `{"organization":{"login":"org"}}`
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(data))
+	sig := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	event := `{"specversion":"1.0","id":"1","source":"s","type":"dev.knative.source.github.ping","datacontenttype":"application/json","data":` + data + `}`
+	batch := "[" + event + "," + event + "]"
+
+	var whConfig atomic.Value
+	whConfig.Store(&PluginConfig{})
+	oCtx := &PluginInstance{
+		whSecret: "secret",
+		whConfig: &whConfig,
+		whQueue:  queue.New(3, queue.PolicyReject),
+	}
+	handle := func(sig string) int {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(batch))
+		r.Header.Set("Content-Type", "application/cloudevents-batch+json")
+		r.Header.Set("X-Hub-Signature", sig)
+		w := httptest.NewRecorder()
+		handleHook(w, r, oCtx)
+		return w.Code
+	}
+
+	// the messages of a request are rejected together if they don't all
+	// fit in the queue, so that the retries don't duplicate them
+	if status := handle(sig); status != http.StatusOK {
+		t.Fatalf("expected the request to be accepted, got %d", status)
+	}
+	if status := handle(sig); status != http.StatusTooManyRequests {
+		t.Fatalf("expected the request to be rejected, got %d", status)
+	}
+	if s := oCtx.whQueue.Stats(); s.Depth != 2 || s.Rejected != 2 {
+		t.Errorf("expected the messages of the first request only, got %+v", s)
+	}
+
+	// the signature failures are answered with 401 and sent as a single
+	// event
+	<-oCtx.whQueue.C()
+	<-oCtx.whQueue.C()
+	if status := handle("sha256=00"); status != http.StatusUnauthorized {
+		t.Fatalf("expected the request to be unauthorized, got %d", status)
+	}
+	if s := oCtx.whQueue.Stats(); s.Depth != 1 {
+		t.Fatalf("expected a signature failure event, got %+v", s)
+	}
+	if msg := <-oCtx.whQueue.C(); !strings.Contains(string(msg), signatureFailureType) {
+		t.Errorf("expected a signature failure event, got %s", msg)
+	}
+}
@@ -20,10 +20,11 @@ package github
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"math"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -31,6 +32,12 @@ import (
 
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/httpclient"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	"github.com/falcosecurity/plugins/shared/go/secrets"
+	"github.com/falcosecurity/plugins/shared/go/tenant"
+	"github.com/falcosecurity/plugins/shared/go/webhook/queue"
 	"github.com/google/go-github/github"
 	"github.com/sethvargo/go-password/password"
 	"github.com/valyala/fastjson"
@@ -46,7 +53,7 @@ type RepoInfo struct {
 	archived      bool
 }
 
-func listRepos(oCtx *PluginInstance) ([]RepoInfo, error) {
+func listRepos(tc *http.Client, isApp bool) ([]RepoInfo, error) {
 	var res []RepoInfo
 	perPage := 100
 	Page := 0
@@ -55,7 +62,12 @@ func listRepos(oCtx *PluginInstance) ([]RepoInfo, error) {
 		Page++
 		// NOTE: we don't use Repositories.List from the github API because it doesn't support pagination and therefore it's
 		//       essentially useless
-		resp, err := oCtx.ghOauth.tc.Get("https://api.github.com/user/repos?type=all&per_page=" + strconv.Itoa(perPage) + "&page=" + strconv.Itoa(Page))
+		// GitHub Apps can only list the repositories of their installation
+		reposURL := "https://api.github.com/user/repos?type=all&per_page="
+		if isApp {
+			reposURL = "https://api.github.com/installation/repositories?per_page="
+		}
+		resp, err := tc.Get(reposURL + strconv.Itoa(perPage) + "&page=" + strconv.Itoa(Page))
 		if err != nil {
 			return res, err
 		}
@@ -88,6 +100,9 @@ func listRepos(oCtx *PluginInstance) ([]RepoInfo, error) {
 			return res, err
 		}
 
+		if isApp {
+			jdata = jdata.Get("repositories")
+		}
 		reposList, _ := jdata.Array()
 
 		for _, repo := range reposList {
@@ -109,15 +124,16 @@ func listRepos(oCtx *PluginInstance) ([]RepoInfo, error) {
 	return res, nil
 }
 
-func GetGithubToken(secretsDir string) (string, error) {
+// readToken reads a github token from the given environment variable
+// or, if not set, from the given file in the secrets directory
+func readToken(secretsDir, envName, fileName string) (string, error) {
 	var err error = nil
 
 	// Try env variable first
-	envName := "GITHUB_PLUGIN_TOKEN"
 	res := os.Getenv(envName)
 	if res == "" {
 		// No env variable, try file
-		tfName := secretsDir + "/github.token"
+		tfName := secretsDir + "/" + fileName
 
 		fBody, err := ioutil.ReadFile(tfName)
 		if err != nil {
@@ -142,25 +158,70 @@ func GetGithubToken(secretsDir string) (string, error) {
 	return string(res), err
 }
 
+func GetGithubToken(secretsDir string) (string, error) {
+	return readToken(secretsDir, "GITHUB_PLUGIN_TOKEN", "github.token")
+}
+
+// GetGithubDiffToken returns the token dedicated to fetching the commit diffs,
+// or an empty string if none is provided
+func GetGithubDiffToken(secretsDir string) string {
+	res, err := readToken(secretsDir, "GITHUB_PLUGIN_DIFF_TOKEN", "github.diff.token")
+	if err != nil {
+		return ""
+	}
+	return res
+}
+
 func (p *Plugin) initInstance(oCtx *PluginInstance) error {
 	oCtx.whSrv = nil
 
-	// Exract the user parameters
-	var terr error
-	oCtx.ghOauth.token, terr = GetGithubToken(p.config.SecretsDir)
-	if terr != nil {
-		return terr
+	// the oauth2 clients send their requests with the client built from
+	// the http config
+	client, err := httpclient.New(p.config.HTTP)
+	if err != nil {
+		return errkind.New(errkind.Config, err)
+	}
+	oCtx.ghOauth.ctx = context.WithValue(context.Background(), oauth2.HTTPClient, client)
+
+	if p.config.AppID != 0 {
+		// Authenticate as a GitHub App installation, whose tokens are
+		// refreshed automatically when they expire
+		keyFile := p.config.AppPrivateKeyFile
+		if keyFile == "" {
+			keyFile = p.config.SecretsDir + "/github.app.pem"
+		}
+		ts, err := newAppTokenSource(p.config.AppID, p.config.AppInstallationID, keyFile)
+		if err != nil {
+			return err
+		}
+		oCtx.ghOauth.ts = ts
+		oCtx.isApp = true
+	} else {
+		// Exract the user parameters
+		var terr error
+		oCtx.ghOauth.token, terr = GetGithubToken(p.config.SecretsDir)
+		if terr != nil {
+			return terr
+		}
+		oCtx.ghOauth.ts = oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: oCtx.ghOauth.token},
+		)
 	}
 
 	// Create the token-authenticated http client that we will use to talk to github through
 	// its API
-	oCtx.ghOauth.ctx = context.Background()
-	oCtx.ghOauth.ts = oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: oCtx.ghOauth.token},
-	)
 	oCtx.ghOauth.tc = oauth2.NewClient(oCtx.ghOauth.ctx, oCtx.ghOauth.ts)
 	oCtx.ghClient = github.NewClient(oCtx.ghOauth.tc)
 
+	// Commit diffs are fetched with their own token, if provided, so that
+	// they don't consume the API rate limit of the main token
+	oCtx.ghDiffClient = oCtx.ghOauth.tc
+	if diffToken := GetGithubDiffToken(p.config.SecretsDir); diffToken != "" {
+		oCtx.ghDiffClient = oauth2.NewClient(oCtx.ghOauth.ctx, oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: diffToken},
+		))
+	}
+
 	return nil
 }
 
@@ -172,7 +233,7 @@ func (p *Plugin) OpenParams() ([]sdk.OpenParam, error) {
 	}
 
 	// if l is used as second argument, list all repositories for the authenticated user
-	repos, gerr := listRepos(oCtx)
+	repos, gerr := listRepos(oCtx.ghOauth.tc, oCtx.isApp)
 	if gerr != nil {
 		return nil, gerr
 	}
@@ -200,42 +261,69 @@ func (p *Plugin) OpenParams() ([]sdk.OpenParam, error) {
 
 // Open an event stream and return an open plugin instance.
 func (p *Plugin) Open(params string) (source.Instance, error) {
-	// Allocate the context struct for this open instance
-	oCtx := &PluginInstance{}
-	err := p.initInstance(oCtx)
+	inst, err := p.open(params)
 	if err != nil {
-		return nil, err
+		return nil, errkind.Count(errkind.New(githubErrorKind(err), err), p.metrics)
 	}
-	oCtx.whSecret, _ = password.Generate(32, 5, 5, false, false)
+	return metrics.Instance(inst, p.metrics), nil
+}
 
-	var selected_repos []string
+// githubErrorKind returns the category of an error returned by the GitHub API
+func githubErrorKind(err error) errkind.Kind {
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	var respErr *github.ErrorResponse
+	switch {
+	case errors.As(err, &rateErr), errors.As(err, &abuseErr):
+		return errkind.RateLimited
+	case errors.As(err, &respErr) && respErr.Response != nil:
+		return errkind.FromStatus(respErr.Response.StatusCode)
+	}
+	return errkind.Of(err)
+}
 
-	// if l is used as second argument, list all repositories for the authenticated user
-	if params == "*" {
-		// Fetch the list of the user's repos
-		repos, gerr := listRepos(oCtx)
-		if gerr != nil {
-			return nil, gerr
-		}
-		if len(repos) == 0 {
-			return nil, fmt.Errorf("the given token cannot access any repository on github")
-		}
+func (p *Plugin) open(params string) (source.Instance, error) {
+	params, err := secrets.ExpandEnv(params)
+	if err != nil {
+		return nil, errkind.New(errkind.Config, err)
+	}
 
-		for _, repo := range repos {
-			rname := strings.Trim(repo.fullName, "\"")
-			if repo.perm_Admin && !repo.archived {
-				selected_repos = append(selected_repos, rname)
-			}
+	// Read the audit log streamed by GitHub Enterprise instead of installing webhooks
+	if isAuditLogParams(params) {
+		return p.openAuditLog(params)
+	}
+
+	// Allocate the context struct for this open instance
+	oCtx := &PluginInstance{}
+	var selected_repos []string
+	if tenant.IsList(params) {
+		// Each of the tenants attaches to its repositories with its own token
+		client, err := httpclient.New(p.config.HTTP)
+		if err != nil {
+			return nil, errkind.New(errkind.Config, err)
+		}
+		selected_repos, err = initTenants(oCtx, params, client)
+		if err != nil {
+			return nil, err
 		}
 	} else {
-		pa := strings.Split(params, ",")
-		for _, rawRepo := range pa {
-			// clean up the string in case the use put spaces among them
-			repo := strings.Trim(rawRepo, " ")
-			repo = strings.Trim(repo, "\t")
-			selected_repos = append(selected_repos, repo)
+		err = p.initInstance(oCtx)
+		if err != nil {
+			return nil, err
+		}
+		selected_repos, err = selectRepos(oCtx.ghOauth.tc, oCtx.isApp, params)
+		if err != nil {
+			return nil, err
 		}
 	}
+	if len(p.config.WebhookSecrets) > 0 {
+		oCtx.whSecret = p.config.WebhookSecrets[0]
+	} else {
+		oCtx.whSecret, _ = password.Generate(32, 5, 5, false, false)
+	}
+	oCtx.whOrgSecrets = p.config.OrgWebhookSecrets
+	oCtx.whConfig = &p.reloaded
+	oCtx.fetchDiffs = p.config.FetchDiffs
 
 	// Compile the regular expressions used to find secrests in commits
 	err = compileRegexes(oCtx)
@@ -249,8 +337,16 @@ func (p *Plugin) Open(params string) (source.Instance, error) {
 		fmt.Println(err)
 	}
 
-	// Create the channel that we'll use to collect the messages from the webserver
-	oCtx.whSrvChan = make(chan []byte, 128)
+	// Create the queue that we'll use to collect the messages from the webserver
+	policy, err := queue.ParsePolicy(p.config.WebhookOverflow)
+	if err != nil {
+		return nil, err
+	}
+	oCtx.whQueue = queue.New(int(p.config.WebhookQueueSize), policy)
+	oCtx.whErrC = make(chan []byte)
+	go oCtx.whQueue.Report(context.Background(), whQueueReportInterval, func(format string, v ...interface{}) {
+		log.Printf("[%s] %s\n", PluginName, fmt.Sprintf(format, v...))
+	})
 
 	// Launch the webhook web server
 	go server(p, oCtx)
@@ -262,13 +358,13 @@ func (p *Plugin) Open(params string) (source.Instance, error) {
 		log.Printf("Installing webhook in github repo %s\n", repoName)
 		rnComps := strings.Split(repoName, "/")
 		if len(rnComps) != 2 {
-			return nil, fmt.Errorf("[%s] invalid repository name %s. Expected format: owner/name, e.g. falcosecurity/falco", PluginName, repoName)
+			return nil, errkind.Errorf(errkind.Config, "[%s] invalid repository name %s. Expected format: owner/name, e.g. falcosecurity/falco", PluginName, repoName)
 		}
 
 		loginName := rnComps[0] // *repo.Owner.Login
 		repoName := rnComps[1]  // *repo.Name
 
-		hooks, _, gerr := oCtx.ghClient.Repositories.ListHooks(oCtx.ghOauth.ctx, loginName, repoName, nil)
+		hooks, _, gerr := oCtx.client(loginName).Repositories.ListHooks(oCtx.ghOauth.ctx, loginName, repoName, nil)
 		if gerr != nil {
 			return nil, gerr
 		}
@@ -276,7 +372,7 @@ func (p *Plugin) Open(params string) (source.Instance, error) {
 		for _, hook := range hooks {
 			if hook.Config["url"] == oCtx.whURL {
 				// Hook already installed for this repo. Delete it and start clean.
-				_, gerr := oCtx.ghClient.Repositories.DeleteHook(oCtx.ghOauth.ctx, loginName, repoName, hook.GetID())
+				_, gerr := oCtx.client(loginName).Repositories.DeleteHook(oCtx.ghOauth.ctx, loginName, repoName, hook.GetID())
 				if gerr != nil {
 					return nil, gerr
 				}
@@ -295,11 +391,11 @@ func (p *Plugin) Open(params string) (source.Instance, error) {
 			Active: &active,
 			Config: map[string]interface{}{
 				"content_type": "form",
-				"secret":       oCtx.whSecret,
+				"secret":       oCtx.hookSecret(loginName),
 				"insecure_ssl": 0,
 				"url":          oCtx.whURL}}
 
-		hook, _, gerr := oCtx.ghClient.Repositories.CreateHook(oCtx.ghOauth.ctx, loginName, repoName, &hookInfo)
+		hook, _, gerr := oCtx.client(loginName).Repositories.CreateHook(oCtx.ghOauth.ctx, loginName, repoName, &hookInfo)
 		_ = hook
 		if gerr != nil {
 			return nil, gerr
@@ -315,9 +411,133 @@ func (p *Plugin) Open(params string) (source.Instance, error) {
 		oCtx.installedHooks = append(oCtx.installedHooks, nh)
 	}
 
+	// the webhooks are installed and the server is listening
+	oCtx.tracker = p.healthServer.Track()
+	oCtx.tracker.SetConnected(true)
+	oCtx.metrics = p.metrics
 	return oCtx, nil
 }
 
+// selectRepos returns the repositories selected by the given comma-separated
+// list, or all the ones administered with the given client if it is "*"
+func selectRepos(tc *http.Client, isApp bool, params string) ([]string, error) {
+	var selected_repos []string
+
+	// if l is used as second argument, list all repositories for the authenticated user
+	if params == "*" {
+		// Fetch the list of the user's repos
+		repos, gerr := listRepos(tc, isApp)
+		if gerr != nil {
+			return nil, gerr
+		}
+		if len(repos) == 0 {
+			return nil, fmt.Errorf("the given token cannot access any repository on github")
+		}
+
+		for _, repo := range repos {
+			rname := strings.Trim(repo.fullName, "\"")
+			if repo.perm_Admin && !repo.archived {
+				selected_repos = append(selected_repos, rname)
+			}
+		}
+	} else {
+		pa := strings.Split(params, ",")
+		for _, rawRepo := range pa {
+			// clean up the string in case the use put spaces among them
+			repo := strings.Trim(rawRepo, " ")
+			repo = strings.Trim(repo, "\t")
+			selected_repos = append(selected_repos, repo)
+		}
+	}
+	return selected_repos, nil
+}
+
+// initTenants initializes an instance opened with a list of tenants, and
+// returns the repositories selected by all of them. The repositories of an
+// owner can only be selected by a single tenant, whose token is used to
+// install their webhooks and to query the API for their messages, with the
+// given client.
+func initTenants(oCtx *PluginInstance, params string, client *http.Client) ([]string, error) {
+	var tenants []*githubTenant
+	if err := tenant.Parse(params, &tenants); err != nil {
+		return nil, errkind.New(errkind.Config, err)
+	}
+
+	// the messages of the repositories that aren't selected by any tenant,
+	// e.g. from organization webhooks, are processed without authentication
+	oCtx.ghOauth.ctx = context.WithValue(context.Background(), oauth2.HTTPClient, client)
+	oCtx.ghOauth.tc = client
+	oCtx.ghClient = github.NewClient(client)
+	oCtx.ghDiffClient = client
+	oCtx.tenants = make(map[string]*githubTenant)
+
+	var res []string
+	for _, t := range tenants {
+		if t.Token == "" || t.Repos == "" {
+			return nil, errkind.Errorf(errkind.Config, "missing token or repos of tenant %s", t.Name)
+		}
+		t.tc = oauth2.NewClient(oCtx.ghOauth.ctx, oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: t.Token},
+		))
+		t.client = github.NewClient(t.tc)
+
+		repos, err := selectRepos(t.tc, false, t.Repos)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", t.Name, err)
+		}
+		for _, repo := range repos {
+			owner := repoOwner(repo)
+			if other, ok := oCtx.tenants[owner]; ok && other != t {
+				return nil, errkind.Errorf(errkind.Config, "the repositories of %s are selected by tenants %s and %s", owner, other.Name, t.Name)
+			}
+			oCtx.tenants[owner] = t
+		}
+		res = append(res, repos...)
+	}
+	return res, nil
+}
+
+// repoOwner returns the owner of a repository from its full name
+func repoOwner(fullName string) string {
+	return strings.SplitN(fullName, "/", 2)[0]
+}
+
+// client returns the API client of the tenant selecting the repositories of
+// the given owner, or the one of the instance if there is no such tenant
+func (o *PluginInstance) client(owner string) *github.Client {
+	if t := o.tenants[owner]; t != nil {
+		return t.client
+	}
+	return o.ghClient
+}
+
+// httpClient returns the http client authenticated with the token of the
+// tenant selecting the repositories of the given owner, if any
+func (o *PluginInstance) httpClient(owner string) *http.Client {
+	if t := o.tenants[owner]; t != nil {
+		return t.tc
+	}
+	return o.ghOauth.tc
+}
+
+// diffClient returns the http client used to fetch the commit diffs of the
+// repositories of the given owner. The tenants fetch them with their token.
+func (o *PluginInstance) diffClient(owner string) *http.Client {
+	if t := o.tenants[owner]; t != nil {
+		return t.tc
+	}
+	return o.ghDiffClient
+}
+
+// hookSecret returns the secret used to sign the messages of the webhooks
+// installed in the repositories of the given owner
+func (o *PluginInstance) hookSecret(owner string) string {
+	if secrets := o.whOrgSecrets[owner]; len(secrets) > 0 {
+		return secrets[0]
+	}
+	return o.whSecret
+}
+
 // Closing the event stream and deinitialize the open plugin instance.
 func (o *PluginInstance) Close() {
 	// Shut down the webhook webserver
@@ -327,11 +547,17 @@ func (o *PluginInstance) Close() {
 			log.Printf("github webhook shutdown failed: %s", err)
 		}
 	}
+	if o.whQueue != nil {
+		o.whQueue.Close()
+	}
+	if o.tracker != nil {
+		o.tracker.Close()
+	}
 
 	// Remove all the webhhoks that we installed in open()
 	for _, hook := range o.installedHooks {
 		log.Printf("deleting webhook from %s/%s\n", hook.owner, hook.repo)
-		o.ghClient.Repositories.DeleteHook(o.ghOauth.ctx, hook.owner, hook.repo, hook.id)
+		o.client(hook.owner).Repositories.DeleteHook(o.ghOauth.ctx, hook.owner, hook.repo, hook.id)
 	}
 }
 
@@ -340,39 +566,72 @@ func (o *PluginInstance) NextBatch(pState sdk.PluginState, evts sdk.EventWriters
 	// Casting to our plugin type
 	pCtx := pState.(*Plugin)
 
-	// Batching is not supported for now, so we only write the first entry of the batch
-	evt := evts.Get(0)
-	writer := evt.Writer()
-
-	// Receive the event from the webserver channel with a 1 sec timeout
-	var data []byte
-	afterCh := time.After(1 * time.Second)
-	select {
-	case data = <-o.whSrvChan:
-	case <-afterCh:
-		pCtx.jdataEvtnum = math.MaxUint64
-		return 0, sdk.ErrTimeout
+	// Receive the first event from the webserver queue with a 1 sec timeout,
+	// unless a message was left over by the previous batch
+	data := o.whPending
+	o.whPending = nil
+	if data == nil {
+		select {
+		case data = <-o.whQueue.C():
+		case data = <-o.whErrC:
+		case <-time.After(1 * time.Second):
+			pCtx.jcache.Reset()
+			return 0, sdk.ErrTimeout
+		}
 	}
 
-	// If the buffer starts with an 'E', it means it contains an error
-	if data[0] == 'E' {
-		return 0, fmt.Errorf("%s", (data[2:]))
-	}
+	// The batch size adapts to the backlog of the queue: during bursts, the
+	// next messages are waited for a short time to fill larger batches, while
+	// at low volume the messages are returned one by one as soon as received
+	size := o.batchSizer.Next(evts.Len())
+	deadline := time.NewTimer(whBatchWait)
+	defer deadline.Stop()
 
-	// Write data inside the event
-	written, err := writer.Write(data)
-	if err != nil {
-		return 0, err
-	}
-	if written < len(data) {
-		return 0, fmt.Errorf("github message too long: %d, max %d supported", len(data), written)
-	}
+	n := 0
+batch:
+	for {
+		// If the buffer starts with an 'E', it means it contains an error
+		if data[0] == 'E' {
+			if n > 0 {
+				// return the events of the batch first, the error
+				// is returned alone by the next call
+				o.whPending = data
+				break
+			}
+			o.tracker.Error()
+			o.metrics.UpstreamError()
+			return 0, errkind.Count(parseErrorMessage(data), o.metrics)
+		}
+
+		// Write data inside the event
+		written, err := evts.Get(n).Writer().Write(data)
+		if err != nil {
+			return n, err
+		}
+		if written < len(data) {
+			return n, fmt.Errorf("github message too long: %d, max %d supported", len(data), written)
+		}
+		n++
+		o.metrics.Ingested(written, time.Time{})
 
-	// Let the engine timestamp this event. It would probably be better to
-	// use the updated_at field in the json.
-	// evt.SetTimestamp(...)
+		// Let the engine timestamp this event. It would probably be better to
+		// use the updated_at field in the json.
+		// evt.SetTimestamp(...)
 
-	return 1, nil
+		if n >= size {
+			break
+		}
+		select {
+		case data = <-o.whQueue.C():
+		case data = <-o.whErrC:
+		case <-deadline.C:
+			break batch
+		}
+	}
+
+	o.batchSizer.Done(n, o.whQueue.Stats().Depth)
+	o.tracker.Event()
+	return n, nil
 }
 
 // Provide a string representation for an event.
@@ -380,12 +639,7 @@ func (p *Plugin) String(evt sdk.EventReader) (string, error) {
 	var line string
 	var err error
 
-	data, err := ioutil.ReadAll(evt.Reader())
-	if err != nil {
-		return "", err
-	}
-
-	p.jdata, err = p.jparser.ParseBytes(data)
+	p.jdata, err = p.jcache.Get(evt.EventNum(), evt.Reader())
 	if err != nil {
 		return "", fmt.Errorf("<invalid JSON: %s>" + err.Error())
 	}
@@ -5,6 +5,33 @@ go 1.15
 require (
 	github.com/alecthomas/jsonschema v0.0.0-20220216202328-9eeeec9d044b
 	github.com/falcosecurity/plugin-sdk-go v0.7.4
+	github.com/falcosecurity/plugins/shared/go/bufpool v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/conformance v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/fuzz v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/golden v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/metrics v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/proto v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/reload v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/secrets v0.0.0-00010101000000-000000000000
 	github.com/iancoleman/orderedmap v0.3.0 // indirect
+	github.com/itchyny/gojq v0.12.13
 	github.com/valyala/fastjson v1.6.4
 )
+
+replace github.com/falcosecurity/plugins/shared/go/bufpool => ../../shared/go/bufpool
+
+replace github.com/falcosecurity/plugins/shared/go/golden => ../../shared/go/golden
+
+replace github.com/falcosecurity/plugins/shared/go/fuzz => ../../shared/go/fuzz
+
+replace github.com/falcosecurity/plugins/shared/go/proto => ../../shared/go/proto
+
+replace github.com/falcosecurity/plugins/shared/go/secrets => ../../shared/go/secrets
+
+replace github.com/falcosecurity/plugins/shared/go/metrics => ../../shared/go/metrics
+
+replace github.com/falcosecurity/plugins/shared/go/reload => ../../shared/go/reload
+
+replace github.com/falcosecurity/plugins/shared/go/conformance => ../../shared/go/conformance
+
+replace github.com/falcosecurity/plugins/shared/go/mux => ../../shared/go/mux
@@ -17,11 +17,21 @@ limitations under the License.
 
 package json
 
+import "github.com/falcosecurity/plugins/shared/go/metrics"
+
 type PluginConfig struct {
-	UseAsync bool `json:"useAsync" jsonschema:"title=Use async extraction,description=If true then async extraction optimization is enabled (Default: true),default=true"`
+	UseAsync       bool   `json:"useAsync" jsonschema:"title=Use async extraction,description=If true then async extraction optimization is enabled (Default: true),default=true"`
+	JqFilter       string `json:"jqFilter" reload:"true" jsonschema:"title=jq filter,description=A jq filter run once over each event before extracting the fields. The fields are then extracted from the result of the filter. (Default: empty)"`
+	MetricsAddress string `json:"metricsAddress" jsonschema:"title=Metrics address,description=Address (e.g. :9090) of the Prometheus endpoint shared by the plugins of the Falco process configured with the same address (Default: empty for disabled),default="`
+	MetricsPath    string `json:"metricsPath" jsonschema:"title=Metrics path,description=Path of the Prometheus endpoint (Default: /metrics),default=/metrics"`
+	ReloadFile     string `json:"reloadFile" jsonschema:"title=Reload file,description=Path of a json file holding the settings applied again at runtime each time it changes: jqFilter (Default: empty for disabled),default="`
 }
 
 // Resets sets the configuration to its default values
 func (k *PluginConfig) Reset() {
 	k.UseAsync = true
+	k.JqFilter = ""
+	k.MetricsAddress = ""
+	k.MetricsPath = metrics.DefaultPath
+	k.ReloadFile = ""
 }
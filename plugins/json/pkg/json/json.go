@@ -27,12 +27,21 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/alecthomas/jsonschema"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/symbols/extract"
+	"github.com/falcosecurity/plugins/shared/go/bufpool"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	eventpb "github.com/falcosecurity/plugins/shared/go/proto"
+	"github.com/falcosecurity/plugins/shared/go/reload"
+	"github.com/falcosecurity/plugins/shared/go/secrets"
+	"github.com/itchyny/gojq"
 	"github.com/valyala/fastjson"
 )
 
@@ -47,7 +56,15 @@ type Plugin struct {
 	plugins.BasePlugin
 	jparser     fastjson.Parser
 	jdata       *fastjson.Value
-	jdataEvtnum uint64 // The event number jdata refers to. Used to know when we can skip the unmarshaling.
+	jdataEvtnum uint64       // The event number jdata refers to. Used to know when we can skip the unmarshaling.
+	jqCode      atomic.Value // The compiled jq filter, nil if none, which can be reloaded while extracting.
+	pointers    pointerCache // compiled json.value arguments
+	wpointers   pointerCache // compiled json.values arguments
+	pevt        eventpb.Event
+	pdata       []byte // The data pevt refers to.
+	isProto     bool   // Whether the event jdata refers to is encoded with the protobuf envelope.
+	metrics     *metrics.Metrics
+	reloader    *reload.Watcher
 	Config      PluginConfig
 }
 
@@ -75,16 +92,99 @@ func (p *Plugin) InitSchema() *sdk.SchemaInfo {
 	return nil
 }
 
-func (m *Plugin) Init(config string) error {
+func (m *Plugin) Init(config string) (err error) {
 	// read configuration
 	m.Config.Reset()
 	json.Unmarshal([]byte(config), &m.Config)
+	if err := secrets.Resolve(&m.Config); err != nil {
+		return err
+	}
+
+	// compile the optional jq filter once for all the events
+	code, err := compileJqFilter(m.Config.JqFilter)
+	if err != nil {
+		return err
+	}
+	m.jqCode.Store(code)
+
+	// the framework doesn't call Destroy when Init fails, so the servers
+	// started before a failure are stopped here
+	defer func() {
+		if err != nil {
+			m.Destroy()
+		}
+	}()
+
+	// watch the reloadable settings, if a file is set
+	if len(m.Config.ReloadFile) > 0 {
+		w, err := reload.Watch(m.Config.ReloadFile, m.reload, func(format string, v ...interface{}) {
+			log.Printf("[%s] "+format+"\n", append([]interface{}{PluginName}, v...)...)
+		})
+		if err != nil {
+			return err
+		}
+		m.reloader = w
+	}
 
 	// setup optional async extraction optimization
 	extract.SetAsync(m.Config.UseAsync)
+
+	// start the optional metrics endpoint
+	if len(m.Config.MetricsAddress) > 0 {
+		mt, err := metrics.Start(m.Config.MetricsAddress, m.Config.MetricsPath, PluginName)
+		if err != nil {
+			return err
+		}
+		m.metrics = mt
+	}
 	return nil
 }
 
+// reload applies the reloadable settings of the reload file on top of the
+// init config, so that removing one of them restores its init value
+func (m *Plugin) reload(data []byte) error {
+	cfg := m.Config
+	if err := reload.Decode(data, &cfg); err != nil {
+		return err
+	}
+	if err := secrets.Resolve(&cfg); err != nil {
+		return err
+	}
+	code, err := compileJqFilter(cfg.JqFilter)
+	if err != nil {
+		return err
+	}
+	m.jqCode.Store(code)
+	return nil
+}
+
+// compileJqFilter compiles a jq filter, or returns nil if it's empty
+func compileJqFilter(filter string) (*gojq.Code, error) {
+	if len(filter) == 0 {
+		return nil, nil
+	}
+	query, err := gojq.Parse(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jq filter: %s", err.Error())
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jq filter: %s", err.Error())
+	}
+	return code, nil
+}
+
+func (m *Plugin) Destroy() {
+	if m.reloader != nil {
+		m.reloader.Close()
+		m.reloader = nil
+	}
+	if m.metrics != nil {
+		m.metrics.Close()
+		m.metrics = nil
+	}
+}
+
 func (m *Plugin) Fields() []sdk.FieldEntry {
 	return []sdk.FieldEntry{
 		{
@@ -119,20 +219,31 @@ func (m *Plugin) Fields() []sdk.FieldEntry {
 			Name: "jevt.rawtime",
 			Desc: "Alias for json.rawtime, provided for backwards compatibility.",
 		},
+		{
+			Type:   "string",
+			Name:   "json.values",
+			IsList: true,
+			Arg:    sdk.FieldEntryArg{IsRequired: true, IsKey: true},
+			Desc:   "Extracts a list of values from a JSON-encoded input. Syntax is json.values[<json pointer>], where <json pointer> is a json pointer (see https://datatracker.ietf.org/doc/html/rfc6901) in which the [*] suffix or the * token match all the elements of an array, e.g. json.values[/spec/containers[*]/image]",
+		},
 	}
 }
 
 func (m *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
+	if m.metrics != nil {
+		defer m.metrics.ObserveExtraction(time.Now())
+	}
 	reader := evt.Reader()
 
 	// As a very quick sanity check, only try to extract all if
-	// the first character is '{' or '['
-	data := []byte{0}
-	_, err := reader.Read(data)
-	if err != nil {
+	// the first character is '{' or '[', or if the event is encoded
+	// with the protobuf envelope
+	data := []byte{0, 0}
+	n, err := io.ReadFull(reader, data)
+	if err != nil && err != io.ErrUnexpectedEOF {
 		return err
 	}
-	if !(data[0] == '{' || data[0] == '[') {
+	if !(data[0] == '{' || data[0] == '[' || eventpb.IsEvent(data[:n])) {
 		return fmt.Errorf("invalid json format")
 	}
 
@@ -143,14 +254,13 @@ func (m *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
 			return err
 		}
 
-		data, err = ioutil.ReadAll(reader)
+		buf, err := bufpool.ReadAll(reader)
 		if err != nil {
 			return err
 		}
+		defer bufpool.Put(buf)
 
-		// Try to parse the data as json
-		m.jdata, err = m.jparser.ParseBytes(data)
-		if err != nil {
+		if err := m.decode(buf.Bytes()); err != nil {
 			return err
 		}
 		m.jdataEvtnum = evt.EventNum()
@@ -160,52 +270,75 @@ func (m *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
 	case 3: // jevt.value
 		fallthrough
 	case 0: // json.value
-		val := m.jdata
-
 		arg := req.ArgKey()
+
+		// the attributes of the protobuf events are keyed by their
+		// json pointer, so most values are found without any json
+		if m.isProto && len(arg) > 0 {
+			if v, ok := m.pevt.Lookup(arg); ok {
+				req.SetValue(v.String())
+				return nil
+			}
+		}
+
+		val, err := m.jsonData()
+		if err != nil {
+			return err
+		}
 		if len(arg) == 0 {
 			req.SetValue(string(val.MarshalTo(nil)))
 			return nil
 		}
-		if arg[0] == '/' {
-			arg = arg[1:]
-		}
 
 		// walk the object using the json pointer syntax (RFC 6901)
-		pointer := strings.Split(arg, "/")
-		for _, key := range pointer {
-			key = strings.Replace(key, "~1", "/", -1)
-			key = strings.Replace(key, "~0", "~", -1)
-			val = val.Get(key)
+		for _, token := range m.pointers.get(arg, false) {
+			val = val.Get(token.key)
 			if val == nil {
 				return nil
 			}
 		}
 
-		if val.Type() == fastjson.TypeString {
-			str, err := val.StringBytes()
+		str, err := valueString(val)
+		if err != nil {
+			return err
+		}
+		req.SetValue(str)
+	case 6: // json.values
+		jdata, err := m.jsonData()
+		if err != nil {
+			return err
+		}
+		arg := req.ArgKey()
+		vals := []*fastjson.Value{jdata}
+		if len(arg) > 0 && arg != "/" {
+			vals = walkWildcardPointer(jdata, m.wpointers.get(arg, true), nil)
+		}
+
+		res := make([]string, 0, len(vals))
+		for _, val := range vals {
+			str, err := valueString(val)
 			if err != nil {
 				return err
 			}
-			req.SetValue(string(str))
-		} else {
-			req.SetValue(string(val.MarshalTo(nil)))
+			res = append(res, str)
 		}
+		req.SetValue(res)
 	case 4: // jevt.obj
 		fallthrough
 	case 1: // json.obj
-		// If we skipped the deserialization, we have to read
-		// the event data.
-		if len(data) == 1 {
-			_, err := reader.Seek(0, io.SeekStart)
-			if err != nil {
-				return err
-			}
+		// The event data is read again, as the json it was decoded to
+		// might have been transformed by the jq filter
+		_, err := reader.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
 
-			data, err = ioutil.ReadAll(reader)
-			if err != nil {
-				return err
-			}
+		data, err = ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		if eventpb.IsEvent(data) {
+			data = m.pevt.AppendJSON(nil)
 		}
 		var out bytes.Buffer
 		err = json.Indent(&out, data, "", "  ")
@@ -223,3 +356,124 @@ func (m *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
 
 	return nil
 }
+
+// decode parses the data of an event, after running the jq filter if any.
+// The events encoded with the protobuf envelope are only decoded, and
+// rendered as json by jsonData if an extraction requires it.
+func (m *Plugin) decode(data []byte) (err error) {
+	jqCode, _ := m.jqCode.Load().(*gojq.Code)
+	m.jdata = nil
+	m.isProto = false
+	if eventpb.IsEvent(data) {
+		// the event references its data, which is copied as the
+		// buffer is released afterwards
+		m.pdata = append(m.pdata[:0], data...)
+		if err := m.pevt.Unmarshal(m.pdata); err != nil {
+			return err
+		}
+		if jqCode == nil {
+			m.isProto = true
+			return nil
+		}
+		data = m.pevt.AppendJSON(nil)
+	}
+
+	// Run the jq filter, if any, so that the fields are extracted
+	// from its result for all the subsequent extractions
+	if jqCode != nil {
+		data, err = runJqFilter(jqCode, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Try to parse the data as json, the parser copies it so
+	// the buffer can be released afterwards
+	m.jdata, err = m.jparser.ParseBytes(data)
+	return err
+}
+
+// jsonData returns the json of the current event, which is rendered from
+// the events encoded with the protobuf envelope when first requested
+func (m *Plugin) jsonData() (*fastjson.Value, error) {
+	if m.jdata == nil && m.isProto {
+		var err error
+		m.jdata, err = m.jparser.ParseBytes(m.pevt.AppendJSON(nil))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m.jdata, nil
+}
+
+// unescapePointerKey decodes the ~1 and ~0 escape sequences of
+// a json pointer reference token (RFC 6901)
+func unescapePointerKey(key string) string {
+	key = strings.Replace(key, "~1", "/", -1)
+	return strings.Replace(key, "~0", "~", -1)
+}
+
+// walkWildcardPointer walks the object using a compiled json pointer and
+// appends to res all the values matched by the pointer
+func walkWildcardPointer(val *fastjson.Value, pointer []pointerToken, res []*fastjson.Value) []*fastjson.Value {
+	for i, token := range pointer {
+		if token.key != "" || !token.wildcard {
+			val = val.Get(token.key)
+			if val == nil {
+				return res
+			}
+		}
+		if token.wildcard {
+			arr, err := val.Array()
+			if err != nil {
+				return res
+			}
+			for _, elem := range arr {
+				res = walkWildcardPointer(elem, pointer[i+1:], res)
+			}
+			return res
+		}
+	}
+	return append(res, val)
+}
+
+// valueString returns the string representation of a json value,
+// which is its content for strings and its encoding otherwise
+func valueString(val *fastjson.Value) (string, error) {
+	if val.Type() == fastjson.TypeString {
+		str, err := val.StringBytes()
+		if err != nil {
+			return "", err
+		}
+		return string(str), nil
+	}
+	return string(val.MarshalTo(nil)), nil
+}
+
+// runJqFilter runs a compiled jq filter over a json input and returns the
+// json encoding of its result. Filters producing multiple results have them
+// collected in an array.
+func runJqFilter(code *gojq.Code, data []byte) ([]byte, error) {
+	var input interface{}
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, err
+	}
+
+	var results []interface{}
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			return nil, fmt.Errorf("jq filter failed: %s", err.Error())
+		}
+		results = append(results, v)
+	}
+
+	if len(results) == 1 {
+		return json.Marshal(results[0])
+	}
+	return json.Marshal(results)
+}
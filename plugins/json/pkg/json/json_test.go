@@ -26,6 +26,7 @@ import (
 	"unsafe"
 
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugins/shared/go/golden"
 )
 
 type testEventReader struct {
@@ -197,6 +198,116 @@ func TestExtractValue(t *testing.T) {
 	}
 }
 
+func TestExtractValues(t *testing.T) {
+	testEvent := &testEventReader{
+		num:  1,
+		time: time.Now(),
+		jsonData: `{
+			"spec":{
+				"containers":[
+					{"image":"nginx","ports":[80,443]},
+					{"image":"redis","ports":[6379]},
+					{"name":"noimage"}
+				]
+			}
+		}`,
+	}
+	testRequest := &testExtractRequest{
+		fieldID:   6,
+		field:     "json.values",
+		fieldType: sdk.FieldTypeCharBuf,
+		isList:    true,
+	}
+	e := &Plugin{}
+
+	tests := []struct {
+		arg      string
+		expected []string
+	}{
+		{"/spec/containers[*]/image", []string{"nginx", "redis"}},
+		{"/spec/containers/*/image", []string{"nginx", "redis"}},
+		{"/spec/containers[*]/ports[*]", []string{"80", "443", "6379"}},
+		{"/spec/containers/0/image", []string{"nginx"}},
+		{"/spec/containers[*]/missing", []string{}},
+		{"/spec[*]", []string{}},
+	}
+	for _, test := range tests {
+		testRequest.arg = test.arg
+		if err := e.Extract(testRequest, testEvent); err != nil {
+			t.Error(err)
+		}
+		res, ok := testRequest.value.([]string)
+		if !ok {
+			t.Errorf("expected []string value for %s", test.arg)
+			continue
+		}
+		if fmt.Sprint(res) != fmt.Sprint(test.expected) {
+			t.Errorf("expected value %v for %s, but found %v", test.expected, test.arg, res)
+		}
+	}
+}
+
+func TestPointerCache(t *testing.T) {
+	var c pointerCache
+	first := c.get("/a/b~1c[*]", true)
+	if fmt.Sprint(first) != fmt.Sprint([]pointerToken{{key: "a"}, {key: "b/c", wildcard: true}}) {
+		t.Errorf("unexpected compiled pointer %v", first)
+	}
+	if second := c.get("/a/b~1c[*]", true); &second[0] != &first[0] {
+		t.Errorf("expected the compiled pointer to be cached")
+	}
+
+	// the least recently used pointers are evicted when the cache is full
+	for i := 0; i < pointerCacheSize; i++ {
+		c.get(fmt.Sprintf("/key%d", i), true)
+	}
+	if c.order.Len() != pointerCacheSize {
+		t.Errorf("expected %d cached pointers, but found %d", pointerCacheSize, c.order.Len())
+	}
+	if _, ok := c.entries["/a/b~1c[*]"]; ok {
+		t.Errorf("expected the least recently used pointer to be evicted")
+	}
+}
+
+func TestExtractJqFilter(t *testing.T) {
+	testEvent := &testEventReader{
+		num:      1,
+		time:     time.Now(),
+		jsonData: `{"items":[{"name":"a","size":1},{"name":"b","size":3}]}`,
+	}
+	testRequest := &testExtractRequest{
+		fieldID:   0,
+		field:     "json.value",
+		fieldType: sdk.FieldTypeCharBuf,
+	}
+	e := &Plugin{}
+	err := e.Init(`{"jqFilter":"{names: [.items[].name], total: ([.items[].size] | add)}"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testRequest.arg = "/total"
+	if err := e.Extract(testRequest, testEvent); err != nil {
+		t.Error(err)
+	}
+	if s, ok := testRequest.value.(string); !ok || s != "4" {
+		t.Errorf("expected value %s, but found %v", "4", testRequest.value)
+	}
+
+	testRequest.arg = "/names/1"
+	if err := e.Extract(testRequest, testEvent); err != nil {
+		t.Error(err)
+	}
+	if s, ok := testRequest.value.(string); !ok || s != "b" {
+		t.Errorf("expected value %s, but found %v", "b", testRequest.value)
+	}
+
+	// invalid filters are rejected at init time
+	if err := e.Init(`{"jqFilter":".items["}`); err == nil {
+		t.Errorf("expected error with invalid jq filter")
+	}
+}
+
 func TestExtractObject(t *testing.T) {
 	var s string
 	var ok bool
@@ -288,3 +399,49 @@ func TestExtractRawtime(t *testing.T) {
 		t.Errorf("expected value '%s', but found '%s'", testTimeStr, ts)
 	}
 }
+
+func BenchmarkExtract(b *testing.B) {
+	testEvent := &testEventReader{
+		time: time.Now(),
+		jsonData: `{
+			"user":{"name":"alice","groups":["admin","dev"]},
+			"request":{"verb":"create","uri":"/api/v1/namespaces/default/pods"},
+			"list":[{"value":1},{"value":2},{"value":3}]
+		}`,
+	}
+	requests := []*testExtractRequest{
+		{fieldID: 0, field: "json.value", arg: "/user/name", fieldType: sdk.FieldTypeCharBuf},
+		{fieldID: 0, field: "json.value", arg: "/request/verb", fieldType: sdk.FieldTypeCharBuf},
+		{fieldID: 6, field: "json.values", arg: "/list[*]/value", fieldType: sdk.FieldTypeCharBuf, isList: true},
+	}
+	e := &Plugin{}
+
+	// each op extracts all the requests, so that ns/op divided by
+	// extractions/op is the cost of a single extraction
+	extractions := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// a new event each time, so that the parsing is measured too
+		testEvent.num = uint64(i + 1)
+		for _, req := range requests {
+			if err := e.Extract(req, testEvent); err != nil {
+				b.Error(err)
+			}
+			extractions++
+		}
+	}
+	b.ReportMetric(float64(extractions)/float64(b.N), "extractions/op")
+}
+
+func TestExtractGolden(t *testing.T) {
+	p := &Plugin{}
+	golden.Run(t, p, "testdata/golden", append(golden.DefaultFields(p),
+		"json.value[/eventName]",
+		"json.value[/userIdentity/userName]",
+		"json.value[/actor/alternateId]",
+		"json.value[/target/0/type]",
+		"json.value[/~1missing]",
+		"json.values[/target/*/alternateId]",
+		"jevt.value[/sender/login]",
+	)...)
+}
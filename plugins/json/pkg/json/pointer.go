@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package json
+
+import (
+	"container/list"
+	"strings"
+)
+
+// pointerCacheSize is the maximum number of compiled json pointers kept in
+// memory, which is far more than the distinct arguments used by a ruleset
+const pointerCacheSize = 1024
+
+// pointerToken is a reference token of a compiled json pointer
+type pointerToken struct {
+	// key is the unescaped key of the token
+	key string
+	// wildcard is true if the token matches all the elements of an array,
+	// in which case key is empty for the "*" token
+	wildcard bool
+}
+
+// compilePointer splits a json pointer (RFC 6901) into its unescaped
+// reference tokens. If wildcards is true, the "*" token and the "[*]"
+// suffix of a token match all the elements of an array.
+func compilePointer(arg string, wildcards bool) []pointerToken {
+	if len(arg) > 0 && arg[0] == '/' {
+		arg = arg[1:]
+	}
+	keys := strings.Split(arg, "/")
+	res := make([]pointerToken, len(keys))
+	for i, key := range keys {
+		if wildcards {
+			if key == "*" {
+				res[i].wildcard = true
+				continue
+			}
+			if strings.HasSuffix(key, "[*]") {
+				key = strings.TrimSuffix(key, "[*]")
+				res[i].wildcard = true
+			}
+		}
+		res[i].key = unescapePointerKey(key)
+	}
+	return res
+}
+
+// pointerCache is a LRU cache of json pointers compiled from the field
+// arguments, so that they are not split and unescaped at every extraction.
+// The zero value is an empty cache ready to use.
+type pointerCache struct {
+	entries map[string]*list.Element
+	order   list.List
+}
+
+type pointerCacheEntry struct {
+	arg    string
+	tokens []pointerToken
+}
+
+// get returns the compiled json pointer of the argument, compiling it
+// only if it is not in the cache already
+func (c *pointerCache) get(arg string, wildcards bool) []pointerToken {
+	if e, ok := c.entries[arg]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*pointerCacheEntry).tokens
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+	}
+	tokens := compilePointer(arg, wildcards)
+	c.entries[arg] = c.order.PushFront(&pointerCacheEntry{arg: arg, tokens: tokens})
+	if c.order.Len() > pointerCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*pointerCacheEntry).arg)
+	}
+	return tokens
+}
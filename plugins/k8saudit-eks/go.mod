@@ -3,18 +3,26 @@ module github.com/falcosecurity/plugins/plugins/k8saudit-eks
 go 1.17
 
 require (
+	github.com/aws/aws-sdk-go v1.54.3
 	github.com/falcosecurity/plugin-sdk-go v0.7.4
 	github.com/falcosecurity/plugins/plugins/k8saudit v0.10.1
 	github.com/falcosecurity/plugins/shared/go/aws/cloudwatchlogs v0.0.0-20240617170800-b69d0d091240
 	github.com/falcosecurity/plugins/shared/go/aws/session v0.0.0-20240617170800-b69d0d091240
+	github.com/falcosecurity/plugins/shared/go/conformance v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/errkind v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/health v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/metrics v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/secrets v0.0.0-00010101000000-000000000000
 	github.com/invopop/jsonschema v0.12.0
 )
 
+require gopkg.in/yaml.v2 v2.4.0 // indirect
+
 require (
 	github.com/alecthomas/jsonschema v0.0.0-20220216202328-9eeeec9d044b // indirect
-	github.com/aws/aws-sdk-go v1.54.3 // indirect
 	github.com/bahlo/generic-list-go v0.2.0 // indirect
 	github.com/buger/jsonparser v1.1.1 // indirect
+	github.com/falcosecurity/plugins/shared/go/mux v0.0.0-00010101000000-000000000000 // indirect
 	github.com/iancoleman/orderedmap v0.3.0 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
@@ -22,3 +30,19 @@ require (
 	github.com/wk8/go-ordered-map/v2 v2.1.8 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/falcosecurity/plugins/shared/go/secrets => ../../shared/go/secrets
+
+replace github.com/falcosecurity/plugins/shared/go/health => ../../shared/go/health
+
+replace github.com/falcosecurity/plugins/shared/go/metrics => ../../shared/go/metrics
+
+replace github.com/falcosecurity/plugins/shared/go/errkind => ../../shared/go/errkind
+
+replace github.com/falcosecurity/plugins/shared/go/tail => ../../shared/go/tail
+
+replace github.com/falcosecurity/plugins/shared/go/batch => ../../shared/go/batch
+
+replace github.com/falcosecurity/plugins/shared/go/conformance => ../../shared/go/conformance
+
+replace github.com/falcosecurity/plugins/shared/go/mux => ../../shared/go/mux
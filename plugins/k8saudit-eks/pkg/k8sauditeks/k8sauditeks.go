@@ -20,13 +20,14 @@ package k8sauditeks
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"os"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
@@ -34,6 +35,10 @@ import (
 	"github.com/falcosecurity/plugins/plugins/k8saudit/pkg/k8saudit"
 	"github.com/falcosecurity/plugins/shared/go/aws/cloudwatchlogs"
 	"github.com/falcosecurity/plugins/shared/go/aws/session"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	"github.com/falcosecurity/plugins/shared/go/secrets"
 	"github.com/invopop/jsonschema"
 )
 
@@ -44,8 +49,10 @@ var regExpCAuditID *regexp.Regexp
 
 type Plugin struct {
 	k8saudit.Plugin
-	Logger *log.Logger
-	Config PluginConfig
+	Logger  *log.Logger
+	Config  PluginConfig
+	health  *health.Server
+	metrics *metrics.Metrics
 }
 
 type PluginConfig struct {
@@ -55,6 +62,10 @@ type PluginConfig struct {
 	Shift           uint64 `json:"shift"            jsonschema:"title=shift,description=Time shift in past in seconds (default: 1s),default=1"`
 	PollingInterval uint64 `json:"polling_interval" jsonschema:"title=polling_interval,description=Polling Interval in seconds (default: 5s),default=5"`
 	UseAsync        bool   `json:"use_async"        jsonschema:"title=use_async,description=If true then async extraction optimization is enabled (default: true),default=true"`
+	HealthAddress   string `json:"health_address"   jsonschema:"title=health_address,description=Address (e.g. :8081) of an HTTP server exposing the health and readiness endpoints of the plugin (default: empty for disabled)"`
+	HealthPath      string `json:"health_path"      jsonschema:"title=health_path,description=Path of the health endpoint. The readiness endpoint is served under <path>/ready (default: /healthz),default=/healthz"`
+	MetricsAddress  string `json:"metrics_address"  jsonschema:"title=metrics_address,description=Address (e.g. :9090) of the Prometheus endpoint shared by the plugins of the Falco process configured with the same address (default: empty for disabled)"`
+	MetricsPath     string `json:"metrics_path"     jsonschema:"title=metrics_path,description=Path of the Prometheus endpoint (default: /metrics),default=/metrics"`
 }
 
 func (k *Plugin) Info() *plugins.Info {
@@ -83,18 +94,23 @@ func (p *PluginConfig) Reset() {
 		p.Region = i
 	}
 	p.UseAsync = true
+	p.HealthPath = health.DefaultPath
+	p.MetricsPath = metrics.DefaultPath
 	// for PollingInterval, Shift and BufferSize, the default values from the package are used automatically
 }
 
-func (k *Plugin) Init(cfg string) error {
+func (k *Plugin) Init(cfg string) (err error) {
 	// read configuration
 	k.Plugin.Config.Reset()
 	k.Config.Reset()
 
-	err := json.Unmarshal([]byte(cfg), &k.Config)
+	err = json.Unmarshal([]byte(cfg), &k.Config)
 	if err != nil {
 		return err
 	}
+	if err = secrets.Resolve(&k.Config); err != nil {
+		return err
+	}
 
 	regExpCAuditID, err = regexp.Compile(regExpAuditID)
 	if err != nil {
@@ -106,9 +122,52 @@ func (k *Plugin) Init(cfg string) error {
 
 	k.Logger = log.New(os.Stderr, "["+pluginName+"] ", log.LstdFlags|log.LUTC|log.Lmsgprefix)
 
+	// the framework doesn't call Destroy when Init fails, so the servers
+	// started before a failure are stopped here
+	defer func() {
+		if err != nil {
+			k.Destroy()
+		}
+	}()
+
+	// start the optional health server
+	if len(k.Config.HealthAddress) > 0 {
+		srv, err := health.Start(k.Config.HealthAddress, k.Config.HealthPath)
+		if err != nil {
+			return err
+		}
+		k.health = srv
+	}
+
+	// start the optional metrics endpoint
+	if len(k.Config.MetricsAddress) > 0 {
+		m, err := metrics.Start(k.Config.MetricsAddress, k.Config.MetricsPath, pluginName)
+		if err != nil {
+			return err
+		}
+		k.metrics = m
+	}
 	return nil
 }
 
+func (k *Plugin) Destroy() {
+	if k.health != nil {
+		k.health.Close()
+		k.health = nil
+	}
+	if k.metrics != nil {
+		k.metrics.Close()
+		k.metrics = nil
+	}
+}
+
+func (k *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
+	if k.metrics != nil {
+		defer k.metrics.ObserveExtraction(time.Now())
+	}
+	return k.Plugin.Extract(req, evt)
+}
+
 func (p *Plugin) InitSchema() *sdk.SchemaInfo {
 	reflector := jsonschema.Reflector{
 		// all properties are optional by default
@@ -131,8 +190,12 @@ func (p *Plugin) OpenParams() ([]sdk.OpenParam, error) {
 }
 
 func (p *Plugin) Open(clustername string) (source.Instance, error) {
+	clustername, err := secrets.ExpandEnv(clustername)
+	if err != nil {
+		return nil, errkind.Count(errkind.New(errkind.Config, err), p.metrics)
+	}
 	if clustername == "" {
-		return nil, fmt.Errorf("cluster name can't be empty")
+		return nil, errkind.Count(errkind.Errorf(errkind.Config, "cluster name can't be empty"), p.metrics)
 	}
 	filter := cloudwatchlogs.CreateFilter("", "/aws/eks/"+clustername+"/cluster", "kube-apiserver-audit", nil)
 	client := cloudwatchlogs.CreateClient(session.CreateSession(p.Config.Region, p.Config.Profile), nil)
@@ -144,6 +207,11 @@ func (p *Plugin) Open(clustername string) (source.Instance, error) {
 	)
 	eventsC, errC := client.Open(ctx, filter, options)
 	pushEventC := make(chan source.PushEvent)
+
+	// the instance is connected as long as it polls Cloudwatch Logs, the
+	// polling errors being fatal
+	tracker := p.health.Track()
+	tracker.SetConnected(true)
 	go func() {
 		for {
 			select {
@@ -152,26 +220,33 @@ func (p *Plugin) Open(clustername string) (source.Instance, error) {
 				if strings.HasSuffix(message, "[Truncated...]") {
 					auditID := regExpCAuditID.FindStringSubmatch(message)
 					if len(auditID) > 0 {
-						p.Logger.Printf("truncated log line, can't be parsed (%v)\n", auditID[0])
+						p.Logger.Println(errkind.Count(errkind.Errorf(errkind.Parse, "truncated log line, can't be parsed (%v)", auditID[0]), p.metrics))
 					} else {
-						p.Logger.Println("truncated log line, can't be parsed")
+						p.Logger.Println(errkind.Count(errkind.Errorf(errkind.Parse, "truncated log line, can't be parsed"), p.metrics))
 					}
 					continue
 				}
 				values, err := p.Plugin.ParseAuditEventsPayload([]byte(*i.Message))
 				if err != nil {
-					p.Logger.Println(err)
+					p.Logger.Println(errkind.Count(errkind.New(errkind.Parse, err), p.metrics))
+					tracker.Error()
+					p.metrics.UpstreamError()
 					continue
 				}
+				tracker.Event()
 				for _, j := range values {
 					if j.Err != nil {
-						p.Logger.Println(j.Err)
+						p.Logger.Println(errkind.Count(errkind.New(errkind.Parse, j.Err), p.metrics))
 						continue
 					}
 					pushEventC <- *j
+					p.metrics.Ingested(len(j.Data), j.Timestamp)
 				}
 			case e := <-errC:
-				pushEventC <- source.PushEvent{Err: e}
+				tracker.SetConnected(false)
+				tracker.Error()
+				p.metrics.UpstreamError()
+				pushEventC <- source.PushEvent{Err: errkind.Count(errkind.New(awsErrorKind(e), e), p.metrics)}
 				// errors are blocking, so we can stop here
 				return
 			}
@@ -179,6 +254,27 @@ func (p *Plugin) Open(clustername string) (source.Instance, error) {
 	}()
 	return source.NewPushInstance(
 		pushEventC,
-		source.WithInstanceClose(cancel),
+		source.WithInstanceClose(func() {
+			cancel()
+			tracker.Close()
+		}),
 	)
 }
+
+// awsErrorKind returns the category of an error returned by the AWS SDK,
+// from its error code when it's an API error
+func awsErrorKind(err error) errkind.Kind {
+	var aErr awserr.Error
+	if errors.As(err, &aErr) {
+		switch aErr.Code() {
+		case "AccessDeniedException", "ExpiredTokenException", "UnrecognizedClientException",
+			"InvalidClientTokenId", "NoCredentialProviders":
+			return errkind.Auth
+		case "ThrottlingException", "LimitExceededException":
+			return errkind.RateLimited
+		case "ResourceNotFoundException":
+			return errkind.Config
+		}
+	}
+	return errkind.Of(err)
+}
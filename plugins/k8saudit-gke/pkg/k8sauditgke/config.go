@@ -22,6 +22,8 @@ import (
 
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
 	"github.com/falcosecurity/plugins/plugins/k8saudit/pkg/k8saudit"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
 	"github.com/patrickmn/go-cache"
 	"google.golang.org/api/container/v1"
 )
@@ -33,6 +35,8 @@ type Plugin struct {
 
 	containerService *container.Service
 	metadataCache    *cache.Cache
+	health           *health.Server
+	metrics          *metrics.Metrics
 }
 
 type PluginConfig struct {
@@ -44,6 +48,10 @@ type PluginConfig struct {
 	CacheExpiration        uint64 `json:"cache_expiration"         jsonschema:"title=Cluster metadata cache expiration (in minutes),description=(Default: 10),default=10"`
 	UseAsync               bool   `json:"use_async"                jsonschema:"title=Use async extraction,description=If true then async extraction optimization is enabled (Default: true),default=true"`
 	MaxEventSize           uint64 `json:"max_event_size"           jsonschema:"title=Maximum event size,description=Maximum size of single audit event (Default: 262144),default=262144"`
+	HealthAddress          string `json:"health_address"           jsonschema:"title=Health address,description=Address (e.g. :8081) of an HTTP server exposing the health and readiness endpoints of the plugin (Default: empty for disabled),default="`
+	HealthPath             string `json:"health_path"              jsonschema:"title=Health path,description=Path of the health endpoint. The readiness endpoint is served under <path>/ready (Default: /healthz),default=/healthz"`
+	MetricsAddress         string `json:"metrics_address"          jsonschema:"title=Metrics address,description=Address (e.g. :9090) of the Prometheus endpoint shared by the plugins of the Falco process configured with the same address (Default: empty for disabled),default="`
+	MetricsPath            string `json:"metrics_path"             jsonschema:"title=Metrics path,description=Path of the Prometheus endpoint (Default: /metrics),default=/metrics"`
 }
 
 // Reset sets the configuration to its default values
@@ -56,4 +64,8 @@ func (p *PluginConfig) Reset() {
 	p.CacheExpiration = 10
 	p.UseAsync = true
 	p.MaxEventSize = uint64(sdk.DefaultEvtSize)
+	p.HealthAddress = ""
+	p.HealthPath = health.DefaultPath
+	p.MetricsAddress = ""
+	p.MetricsPath = metrics.DefaultPath
 }
@@ -28,6 +28,9 @@ import (
 	"github.com/alecthomas/jsonschema"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/symbols/extract"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	"github.com/falcosecurity/plugins/shared/go/secrets"
 	"github.com/patrickmn/go-cache"
 )
 
@@ -45,13 +48,16 @@ func (p *Plugin) InitSchema() *sdk.SchemaInfo {
 }
 
 // initialize state
-func (p *Plugin) Init(cfg string) error {
+func (p *Plugin) Init(cfg string) (err error) {
 	p.Config.Reset()
 
-	err := json.Unmarshal([]byte(cfg), &p.Config)
+	err = json.Unmarshal([]byte(cfg), &p.Config)
 	if err != nil {
 		return err
 	}
+	if err = secrets.Resolve(&p.Config); err != nil {
+		return err
+	}
 
 	// setup optional async extraction optimization
 	extract.SetAsync(p.Config.UseAsync)
@@ -69,5 +75,48 @@ func (p *Plugin) Init(cfg string) error {
 		p.metadataCache = cache.New(expiration, expiration+30)
 	}
 
+	// the framework doesn't call Destroy when Init fails, so the servers
+	// started before a failure are stopped here
+	defer func() {
+		if err != nil {
+			p.Destroy()
+		}
+	}()
+
+	// start the optional health server
+	if len(p.Config.HealthAddress) > 0 {
+		srv, err := health.Start(p.Config.HealthAddress, p.Config.HealthPath)
+		if err != nil {
+			return err
+		}
+		p.health = srv
+	}
+
+	// start the optional metrics endpoint
+	if len(p.Config.MetricsAddress) > 0 {
+		m, err := metrics.Start(p.Config.MetricsAddress, p.Config.MetricsPath, PluginName)
+		if err != nil {
+			return err
+		}
+		p.metrics = m
+	}
 	return nil
 }
+
+func (p *Plugin) Destroy() {
+	if p.health != nil {
+		p.health.Close()
+		p.health = nil
+	}
+	if p.metrics != nil {
+		p.metrics.Close()
+		p.metrics = nil
+	}
+}
+
+func (p *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
+	if p.metrics != nil {
+		defer p.metrics.ObserveExtraction(time.Now())
+	}
+	return p.Plugin.Extract(req, evt)
+}
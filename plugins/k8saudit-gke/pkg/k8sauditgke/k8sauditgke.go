@@ -25,6 +25,8 @@ import (
 
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/secrets"
 	"google.golang.org/api/container/v1"
 	"google.golang.org/api/option"
 )
@@ -50,8 +52,12 @@ func (p *Plugin) Info() *plugins.Info {
 }
 
 func (p *Plugin) Open(params string) (source.Instance, error) {
+	params, err := secrets.ExpandEnv(params)
+	if err != nil {
+		return nil, errkind.Count(errkind.New(errkind.Config, err), p.metrics)
+	}
 	if params == "" {
-		return nil, fmt.Errorf("no subscriptionID provided")
+		return nil, errkind.Count(errkind.Errorf(errkind.Config, "no subscriptionID provided"), p.metrics)
 	}
 
 	// Read audit logs from file, instead of PubSub subscription, for debugging purposes
@@ -61,7 +67,8 @@ func (p *Plugin) Open(params string) (source.Instance, error) {
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
-	eventsC, errC := p.pullMsgsSync(ctx, subscriptionID)
+	tracker := p.health.Track()
+	eventsC, errC := p.pullMsgsSync(ctx, subscriptionID, tracker)
 
 	pushEventC := make(chan source.PushEvent)
 	go func() {
@@ -69,15 +76,23 @@ func (p *Plugin) Open(params string) (source.Instance, error) {
 		for {
 			select {
 			case event := <-eventsC:
+				tracker.Event()
 				pushEventC <- event
+				p.metrics.Ingested(len(event.Data), event.Timestamp)
 			case e := <-errC:
-				pushEventC <- source.PushEvent{Err: e}
+				tracker.SetConnected(false)
+				tracker.Error()
+				p.metrics.UpstreamError()
+				pushEventC <- source.PushEvent{Err: errkind.Count(e, p.metrics)}
 				return
 			}
 		}
 	}()
 
-	return source.NewPushInstance(pushEventC, source.WithInstanceClose(cancel))
+	return source.NewPushInstance(pushEventC, source.WithInstanceClose(func() {
+		cancel()
+		tracker.Close()
+	}))
 }
 
 func (p *Plugin) newFileReaderInstance(file string) (source.Instance, error) {
@@ -29,13 +29,18 @@ import (
 	"cloud.google.com/go/pubsub"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/backoff"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/health"
 	"google.golang.org/api/option"
 	"google.golang.org/genproto/googleapis/cloud/audit"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 )
 
-func (p *Plugin) pullMsgsSync(ctx context.Context, subscriptionID string) (chan source.PushEvent, chan error) {
+func (p *Plugin) pullMsgsSync(ctx context.Context, subscriptionID string, tracker *health.Tracker) (chan source.PushEvent, chan error) {
 	var clientOptions []option.ClientOption
 	if len(p.Config.CredentialsFile) > 0 {
 		clientOptions = append(clientOptions, option.WithCredentialsFile(p.Config.CredentialsFile))
@@ -50,40 +55,73 @@ func (p *Plugin) pullMsgsSync(ctx context.Context, subscriptionID string) (chan
 		// create pubsub client
 		client, err := pubsub.NewClient(ctx, p.Config.ProjectID, clientOptions...)
 		if err != nil {
-			errC <- err
+			errC <- errkind.New(pubsubErrorKind(err), err)
 			return
 		}
 
-		// attempt subscribing with exponential backoff
+		// attempt subscribing with exponential backoff, the plugin being
+		// reported as disconnected while the breaker is open after
+		// repeated quota errors
 		sub := client.Subscription(subscriptionID)
 		sub.ReceiveSettings.MaxOutstandingMessages = p.Config.MaxOutstandingMessages
 		sub.ReceiveSettings.NumGoroutines = p.Config.NumGoroutines
-		maxRetries := 3
-		retryDelay := time.Second
-		for retries := 0; retries < maxRetries; retries++ {
-			err = p.performPubSubOperation(sub, ctx, eventC)
-			if err == nil {
-				// Operation succeeded, break out of the loop
-				return
-			} else if isQuotaExceededError(err) {
-				// Quota exceeded, wait for backoff duration and retry
-				p.logger.Printf("pubsub receive quota exceeded, retrying in %s\n", retryDelay.String())
-				time.Sleep(retryDelay)
-				retryDelay *= 2 // exponential backoff
-			} else {
-				errC <- err
-				return
-			}
+		breaker := backoff.NewBreaker(pubsubBreakerThreshold, pubsubBreakerCooldown, func(s backoff.State) {
+			tracker.SetConnected(s != backoff.Open)
+		})
+		// Receive blocks as long as the subscription is consumed
+		tracker.SetConnected(true)
+		err = backoff.Retry(ctx, backoff.Options{
+			Breaker:   breaker,
+			Retryable: isQuotaExceededError,
+			OnRetry: func(err error, delay time.Duration) {
+				qErr := errkind.Errorf(errkind.RateLimited, "pubsub receive quota exceeded")
+				p.logger.Printf("%s, retrying in %s\n", errkind.Count(qErr, p.metrics), delay.String())
+				tracker.Error()
+				p.metrics.UpstreamError()
+			},
+		}, func(ctx context.Context) error {
+			return p.performPubSubOperation(sub, ctx, eventC)
+		})
+		if err != nil && ctx.Err() == nil {
+			errC <- errkind.New(pubsubErrorKind(err), err)
 		}
 	}()
 
 	return eventC, errC
 }
 
+const (
+	// pubsubBreakerThreshold is the number of consecutive quota errors
+	// after which the subscription isn't received for a cooldown period
+	pubsubBreakerThreshold = 3
+	// pubsubBreakerCooldown is the cooldown period of the breaker
+	pubsubBreakerCooldown = 5 * time.Minute
+)
+
 func isQuotaExceededError(err error) bool {
 	return strings.Contains(err.Error(), "quota exceeded")
 }
 
+// pubsubErrorKind returns the category of an error returned by Pub/Sub, from
+// its gRPC status code
+func pubsubErrorKind(err error) errkind.Kind {
+	s, ok := status.FromError(err)
+	if !ok {
+		return errkind.Of(err)
+	}
+	switch s.Code() {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return errkind.Auth
+	case codes.ResourceExhausted:
+		return errkind.RateLimited
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal:
+		return errkind.Unavailable
+	case codes.NotFound, codes.InvalidArgument, codes.FailedPrecondition:
+		return errkind.Config
+	}
+	return errkind.Of(err)
+}
+
 func (p *Plugin) performPubSubOperation(subscription *pubsub.Subscription, ctx context.Context, eventC chan source.PushEvent) error {
 	return subscription.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
 		defer msg.Ack()
@@ -91,7 +129,8 @@ func (p *Plugin) performPubSubOperation(subscription *pubsub.Subscription, ctx c
 		logEntry := &logging.LogEntry{}
 		err := protojson.Unmarshal(msg.Data, logEntry)
 		if err != nil {
-			p.logger.Printf("failed to unmarshal PubSub message to log entry: %v\n", err)
+			err = errkind.Errorf(errkind.Parse, "failed to unmarshal PubSub message to log entry: %v", err)
+			p.logger.Printf("%s\n", errkind.Count(err, p.metrics))
 			return
 		}
 
@@ -107,7 +146,8 @@ func (p *Plugin) performPubSubOperation(subscription *pubsub.Subscription, ctx c
 				auditLog := &audit.AuditLog{}
 				err := proto.UnmarshalOptions{DiscardUnknown: false}.Unmarshal(payload.ProtoPayload.Value, auditLog)
 				if err != nil {
-					p.logger.Printf("failed to unmarshal log entry payload (insertId=%s): %v\n", logEntry.InsertId, err)
+					err = errkind.Errorf(errkind.Parse, "failed to unmarshal log entry payload (insertId=%s): %v", logEntry.InsertId, err)
+					p.logger.Printf("%s\n", errkind.Count(err, p.metrics))
 					return
 				}
 
@@ -5,6 +5,53 @@ go 1.15
 require (
 	github.com/alecthomas/jsonschema v0.0.0-20220216202328-9eeeec9d044b
 	github.com/falcosecurity/plugin-sdk-go v0.7.4
+	github.com/falcosecurity/plugins/shared/go/batch v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/bufpool v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/conformance v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/debugserver v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/errkind v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/fuzz v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/golden v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/health v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/intern v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/metrics v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/secrets v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/tail v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/webhook/cloudevents v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/webhook/queue v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/webhook/server v0.0.0-00010101000000-000000000000
 	github.com/iancoleman/orderedmap v0.3.0 // indirect
 	github.com/valyala/fastjson v1.6.4
 )
+
+replace github.com/falcosecurity/plugins/shared/go/bufpool => ../../shared/go/bufpool
+
+replace github.com/falcosecurity/plugins/shared/go/webhook/queue => ../../shared/go/webhook/queue
+
+replace github.com/falcosecurity/plugins/shared/go/debugserver => ../../shared/go/debugserver
+
+replace github.com/falcosecurity/plugins/shared/go/intern => ../../shared/go/intern
+
+replace github.com/falcosecurity/plugins/shared/go/golden => ../../shared/go/golden
+
+replace github.com/falcosecurity/plugins/shared/go/fuzz => ../../shared/go/fuzz
+
+replace github.com/falcosecurity/plugins/shared/go/webhook/cloudevents => ../../shared/go/webhook/cloudevents
+
+replace github.com/falcosecurity/plugins/shared/go/secrets => ../../shared/go/secrets
+
+replace github.com/falcosecurity/plugins/shared/go/health => ../../shared/go/health
+
+replace github.com/falcosecurity/plugins/shared/go/metrics => ../../shared/go/metrics
+
+replace github.com/falcosecurity/plugins/shared/go/errkind => ../../shared/go/errkind
+
+replace github.com/falcosecurity/plugins/shared/go/webhook/server => ../../shared/go/webhook/server
+
+replace github.com/falcosecurity/plugins/shared/go/tail => ../../shared/go/tail
+
+replace github.com/falcosecurity/plugins/shared/go/batch => ../../shared/go/batch
+
+replace github.com/falcosecurity/plugins/shared/go/conformance => ../../shared/go/conformance
+
+replace github.com/falcosecurity/plugins/shared/go/mux => ../../shared/go/mux
@@ -17,13 +17,25 @@ limitations under the License.
 
 package k8saudit
 
-import "github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+import (
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	"github.com/falcosecurity/plugins/shared/go/webhook/queue"
+)
 
 type PluginConfig struct {
 	SSLCertificate      string `json:"sslCertificate"       jsonschema:"title=SSL certificate,description=The SSL Certificate to be used with the HTTPS Webhook endpoint (Default: /etc/falco/falco.pem),default=/etc/falco/falco.pem"`
 	UseAsync            bool   `json:"useAsync"             jsonschema:"title=Use async extraction,description=If true then async extraction optimization is enabled (Default: true),default=true"`
 	MaxEventSize        uint64 `json:"maxEventSize"         jsonschema:"title=Maximum event size,description=Maximum size of single audit event (Default: 262144),default=262144"`
 	WebhookMaxBatchSize uint64 `json:"webhookMaxBatchSize"  jsonschema:"title=Maximum webhook request size,description=Maximum size of incoming webhook POST request bodies (Default: 12582912),default=12582912"`
+	WebhookQueueSize    uint64 `json:"webhookQueueSize"     jsonschema:"title=Webhook queue size,description=Maximum number of webhook requests waiting to be consumed (Default: 50),default=50"`
+	WebhookOverflow     string `json:"webhookOverflow"      jsonschema:"title=Webhook queue overflow policy,enum=block,enum=drop_oldest,enum=reject,description=What to do with incoming webhook requests when the queue is full: block waits for room and drop_oldest drops the oldest queued request while reject answers with 429 Too Many Requests (Default: block),default=block"`
+	DebugAddress        string `json:"debugAddress"         jsonschema:"title=Debug address,description=Loopback address (e.g. localhost:6060) of an HTTP server exposing the pprof and expvar endpoints of the plugin (Default: empty for disabled),default="`
+	HealthAddress       string `json:"healthAddress"        jsonschema:"title=Health address,description=Address (e.g. :8081) of an HTTP server exposing the health and readiness endpoints of the plugin (Default: empty for disabled),default="`
+	HealthPath          string `json:"healthPath"           jsonschema:"title=Health path,description=Path of the health endpoint. The readiness endpoint is served under <path>/ready (Default: /healthz),default=/healthz"`
+	MetricsAddress      string `json:"metricsAddress"       jsonschema:"title=Metrics address,description=Address (e.g. :9090) of the Prometheus endpoint shared by the plugins of the Falco process configured with the same address (Default: empty for disabled),default="`
+	MetricsPath         string `json:"metricsPath"          jsonschema:"title=Metrics path,description=Path of the Prometheus endpoint (Default: /metrics),default=/metrics"`
 }
 
 // Resets sets the configuration to its default values
@@ -38,4 +50,8 @@ func (k *PluginConfig) Reset() {
 	// The following values have been chosen by increasing by ~20% the default
 	// values of the K8S docs
 	k.WebhookMaxBatchSize = 12 * 1024 * 1024
+	k.WebhookQueueSize = 50
+	k.WebhookOverflow = string(queue.PolicyBlock)
+	k.HealthPath = health.DefaultPath
+	k.MetricsPath = metrics.DefaultPath
 }
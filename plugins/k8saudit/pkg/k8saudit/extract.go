@@ -20,11 +20,13 @@ package k8saudit
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugins/shared/go/bufpool"
+	"github.com/falcosecurity/plugins/shared/go/webhook/cloudevents"
 	"github.com/valyala/fastjson"
 )
 
@@ -54,6 +56,9 @@ var (
 )
 
 func (k *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
+	if k.metrics != nil {
+		defer k.metrics.ObserveExtraction(time.Now())
+	}
 	err := k.ExtractFromEvent(req, evt)
 	// We want to keep not-available errors internal. Propagating
 	// this error is useful to implement a clean extraction logic, however
@@ -85,11 +90,13 @@ func (e *Plugin) DecodeReader(evtNum uint64, reader io.ReadSeeker) (*fastjson.Va
 		if err != nil {
 			return nil, err
 		}
-		data, err = ioutil.ReadAll(reader)
+		buf, err := bufpool.ReadAll(reader)
 		if err != nil {
 			return nil, err
 		}
-		e.jdata, err = e.jparser.ParseBytes(data)
+		// the parser copies the data, so the buffer can be released
+		e.jdata, err = e.jparser.ParseBytes(buf.Bytes())
+		bufpool.Put(buf)
 		if err != nil {
 			return nil, err
 		}
@@ -120,6 +127,9 @@ func (e *Plugin) ExtractFromJSON(req sdk.ExtractRequest, jsonValue *fastjson.Val
 	if jsonValue.Get("auditID") == nil {
 		return ErrExtractNotAvailable
 	}
+	if cloudevents.IsField(req.Field()) {
+		return cloudevents.Extract(req, jsonValue)
+	}
 	switch req.Field() {
 	case "ka.auditid":
 		return e.extractFromKeys(req, jsonValue, "auditID")
@@ -133,6 +143,8 @@ func (e *Plugin) ExtractFromJSON(req sdk.ExtractRequest, jsonValue *fastjson.Val
 		return e.extractFromKeys(req, jsonValue, "annotations", "authentication.openshift.io/decision")
 	case "ka.auth.openshift.username":
 		return e.extractFromKeys(req, jsonValue, "annotations", "authentication.openshift.io/username")
+	case "ka.annotations":
+		return e.extractFromKeys(req, jsonValue, "annotations", req.ArgKey())
 	case "ka.user.name":
 		return e.extractFromKeys(req, jsonValue, "user", "username")
 	case "ka.user.groups":
@@ -425,7 +437,7 @@ func (e *Plugin) getValuesRecursive(jsonValue *fastjson.Value, indexFilter int,
 				return res, nil
 			}
 			arr := jsonValue.GetArray()
-			if arr == nil || indexFilter >= len(arr) {
+			if arr == nil || indexFilter < 0 || indexFilter >= len(arr) {
 				return nil, ErrExtractNotAvailable
 			}
 			jsonValue = arr[indexFilter]
@@ -601,10 +613,13 @@ func (e *Plugin) extractFromKeys(req sdk.ExtractRequest, jsonValue *fastjson.Val
 	return nil
 }
 
+// jsonValueAsString returns the string representation of a json value.
+// Strings are interned, since most of them repeat across events, like
+// the verbs, the users or the namespaces.
 func (e *Plugin) jsonValueAsString(v *fastjson.Value) (string, error) {
 	if v != nil {
 		if v.Type() == fastjson.TypeString {
-			return string(v.GetStringBytes()), nil
+			return e.strs.Bytes(v.GetStringBytes()), nil
 		}
 		return string(string(v.MarshalTo(nil))), nil
 	}
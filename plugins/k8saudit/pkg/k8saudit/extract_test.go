@@ -27,6 +27,7 @@ import (
 	"unsafe"
 
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugins/shared/go/golden"
 )
 
 type testExtractRequest struct {
@@ -160,3 +161,13 @@ func BenchmarkExtractFromJSON(b *testing.B) {
 	b.ReportMetric(exOp, "extractions/op")
 	b.ReportMetric(nsOp/exOp, "ns/extraction/op")
 }
+
+func TestExtractGolden(t *testing.T) {
+	p := &Plugin{}
+	golden.Run(t, p, "testdata/golden", append(golden.DefaultFields(p),
+		"ka.annotations[authorization.k8s.io/decision]",
+		"ka.req.pod.containers.image[0]",
+		"ka.req.pod.containers.privileged[0]",
+		"ce.extension[traceparent]",
+	)...)
+}
@@ -19,11 +19,13 @@ package k8saudit
 
 import (
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugins/shared/go/webhook/cloudevents"
 )
 
-// Fields returns the list of extractor fields exported for K8S Audit events.
+// Fields returns the list of extractor fields exported for K8S Audit events,
+// including the fields of the CloudEvents envelopes.
 func (k *Plugin) Fields() []sdk.FieldEntry {
-	return []sdk.FieldEntry{
+	return append([]sdk.FieldEntry{
 		{
 			Type: "string",
 			Name: "ka.auditid",
@@ -54,6 +56,15 @@ func (k *Plugin) Fields() []sdk.FieldEntry {
 			Name: "ka.auth.openshift.username",
 			Desc: "The user name performing the openshift authentication operation. Only available on openshift clusters",
 		},
+		{
+			Type: "string",
+			Name: "ka.annotations",
+			Desc: "The value of a given annotation of the audit event (e.g. ka.annotations[authorization.k8s.io/decision] or ka.annotations[pod-security.kubernetes.io/enforce-policy]).",
+			Arg: sdk.FieldEntryArg{
+				IsRequired: true,
+				IsKey:      true,
+			},
+		},
 		{
 			Type: "string",
 			Name: "ka.user.name",
@@ -455,5 +466,5 @@ func (k *Plugin) Fields() []sdk.FieldEntry {
 			Name: "ka.cluster.name",
 			Desc: "The name of the k8s cluster",
 		},
-	}
+	}, cloudevents.Fields()...)
 }
@@ -26,6 +26,12 @@ import (
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/symbols/extract"
+	"github.com/falcosecurity/plugins/shared/go/debugserver"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/intern"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	"github.com/falcosecurity/plugins/shared/go/secrets"
+	"github.com/falcosecurity/plugins/shared/go/webhook/queue"
 	"github.com/valyala/fastjson"
 )
 
@@ -46,6 +52,10 @@ type Plugin struct {
 	jparser     fastjson.Parser
 	jdata       *fastjson.Value
 	jdataEvtnum uint64
+	strs        intern.Pool
+	debugServer *debugserver.Server
+	health      *health.Server
+	metrics     *metrics.Metrics
 }
 
 func (k *Plugin) Info() *plugins.Info {
@@ -59,22 +69,78 @@ func (k *Plugin) Info() *plugins.Info {
 	}
 }
 
-func (k *Plugin) Init(cfg string) error {
+func (k *Plugin) Init(cfg string) (err error) {
 	// read configuration
 	k.Config.Reset()
-	err := json.Unmarshal([]byte(cfg), &k.Config)
+	err = json.Unmarshal([]byte(cfg), &k.Config)
 	if err != nil {
 		return err
 	}
+	if err = secrets.Resolve(&k.Config); err != nil {
+		return err
+	}
+	if _, err = queue.ParsePolicy(k.Config.WebhookOverflow); err != nil {
+		return err
+	}
 
 	// setup optional async extraction optimization
 	extract.SetAsync(k.Config.UseAsync)
 
 	// setup internal logger
 	k.logger = log.New(os.Stderr, "["+pluginName+"] ", log.LstdFlags|log.LUTC|log.Lmsgprefix)
+
+	// the framework doesn't call Destroy when Init fails, so the servers
+	// started before a failure are stopped here
+	defer func() {
+		if err != nil {
+			k.Destroy()
+		}
+	}()
+
+	// start the optional pprof and expvar server
+	if len(k.Config.DebugAddress) > 0 {
+		srv, err := debugserver.Start(k.Config.DebugAddress)
+		if err != nil {
+			return err
+		}
+		k.debugServer = srv
+	}
+
+	// start the optional health server
+	if len(k.Config.HealthAddress) > 0 {
+		srv, err := health.Start(k.Config.HealthAddress, k.Config.HealthPath)
+		if err != nil {
+			return err
+		}
+		k.health = srv
+	}
+
+	// start the optional metrics endpoint
+	if len(k.Config.MetricsAddress) > 0 {
+		m, err := metrics.Start(k.Config.MetricsAddress, k.Config.MetricsPath, pluginName)
+		if err != nil {
+			return err
+		}
+		k.metrics = m
+	}
 	return nil
 }
 
+func (k *Plugin) Destroy() {
+	if k.debugServer != nil {
+		k.debugServer.Close()
+		k.debugServer = nil
+	}
+	if k.health != nil {
+		k.health.Close()
+		k.health = nil
+	}
+	if k.metrics != nil {
+		k.metrics.Close()
+		k.metrics = nil
+	}
+}
+
 func (p *Plugin) InitSchema() *sdk.SchemaInfo {
 	reflector := jsonschema.Reflector{
 		// all properties are optional by default
@@ -26,24 +26,45 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
-	"sort"
 
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/batch"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	"github.com/falcosecurity/plugins/shared/go/secrets"
+	"github.com/falcosecurity/plugins/shared/go/tail"
+	"github.com/falcosecurity/plugins/shared/go/webhook/cloudevents"
+	"github.com/falcosecurity/plugins/shared/go/webhook/queue"
+	"github.com/falcosecurity/plugins/shared/go/webhook/server"
 	"github.com/valyala/fastjson"
 )
 
 const (
-	webServerShutdownTimeoutSecs = 5
-	webServerEventChanBufSize    = 50
+	webServerQueueReportSecs = 10
 )
 
 func (k *Plugin) Open(params string) (source.Instance, error) {
+	inst, err := k.open(params)
+	if err != nil {
+		return nil, errkind.Count(err, k.metrics)
+	}
+	return metrics.Instance(inst, k.metrics), nil
+}
+
+func (k *Plugin) open(params string) (source.Instance, error) {
+	params, err := secrets.ExpandEnv(params)
+	if err != nil {
+		return nil, errkind.New(errkind.Config, err)
+	}
 	u, err := url.Parse(params)
 	if err != nil {
-		return nil, err
+		return nil, errkind.New(errkind.Config, err)
 	}
 
 	switch u.Scheme {
@@ -51,49 +72,88 @@ func (k *Plugin) Open(params string) (source.Instance, error) {
 		return k.OpenWebServer(u.Host, u.Path, false)
 	case "https":
 		return k.OpenWebServer(u.Host, u.Path, true)
+	case "replay":
+		speed := 1.0
+		if s := u.Query().Get("speed"); s != "" {
+			speed, err = strconv.ParseFloat(s, 64)
+			if err != nil || speed < 0 {
+				return nil, errkind.Errorf(errkind.Config, "invalid replay speed: %s", s)
+			}
+		}
+		r, err := openAuditFiles(u.Host + u.Path)
+		if err != nil {
+			return nil, err
+		}
+		return k.OpenReplay(r, speed)
+	case "tail":
+		return k.OpenTail(strings.TrimPrefix(strings.TrimSpace(params), "tail://"))
 	case "": // by default, fallback to opening a filepath
-		trimmed := strings.TrimSpace(params)
-
-		fileInfo, err := os.Stat(trimmed)
+		r, err := openAuditFiles(strings.TrimSpace(params))
 		if err != nil {
 			return nil, err
 		}
-		if !fileInfo.IsDir() {
-			file, err := os.Open(trimmed)
+		return k.OpenReader(r)
+	}
+
+	return nil, errkind.Errorf(errkind.Config, `scheme "%s" is not supported`, u.Scheme)
+}
+
+// openAuditFiles opens a file, or all the files of a directory sorted by
+// modification time, as a single io.ReadCloser
+func openAuditFiles(path string) (io.ReadCloser, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fileInfo.IsDir() {
+		return os.Open(path)
+	}
+
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+
+	// open all files as reader
+	res := &multiFileReader{}
+	results := []io.Reader{}
+	for _, f := range files {
+		if !f.IsDir() {
+			auditFile, err := os.Open(path + "/" + f.Name())
 			if err != nil {
+				res.Close()
 				return nil, err
 			}
-			return k.OpenReader(file)
+			res.files = append(res.files, auditFile)
+			results = append(results, auditFile)
+			results = append(results, strings.NewReader("\n"))
 		}
+	}
 
-		files, err := ioutil.ReadDir(trimmed)
-		if err != nil {
-			return nil, err
-		}
+	// concat the readers, which are all closed at once
+	res.Reader = io.MultiReader(results...)
+	return res, nil
+}
 
-		sort.Slice(files, func(i, j int) bool {
-			return files[i].ModTime().Before(files[j].ModTime())
-		})
-
-		// open all files as reader
-		results := []io.Reader{}
-		for _, f := range files {
-			if !f.IsDir() {
-				auditFile, err := os.Open(trimmed + "/" + f.Name())
-				if err != nil {
-					return nil, err
-				}
-				results = append(results, auditFile)
-				results = append(results, strings.NewReader("\n"))
-			}
-		}
+// multiFileReader reads several files one after the other, and closes
+// them all on Close
+type multiFileReader struct {
+	io.Reader
+	files []*os.File
+}
 
-		// concat the readers and wrap with a no-op Close method
-		AllAuditFiles := io.NopCloser(io.MultiReader(results...))
-		return k.OpenReader(AllAuditFiles)
+func (m *multiFileReader) Close() error {
+	var err error
+	for _, f := range m.files {
+		if cErr := f.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
 	}
-
-	return nil, fmt.Errorf(`scheme "%s" is not supported`, u.Scheme)
+	return err
 }
 
 // OpenReader opens a source.Instance event stream that reads K8S Audit
@@ -101,6 +161,9 @@ func (k *Plugin) Open(params string) (source.Instance, error) {
 // JSONL notation (see: https://jsonlines.org/).
 func (k *Plugin) OpenReader(r io.ReadCloser) (source.Instance, error) {
 	evtC := make(chan source.PushEvent)
+	tracker := k.health.Track()
+	tracker.SetConnected(true)
+	ctx, cancelCtx := context.WithCancel(context.Background())
 
 	go func() {
 		defer close(evtC)
@@ -108,112 +171,236 @@ func (k *Plugin) OpenReader(r io.ReadCloser) (source.Instance, error) {
 		scanner := bufio.NewScanner(r)
 		scanner.Split(bufio.ScanLines)
 		for scanner.Scan() {
-			line := scanner.Text()
-			if len(line) > 0 {
-				k.parseAuditEventsAndPush(&parser, ([]byte)(line), evtC)
+			// the parser copies the line, so the scanner buffer can be
+			// passed as is without converting it to a string first
+			line := scanner.Bytes()
+			if len(line) > 0 && !k.parseAuditEventsAndPush(ctx, &parser, line, evtC, tracker) {
+				return
 			}
 		}
 		err := scanner.Err()
 		if err != nil {
-			evtC <- source.PushEvent{Err: err}
+			tracker.Error()
+			k.metrics.UpstreamError()
+			select {
+			case evtC <- source.PushEvent{Err: errkind.Count(err, k.metrics)}:
+			case <-ctx.Done():
+			}
 		}
 	}()
 
 	return source.NewPushInstance(
 		evtC,
-		source.WithInstanceClose(func() { r.Close() }),
+		source.WithInstanceClose(func() {
+			cancelCtx()
+			r.Close()
+			tracker.Close()
+		}),
 		source.WithInstanceEventSize(uint32(k.Config.MaxEventSize)))
 }
 
-// OpenWebServer opens a source.Instance event stream that receives K8S Audit
-// Events by starting a server and listening for JSON webhooks. The expected
-// JSON format is the one of K8S API Server webhook backend
-// (see: https://kubernetes.io/docs/tasks/debug/debug-cluster/audit/#webhook-backend).
-func (k *Plugin) OpenWebServer(address, endpoint string, ssl bool) (source.Instance, error) {
+// OpenTail opens a source.Instance event stream that follows the log files
+// matching a glob pattern, such as the ones written by the log backend of
+// the K8S API Server, and reads the K8S Audit Events appended to them. The
+// files are followed across their rotations, and the events read at once
+// from several files are ordered by their stageTimestamp values. The lines
+// are read ahead in a buffer, whose backlog sizes the batches.
+func (k *Plugin) OpenTail(pattern string) (source.Instance, error) {
 	ctx, cancelCtx := context.WithCancel(context.Background())
-	serverEvtChan := make(chan []byte, webServerEventChanBufSize)
-	evtChan := make(chan source.PushEvent)
-
-	// launch webserver gorountine. This listens for webhooks coming from
-	// the k8s api server and sends every valid payload to serverEvtChan so
-	// that an HTTP response can be sent as soon as possible. Each payload is
-	// then parsed to extract the list of audit events contained by the
-	// event-parser goroutine
-	m := http.NewServeMux()
-	s := &http.Server{Addr: address, Handler: m}
-	sendBody := func(b []byte) {
-		defer func() {
-			if r := recover(); r != nil {
-				k.logger.Println("request dropped while shutting down server ")
-			}
-		}()
-		serverEvtChan <- b
+	lineC, errC, err := tail.Open(ctx, pattern, &tail.Options{
+		Timestamp: func(line []byte) (time.Time, bool) {
+			t, err := time.Parse(time.RFC3339Nano, fastjson.GetString(line, "stageTimestamp"))
+			return t, err == nil
+		},
+	})
+	if err != nil {
+		cancelCtx()
+		return nil, errkind.New(errkind.Config, err)
 	}
-	m.HandleFunc(endpoint, func(w http.ResponseWriter, req *http.Request) {
-		if req.Method != "POST" {
-			http.Error(w, fmt.Sprintf("%s method not allowed", req.Method), http.StatusMethodNotAllowed)
-			return
-		}
-		if !strings.Contains(req.Header.Get("Content-Type"), "application/json") {
-			http.Error(w, "wrong Content Type", http.StatusBadRequest)
-			return
+	buf := batch.NewBuffer(&batch.BufferOptions{EventSize: uint32(k.Config.MaxEventSize)})
+	tracker := k.health.Track()
+	tracker.SetConnected(true)
+
+	go func() {
+		evtC := buf.C()
+		defer close(evtC)
+		var parser fastjson.Parser
+		for line := range lineC {
+			if len(line.Data) > 0 {
+				k.parseAuditEventsAndPush(ctx, &parser, line.Data, evtC, tracker)
+			}
 		}
-		req.Body = http.MaxBytesReader(w, req.Body, int64(k.Config.WebhookMaxBatchSize))
-		bytes, err := ioutil.ReadAll(req.Body)
-		if err != nil {
-			msg := fmt.Sprintf("bad request: %s", err.Error())
-			k.logger.Println(msg)
-			http.Error(w, msg, http.StatusBadRequest)
-			return
+		if err := <-errC; err != nil {
+			tracker.Error()
+			k.metrics.UpstreamError()
+			buf.Push(source.PushEvent{Err: errkind.Count(err, k.metrics)})
 		}
-		w.WriteHeader(http.StatusOK)
-		sendBody(bytes)
+	}()
+
+	inst, err := batch.NewInstance(buf, func() {
+		cancelCtx()
+		tracker.Close()
 	})
+	if err != nil {
+		cancelCtx()
+		tracker.Close()
+		return nil, err
+	}
+	return inst, nil
+}
+
+// OpenReplay opens a source.Instance event stream that reads K8S Audit
+// Events from a io.ReadCloser like OpenReader, but emits them paced by their
+// original stageTimestamp values. The speed factor compresses the time between
+// two events (e.g. 10 replays 10 times faster), and 0 disables the pacing.
+func (k *Plugin) OpenReplay(r io.ReadCloser, speed float64) (source.Instance, error) {
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	readEvtC := make(chan source.PushEvent)
+	evtC := make(chan source.PushEvent)
+	tracker := k.health.Track()
+	tracker.SetConnected(true)
+
 	go func() {
-		defer close(serverEvtChan)
-		var err error
-		if ssl {
-			// note: the legacy K8S Audit implementation concatenated the key and cert PEM
-			// files, however this seems to be unusual. Here we use the same concatenated files
-			// for both key and cert, but we may want to split them (this seems to work though).
-			err = s.ListenAndServeTLS(k.Config.SSLCertificate, k.Config.SSLCertificate)
-		} else {
-			err = s.ListenAndServe()
+		defer close(readEvtC)
+		var parser fastjson.Parser
+		scanner := bufio.NewScanner(r)
+		scanner.Split(bufio.ScanLines)
+		for scanner.Scan() {
+			// the parser copies the line, so the scanner buffer can be
+			// passed as is without converting it to a string first
+			line := scanner.Bytes()
+			if len(line) > 0 && !k.parseAuditEventsAndPush(ctx, &parser, line, readEvtC, tracker) {
+				return
+			}
 		}
-		if err != nil && err != http.ErrServerClosed {
-			evtChan <- source.PushEvent{Err: err}
+		// the scanner fails once the reader is closed, which is not an
+		// error of the stream
+		err := scanner.Err()
+		if err != nil && ctx.Err() == nil {
+			tracker.Error()
+			k.metrics.UpstreamError()
+			select {
+			case readEvtC <- source.PushEvent{Err: errkind.Count(err, k.metrics)}:
+			case <-ctx.Done():
+			}
 		}
 	}()
 
-	// launch event-parser gorountine. This received webhook payloads
-	// and parses their content to extract the list of audit events contained.
-	// Then, events are sent to the Push-mode event source instance channel.
 	go func() {
-		defer close(evtChan)
-		var parser fastjson.Parser
-		for {
-			select {
-			case bytes, ok := <-serverEvtChan:
-				if !ok {
-					return
+		defer close(evtC)
+		// the timer is only reset once fired, so that it never holds a
+		// stale value
+		var timer *time.Timer
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		var firstEvtTime, replayStart time.Time
+		for evt := range readEvtC {
+			if speed > 0 && evt.Err == nil {
+				if firstEvtTime.IsZero() {
+					firstEvtTime = evt.Timestamp
+					replayStart = time.Now()
+				}
+				// events are not guaranteed to be ordered by stageTimestamp,
+				// the ones older than the current replay time are sent at once
+				offset := time.Duration(float64(evt.Timestamp.Sub(firstEvtTime)) / speed)
+				if wait := time.Until(replayStart.Add(offset)); wait > 0 {
+					if timer == nil {
+						timer = time.NewTimer(wait)
+					} else {
+						timer.Reset(wait)
+					}
+					select {
+					case <-timer.C:
+					case <-ctx.Done():
+						return
+					}
 				}
-				k.parseAuditEventsAndPush(&parser, bytes, evtChan)
+			}
+			select {
+			case evtC <- evt:
 			case <-ctx.Done():
 				return
 			}
 		}
 	}()
 
+	return source.NewPushInstance(
+		evtC,
+		source.WithInstanceContext(ctx),
+		source.WithInstanceClose(func() {
+			cancelCtx()
+			r.Close()
+			tracker.Close()
+		}),
+		source.WithInstanceEventSize(uint32(k.Config.MaxEventSize)))
+}
+
+// OpenWebServer opens a source.Instance event stream that receives K8S Audit
+// Events by starting a server and listening for JSON webhooks. The expected
+// JSON format is the one of K8S API Server webhook backend
+// (see: https://kubernetes.io/docs/tasks/debug/debug-cluster/audit/#webhook-backend).
+func (k *Plugin) OpenWebServer(address, endpoint string, ssl bool) (source.Instance, error) {
+	policy, err := queue.ParsePolicy(k.Config.WebhookOverflow)
+	if err != nil {
+		return nil, err
+	}
+	tracker := k.health.Track()
+	cfg := server.Config{
+		Address:     address,
+		Endpoint:    endpoint,
+		MaxBodySize: int64(k.Config.WebhookMaxBatchSize),
+		QueueSize:   int(k.Config.WebhookQueueSize),
+		Overflow:    policy,
+		Accept: func(req *http.Request) error {
+			if !strings.Contains(req.Header.Get("Content-Type"), "application/json") && !cloudevents.IsCloudEvent(req) {
+				return fmt.Errorf("wrong Content Type")
+			}
+			return nil
+		},
+		// the audit events can be wrapped in CloudEvents envelopes, which
+		// are embedded in their JSON and copied to each of the events
+		Decode:   cloudevents.Payloads,
+		OnListen: tracker.SetConnected,
+		OnRequestError: func(err error) {
+			k.logger.Println(errkind.Count(errkind.New(errkind.Parse, err), k.metrics))
+		},
+		OnServeError: func(err error) error {
+			tracker.Error()
+			k.metrics.UpstreamError()
+			return errkind.Count(errkind.New(errkind.Config, err), k.metrics)
+		},
+		// log the queue overflows, if any
+		ReportInterval: time.Second * webServerQueueReportSecs,
+		Logf:           k.logger.Printf,
+	}
+	if ssl {
+		// note: the legacy K8S Audit implementation concatenated the key and cert PEM
+		// files, however this seems to be unusual. Here we use the same concatenated files
+		// for both key and cert, but we may want to split them (this seems to work though).
+		cfg.CertFile = k.Config.SSLCertificate
+	}
+
+	// the webserver listens for webhooks coming from the k8s api server
+	// and queues every valid payload so that an HTTP response can be sent
+	// as soon as possible. Each payload is then parsed to extract the list
+	// of audit events it contains, which are sent to the Push-mode event
+	// source instance channel.
+	srv := server.New(cfg)
+	var parser fastjson.Parser
+	evtChan := srv.Events(func(ctx context.Context, payload []byte, c chan<- source.PushEvent) {
+		k.parseAuditEventsAndPush(ctx, &parser, payload, c, tracker)
+	})
+
 	// open new instance in with "push" prebuilt
 	return source.NewPushInstance(
 		evtChan,
-		source.WithInstanceContext(ctx),
 		source.WithInstanceClose(func() {
 			// on close, attempt shutting down the webserver gracefully
-			timedCtx, cancelTimeoutCtx := context.WithTimeout(ctx, time.Second*webServerShutdownTimeoutSecs)
-			defer cancelTimeoutCtx()
-			s.Shutdown(timedCtx)
-			cancelCtx()
+			srv.Close()
+			tracker.Close()
 		}),
 		source.WithInstanceEventSize(uint32(k.Config.MaxEventSize)),
 	)
@@ -230,26 +417,39 @@ func (k *Plugin) String(evt sdk.EventReader) (string, error) {
 
 // here we make all errors non-blocking for single events by
 // simply logging them, to ensure consumers don't close the
-// event source with bad or malicious payloads
-func (k *Plugin) parseAuditEventsAndPush(parser *fastjson.Parser, payload []byte, c chan<- source.PushEvent) {
+// event source with bad or malicious payloads. The payloads are recorded
+// in the health tracker of the instance and in the metrics of the plugin.
+// The events are sent unless the context is done, in which case false is
+// returned.
+func (k *Plugin) parseAuditEventsAndPush(ctx context.Context, parser *fastjson.Parser, payload []byte, c chan<- source.PushEvent, tracker *health.Tracker) bool {
 	data, err := parser.ParseBytes(payload)
 	if err != nil {
-		k.logger.Println(err.Error())
-		return
+		k.logger.Println(errkind.Count(errkind.New(errkind.Parse, err), k.metrics))
+		tracker.Error()
+		k.metrics.UpstreamError()
+		return true
 	}
 	values, err := k.ParseAuditEventsJSON(data)
 	if err != nil {
-		k.logger.Println(err.Error())
-		return
+		k.logger.Println(errkind.Count(errkind.New(errkind.Parse, err), k.metrics))
+		tracker.Error()
+		k.metrics.UpstreamError()
+		return true
 	}
+	tracker.Event()
 	for _, v := range values {
 		if v.Err != nil {
-			k.logger.Println(v.Err.Error())
+			k.logger.Println(errkind.Count(errkind.New(errkind.Parse, v.Err), k.metrics))
 			continue
-		} else {
-			c <- *v
+		}
+		select {
+		case c <- *v:
+			k.metrics.Ingested(len(v.Data), v.Timestamp)
+		case <-ctx.Done():
+			return false
 		}
 	}
+	return true
 }
 
 // ParseAuditEventsPayload parses a byte slice representing a JSON payload
@@ -292,7 +492,11 @@ func (k *Plugin) ParseAuditEventsJSON(value *fastjson.Value) ([]*source.PushEven
 			items := value.Get("items").GetArray()
 			if items != nil {
 				var res []*source.PushEvent
+				envelope := value.Get(cloudevents.Key)
 				for _, item := range items {
+					if envelope != nil && item.Type() == fastjson.TypeObject {
+						item.Set(cloudevents.Key, envelope)
+					}
 					res = append(res, k.parseSingleAuditEventJSON(item))
 				}
 				return res, nil
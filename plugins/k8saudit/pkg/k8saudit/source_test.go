@@ -0,0 +1,222 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8saudit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+)
+
+// testEventWriters is a batch of a single event, so that each event is
+// received by its own NextBatch call
+type testEventWriters struct {
+	data      bytes.Buffer
+	timestamp uint64
+}
+
+func (t *testEventWriters) Writer() io.Writer {
+	t.data.Reset()
+	return &t.data
+}
+
+func (t *testEventWriters) SetTimestamp(value uint64) {
+	t.timestamp = value
+}
+
+func (t *testEventWriters) Get(eventIndex int) sdk.EventWriter {
+	return t
+}
+
+func (t *testEventWriters) Len() int {
+	return 1
+}
+
+func (t *testEventWriters) ArrayPtr() unsafe.Pointer {
+	return nil
+}
+
+func (t *testEventWriters) Free() {
+	// do nothing
+}
+
+// replayEvent is an event received from a replay
+type replayEvent struct {
+	timestamp time.Time
+	received  time.Time
+}
+
+// readReplay returns the events of a replay until its end, with the time
+// at which each of them was received
+func readReplay(t *testing.T, inst source.Instance) []replayEvent {
+	evts := &testEventWriters{}
+	var res []replayEvent
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out after %d events", len(res))
+		}
+		n, err := inst.NextBatch(nil, evts)
+		if n > 0 {
+			res = append(res, replayEvent{
+				timestamp: time.Unix(0, int64(evts.timestamp)).UTC(),
+				received:  time.Now(),
+			})
+		}
+		if err == sdk.ErrEOF {
+			return res
+		}
+		if err != nil && err != sdk.ErrTimeout {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeReplayFile writes n copies of an audit event of the golden corpus,
+// with stageTimestamp values the given interval apart
+func writeReplayFile(t *testing.T, path string, n int, interval time.Duration) {
+	data, err := ioutil.ReadFile("testdata/golden/01-create-clusterrolebindings.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var evt map[string]interface{}
+	if err := json.Unmarshal(data, &evt); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	enc := json.NewEncoder(f)
+	for i := 0; i < n; i++ {
+		evt["stageTimestamp"] = start.Add(time.Duration(i) * interval).Format(time.RFC3339Nano)
+		if err := enc.Encode(evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOpenReplayClose(t *testing.T) {
+	p := &Plugin{}
+	if err := p.Init("{}"); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Destroy()
+
+	// the events are an hour apart, so that the replay is always waiting
+	// and the reader blocked on its next event when the instance is closed
+	dir := t.TempDir()
+	for _, name := range []string{"a.json", "b.json"} {
+		writeReplayFile(t, filepath.Join(dir, name), 100, time.Hour)
+	}
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		r, err := openAuditFiles(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inst, err := p.OpenReplay(r, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// let the replay read the first events before closing it
+		time.Sleep(10 * time.Millisecond)
+		inst.(sdk.Closer).Close()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines leaked by the closed replays", runtime.NumGoroutine()-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOpenReplayPacing(t *testing.T) {
+	p := &Plugin{}
+	if err := p.Init("{}"); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Destroy()
+
+	// 5 events a second apart, replayed 20 times faster, are expected to be
+	// received 50ms apart, while they are received at once without pacing
+	const n = 5
+	interval := time.Second
+	path := filepath.Join(t.TempDir(), "audit.json")
+	writeReplayFile(t, path, n, interval)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		speed float64
+		gap   time.Duration
+	}{
+		"paced":     {speed: 20, gap: 50 * time.Millisecond},
+		"not paced": {speed: 0, gap: 0},
+	}
+	for name, test := range tests {
+		r, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inst, err := p.OpenReplay(r, test.speed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		evts := readReplay(t, inst)
+		inst.(sdk.Closer).Close()
+		if len(evts) != n {
+			t.Fatalf("%s: expected %d events, got %d", name, n, len(evts))
+		}
+
+		for i, evt := range evts {
+			// the events keep their original timestamps whatever the speed
+			if want := start.Add(time.Duration(i) * interval); !evt.timestamp.Equal(want) {
+				t.Errorf("%s: expected event %d at %s, got %s", name, i, want, evt.timestamp)
+			}
+			// the replay only waits, so an event can be late but never early,
+			// with a small margin since the first event is received a bit
+			// after the replay started
+			elapsed := evt.received.Sub(evts[0].received)
+			if min := time.Duration(i)*test.gap - 5*time.Millisecond; elapsed < min {
+				t.Errorf("%s: expected event %d after %s, got %s", name, i, min, elapsed)
+			}
+		}
+
+		// the upper bound is loose, the scheduling of the tests being slow
+		// on busy machines
+		total := evts[n-1].received.Sub(evts[0].received)
+		if max := time.Duration(n-1)*test.gap + 500*time.Millisecond; total > max {
+			t.Errorf("%s: expected the replay to last less than %s, got %s", name, max, total)
+		}
+	}
+}
@@ -18,16 +18,23 @@ package kafka
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
-	"os"
+	"errors"
+	"fmt"
+	"log"
 	"time"
 
 	"github.com/alecthomas/jsonschema"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/debugserver"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/kafka/consumer"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	"github.com/falcosecurity/plugins/shared/go/schemaregistry"
+	"github.com/falcosecurity/plugins/shared/go/secrets"
 	"github.com/segmentio/kafka-go"
 )
 
@@ -43,18 +50,18 @@ const (
 // PluginConfig represents the kafka configuration
 // we collect during the initialization phase of the plugin.
 type PluginConfig struct {
-	Brokers   []string  `json:"brokers" jsonschema:"title=Kafka Brokers,description=The list of Kafka brokers to consume messages from."`
-	GroupId   string    `json:"groupId" jsonschema:"title=Group ID,description=The consumer group identifier."`
-	Topics    []string  `json:"topics" jsonschema:"title=Kafka Brokers,description=The topics to consume from."`
-	TlsConfig TlsConfig `json:"tlsConfig" jsonschema:"title=TLS Config,description=Configuration for TLS encryption."`
-}
-
-// TlsConfig represents the information
-// needed to establish an mTLS connection with the Kafka server
-type TlsConfig struct {
-	CaCertPath   string `json:"caCertPath" jsonschema:"title=Ca Cert Path,description=Path to the Kafka server's public certificate."`
-	UserCertPath string `json:"userCertPath" jsonschema:"title=User Cert Path,description=Path to the user's public certificate."`
-	UserKeyPath  string `json:"userKeyPath" jsonschema:"title=User Key Path,description=Path to the user's private key."`
+	Brokers        []string              `json:"brokers" jsonschema:"title=Kafka Brokers,description=The list of Kafka brokers to consume messages from."`
+	GroupId        string                `json:"groupId" jsonschema:"title=Group ID,description=The consumer group identifier."`
+	Topics         []string              `json:"topics" jsonschema:"title=Kafka Brokers,description=The topics to consume from."`
+	TlsConfig      consumer.TLSConfig    `json:"tlsConfig" jsonschema:"title=TLS Config,description=Configuration for TLS encryption."`
+	SaslConfig     consumer.SASLConfig   `json:"saslConfig" jsonschema:"title=SASL Config,description=Configuration for SASL authentication."`
+	Consumers      int                   `json:"consumers" jsonschema:"title=Consumers,description=The number of consumers reading the partitions of the topics concurrently (default: 1).,default=1"`
+	DebugAddress   string                `json:"debugAddress" jsonschema:"title=Debug Address,description=Loopback address (e.g. localhost:6060) of an HTTP server exposing the pprof and expvar endpoints of the plugin (default: empty for disabled)."`
+	HealthAddress  string                `json:"healthAddress" jsonschema:"title=Health Address,description=Address (e.g. :8081) of an HTTP server exposing the health and readiness endpoints of the plugin (default: empty for disabled)."`
+	HealthPath     string                `json:"healthPath" jsonschema:"title=Health Path,description=Path of the health endpoint. The readiness endpoint is served under <path>/ready (default: /healthz).,default=/healthz"`
+	MetricsAddress string                `json:"metricsAddress" jsonschema:"title=Metrics Address,description=Address (e.g. :9090) of the Prometheus endpoint shared by the plugins of the Falco process configured with the same address (default: empty for disabled)."`
+	MetricsPath    string                `json:"metricsPath" jsonschema:"title=Metrics Path,description=Path of the Prometheus endpoint (default: /metrics).,default=/metrics"`
+	SchemaRegistry schemaregistry.Config `json:"schemaRegistry" jsonschema:"title=Schema Registry,description=Confluent Schema Registry decoding the Avro and Protobuf messages framed with the ID of their schema into JSON (default: empty URL for disabled)."`
 }
 
 // Plugin creates a connection between Kafka and Falco, exposing the
@@ -63,7 +70,10 @@ type Plugin struct {
 	plugins.BasePlugin
 
 	pluginConfig PluginConfig
-	reader       *kafka.Reader
+	debugServer  *debugserver.Server
+	healthServer *health.Server
+	metrics      *metrics.Metrics
+	registry     *schemaregistry.Client
 }
 
 func (p *Plugin) Info() *plugins.Info {
@@ -91,102 +101,159 @@ func (p *Plugin) InitSchema() *sdk.SchemaInfo {
 }
 
 func (p *Plugin) Init(config string) (err error) {
+	p.pluginConfig.Consumers = 1
+	p.pluginConfig.HealthPath = health.DefaultPath
+	p.pluginConfig.MetricsPath = metrics.DefaultPath
+	p.pluginConfig.SchemaRegistry.Reset()
 	if len(config) != 0 {
 		err = json.Unmarshal([]byte(config), &p.pluginConfig)
 	}
 
-	return
-}
-
-func (p *Plugin) Open(params string) (source.Instance, error) {
-	dailer, err := p.newDialer()
+	if err == nil {
+		err = secrets.Resolve(&p.pluginConfig)
+	}
 
-	if err != nil {
-		return nil, err
+	if err == nil && p.pluginConfig.Consumers < 1 {
+		err = fmt.Errorf("consumers must be greater than 0")
 	}
 
-	p.reader = kafka.NewReader(kafka.ReaderConfig{
-		Brokers:     p.pluginConfig.Brokers,
-		GroupID:     p.pluginConfig.GroupId,
-		GroupTopics: p.pluginConfig.Topics,
-		Dialer:      dailer,
-	})
+	if err == nil && len(p.pluginConfig.SchemaRegistry.URL) > 0 {
+		p.registry, err = schemaregistry.New(p.pluginConfig.SchemaRegistry)
+	}
+	// the framework doesn't call Destroy when Init fails, so the servers
+	// started before a failure are stopped here
+	defer func() {
+		if err != nil {
+			p.Destroy()
+		}
+	}()
 
-	kafkaEvents := make(chan source.PushEvent)
-	ctx, cancel := context.WithCancel(context.Background())
+	// start the optional pprof and expvar server
+	if err == nil && len(p.pluginConfig.DebugAddress) > 0 {
+		p.debugServer, err = debugserver.Start(p.pluginConfig.DebugAddress)
+	}
 
-	push := func(ctx context.Context) {
-		defer close(kafkaEvents)
+	// start the optional health server
+	if err == nil && len(p.pluginConfig.HealthAddress) > 0 {
+		p.healthServer, err = health.Start(p.pluginConfig.HealthAddress, p.pluginConfig.HealthPath)
+	}
 
-		for {
-			msg, err := p.reader.ReadMessage(ctx)
+	// start the optional metrics endpoint
+	if err == nil && len(p.pluginConfig.MetricsAddress) > 0 {
+		p.metrics, err = metrics.Start(p.pluginConfig.MetricsAddress, p.pluginConfig.MetricsPath, PluginName)
+	}
 
-			if err != nil {
-				kafkaEvents <- source.PushEvent{Err: err}
-				return
-			}
+	return
+}
 
-			kafkaEvents <- source.PushEvent{Data: msg.Value, Timestamp: msg.Time}
-		}
+func (p *Plugin) Open(params string) (source.Instance, error) {
+	// the consumers join the same group, so that the partitions of the
+	// topics are split between them and consumed concurrently
+	group, err := consumer.NewGroup(consumer.Config{
+		Brokers:   p.pluginConfig.Brokers,
+		GroupID:   p.pluginConfig.GroupId,
+		Topics:    p.pluginConfig.Topics,
+		TLS:       p.pluginConfig.TlsConfig,
+		SASL:      p.pluginConfig.SaslConfig,
+		Consumers: p.pluginConfig.Consumers,
+	})
+	if err != nil {
+		return nil, errkind.Count(errkind.New(errkind.Config, err), p.metrics)
 	}
 
-	go push(ctx)
+	ctx, cancel := context.WithCancel(context.Background())
+	tracker := p.healthServer.Track()
+
+	// The offset of a message is only committed once it has been handed
+	// to Falco, so that it is not lost if the plugin stops in between.
+	kafkaEvents := group.Events(ctx, consumer.Handler{
+		OnFetch: func(msg kafka.Message) {
+			tracker.SetConnected(true)
+			tracker.Event()
+		},
+		OnPush: func(msg kafka.Message) {
+			p.metrics.Ingested(len(msg.Value), msg.Time)
+		},
+		Decode: p.decoder(ctx),
+		OnDecodeError: func(msg kafka.Message, err error) error {
+			if !errors.Is(err, schemaregistry.ErrInvalid) {
+				// the registry can't be reached, the message is
+				// consumed again once the stream is reopened
+				return err
+			}
+			err = errkind.Count(errkind.New(errkind.Parse, err), p.metrics)
+			log.Printf("[%s] skipping message %d of partition %d of topic %s: %s\n", PluginName, msg.Offset, msg.Partition, msg.Topic, err.Error())
+			return nil
+		},
+		OnError: func(err error) error {
+			tracker.SetConnected(false)
+			tracker.Error()
+			p.metrics.UpstreamError()
+			return errkind.Count(errkind.New(kafkaErrorKind(err), err), p.metrics)
+		},
+	})
+
 	return source.NewPushInstance(
 		kafkaEvents,
-		source.WithInstanceClose(cancel),
+		source.WithInstanceContext(ctx),
+		source.WithInstanceClose(func() {
+			cancel()
+			// leave the group, so that the partitions are rebalanced
+			// to the other members right away
+			group.Close()
+			tracker.Close()
+		}),
 		source.WithInstanceTimeout(10*time.Millisecond))
 }
 
 func (p *Plugin) Destroy() {
-	if p.reader == nil {
-		return
+	if p.debugServer != nil {
+		p.debugServer.Close()
+		p.debugServer = nil
 	}
-
-	if err := p.reader.Close(); err != nil {
-		panic(err)
-	}
-}
-
-func (p *Plugin) newDialer() (*kafka.Dialer, error) {
-	if len(p.pluginConfig.TlsConfig.CaCertPath) == 0 {
-		return nil, nil
+	if p.healthServer != nil {
+		p.healthServer.Close()
+		p.healthServer = nil
 	}
-
-	caPEM, err := os.ReadFile(p.pluginConfig.TlsConfig.CaCertPath)
-
-	if err != nil {
-		return nil, err
+	if p.metrics != nil {
+		p.metrics.Close()
+		p.metrics = nil
 	}
+}
 
-	certPEM, err := os.ReadFile(p.pluginConfig.TlsConfig.UserCertPath)
-
-	if err != nil {
-		return nil, err
-	}
-
-	keyPEM, err := os.ReadFile(p.pluginConfig.TlsConfig.UserCertPath)
-
-	if err != nil {
-		return nil, err
-	}
-
-	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
-
-	if err != nil {
-		return nil, err
+// decoder returns the decoder of the messages framed with the ID of their
+// schema in the registry, which passes the other messages through, or nil
+// if no registry is configured
+func (p *Plugin) decoder(ctx context.Context) func(msg kafka.Message) ([]byte, error) {
+	if p.registry == nil {
+		return nil
 	}
-
-	caCertPool := x509.NewCertPool()
-
-	if ok := caCertPool.AppendCertsFromPEM(caPEM); !ok {
-		return nil, err
+	return func(msg kafka.Message) ([]byte, error) {
+		data, err := p.registry.Decode(ctx, msg.Value)
+		if errors.Is(err, schemaregistry.ErrNotFramed) {
+			return msg.Value, nil
+		}
+		return data, err
 	}
+}
 
-	tlsConfig := &tls.Config{
-		Certificates:       []tls.Certificate{certificate},
-		RootCAs:            caCertPool,
-		InsecureSkipVerify: false,
+// kafkaErrorKind returns the category of an error returned by the brokers,
+// from its error code when it's a protocol error
+func kafkaErrorKind(err error) errkind.Kind {
+	var kErr kafka.Error
+	if errors.As(err, &kErr) {
+		switch kErr {
+		case kafka.SASLAuthenticationFailed, kafka.TopicAuthorizationFailed,
+			kafka.GroupAuthorizationFailed, kafka.ClusterAuthorizationFailed:
+			return errkind.Auth
+		case kafka.ThrottlingQuotaExceeded:
+			return errkind.RateLimited
+		case kafka.UnknownTopicOrPartition, kafka.InvalidTopic:
+			return errkind.Config
+		}
+		if kErr.Temporary() {
+			return errkind.Unavailable
+		}
 	}
-
-	return &kafka.Dialer{TLS: tlsConfig}, nil
+	return errkind.Of(err)
 }
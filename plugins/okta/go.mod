@@ -6,6 +6,74 @@ require (
 	github.com/alecthomas/jsonschema v0.0.0-20220216202328-9eeeec9d044b
 	github.com/bluele/gcache v0.0.2
 	github.com/falcosecurity/plugin-sdk-go v0.7.4
+	github.com/falcosecurity/plugins/shared/go/batch v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/checkpoint v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/conformance v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/debugserver v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/dedup v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/errkind v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/fuzz v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/golden v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/health v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/httpclient v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/jsoncache v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/metrics v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/multishard v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/ratelimit v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/reload v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/secrets v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/tenant v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/webhook/cloudevents v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/webhook/queue v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/webhook/server v0.0.0-00010101000000-000000000000
+	github.com/valyala/fastjson v1.6.4
 )
 
-require github.com/iancoleman/orderedmap v0.3.0 // indirect
+require gopkg.in/yaml.v2 v2.4.0 // indirect
+
+require (
+	github.com/falcosecurity/plugins/shared/go/mux v0.0.0-00010101000000-000000000000 // indirect
+	github.com/iancoleman/orderedmap v0.3.0 // indirect
+)
+
+replace github.com/falcosecurity/plugins/shared/go/jsoncache => ../../shared/go/jsoncache
+
+replace github.com/falcosecurity/plugins/shared/go/webhook/queue => ../../shared/go/webhook/queue
+
+replace github.com/falcosecurity/plugins/shared/go/debugserver => ../../shared/go/debugserver
+
+replace github.com/falcosecurity/plugins/shared/go/golden => ../../shared/go/golden
+
+replace github.com/falcosecurity/plugins/shared/go/fuzz => ../../shared/go/fuzz
+
+replace github.com/falcosecurity/plugins/shared/go/webhook/cloudevents => ../../shared/go/webhook/cloudevents
+
+replace github.com/falcosecurity/plugins/shared/go/secrets => ../../shared/go/secrets
+
+replace github.com/falcosecurity/plugins/shared/go/health => ../../shared/go/health
+
+replace github.com/falcosecurity/plugins/shared/go/metrics => ../../shared/go/metrics
+
+replace github.com/falcosecurity/plugins/shared/go/reload => ../../shared/go/reload
+
+replace github.com/falcosecurity/plugins/shared/go/errkind => ../../shared/go/errkind
+
+replace github.com/falcosecurity/plugins/shared/go/tenant => ../../shared/go/tenant
+
+replace github.com/falcosecurity/plugins/shared/go/webhook/server => ../../shared/go/webhook/server
+
+replace github.com/falcosecurity/plugins/shared/go/checkpoint => ../../shared/go/checkpoint
+
+replace github.com/falcosecurity/plugins/shared/go/ratelimit => ../../shared/go/ratelimit
+
+replace github.com/falcosecurity/plugins/shared/go/httpclient => ../../shared/go/httpclient
+
+replace github.com/falcosecurity/plugins/shared/go/dedup => ../../shared/go/dedup
+
+replace github.com/falcosecurity/plugins/shared/go/multishard => ../../shared/go/multishard
+
+replace github.com/falcosecurity/plugins/shared/go/batch => ../../shared/go/batch
+
+replace github.com/falcosecurity/plugins/shared/go/conformance => ../../shared/go/conformance
+
+replace github.com/falcosecurity/plugins/shared/go/mux => ../../shared/go/mux
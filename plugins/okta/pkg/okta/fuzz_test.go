@@ -0,0 +1,55 @@
+//go:build go1.18
+
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package okta
+
+import (
+	"context"
+	"testing"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/fuzz"
+	"github.com/falcosecurity/plugins/shared/go/golden"
+)
+
+func FuzzExtract(f *testing.F) {
+	p := &Plugin{}
+	if err := p.Init("{}"); err != nil {
+		f.Fatal(err)
+	}
+	fuzz.AddDir(f, "testdata/golden", golden.Ext)
+	fuzz.Extract(f, p)
+}
+
+func FuzzEventHookPayload(f *testing.F) {
+	f.Add([]byte(`{"eventType":"com.okta.event_hook","data":{"events":[{"published":"2024-01-01T00:00:00.000Z"},{"published":1},null]}}`))
+	f.Add([]byte(`{"data":{"events":{}}}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := make(chan source.PushEvent)
+		done := make(chan struct{})
+		go func() {
+			for range c {
+			}
+			close(done)
+		}()
+		pushEventHookPayload(context.Background(), data, c, nil)
+		close(c)
+		<-done
+	})
+}
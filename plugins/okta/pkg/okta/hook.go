@@ -0,0 +1,197 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package okta
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	"github.com/falcosecurity/plugins/shared/go/webhook/cloudevents"
+	"github.com/falcosecurity/plugins/shared/go/webhook/queue"
+	"github.com/falcosecurity/plugins/shared/go/webhook/server"
+)
+
+const (
+	eventHookQueueReportSecs = 10
+	eventHookMaxBodySize     = 10 * 1024 * 1024
+	eventHookChallengeHeader = "X-Okta-Verification-Challenge"
+	eventHookSignatureHeader = "X-Okta-Signature"
+)
+
+// eventHookPayload is the body of a request sent by an Okta Event Hook,
+// see https://developer.okta.com/docs/concepts/event-hooks/
+type eventHookPayload struct {
+	EventType string `json:"eventType"`
+	Data      struct {
+		Events []json.RawMessage `json:"events"`
+	} `json:"data"`
+	// CloudEvent is the envelope the payload was wrapped in, if any
+	CloudEvent *cloudevents.Envelope `json:"cloudevent"`
+}
+
+// OpenEventHook opens a source.Instance event stream that receives Okta
+// Log Events by starting a server and listening for Okta Event Hooks. The
+// event_hook_secret must be set, so that the server can't be fed with
+// forged events.
+func (oktaPlugin *Plugin) OpenEventHook(address, endpoint string, ssl bool) (source.Instance, error) {
+	if oktaPlugin.currentSettings().EventHookSecret == "" {
+		return nil, errkind.Count(errkind.Errorf(errkind.Config, "event_hook_secret must be set to receive Event Hooks"), oktaPlugin.metrics)
+	}
+	tracker := oktaPlugin.healthServer.Track()
+	srv, err := oktaPlugin.newEventHookServer(address, endpoint, ssl, tracker)
+	if err != nil {
+		tracker.Close()
+		return nil, err
+	}
+	evtChan := srv.Events(func(ctx context.Context, payload []byte, c chan<- source.PushEvent) {
+		tracker.Event()
+		pushEventHookPayload(ctx, payload, c, oktaPlugin.metrics)
+	})
+
+	return source.NewPushInstance(
+		evtChan,
+		source.WithInstanceClose(func() {
+			srv.Close()
+			tracker.Close()
+		}),
+		source.WithInstanceTimeout(oktaPlugin.batchTimeout()),
+	)
+}
+
+// newEventHookServer returns the server receiving the Okta Event Hooks,
+// which records its state in the given tracker
+func (oktaPlugin *Plugin) newEventHookServer(address, endpoint string, ssl bool, tracker *health.Tracker) (*server.Server, error) {
+	policy, err := queue.ParsePolicy(oktaPlugin.EventHookOverflow)
+	if err != nil {
+		return nil, err
+	}
+	cfg := server.Config{
+		Address:     address,
+		Endpoint:    endpoint,
+		MaxBodySize: eventHookMaxBodySize,
+		QueueSize:   int(oktaPlugin.EventHookQueueSize),
+		Overflow:    policy,
+		Auth:        oktaPlugin.checkEventHookAuth,
+		// the payloads can be wrapped in CloudEvents envelopes, which
+		// are embedded in their JSON and copied to each of the events
+		Decode:   cloudevents.Payloads,
+		Verify:   verifyEventHook,
+		OnListen: tracker.SetConnected,
+		OnRequestError: func(err error) {
+			if errors.Is(err, server.ErrUnauthorized) {
+				log.Printf("[okta] %s\n", errkind.Count(errkind.New(errkind.Auth, err), oktaPlugin.metrics))
+				tracker.Error()
+				oktaPlugin.metrics.UpstreamError()
+				return
+			}
+			log.Printf("[okta] %s\n", errkind.Count(errkind.New(errkind.Parse, err), oktaPlugin.metrics))
+		},
+		OnServeError: func(err error) error {
+			tracker.Error()
+			oktaPlugin.metrics.UpstreamError()
+			return errkind.Count(errkind.New(errkind.Config, err), oktaPlugin.metrics)
+		},
+		// log the queue overflows, if any
+		ReportInterval: time.Second * eventHookQueueReportSecs,
+		Logf: func(format string, v ...interface{}) {
+			log.Printf("[okta] "+format+"\n", v...)
+		},
+	}
+	if ssl {
+		cfg.CertFile = oktaPlugin.SSLCertificate
+	}
+	return server.New(cfg), nil
+}
+
+// verifyEventHook answers the one-time verification of the endpoint, Okta
+// expects the challenge to be echoed back in the response body
+func verifyEventHook(w http.ResponseWriter, req *http.Request) {
+	challenge := req.Header.Get(eventHookChallengeHeader)
+	if challenge == "" {
+		http.Error(w, "missing verification challenge", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"verification": challenge})
+}
+
+// checkEventHookAuth returns true if the request is authenticated with the
+// configured secret. Okta natively sends the secret as the value of the
+// Authorization header, while proxies in front of the plugin can instead
+// sign the body with HMAC-SHA256 and set the X-Okta-Signature header.
+// The secret can be reloaded, so the authenticators are built for each
+// request. All the requests are rejected if it's not set.
+func (oktaPlugin *Plugin) checkEventHookAuth(req *http.Request, body []byte) bool {
+	s := oktaPlugin.currentSettings()
+	if s.EventHookSecret == "" {
+		return false
+	}
+	secret := []byte(s.EventHookSecret)
+	if req.Header.Get(eventHookSignatureHeader) != "" {
+		return server.Any(
+			server.HMAC(eventHookSignatureHeader, "sha256=", secret, sha256.New),
+			server.HMAC(eventHookSignatureHeader, "", secret, sha256.New),
+		)(req, body)
+	}
+	return server.Token("Authorization", s.EventHookSecret)(req, body)
+}
+
+// here we make all errors non-blocking by simply logging them,
+// to ensure the event source is not closed with bad payloads. The events
+// sent and the errors are recorded in the given metrics, if any. The events
+// are sent until the context is done.
+func pushEventHookPayload(ctx context.Context, body []byte, c chan<- source.PushEvent, m *metrics.Metrics) {
+	var payload eventHookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		log.Printf("[okta] %s\n", errkind.Count(errkind.New(errkind.Parse, err), m))
+		return
+	}
+	for _, e := range payload.Data.Events {
+		var evt struct {
+			Published string `json:"published"`
+		}
+		if err := json.Unmarshal(e, &evt); err != nil {
+			log.Printf("[okta] %s\n", errkind.Count(errkind.New(errkind.Parse, err), m))
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, evt.Published)
+		if err != nil {
+			t = time.Now()
+		}
+		data, err := cloudevents.Embed(e, payload.CloudEvent)
+		if err != nil {
+			log.Printf("[okta] %s\n", errkind.Count(errkind.New(errkind.Parse, err), m))
+			continue
+		}
+		select {
+		case c <- source.PushEvent{Data: data, Timestamp: t}:
+			m.Ingested(len(data), t)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package okta
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/health"
+)
+
+const testEventHookBody = `{"eventType":"com.okta.event_hook","data":{"events":[{"uuid":"1","published":"2024-01-01T00:00:00.000Z"}]}}`
+
+// newTestEventHookServer returns the handler of the Event Hooks of a plugin
+// initialized with the given config
+func newTestEventHookServer(t *testing.T, config string) (*Plugin, http.Handler) {
+	p := &Plugin{}
+	if err := p.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	srv, err := p.newEventHookServer("127.0.0.1:0", "/okta", false, (*health.Server)(nil).Track())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	return p, srv
+}
+
+// serveEventHook returns the response to a request to the Event Hooks
+// handler
+func serveEventHook(h http.Handler, method, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/okta", strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestOpenEventHookSecret(t *testing.T) {
+	p := &Plugin{}
+	if err := p.Init("{}"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := p.Open("http://127.0.0.1:0/okta")
+	if err == nil || errkind.Of(err) != errkind.Config {
+		t.Errorf("expected a config error without event_hook_secret, got %v", err)
+	}
+
+	// the requests are all rejected without secret anyway
+	req := httptest.NewRequest("POST", "/okta", strings.NewReader(testEventHookBody))
+	if p.checkEventHookAuth(req, []byte(testEventHookBody)) {
+		t.Error("expected the request to be rejected without event_hook_secret")
+	}
+
+	// the secret can't be removed by a reload
+	p = &Plugin{}
+	if err := p.Init(`{"event_hook_secret":"secret"}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.reload([]byte(`{"event_hook_secret":""}`)); err == nil {
+		t.Error("expected the reload removing event_hook_secret to fail")
+	}
+	if err := p.reload([]byte(`{"event_hook_secret":"other"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if s := p.currentSettings().EventHookSecret; s != "other" {
+		t.Errorf("expected the reloaded secret, got %s", s)
+	}
+}
+
+func TestEventHookVerify(t *testing.T) {
+	_, h := newTestEventHookServer(t, `{"event_hook_secret":"secret"}`)
+
+	w := serveEventHook(h, "GET", "", eventHookChallengeHeader, "challenge")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"verification":"challenge"}` {
+		t.Errorf("expected the challenge to be echoed back, got %d %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a json response, got %s", ct)
+	}
+	if w = serveEventHook(h, "GET", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected the request without challenge to be rejected, got %d", w.Code)
+	}
+}
+
+func TestEventHookAuth(t *testing.T) {
+	_, h := newTestEventHookServer(t, `{"event_hook_secret":"secret"}`)
+	tests := []struct {
+		name     string
+		header   []string
+		expected int
+	}{
+		{"authorization", []string{"Authorization", "secret"}, http.StatusOK},
+		{"wrong authorization", []string{"Authorization", "other"}, http.StatusUnauthorized},
+		{"signature", []string{eventHookSignatureHeader, "sha256=" + sign("secret", testEventHookBody)}, http.StatusOK},
+		{"signature without prefix", []string{eventHookSignatureHeader, sign("secret", testEventHookBody)}, http.StatusOK},
+		{"wrong signature", []string{eventHookSignatureHeader, "sha256=" + sign("other", testEventHookBody)}, http.StatusUnauthorized},
+		{"invalid signature", []string{eventHookSignatureHeader, "sha256=secret"}, http.StatusUnauthorized},
+		// the signature takes precedence over the Authorization header
+		{"wrong signature with authorization", []string{eventHookSignatureHeader, "00", "Authorization", "secret"}, http.StatusUnauthorized},
+		{"none", nil, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		if w := serveEventHook(h, "POST", testEventHookBody, test.header...); w.Code != test.expected {
+			t.Errorf("%s: expected the status %d, got %d", test.name, test.expected, w.Code)
+		}
+	}
+}
+
+func TestEventHookEvents(t *testing.T) {
+	p := &Plugin{}
+	if err := p.Init(`{"event_hook_secret":"secret"}`); err != nil {
+		t.Fatal(err)
+	}
+	tracker := (*health.Server)(nil).Track()
+	srv, err := p.newEventHookServer("127.0.0.1:0", "/okta", false, tracker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	c := srv.Events(func(ctx context.Context, payload []byte, c chan<- source.PushEvent) {
+		pushEventHookPayload(ctx, payload, c, nil)
+	})
+
+	// the events of the request are sent with their published time
+	if w := serveEventHook(srv, "POST", testEventHookBody, "Authorization", "secret"); w.Code != http.StatusOK {
+		t.Fatalf("expected the request to be accepted, got %d", w.Code)
+	}
+	select {
+	case evt := <-c:
+		if string(evt.Data) != `{"uuid":"1","published":"2024-01-01T00:00:00.000Z"}` {
+			t.Errorf("unexpected event %s", evt.Data)
+		}
+		if !evt.Timestamp.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("expected the published time, got %s", evt.Timestamp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an event")
+	}
+}
+
+func TestPushEventHookPayload(t *testing.T) {
+	body := `{"data":{"events":[{"uuid":"1","published":"2024-01-01T00:00:00.000Z"},1,{"uuid":"2","published":"invalid"}]},` +
+		`"cloudevent":{"specversion":"1.0","id":"ce","source":"mesh","type":"okta"}}`
+	c := make(chan source.PushEvent, 4)
+	before := time.Now()
+	pushEventHookPayload(context.Background(), []byte(body), c, nil)
+	close(c)
+	var evts []source.PushEvent
+	for evt := range c {
+		evts = append(evts, evt)
+	}
+
+	// the invalid events are skipped, the envelope is embedded in the
+	// others and the invalid times are replaced by the current one
+	if len(evts) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(evts))
+	}
+	for i, uuid := range []string{`"uuid":"1"`, `"uuid":"2"`} {
+		if !strings.Contains(string(evts[i].Data), uuid) || !strings.Contains(string(evts[i].Data), `"cloudevent":{`) {
+			t.Errorf("unexpected event %s", evts[i].Data)
+		}
+	}
+	if !evts[0].Timestamp.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the published time, got %s", evts[0].Timestamp)
+	}
+	if evts[1].Timestamp.Before(before) {
+		t.Errorf("expected the current time, got %s", evts[1].Timestamp)
+	}
+
+	// the events are not sent once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		pushEventHookPayload(ctx, []byte(testEventHookBody), make(chan source.PushEvent), nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the payload to be given up once the context is done")
+	}
+}
@@ -20,10 +20,16 @@ package okta
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/alecthomas/jsonschema"
@@ -31,6 +37,24 @@ import (
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/symbols/extract"
+	"github.com/falcosecurity/plugins/shared/go/batch"
+	"github.com/falcosecurity/plugins/shared/go/checkpoint"
+	"github.com/falcosecurity/plugins/shared/go/debugserver"
+	"github.com/falcosecurity/plugins/shared/go/dedup"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/httpclient"
+	"github.com/falcosecurity/plugins/shared/go/jsoncache"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	"github.com/falcosecurity/plugins/shared/go/multishard"
+	"github.com/falcosecurity/plugins/shared/go/ratelimit"
+	"github.com/falcosecurity/plugins/shared/go/reload"
+	"github.com/falcosecurity/plugins/shared/go/secrets"
+	"github.com/falcosecurity/plugins/shared/go/tenant"
+	"github.com/falcosecurity/plugins/shared/go/webhook/cloudevents"
+	"github.com/falcosecurity/plugins/shared/go/webhook/queue"
+	"github.com/valyala/fastjson"
 )
 
 // LogEvent describes a single logged action or "event" that is performed by a set of actors for a set of targets.
@@ -86,6 +110,9 @@ type LogEvent struct {
 	DebugContext struct {
 		DebugData struct {
 			RequestURI        string `json:"requestUri"`
+			ThreatSuspected   string `json:"threatSuspected,omitempty"`
+			Risk              string `json:"risk,omitempty"`
+			Behaviors         string `json:"behaviors,omitempty"`
 			OriginalPrincipal struct {
 				ID          string `json:"id,omitempty"`
 				Type        string `json:"type,omitempty"`
@@ -109,28 +136,63 @@ type LogEvent struct {
 // Plugin represents our plugin
 type Plugin struct {
 	plugins.BasePlugin
-	APIToken         string `json:"api_token" jsonschema:"title=API token,description=API Token"`
-	Organization     string `json:"organization" jsonschema:"title=Organization,description=Your Okta organization"`
-	CacheExpiration  uint64 `json:"cache_expiration" jsonschema:"title=Cache Expiration,description=TTL in seconds for keys in cache for MFA events (default: 600)"`
-	CacheUserMaxSize uint64 `json:"cache_usermaxsize" jsonschema:"title=Cache User Max Size,description=Max size by user for the cache (default: 200)"`
-	RefreshInterval  uint64 `json:"refresh_interval" jsonschema:"title=Refresh Interval,description=Delay in seconds between two calls to the Okta API (default: 10)"`
-	UseAsync         bool   `json:"useAsync" jsonschema:"title=Use async extraction,description=If true then async extraction optimization is enabled (Default: true),default=true"`
-	lastLogEvent     LogEvent
-	lastEventNum     uint64
-	cache            gcache.Cache
+	APIToken           string            `json:"api_token" secret:"true" jsonschema:"title=API token,description=API Token,writeOnly=true"`
+	Organization       string            `json:"organization" jsonschema:"title=Organization,description=Your Okta organization"`
+	CacheExpiration    uint64            `json:"cache_expiration" jsonschema:"title=Cache Expiration,description=TTL in seconds for keys in cache for MFA events (default: 600)"`
+	CacheUserMaxSize   uint64            `json:"cache_usermaxsize" jsonschema:"title=Cache User Max Size,description=Max size by user for the cache (default: 200)"`
+	RefreshInterval    uint64            `json:"refresh_interval" jsonschema:"title=Refresh Interval,description=Delay in seconds between two calls to the Okta API (default: 10)"`
+	RateLimit          uint64            `json:"rate_limit" jsonschema:"title=Rate limit,description=Maximum number of calls per minute to the Okta API of each organization. The rate limit headers returned by Okta are respected in any case (default: 0 for no limit)"`
+	UseAsync           bool              `json:"useAsync" jsonschema:"title=Use async extraction,description=If true then async extraction optimization is enabled (Default: true),default=true"`
+	EventHookSecret    string            `json:"event_hook_secret" secret:"true" jsonschema:"title=Event Hook secret,description=Secret used to authenticate the requests received from Okta Event Hooks and required to receive them (default: empty),writeOnly=true"`
+	SSLCertificate     string            `json:"ssl_certificate" jsonschema:"title=SSL certificate,description=The SSL Certificate to be used with the HTTPS Event Hook endpoint (default: /etc/falco/falco.pem)"`
+	EventHookQueueSize uint64            `json:"event_hook_queue_size" jsonschema:"title=Event Hook queue size,description=Maximum number of Event Hook requests waiting to be consumed (default: 50)"`
+	EventHookOverflow  string            `json:"event_hook_overflow" jsonschema:"title=Event Hook queue overflow policy,enum=block,enum=drop_oldest,enum=reject,description=What to do with incoming Event Hook requests when the queue is full: block or drop_oldest or reject with 429 Too Many Requests (default: block)"`
+	DebugAddress       string            `json:"debugAddress" jsonschema:"title=Debug address,description=Loopback address (e.g. localhost:6060) of an HTTP server exposing the pprof and expvar endpoints of the plugin (default: empty for disabled)"`
+	BatchTimeout       uint64            `json:"batch_timeout" jsonschema:"title=Batch timeout,description=Delay in milliseconds after which the events received so far are delivered without waiting for a full batch (default: 30),minimum=1"`
+	HealthAddress      string            `json:"health_address" jsonschema:"title=Health address,description=Address (e.g. :8081) of an HTTP server exposing the health and readiness endpoints of the plugin (default: empty for disabled)"`
+	HealthPath         string            `json:"health_path" jsonschema:"title=Health path,description=Path of the health endpoint. The readiness endpoint is served under <path>/ready (default: /healthz)"`
+	MetricsAddress     string            `json:"metrics_address" jsonschema:"title=Metrics address,description=Address (e.g. :9090) of the Prometheus endpoint shared by the plugins of the Falco process configured with the same address (default: empty for disabled)"`
+	MetricsPath        string            `json:"metrics_path" jsonschema:"title=Metrics path,description=Path of the Prometheus endpoint (default: /metrics)"`
+	ReloadFile         string            `json:"reload_file" jsonschema:"title=Reload file,description=Path of a json file holding the settings applied again at runtime each time it changes: api_token and event_hook_secret and refresh_interval (default: empty for disabled)"`
+	HTTP               httpclient.Config `json:"http" jsonschema:"title=HTTP client,description=Proxy and TLS and timeout and retries of the calls to the Okta API"`
+	CheckpointFile     string            `json:"checkpoint_file" jsonschema:"title=Checkpoint file,description=Path of a json file where the time of the last event polled from each organization is saved so that the polling resumes from it after a restart (default: empty for disabled)"`
+	WatchdogTimeout    uint64            `json:"watchdog_timeout" jsonschema:"title=Watchdog timeout,description=Delay in seconds without any event nor completed call to the Okta API after which the polling is reported as stalled by the health endpoint and logged. It must be greater than the refresh interval (default: 0 for disabled)"`
+	WatchdogRestart    bool              `json:"watchdog_restart" jsonschema:"title=Watchdog restart,description=If true then the calls in progress are canceled and retried at the next interval when the polling stalls (default: false)"`
+	Dedup              dedup.Config      `json:"dedup" jsonschema:"title=De-duplication,description=Sliding window dropping the polled events already received such as the ones of overlapping pages after a restart"`
+	jcache             jsoncache.Cache
+	jdata              *fastjson.Value
+	lastEventNum       uint64
+	cache              gcache.Cache
+	debugServer        *debugserver.Server
+	healthServer       *health.Server
+	metrics            *metrics.Metrics
+	settings           atomic.Value // holds the reloadableSettings currently in effect
+	reloader           *reload.Watcher
+	checkpoints        checkpoint.Store
+	tenantOrgs         sync.Map // tenant name -> organization, for the okta.org field
 }
 
-// PluginInstance represents a opened stream based on our Plugin
-type PluginInstance struct {
-	source.BaseInstance
-	client          *http.Client
-	request         *http.Request
-	cancel          context.CancelFunc
-	lastReqTime     time.Time
-	refreshInterval uint64
+// oktaTenant is a tenant of an instance opened with a list of tenants,
+// whose organization is polled with its own API token
+type oktaTenant struct {
+	Name         string `json:"name"`
+	Organization string `json:"organization"`
+	APIToken     string `json:"api_token" secret:"true"`
 }
 
-const oktaBaseURL string = "okta.com/api/v1/logs"
+// reloadableSettings holds the settings that can be reloaded at runtime
+// from the reload file, with the same property names as the init config
+type reloadableSettings struct {
+	APIToken        string `json:"api_token" secret:"true" reload:"true"`
+	EventHookSecret string `json:"event_hook_secret" secret:"true" reload:"true"`
+	RefreshInterval uint64 `json:"refresh_interval" reload:"true"`
+}
+
+const (
+	oktaBaseURL string = "okta.com/api/v1/logs"
+	// oktaMaxLimit is the maximum number of events returned by a call to the Okta API
+	oktaMaxLimit = 1000
+)
 
 // Info displays information of the plugin to Falco plugin framework
 func (oktaPlugin *Plugin) Info() *plugins.Info {
@@ -161,30 +223,169 @@ func (oktaPlugin *Plugin) InitSchema() *sdk.SchemaInfo {
 // Init is called by the Falco plugin framework as first entry,
 // we use it for setting default configuration values and mapping
 // values from `init_config` (json format for this plugin)
-func (oktaPlugin *Plugin) Init(config string) error {
+func (oktaPlugin *Plugin) Init(config string) (err error) {
 	oktaPlugin.CacheExpiration = 84600
 	oktaPlugin.CacheUserMaxSize = 200
 	oktaPlugin.RefreshInterval = 10
-	err := json.Unmarshal([]byte(config), &oktaPlugin)
+	oktaPlugin.SSLCertificate = "/etc/falco/falco.pem"
+	oktaPlugin.UseAsync = true
+	oktaPlugin.EventHookQueueSize = 50
+	oktaPlugin.EventHookOverflow = string(queue.PolicyBlock)
+	oktaPlugin.BatchTimeout = 30
+	oktaPlugin.HealthPath = health.DefaultPath
+	oktaPlugin.MetricsPath = metrics.DefaultPath
+	oktaPlugin.HTTP.Reset()
+	oktaPlugin.Dedup.Reset()
+	err = json.Unmarshal([]byte(config), &oktaPlugin)
 	if err != nil {
 		return err
 	}
+	if err = secrets.Resolve(oktaPlugin); err != nil {
+		return err
+	}
+	if _, err = queue.ParsePolicy(oktaPlugin.EventHookOverflow); err != nil {
+		return err
+	}
+	if oktaPlugin.BatchTimeout == 0 {
+		return fmt.Errorf("[okta] batch_timeout must be greater than 0")
+	}
+	if oktaPlugin.WatchdogTimeout > 0 && oktaPlugin.WatchdogTimeout <= oktaPlugin.RefreshInterval {
+		return fmt.Errorf("[okta] watchdog_timeout must be greater than refresh_interval")
+	}
+
+	// enable/disable async extraction optimazion (enabled by default)
+	extract.SetAsync(oktaPlugin.UseAsync)
+
+	// the framework doesn't call Destroy when Init fails, so the servers
+	// started before a failure are stopped here
+	defer func() {
+		if err != nil {
+			oktaPlugin.Destroy()
+		}
+	}()
+
+	// apply the reloadable settings, and watch them if a file is set
+	oktaPlugin.settings.Store(oktaPlugin.initSettings())
+	if len(oktaPlugin.ReloadFile) > 0 {
+		w, err := reload.Watch(oktaPlugin.ReloadFile, oktaPlugin.reload, func(format string, v ...interface{}) {
+			log.Printf("[okta] "+format+"\n", v...)
+		})
+		if err != nil {
+			return err
+		}
+		oktaPlugin.reloader = w
+	}
 	oktaPlugin.cache = gcache.New(10000).LFU().Build()
+
+	// restore the cursors of the previous runs, if any
+	if len(oktaPlugin.CheckpointFile) > 0 {
+		s, err := checkpoint.Open(oktaPlugin.CheckpointFile)
+		if err != nil {
+			return err
+		}
+		oktaPlugin.checkpoints = s
+	}
+
+	// start the optional pprof and expvar server
+	if len(oktaPlugin.DebugAddress) > 0 {
+		srv, err := debugserver.Start(oktaPlugin.DebugAddress)
+		if err != nil {
+			return err
+		}
+		oktaPlugin.debugServer = srv
+	}
+
+	// start the optional health server
+	if len(oktaPlugin.HealthAddress) > 0 {
+		srv, err := health.Start(oktaPlugin.HealthAddress, oktaPlugin.HealthPath)
+		if err != nil {
+			return err
+		}
+		oktaPlugin.healthServer = srv
+	}
+
+	// start the optional metrics endpoint
+	if len(oktaPlugin.MetricsAddress) > 0 {
+		m, err := metrics.Start(oktaPlugin.MetricsAddress, oktaPlugin.MetricsPath, "okta")
+		if err != nil {
+			return err
+		}
+		oktaPlugin.metrics = m
+	}
+	return nil
+}
+
+// initSettings returns the reloadable settings of the init config
+func (oktaPlugin *Plugin) initSettings() reloadableSettings {
+	return reloadableSettings{
+		APIToken:        oktaPlugin.APIToken,
+		EventHookSecret: oktaPlugin.EventHookSecret,
+		RefreshInterval: oktaPlugin.RefreshInterval,
+	}
+}
+
+// currentSettings returns the reloadable settings currently in effect
+func (oktaPlugin *Plugin) currentSettings() reloadableSettings {
+	if s, ok := oktaPlugin.settings.Load().(reloadableSettings); ok {
+		return s
+	}
+	return oktaPlugin.initSettings()
+}
+
+// reload applies the settings of the reload file on top of the init config,
+// so that removing one of them restores its init value
+func (oktaPlugin *Plugin) reload(data []byte) error {
+	s := oktaPlugin.initSettings()
+	if err := reload.Decode(data, &s); err != nil {
+		return err
+	}
+	if err := secrets.Resolve(&s); err != nil {
+		return err
+	}
+	if s.EventHookSecret == "" && oktaPlugin.currentSettings().EventHookSecret != "" {
+		return errkind.Errorf(errkind.Config, "event_hook_secret can't be removed, the Event Hooks would be rejected")
+	}
+	oktaPlugin.settings.Store(s)
 	return nil
 }
 
+func (oktaPlugin *Plugin) Destroy() {
+	if oktaPlugin.reloader != nil {
+		oktaPlugin.reloader.Close()
+		oktaPlugin.reloader = nil
+	}
+	if oktaPlugin.checkpoints != nil {
+		oktaPlugin.checkpoints.Close()
+		oktaPlugin.checkpoints = nil
+	}
+	if oktaPlugin.debugServer != nil {
+		oktaPlugin.debugServer.Close()
+		oktaPlugin.debugServer = nil
+	}
+	if oktaPlugin.healthServer != nil {
+		oktaPlugin.healthServer.Close()
+		oktaPlugin.healthServer = nil
+	}
+	if oktaPlugin.metrics != nil {
+		oktaPlugin.metrics.Close()
+		oktaPlugin.metrics = nil
+	}
+}
+
 // Fields exposes to Falco plugin framework all availables fields for this plugin
 func (oktaPlugin *Plugin) Fields() []sdk.FieldEntry {
-	return []sdk.FieldEntry{
+	return append([]sdk.FieldEntry{
 		{Type: "string", Name: "okta.app", Desc: "Application"},
 		{Type: "string", Name: "okta.org", Desc: "Organization"},
+		{Type: "string", Name: "okta.tenant", Desc: "Tenant of the event, for the instances opened with a list of tenants"},
 		{Type: "string", Name: "okta.evt.type", Desc: "Event Type"},
 		{Type: "string", Name: "okta.evt.legacytype", Desc: "Event Legacy Type"},
 		{Type: "string", Name: "okta.severity", Desc: "Severity"},
 		{Type: "string", Name: "okta.message", Desc: "Message"},
 		{Type: "string", Name: "okta.published", Desc: "Event Source Timestamp"},
 		{Type: "string", Name: "okta.actor.id", Desc: "Actor ID"},
-		{Type: "string", Name: "okta.actor.Type", Desc: "Actor Type"},
+		{Type: "string", Name: "okta.actor.Type", Desc: "Actor Type (deprecated, use okta.actor.type)"},
+		{Type: "string", Name: "okta.actor.type", Desc: "Actor Type"},
 		{Type: "string", Name: "okta.actor.alternateid", Desc: "Actor Alternate ID"},
 		{Type: "string", Name: "okta.actor.name", Desc: "Actor Display Name"},
 		{Type: "string", Name: "okta.client.zone", Desc: "Client Zone"},
@@ -215,6 +416,10 @@ func (oktaPlugin *Plugin) Fields() []sdk.FieldEntry {
 		{Type: "string", Name: "okta.security.asorg", Desc: "Security AS Org"},
 		{Type: "string", Name: "okta.security.isp", Desc: "Security ISP"},
 		{Type: "string", Name: "okta.security.domain", Desc: "Security Domain"},
+		{Type: "string", Name: "okta.security.threat", Desc: "Whether Okta ThreatInsight suspected a threat ('true' or 'false')"},
+		{Type: "string", Name: "okta.security.risk.level", Desc: "Risk Level computed by Okta (LOW, MEDIUM or HIGH)"},
+		{Type: "string", Name: "okta.security.risk.reasons", Desc: "Reasons of the Risk Level computed by Okta"},
+		{Type: "string", Name: "okta.security.behaviors", Desc: "Result of a Behavior Detection evaluated by Okta (POSITIVE, NEGATIVE or UNKNOWN), e.g. okta.security.behaviors[New Device]", Arg: sdk.FieldEntryArg{IsRequired: true, IsKey: true}},
 		{Type: "string", Name: "okta.target.user.id", Desc: "Target User ID"},
 		{Type: "string", Name: "okta.target.user.alternateid", Desc: "Target User Alternate ID"},
 		{Type: "string", Name: "okta.target.user.name", Desc: "Target User Name"},
@@ -222,31 +427,38 @@ func (oktaPlugin *Plugin) Fields() []sdk.FieldEntry {
 		{Type: "string", Name: "okta.target.group.alternateid", Desc: "Target Group Alternate ID"},
 		{Type: "string", Name: "okta.target.group.name", Desc: "Target Group Name"},
 		{Type: "string", Name: "okta.target.app.alternateid", Desc: "Target App Alternate ID"},
+		{Type: "string", Name: "okta.target.user", IsList: true, Desc: "Alternate IDs of all the Target Users"},
+		{Type: "string", Name: "okta.target.group", IsList: true, Desc: "Alternate IDs of all the Target Groups"},
+		{Type: "string", Name: "okta.target.app", IsList: true, Desc: "Alternate IDs of all the Target Apps"},
+		{Type: "string", Name: "okta.value", Desc: "Value of the Log Event at a dotted path or a JSON pointer, e.g. okta.value[client.geographicalContext.city] or okta.value[/target/0/alternateId]. The values that are not strings are rendered in JSON.", Arg: sdk.FieldEntryArg{IsRequired: true, IsKey: true}},
 		{Type: "uint64", Name: "okta.mfa.failure.countlast", Desc: "Count of MFA failures in last seconds", Arg: sdk.FieldEntryArg{IsRequired: true, IsIndex: true}},
 		{Type: "uint64", Name: "okta.mfa.deny.countlast", Desc: "Count of MFA denies in last seconds", Arg: sdk.FieldEntryArg{IsRequired: true, IsIndex: true}},
-	}
+	}, cloudevents.Fields()...)
 }
 
 // Extract allows Falco plugin framework to get values for all available fields
 func (oktaPlugin *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
-	data := oktaPlugin.lastLogEvent
+	if oktaPlugin.metrics != nil {
+		defer oktaPlugin.metrics.ObserveExtraction(time.Now())
+	}
+	// the event is parsed lazily once per event number, and each field
+	// only reads the values it needs from the parsed document
+	var err error
+	oktaPlugin.jdata, err = oktaPlugin.jcache.Get(evt.EventNum(), evt.Reader())
+	if err != nil {
+		return err
+	}
 
+	// the MFA counters are updated only once per event
 	if evt.EventNum() != oktaPlugin.lastEventNum {
-		rawData, err := io.ReadAll(evt.Reader())
-		if err != nil {
-			return err
-		}
-
-		err = json.Unmarshal(rawData, &data)
-		if err != nil {
-			return err
-		}
-
-		oktaPlugin.lastLogEvent = data
 		oktaPlugin.lastEventNum = evt.EventNum()
 
-		if data.EventType == "user.mfa.okta_verify.deny_push" || (data.EventType == "user.authentication.auth_via_mfa" && data.Outcome.Result == "FAILURE") {
-			key := data.EventType + ":" + data.Actor.ID
+		if isMFAFailure(oktaPlugin.jdata) {
+			key := getString(oktaPlugin.jdata, "eventType") + ":" + getString(oktaPlugin.jdata, "actor", "id")
+			if name := getString(oktaPlugin.jdata, tenant.Key); name != "" {
+				// the actors of different tenants are counted separately
+				key = name + ":" + key
+			}
 			valueList := []uint64{}
 			value, err := oktaPlugin.cache.Get(key)
 			if err == nil {
@@ -266,133 +478,173 @@ func (oktaPlugin *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) e
 		}
 	}
 
+	data := oktaPlugin.jdata
+	if cloudevents.IsField(req.Field()) {
+		return cloudevents.Extract(req, data)
+	}
 	switch req.Field() {
 	case "okta.app":
-		if strings.HasPrefix(data.DebugContext.DebugData.RequestURI, "/app/") {
-			s := strings.Split(data.DebugContext.DebugData.RequestURI, "/")
+		requestURI := getString(data, "debugContext", "debugData", "requestUri")
+		if strings.HasPrefix(requestURI, "/app/") {
+			s := strings.Split(requestURI, "/")
 			req.SetValue(s[2])
 		}
 	case "okta.target.app.alternateid":
-		for _, i := range data.Target {
-			if i.Type == "AppInstance" {
-				req.SetValue(i.AlternateID)
+		for _, i := range data.GetArray("target") {
+			if getString(i, "type") == "AppInstance" {
+				req.SetValue(getString(i, "alternateId"))
 			}
 		}
 	case "okta.org":
-		req.SetValue(oktaPlugin.Organization)
+		org := oktaPlugin.Organization
+		if name := getString(data, tenant.Key); name != "" {
+			if v, ok := oktaPlugin.tenantOrgs.Load(name); ok {
+				org = v.(string)
+			}
+		}
+		req.SetValue(org)
+	case "okta.tenant":
+		if name := getString(data, tenant.Key); name != "" {
+			req.SetValue(name)
+		}
 	case "okta.evt.type":
-		req.SetValue(data.EventType)
+		req.SetValue(getString(data, "eventType"))
 	case "okta.evt.legacytype":
-		req.SetValue(data.LegacyEventType)
+		req.SetValue(getString(data, "legacyEventType"))
 	case "okta.severity":
-		req.SetValue(data.Severity)
+		req.SetValue(getString(data, "severity"))
 	case "okta.message":
-		req.SetValue(data.DisplayMessage)
+		req.SetValue(getString(data, "displayMessage"))
 	case "okta.published":
-		req.SetValue(data.Published)
+		req.SetValue(getString(data, "published"))
 	case "okta.actor.id":
-		req.SetValue(data.Actor.ID)
-	case "okta.actor.Type":
-		req.SetValue(data.Actor.Type)
+		req.SetValue(getString(data, "actor", "id"))
+	case "okta.actor.Type", "okta.actor.type":
+		req.SetValue(getString(data, "actor", "type"))
 	case "okta.actor.alternateid":
-		req.SetValue(data.Actor.AlternateID)
+		req.SetValue(getString(data, "actor", "alternateId"))
 	case "okta.actor.name":
-		req.SetValue(data.Actor.DisplayName)
+		req.SetValue(getString(data, "actor", "displayName"))
 	case "okta.client.zone":
-		req.SetValue(data.Client.Zone)
+		req.SetValue(getString(data, "client", "zone"))
 	case "okta.client.ip":
-		req.SetValue(data.Client.IPAddress)
+		req.SetValue(getString(data, "client", "ipAddress"))
 	case "okta.client.device":
-		req.SetValue(data.Client.Device)
+		req.SetValue(getString(data, "client", "device"))
 	case "okta.client.id":
-		req.SetValue(data.Client.ID)
+		req.SetValue(getString(data, "client", "id"))
 	case "okta.client.geo.city":
-		req.SetValue(data.Client.GeographicalContext.City)
+		req.SetValue(getString(data, "client", "geographicalContext", "city"))
 	case "okta.client.geo.state":
-		req.SetValue(data.Client.GeographicalContext.State)
+		req.SetValue(getString(data, "client", "geographicalContext", "state"))
 	case "okta.client.geo.country":
-		req.SetValue(data.Client.GeographicalContext.Country)
+		req.SetValue(getString(data, "client", "geographicalContext", "country"))
 	case "okta.client.geo.postalcode":
-		req.SetValue(data.Client.GeographicalContext.PostalCode)
+		req.SetValue(getString(data, "client", "geographicalContext", "postalCode"))
 	case "okta.client.geo.lat":
-		req.SetValue(fmt.Sprintf("%v", data.Client.GeographicalContext.Geolocation.Lat))
+		req.SetValue(fmt.Sprintf("%v", data.GetFloat64("client", "geographicalContext", "geolocation", "lat")))
 	case "okta.client.geo.lon":
-		req.SetValue(fmt.Sprintf("%v", data.Client.GeographicalContext.Geolocation.Lon))
+		req.SetValue(fmt.Sprintf("%v", data.GetFloat64("client", "geographicalContext", "geolocation", "lon")))
 	case "okta.useragent.os":
-		req.SetValue(data.Client.UserAgent.OS)
+		req.SetValue(getString(data, "client", "userAgent", "os"))
 	case "okta.useragent.browser":
-		req.SetValue(data.Client.UserAgent.Browser)
+		req.SetValue(getString(data, "client", "userAgent", "browser"))
 	case "okta.useragent.raw":
-		req.SetValue(data.Client.UserAgent.RawUserAgent)
+		req.SetValue(getString(data, "client", "userAgent", "rawUserAgent"))
 	case "okta.result":
-		req.SetValue(data.Outcome.Result)
+		req.SetValue(getString(data, "outcome", "result"))
 	case "okta.reason":
-		req.SetValue(data.Outcome.Reason)
+		req.SetValue(getString(data, "outcome", "reason"))
 	case "okta.transaction.id":
-		req.SetValue(data.Transaction.ID)
+		req.SetValue(getString(data, "transaction", "id"))
 	case "okta.transaction.type":
-		req.SetValue(data.Transaction.Type)
+		req.SetValue(getString(data, "transaction", "type"))
 	case "okta.requesturi":
-		req.SetValue(data.DebugContext.DebugData.RequestURI)
+		req.SetValue(getString(data, "debugContext", "debugData", "requestUri"))
 	case "okta.principal.id":
-		req.SetValue(data.DebugContext.DebugData.OriginalPrincipal.ID)
+		req.SetValue(getString(data, "debugContext", "debugData", "originalPrincipal", "id"))
 	case "okta.principal.alternateid":
-		req.SetValue(data.DebugContext.DebugData.OriginalPrincipal.AlternateID)
+		req.SetValue(getString(data, "debugContext", "debugData", "originalPrincipal", "alternateId"))
 	case "okta.principal.type":
-		req.SetValue(data.DebugContext.DebugData.OriginalPrincipal.Type)
+		req.SetValue(getString(data, "debugContext", "debugData", "originalPrincipal", "type"))
 	case "okta.principal.name":
-		req.SetValue(data.DebugContext.DebugData.OriginalPrincipal.DisplayName)
+		req.SetValue(getString(data, "debugContext", "debugData", "originalPrincipal", "displayName"))
 	case "okta.authentication.step":
-		req.SetValue(data.AuthenticationContext.AuthenticationStep)
+		req.SetValue(strconv.Itoa(data.GetInt("authenticationContext", "authenticationStep")))
 	case "okta.authentication.sessionid":
-		req.SetValue(data.AuthenticationContext.ExternalSessionID)
+		req.SetValue(getString(data, "authenticationContext", "externalSessionId"))
 	case "okta.security.asnumber":
-		req.SetValue(data.SecurityContext.AsNumber)
+		req.SetValue(data.GetUint64("securityContext", "asNumber"))
 	case "okta.security.asorg":
-		req.SetValue(data.SecurityContext.AsOrg)
+		req.SetValue(getString(data, "securityContext", "asOrg"))
 	case "okta.security.isp":
-		req.SetValue(data.SecurityContext.ISP)
+		req.SetValue(getString(data, "securityContext", "isp"))
 	case "okta.security.domain":
-		req.SetValue(data.SecurityContext.Domain)
+		req.SetValue(getString(data, "securityContext", "domain"))
+	case "okta.security.threat":
+		req.SetValue(getString(data, "debugContext", "debugData", "threatSuspected"))
+	case "okta.security.risk.level":
+		req.SetValue(parseDebugDataMap(getString(data, "debugContext", "debugData", "risk"))["level"])
+	case "okta.security.risk.reasons":
+		req.SetValue(parseDebugDataMap(getString(data, "debugContext", "debugData", "risk"))["reasons"])
+	case "okta.value":
+		// the path is compiled once, and looked up in the cached document
+		v, err := oktaPlugin.jcache.Lookup(evt.EventNum(), evt.Reader(), req.ArgKey())
+		if err != nil {
+			return err
+		}
+		if v != nil {
+			req.SetValue(jsoncache.String(v))
+		}
+	case "okta.security.behaviors":
+		if v, ok := parseDebugDataMap(getString(data, "debugContext", "debugData", "behaviors"))[req.ArgKey()]; ok {
+			req.SetValue(v)
+		}
 	case "okta.target.user.id":
-		for _, i := range data.Target {
-			if i.Type == "User" {
-				req.SetValue(i.ID)
+		for _, i := range data.GetArray("target") {
+			if getString(i, "type") == "User" {
+				req.SetValue(getString(i, "id"))
 			}
 		}
 	case "okta.target.user.alternateid":
-		for _, i := range data.Target {
-			if i.Type == "User" {
-				req.SetValue(i.AlternateID)
+		for _, i := range data.GetArray("target") {
+			if getString(i, "type") == "User" {
+				req.SetValue(getString(i, "alternateId"))
 			}
 		}
 	case "okta.target.user.name":
-		for _, i := range data.Target {
-			if i.Type == "User" {
-				req.SetValue(i.DisplayName)
+		for _, i := range data.GetArray("target") {
+			if getString(i, "type") == "User" {
+				req.SetValue(getString(i, "displayName"))
 			}
 		}
 	case "okta.target.group.id":
-		for _, i := range data.Target {
-			if i.Type == "UserGroup" {
-				req.SetValue(i.ID)
+		for _, i := range data.GetArray("target") {
+			if getString(i, "type") == "UserGroup" {
+				req.SetValue(getString(i, "id"))
 			}
 		}
 	case "okta.target.group.alternateid":
-		for _, i := range data.Target {
-			if i.Type == "UserGroup" {
-				req.SetValue(i.AlternateID)
+		for _, i := range data.GetArray("target") {
+			if getString(i, "type") == "UserGroup" {
+				req.SetValue(getString(i, "alternateId"))
 			}
 		}
 	case "okta.target.group.name":
-		for _, i := range data.Target {
-			if i.Type == "UserGroup" {
-				req.SetValue(i.DisplayName)
+		for _, i := range data.GetArray("target") {
+			if getString(i, "type") == "UserGroup" {
+				req.SetValue(getString(i, "displayName"))
 			}
 		}
+	case "okta.target.user":
+		req.SetValue(targetAlternateIDs(data, "User"))
+	case "okta.target.group":
+		req.SetValue(targetAlternateIDs(data, "UserGroup"))
+	case "okta.target.app":
+		req.SetValue(targetAlternateIDs(data, "AppInstance"))
 	case "okta.mfa.failure.countlast", "okta.mfa.deny.countlast":
-		if data.EventType == "user.mfa.okta_verify.deny_push" || (data.EventType == "user.authentication.auth_via_mfa" && data.Outcome.Result == "FAILURE") {
-			key := data.EventType + ":" + data.Actor.ID
+		if isMFAFailure(data) {
+			key := getString(data, "eventType") + ":" + getString(data, "actor", "id")
 			shift := req.ArgIndex()
 			getvalue, err := oktaPlugin.cache.Get(key)
 			if err == nil {
@@ -418,98 +670,326 @@ func (oktaPlugin *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) e
 	return nil
 }
 
-// Open is called by Falco plugin framework for opening a stream of events, we call that an instance
+// Open is called by Falco plugin framework for opening a stream of events, we call that an instance.
+// An empty params polls the Okta System Log API, while an URL starts a server receiving Okta Event Hooks.
+// A list of tenants polls the System Log API of each of their organizations.
 func (oktaPlugin *Plugin) Open(params string) (source.Instance, error) {
-	ctx, cancel := context.WithCancel(context.Background())
+	params, err := secrets.ExpandEnv(params)
+	if err != nil {
+		return nil, errkind.Count(errkind.New(errkind.Config, err), oktaPlugin.metrics)
+	}
+	if tenant.IsList(params) {
+		var tenants []oktaTenant
+		if err := tenant.Parse(params, &tenants); err != nil {
+			return nil, errkind.Count(errkind.New(errkind.Config, err), oktaPlugin.metrics)
+		}
+		for _, t := range tenants {
+			if t.Organization == "" || t.APIToken == "" {
+				return nil, errkind.Count(errkind.Errorf(errkind.Config, "missing organization or api_token of tenant %s", t.Name), oktaPlugin.metrics)
+			}
+		}
+		return oktaPlugin.openPolling(tenants)
+	}
+	if params = strings.TrimSpace(params); params != "" {
+		u, err := url.Parse(params)
+		if err != nil {
+			return nil, errkind.Count(errkind.New(errkind.Config, err), oktaPlugin.metrics)
+		}
+		switch u.Scheme {
+		case "http":
+			return oktaPlugin.OpenEventHook(u.Host, u.Path, false)
+		case "https":
+			return oktaPlugin.OpenEventHook(u.Host, u.Path, true)
+		default:
+			return nil, errkind.Count(errkind.Errorf(errkind.Config, `scheme "%s" is not supported`, u.Scheme), oktaPlugin.metrics)
+		}
+	}
+
+	return oktaPlugin.openPolling([]oktaTenant{{Organization: oktaPlugin.Organization}})
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://%v.%v", oktaPlugin.Organization, oktaBaseURL), nil)
+// openPolling opens a stream of the events returned by the System Log API of
+// the organizations of the given tenants, which are polled concurrently and
+// merged in the time order of their events. The tenant without a name is the
+// organization of the init config, whose token can be reloaded.
+func (oktaPlugin *Plugin) openPolling(tenants []oktaTenant) (source.Instance, error) {
+	// the events of all the organizations go through the same window,
+	// since their uuid is unique across organizations
+	filter, err := dedup.New(oktaPlugin.Dedup)
 	if err != nil {
-		cancel()
-		return nil, err
+		return nil, errkind.Count(errkind.New(errkind.Config, err), oktaPlugin.metrics)
 	}
 
-	since := time.Now().UTC().Add(time.Duration(-30) * time.Second)
-	values := req.URL.Query()
-	values.Add("since", since.Format(time.RFC3339))
-	req.URL.RawQuery = values.Encode()
+	tracker := oktaPlugin.healthServer.Track()
 
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "SSWS "+oktaPlugin.APIToken)
-
-	return &PluginInstance{
-		client:          &http.Client{},
-		request:         req,
-		cancel:          cancel,
-		refreshInterval: oktaPlugin.RefreshInterval,
-		lastReqTime:     since,
-	}, nil
-}
+	// the watchdog restarts a stalled polling by canceling the calls in
+	// progress, which are retried at the next interval
+	var polls sync.Map // organization -> *stallablePoll
+	if oktaPlugin.WatchdogTimeout > 0 {
+		tracker.Watch(time.Duration(oktaPlugin.WatchdogTimeout)*time.Second, func(idle time.Duration) {
+			if !oktaPlugin.WatchdogRestart {
+				log.Printf("[okta] polling stalled, no event nor call completed for %s\n", idle.Round(time.Second))
+				return
+			}
+			log.Printf("[okta] polling stalled, no event nor call completed for %s, restarting it\n", idle.Round(time.Second))
+			polls.Range(func(_, p interface{}) bool {
+				p.(*stallablePoll).stall()
+				return true
+			})
+		})
+	}
 
-// String represents the raw value of on event
-// todo: optimize this to cache by event number
-func (oktaPlugin *Plugin) String(evt sdk.EventReader) (string, error) {
-	evtBytes, err := io.ReadAll(evt.Reader())
+	var shards []multishard.Shard
+	for _, t := range tenants {
+		t := t
+		// the calls wait for the quota of the organization, and
+		// for its rate limit to be reset once exhausted
+		limiter := ratelimit.New(float64(oktaPlugin.RateLimit), 1)
+		client, err := httpclient.New(oktaPlugin.HTTP, func(rt http.RoundTripper) http.RoundTripper {
+			return ratelimit.Transport(limiter, rt)
+		})
+		if err != nil {
+			tracker.Close()
+			return nil, errkind.Count(errkind.New(errkind.Config, err), oktaPlugin.metrics)
+		}
+		endpoint := fmt.Sprintf("https://%v.%v", t.Organization, oktaBaseURL)
+		if t.Name != "" {
+			oktaPlugin.tenantOrgs.Store(t.Name, t.Organization)
+		}
+
+		// the polling resumes from the last event of the previous run, if
+		// saved, or starts slightly in the past otherwise
+		start := time.Now().UTC().Add(time.Duration(-30) * time.Second).Format(time.RFC3339)
+		shards = append(shards, multishard.Shard{
+			Name:   t.Organization,
+			Cursor: start,
+			Poll: func(ctx context.Context, since string, emit multishard.Emit) (string, error) {
+				if _, err := time.Parse(time.RFC3339, since); err != nil {
+					log.Printf("[okta] ignoring the invalid checkpoint of %s: %s\n", t.Organization, since)
+					since = start
+				}
+				p := newStallablePoll(ctx)
+				polls.Store(t.Organization, p)
+				defer func() {
+					polls.Delete(t.Organization)
+					p.cancel()
+				}()
+
+				req, err := http.NewRequestWithContext(p.ctx, "GET", endpoint, nil)
+				if err != nil {
+					return "", err
+				}
+				values := req.URL.Query()
+				values.Add("since", since)
+				values.Add("limit", strconv.Itoa(oktaMaxLimit))
+				req.URL.RawQuery = values.Encode()
+				req.Header.Add("Accept", "application/json")
+				req.Header.Add("Content-Type", "application/json")
+
+				// the token can be reloaded between two calls
+				token := oktaPlugin.currentSettings().APIToken
+				if t.Name != "" {
+					token = t.APIToken
+				}
+				req.Header.Set("Authorization", "SSWS "+token)
+				err = pollLogEvents(p.ctx, client, req, emit, tracker, oktaPlugin.metrics, filter, t.Name)
+				if err != nil && p.stalled() {
+					err = errStalled
+				}
+				tracker.Poll()
+				if err != nil && t.Name != "" {
+					err = fmt.Errorf("tenant %s: %w", t.Name, err)
+				}
+				return req.URL.Query().Get("since"), err
+			},
+		})
+	}
+
+	inst, err := multishard.Open(shards, multishard.Options{
+		// the interval can be reloaded between two calls
+		Interval: func() time.Duration {
+			return time.Duration(oktaPlugin.currentSettings().RefreshInterval) * time.Second
+		},
+		Checkpoints: oktaPlugin.checkpoints,
+		Prefix:      "okta",
+		Buffer:      &batch.BufferOptions{Timeout: oktaPlugin.batchTimeout()},
+		OnError: func(shard string, err error) error {
+			if errors.Is(err, errStalled) {
+				return nil
+			}
+			tracker.SetConnected(false)
+			tracker.Error()
+			oktaPlugin.metrics.UpstreamError()
+			return errkind.Count(err, oktaPlugin.metrics)
+		},
+		Logf: func(format string, v ...interface{}) {
+			log.Printf("[okta] "+format+"\n", v...)
+		},
+		OnClose: func() {
+			tracker.Close()
+			if err := filter.Close(); err != nil {
+				log.Printf("[okta] failed to save the de-duplication state: %s\n", err.Error())
+			}
+		},
+	})
 	if err != nil {
-		return "", err
+		tracker.Close()
+		return nil, errkind.Count(errkind.New(errkind.Config, err), oktaPlugin.metrics)
 	}
-	evtStr := string(evtBytes)
+	return inst, nil
+}
 
-	return fmt.Sprintf("%v", evtStr), nil
+// errStalled is the error of the calls canceled by the watchdog
+var errStalled = errors.New("call canceled by the watchdog")
+
+// stallablePoll is a poll in progress, which the watchdog can cancel
+type stallablePoll struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	stalls int32
 }
 
-// NextBatch is called by Falco plugin framework to get a batch of events from the instance
-func (oktaInstance *PluginInstance) NextBatch(pState sdk.PluginState, evts sdk.EventWriters) (int, error) {
-	now := time.Now().UTC()
-	if duration := now.Sub(oktaInstance.lastReqTime); duration < (time.Duration(oktaInstance.refreshInterval) * time.Second) {
-		time.Sleep(time.Duration(oktaInstance.refreshInterval)*time.Second - duration)
-		now = time.Now()
-	}
+func newStallablePoll(ctx context.Context) *stallablePoll {
+	p := &stallablePoll{}
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	return p
+}
+
+// stall cancels the poll
+func (p *stallablePoll) stall() {
+	atomic.StoreInt32(&p.stalls, 1)
+	p.cancel()
+}
+
+// stalled returns true if the poll was canceled by the watchdog
+func (p *stallablePoll) stalled() bool {
+	return atomic.LoadInt32(&p.stalls) != 0
+}
 
-	var logEvents []LogEvent
-	values := oktaInstance.request.URL.Query()
-	values.Set("limit", fmt.Sprintf("%v", evts.Len()))
-	oktaInstance.request.URL.RawQuery = values.Encode()
-	oktaInstance.lastReqTime = now
+// batchTimeout is the delay after which the push instances return a
+// partial batch, so that low-rate sources don't wait for the batch to fill
+func (oktaPlugin *Plugin) batchTimeout() time.Duration {
+	return time.Duration(oktaPlugin.BatchTimeout) * time.Millisecond
+}
 
-	resp, err := oktaInstance.client.Do(oktaInstance.request)
+// pollLogEvents sends the log events returned by one call to the Okta API,
+// and moves the since parameter of the request after the last one of them.
+// The name of the tenant of the organization, if any, is added to the events,
+// and the duplicates of the events already received are dropped by filter.
+func pollLogEvents(ctx context.Context, client *http.Client, req *http.Request, emit multishard.Emit, tracker *health.Tracker, m *metrics.Metrics, filter *dedup.Filter, tenantName string) error {
+	resp, err := client.Do(req)
 	if err != nil {
-		return 0, err
+		return err
 	}
 	defer resp.Body.Close()
 
+	// errors such as rate limiting are retried at the next call, which
+	// waits for the rate limit to be reset
 	if resp.StatusCode != http.StatusOK {
-		return 0, sdk.ErrTimeout
+		kind := errkind.FromStatus(resp.StatusCode)
+		if kind == errkind.Auth {
+			tracker.SetConnected(false)
+		}
+		tracker.Error()
+		m.UpstreamError()
+		err := errkind.Errorf(kind, "system log api returned %s", resp.Status)
+		log.Printf("[okta] %s, retrying at the next call\n", errkind.Count(err, m))
+		return nil
 	}
+	tracker.SetConnected(true)
 
-	err = json.NewDecoder(resp.Body).Decode(&logEvents)
+	// the events are kept raw, so that they are written as received
+	// without being unmarshaled and marshaled back
+	var logEvents []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&logEvents); err != nil {
+		return errkind.New(errkind.Parse, err)
+	}
+
+	values := req.URL.Query()
+	for _, e := range logEvents {
+		var logEvent struct {
+			Published string `json:"published"`
+		}
+		if err := json.Unmarshal(e, &logEvent); err != nil {
+			return errkind.New(errkind.Parse, err)
+		}
+		t, _ := time.Parse(time.RFC3339, logEvent.Published)
+		if filter.Seen(e) {
+			values.Set("since", t.Add(1*time.Second).Format(time.RFC3339))
+			continue
+		}
+		if tenantName != "" {
+			if e, err = tenant.Embed(e, tenantName); err != nil {
+				return errkind.New(errkind.Parse, err)
+			}
+		}
+		if !emit(source.PushEvent{Data: e, Timestamp: t}) {
+			return nil
+		}
+		m.Ingested(len(e), t)
+		values.Set("since", t.Add(1*time.Second).Format(time.RFC3339))
+		tracker.Event()
+	}
+	req.URL.RawQuery = values.Encode()
+	return nil
+}
+
+// String represents the raw value of on event
+// todo: optimize this to cache by event number
+func (oktaPlugin *Plugin) String(evt sdk.EventReader) (string, error) {
+	evtBytes, err := io.ReadAll(evt.Reader())
 	if err != nil {
-		return 0, err
+		return "", err
 	}
+	evtStr := string(evtBytes)
 
-	if len(logEvents) == 0 {
-		return 0, sdk.ErrTimeout
+	return fmt.Sprintf("%v", evtStr), nil
+}
+
+// parseDebugDataMap parses the maps serialized by Okta in the debugData
+// of the log events, e.g. "{reasons=Anomalous Device, level=MEDIUM}".
+// Values can contain ", " themselves, so a part without "=" is appended
+// to the value of the previous key.
+func parseDebugDataMap(str string) map[string]string {
+	res := map[string]string{}
+	str = strings.TrimSuffix(strings.TrimPrefix(str, "{"), "}")
+	if str == "" {
+		return res
 	}
+	var key string
+	for _, part := range strings.Split(str, ", ") {
+		if i := strings.Index(part, "="); i > 0 {
+			key = part[:i]
+			res[key] = part[i+1:]
+		} else if key != "" {
+			res[key] += ", " + part
+		}
+	}
+	return res
+}
 
-	i := 0
-	for i < evts.Len() && i < len(logEvents) {
-		s, _ := json.Marshal(logEvents[i])
-		evt := evts.Get(i)
-		if _, err := evt.Writer().Write(s); err != nil {
-			return i, err
+// targetAlternateIDs returns the Alternate IDs of all the targets of the given type
+func targetAlternateIDs(data *fastjson.Value, targetType string) []string {
+	res := []string{}
+	for _, i := range data.GetArray("target") {
+		if getString(i, "type") == targetType {
+			res = append(res, getString(i, "alternateId"))
 		}
-		t, _ := time.Parse(time.RFC3339, logEvents[i].Published)
-		evt.SetTimestamp(uint64(t.UnixNano()))
-		values.Set("since", t.Add(1*time.Second).Format(time.RFC3339))
-		i++
 	}
-	oktaInstance.request.URL.RawQuery = values.Encode()
+	return res
+}
 
-	return i, nil
+// getString returns the string located at the given keys, or an empty
+// string if it doesn't exist
+func getString(data *fastjson.Value, keys ...string) string {
+	return string(data.GetStringBytes(keys...))
 }
 
-func (oktaInstance *PluginInstance) Close() {
-	oktaInstance.cancel()
+// isMFAFailure returns true if the event is a denied or failed MFA
+func isMFAFailure(data *fastjson.Value) bool {
+	eventType := getString(data, "eventType")
+	return eventType == "user.mfa.okta_verify.deny_push" ||
+		(eventType == "user.authentication.auth_via_mfa" && getString(data, "outcome", "result") == "FAILURE")
 }
 
 func removeDuplicateUint64(intSlice []uint64) []uint64 {
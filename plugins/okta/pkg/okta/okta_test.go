@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package okta
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/falcosecurity/plugins/shared/go/golden"
+	"github.com/falcosecurity/plugins/shared/go/secrets"
+)
+
+func TestExtractGolden(t *testing.T) {
+	p := &Plugin{}
+	if err := p.Init("{}"); err != nil {
+		t.Fatal(err)
+	}
+	golden.Run(t, p, "testdata/golden",
+		append(golden.DefaultFields(p), "okta.mfa.failure.countlast[3600]")...)
+}
+
+// freeAddr returns the address of a free loopback port
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestInitUnwind(t *testing.T) {
+	dir := t.TempDir()
+	reloadFile := filepath.Join(dir, "reload.json")
+	if err := ioutil.WriteFile(reloadFile, []byte(`{"refresh_interval":5}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	debugAddr, healthAddr := freeAddr(t), freeAddr(t)
+	config := fmt.Sprintf(`{"reload_file":%q,"checkpoint_file":%q,"debugAddress":%q,"health_address":%q,"metrics_address":"invalid"}`,
+		reloadFile, filepath.Join(dir, "checkpoints.json"), debugAddr, healthAddr)
+
+	// the steps started before the failure are stopped, since Destroy is
+	// not called after a failed Init
+	p := &Plugin{}
+	if err := p.Init(config); err == nil {
+		t.Fatal("expected an error with an invalid metrics address")
+	}
+	if p.reloader != nil || p.checkpoints != nil || p.debugServer != nil || p.healthServer != nil {
+		t.Error("expected the reloader, the checkpoints and the servers to be stopped")
+	}
+	for _, addr := range []string{debugAddr, healthAddr} {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Errorf("expected %s to be released, got %s", addr, err)
+			continue
+		}
+		ln.Close()
+	}
+
+	// the plugin can be initialized again with the same addresses
+	p = &Plugin{}
+	if err := p.Init(fmt.Sprintf(`{"debugAddress":%q,"health_address":%q,"metrics_address":%q}`, debugAddr, healthAddr, healthAddr)); err != nil {
+		t.Fatal(err)
+	}
+	p.Destroy()
+	p.Destroy()
+}
+
+func TestInitSecrets(t *testing.T) {
+	t.Setenv("OKTA_TEST_TOKEN", "s3cr3t")
+	p := &Plugin{}
+	if err := p.Init(`{"api_token":"${OKTA_TEST_TOKEN}","event_hook_secret":"hook-s3cr3t","organization":"${OKTA_TEST_TOKEN}"}`); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Destroy)
+
+	// only the secrets are resolved
+	if p.APIToken != "s3cr3t" || p.Organization != "${OKTA_TEST_TOKEN}" {
+		t.Errorf("expected only api_token to be resolved, got %q and %q", p.APIToken, p.Organization)
+	}
+
+	// and they are hidden from the dumps of the config and the messages
+	dump, err := secrets.Redact(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(dump, "s3cr3t") || !strings.Contains(dump, `"api_token":"`+secrets.Redacted+`"`) {
+		t.Errorf("expected the secrets to be redacted, got %s", dump)
+	}
+	if msg := secrets.Scrub("GET /api/v1/logs: SSWS s3cr3t rejected", p); strings.Contains(msg, "s3cr3t") {
+		t.Errorf("expected the secrets to be scrubbed, got %s", msg)
+	}
+}
@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlp
+
+import (
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	"github.com/falcosecurity/plugins/shared/go/webhook/queue"
+)
+
+// the encodings of the event payloads
+const (
+	encodingJSON     = "json"
+	encodingProtobuf = "protobuf"
+)
+
+// PluginConfig represents the init configuration of the plugin
+type PluginConfig struct {
+	SSLCertificate string `json:"sslCertificate" jsonschema:"title=SSL certificate,description=The concatenated key and certificate PEM file used by the https and grpcs endpoints (Default: /etc/falco/falco.pem),default=/etc/falco/falco.pem"`
+	MaxRequestSize uint64 `json:"maxRequestSize" jsonschema:"title=Maximum request size,description=Maximum size in bytes of the decompressed export requests (Default: 4194304),default=4194304,minimum=1"`
+	MaxEventSize   uint64 `json:"maxEventSize" jsonschema:"title=Maximum event size,description=Maximum size in bytes of a log record once encoded; the bigger ones are dropped (Default: 262144),default=262144,minimum=1"`
+	QueueSize      uint64 `json:"queueSize" jsonschema:"title=Queue size,description=Maximum number of export requests waiting to be consumed (Default: 64),default=64,minimum=1"`
+	Overflow       string `json:"overflow" jsonschema:"title=Queue overflow policy,enum=block,enum=drop_oldest,enum=reject,description=What to do with the export requests received when the queue is full: block or drop_oldest or reject with a retryable error (Default: block),default=block"`
+	BatchTimeout   uint64 `json:"batchTimeout" jsonschema:"title=Batch timeout,description=Delay in milliseconds after which the events received so far are delivered without waiting for a full batch (Default: 30),default=30,minimum=1"`
+	Encoding       string `json:"encoding" jsonschema:"title=Event encoding,enum=json,enum=protobuf,description=The encoding of the event payloads: json or protobuf which is more compact and cheaper to produce and extract from (Default: json),default=json"`
+	HealthAddress  string `json:"healthAddress" jsonschema:"title=Health address,description=Address (e.g. :8081) of an HTTP server exposing the health and readiness endpoints of the plugin (Default: empty for disabled),default="`
+	HealthPath     string `json:"healthPath" jsonschema:"title=Health path,description=Path of the health endpoint. The readiness endpoint is served under <path>/ready (Default: /healthz),default=/healthz"`
+	MetricsAddress string `json:"metricsAddress" jsonschema:"title=Metrics address,description=Address (e.g. :9090) of the Prometheus endpoint shared by the plugins of the Falco process configured with the same address (Default: empty for disabled),default="`
+	MetricsPath    string `json:"metricsPath" jsonschema:"title=Metrics path,description=Path of the Prometheus endpoint (Default: /metrics),default=/metrics"`
+	UseAsync       bool   `json:"useAsync" jsonschema:"title=Use async extraction,description=If true then async extraction optimization is enabled (Default: true),default=true"`
+}
+
+// Reset sets the configuration to its default values
+func (p *PluginConfig) Reset() {
+	p.SSLCertificate = "/etc/falco/falco.pem"
+	p.MaxRequestSize = 4 * 1024 * 1024
+	p.MaxEventSize = uint64(sdk.DefaultEvtSize)
+	p.QueueSize = 64
+	p.Overflow = string(queue.PolicyBlock)
+	p.BatchTimeout = 30
+	p.Encoding = encodingJSON
+	p.HealthPath = health.DefaultPath
+	p.MetricsPath = metrics.DefaultPath
+	p.UseAsync = true
+}
@@ -0,0 +1,276 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlp
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	eventpb "github.com/falcosecurity/plugins/shared/go/proto"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+// logEvent is the payload of an event: a LogRecord, along with the
+// resource and the instrumentation scope it was emitted by. The values
+// of the attributes and of the body are converted to their natural JSON
+// representation.
+type logEvent struct {
+	Time           string                 `json:"time,omitempty"`
+	ObservedTime   string                 `json:"observedTime,omitempty"`
+	SeverityNumber int32                  `json:"severityNumber,omitempty"`
+	SeverityText   string                 `json:"severityText,omitempty"`
+	Body           interface{}            `json:"body,omitempty"`
+	Attributes     map[string]interface{} `json:"attributes,omitempty"`
+	TraceID        string                 `json:"traceId,omitempty"`
+	SpanID         string                 `json:"spanId,omitempty"`
+	Resource       logResource            `json:"resource"`
+	Scope          logScope               `json:"scope"`
+}
+
+type logResource struct {
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type logScope struct {
+	Name       string                 `json:"name,omitempty"`
+	Version    string                 `json:"version,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// pushExportRequest sends an event for each LogRecord of an export
+// request. Here we make all errors non-blocking by simply logging them,
+// to ensure the event source is not closed with bad payloads. The events
+// are sent unless the context is done, in which case false is returned.
+func (p *Plugin) pushExportRequest(ctx context.Context, req *collogspb.ExportLogsServiceRequest, c chan<- source.PushEvent) bool {
+	var b, shared eventpb.Builder
+	for _, rl := range req.GetResourceLogs() {
+		resource := logResource{Attributes: attributes(rl.GetResource().GetAttributes())}
+		for _, sl := range rl.GetScopeLogs() {
+			scope := logScope{
+				Name:       sl.GetScope().GetName(),
+				Version:    sl.GetScope().GetVersion(),
+				Attributes: attributes(sl.GetScope().GetAttributes()),
+			}
+			if p.Config.Encoding == encodingProtobuf {
+				// the resource and the scope are encoded once for all
+				// their log records
+				shared.Reset()
+				appendScope(&shared, rl.GetResource().GetAttributes(), sl.GetScope())
+			}
+			for _, r := range sl.GetLogRecords() {
+				var data []byte
+				if p.Config.Encoding == encodingProtobuf {
+					b.Reset()
+					appendLogRecord(&b, r)
+					b.Merge(shared.Bytes())
+					// the builder is reused, so the data is copied
+					data = append([]byte(nil), b.Bytes()...)
+				} else {
+					var err error
+					data, err = json.Marshal(newLogEvent(r, resource, scope))
+					if err != nil {
+						log.Printf("[%s] %s\n", PluginName, errkind.Count(errkind.New(errkind.Parse, err), p.metrics))
+						continue
+					}
+				}
+				if len(data) > int(p.Config.MaxEventSize) {
+					err := errkind.Errorf(errkind.Parse, "log record larger than maxEventSize: size=%d", len(data))
+					log.Printf("[%s] %s\n", PluginName, errkind.Count(err, p.metrics))
+					continue
+				}
+				ts := recordTime(r)
+				select {
+				case c <- source.PushEvent{Data: data, Timestamp: ts}:
+					p.metrics.Ingested(len(data), ts)
+				case <-ctx.Done():
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func newLogEvent(r *logspb.LogRecord, resource logResource, scope logScope) *logEvent {
+	res := &logEvent{
+		Time:           timestamp(r.GetTimeUnixNano()),
+		ObservedTime:   timestamp(r.GetObservedTimeUnixNano()),
+		SeverityNumber: int32(r.GetSeverityNumber()),
+		SeverityText:   r.GetSeverityText(),
+		Attributes:     attributes(r.GetAttributes()),
+		Resource:       resource,
+		Scope:          scope,
+	}
+	if r.GetBody() != nil {
+		res.Body = anyValue(r.GetBody())
+	}
+	if id := r.GetTraceId(); len(id) > 0 {
+		res.TraceID = hex.EncodeToString(id)
+	}
+	if id := r.GetSpanId(); len(id) > 0 {
+		res.SpanID = hex.EncodeToString(id)
+	}
+	return res
+}
+
+// appendLogRecord encodes the fields of a LogRecord with the protobuf
+// envelope, at the JSON pointers they have in a logEvent
+func appendLogRecord(b *eventpb.Builder, r *logspb.LogRecord) {
+	if t := timestamp(r.GetTimeUnixNano()); t != "" {
+		b.String("/time", t)
+	}
+	if t := timestamp(r.GetObservedTimeUnixNano()); t != "" {
+		b.String("/observedTime", t)
+	}
+	if n := r.GetSeverityNumber(); n != 0 {
+		b.Int("/severityNumber", int64(n))
+	}
+	if s := r.GetSeverityText(); s != "" {
+		b.String("/severityText", s)
+	}
+	if r.GetBody().GetValue() != nil {
+		appendAnyValue(b, "/body", r.GetBody())
+	}
+	appendAttributes(b, "/attributes", r.GetAttributes())
+	if id := r.GetTraceId(); len(id) > 0 {
+		b.String("/traceId", hex.EncodeToString(id))
+	}
+	if id := r.GetSpanId(); len(id) > 0 {
+		b.String("/spanId", hex.EncodeToString(id))
+	}
+}
+
+// appendScope encodes the attributes of a resource and an instrumentation
+// scope with the protobuf envelope, at the JSON pointers they have in a
+// logEvent
+func appendScope(b *eventpb.Builder, resource []*commonpb.KeyValue, scope *commonpb.InstrumentationScope) {
+	appendAttributes(b, "/resource/attributes", resource)
+	if s := scope.GetName(); s != "" {
+		b.String("/scope/name", s)
+	}
+	if s := scope.GetVersion(); s != "" {
+		b.String("/scope/version", s)
+	}
+	appendAttributes(b, "/scope/attributes", scope.GetAttributes())
+}
+
+func appendAttributes(b *eventpb.Builder, prefix string, kvs []*commonpb.KeyValue) {
+	for _, kv := range kvs {
+		appendAnyValue(b, prefix+eventpb.Pointer(kv.GetKey()), kv.GetValue())
+	}
+}
+
+// appendAnyValue encodes an AnyValue with the protobuf envelope. The arrays
+// and the key-value lists are encoded in JSON like in a logEvent, and so are
+// the doubles that can't be represented in JSON.
+func appendAnyValue(b *eventpb.Builder, key string, v *commonpb.AnyValue) {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		b.String(key, v.StringValue)
+	case *commonpb.AnyValue_BoolValue:
+		b.Bool(key, v.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		b.Int(key, v.IntValue)
+	case *commonpb.AnyValue_DoubleValue:
+		if math.IsNaN(v.DoubleValue) || math.IsInf(v.DoubleValue, 0) {
+			b.String(key, fmt.Sprint(v.DoubleValue))
+			return
+		}
+		b.Double(key, v.DoubleValue)
+	case *commonpb.AnyValue_BytesValue:
+		b.Binary(key, v.BytesValue)
+	default:
+		data, err := json.Marshal(anyValue(&commonpb.AnyValue{Value: v}))
+		if err != nil {
+			data = []byte("null")
+		}
+		b.JSON(key, data)
+	}
+}
+
+// recordTime returns the time of a LogRecord, which is the time it was
+// observed at if the time of the event it records is unknown
+func recordTime(r *logspb.LogRecord) time.Time {
+	if t := r.GetTimeUnixNano(); t > 0 {
+		return time.Unix(0, int64(t))
+	}
+	if t := r.GetObservedTimeUnixNano(); t > 0 {
+		return time.Unix(0, int64(t))
+	}
+	return time.Now()
+}
+
+func timestamp(nsec uint64) string {
+	if nsec == 0 {
+		return ""
+	}
+	return time.Unix(0, int64(nsec)).UTC().Format(time.RFC3339Nano)
+}
+
+func attributes(kvs []*commonpb.KeyValue) map[string]interface{} {
+	if len(kvs) == 0 {
+		return nil
+	}
+	res := make(map[string]interface{}, len(kvs))
+	for _, kv := range kvs {
+		res[kv.GetKey()] = anyValue(kv.GetValue())
+	}
+	return res
+}
+
+// anyValue converts an AnyValue to a value encoded by encoding/json. The
+// doubles that can't be represented in JSON are converted to strings.
+func anyValue(v *commonpb.AnyValue) interface{} {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		if math.IsNaN(v.DoubleValue) || math.IsInf(v.DoubleValue, 0) {
+			return fmt.Sprint(v.DoubleValue)
+		}
+		return v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return v.BytesValue
+	case *commonpb.AnyValue_ArrayValue:
+		res := make([]interface{}, 0, len(v.ArrayValue.GetValues()))
+		for _, e := range v.ArrayValue.GetValues() {
+			res = append(res, anyValue(e))
+		}
+		return res
+	case *commonpb.AnyValue_KvlistValue:
+		res := attributes(v.KvlistValue.GetValues())
+		if res == nil {
+			res = map[string]interface{}{}
+		}
+		return res
+	}
+	return nil
+}
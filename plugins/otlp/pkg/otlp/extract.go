@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugins/shared/go/fieldschema"
+	eventpb "github.com/falcosecurity/plugins/shared/go/proto"
+	"github.com/valyala/fastjson"
+)
+
+// severityNames are the short names of the ranges of severity numbers
+var severityNames = []string{"TRACE", "DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+
+// logFields are the fields extracted from a log record, whose list and
+// extraction are generated from their tags by fieldSchema. The fields are
+// functions, so that only the values requested are read from the event.
+type logFields struct {
+	Severity       func() (string, bool)           `field:"otel.severity" display:"Severity" desc:"The severity text of the log record, or the short name of its severity number if the text is not set (e.g. INFO or ERROR2)."`
+	SeverityNumber func() (uint64, bool)           `field:"otel.severity.number" display:"Severity Number" desc:"The severity number of the log record, from 1 (TRACE) to 24 (FATAL4)."`
+	Body           func() (string, bool)           `field:"otel.body" display:"Body" desc:"The body of the log record. The bodies that are not strings are rendered in JSON."`
+	Attr           func(key string) (string, bool) `field:"otel.attr" arg:"required" display:"Attribute" desc:"The value of an attribute of the log record (e.g. otel.attr[http.request.method]). The values that are not strings are rendered in JSON."`
+	ResourceAttr   func(key string) (string, bool) `field:"otel.resource.attr" arg:"required" display:"Resource Attribute" desc:"The value of an attribute of the resource that emitted the log record (e.g. otel.resource.attr[k8s.pod.name]). The values that are not strings are rendered in JSON."`
+	ServiceName    func() (string, bool)           `field:"otel.service.name" display:"Service Name" desc:"The name of the service that emitted the log record, i.e. the service.name attribute of its resource."`
+	ScopeName      func() (string, bool)           `field:"otel.scope.name" display:"Scope Name" desc:"The name of the instrumentation scope that emitted the log record."`
+	ScopeVersion   func() (string, bool)           `field:"otel.scope.version" display:"Scope Version" desc:"The version of the instrumentation scope that emitted the log record."`
+	TraceID        func() (string, bool)           `field:"otel.trace_id" display:"Trace ID" desc:"The hex encoded ID of the trace the log record is correlated with."`
+	SpanID         func() (string, bool)           `field:"otel.span_id" display:"Span ID" desc:"The hex encoded ID of the span the log record is correlated with."`
+}
+
+var fieldSchema = fieldschema.Must((*logFields)(nil))
+
+func (p *Plugin) Fields() []sdk.FieldEntry {
+	return fieldSchema.Fields()
+}
+
+func (p *Plugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
+	if p.metrics != nil {
+		defer p.metrics.ObserveExtraction(time.Now())
+	}
+	data, err := p.decode(evt)
+	if err != nil {
+		return err
+	}
+
+	get := func(path ...string) func() (string, bool) {
+		return func() (string, bool) {
+			return data.get(path...)
+		}
+	}
+	fields := logFields{
+		Severity: func() (string, bool) {
+			if s, ok := data.get("severityText"); ok && len(s) > 0 {
+				return s, true
+			}
+			if n, ok := data.severityNumber(); ok && n > 0 && n <= int64(4*len(severityNames)) {
+				return severityName(int(n)), true
+			}
+			return "", false
+		},
+		SeverityNumber: func() (uint64, bool) {
+			n, ok := data.severityNumber()
+			return uint64(n), ok && n >= 0
+		},
+		Body: get("body"),
+		Attr: func(key string) (string, bool) {
+			return data.get("attributes", key)
+		},
+		ResourceAttr: func(key string) (string, bool) {
+			return data.get("resource", "attributes", key)
+		},
+		ServiceName:  get("resource", "attributes", "service.name"),
+		ScopeName:    get("scope", "name"),
+		ScopeVersion: get("scope", "version"),
+		TraceID:      get("traceId"),
+		SpanID:       get("spanId"),
+	}
+	return fieldSchema.Extract(req, &fields)
+}
+
+// severityName returns the short name of a severity number, e.g. INFO for
+// 9 and INFO2 for 10
+func severityName(n int) string {
+	name := severityNames[(n-1)/4]
+	if i := (n - 1) % 4; i > 0 {
+		name = fmt.Sprintf("%s%d", name, i+1)
+	}
+	return name
+}
+
+// record is the payload of an event, which is either a logEvent encoded in
+// JSON or its counterpart encoded with the protobuf envelope
+type record struct {
+	json *fastjson.Value
+	pb   *eventpb.Event
+}
+
+// get returns the string representation of the value at the given path of
+// a logEvent, which is its content for the strings and its JSON encoding
+// otherwise
+func (r record) get(path ...string) (string, bool) {
+	if r.pb != nil {
+		v, ok := r.pb.Lookup(eventpb.Pointer(path...))
+		if !ok {
+			return "", false
+		}
+		return v.String(), true
+	}
+	v := r.json.Get(path...)
+	if v == nil {
+		return "", false
+	}
+	if v.Type() == fastjson.TypeString {
+		return string(v.GetStringBytes()), true
+	}
+	return string(v.MarshalTo(nil)), true
+}
+
+func (r record) severityNumber() (int64, bool) {
+	if r.pb != nil {
+		v, _ := r.pb.Get("/severityNumber")
+		return v.Int()
+	}
+	v := r.json.Get("severityNumber")
+	if v == nil {
+		return 0, false
+	}
+	n, err := v.Int64()
+	return n, err == nil
+}
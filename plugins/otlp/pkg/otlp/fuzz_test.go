@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/fuzz"
+	"github.com/falcosecurity/plugins/shared/go/golden"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func FuzzExtract(f *testing.F) {
+	p := &Plugin{}
+	if err := p.Init("{}"); err != nil {
+		f.Fatal(err)
+	}
+	fuzz.AddDir(f, "testdata/golden", golden.Ext)
+	fuzz.Extract(f, p)
+}
+
+func FuzzExportRequest(f *testing.F) {
+	p := &Plugin{}
+	if err := p.Init("{}"); err != nil {
+		f.Fatal(err)
+	}
+	f.Add([]byte(`{"resourceLogs":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"checkout"}}]},"scopeLogs":[{"scope":{"name":"s"},"logRecords":[{"timeUnixNano":"1704103200000000000","severityNumber":9,"body":{"kvlistValue":{"values":[{"key":"d","value":{"doubleValue":"NaN"}}]}},"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"00f067aa0ba902b7"}]}]}]}`))
+	f.Add([]byte(`{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"traceId":"zz"},{}]}]}]}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var req collogspb.ExportLogsServiceRequest
+		b, err := hexToBase64IDs(data)
+		if err != nil || protojson.Unmarshal(b, &req) != nil {
+			// the fuzzer mutates the protobuf encoding too
+			if proto.Unmarshal(data, &req) != nil {
+				return
+			}
+		}
+		c := make(chan source.PushEvent)
+		done := make(chan struct{})
+		go func() {
+			for range c {
+			}
+			close(done)
+		}()
+		p.pushExportRequest(context.Background(), &req, c)
+		close(c)
+		<-done
+	})
+}
@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package otlp implements a Falco plugin receiving the logs exported by
+// OpenTelemetry SDKs and collectors with the OTLP protocol, over gRPC or
+// HTTP, see https://opentelemetry.io/docs/specs/otlp/. Each LogRecord is an
+// event, along with the attributes of its resource and scope.
+package otlp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/jsonschema"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/symbols/extract"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/health"
+	"github.com/falcosecurity/plugins/shared/go/jsoncache"
+	"github.com/falcosecurity/plugins/shared/go/metrics"
+	eventpb "github.com/falcosecurity/plugins/shared/go/proto"
+	"github.com/falcosecurity/plugins/shared/go/secrets"
+	"github.com/falcosecurity/plugins/shared/go/webhook/queue"
+)
+
+const (
+	PluginID          uint32 = 21
+	PluginName               = "otlp"
+	PluginDescription        = "Receive the logs exported with the OpenTelemetry Protocol (OTLP)"
+	PluginContact            = "github.com/falcosecurity/plugins"
+	PluginVersion            = "0.1.0"
+	PluginEventSource        = "otlp"
+
+	// defaultEndpoints are the default OTLP ports of the gRPC and HTTP
+	// protocols, when the open params are empty
+	defaultEndpoints = "grpc://:4317,http://:4318"
+	// defaultHTTPPath is the path of the HTTP endpoint when the open
+	// params don't set one
+	defaultHTTPPath = "/v1/logs"
+)
+
+// Plugin implements the OTLP logs receiver
+type Plugin struct {
+	plugins.BasePlugin
+	Config  PluginConfig
+	jcache  jsoncache.Cache
+	pcache  eventpb.Cache
+	health  *health.Server
+	metrics *metrics.Metrics
+}
+
+func (p *Plugin) Info() *plugins.Info {
+	return &plugins.Info{
+		ID:          PluginID,
+		Name:        PluginName,
+		Description: PluginDescription,
+		Contact:     PluginContact,
+		Version:     PluginVersion,
+		EventSource: PluginEventSource,
+	}
+}
+
+func (p *Plugin) InitSchema() *sdk.SchemaInfo {
+	reflector := jsonschema.Reflector{
+		RequiredFromJSONSchemaTags: true, // all properties are optional by default
+		AllowAdditionalProperties:  true, // unrecognized properties don't cause a parsing failures
+	}
+	if schema, err := reflector.Reflect(&PluginConfig{}).MarshalJSON(); err == nil {
+		return &sdk.SchemaInfo{
+			Schema: string(schema),
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) Init(cfg string) (err error) {
+	p.Config.Reset()
+	// the config is validated against the schema by the framework
+	json.Unmarshal([]byte(cfg), &p.Config)
+	if err := secrets.Resolve(&p.Config); err != nil {
+		return err
+	}
+	if _, err := queue.ParsePolicy(p.Config.Overflow); err != nil {
+		return err
+	}
+	if p.Config.MaxRequestSize == 0 || p.Config.MaxEventSize == 0 || p.Config.QueueSize == 0 || p.Config.BatchTimeout == 0 {
+		return fmt.Errorf("[%s] maxRequestSize, maxEventSize, queueSize and batchTimeout must be greater than 0", PluginName)
+	}
+	if p.Config.Encoding != encodingJSON && p.Config.Encoding != encodingProtobuf {
+		return fmt.Errorf("[%s] unknown encoding: %s", PluginName, p.Config.Encoding)
+	}
+	extract.SetAsync(p.Config.UseAsync)
+
+	// the framework doesn't call Destroy when Init fails, so the servers
+	// started before a failure are stopped here
+	defer func() {
+		if err != nil {
+			p.Destroy()
+		}
+	}()
+
+	// start the optional health server
+	if len(p.Config.HealthAddress) > 0 {
+		srv, err := health.Start(p.Config.HealthAddress, p.Config.HealthPath)
+		if err != nil {
+			return err
+		}
+		p.health = srv
+	}
+
+	// start the optional metrics endpoint
+	if len(p.Config.MetricsAddress) > 0 {
+		m, err := metrics.Start(p.Config.MetricsAddress, p.Config.MetricsPath, PluginName)
+		if err != nil {
+			return err
+		}
+		p.metrics = m
+	}
+	return nil
+}
+
+func (p *Plugin) Destroy() {
+	if p.health != nil {
+		p.health.Close()
+		p.health = nil
+	}
+	if p.metrics != nil {
+		p.metrics.Close()
+		p.metrics = nil
+	}
+}
+
+// Open starts receiving the logs on the comma separated list of endpoints
+// of the open params, e.g. grpc://:4317,http://:4318/v1/logs. The schemes
+// are grpc and http, or grpcs and https with TLS.
+func (p *Plugin) Open(params string) (source.Instance, error) {
+	params, err := secrets.ExpandEnv(params)
+	if err != nil {
+		return nil, errkind.Count(errkind.New(errkind.Config, err), p.metrics)
+	}
+	params = strings.TrimSpace(params)
+	if params == "" {
+		params = defaultEndpoints
+	}
+	var endpoints []*url.URL
+	for _, s := range strings.Split(params, ",") {
+		u, err := url.Parse(strings.TrimSpace(s))
+		if err != nil {
+			return nil, errkind.Count(errkind.New(errkind.Config, err), p.metrics)
+		}
+		switch u.Scheme {
+		case "grpc", "grpcs":
+		case "http", "https":
+			if u.Path == "" {
+				u.Path = defaultHTTPPath
+			}
+		default:
+			return nil, errkind.Count(errkind.Errorf(errkind.Config, `scheme "%s" is not supported`, u.Scheme), p.metrics)
+		}
+		endpoints = append(endpoints, u)
+	}
+	inst, err := p.OpenReceiver(endpoints)
+	if err != nil {
+		// the endpoints can't be listened on or their certificate loaded
+		return nil, errkind.Count(errkind.New(errkind.Config, err), p.metrics)
+	}
+	return inst, nil
+}
+
+func (p *Plugin) String(evt sdk.EventReader) (string, error) {
+	evtBytes, err := io.ReadAll(evt.Reader())
+	if err != nil {
+		return "", err
+	}
+	if eventpb.IsEvent(evtBytes) {
+		var e eventpb.Event
+		if err := e.Unmarshal(evtBytes); err != nil {
+			return "", err
+		}
+		return string(e.AppendJSON(nil)), nil
+	}
+	return string(evtBytes), nil
+}
+
+// batchTimeout is the delay after which the push instances return a
+// partial batch, so that low-rate sources don't wait for the batch to fill
+func (p *Plugin) batchTimeout() time.Duration {
+	return time.Duration(p.Config.BatchTimeout) * time.Millisecond
+}
+
+// decode parses the payload of an event, once per event number, whatever
+// its encoding
+func (p *Plugin) decode(evt sdk.EventReader) (record, error) {
+	pevt, err := p.pcache.Get(evt.EventNum(), evt.Reader())
+	if err != nil || pevt != nil {
+		return record{pb: pevt}, err
+	}
+	jdata, err := p.jcache.Get(evt.EventNum(), evt.Reader())
+	return record{json: jdata}, err
+}
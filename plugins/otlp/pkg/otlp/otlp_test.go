@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/golden"
+	eventpb "github.com/falcosecurity/plugins/shared/go/proto"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestExtractGolden(t *testing.T) {
+	p := &Plugin{}
+	if err := p.Init("{}"); err != nil {
+		t.Fatal(err)
+	}
+	golden.Run(t, p, "testdata/golden", append(golden.DefaultFields(p),
+		"otel.attr[http.request.method]",
+		"otel.attr[http.response.status_code]",
+		"otel.attr[tags]",
+		"otel.resource.attr[k8s.pod.name]",
+	)...)
+}
+
+func TestProtobufEncoding(t *testing.T) {
+	var req collogspb.ExportLogsServiceRequest
+	data, err := hexToBase64IDs([]byte(`{"resourceLogs":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"checkout"}},{"key":"a/b","value":{"arrayValue":{"values":[{"intValue":"1"},{"boolValue":true}]}}}]},"scopeLogs":[{"scope":{"name":"s","version":"1.0"},"logRecords":[{"timeUnixNano":"1704103200000000000","severityNumber":17,"body":{"kvlistValue":{"values":[{"key":"d","value":{"doubleValue":"NaN"}},{"key":"b","value":{"bytesValue":"AQI="}}]}},"attributes":[{"key":"http.response.status_code","value":{"intValue":"403"}},{"key":"ratio","value":{"doubleValue":0.25}}],"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"00f067aa0ba902b7"},{"observedTimeUnixNano":"1704103200000000000","body":{"stringValue":"hello"}}]}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := protojson.Unmarshal(data, &req); err != nil {
+		t.Fatal(err)
+	}
+
+	// the events have the same JSON rendering with both encodings
+	var strs [2][]string
+	for i, encoding := range []string{encodingJSON, encodingProtobuf} {
+		p := &Plugin{}
+		if err := p.Init(`{"encoding":"` + encoding + `"}`); err != nil {
+			t.Fatal(err)
+		}
+		c := make(chan source.PushEvent, 16)
+		p.pushExportRequest(context.Background(), &req, c)
+		close(c)
+		for evt := range c {
+			if encoding == encodingProtobuf && !eventpb.IsEvent(evt.Data) {
+				t.Fatalf("event not encoded with protobuf: %s", evt.Data)
+			}
+			str, err := p.String(&testEvent{data: evt.Data})
+			if err != nil {
+				t.Fatal(err)
+			}
+			strs[i] = append(strs[i], str)
+		}
+	}
+	if len(strs[0]) != 2 || len(strs[0]) != len(strs[1]) {
+		t.Fatalf("unexpected number of events: %d and %d", len(strs[0]), len(strs[1]))
+	}
+	for i := range strs[0] {
+		var expected, actual interface{}
+		if err := json.Unmarshal([]byte(strs[0][i]), &expected); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(strs[1][i]), &actual); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("event %d: expected %s, got %s", i, strs[0][i], strs[1][i])
+		}
+	}
+}
+
+// testEvent implements sdk.EventReader
+type testEvent struct {
+	data []byte
+}
+
+func (e *testEvent) EventNum() uint64 {
+	return 1
+}
+
+func (e *testEvent) Timestamp() uint64 {
+	return 0
+}
+
+func (e *testEvent) Reader() io.ReadSeeker {
+	return bytes.NewReader(e.data)
+}
@@ -0,0 +1,349 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/errkind"
+	"github.com/falcosecurity/plugins/shared/go/webhook/queue"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	receiverShutdownTimeoutSecs = 5
+	receiverQueueReportSecs     = 10
+
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+// OpenReceiver opens a source.Instance event stream that receives the logs
+// exported to the given OTLP/gRPC and OTLP/HTTP endpoints. The export
+// requests are acknowledged as soon as they are queued, and the queue is
+// consumed by the event source.
+func (p *Plugin) OpenReceiver(endpoints []*url.URL) (source.Instance, error) {
+	policy, err := queue.ParsePolicy(p.Config.Overflow)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	reqQueue := queue.New(int(p.Config.QueueSize), policy)
+	evtChan := make(chan source.PushEvent)
+
+	// the listeners are opened synchronously, so that a busy port fails
+	// the opening of the event source
+	var servers []func(context.Context)
+	fail := func(err error) (source.Instance, error) {
+		for _, shutdown := range servers {
+			shutdown(ctx)
+		}
+		cancelCtx()
+		return nil, err
+	}
+	for _, u := range endpoints {
+		lis, err := net.Listen("tcp", u.Host)
+		if err != nil {
+			return fail(err)
+		}
+		var shutdown func(context.Context)
+		switch u.Scheme {
+		case "grpc", "grpcs":
+			shutdown, err = p.serveGRPC(ctx, lis, u.Scheme == "grpcs", reqQueue, evtChan)
+		default:
+			shutdown, err = p.serveHTTP(ctx, lis, u.Path, u.Scheme == "https", reqQueue, evtChan)
+		}
+		if err != nil {
+			lis.Close()
+			return fail(err)
+		}
+		servers = append(servers, shutdown)
+	}
+
+	// the receiver is connected as soon as it listens, and its events are
+	// the export requests it receives
+	tracker := p.health.Track()
+	tracker.SetConnected(true)
+
+	go func() {
+		defer close(evtChan)
+		for {
+			select {
+			case b := <-reqQueue.C():
+				var req collogspb.ExportLogsServiceRequest
+				if err := proto.Unmarshal(b, &req); err != nil {
+					log.Printf("[%s] %s\n", PluginName, errkind.Count(errkind.New(errkind.Parse, err), p.metrics))
+					tracker.Error()
+					p.metrics.UpstreamError()
+					continue
+				}
+				tracker.Event()
+				if !p.pushExportRequest(ctx, &req, evtChan) {
+					return
+				}
+			case <-reqQueue.Done():
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// log the queue overflows, if any
+	go reqQueue.Report(ctx, time.Second*receiverQueueReportSecs, func(format string, v ...interface{}) {
+		log.Printf("[%s] "+format+"\n", append([]interface{}{PluginName}, v...)...)
+	})
+
+	return source.NewPushInstance(
+		evtChan,
+		source.WithInstanceContext(ctx),
+		source.WithInstanceClose(func() {
+			// on close, attempt shutting down the servers gracefully
+			timedCtx, cancelTimeoutCtx := context.WithTimeout(ctx, time.Second*receiverShutdownTimeoutSecs)
+			defer cancelTimeoutCtx()
+			for _, shutdown := range servers {
+				shutdown(timedCtx)
+			}
+			reqQueue.Close()
+			cancelCtx()
+			tracker.Close()
+		}),
+		source.WithInstanceTimeout(p.batchTimeout()),
+		source.WithInstanceEventSize(uint32(p.Config.MaxEventSize)),
+	)
+}
+
+// logsService implements the OTLP/gRPC logs service
+type logsService struct {
+	collogspb.UnimplementedLogsServiceServer
+	queue *queue.Queue
+}
+
+func (s *logsService) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	b, err := proto.Marshal(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	// the clients retry the requests failing as unavailable
+	if !s.queue.Push(b) {
+		return nil, status.Error(codes.Unavailable, "too many requests")
+	}
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+// serveGRPC serves the OTLP/gRPC endpoint on the given listener, until the
+// returned shutdown function is called. The error stopping the server is
+// sent to c unless ctx is done.
+func (p *Plugin) serveGRPC(ctx context.Context, lis net.Listener, tls bool, q *queue.Queue, c chan<- source.PushEvent) (func(context.Context), error) {
+	opts := []grpc.ServerOption{grpc.MaxRecvMsgSize(int(p.Config.MaxRequestSize))}
+	if tls {
+		creds, err := credentials.NewServerTLSFromFile(p.Config.SSLCertificate, p.Config.SSLCertificate)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	s := grpc.NewServer(opts...)
+	collogspb.RegisterLogsServiceServer(s, &logsService{queue: q})
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			select {
+			case c <- source.PushEvent{Err: errkind.Count(err, p.metrics)}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return func(ctx context.Context) {
+		done := make(chan struct{})
+		go func() {
+			s.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			s.Stop()
+		}
+	}, nil
+}
+
+// serveHTTP serves the OTLP/HTTP endpoint on the given listener and path,
+// like serveGRPC
+func (p *Plugin) serveHTTP(ctx context.Context, lis net.Listener, path string, tls bool, q *queue.Queue, c chan<- source.PushEvent) (func(context.Context), error) {
+	m := http.NewServeMux()
+	s := &http.Server{Handler: m}
+	m.HandleFunc(path, func(w http.ResponseWriter, req *http.Request) {
+		p.handleExport(w, req, q)
+	})
+	go func() {
+		var err error
+		if tls {
+			// note: like the other plugins, the key and the certificate are
+			// read from the same concatenated PEM file
+			err = s.ServeTLS(lis, p.Config.SSLCertificate, p.Config.SSLCertificate)
+		} else {
+			err = s.Serve(lis)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			select {
+			case c <- source.PushEvent{Err: errkind.Count(err, p.metrics)}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return func(ctx context.Context) { s.Shutdown(ctx) }, nil
+}
+
+// handleExport receives an OTLP/HTTP export request, encoded in protobuf
+// or JSON and optionally compressed with gzip, and answers with a response
+// of the same encoding
+func (p *Plugin) handleExport(w http.ResponseWriter, req *http.Request, q *queue.Queue) {
+	if req.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("%s method not allowed", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if contentType != contentTypeProtobuf && contentType != contentTypeJSON {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, req.Body, int64(p.Config.MaxRequestSize))
+	switch req.Header.Get("Content-Encoding") {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("bad request: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		// the size limit also applies to the decompressed body
+		body = io.LimitReader(gz, int64(p.Config.MaxRequestSize)+1)
+	default:
+		http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+		return
+	}
+	b, err := io.ReadAll(body)
+	if err == nil && len(b) > int(p.Config.MaxRequestSize) {
+		err = fmt.Errorf("request larger than maxRequestSize")
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("bad request: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	// the requests are queued in protobuf, the JSON ones are converted
+	var exportReq collogspb.ExportLogsServiceRequest
+	if contentType == contentTypeJSON {
+		if b, err = hexToBase64IDs(b); err == nil {
+			err = protojson.Unmarshal(b, &exportReq)
+		}
+		if err == nil {
+			b, err = proto.Marshal(&exportReq)
+		}
+	} else {
+		err = proto.Unmarshal(b, &exportReq)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("bad request: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	if !q.Push(b) {
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	var resp []byte
+	if contentType == contentTypeJSON {
+		resp, err = protojson.Marshal(&collogspb.ExportLogsServiceResponse{})
+	} else {
+		resp, err = proto.Marshal(&collogspb.ExportLogsServiceResponse{})
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// hexToBase64IDs converts the trace and span IDs of the LogRecords of an
+// OTLP/JSON request, which are hex encoded unlike the other bytes fields of
+// the protobuf JSON mapping, to base64 so that protojson can decode them
+func hexToBase64IDs(b []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var req map[string]interface{}
+	if err := dec.Decode(&req); err != nil {
+		return nil, err
+	}
+	converted := false
+	for _, rl := range objects(req["resourceLogs"]) {
+		for _, sl := range objects(rl["scopeLogs"]) {
+			for _, r := range objects(sl["logRecords"]) {
+				for _, key := range []string{"traceId", "spanId"} {
+					if id, ok := r[key].(string); ok && id != "" {
+						raw, err := hex.DecodeString(id)
+						if err != nil {
+							return nil, fmt.Errorf("invalid %s: %s", key, err.Error())
+						}
+						r[key] = base64.StdEncoding.EncodeToString(raw)
+						converted = true
+					}
+				}
+			}
+		}
+	}
+	if !converted {
+		return b, nil
+	}
+	return json.Marshal(req)
+}
+
+func objects(v interface{}) []map[string]interface{} {
+	var res []map[string]interface{}
+	arr, _ := v.([]interface{})
+	for _, e := range arr {
+		if obj, ok := e.(map[string]interface{}); ok {
+			res = append(res, obj)
+		}
+	}
+	return res
+}
@@ -0,0 +1,274 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/webhook/queue"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+	testRequest = `{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"timeUnixNano":"1704103200000000000","body":{"stringValue":"a"},"traceId":"` + testTraceID + `","spanId":"` + testSpanID + `"},{"body":{"stringValue":"b"}}]}]}]}`
+)
+
+func newTestPlugin(t *testing.T, config string) *Plugin {
+	p := &Plugin{}
+	if err := p.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// testExportRequest returns the export request of testRequest
+func testExportRequest(t *testing.T) *collogspb.ExportLogsServiceRequest {
+	b, err := hexToBase64IDs([]byte(testRequest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req collogspb.ExportLogsServiceRequest
+	if err := protojson.Unmarshal(b, &req); err != nil {
+		t.Fatal(err)
+	}
+	return &req
+}
+
+// queued returns the export request waiting in the queue
+func queued(t *testing.T, q *queue.Queue) *collogspb.ExportLogsServiceRequest {
+	select {
+	case b := <-q.C():
+		var req collogspb.ExportLogsServiceRequest
+		if err := proto.Unmarshal(b, &req); err != nil {
+			t.Fatal(err)
+		}
+		return &req
+	default:
+		t.Fatal("expected a queued request")
+		return nil
+	}
+}
+
+func gzipped(s string) string {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write([]byte(s))
+	w.Close()
+	return b.String()
+}
+
+func TestHexToBase64IDs(t *testing.T) {
+	req := testExportRequest(t)
+	r := req.GetResourceLogs()[0].GetScopeLogs()[0].GetLogRecords()[0]
+	if hex.EncodeToString(r.GetTraceId()) != testTraceID || hex.EncodeToString(r.GetSpanId()) != testSpanID {
+		t.Errorf("expected the IDs to be decoded from hex, got %x and %x", r.GetTraceId(), r.GetSpanId())
+	}
+
+	// the requests without IDs are left as they are
+	body := `{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"body":{"stringValue":"a"},"traceId":""}]}]}]}`
+	if b, err := hexToBase64IDs([]byte(body)); err != nil || string(b) != body {
+		t.Errorf("expected the request unchanged, got %s (%v)", b, err)
+	}
+
+	for _, body := range []string{
+		`{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"traceId":"not hex"}]}]}]}`,
+		`{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"spanId":"0"}]}]}]}`,
+		`not json`,
+	} {
+		if _, err := hexToBase64IDs([]byte(body)); err == nil {
+			t.Errorf("expected an error converting %s", body)
+		}
+	}
+}
+
+func TestHandleExport(t *testing.T) {
+	p := newTestPlugin(t, `{"maxRequestSize":1024}`)
+	pb, err := proto.Marshal(testExportRequest(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		header   []string
+		expected int
+	}{
+		{"protobuf", "POST", string(pb), []string{"Content-Type", contentTypeProtobuf}, http.StatusOK},
+		{"json", "POST", testRequest, []string{"Content-Type", contentTypeJSON + "; charset=utf-8"}, http.StatusOK},
+		{"gzip", "POST", gzipped(testRequest), []string{"Content-Type", contentTypeJSON, "Content-Encoding", "gzip"}, http.StatusOK},
+		{"method", "GET", "", nil, http.StatusMethodNotAllowed},
+		{"content type", "POST", testRequest, []string{"Content-Type", "text/plain"}, http.StatusUnsupportedMediaType},
+		{"content encoding", "POST", testRequest, []string{"Content-Type", contentTypeJSON, "Content-Encoding", "br"}, http.StatusUnsupportedMediaType},
+		{"invalid gzip", "POST", testRequest, []string{"Content-Type", contentTypeJSON, "Content-Encoding", "gzip"}, http.StatusBadRequest},
+		{"invalid json", "POST", `{"resourceLogs":1}`, []string{"Content-Type", contentTypeJSON}, http.StatusBadRequest},
+		{"invalid protobuf", "POST", "\xff", []string{"Content-Type", contentTypeProtobuf}, http.StatusBadRequest},
+		{"invalid id", "POST", strings.Replace(testRequest, testSpanID, "x", 1), []string{"Content-Type", contentTypeJSON}, http.StatusBadRequest},
+		{"too large", "POST", strings.Repeat(" ", 1025) + testRequest, []string{"Content-Type", contentTypeJSON}, http.StatusBadRequest},
+		// the size limit applies to the decompressed body
+		{"too large decompressed", "POST", gzipped(strings.Repeat(" ", 1025) + testRequest), []string{"Content-Type", contentTypeJSON, "Content-Encoding", "gzip"}, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		q := queue.New(1, queue.PolicyReject)
+		req := httptest.NewRequest(test.method, "/v1/logs", strings.NewReader(test.body))
+		for i := 0; i+1 < len(test.header); i += 2 {
+			req.Header.Set(test.header[i], test.header[i+1])
+		}
+		w := httptest.NewRecorder()
+		p.handleExport(w, req, q)
+		if w.Code != test.expected {
+			t.Errorf("%s: expected the status %d, got %d: %s", test.name, test.expected, w.Code, w.Body.String())
+			continue
+		}
+		if test.expected != http.StatusOK {
+			if q.Stats().Depth != 0 {
+				t.Errorf("%s: expected no request to be queued", test.name)
+			}
+			continue
+		}
+
+		// the requests are queued in protobuf and answered in their
+		// own encoding
+		if !proto.Equal(queued(t, q), testExportRequest(t)) {
+			t.Errorf("%s: unexpected queued request", test.name)
+		}
+		ct := w.Header().Get("Content-Type")
+		if strings.HasPrefix(test.header[1], contentTypeJSON) && (ct != contentTypeJSON || w.Body.String() != "{}") {
+			t.Errorf("%s: expected an empty json response, got %s %q", test.name, ct, w.Body.String())
+		}
+		if test.header[1] == contentTypeProtobuf && (ct != contentTypeProtobuf || w.Body.Len() != 0) {
+			t.Errorf("%s: expected an empty protobuf response, got %s %q", test.name, ct, w.Body.String())
+		}
+	}
+}
+
+func TestHandleExportOverflow(t *testing.T) {
+	p := newTestPlugin(t, "{}")
+	q := queue.New(1, queue.PolicyReject)
+	for _, expected := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("POST", "/v1/logs", strings.NewReader(testRequest))
+		req.Header.Set("Content-Type", contentTypeJSON)
+		w := httptest.NewRecorder()
+		p.handleExport(w, req, q)
+		if w.Code != expected {
+			t.Errorf("expected the status %d, got %d", expected, w.Code)
+		}
+	}
+	if s := q.Stats(); s.Depth != 1 || s.Rejected != 1 {
+		t.Errorf("expected a rejected request, got %+v", s)
+	}
+}
+
+func TestServeGRPC(t *testing.T) {
+	p := newTestPlugin(t, "{}")
+	lis := bufconn.Listen(1024 * 1024)
+	q := queue.New(1, queue.PolicyReject)
+	c := make(chan source.PushEvent, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	shutdown, err := p.serveGRPC(ctx, lis, false, q, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(ctx)
+
+	conn, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := collogspb.NewLogsServiceClient(conn)
+	if _, err := client.Export(ctx, testExportRequest(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the full queue is answered with a retryable error
+	_, err = client.Export(ctx, testExportRequest(t))
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("expected the request to be unavailable, got %v", err)
+	}
+	if !proto.Equal(queued(t, q), testExportRequest(t)) {
+		t.Error("unexpected queued request")
+	}
+}
+
+func TestOpenReceiverClose(t *testing.T) {
+	// the address of a free port, the receiver listening by itself
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	before := runtime.NumGoroutine()
+	p := newTestPlugin(t, "{}")
+	u := &url.URL{Scheme: "http", Host: addr, Path: defaultHTTPPath}
+	inst, err := p.OpenReceiver([]*url.URL{u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Post(u.String(), contentTypeJSON, strings.NewReader(testRequest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the request to be accepted, got %d", resp.StatusCode)
+	}
+
+	// closing the receiver without consuming its events leaves no
+	// goroutine blocked on sending them
+	time.Sleep(10 * time.Millisecond)
+	inst.(sdk.Closer).Close()
+	n := runtime.NumGoroutine()
+	for deadline := time.Now().Add(5 * time.Second); n > before && time.Now().Before(deadline); n = runtime.NumGoroutine() {
+		time.Sleep(time.Millisecond)
+	}
+	if n > before {
+		buf := make([]byte, 1<<16)
+		t.Errorf("expected %d goroutines at most, got %d:\n%s", before, n, buf[:runtime.Stack(buf, true)])
+	}
+}
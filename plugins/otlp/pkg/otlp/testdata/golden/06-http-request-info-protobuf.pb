@@ -0,0 +1,19 @@
+'
+/time2024-01-01T10:00:00.123456789Z)
+/observedTime2024-01-01T10:00:00.125Z
+/severityNumber 	
+/severityTextINFO
+/bodyrequest completed'
+/attributes/http.request.methodPOST%
+/attributes/http.route/api/orders*
+%/attributes/http.response.status_code 
+/attributes/user.idu-1042,
+/traceId 4bf92f3577b34da6a3ce929d0e0e4736
+/spanId00f067aa0ba902b7-
+!/resource/attributes/service.namecheckout-
+$/resource/attributes/service.version1.4.2/
+'/resource/attributes/k8s.namespace.nameshop=
+!/resource/attributes/k8s.pod.namecheckout-7d9f8b6c5-x2x4q1
++/resource/attributes/telemetry.sdk.languagego;
+/scope/name,go.opentelemetry.io/contrib/bridges/otelslog
+/scope/version0.2.0
\ No newline at end of file
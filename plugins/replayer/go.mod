@@ -0,0 +1,18 @@
+module github.com/falcosecurity/plugins/plugins/replayer
+
+go 1.22
+
+require (
+	github.com/alecthomas/jsonschema v0.0.0-20220216202328-9eeeec9d044b
+	github.com/falcosecurity/plugin-sdk-go v0.7.4
+	github.com/falcosecurity/plugins/shared/go/conformance v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/replay v0.0.0-00010101000000-000000000000
+)
+
+require gopkg.in/yaml.v2 v2.4.0 // indirect
+
+require github.com/iancoleman/orderedmap v0.0.0-20190318233801-ac98e3ecb4b0 // indirect
+
+replace github.com/falcosecurity/plugins/shared/go/replay => ../../shared/go/replay
+
+replace github.com/falcosecurity/plugins/shared/go/conformance => ../../shared/go/conformance
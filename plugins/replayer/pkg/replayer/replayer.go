@@ -0,0 +1,270 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package replayer implements a source plugin emitting again the events of
+// the bundles recorded from the other source plugins with the record tool,
+// with their original timing or a compressed one, to reproduce the
+// detections depending on a given sequence of events.
+package replayer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alecthomas/jsonschema"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/replay"
+)
+
+const (
+	PluginID          uint32 = 22
+	PluginName               = "replayer"
+	PluginDescription        = "Replay the events recorded from the source plugins"
+	PluginContact            = "github.com/falcosecurity/plugins"
+	PluginVersion            = "0.1.0"
+	PluginEventSource        = "replayer"
+)
+
+// The event source and the ID of the plugin are read by the frameworks
+// when the plugin is loaded, before its init config, so they are set with
+// environment variables to replay the events in place of another plugin
+const (
+	EnvEventSource = "FALCO_REPLAYER_EVENT_SOURCE"
+	EnvPluginID    = "FALCO_REPLAYER_PLUGIN_ID"
+)
+
+const (
+	timestampsOriginal = "original"
+	timestampsReplay   = "replay"
+)
+
+// maxWait is the longest the instances wait for their next event before
+// returning the events of the batch
+const maxWait = 30 * time.Millisecond
+
+type PluginConfig struct {
+	Speed      float64 `json:"speed" jsonschema:"title=Speed,description=Factor by which the original timing of the events is accelerated or 0 to replay them as fast as possible (Default: 1),default=1"`
+	MaxGapMs   uint64  `json:"maxGapMs" jsonschema:"title=Max gap,description=Longest wait in milliseconds between two events whatever their original gap or 0 for no limit (Default: 0),default=0"`
+	Timestamps string  `json:"timestamps" jsonschema:"title=Timestamps,description=Timestamps of the events replayed: original or replay for the time at which they are replayed (Default: original),enum=original,enum=replay,default=original"`
+}
+
+type Plugin struct {
+	plugins.BasePlugin
+	// Contains the init configuration values
+	config PluginConfig
+}
+
+func (p *PluginConfig) setDefault() {
+	p.Speed = 1
+	p.MaxGapMs = 0
+	p.Timestamps = timestampsOriginal
+}
+
+// eventSource returns the event source of the plugin, set by the
+// environment if any
+func eventSource() string {
+	if s := os.Getenv(EnvEventSource); len(s) > 0 {
+		return s
+	}
+	return PluginEventSource
+}
+
+// pluginID returns the ID of the plugin, set by the environment if any
+func pluginID() uint32 {
+	if s := os.Getenv(EnvPluginID); len(s) > 0 {
+		id, err := strconv.ParseUint(s, 10, 32)
+		if err == nil && id > 0 {
+			return uint32(id)
+		}
+		log.Printf("[%s] invalid %s %q, using the ID %d\n", PluginName, EnvPluginID, s, PluginID)
+	}
+	return PluginID
+}
+
+func (p *Plugin) Info() *plugins.Info {
+	return &plugins.Info{
+		ID:          pluginID(),
+		Name:        PluginName,
+		Description: PluginDescription,
+		Contact:     PluginContact,
+		Version:     PluginVersion,
+		EventSource: eventSource(),
+	}
+}
+
+func (p *Plugin) InitSchema() *sdk.SchemaInfo {
+	reflector := jsonschema.Reflector{
+		RequiredFromJSONSchemaTags: true,  // all properties are optional by default
+		AllowAdditionalProperties:  false, // unrecognized properties are rejected
+	}
+	if schema, err := reflector.Reflect(&PluginConfig{}).MarshalJSON(); err == nil {
+		return &sdk.SchemaInfo{
+			Schema: string(schema),
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) Init(cfg string) error {
+	p.config.setDefault()
+	if len(cfg) != 0 {
+		dec := json.NewDecoder(strings.NewReader(cfg))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&p.config); err != nil {
+			return fmt.Errorf("invalid init config: %s", err.Error())
+		}
+	}
+	if p.config.Speed < 0 {
+		return fmt.Errorf("speed must be positive: %v", p.config.Speed)
+	}
+	switch p.config.Timestamps {
+	case timestampsOriginal, timestampsReplay:
+	default:
+		return fmt.Errorf("unknown timestamps: %s", p.config.Timestamps)
+	}
+	return nil
+}
+
+// Open replays the bundle whose path is given in the open params. The
+// bundles recorded from another event source than the one of the plugin
+// are rejected, unless it has its default event source.
+func (p *Plugin) Open(params string) (source.Instance, error) {
+	path := strings.TrimSpace(params)
+	if len(path) == 0 {
+		return nil, fmt.Errorf("the path of a bundle must be given in the open params")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := replay.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if src := eventSource(); src != PluginEventSource && r.Header().EventSource != src {
+		r.Close()
+		file.Close()
+		return nil, fmt.Errorf("the bundle recorded from the %s event source can't be replayed as %s", r.Header().EventSource, src)
+	}
+
+	pacer := &pacer{
+		speed:  p.config.Speed,
+		maxGap: time.Duration(p.config.MaxGapMs) * time.Millisecond,
+	}
+	replayTimestamps := p.config.Timestamps == timestampsReplay
+	var pending *replay.Event
+	pull := func(ctx context.Context, evt sdk.EventWriter) error {
+		if pending == nil {
+			e, err := r.Next()
+			if err == io.EOF {
+				return sdk.ErrEOF
+			}
+			if err != nil {
+				return err
+			}
+			pending = &e
+			pacer.schedule(e.Timestamp, time.Now())
+		}
+
+		// the partial batch is flushed while waiting for a distant event
+		if wait := time.Until(pacer.due); wait > 0 {
+			timeout := wait > maxWait
+			if timeout {
+				wait = maxWait
+			}
+			t := time.NewTimer(wait)
+			defer t.Stop()
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				return sdk.ErrEOF
+			}
+			if timeout {
+				return sdk.ErrTimeout
+			}
+		}
+
+		if _, err := evt.Writer().Write(pending.Data); err != nil {
+			return err
+		}
+		ts := pending.Timestamp
+		if replayTimestamps {
+			ts = time.Now()
+		}
+		evt.SetTimestamp(uint64(ts.UnixNano()))
+		pending = nil
+		return nil
+	}
+	return source.NewPullInstance(pull, source.WithInstanceClose(func() {
+		r.Close()
+		file.Close()
+	}))
+}
+
+func (p *Plugin) String(evt sdk.EventReader) (string, error) {
+	data, err := io.ReadAll(evt.Reader())
+	if err != nil {
+		return "", err
+	}
+	if utf8.Valid(data) {
+		return string(data), nil
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// pacer computes when the events are due, reproducing the gaps between
+// their original timestamps divided by the speed, and bounded by maxGap
+type pacer struct {
+	speed  float64
+	maxGap time.Duration
+	// the original timestamp of the previous event, zero for none
+	prev time.Time
+	// the time at which the current event is due
+	due time.Time
+}
+
+// schedule computes when an event is due. The first event is due now, and
+// the next ones are due relatively to the previous one, so that they catch
+// up when the events are consumed more slowly than they are replayed.
+func (p *pacer) schedule(ts time.Time, now time.Time) {
+	if p.prev.IsZero() || p.speed == 0 {
+		p.due = now
+	} else {
+		gap := ts.Sub(p.prev)
+		if gap < 0 {
+			gap = 0
+		}
+		gap = time.Duration(float64(gap) / p.speed)
+		if p.maxGap > 0 && gap > p.maxGap {
+			gap = p.maxGap
+		}
+		p.due = p.due.Add(gap)
+	}
+	p.prev = ts
+}
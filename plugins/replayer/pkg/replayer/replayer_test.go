@@ -0,0 +1,205 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replayer
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugins/shared/go/replay"
+)
+
+var recordedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// writeBundle writes a bundle of the given payloads, one second apart
+func writeBundle(t *testing.T, source string, payloads ...string) string {
+	path := filepath.Join(t.TempDir(), "events"+replay.Ext)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := replay.NewWriter(f, replay.Header{EventSource: source, RecordedAt: recordedAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range payloads {
+		e := replay.Event{Timestamp: recordedAt.Add(time.Duration(i) * time.Second), Data: []byte(p)}
+		if err := w.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// replayAll returns the events replayed from a bundle
+func replayAll(t *testing.T, p *Plugin, path string) []*eventWriter {
+	inst, err := p.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.(sdk.Closer).Close()
+
+	var res []*eventWriter
+	for {
+		batch := newEventWriters(4)
+		n, err := inst.NextBatch(p, batch)
+		res = append(res, batch.evts[:n]...)
+		switch err {
+		case nil, sdk.ErrTimeout:
+		case sdk.ErrEOF:
+			return res
+		default:
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	path := writeBundle(t, "k8s_audit", `{"n":1}`, `{"n":2}`, "\xff\x00", `{"n":4}`, `{"n":5}`)
+	p := &Plugin{}
+	if err := p.Init(`{"speed": 0}`); err != nil {
+		t.Fatal(err)
+	}
+	evts := replayAll(t, p, path)
+	if len(evts) != 5 {
+		t.Fatalf("expected 5 events, got %d", len(evts))
+	}
+	for i, e := range evts {
+		if ts := recordedAt.Add(time.Duration(i) * time.Second); e.ts != uint64(ts.UnixNano()) {
+			t.Errorf("expected the original timestamp of event %d", i)
+		}
+	}
+	if s := evts[1].data.String(); s != `{"n":2}` {
+		t.Errorf("unexpected payload %s", s)
+	}
+	if s := evts[2].data.String(); s != "\xff\x00" {
+		t.Errorf("unexpected binary payload %q", s)
+	}
+}
+
+func TestReplayTiming(t *testing.T) {
+	path := writeBundle(t, "k8s_audit", `{"n":1}`, `{"n":2}`, `{"n":3}`)
+
+	// the gaps of a second are divided by the speed
+	p := &Plugin{}
+	if err := p.Init(`{"speed": 20, "timestamps": "replay"}`); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	evts := replayAll(t, p, path)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected a replay of about 100ms, took %s", elapsed)
+	}
+	if len(evts) != 3 || evts[0].ts < uint64(start.UnixNano()) {
+		t.Errorf("expected 3 events with the replay timestamps")
+	}
+
+	// and bounded by the max gap
+	if err := p.Init(`{"maxGapMs": 10}`); err != nil {
+		t.Fatal(err)
+	}
+	start = time.Now()
+	replayAll(t, p, path)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the gaps to be bounded, took %s", elapsed)
+	}
+}
+
+func TestEventSource(t *testing.T) {
+	path := writeBundle(t, "k8s_audit", `{"n":1}`)
+	p := &Plugin{}
+	if err := p.Init(""); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(EnvEventSource, "okta")
+	t.Setenv(EnvPluginID, "7")
+	if info := p.Info(); info.EventSource != "okta" || info.ID != 7 {
+		t.Errorf("expected the event source and ID of the environment, got %s and %d", info.EventSource, info.ID)
+	}
+	if _, err := p.Open(path); err == nil {
+		t.Errorf("expected an error replaying k8s_audit events as okta")
+	}
+
+	t.Setenv(EnvEventSource, "k8s_audit")
+	if evts := replayAll(t, p, path); len(evts) != 1 {
+		t.Errorf("expected 1 event, got %d", len(evts))
+	}
+}
+
+func TestInit(t *testing.T) {
+	p := &Plugin{}
+	for _, cfg := range []string{`{"speed": -1}`, `{"timestamps": "now"}`, `{"unknown": true}`} {
+		if err := p.Init(cfg); err == nil {
+			t.Errorf("expected an error for %s", cfg)
+		}
+	}
+}
+
+// eventWriters implements sdk.EventWriters in Go memory
+type eventWriters struct {
+	evts []*eventWriter
+}
+
+func newEventWriters(size int) *eventWriters {
+	res := &eventWriters{}
+	for i := 0; i < size; i++ {
+		res.evts = append(res.evts, &eventWriter{})
+	}
+	return res
+}
+
+func (w *eventWriters) Get(eventIndex int) sdk.EventWriter {
+	return w.evts[eventIndex]
+}
+
+func (w *eventWriters) Len() int {
+	return len(w.evts)
+}
+
+func (w *eventWriters) ArrayPtr() unsafe.Pointer {
+	return nil
+}
+
+func (w *eventWriters) Free() {
+	// do nothing
+}
+
+type eventWriter struct {
+	data bytes.Buffer
+	ts   uint64
+}
+
+func (w *eventWriter) Writer() io.Writer {
+	w.data.Reset()
+	return &w.data
+}
+
+func (w *eventWriter) SetTimestamp(value uint64) {
+	w.ts = value
+}
@@ -0,0 +1,5 @@
+module github.com/falcosecurity/plugins/registry
+
+go 1.16
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+// Plugins are the plugins of the registry, in the order of registry.yaml
+var Plugins = []Plugin{
+	{
+		Name:     "plugin-id-zero-value",
+		ID:       0,
+		Reserved: true,
+	},
+	{
+		Name:               "k8saudit",
+		ID:                 1,
+		EventSource:        "k8s_audit",
+		FieldPrefixes:      []string{"ka.", "ce."},
+		RequiredAPIVersion: GoSDKAPIVersion,
+	},
+	{
+		Name:               "cloudtrail",
+		ID:                 2,
+		EventSource:        "aws_cloudtrail",
+		FieldPrefixes:      []string{"ct.", "s3.", "ec2.", "ecr."},
+		RequiredAPIVersion: GoSDKAPIVersion,
+	},
+	{
+		Name:               "json",
+		FieldPrefixes:      []string{"json.", "jevt."},
+		RequiredAPIVersion: GoSDKAPIVersion,
+	},
+	{
+		Name:               "dummy",
+		ID:                 3,
+		EventSource:        "dummy",
+		FieldPrefixes:      []string{"dummy."},
+		RequiredAPIVersion: GoSDKAPIVersion,
+	},
+	{
+		Name:          "dummy_c",
+		ID:            4,
+		EventSource:   "dummy_c",
+		FieldPrefixes: []string{"dummy."},
+	},
+	{
+		Name:        "docker",
+		ID:          5,
+		EventSource: "docker",
+		External:    true,
+	},
+	{
+		Name:        "seccompagent",
+		ID:          6,
+		EventSource: "seccompagent",
+		External:    true,
+	},
+	{
+		Name:               "okta",
+		ID:                 7,
+		EventSource:        "okta",
+		FieldPrefixes:      []string{"okta.", "ce."},
+		RequiredAPIVersion: GoSDKAPIVersion,
+	},
+	{
+		Name:               "github",
+		ID:                 8,
+		EventSource:        "github",
+		FieldPrefixes:      []string{"github.", "ce."},
+		RequiredAPIVersion: GoSDKAPIVersion,
+	},
+	{
+		Name:               "k8saudit-eks",
+		ID:                 9,
+		EventSource:        "k8s_audit",
+		FieldPrefixes:      []string{"ka.", "ce."},
+		VariantOf:          "k8saudit",
+		RequiredAPIVersion: GoSDKAPIVersion,
+	},
+	{
+		Name:        "nomad",
+		ID:          10,
+		EventSource: "nomad",
+		External:    true,
+	},
+	{
+		Name:        "dnscollector",
+		ID:          11,
+		EventSource: "dnscollector",
+		External:    true,
+	},
+	{
+		Name:               "gcpaudit",
+		ID:                 12,
+		EventSource:        "gcp_auditlog",
+		FieldPrefixes:      []string{"gcp."},
+		RequiredAPIVersion: GoSDKAPIVersion,
+	},
+	{
+		Name:        "syslogsrv",
+		ID:          13,
+		EventSource: "syslogsrv",
+		External:    true,
+	},
+	{
+		Name:        "salesforce",
+		ID:          14,
+		EventSource: "salesforce",
+		External:    true,
+	},
+	{
+		Name:        "box",
+		ID:          15,
+		EventSource: "box",
+		External:    true,
+	},
+	{
+		Name:        "test",
+		ID:          999,
+		EventSource: "test",
+		Reserved:    true,
+	},
+	{
+		Name:               "k8smeta",
+		ExtractSources:     []string{"syscall"},
+		FieldPrefixes:      []string{"k8smeta."},
+		RequiredAPIVersion: "3.1.0",
+	},
+	{
+		Name:               "k8saudit-gke",
+		ID:                 16,
+		EventSource:        "k8s_audit",
+		FieldPrefixes:      []string{"ka.", "ce."},
+		VariantOf:          "k8saudit",
+		RequiredAPIVersion: GoSDKAPIVersion,
+	},
+	{
+		Name:        "journald",
+		ID:          17,
+		EventSource: "journal",
+		External:    true,
+	},
+	{
+		Name:               "kafka",
+		ID:                 18,
+		EventSource:        "kafka",
+		RequiredAPIVersion: GoSDKAPIVersion,
+	},
+	{
+		Name:        "gitlab",
+		ID:          19,
+		EventSource: "gitlab",
+		External:    true,
+	},
+	{
+		Name:        "keycloak",
+		ID:          20,
+		EventSource: "keycloak",
+		External:    true,
+	},
+	{
+		Name:               "otlp",
+		ID:                 21,
+		EventSource:        "otlp",
+		FieldPrefixes:      []string{"otel."},
+		RequiredAPIVersion: GoSDKAPIVersion,
+	},
+	{
+		Name:               "replayer",
+		ID:                 22,
+		EventSource:        "replayer",
+		RequiredAPIVersion: GoSDKAPIVersion,
+	},
+}
@@ -0,0 +1,226 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package registry describes the plugins of the repository as data, with
+// their ID, event source, field prefixes and required plugin API version,
+// along with the IDs registered by the plugins hosted in other repositories.
+// It is the programmatic counterpart of registry.yaml, which it's checked
+// against, and it allocates the ID of new plugins while rejecting the
+// collisions of names, IDs and field prefixes.
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// MaxPublicID is the highest ID that can be assigned in the public
+	// registry, see docs/plugin-ids.md
+	MaxPublicID = 1<<30 - 1
+
+	// GoSDKAPIVersion is the plugin API version required by default by the
+	// plugins built with plugin-sdk-go
+	GoSDKAPIVersion = "3.0.0"
+)
+
+// ReservedSources are the event sources that can't be used by plugins,
+// since they are already used in Falco
+var ReservedSources = []string{"syscall", "internal", "plugins"}
+
+// Plugin describes a plugin of the registry
+type Plugin struct {
+	// Name is the unique name of the plugin
+	Name string
+	// ID is the ID of the events of the plugins with event sourcing
+	// capability, and 0 for the other ones
+	ID uint32
+	// EventSource is the source of the events of the plugins with event
+	// sourcing capability
+	EventSource string
+	// ExtractSources are the event sources the fields are extracted from. If
+	// empty, the fields of a plugin with event sourcing capability are
+	// extracted from its own source, and the ones of the other plugins from
+	// all the sources.
+	ExtractSources []string
+	// FieldPrefixes are the prefixes of the names of the fields, e.g. "ka."
+	FieldPrefixes []string
+	// VariantOf is the name of the plugin whose fields are exported as is,
+	// for the plugins reading the same events from another upstream
+	VariantOf string
+	// RequiredAPIVersion is the plugin API version required by the plugin.
+	// If empty, it's the default of the SDK the plugin is built with.
+	RequiredAPIVersion string
+	// External is true for the plugins hosted in other repositories, whose
+	// fields and required API version aren't known
+	External bool
+	// Reserved is true for the IDs reserved for particular purposes, which
+	// are not assigned to any plugin
+	Reserved bool
+}
+
+// extractSources returns the sources the fields of the plugin are extracted
+// from, or nil if they are extracted from all the sources
+func (p *Plugin) extractSources() []string {
+	if len(p.ExtractSources) > 0 {
+		return p.ExtractSources
+	}
+	if p.EventSource != "" {
+		return []string{p.EventSource}
+	}
+	return nil
+}
+
+// Lookup returns the plugin of the registry with the given name
+func Lookup(name string) (Plugin, bool) {
+	for _, p := range Plugins {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Plugin{}, false
+}
+
+// NextID returns the lowest public ID not used by any of the given plugins
+func NextID(plugins []Plugin) (uint32, error) {
+	used := make(map[uint32]bool)
+	for _, p := range plugins {
+		if p.ID != 0 || p.Reserved {
+			used[p.ID] = true
+		}
+	}
+	for id := uint32(1); id <= MaxPublicID; id++ {
+		if !used[id] {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("no public ID available")
+}
+
+// Allocate assigns the next available ID to a new plugin with event
+// sourcing capability, unless it already has one, and returns it after
+// checking that it doesn't collide with the plugins of the registry
+func Allocate(p Plugin) (Plugin, error) {
+	if p.EventSource != "" && p.ID == 0 {
+		id, err := NextID(Plugins)
+		if err != nil {
+			return p, err
+		}
+		p.ID = id
+	}
+	plugins := append(append([]Plugin{}, Plugins...), p)
+	if err := Validate(plugins); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// Validate returns an error if two of the given plugins have the same name
+// or ID, if an ID is outside of the public range, if an event source is
+// reserved, or if two plugins export fields with the same prefix for the
+// same event source, unless one of them is a variant of the other
+func Validate(plugins []Plugin) error {
+	reserved := make(map[string]bool)
+	for _, s := range ReservedSources {
+		reserved[s] = true
+	}
+
+	names := make(map[string]bool)
+	ids := make(map[uint32]string)
+	for _, p := range plugins {
+		if p.Name == "" {
+			return fmt.Errorf("plugin without name")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("plugin name is not unique: '%s'", p.Name)
+		}
+		names[p.Name] = true
+
+		if p.EventSource == "" && !p.Reserved {
+			if p.ID != 0 {
+				return fmt.Errorf("plugin %s has an ID but no event source", p.Name)
+			}
+			continue
+		}
+		if p.ID > MaxPublicID {
+			return fmt.Errorf("source ID of plugin %s outside the allowed range (%d): '%d'", p.Name, MaxPublicID, p.ID)
+		}
+		if other, ok := ids[p.ID]; ok {
+			return fmt.Errorf("source ID of plugin %s is already used by %s: '%d'", p.Name, other, p.ID)
+		}
+		ids[p.ID] = p.Name
+		if reserved[p.EventSource] {
+			return fmt.Errorf("forbidden source name of plugin %s: '%s'", p.Name, p.EventSource)
+		}
+	}
+
+	for i := range plugins {
+		for j := i + 1; j < len(plugins); j++ {
+			if err := checkFields(&plugins[i], &plugins[j]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkFields returns an error if the two plugins export fields with the
+// same prefix for the same event source
+func checkFields(a, b *Plugin) error {
+	if a.VariantOf == b.Name || b.VariantOf == a.Name || (a.VariantOf != "" && a.VariantOf == b.VariantOf) {
+		return nil
+	}
+	source, ok := commonSource(a.extractSources(), b.extractSources())
+	if !ok {
+		return nil
+	}
+	for _, pa := range a.FieldPrefixes {
+		for _, pb := range b.FieldPrefixes {
+			if strings.HasPrefix(pa, pb) || strings.HasPrefix(pb, pa) {
+				return fmt.Errorf("field prefix '%s' of plugin %s collides with '%s' of plugin %s for source '%s'", pa, a.Name, pb, b.Name, source)
+			}
+		}
+	}
+	return nil
+}
+
+// commonSource returns an event source from which fields are extracted by
+// both of the given lists of sources, nil meaning all the sources
+func commonSource(a, b []string) (string, bool) {
+	switch {
+	case a == nil && b == nil:
+		return "*", true
+	case a == nil:
+		return b[0], true
+	case b == nil:
+		return a[0], true
+	}
+	common := make([]string, 0)
+	for _, sa := range a {
+		for _, sb := range b {
+			if sa == sb {
+				common = append(common, sa)
+			}
+		}
+	}
+	if len(common) == 0 {
+		return "", false
+	}
+	sort.Strings(common)
+	return common[0], true
+}
@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestValidate(t *testing.T) {
+	if err := Validate(Plugins); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRegistryFile checks that the plugins are the ones of registry.yaml
+func TestRegistryFile(t *testing.T) {
+	data, err := os.ReadFile("../registry.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		ReservedSources []string `yaml:"reserved_sources"`
+		Plugins         []struct {
+			Name         string `yaml:"name"`
+			Reserved     bool   `yaml:"reserved"`
+			Capabilities struct {
+				Sourcing struct {
+					Supported bool   `yaml:"supported"`
+					ID        uint32 `yaml:"id"`
+					Source    string `yaml:"source"`
+				} `yaml:"sourcing"`
+			} `yaml:"capabilities"`
+		} `yaml:"plugins"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(file.ReservedSources) != len(ReservedSources) {
+		t.Errorf("expected reserved sources %v, got %v", file.ReservedSources, ReservedSources)
+	}
+	if len(file.Plugins) != len(Plugins) {
+		t.Fatalf("expected %d plugins, got %d", len(file.Plugins), len(Plugins))
+	}
+	for i, fp := range file.Plugins {
+		p := Plugins[i]
+		if p.Name != fp.Name || p.Reserved != fp.Reserved {
+			t.Errorf("expected plugin %s (reserved: %v), got %s (reserved: %v)", fp.Name, fp.Reserved, p.Name, p.Reserved)
+			continue
+		}
+		s := fp.Capabilities.Sourcing
+		if s.Supported && (p.ID != s.ID || p.EventSource != s.Source) {
+			t.Errorf("plugin %s: expected ID %d and source '%s', got %d and '%s'", p.Name, s.ID, s.Source, p.ID, p.EventSource)
+		}
+		if !s.Supported && p.EventSource != "" {
+			t.Errorf("plugin %s: unexpected event source '%s'", p.Name, p.EventSource)
+		}
+	}
+}
+
+// TestRepositoryPlugins checks that every plugin of the repository is
+// described, and that the other ones are external
+func TestRepositoryPlugins(t *testing.T) {
+	dirs, err := filepath.Glob("../plugins/*/README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inRepo := make(map[string]bool)
+	for _, d := range dirs {
+		name := filepath.Base(filepath.Dir(d))
+		inRepo[name] = true
+		if p, ok := Lookup(name); !ok || p.External || p.Reserved {
+			t.Errorf("plugin %s of the repository is not described", name)
+		}
+	}
+	for _, p := range Plugins {
+		if !p.Reserved && !p.External && !inRepo[p.Name] {
+			t.Errorf("plugin %s is not in the repository", p.Name)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	p, err := Allocate(Plugin{Name: "new", EventSource: "new", FieldPrefixes: []string{"new."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != 23 {
+		t.Errorf("expected ID 23, got %d", p.ID)
+	}
+
+	// extractor plugins don't get an ID
+	p, err = Allocate(Plugin{Name: "newextractor", FieldPrefixes: []string{"newextractor."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != 0 {
+		t.Errorf("expected ID 0, got %d", p.ID)
+	}
+
+	// IDs freed in the registry are allocated first
+	plugins := []Plugin{{Name: "a", ID: 1, EventSource: "a"}, {Name: "b", ID: 3, EventSource: "b"}}
+	if id, err := NextID(plugins); err != nil || id != 2 {
+		t.Errorf("expected ID 2, got %d (%v)", id, err)
+	}
+}
+
+func TestAllocateCollisions(t *testing.T) {
+	tests := map[string]Plugin{
+		"name":            {Name: "okta", EventSource: "okta2"},
+		"id":              {Name: "new", ID: 7, EventSource: "new"},
+		"reserved id":     {Name: "new", ID: 999, EventSource: "new"},
+		"private id":      {Name: "new", ID: MaxPublicID + 1, EventSource: "new"},
+		"reserved source": {Name: "new", EventSource: "syscall"},
+		"id of extractor": {Name: "new", ID: 30},
+		"field prefix":    {Name: "new", EventSource: "new", ExtractSources: []string{"okta"}, FieldPrefixes: []string{"okta.user."}},
+		"all sources":     {Name: "new", FieldPrefixes: []string{"json."}},
+		"syscall source":  {Name: "new", ExtractSources: []string{"syscall"}, FieldPrefixes: []string{"k8smeta."}},
+	}
+	for name, p := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Allocate(p); err == nil {
+				t.Errorf("expected collision of plugin %+v", p)
+			}
+		})
+	}
+
+	// the prefixes can be shared by the plugins extracting from other sources
+	if _, err := Allocate(Plugin{Name: "new", EventSource: "new", FieldPrefixes: []string{"ce.", "dummy."}}); err != nil {
+		t.Error(err)
+	}
+}
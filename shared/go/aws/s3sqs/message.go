@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package s3sqs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// Object is a S3 object notified in a SQS message
+type Object struct {
+	Bucket string
+	Key    string
+}
+
+// ParseMessage returns the S3 objects notified by the body of a SQS message.
+// The body is either a SNS envelope, when the queue is subscribed to a SNS topic,
+// or directly the notification, when the SNS subscription uses raw message
+// delivery or when S3 notifies the queue directly. The notification is either
+// sent by CloudTrail itself or is a S3 event notification.
+func ParseMessage(body []byte) ([]Object, error) {
+	var envelope struct {
+		Type    *string `json:"Type"`
+		Message string  `json:"Message"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, err
+	}
+
+	msg := body
+	if envelope.Type != nil {
+		// Other SNS messages, like subscription confirmations, don't
+		// notify any new object
+		if *envelope.Type != "Notification" {
+			return nil, nil
+		}
+		msg = []byte(envelope.Message)
+	}
+
+	var notification struct {
+		// CloudTrail notification
+		Bucket string   `json:"s3Bucket"`
+		Keys   []string `json:"s3ObjectKey"`
+		// S3 event notification
+		Records []struct {
+			S3 struct {
+				Bucket struct {
+					Name string `json:"name"`
+				} `json:"bucket"`
+				Object struct {
+					Key string `json:"key"`
+				} `json:"object"`
+			} `json:"s3"`
+		} `json:"Records"`
+		Event string `json:"Event"`
+	}
+	if err := json.Unmarshal(msg, &notification); err != nil {
+		return nil, err
+	}
+
+	var res []Object
+	switch {
+	case notification.Bucket != "":
+		for _, key := range notification.Keys {
+			res = append(res, Object{Bucket: notification.Bucket, Key: key})
+		}
+	case len(notification.Records) > 0:
+		for _, record := range notification.Records {
+			// S3 event keys are URL encoded
+			key, err := url.QueryUnescape(record.S3.Object.Key)
+			if err != nil {
+				key = record.S3.Object.Key
+			}
+			res = append(res, Object{Bucket: record.S3.Bucket.Name, Key: key})
+		}
+	case notification.Event == "s3:TestEvent":
+		// Sent by S3 when the notification is configured
+	default:
+		return nil, fmt.Errorf("received SQS message that was not a CloudTrail or S3 notification")
+	}
+	return res, nil
+}
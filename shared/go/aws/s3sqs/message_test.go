@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package s3sqs
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// snsEnvelope returns a SNS notification of the given message
+func snsEnvelope(typ, msg string) string {
+	b, _ := json.Marshal(map[string]string{
+		"Type":      typ,
+		"MessageId": "1",
+		"TopicArn":  "arn:aws:sns:us-east-1:123456789012:topic",
+		"Message":   msg,
+	})
+	return string(b)
+}
+
+// s3Event returns a S3 event notification of the given bucket and key pairs
+func s3Event(objects ...string) string {
+	type record struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	}
+	var records []record
+	for i := 0; i+1 < len(objects); i += 2 {
+		var r record
+		r.EventName = "ObjectCreated:Put"
+		r.S3.Bucket.Name = objects[i]
+		r.S3.Object.Key = objects[i+1]
+		records = append(records, r)
+	}
+	b, _ := json.Marshal(map[string]interface{}{"Records": records})
+	return string(b)
+}
+
+func TestParseMessage(t *testing.T) {
+	const (
+		cloudTrail = `{"s3Bucket":"trail","s3ObjectKey":["AWSLogs/1.json.gz","AWSLogs/2.json.gz"]}`
+		testEvent  = `{"Service":"Amazon S3","Event":"s3:TestEvent","Time":"2024-01-01T00:00:00.000Z","Bucket":"bucket"}`
+	)
+	cloudTrailObjects := []Object{{"trail", "AWSLogs/1.json.gz"}, {"trail", "AWSLogs/2.json.gz"}}
+	tests := []struct {
+		name     string
+		body     string
+		expected []Object
+		err      bool
+	}{
+		{"s3 event", s3Event("bucket", "a.json"), []Object{{"bucket", "a.json"}}, false},
+		{"s3 event in sns", snsEnvelope("Notification", s3Event("bucket", "a.json")), []Object{{"bucket", "a.json"}}, false},
+		{"cloudtrail", cloudTrail, cloudTrailObjects, false},
+		{"cloudtrail in sns", snsEnvelope("Notification", cloudTrail), cloudTrailObjects, false},
+		// the keys of the S3 events are URL encoded, the spaces as +
+		{"encoded key", s3Event("bucket", "AWSLogs%2F2024%2Fa+b%3D.json"), []Object{{"bucket", "AWSLogs/2024/a b=.json"}}, false},
+		{"invalid encoding", s3Event("bucket", "a%zz.json"), []Object{{"bucket", "a%zz.json"}}, false},
+		// the keys of the CloudTrail notifications are not encoded
+		{"cloudtrail key", `{"s3Bucket":"trail","s3ObjectKey":["a+b.json"]}`, []Object{{"trail", "a+b.json"}}, false},
+		{"multiple records", s3Event("a", "1.json", "b", "2.json", "a", "3.json"), []Object{{"a", "1.json"}, {"b", "2.json"}, {"a", "3.json"}}, false},
+		{"multiple records in sns", snsEnvelope("Notification", s3Event("a", "1.json", "b", "2.json")), []Object{{"a", "1.json"}, {"b", "2.json"}}, false},
+		{"test event", testEvent, nil, false},
+		{"test event in sns", snsEnvelope("Notification", testEvent), nil, false},
+		{"subscription confirmation", snsEnvelope("SubscriptionConfirmation", "You have chosen to subscribe to the topic"), nil, false},
+		{"unsubscribe confirmation", snsEnvelope("UnsubscribeConfirmation", "You have chosen to deactivate subscription"), nil, false},
+		{"cloudtrail without keys", `{"s3Bucket":"trail","s3ObjectKey":[]}`, nil, false},
+		{"invalid json", `{"Records":`, nil, true},
+		{"invalid sns message", snsEnvelope("Notification", "not json"), nil, true},
+		{"unknown notification", `{"foo":"bar"}`, nil, true},
+		{"unknown notification in sns", snsEnvelope("Notification", `{"Records":[]}`), nil, true},
+	}
+	for _, test := range tests {
+		objects, err := ParseMessage([]byte(test.body))
+		if (err != nil) != test.err {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(objects, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, objects)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package s3sqs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Splitter splits the decompressed content of an object into records,
+// calling yield for each of them
+type Splitter func(obj Object, r io.Reader, yield func(record []byte) error) error
+
+// Lines splits the objects into their non-empty lines, e.g. the VPC flow
+// logs, the ALB access logs or the WAF logs. The header lines starting with
+// one of the given prefixes, if any, are skipped.
+func Lines(headerPrefixes ...string) Splitter {
+	return func(obj Object, r io.Reader, yield func(record []byte) error) error {
+		s := bufio.NewScanner(r)
+		s.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lines:
+		for s.Scan() {
+			line := bytes.TrimSpace(s.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			for _, p := range headerPrefixes {
+				if bytes.HasPrefix(line, []byte(p)) {
+					continue lines
+				}
+			}
+			if err := yield(append([]byte(nil), line...)); err != nil {
+				return err
+			}
+		}
+		return s.Err()
+	}
+}
+
+// JSONArray splits the objects made of a JSON object holding an array of
+// records under the given key, e.g. "Records" for the CloudTrail logs
+func JSONArray(key string) Splitter {
+	return func(obj Object, r io.Reader, yield func(record []byte) error) error {
+		var doc map[string]json.RawMessage
+		if err := json.NewDecoder(r).Decode(&doc); err != nil {
+			return fmt.Errorf("invalid JSON object %s/%s: %s", obj.Bucket, obj.Key, err.Error())
+		}
+		var records []json.RawMessage
+		if raw, ok := doc[key]; ok {
+			if err := json.Unmarshal(raw, &records); err != nil {
+				return fmt.Errorf("invalid %s array in %s/%s: %s", key, obj.Bucket, obj.Key, err.Error())
+			}
+		}
+		for _, rec := range records {
+			if err := yield(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
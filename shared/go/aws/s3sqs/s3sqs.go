@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package s3sqs ingests the objects notified to a SQS queue when they are
+// created in a S3 bucket, which is how AWS delivers most of its logs, e.g.
+// CloudTrail, VPC flow logs, ALB access logs or WAF logs. The queue is long
+// polled, the notified objects are downloaded and decompressed, and their
+// records are sent to the plugin owning the Consumer.
+package s3sqs
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/falcosecurity/plugins/shared/go/compress"
+)
+
+const (
+	DefaultWaitTime    time.Duration = 20 * time.Second // long polling duration of the SQS queue
+	DefaultMaxMessages int32         = 10               // maximum number of messages received at once
+	DefaultBufferSize  uint64        = 200              // buffer size of the channel that transmits the records to the plugin
+)
+
+// SQSAPI is the part of the SQS client used by a Consumer
+type SQSAPI interface {
+	GetQueueUrl(ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error)
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+// S3API is the part of the S3 client used by a Consumer
+type S3API interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// Options represents the options of a Consumer
+type Options struct {
+	// WaitTime is the long polling duration of the queue
+	WaitTime time.Duration
+	// MaxMessages is the maximum number of messages received at once
+	MaxMessages int32
+	// BufferSize is the size of the channel of the records
+	BufferSize uint64
+	// Delete deletes the messages from the queue once the records of all
+	// their objects are sent, so that they are received again otherwise
+	Delete bool
+	// Filter returns true for the notified objects to download, nil for all
+	Filter func(obj Object) bool
+}
+
+func (options *Options) setDefault() {
+	if options.WaitTime == 0 {
+		options.WaitTime = DefaultWaitTime
+	}
+	if options.MaxMessages == 0 {
+		options.MaxMessages = DefaultMaxMessages
+	}
+	if options.BufferSize == 0 {
+		options.BufferSize = DefaultBufferSize
+	}
+}
+
+// Record is a record of a S3 object
+type Record struct {
+	Object Object
+	Data   []byte
+}
+
+// Consumer receives the records of the objects notified to a SQS queue
+type Consumer struct {
+	sqs     SQSAPI
+	s3      S3API
+	options Options
+}
+
+// NewConsumer returns a Consumer using the given clients, e.g. created from
+// the same aws.Config, with the given options or the default ones if nil
+func NewConsumer(sqsClient SQSAPI, s3Client S3API, options *Options) *Consumer {
+	c := &Consumer{sqs: sqsClient, s3: s3Client}
+	if options != nil {
+		c.options = *options
+	}
+	c.options.setDefault()
+	return c
+}
+
+// NewConsumerFromConfig returns a Consumer using the SQS and S3 clients
+// created from the given aws.Config
+func NewConsumerFromConfig(cfg aws.Config, options *Options) *Consumer {
+	return NewConsumer(sqs.NewFromConfig(cfg), s3.NewFromConfig(cfg), options)
+}
+
+// QueueURL returns the URL of a queue given its name or its URL
+func (c *Consumer) QueueURL(ctx context.Context, queue string) (string, error) {
+	if strings.HasPrefix(queue, "https://") || strings.HasPrefix(queue, "http://") {
+		return queue, nil
+	}
+	res, err := c.sqs.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(queue)})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(res.QueueUrl), nil
+}
+
+// Open long polls the queue with the given URL until the context is done,
+// and sends the records of the notified objects, split with split, on the
+// returned channel. The first error stops the polling and is sent on the
+// error channel. Both channels are closed once the polling stops.
+func (c *Consumer) Open(ctx context.Context, queueURL string, split Splitter) (chan *Record, chan error) {
+	recordC := make(chan *Record, c.options.BufferSize)
+	errC := make(chan error, 1)
+
+	go func() {
+		defer close(recordC)
+		defer close(errC)
+		for ctx.Err() == nil {
+			if err := c.poll(ctx, queueURL, split, recordC); err != nil {
+				if ctx.Err() == nil {
+					errC <- err
+				}
+				return
+			}
+		}
+	}()
+	return recordC, errC
+}
+
+// poll receives a batch of messages and sends the records of their objects
+func (c *Consumer) poll(ctx context.Context, queueURL string, split Splitter, recordC chan<- *Record) error {
+	res, err := c.sqs.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(queueURL),
+		MaxNumberOfMessages: c.options.MaxMessages,
+		WaitTimeSeconds:     int32(c.options.WaitTime / time.Second),
+	})
+	if err != nil {
+		return err
+	}
+	for _, msg := range res.Messages {
+		objects, err := ParseMessage([]byte(aws.ToString(msg.Body)))
+		if err != nil {
+			return err
+		}
+		for _, obj := range objects {
+			if c.options.Filter != nil && !c.options.Filter(obj) {
+				continue
+			}
+			if err := c.download(ctx, obj, split, recordC); err != nil {
+				return err
+			}
+		}
+		if c.options.Delete {
+			_, err := c.sqs.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(queueURL),
+				ReceiptHandle: msg.ReceiptHandle,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// download sends the records of an object
+func (c *Consumer) download(ctx context.Context, obj Object, split Splitter, recordC chan<- *Record) error {
+	res, err := c.s3.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(obj.Bucket),
+		Key:    aws.String(obj.Key),
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// the objects are decompressed regardless of their key, e.g. the
+	// gzipped ALB logs or the zstd Logpush ones
+	r, err := compress.NewReader(res.Body, nil)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return split(obj, r, func(record []byte) error {
+		select {
+		case recordC <- &Record{Object: obj, Data: record}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
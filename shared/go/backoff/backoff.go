@@ -0,0 +1,205 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package backoff retries the failing calls of the plugins to their
+// upstream with an exponential backoff, randomized with a jitter so that
+// several instances don't retry in lockstep, and bounded in attempts and in
+// elapsed time. A Breaker stops the calls for a cooldown period after
+// repeated failures, so that a plugin whose upstream is down stays alive
+// and reports itself as degraded instead of hot-looping on its errors.
+package backoff
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Config is the configuration block of the retries of a plugin
+type Config struct {
+	InitialInterval uint64  `json:"initialInterval" jsonschema:"title=Initial interval,description=Delay in milliseconds before the first retry (default: 1000)"`
+	MaxInterval     uint64  `json:"maxInterval" jsonschema:"title=Max interval,description=Maximum delay in milliseconds between two retries (default: 60000)"`
+	Multiplier      float64 `json:"multiplier" jsonschema:"title=Multiplier,description=Factor applied to the delay at each retry (default: 2)"`
+	Jitter          float64 `json:"jitter" jsonschema:"title=Jitter,description=Fraction of the delay randomly added or removed at each retry between 0 and 1 (default: 0.2)"`
+	MaxElapsedTime  uint64  `json:"maxElapsedTime" jsonschema:"title=Max elapsed time,description=Time in seconds after which a failing call is not retried anymore or 0 to retry it forever (default: 0)"`
+	MaxRetries      uint64  `json:"maxRetries" jsonschema:"title=Max retries,description=Number of retries of a failing call or 0 to retry it forever (default: 0)"`
+}
+
+// Reset sets the configuration to its default values
+func (c *Config) Reset() {
+	*c = Config{
+		InitialInterval: 1000,
+		MaxInterval:     60000,
+		Multiplier:      2,
+		Jitter:          0.2,
+	}
+}
+
+// Backoff computes the delays between the retries of a call. It isn't safe
+// for concurrent use.
+type Backoff struct {
+	cfg     Config
+	start   time.Time
+	retries uint64
+	delay   float64
+	rand    *rand.Rand
+}
+
+// New returns a Backoff with the given configuration, whose zero values
+// are replaced by the defaults, except for the unbounded MaxElapsedTime
+// and MaxRetries
+func New(c Config) *Backoff {
+	var def Config
+	def.Reset()
+	if c.InitialInterval == 0 {
+		c.InitialInterval = def.InitialInterval
+	}
+	if c.MaxInterval < c.InitialInterval {
+		c.MaxInterval = def.MaxInterval
+		if c.MaxInterval < c.InitialInterval {
+			c.MaxInterval = c.InitialInterval
+		}
+	}
+	if c.Multiplier < 1 {
+		c.Multiplier = def.Multiplier
+	}
+	c.Jitter = math.Min(math.Max(c.Jitter, 0), 1)
+	b := &Backoff{cfg: c, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	b.Reset()
+	return b
+}
+
+// Reset restarts the backoff, once a call succeeded
+func (b *Backoff) Reset() {
+	b.start = time.Now()
+	b.retries = 0
+	b.delay = float64(time.Duration(b.cfg.InitialInterval) * time.Millisecond)
+}
+
+// Next returns the delay before the next retry, or false if the call
+// shouldn't be retried anymore
+func (b *Backoff) Next() (time.Duration, bool) {
+	if b.cfg.MaxRetries > 0 && b.retries >= b.cfg.MaxRetries {
+		return 0, false
+	}
+	elapsed := time.Since(b.start)
+	if b.cfg.MaxElapsedTime > 0 && elapsed >= time.Duration(b.cfg.MaxElapsedTime)*time.Second {
+		return 0, false
+	}
+	b.retries++
+	res := b.delay * (1 + b.cfg.Jitter*(2*b.rand.Float64()-1))
+	b.delay = math.Min(b.delay*b.cfg.Multiplier, float64(time.Duration(b.cfg.MaxInterval)*time.Millisecond))
+	return time.Duration(res), true
+}
+
+// permanentError is an error that retrying won't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps an error so that Retry returns it without retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Options are the options of Retry
+type Options struct {
+	// Backoff is the configuration of the delays between the retries
+	Backoff Config
+	// Breaker defers the calls while it's open, if not nil. It can be
+	// shared by the retries of several calls to the same upstream.
+	Breaker *Breaker
+	// Retryable returns true if an error is worth retrying, if not nil.
+	// The errors wrapped with Permanent are never retried.
+	Retryable func(err error) bool
+	// OnRetry is called with each error retried and the delay before its
+	// retry, if not nil, e.g. to log it
+	OnRetry func(err error, delay time.Duration)
+}
+
+// Retry calls op until it succeeds, returns an error that isn't retryable,
+// or the retries are exhausted, in which case its last error is returned.
+// The retries stop with the error of the context once it's done.
+func Retry(ctx context.Context, opts Options, op func(ctx context.Context) error) error {
+	b := New(opts.Backoff)
+	for {
+		for opts.Breaker != nil {
+			wait := opts.Breaker.Wait()
+			if wait <= 0 {
+				break
+			}
+			if err := sleep(ctx, wait); err != nil {
+				return err
+			}
+		}
+		err := op(ctx)
+		if err == nil {
+			if opts.Breaker != nil {
+				opts.Breaker.Success()
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if opts.Retryable != nil && !opts.Retryable(err) {
+			return err
+		}
+		if opts.Breaker != nil {
+			opts.Breaker.Failure()
+		}
+		delay, ok := b.Next()
+		if !ok {
+			return err
+		}
+		if opts.OnRetry != nil {
+			opts.OnRetry(err, delay)
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits for the given duration, or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
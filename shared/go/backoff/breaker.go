@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backoff
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the state of a Breaker
+type State int
+
+const (
+	// Closed lets the calls through
+	Closed State = iota
+	// Open defers the calls until the end of its cooldown period
+	Open
+	// HalfOpen lets a single trial call through after the cooldown
+	// period, which closes the Breaker if it succeeds, and opens it again
+	// otherwise
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Breaker is a circuit breaker, which opens after a number of consecutive
+// failures of the calls to an upstream, and defers the next calls for a
+// cooldown period. It is safe for concurrent use.
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     State
+	until     time.Time
+	onChange  func(State)
+}
+
+// NewBreaker returns a Breaker opening after threshold consecutive
+// failures for the cooldown period. The onChange function is called with
+// each new state, if not nil, e.g. to report the plugin as degraded while
+// the Breaker is open. It must not call the Breaker.
+func NewBreaker(threshold int, cooldown time.Duration, onChange func(State)) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Breaker{threshold: threshold, cooldown: cooldown, onChange: onChange}
+}
+
+// State returns the current state of the Breaker
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Wait returns how long to wait before the next call, 0 if it's allowed
+// now. The Breaker is half-open once its cooldown period is over.
+func (b *Breaker) Wait() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != Open {
+		return 0
+	}
+	if wait := time.Until(b.until); wait > 0 {
+		return wait
+	}
+	b.set(HalfOpen)
+	return 0
+}
+
+// Success records a successful call, which closes the Breaker
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.set(Closed)
+}
+
+// Failure records a failed call, which opens the Breaker after threshold
+// consecutive failures, or right away if it's half-open
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.until = time.Now().Add(b.cooldown)
+		b.set(Open)
+	}
+}
+
+// set changes the state of the Breaker, with its lock held
+func (b *Breaker) set(s State) {
+	if b.state == s {
+		return
+	}
+	b.state = s
+	if b.onChange != nil {
+		b.onChange(s)
+	}
+}
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backoff
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestBreaker returns a Breaker recording its state changes
+func newTestBreaker(threshold int, cooldown time.Duration) (*Breaker, func() []State) {
+	var mu sync.Mutex
+	var changes []State
+	b := NewBreaker(threshold, cooldown, func(s State) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, s)
+	})
+	return b, func() []State {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]State(nil), changes...)
+	}
+}
+
+func expectStates(t *testing.T, changes []State, expected ...State) {
+	t.Helper()
+	if len(changes) != len(expected) {
+		t.Fatalf("expected the state changes %v, got %v", expected, changes)
+	}
+	for i := range changes {
+		if changes[i] != expected[i] {
+			t.Fatalf("expected the state changes %v, got %v", expected, changes)
+		}
+	}
+}
+
+func TestBreakerThreshold(t *testing.T) {
+	b, changes := newTestBreaker(3, time.Hour)
+	b.Failure()
+	b.Failure()
+	if b.State() != Closed || b.Wait() != 0 {
+		t.Fatalf("expected the breaker to be closed under the threshold, got %s", b.State())
+	}
+
+	// a success resets the consecutive failures
+	b.Success()
+	b.Failure()
+	b.Failure()
+	if b.State() != Closed {
+		t.Fatalf("expected the breaker to be closed after a success, got %s", b.State())
+	}
+	b.Failure()
+	if b.State() != Open {
+		t.Fatalf("expected the breaker to open at the threshold, got %s", b.State())
+	}
+	if wait := b.Wait(); wait <= 0 || wait > time.Hour {
+		t.Errorf("expected to wait for the cooldown, got %s", wait)
+	}
+	expectStates(t, changes(), Open)
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b, changes := newTestBreaker(2, 10*time.Millisecond)
+	b.Failure()
+	b.Failure()
+	time.Sleep(20 * time.Millisecond)
+
+	// the breaker is half-open once the cooldown has passed, and opens
+	// again on the first failure
+	if wait := b.Wait(); wait != 0 || b.State() != HalfOpen {
+		t.Fatalf("expected the breaker to be half-open after the cooldown, got %s (%s)", b.State(), wait)
+	}
+	b.Failure()
+	if b.State() != Open || b.Wait() <= 0 {
+		t.Fatalf("expected the breaker to open on a half-open failure, got %s", b.State())
+	}
+
+	// or closes on the first success
+	time.Sleep(20 * time.Millisecond)
+	b.Wait()
+	b.Success()
+	if b.State() != Closed || b.Wait() != 0 {
+		t.Fatalf("expected the breaker to close on a half-open success, got %s", b.State())
+	}
+	expectStates(t, changes(), Open, HalfOpen, Open, HalfOpen, Closed)
+}
+
+func TestBreakerDefaults(t *testing.T) {
+	b := NewBreaker(0, time.Hour, nil)
+	b.Failure()
+	if b.State() != Open {
+		t.Errorf("expected a threshold of 1, got the state %s after a failure", b.State())
+	}
+	if s := State(42).String(); s != "unknown" {
+		t.Errorf("expected an unknown state, got %s", s)
+	}
+}
+
+func TestRetryBreaker(t *testing.T) {
+	b, changes := newTestBreaker(2, 10*time.Millisecond)
+	failure := errors.New("failure")
+	calls := 0
+	err := Retry(context.Background(), Options{
+		Backoff: Config{InitialInterval: 1, MaxInterval: 1},
+		Breaker: b,
+	}, func(ctx context.Context) error {
+		calls++
+		if calls < 4 {
+			return failure
+		}
+		return nil
+	})
+	if err != nil || calls != 4 {
+		t.Fatalf("expected a success after 4 calls, got %d calls (%v)", calls, err)
+	}
+	expectStates(t, changes(), Open, HalfOpen, Open, HalfOpen, Closed)
+
+	// the context is checked while the breaker is open
+	b.Failure()
+	b.Failure()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Retry(ctx, Options{Breaker: b}, func(ctx context.Context) error {
+		t.Error("unexpected call with the breaker open")
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("expected the context error, got %v", err)
+	}
+}
+
+func TestBreakerConcurrent(t *testing.T) {
+	b := NewBreaker(5, time.Millisecond, func(State) {})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				b.Wait()
+				if (i+j)%3 == 0 {
+					b.Success()
+				} else {
+					b.Failure()
+				}
+				b.State()
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package batch provides the adaptive sizing of the batches returned by the
+// NextBatch implementations of the pull-based plugins. Instead of always
+// trying to fill all the event writers provided by Falco, a plugin returns
+// as soon as it reaches a target size, which grows while the source has a
+// backlog and shrinks when Falco keeps up with it. At low volume, the events
+// are delivered one by one without waiting for more, which minimizes the
+// latency, while bursts are delivered in large batches, which minimizes
+// the overhead per event. A Buffer applies the sizing to the events received
+// from the goroutine ingesting an async source, and can back the instances
+// of the plugins in place of the push instances of the SDK.
+package batch
+
+// Sizer computes the target size of the next batch from the outcome of the
+// previous ones. The zero value starts with batches of a single event.
+type Sizer struct {
+	size int
+}
+
+// Next returns the target size of the next batch, which is at least 1
+// and at most max, usually the number of event writers
+func (s *Sizer) Next(max int) int {
+	if s.size < 1 {
+		s.size = 1
+	}
+	if s.size > max {
+		s.size = max
+	}
+	return s.size
+}
+
+// Done records the outcome of a batch: the number of events it contained,
+// and the backlog, which is the number of events still waiting upstream.
+// The target size doubles if the backlog is at least as large as the batch,
+// meaning that the source produces faster than Falco consumes, and halves
+// if there is no backlog anymore.
+func (s *Sizer) Done(n, backlog int) {
+	switch {
+	case n >= s.size && backlog >= n:
+		s.size *= 2
+	case backlog == 0 && s.size > 1:
+		s.size /= 2
+	}
+}
@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package batch
+
+import "testing"
+
+func TestSizer(t *testing.T) {
+	var s Sizer
+	if n := s.Next(16); n != 1 {
+		t.Fatalf("expected a first batch of 1 event, got %d", n)
+	}
+
+	// the size doubles while the backlog is at least as large as the batch
+	for _, expected := range []int{2, 4, 8, 16, 16} {
+		s.Done(s.Next(16), 100)
+		if n := s.Next(16); n != expected {
+			t.Fatalf("expected a batch of %d events, got %d", expected, n)
+		}
+	}
+
+	// and is kept with a smaller backlog, or a partial batch
+	s.Done(16, 8)
+	s.Done(4, 100)
+	if n := s.Next(16); n != 16 {
+		t.Fatalf("expected the size to be kept, got %d", n)
+	}
+
+	// it halves once there is no backlog anymore, down to 1
+	for _, expected := range []int{8, 4, 2, 1, 1} {
+		s.Done(1, 0)
+		if n := s.Next(16); n != expected {
+			t.Fatalf("expected a batch of %d events, got %d", expected, n)
+		}
+	}
+}
+
+func TestSizerMax(t *testing.T) {
+	s := Sizer{size: 64}
+	if n := s.Next(10); n != 10 {
+		t.Errorf("expected the size to be clamped to the event writers, got %d", n)
+	}
+	s.Done(10, 100)
+	if n := s.Next(10); n != 10 {
+		t.Errorf("expected the size to stay clamped to the event writers, got %d", n)
+	}
+}
@@ -0,0 +1,239 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package batch
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+)
+
+const (
+	DefaultBufferSize = 1024                  // number of events held by a Buffer
+	DefaultTimeout    = 30 * time.Millisecond // wait for the first event of a batch, like the push instances of the SDK
+	DefaultLinger     = 10 * time.Millisecond // wait for the next events of a batch
+)
+
+// BufferOptions represents the options of a Buffer
+type BufferOptions struct {
+	// Size is the number of events the Buffer holds before the producers
+	// wait for room
+	Size int
+	// Timeout is how long NextBatch waits for a first event before
+	// returning sdk.ErrTimeout
+	Timeout time.Duration
+	// Linger is how long NextBatch waits for the next events of a batch
+	// once it received a first one, until the target size of the batch
+	Linger time.Duration
+	// OnEvent is called with each event written in a batch, e.g. to
+	// record it in the metrics of the plugin
+	OnEvent func(evt *source.PushEvent)
+	// EventSize is the maximum size of the events of the instances
+	// returned by NewInstance, 0 for the default one of the SDK
+	EventSize uint32
+}
+
+func (options *BufferOptions) setDefault() {
+	if options.Size <= 0 {
+		options.Size = DefaultBufferSize
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+	if options.Linger <= 0 {
+		options.Linger = DefaultLinger
+	}
+}
+
+// Buffer is a bounded buffer between the goroutine ingesting the events of
+// an async source and the NextBatch calls of its instance. The producers
+// wait when it is full, which applies backpressure to the upstream, and the
+// batches are sized by a Sizer from the backlog of the Buffer. An event
+// with an error ends the stream once the events before it are returned, and
+// so does the closing of the channel by the producers, with sdk.ErrEOF.
+type Buffer struct {
+	ch      chan source.PushEvent
+	options BufferOptions
+	sizer   Sizer
+	pending *source.PushEvent // an error left over by the previous batch
+	eof     bool
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewBuffer returns a Buffer with the given options, or the default ones
+// if nil
+func NewBuffer(options *BufferOptions) *Buffer {
+	b := &Buffer{done: make(chan struct{})}
+	if options != nil {
+		b.options = *options
+	}
+	b.options.setDefault()
+	b.ch = make(chan source.PushEvent, b.options.Size)
+	return b
+}
+
+// C returns the channel the producers send the events to. It can be used
+// in place of the channel of a source.NewPushInstance, and is closed by the
+// producers once they have no more events. Unlike Push, the sends to it
+// keep waiting once the Buffer is closed.
+func (b *Buffer) C() chan<- source.PushEvent {
+	return b.ch
+}
+
+// Push adds an event, waiting until there is room. It returns false if the
+// Buffer is closed, so that the producers stop.
+func (b *Buffer) Push(evt source.PushEvent) bool {
+	select {
+	case <-b.done:
+		return false
+	case b.ch <- evt:
+		return true
+	}
+}
+
+// Done returns a channel that is closed when the Buffer is closed
+func (b *Buffer) Done() <-chan struct{} {
+	return b.done
+}
+
+// Close makes all the pending and future calls to Push return false. It
+// can be called more than once.
+func (b *Buffer) Close() {
+	b.once.Do(func() { close(b.done) })
+}
+
+// Len returns the number of events waiting in the Buffer
+func (b *Buffer) Len() int {
+	return len(b.ch)
+}
+
+// NextBatch writes the next batch of events in evts. It returns
+// sdk.ErrTimeout if no event was received within the timeout.
+func (b *Buffer) NextBatch(evts sdk.EventWriters) (int, error) {
+	if b.eof {
+		return 0, sdk.ErrEOF
+	}
+	var evt source.PushEvent
+	if b.pending != nil {
+		evt, b.pending = *b.pending, nil
+	} else {
+		timeout := time.NewTimer(b.options.Timeout)
+		defer timeout.Stop()
+		select {
+		case e, ok := <-b.ch:
+			if !ok {
+				b.eof = true
+				return 0, sdk.ErrEOF
+			}
+			evt = e
+		case <-timeout.C:
+			return 0, sdk.ErrTimeout
+		}
+	}
+
+	size := b.sizer.Next(evts.Len())
+	linger := time.NewTimer(b.options.Linger)
+	defer linger.Stop()
+
+	n := 0
+batch:
+	for {
+		if evt.Err != nil {
+			if n > 0 {
+				// the events of the batch are returned first, and
+				// the error alone by the next call
+				b.pending = &evt
+				break
+			}
+			b.eof = true
+			return 0, evt.Err
+		}
+		w := evts.Get(n)
+		l, err := w.Writer().Write(evt.Data)
+		if err == nil && l < len(evt.Data) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			b.eof = true
+			return n, err
+		}
+		if !evt.Timestamp.IsZero() {
+			w.SetTimestamp(uint64(evt.Timestamp.UnixNano()))
+		}
+		if b.options.OnEvent != nil {
+			b.options.OnEvent(&evt)
+		}
+		n++
+
+		if n >= size {
+			break
+		}
+		select {
+		case e, ok := <-b.ch:
+			if !ok {
+				// the EOF is returned by the next call
+				b.eof = true
+				break batch
+			}
+			evt = e
+		case <-linger.C:
+			break batch
+		}
+	}
+
+	b.sizer.Done(n, len(b.ch))
+	return n, nil
+}
+
+// Instance is a source.Instance returning the events of a Buffer
+type Instance struct {
+	source.BaseInstance
+	buffer *Buffer
+	close  func()
+}
+
+// NewInstance returns an instance returning the events of the Buffer,
+// which is closed with the instance after calling close, if not nil
+func NewInstance(b *Buffer, close func()) (*Instance, error) {
+	res := &Instance{buffer: b, close: close}
+	if b.options.EventSize > 0 {
+		evts, err := sdk.NewEventWriters(int64(sdk.DefaultBatchSize), int64(b.options.EventSize))
+		if err != nil {
+			return nil, err
+		}
+		res.SetEvents(evts)
+	}
+	return res, nil
+}
+
+// NextBatch implements source.Instance
+func (i *Instance) NextBatch(pState sdk.PluginState, evts sdk.EventWriters) (int, error) {
+	return i.buffer.NextBatch(evts)
+}
+
+// Close implements sdk.Closer
+func (i *Instance) Close() {
+	if i.close != nil {
+		i.close()
+	}
+	i.buffer.Close()
+}
@@ -0,0 +1,261 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package batch
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+)
+
+type testEventWriter struct {
+	data bytes.Buffer
+	ts   uint64
+}
+
+func (t *testEventWriter) Writer() io.Writer {
+	t.data.Reset()
+	return &t.data
+}
+
+func (t *testEventWriter) SetTimestamp(value uint64) {
+	t.ts = value
+}
+
+type testEventWriters struct {
+	evts []*testEventWriter
+}
+
+func newTestEventWriters(size int) *testEventWriters {
+	res := &testEventWriters{}
+	for i := 0; i < size; i++ {
+		res.evts = append(res.evts, &testEventWriter{})
+	}
+	return res
+}
+
+func (t *testEventWriters) Get(eventIndex int) sdk.EventWriter {
+	return t.evts[eventIndex]
+}
+
+func (t *testEventWriters) Len() int {
+	return len(t.evts)
+}
+
+func (t *testEventWriters) ArrayPtr() unsafe.Pointer {
+	return nil
+}
+
+func (t *testEventWriters) Free() {
+	// do nothing
+}
+
+// data returns the data of the first n events, joined with commas
+func (t *testEventWriters) data(n int) string {
+	var res []string
+	for _, evt := range t.evts[:n] {
+		res = append(res, evt.data.String())
+	}
+	return strings.Join(res, ",")
+}
+
+func newTestBuffer() *Buffer {
+	return NewBuffer(&BufferOptions{Size: 16, Timeout: 10 * time.Millisecond, Linger: 10 * time.Millisecond})
+}
+
+func push(b *Buffer, data ...string) {
+	for _, d := range data {
+		b.Push(source.PushEvent{Data: []byte(d)})
+	}
+}
+
+func TestBufferTimeout(t *testing.T) {
+	b := newTestBuffer()
+	if n, err := b.NextBatch(newTestEventWriters(4)); n != 0 || err != sdk.ErrTimeout {
+		t.Errorf("expected a timeout, got %d events (%v)", n, err)
+	}
+}
+
+func TestBufferBatches(t *testing.T) {
+	var mu sync.Mutex
+	count := 0
+	b := NewBuffer(&BufferOptions{
+		Size:   16,
+		Linger: 10 * time.Millisecond,
+		OnEvent: func(evt *source.PushEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			count++
+		},
+	})
+	evts := newTestEventWriters(4)
+	push(b, "a", "b", "c", "d", "e")
+
+	// the first batch has a single event, and the next ones grow with the
+	// backlog, up to the event writers
+	for _, expected := range []string{"a", "b,c", "d,e"} {
+		n, err := b.NextBatch(evts)
+		if err != nil || evts.data(n) != expected {
+			t.Fatalf("expected the events %s, got %s (%v)", expected, evts.data(n), err)
+		}
+	}
+	if evts.evts[0].ts != 0 {
+		t.Errorf("expected no timestamp for the events without one, got %d", evts.evts[0].ts)
+	}
+
+	// the partial batches are returned after the linger
+	b.Push(source.PushEvent{Data: []byte("f"), Timestamp: time.Unix(0, 42)})
+	if n, err := b.NextBatch(evts); err != nil || evts.data(n) != "f" {
+		t.Fatalf("expected a single event, got %s (%v)", evts.data(n), err)
+	}
+	if evts.evts[0].ts != 42 {
+		t.Errorf("expected the timestamp of the event, got %d", evts.evts[0].ts)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if count != 6 {
+		t.Errorf("expected OnEvent to be called for the 6 events, got %d", count)
+	}
+}
+
+func TestBufferErrorAfterPartialBatch(t *testing.T) {
+	b := newTestBuffer()
+	b.sizer.size = 4
+	failure := errors.New("failure")
+	push(b, "a", "b")
+	b.Push(source.PushEvent{Err: failure})
+	push(b, "c")
+
+	// the events before the error are returned first, then the error
+	// alone, which ends the stream
+	evts := newTestEventWriters(4)
+	if n, err := b.NextBatch(evts); err != nil || evts.data(n) != "a,b" {
+		t.Fatalf("expected the events before the error, got %s (%v)", evts.data(n), err)
+	}
+	if n, err := b.NextBatch(evts); n != 0 || err != failure {
+		t.Fatalf("expected the error, got %d events (%v)", n, err)
+	}
+	if n, err := b.NextBatch(evts); n != 0 || err != sdk.ErrEOF {
+		t.Fatalf("expected the end of the stream, got %d events (%v)", n, err)
+	}
+}
+
+func TestBufferEOFMidBatch(t *testing.T) {
+	b := newTestBuffer()
+	b.sizer.size = 4
+	push(b, "a", "b")
+	close(b.C())
+
+	// the events before the closing are returned first, then sdk.ErrEOF
+	evts := newTestEventWriters(4)
+	if n, err := b.NextBatch(evts); err != nil || evts.data(n) != "a,b" {
+		t.Fatalf("expected the events before the closing, got %s (%v)", evts.data(n), err)
+	}
+	for i := 0; i < 2; i++ {
+		if n, err := b.NextBatch(evts); n != 0 || err != sdk.ErrEOF {
+			t.Fatalf("expected the end of the stream, got %d events (%v)", n, err)
+		}
+	}
+
+	// and right away without events
+	b = newTestBuffer()
+	close(b.C())
+	if n, err := b.NextBatch(evts); n != 0 || err != sdk.ErrEOF {
+		t.Fatalf("expected the end of the stream, got %d events (%v)", n, err)
+	}
+}
+
+func TestBufferClose(t *testing.T) {
+	b := NewBuffer(&BufferOptions{Size: 1})
+	if !b.Push(source.PushEvent{Data: []byte("a")}) {
+		t.Fatal("expected the event to be pushed")
+	}
+
+	// closing unblocks the producers waiting for room
+	res := make(chan bool)
+	go func() { res <- b.Push(source.PushEvent{Data: []byte("b")}) }()
+	time.Sleep(10 * time.Millisecond)
+	closed := false
+	inst, err := NewInstance(b, func() { closed = true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst.Close()
+	inst.Close()
+	select {
+	case ok := <-res:
+		if ok {
+			t.Error("expected the pending push to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the pending push to return")
+	}
+	if !closed {
+		t.Error("expected the close function to be called")
+	}
+	select {
+	case <-b.Done():
+	default:
+		t.Error("expected the buffer to be done")
+	}
+	if b.Push(source.PushEvent{}) {
+		t.Error("expected the pushes to fail once closed")
+	}
+}
+
+func TestBufferConcurrent(t *testing.T) {
+	b := NewBuffer(&BufferOptions{Size: 8})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				b.Push(source.PushEvent{Data: []byte("a")})
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(b.C())
+	}()
+
+	evts := newTestEventWriters(16)
+	count := 0
+	for {
+		n, err := b.NextBatch(evts)
+		count += n
+		if err == sdk.ErrEOF {
+			break
+		}
+		if err != nil && err != sdk.ErrTimeout {
+			t.Fatal(err)
+		}
+	}
+	if count != 4000 {
+		t.Errorf("expected 4000 events, got %d", count)
+	}
+}
@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bufpool provides a pool of byte buffers shared by the plugins to
+// read event data and payloads without allocating a new buffer each time.
+package bufpool
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// MaxPooledSize is the capacity above which a buffer is not put back in
+// the pool, so that a single large payload doesn't keep memory forever
+const MaxPooledSize = 16 * 1024 * 1024
+
+var pool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// Get returns an empty buffer from the pool
+func Get() *bytes.Buffer {
+	return pool.Get().(*bytes.Buffer)
+}
+
+// Put resets a buffer and puts it back in the pool. The buffer and the
+// byte slices returned by its methods must not be used after this call.
+func Put(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() > MaxPooledSize {
+		return
+	}
+	buf.Reset()
+	pool.Put(buf)
+}
+
+// ReadAll reads r until EOF into a buffer of the pool. The buffer must be
+// released with Put once its content is not needed anymore.
+func ReadAll(r io.Reader) (*bytes.Buffer, error) {
+	buf := Get()
+	if _, err := buf.ReadFrom(r); err != nil {
+		Put(buf)
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bufpool
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+func TestReadAll(t *testing.T) {
+	buf, err := ReadAll(strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "payload" {
+		t.Errorf("expected payload, got %s", buf.String())
+	}
+	Put(buf)
+
+	// the buffers of the pool are always empty
+	if buf := Get(); buf.Len() != 0 {
+		t.Errorf("expected an empty buffer, got %q", buf.String())
+	}
+
+	if _, err := ReadAll(io.MultiReader(strings.NewReader("a"), errReader{})); err == nil {
+		t.Error("expected the read error")
+	}
+}
+
+func TestPut(t *testing.T) {
+	// the nil buffers are ignored
+	Put(nil)
+
+	buf := bytes.NewBuffer(make([]byte, 0, MaxPooledSize+1))
+	buf.WriteString("large")
+	Put(buf)
+	// the large buffers are not reset, as they are not put back
+	if buf.String() != "large" {
+		t.Errorf("expected the large buffer to be left as is, got %q", buf.String())
+	}
+
+	buf = Get()
+	buf.WriteString("small")
+	Put(buf)
+	if buf.Len() != 0 {
+		t.Errorf("expected the buffer to be reset, got %q", buf.String())
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/falcosecurity/plugins/shared/go/bufpool
+
+go 1.15
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package checkpoint persists the cursors of the polling plugins, such as
+// the time of the last event received or the key of the last object read,
+// so that an instance opened again after a restart of Falco resumes where
+// the previous one stopped instead of re-ingesting or losing events. Each
+// cursor is stored under a key identifying the instance, e.g. the plugin
+// name and the polled organization.
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Store persists the cursors by key
+type Store interface {
+	// Load returns the cursor stored under key, if any
+	Load(key string) (string, bool, error)
+	// Save stores the cursor under key
+	Save(key, cursor string) error
+	// Close releases the resources of the store
+	Close() error
+}
+
+// Open returns the store at the given location. A path, optionally with
+// the file:// scheme, is a FileStore, and the other schemes are reserved
+// for the external stores.
+func Open(location string) (Store, error) {
+	if strings.Contains(location, "://") && !strings.HasPrefix(location, "file://") {
+		return nil, fmt.Errorf("unsupported checkpoint store %q", location)
+	}
+	return OpenFile(strings.TrimPrefix(location, "file://"))
+}
+
+// Key returns the key of a cursor made of the given parts
+func Key(parts ...string) string {
+	return strings.Join(parts, "/")
+}
+
+// FileStore is a Store persisting the cursors in a local JSON file, which
+// is written atomically at each save. It can be shared by the instances of
+// a plugin, but not by several processes.
+type FileStore struct {
+	path    string
+	mu      sync.Mutex
+	cursors map[string]string
+}
+
+// OpenFile returns the FileStore of the given file, restoring the cursors
+// it holds if it exists
+func OpenFile(path string) (*FileStore, error) {
+	s := &FileStore{path: path, cursors: map[string]string{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.cursors); err != nil {
+			return nil, fmt.Errorf("invalid checkpoint file %s: %s", path, err.Error())
+		}
+	}
+	return s, nil
+}
+
+func (s *FileStore) Load(key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cursor, ok := s.cursors[key]
+	return cursor, ok, nil
+}
+
+func (s *FileStore) Save(key, cursor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.cursors[key]
+	if ok && prev == cursor {
+		return nil
+	}
+	s.cursors[key] = cursor
+	if err := s.write(); err != nil {
+		// the cursor is saved again at the next attempt
+		if ok {
+			s.cursors[key] = prev
+		} else {
+			delete(s.cursors, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// write writes all the cursors to the file
+func (s *FileStore) write() error {
+	data, err := json.MarshalIndent(s.cursors, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// the file is replaced by renaming a complete temporary one, so that
+	// a crash while writing never leaves a truncated file
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
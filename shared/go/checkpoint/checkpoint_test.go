@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+	s, err := Open("file://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := s.Load("github/falcosecurity"); ok || err != nil {
+		t.Errorf("expected no cursor, got %v", err)
+	}
+	key := Key("github", "falcosecurity")
+	if key != "github/falcosecurity" {
+		t.Errorf("unexpected key %s", key)
+	}
+	if err := s.Save(key, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(Key("okta", "org"), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(key, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if cursor, ok, err := s.Load(key); !ok || cursor != "2" || err != nil {
+		t.Errorf("expected the last cursor, got %s (%v)", cursor, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cursors are restored by the next store of the file, and no
+	// temporary file is left
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, expected := range map[string]string{key: "2", "okta/org": "a"} {
+		if cursor, ok, _ := s.Load(k); !ok || cursor != expected {
+			t.Errorf("%s: expected the cursor %s, got %s", k, expected, cursor)
+		}
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected a single file, got %d", len(entries))
+	}
+}
+
+func TestFileStoreErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Open("redis://localhost"); err == nil {
+		t.Error("expected an error for an unsupported store")
+	}
+
+	path := filepath.Join(dir, "invalid.json")
+	os.WriteFile(path, []byte("{"), 0600)
+	if _, err := OpenFile(path); err == nil {
+		t.Error("expected an error for an invalid file")
+	}
+	path = filepath.Join(dir, "empty.json")
+	os.WriteFile(path, nil, 0600)
+	if _, err := OpenFile(path); err != nil {
+		t.Errorf("expected an empty file to be accepted, got %v", err)
+	}
+	if _, err := OpenFile(dir); err == nil {
+		t.Error("expected an error for a directory")
+	}
+
+	// a cursor that can't be written is not kept, so that it's saved
+	// again at the next attempt
+	s, err := OpenFile(filepath.Join(dir, "missing", "checkpoints.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save("a", "1"); err == nil {
+		t.Fatal("expected an error writing in a missing directory")
+	}
+	if _, ok, _ := s.Load("a"); ok {
+		t.Error("expected the cursor not to be kept")
+	}
+	os.Mkdir(filepath.Join(dir, "missing"), 0700)
+	if err := s.Save("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll(filepath.Join(dir, "missing"))
+	if err := s.Save("a", "2"); err == nil {
+		t.Fatal("expected an error writing in a missing directory")
+	}
+	if cursor, _, _ := s.Load("a"); cursor != "1" {
+		t.Errorf("expected the previous cursor, got %s", cursor)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/falcosecurity/plugins/shared/go/checkpoint
+
+go 1.16
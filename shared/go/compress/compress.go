@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package compress provides the transparent decompression of the payloads
+// of the plugins ingesting archived logs, such as the CloudTrail files or
+// the ALB and Logpush objects. The compression format is detected from the
+// first bytes of the payload rather than from its name, among gzip, zstd,
+// bzip2 and the framing format of snappy, and the payloads that are not
+// compressed are read as is. The content is decompressed while it's read,
+// so that it's never held in memory as a whole, and the memory used by the
+// decompression and the decompressed size can be bounded.
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format is a compression format
+type Format string
+
+const (
+	None   Format = ""
+	Gzip   Format = "gzip"
+	Zstd   Format = "zstd"
+	Bzip2  Format = "bzip2"
+	Snappy Format = "snappy"
+)
+
+// DefaultMaxWindow is the largest window of the zstd frames accepted by
+// default, which bounds the memory used to decode them
+const DefaultMaxWindow = 64 << 20
+
+// ErrTooLarge is returned by the readers when the decompressed content
+// exceeds the maximum size of the options
+var ErrTooLarge = errors.New("decompressed payload exceeds the maximum size")
+
+// magics are the first bytes of the payloads of each format
+var magics = []struct {
+	format Format
+	magic  []byte
+}{
+	{Gzip, []byte{0x1f, 0x8b}},
+	{Zstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{Bzip2, []byte("BZh")},
+	{Snappy, []byte("\xff\x06\x00\x00sNaPpY")},
+}
+
+// maxMagic is the length of the longest magic
+const maxMagic = 10
+
+// Detect returns the compression format of a payload given its first
+// bytes, or None if it's not compressed or in an unknown format
+func Detect(head []byte) Format {
+	for _, m := range magics {
+		if bytes.HasPrefix(head, m.magic) {
+			return m.format
+		}
+	}
+	return None
+}
+
+// Options are the options of a reader
+type Options struct {
+	// MaxSize is the maximum size of the decompressed content, above
+	// which the reader fails with ErrTooLarge, or 0 for no limit
+	MaxSize int64
+	// MaxWindow is the largest window of the zstd frames, or
+	// DefaultMaxWindow if 0
+	MaxWindow uint64
+}
+
+// Reader reads the decompressed content of a payload
+type Reader struct {
+	format  Format
+	r       io.Reader
+	closer  func()
+	limit   int64
+	limited bool
+}
+
+// NewReader returns a reader of the decompressed content of r, with the
+// given options or the default ones if nil. The headers of the gzip and
+// zstd payloads are read and checked at once.
+func NewReader(r io.Reader, options *Options) (*Reader, error) {
+	var opts Options
+	if options != nil {
+		opts = *options
+	}
+	if opts.MaxWindow == 0 {
+		opts.MaxWindow = DefaultMaxWindow
+	}
+
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(maxMagic)
+	res := &Reader{format: Detect(head), r: br, closer: func() {}}
+	switch res.format {
+	case Gzip:
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		res.r, res.closer = gz, func() { gz.Close() }
+	case Zstd:
+		// a single goroutine and the low memory mode, since the
+		// payloads are decompressed while the events are read
+		dec, err := zstd.NewReader(br,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderLowmem(true),
+			zstd.WithDecoderMaxWindow(opts.MaxWindow))
+		if err != nil {
+			return nil, err
+		}
+		res.r, res.closer = dec, dec.Close
+	case Bzip2:
+		res.r = bzip2.NewReader(br)
+	case Snappy:
+		res.r = snappy.NewReader(br)
+	}
+	if opts.MaxSize > 0 {
+		res.limit = opts.MaxSize
+		res.limited = true
+	}
+	return res, nil
+}
+
+// Format returns the compression format of the payload
+func (r *Reader) Format() Format {
+	return r.format
+}
+
+// Read implements io.Reader
+func (r *Reader) Read(p []byte) (int, error) {
+	if !r.limited {
+		return r.r.Read(p)
+	}
+	if r.limit <= 0 {
+		// the content is too large only if there is more of it
+		var b [1]byte
+		n, err := r.r.Read(b[:])
+		if n > 0 {
+			return 0, ErrTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > r.limit {
+		p = p[:r.limit]
+	}
+	n, err := r.r.Read(p)
+	r.limit -= int64(n)
+	return n, err
+}
+
+// Close releases the resources of the decompression. It doesn't close the
+// reader of the payload.
+func (r *Reader) Close() error {
+	r.closer()
+	return nil
+}
@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// testBzip2 is "hello bzip2\n" compressed by the bzip2 tool, since the
+// standard library has no bzip2 encoder
+const testBzip2 = "425a6839314159265359ab6ba1f1000002d9800010400010001264c01020003100d34d04001ea3ef4e51a2078bb9229c284855b5d0f880"
+
+// compressed returns the content compressed in the given format by the
+// reference encoders
+func compressed(t *testing.T, f Format, content string) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch f {
+	case None:
+		return []byte(content)
+	case Gzip:
+		w = gzip.NewWriter(&buf)
+	case Zstd:
+		enc, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = enc
+	case Snappy:
+		w = snappy.NewBufferedWriter(&buf)
+	case Bzip2:
+		if content != "hello bzip2\n" {
+			t.Fatal("only the bzip2 fixture is available")
+		}
+		b, _ := hex.DecodeString(testBzip2)
+		return b
+	}
+	if _, err := w.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReader(t *testing.T) {
+	large := strings.Repeat(`{"eventName":"GetObject"}`+"\n", 100000)
+	tests := []struct {
+		format  Format
+		content string
+	}{
+		{None, "hello\n"},
+		{None, ""},
+		{Gzip, "hello bzip2\n"},
+		{Gzip, large},
+		{Zstd, large},
+		{Snappy, large},
+		{Bzip2, "hello bzip2\n"},
+	}
+	for _, test := range tests {
+		data := compressed(t, test.format, test.content)
+		if f := Detect(data); f != test.format {
+			t.Errorf("expected the format %q, got %q", test.format, f)
+		}
+		r, err := NewReader(bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", test.format, err)
+		}
+		res, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", test.format, err)
+		}
+		if string(res) != test.content || r.Format() != test.format {
+			t.Errorf("%s: unexpected content of %d bytes", test.format, len(res))
+		}
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	content := strings.Repeat("a", 1000)
+	for _, f := range []Format{None, Gzip, Zstd, Snappy} {
+		data := compressed(t, f, content)
+
+		// the content of the maximum size is accepted
+		r, err := NewReader(bytes.NewReader(data), &Options{MaxSize: 1000})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res, err := io.ReadAll(r); err != nil || len(res) != 1000 {
+			t.Errorf("%s: expected the whole content, got %d bytes (%v)", f, len(res), err)
+		}
+		r.Close()
+
+		// but not a larger one
+		r, err = NewReader(bytes.NewReader(data), &Options{MaxSize: 999})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res, err := io.ReadAll(r); err != ErrTooLarge || len(res) != 999 {
+			t.Errorf("%s: expected ErrTooLarge after 999 bytes, got %d bytes (%v)", f, len(res), err)
+		}
+		r.Close()
+	}
+}
+
+func TestMaxWindow(t *testing.T) {
+	// a frame whose window is larger than the maximum is rejected
+	var buf bytes.Buffer
+	enc, _ := zstd.NewWriter(&buf, zstd.WithWindowSize(1<<20), zstd.WithSingleSegment(false))
+	enc.Write(bytes.Repeat([]byte("abcdefgh"), 1<<18))
+	enc.Close()
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), &Options{MaxWindow: 1 << 10})
+	if err == nil {
+		_, err = io.ReadAll(r)
+		r.Close()
+	}
+	if err == nil {
+		t.Error("expected the window to be rejected")
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	// the headers are checked at once
+	if _, err := NewReader(bytes.NewReader([]byte{0x1f, 0x8b, 0}), nil); err == nil {
+		t.Error("expected an invalid gzip header to be rejected")
+	}
+
+	// and the corrupted content fails while reading
+	for _, f := range []Format{Gzip, Zstd, Snappy, Bzip2} {
+		data := compressed(t, f, "hello bzip2\n")
+		data = data[:len(data)-4]
+		r, err := NewReader(bytes.NewReader(data), nil)
+		if err == nil {
+			_, err = io.ReadAll(r)
+			r.Close()
+		}
+		if err == nil {
+			t.Errorf("%s: expected a truncated payload to fail", f)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+module github.com/falcosecurity/plugins/shared/go/compress
+
+go 1.20
+
+require github.com/klauspost/compress v1.17.9
@@ -0,0 +1,679 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package conformance provides the checks that every plugin must pass,
+// whatever its capabilities: its info must be consistent with its entry of
+// the registry, its fields must be well-formed, and malformed configs, open
+// params and payloads must make it fail with an error instead of a panic.
+// The checks run as subtests of a regular test of each plugin:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, func() conformance.Plugin { return &Plugin{} }, conformance.Options{})
+//	}
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultCorpus is the directory of the payloads from which the fields are
+// extracted, shared with the golden file tests
+const DefaultCorpus = "testdata/golden"
+
+// goldenExt is the extension of the golden files, which are not payloads
+const goldenExt = ".golden"
+
+// openTimeout is how long an event stream opened with bad params is read
+// before giving up on getting an error
+const openTimeout = 5 * time.Second
+
+var (
+	// DefaultBadOpenParams are the open params that must make a plugin fail
+	// to open its event stream when none are given in the Options
+	DefaultBadOpenParams = []string{"{", "\x00"}
+
+	// badConfigs are the init configs that must make any plugin fail
+	badConfigs = []string{"{", "[]", `"config"`, `{"a":`, "\x00"}
+
+	// badPayloads are the payloads, beside the truncated ones of the
+	// corpus, from which the fields are extracted
+	badPayloads = []string{"", "\x00", "\xff\xfe", "null", "{}", "[]", `{"a":`, "0"}
+
+	// keyArgs and indexArgs are the arguments passed to the fields that
+	// accept one
+	keyArgs   = []string{"", "a", "/a/0", "["}
+	indexArgs = []uint64{0, 1 << 63}
+
+	rgxName    = regexp.MustCompile(`^[a-z]+[a-z0-9-_]*$`)
+	rgxSource  = regexp.MustCompile(`^[a-z]+[a-z0-9_]*$`)
+	rgxField   = regexp.MustCompile(`^[a-zA-Z0-9_]+(\.[a-zA-Z0-9_]+)+$`)
+	rgxVersion = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+	fieldTypes = map[string]uint32{
+		"uint64":  sdk.FieldTypeUint64,
+		"string":  sdk.FieldTypeCharBuf,
+		"reltime": sdk.FieldTypeRelTime,
+		"abstime": sdk.FieldTypeAbsTime,
+		"bool":    sdk.FieldTypeBool,
+		"ipaddr":  sdk.FieldTypeIPAddr,
+		"ipnet":   sdk.FieldTypeIPNet,
+	}
+)
+
+// Plugin is the part of the plugin interface common to all the plugins, the
+// checks of each capability run if the plugin supports it
+type Plugin interface {
+	Info() *plugins.Info
+	Init(config string) error
+}
+
+// Extractor is a plugin supporting the field extraction capability
+type Extractor interface {
+	Plugin
+	Fields() []sdk.FieldEntry
+	Extract(req sdk.ExtractRequest, evt sdk.EventReader) error
+}
+
+// Options tunes the checks to a plugin
+type Options struct {
+	// InitConfig is a valid init config of the plugin, with which it is
+	// initialized for the checks other than the ones of Init. The empty
+	// config is "{}" for the plugins with an init schema, as in Falco.
+	InitConfig string
+	// ConfigRequired tells that the plugin can't be initialized with the
+	// empty config, which must then fail with an error
+	ConfigRequired bool
+	// BadOpenParams are the open params that must make the plugin fail to
+	// open its event stream, DefaultBadOpenParams if nil
+	BadOpenParams []string
+	// Corpus is the directory of the payloads whose truncations the fields
+	// are extracted from, DefaultCorpus if empty. Only the bad payloads are
+	// used if the default directory doesn't exist.
+	Corpus string
+	// Registry is the path of the registry file, searched for in the
+	// working directory and its parents if empty
+	Registry string
+}
+
+// checks are the conformance checks, run in this order
+var checks = []struct {
+	name string
+	run  func(t *testing.T, newPlugin func() Plugin, opts *Options)
+}{
+	{"Info", checkInfo},
+	{"Registry", checkRegistry},
+	{"InitSchema", checkInitSchema},
+	{"Init", checkInit},
+	{"Fields", checkFields},
+	{"Open", checkOpen},
+	{"Extract", checkExtract},
+}
+
+// Run runs each conformance check as a subtest, with a new plugin created
+// by newPlugin for each of them
+func Run(t *testing.T, newPlugin func() Plugin, opts Options) {
+	if opts.BadOpenParams == nil {
+		opts.BadOpenParams = DefaultBadOpenParams
+	}
+	for _, c := range checks {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			c.run(t, newPlugin, &opts)
+		})
+	}
+}
+
+// call calls f and returns its error, or an error holding the stack trace
+// of the panic of f as its second result
+func call(f func() error) (err error, panicked error) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return f(), nil
+}
+
+// hasSchema tells whether a plugin has an init schema, in which case Falco
+// validates the init configs against it before passing them to the plugin
+func hasSchema(p Plugin) bool {
+	s, ok := p.(sdk.InitSchema)
+	return ok && s.InitSchema() != nil
+}
+
+// initConfig returns the init config passed by Falco to a plugin for the
+// given one
+func initConfig(p Plugin, config string) string {
+	if config == "" && hasSchema(p) {
+		return "{}"
+	}
+	return config
+}
+
+// initPlugin returns a new plugin initialized with the init config of the
+// options, which is destroyed at the end of the test
+func initPlugin(t *testing.T, newPlugin func() Plugin, opts *Options) Plugin {
+	p := newPlugin()
+	err, panicked := call(func() error { return p.Init(initConfig(p, opts.InitConfig)) })
+	if panicked != nil {
+		t.Fatal(panicked)
+	}
+	if err != nil {
+		t.Fatalf("init failed with config %q: %s", opts.InitConfig, err)
+	}
+	if d, ok := p.(sdk.Destroyer); ok {
+		t.Cleanup(d.Destroy)
+	}
+	return p
+}
+
+func checkInfo(t *testing.T, newPlugin func() Plugin, opts *Options) {
+	i := newPlugin().Info()
+	if !rgxName.MatchString(i.Name) {
+		t.Errorf("invalid name %q", i.Name)
+	}
+	if i.Description == "" {
+		t.Error("empty description")
+	}
+	if i.Contact == "" {
+		t.Error("empty contact")
+	}
+	if !rgxVersion.MatchString(i.Version) {
+		t.Errorf("version %q is not a semver", i.Version)
+	}
+	_, sourcing := newPlugin().(source.Plugin)
+	if sourcing {
+		if i.ID == 0 {
+			t.Error("the ID of a plugin with the sourcing capability can't be 0")
+		}
+		if !rgxSource.MatchString(i.EventSource) {
+			t.Errorf("invalid event source %q", i.EventSource)
+		}
+	} else if i.ID != 0 || i.EventSource != "" {
+		t.Errorf("a plugin without the sourcing capability has ID %d and event source %q", i.ID, i.EventSource)
+	}
+	if _, ok := newPlugin().(Extractor); !ok && len(i.ExtractEventSources) > 0 {
+		t.Error("a plugin without the extraction capability has extract event sources")
+	}
+}
+
+// registry holds the parts of the registry file used by the checks
+type registry struct {
+	ReservedSources []string `yaml:"reserved_sources"`
+	Plugins         []struct {
+		Name         string `yaml:"name"`
+		Reserved     bool   `yaml:"reserved"`
+		Capabilities struct {
+			Sourcing struct {
+				Supported bool   `yaml:"supported"`
+				ID        uint32 `yaml:"id"`
+				Source    string `yaml:"source"`
+			} `yaml:"sourcing"`
+			Extraction struct {
+				Supported bool     `yaml:"supported"`
+				Sources   []string `yaml:"sources"`
+			} `yaml:"extraction"`
+		} `yaml:"capabilities"`
+	} `yaml:"plugins"`
+}
+
+// findRegistry returns the path of the registry file found in the working
+// directory or its closest parent
+func findRegistry() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, "registry.yaml")
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("registry.yaml not found in the working directory and its parents")
+		}
+		dir = parent
+	}
+}
+
+func checkRegistry(t *testing.T, newPlugin func() Plugin, opts *Options) {
+	path := opts.Registry
+	if path == "" {
+		var err error
+		if path, err = findRegistry(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r registry
+	if err := yaml.Unmarshal(data, &r); err != nil {
+		t.Fatalf("parsing %s: %s", path, err)
+	}
+
+	p := newPlugin()
+	i := p.Info()
+	for _, s := range r.ReservedSources {
+		if i.EventSource == s {
+			t.Errorf("event source %q is reserved", s)
+		}
+	}
+	for _, e := range r.Plugins {
+		if e.Name != i.Name {
+			continue
+		}
+		if e.Reserved {
+			t.Errorf("name %q is reserved", i.Name)
+		}
+		_, sourcing := p.(source.Plugin)
+		_, extraction := p.(Extractor)
+		caps := &e.Capabilities
+		if caps.Sourcing.Supported != sourcing {
+			t.Errorf("sourcing capability is %v, %v in %s", sourcing, caps.Sourcing.Supported, path)
+		}
+		if caps.Extraction.Supported != extraction {
+			t.Errorf("extraction capability is %v, %v in %s", extraction, caps.Extraction.Supported, path)
+		}
+		if sourcing && caps.Sourcing.ID != i.ID {
+			t.Errorf("ID is %d, %d in %s", i.ID, caps.Sourcing.ID, path)
+		}
+		if sourcing && caps.Sourcing.Source != i.EventSource {
+			t.Errorf("event source is %q, %q in %s", i.EventSource, caps.Sourcing.Source, path)
+		}
+		if len(caps.Extraction.Sources) > 0 && !sameSet(caps.Extraction.Sources, i.ExtractEventSources) {
+			t.Errorf("extract event sources are %v, %v in %s", i.ExtractEventSources, caps.Extraction.Sources, path)
+		}
+		return
+	}
+	t.Errorf("plugin %q not found in %s", i.Name, path)
+}
+
+func sameSet(a, b []string) bool {
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return strings.Join(a, "\x00") == strings.Join(b, "\x00")
+}
+
+func checkInitSchema(t *testing.T, newPlugin func() Plugin, opts *Options) {
+	p, ok := newPlugin().(sdk.InitSchema)
+	if !ok {
+		t.Skip("no init schema")
+	}
+	s := p.InitSchema()
+	if s == nil {
+		t.Skip("no init schema")
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(s.Schema), &v); err != nil {
+		t.Fatalf("invalid init schema: %s", err)
+	}
+}
+
+func checkInit(t *testing.T, newPlugin func() Plugin, opts *Options) {
+	type test struct {
+		config    string
+		wantErr   bool
+		malformed bool
+	}
+	tests := []test{{config: "", wantErr: opts.ConfigRequired}}
+	if opts.InitConfig != "" {
+		tests = append(tests, test{config: opts.InitConfig})
+	}
+	for _, c := range badConfigs {
+		tests = append(tests, test{config: c, wantErr: true, malformed: true})
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("%q", tt.config), func(t *testing.T) {
+			p := newPlugin()
+			err, panicked := call(func() error { return p.Init(initConfig(p, tt.config)) })
+			if panicked != nil {
+				t.Fatal(panicked)
+			}
+			if d, ok := p.(sdk.Destroyer); ok && err == nil {
+				defer d.Destroy()
+			}
+			// the malformed configs are rejected by Falco before reaching
+			// the plugins with an init schema, which must only not panic
+			if tt.malformed && hasSchema(p) {
+				return
+			}
+			if tt.wantErr && err == nil {
+				t.Error("init succeeded")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("init failed: %s", err)
+			}
+		})
+	}
+}
+
+func checkFields(t *testing.T, newPlugin func() Plugin, opts *Options) {
+	p, ok := newPlugin().(Extractor)
+	if !ok {
+		t.Skip("no extraction capability")
+	}
+	fields := p.Fields()
+	if len(fields) == 0 {
+		t.Fatal("no field")
+	}
+	names := make(map[string]bool)
+	for _, f := range fields {
+		if !rgxField.MatchString(f.Name) {
+			t.Errorf("invalid field name %q", f.Name)
+		}
+		if names[f.Name] {
+			t.Errorf("field %s is defined more than once", f.Name)
+		}
+		names[f.Name] = true
+		if _, ok := fieldTypes[f.Type]; !ok {
+			t.Errorf("field %s has invalid type %q", f.Name, f.Type)
+		}
+		if f.Desc == "" {
+			t.Errorf("field %s has no description", f.Name)
+		}
+		if f.Arg.IsRequired && !f.Arg.IsKey && !f.Arg.IsIndex {
+			t.Errorf("field %s requires an argument that is neither a key nor an index", f.Name)
+		}
+	}
+}
+
+func checkOpen(t *testing.T, newPlugin func() Plugin, opts *Options) {
+	if _, ok := newPlugin().(source.Plugin); !ok {
+		t.Skip("no sourcing capability")
+	}
+	for _, params := range opts.BadOpenParams {
+		params := params
+		t.Run(fmt.Sprintf("%q", params), func(t *testing.T) {
+			p := initPlugin(t, newPlugin, opts).(source.Plugin)
+			var inst source.Instance
+			err, panicked := call(func() (err error) {
+				inst, err = p.Open(params)
+				return err
+			})
+			if panicked != nil {
+				t.Fatal(panicked)
+			}
+			if err != nil {
+				return
+			}
+			if c, ok := inst.(sdk.Closer); ok {
+				defer c.Close()
+			}
+			// the plugins opening their event stream asynchronously fail
+			// with the first batches instead
+			evts := newEventWriters(int(sdk.DefaultBatchSize))
+			for deadline := time.Now().Add(openTimeout); time.Now().Before(deadline); {
+				err, panicked = call(func() (err error) {
+					_, err = inst.NextBatch(p, evts)
+					return err
+				})
+				if panicked != nil {
+					t.Fatal(panicked)
+				}
+				switch err {
+				case nil, sdk.ErrTimeout:
+					continue
+				case sdk.ErrEOF:
+					t.Fatal("open succeeded with an empty event stream")
+				default:
+					return
+				}
+			}
+			t.Error("open succeeded")
+		})
+	}
+}
+
+func checkExtract(t *testing.T, newPlugin func() Plugin, opts *Options) {
+	if _, ok := newPlugin().(Extractor); !ok {
+		t.Skip("no extraction capability")
+	}
+	p := initPlugin(t, newPlugin, opts).(Extractor)
+
+	payloads := make(map[string][]byte)
+	for _, b := range badPayloads {
+		payloads[fmt.Sprintf("%q", b)] = []byte(b)
+	}
+	dir := opts.Corpus
+	if dir == "" {
+		dir = DefaultCorpus
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil && (opts.Corpus != "" || !os.IsNotExist(err)) {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) == goldenExt {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range []int{0, 1, len(data) / 4, len(data) / 2, len(data) * 3 / 4, len(data) - 1} {
+			if n >= 0 && n < len(data) {
+				payloads[fmt.Sprintf("%s[:%d]", e.Name(), n)] = data[:n]
+			}
+		}
+	}
+	var names []string
+	for name := range payloads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	reqs := newRequests(p.Fields())
+	stringer, _ := p.(sdk.Stringer)
+	for i, name := range names {
+		// each payload is a new event, so that the plugins don't reuse
+		// what they cached for the previous one
+		evt := &event{num: uint64(i + 1), data: payloads[name]}
+		for _, req := range reqs {
+			_, panicked := call(func() error { return p.Extract(req, evt) })
+			if panicked != nil {
+				t.Errorf("extracting %s from %s: %s", req, name, panicked)
+			}
+		}
+		if stringer != nil {
+			_, panicked := call(func() (err error) {
+				_, err = stringer.String(evt)
+				return err
+			})
+			if panicked != nil {
+				t.Errorf("formatting %s: %s", name, panicked)
+			}
+		}
+	}
+}
+
+// newRequests returns the requests of all the fields, with several
+// arguments for the fields that accept one
+func newRequests(fields []sdk.FieldEntry) []*request {
+	var reqs []*request
+	for id, f := range fields {
+		base := request{
+			fieldID:   uint64(id),
+			fieldType: fieldTypes[f.Type],
+			field:     f.Name,
+			isList:    f.IsList,
+		}
+		if !f.Arg.IsRequired {
+			req := base
+			reqs = append(reqs, &req)
+		}
+		if f.Arg.IsKey {
+			for _, arg := range keyArgs {
+				req := base
+				req.argKey = arg
+				req.argPresent = true
+				reqs = append(reqs, &req)
+			}
+		}
+		if f.Arg.IsIndex {
+			for _, arg := range indexArgs {
+				req := base
+				req.argIndex = arg
+				req.argPresent = true
+				reqs = append(reqs, &req)
+			}
+		}
+	}
+	return reqs
+}
+
+// request implements sdk.ExtractRequest and discards the extracted values
+type request struct {
+	fieldID    uint64
+	fieldType  uint32
+	field      string
+	argKey     string
+	argIndex   uint64
+	argPresent bool
+	isList     bool
+}
+
+func (r *request) String() string {
+	switch {
+	case !r.argPresent:
+		return r.field
+	case r.argKey != "":
+		return fmt.Sprintf("%s[%s]", r.field, r.argKey)
+	default:
+		return fmt.Sprintf("%s[%d]", r.field, r.argIndex)
+	}
+}
+
+func (r *request) FieldID() uint64 {
+	return r.fieldID
+}
+
+func (r *request) FieldType() uint32 {
+	return r.fieldType
+}
+
+func (r *request) Field() string {
+	return r.field
+}
+
+func (r *request) ArgKey() string {
+	return r.argKey
+}
+
+func (r *request) ArgIndex() uint64 {
+	return r.argIndex
+}
+
+func (r *request) ArgPresent() bool {
+	return r.argPresent
+}
+
+func (r *request) IsList() bool {
+	return r.isList
+}
+
+func (r *request) SetValue(v interface{}) {
+	// do nothing
+}
+
+func (r *request) SetPtr(unsafe.Pointer) {
+	// do nothing
+}
+
+// event implements sdk.EventReader
+type event struct {
+	num  uint64
+	data []byte
+}
+
+func (e *event) EventNum() uint64 {
+	return e.num
+}
+
+func (e *event) Timestamp() uint64 {
+	return 0
+}
+
+func (e *event) Reader() io.ReadSeeker {
+	return bytes.NewReader(e.data)
+}
+
+// eventWriters implements sdk.EventWriters in Go memory
+type eventWriters struct {
+	evts []*eventWriter
+}
+
+func newEventWriters(size int) *eventWriters {
+	res := &eventWriters{}
+	for i := 0; i < size; i++ {
+		res.evts = append(res.evts, &eventWriter{})
+	}
+	return res
+}
+
+func (w *eventWriters) Get(eventIndex int) sdk.EventWriter {
+	return w.evts[eventIndex]
+}
+
+func (w *eventWriters) Len() int {
+	return len(w.evts)
+}
+
+func (w *eventWriters) ArrayPtr() unsafe.Pointer {
+	return nil
+}
+
+func (w *eventWriters) Free() {
+	// do nothing
+}
+
+type eventWriter struct {
+	data bytes.Buffer
+}
+
+func (w *eventWriter) Writer() io.Writer {
+	w.data.Reset()
+	return &w.data
+}
+
+func (w *eventWriter) SetTimestamp(value uint64) {
+	// do nothing
+}
@@ -0,0 +1,8 @@
+module github.com/falcosecurity/plugins/shared/go/conformance
+
+go 1.15
+
+require (
+	github.com/falcosecurity/plugin-sdk-go v0.7.3
+	gopkg.in/yaml.v2 v2.4.0
+)
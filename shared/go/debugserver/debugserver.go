@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package debugserver provides the HTTP server exposing the pprof and expvar
+// endpoints of a plugin, to diagnose the goroutines and the allocations of a
+// long-running plugin in place. The server only listens on the loopback
+// interface, since the profiles contain sensitive data.
+package debugserver
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+var publishOnce sync.Once
+
+// Server is a running debug server
+type Server struct {
+	srv *http.Server
+	ln  net.Listener
+}
+
+// Start starts a debug server listening on addr, which must be a loopback
+// address such as localhost:6060 or 127.0.0.1:6060. The pprof endpoints
+// are served under /debug/pprof/ and the expvar ones under /debug/vars.
+func Start(addr string) (*Server, error) {
+	if err := checkLoopback(addr); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// the number of goroutines is not published by expvar by default
+	publishOnce.Do(func() {
+		expvar.Publish("goroutines", expvar.Func(func() interface{} {
+			return runtime.NumGoroutine()
+		}))
+	})
+
+	m := http.NewServeMux()
+	m.HandleFunc("/debug/pprof/", pprof.Index)
+	m.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	m.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	m.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	m.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	m.Handle("/debug/vars", expvar.Handler())
+
+	s := &Server{srv: &http.Server{Handler: m}, ln: ln}
+	go s.srv.Serve(ln)
+	return s, nil
+}
+
+// Close stops the debug server
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := s.srv.Shutdown(ctx)
+	// the listener is not closed by Shutdown if the server is closed
+	// before it started serving it, so that the address is released
+	// by the time Close returns
+	s.ln.Close()
+	return err
+}
+
+// checkLoopback returns an error if addr doesn't only listen on the
+// loopback interface
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("debug server address %s is not a loopback address", addr)
+}
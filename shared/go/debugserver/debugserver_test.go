@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package debugserver
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+)
+
+// freeAddr returns the address of a free loopback port
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestStart(t *testing.T) {
+	addr := freeAddr(t)
+	s, err := Start(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine?debug=1", "/debug/pprof/cmdline", "/debug/vars"} {
+		res, err := client.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected the status 200, got %d", path, res.StatusCode)
+		}
+	}
+
+	// the number of goroutines is published along with the expvar ones
+	res, err := client.Get("http://" + addr + "/debug/vars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vars map[string]interface{}
+	err = json.NewDecoder(res.Body).Decode(&vars)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := vars["goroutines"].(float64); !ok || n < 1 {
+		t.Errorf("expected the number of goroutines, got %v", vars["goroutines"])
+	}
+
+	// a second server can be started, the vars being published once
+	other, err := Start(freeAddr(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Close()
+
+	// the address is released once the server is closed, even right
+	// after being started
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		s, err := Start(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Fatalf("expected the address to be released, got %s", err)
+		}
+		ln.Close()
+	}
+}
+
+func TestStartLoopback(t *testing.T) {
+	tests := map[string]bool{
+		"localhost:0":      true,
+		"127.0.0.1:0":      true,
+		"[::1]:0":          true,
+		":6060":            false,
+		"0.0.0.0:0":        false,
+		"10.0.0.1:0":       false,
+		"example.com:6060": false,
+		"invalid":          false,
+	}
+	for addr, ok := range tests {
+		if err := checkLoopback(addr); (err == nil) != ok {
+			t.Errorf("%s: expected the address to be accepted: %v, got %v", addr, ok, err)
+		}
+	}
+	if _, err := Start(":0"); err == nil {
+		t.Error("expected an error starting the server on all the interfaces")
+	}
+}
@@ -0,0 +1,231 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dedup drops the events already received within a sliding window,
+// such as the ones of the overlapping pages returned by the APIs polled from
+// a cursor that is not exact, e.g. after a restart. An event is identified
+// by a hash of the values of a set of fields of its JSON payload, or of the
+// whole payload, and is a duplicate if the same hash was seen within the
+// window. The hashes are bounded by a memory budget, beyond which the
+// oldest ones are forgotten before the end of the window, and can be saved
+// in a file when the filter is closed, so that the window survives a
+// restart.
+package dedup
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/falcosecurity/plugins/shared/go/jsoncache"
+	"github.com/valyala/fastjson"
+)
+
+// entrySize is the estimated memory used by a hash, in the map and in the
+// queue of the window
+const entrySize = 64
+
+// Config is the configuration block of the de-duplication of the events
+type Config struct {
+	Window uint64   `json:"window" jsonschema:"title=Window,description=Duration in seconds during which an event identical to one already received is dropped (default: 0 for disabled)"`
+	Fields []string `json:"fields" jsonschema:"title=Fields,description=Paths of the fields of the json payload identifying an event as dotted paths or JSON pointers (default: empty for the whole payload)"`
+	Memory uint64   `json:"memory" jsonschema:"title=Memory,description=Maximum memory in MiB of the hashes of the events of the window beyond which the oldest ones are forgotten (default: 16)"`
+	State  string   `json:"state" jsonschema:"title=State,description=Path of a file where the hashes of the window are saved when the event stream is closed and restored from when it is opened again (default: empty for disabled)"`
+}
+
+// Reset sets the configuration to its default values
+func (c *Config) Reset() {
+	*c = Config{Memory: 16}
+}
+
+type key [16]byte
+
+type entry struct {
+	key  key
+	seen int64 // time in nanoseconds
+}
+
+// Filter drops the duplicate events. A nil Filter, returned by New when the
+// de-duplication is disabled, drops nothing. A Filter can be used
+// concurrently.
+type Filter struct {
+	window time.Duration
+	paths  []jsoncache.Path
+	max    int
+	state  string
+
+	mu      sync.Mutex
+	parser  fastjson.Parser
+	buf     []byte
+	seen    map[key]int64
+	queue   []entry // in the order the hashes were seen
+	head    int
+	dropped uint64
+}
+
+// New returns the Filter configured by c, or nil if the de-duplication is
+// disabled. The hashes saved in the state file, if any, are restored.
+func New(c Config) (*Filter, error) {
+	if c.Window == 0 {
+		return nil, nil
+	}
+	if c.Memory == 0 {
+		return nil, errors.New("the memory of the de-duplication must be greater than 0")
+	}
+	f := &Filter{
+		window: time.Duration(c.Window) * time.Second,
+		max:    int(c.Memory << 20 / entrySize),
+		state:  c.State,
+		seen:   make(map[key]int64),
+	}
+	for _, p := range c.Fields {
+		if p == "" {
+			return nil, errors.New("empty de-duplication field")
+		}
+		f.paths = append(f.paths, jsoncache.CompilePath(p))
+	}
+	if f.state != "" {
+		if err := f.load(); err != nil {
+			return nil, fmt.Errorf("can't restore de-duplication state: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// Seen reports whether an event with the same hash as the payload was seen
+// within the window, and records it otherwise. A payload that is not JSON,
+// or that has none of the fields, can't be identified and is never a
+// duplicate.
+func (f *Filter) Seen(payload []byte) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	k, ok := f.hash(payload)
+	if !ok {
+		return false
+	}
+	now := time.Now().UnixNano()
+	f.expire(now)
+	if _, ok := f.seen[k]; ok {
+		f.dropped++
+		return true
+	}
+	f.add(entry{key: k, seen: now})
+	return false
+}
+
+// Dropped returns the number of duplicates reported by Seen
+func (f *Filter) Dropped() uint64 {
+	if f == nil {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.dropped
+}
+
+// Len returns the number of hashes in the window
+func (f *Filter) Len() int {
+	if f == nil {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.seen)
+}
+
+// Close saves the hashes of the window in the state file, if any
+func (f *Filter) Close() error {
+	if f == nil || f.state == "" {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expire(time.Now().UnixNano())
+	return f.save()
+}
+
+// hash returns the hash identifying a payload
+func (f *Filter) hash(payload []byte) (key, bool) {
+	var k key
+	h := fnv.New128a()
+	if len(f.paths) == 0 {
+		h.Write(payload)
+		copy(k[:], h.Sum(nil))
+		return k, true
+	}
+
+	v, err := f.parser.ParseBytes(payload)
+	if err != nil {
+		return k, false
+	}
+	found := false
+	for _, p := range f.paths {
+		// the values are separated, so that moving a value from a
+		// field to the next one changes the hash
+		f.buf = f.buf[:0]
+		if field := p.Get(v); field != nil {
+			found = true
+			f.buf = field.MarshalTo(f.buf)
+		}
+		f.buf = append(f.buf, 0)
+		h.Write(f.buf)
+	}
+	if !found {
+		return k, false
+	}
+	copy(k[:], h.Sum(nil))
+	return k, true
+}
+
+// add records a hash, forgetting the oldest ones beyond the memory budget
+func (f *Filter) add(e entry) {
+	for len(f.seen) >= f.max {
+		f.pop()
+	}
+	f.seen[e.key] = e.seen
+	f.queue = append(f.queue, e)
+}
+
+// expire forgets the hashes seen before the window
+func (f *Filter) expire(now int64) {
+	limit := now - int64(f.window)
+	for f.head < len(f.queue) && f.queue[f.head].seen <= limit {
+		f.pop()
+	}
+}
+
+// pop forgets the oldest hash
+func (f *Filter) pop() {
+	e := f.queue[f.head]
+	f.queue[f.head] = entry{}
+	f.head++
+	delete(f.seen, e.key)
+
+	// the queue is compacted once half of it is consumed, so that its
+	// backing array doesn't grow forever
+	if f.head > len(f.queue)/2 {
+		n := copy(f.queue, f.queue[f.head:])
+		f.queue = f.queue[:n]
+		f.head = 0
+	}
+}
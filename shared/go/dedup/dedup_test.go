@@ -0,0 +1,236 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dedup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newFilter(t *testing.T, c Config) *Filter {
+	if c.Memory == 0 {
+		c.Memory = 16
+	}
+	f, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestDisabled(t *testing.T) {
+	f := newFilter(t, Config{})
+	if f != nil {
+		t.Fatal("expected a nil filter without a window")
+	}
+	if f.Seen([]byte("a")) || f.Seen([]byte("a")) || f.Dropped() != 0 || f.Len() != 0 || f.Close() != nil {
+		t.Error("expected a nil filter to drop nothing")
+	}
+
+	if _, err := New(Config{Window: 1}); err == nil {
+		t.Error("expected an error without memory")
+	}
+	if _, err := New(Config{Window: 1, Memory: 1, Fields: []string{""}}); err == nil {
+		t.Error("expected an error for an empty field")
+	}
+}
+
+func TestSeen(t *testing.T) {
+	f := newFilter(t, Config{Window: 60})
+	if f.Seen([]byte(`{"id": 1}`)) {
+		t.Error("expected the first event to be new")
+	}
+	if !f.Seen([]byte(`{"id": 1}`)) {
+		t.Error("expected the second event to be a duplicate")
+	}
+	if f.Seen([]byte(`{"id": 1} `)) {
+		t.Error("expected a different payload to be new")
+	}
+	if f.Dropped() != 1 || f.Len() != 2 {
+		t.Errorf("expected 1 dropped and 2 hashes, got %d and %d", f.Dropped(), f.Len())
+	}
+}
+
+func TestFields(t *testing.T) {
+	f := newFilter(t, Config{Window: 60, Fields: []string{"user.id", "/uuid"}})
+	tests := []struct {
+		payload string
+		seen    bool
+	}{
+		{`{"user": {"id": 1}, "uuid": "a", "other": 1}`, false},
+		// the other fields don't identify the event
+		{`{"user": {"id": 1}, "uuid": "a", "other": 2}`, true},
+		{`{"uuid": "a", "user": {"id": 1}}`, true},
+		{`{"user": {"id": 2}, "uuid": "a"}`, false},
+		// a field alone identifies the events too
+		{`{"uuid": "b"}`, false},
+		{`{"uuid": "b", "other": 1}`, true},
+		// moving a value to another field changes the hash
+		{`{"user": {"id": "b"}}`, false},
+		// the events that can't be identified are never duplicates
+		{`{"other": 1}`, false},
+		{`{"other": 1}`, false},
+		{`not json`, false},
+		{`not json`, false},
+	}
+	for _, test := range tests {
+		if seen := f.Seen([]byte(test.payload)); seen != test.seen {
+			t.Errorf("%s: expected seen %v, got %v", test.payload, test.seen, seen)
+		}
+	}
+}
+
+// age moves the hashes of a filter into the past
+func age(f *Filter, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := f.head; i < len(f.queue); i++ {
+		f.queue[i].seen -= int64(d)
+		f.seen[f.queue[i].key] = f.queue[i].seen
+	}
+}
+
+func TestWindowExpiry(t *testing.T) {
+	f := newFilter(t, Config{Window: 60})
+	f.Seen([]byte("a"))
+	age(f, 30*time.Second)
+	f.Seen([]byte("b"))
+	if !f.Seen([]byte("a")) || !f.Seen([]byte("b")) {
+		t.Fatal("expected the events of the window to be duplicates")
+	}
+
+	// only the hashes seen before the window are forgotten
+	age(f, 31*time.Second)
+	if f.Seen([]byte("a")) {
+		t.Error("expected the event seen before the window to be new")
+	}
+	if !f.Seen([]byte("b")) {
+		t.Error("expected the event of the window to be a duplicate")
+	}
+	if f.Len() != 2 {
+		t.Errorf("expected 2 hashes, got %d", f.Len())
+	}
+}
+
+func TestMemoryEviction(t *testing.T) {
+	f := newFilter(t, Config{Window: 60, Memory: 1})
+	max := 1 << 20 / entrySize
+	for i := 0; i < max+10; i++ {
+		f.Seen([]byte(fmt.Sprint(i)))
+	}
+	if f.Len() != max {
+		t.Fatalf("expected %d hashes, got %d", max, f.Len())
+	}
+	// the oldest hashes are forgotten first
+	if !f.Seen([]byte(fmt.Sprint(max + 9))) {
+		t.Error("expected the last event to be a duplicate")
+	}
+	if f.Seen([]byte("0")) {
+		t.Error("expected the first event to be forgotten")
+	}
+	if len(f.queue) > 2*max {
+		t.Errorf("expected the queue to be compacted, got %d entries", len(f.queue))
+	}
+}
+
+func TestState(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "dedup.state")
+	f := newFilter(t, Config{Window: 60, State: state})
+	f.Seen([]byte("old"))
+	age(f, 61*time.Second)
+	f.Seen([]byte("a"))
+	f.Seen([]byte("b"))
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected a state file only readable by its owner, got %v", info.Mode())
+	}
+
+	// the hashes of the window are restored, in order
+	f = newFilter(t, Config{Window: 60, State: state})
+	if f.Len() != 2 {
+		t.Fatalf("expected 2 restored hashes, got %d", f.Len())
+	}
+	if !f.Seen([]byte("a")) || !f.Seen([]byte("b")) || f.Seen([]byte("old")) {
+		t.Error("expected the events of the window to be restored")
+	}
+
+	// the restored hashes still expire, and are bounded by the memory
+	age(f, 61*time.Second)
+	if f.Seen([]byte("a")) {
+		t.Error("expected the restored event to expire")
+	}
+}
+
+func TestStateErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	// a missing state file is an empty state
+	f := newFilter(t, Config{Window: 60, State: filepath.Join(dir, "missing")})
+	if f.Len() != 0 {
+		t.Errorf("expected no hash, got %d", f.Len())
+	}
+
+	invalid := filepath.Join(dir, "invalid")
+	if err := ioutil.WriteFile(invalid, []byte("not a state"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Config{Window: 60, Memory: 1, State: invalid}); err == nil {
+		t.Error("expected an error for an invalid state file")
+	}
+
+	truncated := filepath.Join(dir, "truncated")
+	if err := ioutil.WriteFile(truncated, append(stateHeader, 1, 2, 3), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Config{Window: 60, Memory: 1, State: truncated}); err == nil {
+		t.Error("expected an error for a truncated state file")
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	f := newFilter(t, Config{Window: 60, Fields: []string{"id"}})
+	var wg sync.WaitGroup
+	var unique int64
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if !f.Seen([]byte(fmt.Sprintf(`{"id": %d}`, i))) {
+					atomic.AddInt64(&unique, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if unique != 1000 || f.Dropped() != 7000 {
+		t.Errorf("expected 1000 new events and 7000 duplicates, got %d and %d", unique, f.Dropped())
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/falcosecurity/plugins/shared/go/dedup
+
+go 1.16
+
+require (
+	github.com/falcosecurity/plugins/shared/go/jsoncache v0.0.0-00010101000000-000000000000
+	github.com/valyala/fastjson v1.6.4
+)
+
+replace github.com/falcosecurity/plugins/shared/go/jsoncache => ../jsoncache
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dedup
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateHeader starts the state files, followed by the hashes and the times
+// they were seen, in the order they were seen
+var stateHeader = []byte("falco-dedup-v1\n")
+
+// load restores the hashes of the state file that are still in the window.
+// A missing file is an empty state.
+func (f *Filter) load() error {
+	file, err := os.Open(f.state)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	header := make([]byte, len(stateHeader))
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header, stateHeader) {
+		return errors.New("invalid state file")
+	}
+	limit := time.Now().Add(-f.window).UnixNano()
+	var buf [len(key{}) + 8]byte
+	for {
+		if _, err := io.ReadFull(r, buf[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var e entry
+		copy(e.key[:], buf[:len(e.key)])
+		e.seen = int64(binary.BigEndian.Uint64(buf[len(e.key):]))
+		if _, ok := f.seen[e.key]; ok || e.seen <= limit {
+			continue
+		}
+		f.add(e)
+	}
+}
+
+// save writes the hashes of the window in the state file, atomically
+func (f *Filter) save() error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.state), filepath.Base(f.state)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	w.Write(stateHeader)
+	var buf [len(key{}) + 8]byte
+	for _, e := range f.queue[f.head:] {
+		copy(buf[:], e.key[:])
+		binary.BigEndian.PutUint64(buf[len(e.key):], uint64(e.seen))
+		w.Write(buf[:])
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.state)
+}
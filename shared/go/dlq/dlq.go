@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dlq provides the dead-letter sinks of the source plugins, to
+// which they route the records they can't parse instead of silently
+// discarding them or failing their whole batch. The records are kept along
+// with the reason of their rejection, so that they can be inspected and
+// replayed once the parser or the upstream is fixed.
+//
+// A sink is opened from a URI, usually taken from the init configuration of
+// the plugin: an absolute path appends the records as JSON lines to a local
+// file, s3://bucket/prefix uploads them in gzipped
+// JSON lines objects, and drop, or an empty URI, discards them. All of them
+// count the records, e.g. in the metrics of the plugin. The file:// scheme
+// is not used for the local files, since the plugins resolve it as a
+// reference to a secret in their configuration.
+package dlq
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// Record is a record routed to a dead-letter sink
+type Record struct {
+	// Time is when the record was rejected, now if zero
+	Time time.Time
+	// Source is where the record was read from, such as a file or an
+	// object, if known
+	Source string
+	// Reason is why the record was rejected
+	Reason string
+	// Data is the raw record
+	Data []byte
+}
+
+// entry is a record as written by the sinks. The data is kept as a string
+// if it's valid UTF-8, and encoded with base64 otherwise.
+type entry struct {
+	Time     time.Time `json:"time"`
+	Plugin   string    `json:"plugin"`
+	Source   string    `json:"source,omitempty"`
+	Reason   string    `json:"reason"`
+	Data     string    `json:"data"`
+	Encoding string    `json:"encoding,omitempty"`
+}
+
+func newEntry(plugin string, r *Record) *entry {
+	e := &entry{Time: r.Time, Plugin: plugin, Source: r.Source, Reason: r.Reason}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	if utf8.Valid(r.Data) {
+		e.Data = string(r.Data)
+	} else {
+		e.Data = base64.StdEncoding.EncodeToString(r.Data)
+		e.Encoding = "base64"
+	}
+	return e
+}
+
+// Sink is a dead-letter sink. Its methods can be called concurrently.
+type Sink interface {
+	// Write routes a record to the sink. The data of the record can be
+	// reused once it returns.
+	Write(r Record) error
+	// Close flushes the records and releases the sink
+	Close() error
+}
+
+// Counter counts the records written to a sink, it's implemented by
+// *metrics.Metrics
+type Counter interface {
+	DeadLetter()
+}
+
+// Options are the options of a sink
+type Options struct {
+	// Plugin is the name of the plugin writing the records
+	Plugin string
+	// Counter counts the records, if not nil
+	Counter Counter
+	// AWS is the configuration of the S3 client, the default one is
+	// loaded from the environment if nil
+	AWS *aws.Config
+	// Logf logs the errors of the sinks writing in the background, if
+	// not nil
+	Logf func(format string, v ...interface{})
+}
+
+// Open opens the sink at the given URI
+func Open(uri string, opts Options) (Sink, error) {
+	if opts.Logf == nil {
+		opts.Logf = func(format string, v ...interface{}) {}
+	}
+	if uri == "" || uri == "drop" {
+		return &dropSink{counter: opts.Counter}, nil
+	}
+	if strings.HasPrefix(uri, "/") {
+		return openFile(uri, opts)
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dead-letter sink: %w", err)
+	}
+	switch u.Scheme {
+	case "s3":
+		if opts.AWS == nil {
+			cfg, err := config.LoadDefaultConfig(context.Background())
+			if err != nil {
+				return nil, err
+			}
+			opts.AWS = &cfg
+		}
+		return openS3(u.Host, strings.Trim(u.Path, "/"), opts)
+	}
+	return nil, fmt.Errorf("unknown dead-letter sink: %s", uri)
+}
+
+// dropSink discards the records, only counting them
+type dropSink struct {
+	counter Counter
+}
+
+func (d *dropSink) Write(r Record) error {
+	if d.counter != nil {
+		d.counter.DeadLetter()
+	}
+	return nil
+}
+
+func (d *dropSink) Close() error {
+	return nil
+}
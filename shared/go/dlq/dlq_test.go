@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dlq
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+type counter int32
+
+func (c *counter) DeadLetter() {
+	atomic.AddInt32((*int32)(c), 1)
+}
+
+// readEntries decodes the JSON lines of the records written by a sink
+func readEntries(t *testing.T, r io.Reader) []entry {
+	var res []entry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid entry %s: %v", scanner.Text(), err)
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+var testRecords = []Record{
+	{Time: time.Date(2024, 1, 31, 12, 0, 0, 0, time.FixedZone("CET", 3600)), Source: "s3://bucket/a.json.gz", Reason: "invalid json", Data: []byte(`{"a":`)},
+	{Reason: "binary", Data: []byte{0xff, 0x00}},
+}
+
+// checkEntries checks the entries of testRecords
+func checkEntries(t *testing.T, entries []entry) {
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	e := entries[0]
+	if !e.Time.Equal(testRecords[0].Time) || e.Time.Location() != time.UTC || e.Plugin != "cloudtrail" || e.Source != testRecords[0].Source ||
+		e.Reason != "invalid json" || e.Data != `{"a":` || e.Encoding != "" {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	// the invalid UTF-8 data is encoded in base64, and the time defaults
+	// to now
+	e = entries[1]
+	if e.Data != "/wA=" || e.Encoding != "base64" || time.Since(e.Time) > time.Minute {
+		t.Errorf("unexpected entry %+v", e)
+	}
+}
+
+func TestDrop(t *testing.T) {
+	for _, uri := range []string{"", "drop"} {
+		var c counter
+		s, err := Open(uri, Options{Counter: &c})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Write(testRecords[0])
+		if err := s.Close(); err != nil || c != 1 {
+			t.Errorf("%q: expected a counted record, got %d (%v)", uri, c, err)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dlq.jsonl")
+	var c counter
+	for _, r := range testRecords {
+		// the file is appended to by each sink
+		s, err := Open(path, Options{Plugin: "cloudtrail", Counter: &c})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Write(r); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	checkEntries(t, readEntries(t, f))
+	if c != 2 {
+		t.Errorf("expected 2 counted records, got %d", c)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	for _, uri := range []string{"file:///tmp/dlq", "kafka://topic", "s3://", "/missing/dir/dlq.jsonl", "%zz"} {
+		if _, err := Open(uri, Options{AWS: &aws.Config{}}); err == nil {
+			t.Errorf("%s: expected an error", uri)
+		}
+	}
+}
+
+func TestS3(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		objects[r.URL.Path] = body
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	var c counter
+	cfg := &aws.Config{
+		Region:       "us-east-1",
+		Credentials:  aws.AnonymousCredentials{},
+		BaseEndpoint: aws.String(srv.URL),
+		HTTPClient:   srv.Client(),
+	}
+	s, err := Open("s3://bucket/dlq/", Options{Plugin: "cloudtrail", Counter: &c, AWS: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range testRecords {
+		if err := s.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the records are uploaded at once on close, in an object named after
+	// the plugin and the time
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || c != 2 {
+		t.Fatalf("expected a single object of 2 records, got %d objects and %d records", len(objects), c)
+	}
+	key := regexp.MustCompile(`^/bucket/dlq/cloudtrail/\d{4}/\d{2}/\d{2}/\d{8}T\d{6}Z-[0-9a-f]{8}\.jsonl\.gz$`)
+	for name, data := range objects {
+		if !key.MatchString(name) {
+			t.Errorf("unexpected object name %s", name)
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEntries(t, readEntries(t, gz))
+	}
+
+	// the records above the flush size are uploaded right away
+	objects = map[string][]byte{}
+	s, _ = Open("s3://bucket", Options{Plugin: "cloudtrail", AWS: cfg})
+	data := []byte(strings.Repeat("x", 1024*1024))
+	for i := 0; i < 64; i++ {
+		// random data doesn't compress
+		rand.Read(data)
+		s.Write(Record{Reason: "large", Data: data})
+	}
+	sink := s.(*s3Sink)
+	sink.uploads.Wait()
+	mu.Lock()
+	n := len(objects)
+	mu.Unlock()
+	if n == 0 {
+		t.Error("expected an upload before close")
+	}
+	s.Close()
+}
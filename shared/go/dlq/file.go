@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dlq
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// fileSink appends the records to a local file as JSON lines. The file is
+// opened in append mode, so that it can be rotated by truncation.
+type fileSink struct {
+	mu      sync.Mutex
+	file    *os.File
+	plugin  string
+	counter Counter
+}
+
+func openFile(path string, opts Options) (*fileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{file: f, plugin: opts.Plugin, counter: opts.Counter}, nil
+}
+
+func (f *fileSink) Write(r Record) error {
+	line, err := json.Marshal(newEntry(f.plugin, &r))
+	if err != nil {
+		return err
+	}
+	if f.counter != nil {
+		f.counter.DeadLetter()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err = f.file.Write(append(line, '\n'))
+	return err
+}
+
+func (f *fileSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,156 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dlq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// S3FlushInterval is the longest the records wait before being
+	// uploaded to S3
+	S3FlushInterval = time.Minute
+	// S3FlushSize is the size of the compressed records above which
+	// they are uploaded at once
+	S3FlushSize = 4 * 1024 * 1024
+)
+
+// s3Sink uploads the records to S3 in gzipped JSON lines objects, named
+// after the plugin and the time of their upload, e.g.
+// prefix/cloudtrail/2024/01/31/20240131T120000Z-1a2b3c4d.jsonl.gz
+type s3Sink struct {
+	client  *s3.Client
+	bucket  string
+	prefix  string
+	opts    Options
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	gz      *gzip.Writer
+	count   int
+	stop    chan struct{}
+	done    chan struct{}
+	uploads sync.WaitGroup
+}
+
+func openS3(bucket, prefix string, opts Options) (*s3Sink, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("invalid dead-letter sink: no S3 bucket")
+	}
+	s := &s3Sink{
+		client: s3.NewFromConfig(opts.AWS.Copy()),
+		bucket: bucket,
+		prefix: prefix,
+		opts:   opts,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	s.gz = gzip.NewWriter(&s.buf)
+	go s.run()
+	return s, nil
+}
+
+func (s *s3Sink) Write(r Record) error {
+	line, err := json.Marshal(newEntry(s.opts.Plugin, &r))
+	if err != nil {
+		return err
+	}
+	if s.opts.Counter != nil {
+		s.opts.Counter.DeadLetter()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err = s.gz.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.count++
+	if s.buf.Len() >= S3FlushSize {
+		s.flush()
+	}
+	return nil
+}
+
+func (s *s3Sink) Close() error {
+	close(s.stop)
+	<-s.done
+	s.mu.Lock()
+	s.flush()
+	s.mu.Unlock()
+	s.uploads.Wait()
+	return nil
+}
+
+func (s *s3Sink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(S3FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.flush()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// flush uploads the buffered records in the background, if any. It must
+// be called with the lock held.
+func (s *s3Sink) flush() {
+	if s.count == 0 {
+		return
+	}
+	if err := s.gz.Close(); err != nil {
+		s.opts.Logf("can't compress the dead letters: %s", err.Error())
+	}
+	data := append([]byte(nil), s.buf.Bytes()...)
+	count := s.count
+	s.buf.Reset()
+	s.gz.Reset(&s.buf)
+	s.count = 0
+
+	now := time.Now().UTC()
+	key := path.Join(s.prefix, s.opts.Plugin, now.Format("2006/01/02"),
+		fmt.Sprintf("%s-%08x.jsonl.gz", now.Format("20060102T150405Z"), rand.Uint32()))
+	s.uploads.Add(1)
+	go func() {
+		defer s.uploads.Done()
+		_, err := s.client.PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket:          aws.String(s.bucket),
+			Key:             aws.String(key),
+			Body:            bytes.NewReader(data),
+			ContentType:     aws.String("application/x-ndjson"),
+			ContentEncoding: aws.String("gzip"),
+		})
+		if err != nil {
+			s.opts.Logf("can't upload %d dead letters to s3://%s/%s: %s", count, s.bucket, key, err.Error())
+		}
+	}()
+}
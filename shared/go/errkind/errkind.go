@@ -0,0 +1,174 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package errkind provides the taxonomy of the errors of the plugins, so
+// that the operators can tell apart the errors on their side, such as an
+// invalid token or configuration, from the ones of the upstream of the
+// plugins, such as an outage or a rate limiting.
+//
+// The plugins categorize the errors returned when opening their instances or
+// reading their events, and the ones they log and skip, by wrapping them
+// with New or Count. The message of a categorized error starts with its
+// category, e.g. "auth failure: 401 Unauthorized", and Count records it in
+// the categorized error counters of the metrics of the plugin.
+package errkind
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+// Kind is the category of an error
+type Kind string
+
+const (
+	// Auth is an authentication or authorization failure, e.g. an invalid
+	// or expired token, or an invalid webhook signature
+	Auth Kind = "auth"
+	// RateLimited is a rejection of the upstream because of a rate
+	// limiting or an exhausted quota
+	RateLimited Kind = "rate_limited"
+	// Unavailable is an outage of the upstream, e.g. a network error or
+	// a server error
+	Unavailable Kind = "upstream_unavailable"
+	// Parse is an event or payload that can't be parsed
+	Parse Kind = "parse"
+	// Config is an invalid configuration of the plugin, e.g. a missing
+	// file or an unknown resource
+	Config Kind = "config"
+	// Unknown is an error that can't be categorized
+	Unknown Kind = "unknown"
+)
+
+// Kinds are all the categories of the errors
+var Kinds = []Kind{Auth, RateLimited, Unavailable, Parse, Config, Unknown}
+
+var descriptions = map[Kind]string{
+	Auth:        "auth failure",
+	RateLimited: "rate limited",
+	Unavailable: "upstream unavailable",
+	Parse:       "parse error",
+	Config:      "config error",
+	Unknown:     "error",
+}
+
+// String returns the description of the category used in the error messages
+func (k Kind) String() string {
+	if d, ok := descriptions[k]; ok {
+		return d
+	}
+	return string(k)
+}
+
+// Error is an error along with its category
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.String() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New returns err categorized with kind, or err itself if it's nil or
+// already categorized
+func New(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// Errorf returns an error categorized with kind, formatted like fmt.Errorf
+func Errorf(kind Kind, format string, a ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, a...)}
+}
+
+// FromStatus returns the category of an HTTP response status code
+func FromStatus(code int) Kind {
+	switch {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return Auth
+	case code == http.StatusTooManyRequests:
+		return RateLimited
+	case code >= 500:
+		return Unavailable
+	case code >= 400:
+		return Config
+	}
+	return Unknown
+}
+
+// Of returns the category of err. The errors that are not categorized
+// explicitly are categorized from their type when possible, e.g. the
+// network errors are reported as Unavailable, or as Unknown otherwise.
+func Of(err error) Kind {
+	var e *Error
+	var status interface{ StatusCode() int }
+	var httpStatus interface{ HTTPStatusCode() int }
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &e):
+		return e.Kind
+	case errors.As(err, &status):
+		return FromStatus(status.StatusCode())
+	case errors.As(err, &httpStatus):
+		return FromStatus(httpStatus.HTTPStatusCode())
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return Parse
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return Unavailable
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, os.ErrPermission):
+		return Config
+	}
+	return Unknown
+}
+
+// Counter records the categorized errors, e.g. the metrics of a plugin
+type Counter interface {
+	Failure(kind string)
+}
+
+// Count categorizes err with Of, records it in c, and returns the
+// categorized error, or nil if err is nil
+func Count(err error, c Counter) error {
+	if err == nil {
+		return nil
+	}
+	kind := Of(err)
+	if c != nil {
+		c.Failure(string(kind))
+	}
+	return New(kind, err)
+}
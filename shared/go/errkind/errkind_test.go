@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package errkind
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+)
+
+// statusError is an error with the status code of an HTTP response, like
+// the ones of the API clients
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status %d", e.code)
+}
+
+func (e *statusError) StatusCode() int {
+	return e.code
+}
+
+// httpStatusError is an error with the status code of an HTTP response,
+// like the ones of the AWS SDK
+type httpStatusError struct {
+	code int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("status %d", e.code)
+}
+
+func (e *httpStatusError) HTTPStatusCode() int {
+	return e.code
+}
+
+// testCounter records the categorized errors
+type testCounter map[string]int
+
+func (c testCounter) Failure(kind string) {
+	c[kind]++
+}
+
+func TestNew(t *testing.T) {
+	if New(Auth, nil) != nil {
+		t.Error("expected no error")
+	}
+	err := New(Auth, errors.New("invalid token"))
+	if err.Error() != "auth failure: invalid token" {
+		t.Errorf("unexpected message %s", err.Error())
+	}
+	if Of(err) != Auth {
+		t.Errorf("expected %s, got %s", Auth, Of(err))
+	}
+
+	// the categorized errors keep their category, even wrapped
+	wrapped := fmt.Errorf("open: %w", err)
+	if res := New(Config, wrapped); res != wrapped || Of(res) != Auth {
+		t.Errorf("expected the error to keep its category, got %v", res)
+	}
+	if !errors.Is(err, errors.Unwrap(err)) {
+		t.Error("expected the error to be unwrapped")
+	}
+
+	err = Errorf(Parse, "invalid event %d", 1)
+	if err.Error() != "parse error: invalid event 1" || Of(err) != Parse {
+		t.Errorf("unexpected error %v", err)
+	}
+	if s := Kind("other").String(); s != "other" {
+		t.Errorf("expected the name of the unknown kind, got %s", s)
+	}
+	for _, k := range Kinds {
+		if _, ok := descriptions[k]; !ok {
+			t.Errorf("expected a description of %s", k)
+		}
+	}
+}
+
+func TestFromStatus(t *testing.T) {
+	tests := map[int]Kind{
+		200: Unknown,
+		302: Unknown,
+		400: Config,
+		401: Auth,
+		403: Auth,
+		404: Config,
+		429: RateLimited,
+		500: Unavailable,
+		503: Unavailable,
+	}
+	for code, expected := range tests {
+		if k := FromStatus(code); k != expected {
+			t.Errorf("%d: expected %s, got %s", code, expected, k)
+		}
+	}
+}
+
+func TestOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected Kind
+	}{
+		{"nil", nil, ""},
+		{"categorized", New(RateLimited, errors.New("quota")), RateLimited},
+		{"status", fmt.Errorf("list: %w", &statusError{code: 401}), Auth},
+		{"http status", &httpStatusError{code: 503}, Unavailable},
+		{"json syntax", json.Unmarshal([]byte("{"), &struct{}{}), Parse},
+		{"json type", json.Unmarshal([]byte(`"a"`), new(int)), Parse},
+		{"deadline", fmt.Errorf("poll: %w", context.DeadlineExceeded), Unavailable},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("refused")}, Unavailable},
+		{"dns", &net.DNSError{Err: "no such host"}, Unavailable},
+		{"missing file", fmt.Errorf("open: %w", os.ErrNotExist), Config},
+		{"permission", os.ErrPermission, Config},
+		{"other", errors.New("other"), Unknown},
+		// the explicit category takes precedence over the type
+		{"categorized status", New(Config, &statusError{code: 500}), Config},
+	}
+	for _, test := range tests {
+		if k := Of(test.err); k != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, k)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	c := testCounter{}
+	if Count(nil, c) != nil || len(c) != 0 {
+		t.Errorf("expected no error to be counted, got %v", c)
+	}
+	err := Count(&statusError{code: 429}, c)
+	if Of(err) != RateLimited || err.Error() != "rate limited: status 429" {
+		t.Errorf("expected the error to be categorized, got %v", err)
+	}
+	Count(errors.New("other"), c)
+	Count(New(Auth, errors.New("token")), c)
+	expected := map[string]int{"rate_limited": 1, "unknown": 1, "auth": 1}
+	for k, n := range expected {
+		if c[k] != n {
+			t.Errorf("expected %d %s errors, got %d", n, k, c[k])
+		}
+	}
+
+	// the errors are categorized without counter
+	if err := Count(os.ErrNotExist, nil); Of(err) != Config {
+		t.Errorf("expected a config error, got %v", err)
+	}
+}
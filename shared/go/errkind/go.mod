@@ -0,0 +1,3 @@
+module github.com/falcosecurity/plugins/shared/go/errkind
+
+go 1.15
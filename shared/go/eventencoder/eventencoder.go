@@ -0,0 +1,360 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package eventencoder encodes the payloads of the events as typed records,
+// so that the source and the extractor of a plugin, and the test tooling,
+// agree on their wire format instead of each parsing ad-hoc strings. A
+// record is an ordered list of named values of the types string, int64,
+// uint64, float64, bool and []byte, encoded either as a msgpack map or as
+// the protobuf envelope of the proto package, with its keys as the JSON
+// pointers of its top-level members.
+//
+// The encoded record is framed with a header telling its format and its
+// length, so that any data can follow it in the payload, e.g. the random
+// padding of the benchmarks, and so that it's never mistaken for JSON:
+//
+//	0xfa 0x1c | format (1 byte) | length (uvarint) | record
+package eventencoder
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/falcosecurity/plugins/shared/go/proto"
+)
+
+// Format is the encoding of the records
+type Format byte
+
+const (
+	// MsgPack encodes the records as msgpack maps
+	MsgPack Format = 1
+	// Protobuf encodes the records with the protobuf envelope of the proto
+	// package. The uint64 values above math.MaxInt64 are encoded as
+	// decimal strings, since the envelope has no unsigned integers.
+	Protobuf Format = 2
+)
+
+// magic starts the frame of every record
+var magic = [2]byte{0xfa, 0x1c}
+
+var (
+	// ErrNotFramed is returned when decoding data that isn't a framed
+	// record
+	ErrNotFramed = errors.New("not a framed record")
+	errTruncated = errors.New("truncated record")
+)
+
+// ParseFormat returns the format of the given name: msgpack or protobuf
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "msgpack":
+		return MsgPack, nil
+	case "protobuf":
+		return Protobuf, nil
+	}
+	return 0, fmt.Errorf("unknown record format %q", name)
+}
+
+// String returns the name of the format
+func (f Format) String() string {
+	switch f {
+	case MsgPack:
+		return "msgpack"
+	case Protobuf:
+		return "protobuf"
+	}
+	return "Format(" + strconv.Itoa(int(f)) + ")"
+}
+
+// IsFramed returns true if data starts with the frame of a record
+func IsFramed(data []byte) bool {
+	return len(data) > 3 && data[0] == magic[0] && data[1] == magic[1]
+}
+
+// Encoder encodes records by appending their values one after the other.
+// It can be reused with Reset to save allocations.
+type Encoder struct {
+	format Format
+	count  int
+	body   []byte
+	pb     proto.Builder
+}
+
+// NewEncoder returns an Encoder of the given format
+func NewEncoder(f Format) (*Encoder, error) {
+	if f != MsgPack && f != Protobuf {
+		return nil, fmt.Errorf("unknown record format %d", f)
+	}
+	return &Encoder{format: f}, nil
+}
+
+// Reset drops the values appended so far, keeping the allocated memory
+func (e *Encoder) Reset() {
+	e.count = 0
+	e.body = e.body[:0]
+	e.pb.Reset()
+}
+
+// String appends a string value
+func (e *Encoder) String(key, v string) {
+	e.count++
+	if e.format == Protobuf {
+		e.pb.String(proto.Pointer(key), v)
+		return
+	}
+	e.body = appendMsgpackString(appendMsgpackString(e.body, key), v)
+}
+
+// Int appends a signed integer value
+func (e *Encoder) Int(key string, v int64) {
+	e.count++
+	if e.format == Protobuf {
+		e.pb.Int(proto.Pointer(key), v)
+		return
+	}
+	e.body = appendMsgpackInt(appendMsgpackString(e.body, key), v)
+}
+
+// Uint appends an unsigned integer value
+func (e *Encoder) Uint(key string, v uint64) {
+	e.count++
+	if e.format == Protobuf {
+		if v > math.MaxInt64 {
+			e.pb.String(proto.Pointer(key), strconv.FormatUint(v, 10))
+			return
+		}
+		e.pb.Int(proto.Pointer(key), int64(v))
+		return
+	}
+	e.body = appendMsgpackUint(appendMsgpackString(e.body, key), v)
+}
+
+// Float appends a floating point value
+func (e *Encoder) Float(key string, v float64) {
+	e.count++
+	if e.format == Protobuf {
+		e.pb.Double(proto.Pointer(key), v)
+		return
+	}
+	e.body = appendMsgpackFloat(appendMsgpackString(e.body, key), v)
+}
+
+// Bool appends a bool value
+func (e *Encoder) Bool(key string, v bool) {
+	e.count++
+	if e.format == Protobuf {
+		e.pb.Bool(proto.Pointer(key), v)
+		return
+	}
+	e.body = appendMsgpackBool(appendMsgpackString(e.body, key), v)
+}
+
+// Bytes appends a binary value
+func (e *Encoder) Bytes(key string, v []byte) {
+	e.count++
+	if e.format == Protobuf {
+		e.pb.Binary(proto.Pointer(key), v)
+		return
+	}
+	e.body = appendMsgpackBinary(appendMsgpackString(e.body, key), v)
+}
+
+// AppendTo appends the framed record to dst
+func (e *Encoder) AppendTo(dst []byte) []byte {
+	var record []byte
+	var mapHeader []byte
+	if e.format == Protobuf {
+		record = e.pb.Bytes()
+	} else {
+		var b [5]byte
+		mapHeader = appendMsgpackMapHeader(b[:0], e.count)
+		record = e.body
+	}
+	dst = append(dst, magic[0], magic[1], byte(e.format))
+	var n [binary.MaxVarintLen64]byte
+	dst = append(dst, n[:binary.PutUvarint(n[:], uint64(len(mapHeader)+len(record)))]...)
+	dst = append(dst, mapHeader...)
+	return append(dst, record...)
+}
+
+// Field is a value of a record
+type Field struct {
+	Key string
+	// Value is a string, an int64, a uint64, a float64, a bool or a
+	// []byte, or nil for the msgpack nil
+	Value interface{}
+}
+
+// Record is a decoded record
+type Record struct {
+	Format Format
+	Fields []Field
+}
+
+// Decode decodes the framed record at the beginning of data, and returns
+// it along with the data following it. The strings and the binary values
+// of the record are copied, so data can be reused.
+func Decode(data []byte) (*Record, []byte, error) {
+	if !IsFramed(data) {
+		return nil, data, ErrNotFramed
+	}
+	format := Format(data[2])
+	size, n := binary.Uvarint(data[3:])
+	if n <= 0 || uint64(len(data)-3-n) < size {
+		return nil, data, errTruncated
+	}
+	body, rest := data[3+n:3+n+int(size)], data[3+n+int(size):]
+
+	res := &Record{Format: format}
+	var err error
+	switch format {
+	case MsgPack:
+		res.Fields, err = decodeMsgpackMap(body)
+	case Protobuf:
+		res.Fields, err = decodeProtobuf(body)
+	default:
+		err = fmt.Errorf("unknown record format %d", format)
+	}
+	if err != nil {
+		return nil, data, err
+	}
+	return res, rest, nil
+}
+
+// decodeProtobuf decodes the fields of a record encoded with the protobuf
+// envelope, whose keys are JSON pointers
+func decodeProtobuf(body []byte) ([]Field, error) {
+	var evt proto.Event
+	if err := evt.Unmarshal(body); err != nil {
+		return nil, err
+	}
+	var res []Field
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	for _, attr := range evt.Attributes() {
+		f := Field{Key: unescape.Replace(strings.TrimPrefix(attr.Key(), "/"))}
+		switch attr.Value.Kind() {
+		case proto.KindInt:
+			f.Value, _ = attr.Value.Int()
+		case proto.KindDouble:
+			f.Value, _ = attr.Value.Double()
+		case proto.KindBool:
+			f.Value, _ = attr.Value.Bool()
+		case proto.KindBytes:
+			raw, _ := attr.Value.Raw()
+			f.Value = append([]byte(nil), raw...)
+		default:
+			f.Value = attr.Value.String()
+		}
+		res = append(res, f)
+	}
+	return res, nil
+}
+
+// Get returns the value of the first field with the given key
+func (r *Record) Get(key string) (interface{}, bool) {
+	for _, f := range r.Fields {
+		if f.Key == key {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Uint returns the value of an unsigned integer field, or of a signed
+// integer or decimal string field holding an unsigned integer, as they
+// are written by the encoders of the other languages
+func (r *Record) Uint(key string) (uint64, bool) {
+	v, _ := r.Get(key)
+	switch v := v.(type) {
+	case uint64:
+		return v, true
+	case int64:
+		return uint64(v), v >= 0
+	case string:
+		n, err := strconv.ParseUint(v, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// Int returns the value of a signed integer field, or of an unsigned one
+// within its range
+func (r *Record) Int(key string) (int64, bool) {
+	v, _ := r.Get(key)
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	}
+	return 0, false
+}
+
+// String returns the value of a string field
+func (r *Record) String(key string) (string, bool) {
+	v, ok := r.Get(key)
+	s, isString := v.(string)
+	return s, ok && isString
+}
+
+// Float returns the value of a floating point field
+func (r *Record) Float(key string) (float64, bool) {
+	v, ok := r.Get(key)
+	f, isFloat := v.(float64)
+	return f, ok && isFloat
+}
+
+// Bool returns the value of a bool field
+func (r *Record) Bool(key string) (bool, bool) {
+	v, ok := r.Get(key)
+	b, isBool := v.(bool)
+	return b, ok && isBool
+}
+
+// Bytes returns the value of a binary field
+func (r *Record) Bytes(key string) ([]byte, bool) {
+	v, ok := r.Get(key)
+	b, isBytes := v.([]byte)
+	return b, ok && isBytes
+}
+
+// AppendJSON appends the JSON object of the fields of the record to dst,
+// with the binary values in base64 like encoding/json
+func (r *Record) AppendJSON(dst []byte) []byte {
+	dst = append(dst, '{')
+	for i, f := range r.Fields {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		key, _ := json.Marshal(f.Key)
+		dst = append(dst, key...)
+		dst = append(dst, ':')
+		v := f.Value
+		if fv, ok := v.(float64); ok && (math.IsNaN(fv) || math.IsInf(fv, 0)) {
+			v = strconv.FormatFloat(fv, 'g', -1, 64)
+		}
+		value, _ := json.Marshal(v)
+		dst = append(dst, value...)
+	}
+	return append(dst, '}')
+}
@@ -0,0 +1,333 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eventencoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/falcosecurity/plugins/shared/go/proto"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// testFields are values of all the types, in all the sizes of their msgpack
+// representations
+var testFields = []Field{
+	{"s", "x"},
+	{"empty", ""},
+	{"s31", strings.Repeat("a", 31)},
+	{"s255", strings.Repeat("b", 255)},
+	{"s65535", strings.Repeat("c", 65535)},
+	{"s65536", strings.Repeat("d", 65536)},
+	{"i0", int64(-1)},
+	{"i-32", int64(-32)},
+	{"i-33", int64(-33)},
+	{"i-128", int64(math.MinInt8)},
+	{"i-32768", int64(math.MinInt16)},
+	{"i-2147483648", int64(math.MinInt32)},
+	{"imin", int64(math.MinInt64)},
+	{"u0", uint64(0)},
+	{"u127", uint64(127)},
+	{"u255", uint64(255)},
+	{"u65535", uint64(65535)},
+	{"u4294967295", uint64(math.MaxUint32)},
+	{"umax", uint64(math.MaxUint64)},
+	{"f", 1.5},
+	{"fneg", -0.25},
+	{"t", true},
+	{"false", false},
+	{"b", []byte{0, 1, 0xff}},
+	{"b0", []byte{}},
+	{"b256", bytes.Repeat([]byte{1}, 256)},
+	{"b65536", bytes.Repeat([]byte{2}, 65536)},
+}
+
+// encode encodes the fields with an encoder of the given format
+func encode(t *testing.T, f Format, fields []Field) []byte {
+	e, err := NewEncoder(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range fields {
+		switch v := field.Value.(type) {
+		case string:
+			e.String(field.Key, v)
+		case int64:
+			e.Int(field.Key, v)
+		case uint64:
+			e.Uint(field.Key, v)
+		case float64:
+			e.Float(field.Key, v)
+		case bool:
+			e.Bool(field.Key, v)
+		case []byte:
+			e.Bytes(field.Key, v)
+		default:
+			t.Fatalf("unexpected value %v", v)
+		}
+	}
+	return e.AppendTo(nil)
+}
+
+// unframe returns the record of a frame
+func unframe(t *testing.T, data []byte, f Format) []byte {
+	if !IsFramed(data) || Format(data[2]) != f {
+		t.Fatalf("expected a frame of format %s", f)
+	}
+	size, n := binary.Uvarint(data[3:])
+	if int(size) != len(data)-3-n {
+		t.Fatalf("expected a record of %d bytes, got %d", len(data)-3-n, size)
+	}
+	return data[3+n:]
+}
+
+// normalize returns the value of a field as decoded by the reference
+// implementation of msgpack, which decodes the positive integers as
+// unsigned and the others as signed
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int8, int16, int32, int64:
+		n := reflect.ValueOf(v).Int()
+		if n >= 0 {
+			return uint64(n)
+		}
+		return n
+	case uint8, uint16, uint32, uint64:
+		return reflect.ValueOf(v).Uint()
+	case float32:
+		return float64(v)
+	case int:
+		return normalize(int64(v))
+	}
+	return v
+}
+
+func TestMsgpackReference(t *testing.T) {
+	record := unframe(t, encode(t, MsgPack, testFields), MsgPack)
+
+	// the record is decoded by the reference implementation as a map in
+	// the encoding order
+	dec := msgpack.NewDecoder(bytes.NewReader(record))
+	n, err := dec.DecodeMapLen()
+	if err != nil || n != len(testFields) {
+		t.Fatalf("expected a map of %d fields, got %d (%v)", len(testFields), n, err)
+	}
+	for _, f := range testFields {
+		key, err := dec.DecodeString()
+		if err != nil || key != f.Key {
+			t.Fatalf("expected the key %s, got %s (%v)", f.Key, key, err)
+		}
+		v, err := dec.DecodeInterface()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := normalize(f.Value); !reflect.DeepEqual(normalize(v), expected) {
+			t.Errorf("%s: expected %v, got %v", f.Key, expected, v)
+		}
+	}
+
+	// and the encoding of the reference implementation, which uses other
+	// representations for some values, is decoded the same way
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseCompactInts(false)
+	enc.UseCompactFloats(true)
+	enc.EncodeMapLen(7)
+	enc.EncodeString("i")
+	enc.EncodeInt64(-5)
+	enc.EncodeString("u")
+	enc.EncodeUint64(7)
+	enc.EncodeString("f32")
+	enc.EncodeFloat32(0.5)
+	enc.EncodeString("f64")
+	enc.EncodeFloat64(0.1)
+	enc.EncodeString("nil")
+	enc.EncodeNil()
+	enc.EncodeString(strings.Repeat("k", 40))
+	enc.EncodeString(strings.Repeat("v", 300))
+	enc.EncodeString("b")
+	enc.EncodeBytes([]byte("bin"))
+	fields, err := decodeMsgpackMap(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Field{
+		{"i", int64(-5)},
+		{"u", uint64(7)},
+		{"f32", 0.5},
+		{"f64", 0.1},
+		{"nil", nil},
+		{strings.Repeat("k", 40), strings.Repeat("v", 300)},
+		{"b", []byte("bin")},
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected %v, got %v", expected, fields)
+	}
+
+	// with the map headers of all the sizes
+	for _, n := range []int{15, 16, 65536} {
+		buf.Reset()
+		enc.EncodeMapLen(n)
+		for i := 0; i < n; i++ {
+			enc.EncodeString("k")
+			enc.EncodeBool(true)
+		}
+		if fields, err := decodeMsgpackMap(buf.Bytes()); err != nil || len(fields) != n {
+			t.Errorf("expected %d fields, got %d (%v)", n, len(fields), err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, f := range []Format{MsgPack, Protobuf} {
+		data := encode(t, f, testFields)
+		r, rest, err := Decode(append(data, "padding"...))
+		if err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		if string(rest) != "padding" || r.Format != f {
+			t.Errorf("%s: unexpected rest %q", f, rest)
+		}
+		for _, field := range testFields {
+			switch v := field.Value.(type) {
+			case string:
+				if res, ok := r.String(field.Key); !ok || res != v {
+					t.Errorf("%s: %s: expected %q, got %q", f, field.Key, v, res)
+				}
+			case int64:
+				if res, ok := r.Int(field.Key); !ok || res != v {
+					t.Errorf("%s: %s: expected %d, got %d", f, field.Key, v, res)
+				}
+			case uint64:
+				if res, ok := r.Uint(field.Key); !ok || res != v {
+					t.Errorf("%s: %s: expected %d, got %d", f, field.Key, v, res)
+				}
+			case float64:
+				if res, ok := r.Float(field.Key); !ok || res != v {
+					t.Errorf("%s: %s: expected %f, got %f", f, field.Key, v, res)
+				}
+			case bool:
+				if res, ok := r.Bool(field.Key); !ok || res != v {
+					t.Errorf("%s: %s: expected %v, got %v", f, field.Key, v, res)
+				}
+			case []byte:
+				if res, ok := r.Bytes(field.Key); !ok || !bytes.Equal(res, v) {
+					t.Errorf("%s: %s: unexpected bytes", f, field.Key)
+				}
+			}
+		}
+		if _, ok := r.Get("missing"); ok {
+			t.Errorf("%s: expected no missing field", f)
+		}
+		if _, ok := r.Int("umax"); ok {
+			t.Errorf("%s: expected the max uint not to be an int", f)
+		}
+		if _, ok := r.Uint("i0"); ok {
+			t.Errorf("%s: expected a negative int not to be an uint", f)
+		}
+	}
+}
+
+func TestProtobufKeys(t *testing.T) {
+	// the keys are the JSON pointers of the top-level members in the
+	// protobuf envelope
+	data := encode(t, Protobuf, []Field{{"a/b~c", "x"}, {"n", uint64(math.MaxUint64)}})
+	var evt proto.Event
+	if err := evt.Unmarshal(unframe(t, data, Protobuf)); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := evt.Get("/a~1b~0c"); !ok || v.String() != "x" {
+		t.Errorf("expected the key as a JSON pointer, got %v", evt.Attributes())
+	}
+	// the uint64 values above the max int64 are decimal strings
+	if v, ok := evt.Get("/n"); !ok || v.Kind() != proto.KindString || v.String() != "18446744073709551615" {
+		t.Errorf("expected a decimal string, got %v", v)
+	}
+	r, _, err := Decode(data)
+	if err != nil || r.Fields[0].Key != "a/b~c" {
+		t.Errorf("expected the key unescaped, got %v (%v)", r, err)
+	}
+}
+
+func TestEncoderReset(t *testing.T) {
+	e, _ := NewEncoder(MsgPack)
+	e.String("a", "x")
+	e.Reset()
+	e.Int("b", 1)
+	r, _, err := Decode(e.AppendTo(nil))
+	if err != nil || len(r.Fields) != 1 || r.Fields[0].Key != "b" {
+		t.Errorf("expected a single field, got %v (%v)", r, err)
+	}
+	if _, err := NewEncoder(3); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	valid := encode(t, MsgPack, []Field{{"a", "x"}})
+	tests := map[string][]byte{
+		"json":          []byte(`{"a":"x"}`),
+		"truncated":     valid[:len(valid)-1],
+		"format":        {magic[0], magic[1], 3, 1, 0x80},
+		"not a map":     {magic[0], magic[1], byte(MsgPack), 1, 0x90},
+		"key":           {magic[0], magic[1], byte(MsgPack), 3, 0x81, 0x01, 0x01},
+		"type":          {magic[0], magic[1], byte(MsgPack), 4, 0x81, 0xa1, 'a', 0xc1},
+		"value":         {magic[0], magic[1], byte(MsgPack), 4, 0x81, 0xa1, 'a', 0xa2},
+		"count":         {magic[0], magic[1], byte(MsgPack), 5, 0xdf, 0xff, 0xff, 0xff, 0xff},
+		"protobuf":      {magic[0], magic[1], byte(Protobuf), 1, 0x7b},
+		"size":          {magic[0], magic[1], byte(MsgPack), 0xff},
+		"empty msgpack": {magic[0], magic[1], byte(MsgPack), 0, 0},
+	}
+	for name, data := range tests {
+		if _, rest, err := Decode(data); err == nil || !bytes.Equal(rest, data) {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, _, err := Decode([]byte(`{}`)); err != ErrNotFramed {
+		t.Errorf("expected ErrNotFramed, got %v", err)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for name, expected := range map[string]Format{"msgpack": MsgPack, "Protobuf": Protobuf} {
+		if f, err := ParseFormat(name); err != nil || f != expected {
+			t.Errorf("%s: expected %s, got %s (%v)", name, expected, f, err)
+		}
+	}
+	if _, err := ParseFormat("json"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if s := Format(9).String(); s != "Format(9)" {
+		t.Errorf("unexpected name %s", s)
+	}
+}
+
+func TestAppendJSON(t *testing.T) {
+	r := &Record{Fields: []Field{
+		{"s", "x\"y"}, {"i", int64(-1)}, {"u", uint64(2)}, {"f", 0.5}, {"nan", math.NaN()},
+		{"b", []byte{0xff}}, {"t", true}, {"nil", nil},
+	}}
+	expected := `{"s":"x\"y","i":-1,"u":2,"f":0.5,"nan":"NaN","b":"/w==","t":true,"nil":null}`
+	if res := string(r.AppendJSON(nil)); res != expected {
+		t.Errorf("expected %s, got %s", expected, res)
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/falcosecurity/plugins/shared/go/eventencoder
+
+go 1.15
+
+require (
+	github.com/falcosecurity/plugins/shared/go/proto v0.0.0-00010101000000-000000000000
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+)
+
+replace github.com/falcosecurity/plugins/shared/go/proto => ../proto
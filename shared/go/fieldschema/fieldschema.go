@@ -0,0 +1,290 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fieldschema generates the fields of an extractor plugin and the
+// dispatching of their extraction from an annotated struct, rather than
+// maintaining a list of sdk.FieldEntry and a switch on the field IDs that
+// must be kept in the same order.
+//
+// Each field of the plugin is a field of the struct tagged with its name,
+// and optionally with its description, display name, properties and the
+// requirement of its argument:
+//
+//	type fields struct {
+//		User  string                      `field:"foo.user" desc:"The user of the event" display:"User"`
+//		Tags  []string                    `field:"foo.tags" desc:"The tags of the event"`
+//		Label func(string) (string, bool) `field:"foo.label" arg:"required" desc:"The value of a label"`
+//	}
+//
+// The type of a field is given by the type of its struct field: string,
+// uint64, bool, time.Duration (reltime), time.Time (abstime) or net.IP
+// (ipaddr), a slice of them for the list fields, or a pointer to them for
+// the fields that have no value when it is nil. The struct field can also
+// be a function computing the value lazily, taking the argument of the
+// field if any, a string for the key arguments and an uint64 for the index
+// ones, and returning the value along with a bool or an error that tells
+// whether there is one, see ErrNoValue. A map keyed by a string or an
+// uint64 is a field with an argument too. The plugin fills the struct for
+// each event extracted and passes it to Schema.Extract.
+package fieldschema
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+)
+
+// ErrNoValue can be returned by the functions of the fields to leave them
+// without a value, like returning false
+var ErrNoValue = errors.New("no value")
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+	ipType       = reflect.TypeOf(net.IP{})
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// fieldTypes are the types of the fields, by the Go types of their values
+var fieldTypes = map[reflect.Type]string{
+	reflect.TypeOf(""):        "string",
+	reflect.TypeOf(uint64(0)): "uint64",
+	reflect.TypeOf(false):     "bool",
+	durationType:              "reltime",
+	timeType:                  "abstime",
+	ipType:                    "ipaddr",
+}
+
+// accessor is how the value of a field is read from the struct
+type accessor int
+
+const (
+	accessValue accessor = iota
+	accessPointer
+	accessMap
+	accessFunc
+)
+
+// field is a field of the schema
+type field struct {
+	index    int
+	name     string
+	access   accessor
+	arg      reflect.Type // type of the argument, if any
+	required bool
+	result   reflect.Type // type of the second result of the functions, if any
+}
+
+// Schema is the schema of the fields generated from a struct type
+type Schema struct {
+	typ     reflect.Type
+	entries []sdk.FieldEntry
+	fields  []field
+}
+
+// New returns the schema of the fields of the struct pointed to by v,
+// which is usually a nil pointer to the struct type, e.g. (*fields)(nil).
+// The struct fields without a field tag are ignored.
+func New(v interface{}) (*Schema, error) {
+	typ := reflect.TypeOf(v)
+	if typ == nil || typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("fieldschema: %v is not a pointer to a struct", typ)
+	}
+	typ = typ.Elem()
+	s := &Schema{typ: typ}
+	names := make(map[string]bool)
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		name := sf.Tag.Get("field")
+		if name == "" {
+			continue
+		}
+		if names[name] {
+			return nil, fmt.Errorf("fieldschema: duplicate field %s", name)
+		}
+		names[name] = true
+		f, entry, err := newField(sf)
+		if err != nil {
+			return nil, fmt.Errorf("fieldschema: field %s: %s", name, err.Error())
+		}
+		f.index = i
+		s.fields = append(s.fields, f)
+		s.entries = append(s.entries, entry)
+	}
+	return s, nil
+}
+
+// Must is like New but panics on errors, for the schemas declared as
+// package variables
+func Must(v interface{}) *Schema {
+	s, err := New(v)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// newField returns the field of a tagged struct field and its entry
+func newField(sf reflect.StructField) (field, sdk.FieldEntry, error) {
+	f := field{name: sf.Tag.Get("field")}
+	entry := sdk.FieldEntry{
+		Name:    f.name,
+		Desc:    sf.Tag.Get("desc"),
+		Display: sf.Tag.Get("display"),
+	}
+	if p := sf.Tag.Get("properties"); p != "" {
+		entry.Properties = strings.Split(p, ",")
+	}
+	switch arg := sf.Tag.Get("arg"); arg {
+	case "":
+	case "required":
+		f.required = true
+	default:
+		return f, entry, fmt.Errorf("unknown arg tag %q", arg)
+	}
+
+	typ := sf.Type
+	switch typ.Kind() {
+	case reflect.Func:
+		f.access = accessFunc
+		if typ.NumIn() > 1 || typ.NumOut() < 1 || typ.NumOut() > 2 || typ.IsVariadic() {
+			return f, entry, fmt.Errorf("unsupported function %v", typ)
+		}
+		if typ.NumIn() == 1 {
+			f.arg = typ.In(0)
+		}
+		if typ.NumOut() == 2 {
+			f.result = typ.Out(1)
+			if f.result.Kind() != reflect.Bool && f.result != errorType {
+				return f, entry, fmt.Errorf("unsupported function %v", typ)
+			}
+		}
+		typ = typ.Out(0)
+	case reflect.Map:
+		f.access = accessMap
+		f.arg = typ.Key()
+		typ = typ.Elem()
+	case reflect.Ptr:
+		f.access = accessPointer
+		typ = typ.Elem()
+	}
+
+	if f.arg != nil {
+		switch f.arg.Kind() {
+		case reflect.String:
+			entry.Arg.IsKey = true
+		case reflect.Uint64:
+			entry.Arg.IsIndex = true
+		default:
+			return f, entry, fmt.Errorf("unsupported argument type %v", f.arg)
+		}
+		entry.Arg.IsRequired = f.required
+	} else if f.required {
+		return f, entry, errors.New("required argument without argument type")
+	}
+
+	if typ != ipType && typ.Kind() == reflect.Slice {
+		entry.IsList = true
+		typ = typ.Elem()
+	}
+	var ok bool
+	if entry.Type, ok = fieldTypes[typ]; !ok {
+		return f, entry, fmt.Errorf("unsupported type %v", sf.Type)
+	}
+	return f, entry, nil
+}
+
+// Fields returns the fields of the schema, in the order of the struct
+func (s *Schema) Fields() []sdk.FieldEntry {
+	return s.entries
+}
+
+// Extract sets the value of the requested field from the struct pointed
+// to by v, which must be of the type of the schema. No value is set if the
+// field has none, such as a nil pointer or a missing map key.
+func (s *Schema) Extract(req sdk.ExtractRequest, v interface{}) error {
+	id := int(req.FieldID())
+	if id >= len(s.fields) {
+		return fmt.Errorf("no known field: %s", req.Field())
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Type().Elem() != s.typ || rv.IsNil() {
+		return fmt.Errorf("fieldschema: extracting %s from %T rather than *%v", req.Field(), v, s.typ)
+	}
+	f := &s.fields[id]
+	value, ok, err := f.value(req, rv.Elem().Field(f.index))
+	if err != nil || !ok {
+		return err
+	}
+	req.SetValue(value.Interface())
+	return nil
+}
+
+// value returns the value of the field in the struct field fv, and false
+// if it has none
+func (f *field) value(req sdk.ExtractRequest, fv reflect.Value) (reflect.Value, bool, error) {
+	var arg reflect.Value
+	if f.arg != nil {
+		if f.required && !req.ArgPresent() {
+			return arg, false, fmt.Errorf("'%s' field requires an argument, but no argument is provided", f.name)
+		}
+		if f.arg.Kind() == reflect.String {
+			arg = reflect.ValueOf(req.ArgKey()).Convert(f.arg)
+		} else {
+			arg = reflect.ValueOf(req.ArgIndex()).Convert(f.arg)
+		}
+	}
+
+	switch f.access {
+	case accessPointer:
+		if fv.IsNil() {
+			return fv, false, nil
+		}
+		return fv.Elem(), true, nil
+	case accessMap:
+		value := fv.MapIndex(arg)
+		return value, value.IsValid(), nil
+	case accessFunc:
+		if fv.IsNil() {
+			return fv, false, nil
+		}
+		var in []reflect.Value
+		if arg.IsValid() {
+			in = []reflect.Value{arg}
+		}
+		out := fv.Call(in)
+		if f.result == nil {
+			return out[0], true, nil
+		}
+		if f.result == errorType {
+			if err, _ := out[1].Interface().(error); err != nil {
+				if errors.Is(err, ErrNoValue) {
+					return out[0], false, nil
+				}
+				return out[0], false, err
+			}
+			return out[0], true, nil
+		}
+		return out[0], out[1].Bool(), nil
+	}
+	return fv, true, nil
+}
@@ -0,0 +1,263 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fieldschema
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+)
+
+type testExtractRequest struct {
+	fieldID    uint64
+	field      string
+	argKey     string
+	argIndex   uint64
+	argPresent bool
+	value      interface{}
+	set        bool
+}
+
+func (t *testExtractRequest) FieldID() uint64 {
+	return t.fieldID
+}
+
+func (t *testExtractRequest) FieldType() uint32 {
+	return 0
+}
+
+func (t *testExtractRequest) Field() string {
+	return t.field
+}
+
+func (t *testExtractRequest) ArgKey() string {
+	return t.argKey
+}
+
+func (t *testExtractRequest) ArgIndex() uint64 {
+	return t.argIndex
+}
+
+func (t *testExtractRequest) ArgPresent() bool {
+	return t.argPresent
+}
+
+func (t *testExtractRequest) IsList() bool {
+	return false
+}
+
+func (t *testExtractRequest) SetValue(v interface{}) {
+	t.value = v
+	t.set = true
+}
+
+func (t *testExtractRequest) SetPtr(unsafe.Pointer) {
+	// do nothing
+}
+
+type testFields struct {
+	User    string                       `field:"test.user" desc:"The user" display:"User" properties:"conversation,info"`
+	Count   uint64                       `field:"test.count" desc:"The count"`
+	Admin   bool                         `field:"test.admin" desc:"Whether the user is an admin"`
+	Latency time.Duration                `field:"test.latency" desc:"The latency"`
+	Time    time.Time                    `field:"test.time" desc:"The time"`
+	IP      net.IP                       `field:"test.ip" desc:"The IP"`
+	Tags    []string                     `field:"test.tags" desc:"The tags"`
+	IPs     []net.IP                     `field:"test.ips" desc:"The IPs"`
+	Org     *string                      `field:"test.org" desc:"The org"`
+	Labels  map[string]string            `field:"test.labels" arg:"required" desc:"The labels"`
+	Values  map[uint64]uint64            `field:"test.values" desc:"The values"`
+	Lazy    func() string                `field:"test.lazy" desc:"A lazy value"`
+	Label   func(string) (string, bool)  `field:"test.label" arg:"required" desc:"A lazy label"`
+	Index   func(uint64) (uint64, error) `field:"test.index" desc:"A lazy index"`
+	// the fields without tag are ignored
+	internal string
+}
+
+var testSchema = Must((*testFields)(nil))
+
+func TestFields(t *testing.T) {
+	expected := []sdk.FieldEntry{
+		{Type: "string", Name: "test.user", Desc: "The user", Display: "User", Properties: []string{"conversation", "info"}},
+		{Type: "uint64", Name: "test.count", Desc: "The count"},
+		{Type: "bool", Name: "test.admin", Desc: "Whether the user is an admin"},
+		{Type: "reltime", Name: "test.latency", Desc: "The latency"},
+		{Type: "abstime", Name: "test.time", Desc: "The time"},
+		{Type: "ipaddr", Name: "test.ip", Desc: "The IP"},
+		{Type: "string", Name: "test.tags", Desc: "The tags", IsList: true},
+		{Type: "ipaddr", Name: "test.ips", Desc: "The IPs", IsList: true},
+		{Type: "string", Name: "test.org", Desc: "The org"},
+		{Type: "string", Name: "test.labels", Desc: "The labels", Arg: sdk.FieldEntryArg{IsRequired: true, IsKey: true}},
+		{Type: "uint64", Name: "test.values", Desc: "The values", Arg: sdk.FieldEntryArg{IsIndex: true}},
+		{Type: "string", Name: "test.lazy", Desc: "A lazy value"},
+		{Type: "string", Name: "test.label", Desc: "A lazy label", Arg: sdk.FieldEntryArg{IsRequired: true, IsKey: true}},
+		{Type: "uint64", Name: "test.index", Desc: "A lazy index", Arg: sdk.FieldEntryArg{IsIndex: true}},
+	}
+	if fields := testSchema.Fields(); !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected %+v, got %+v", expected, fields)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	org := "falcosecurity"
+	now := time.Now()
+	v := &testFields{
+		User:    "alice",
+		Count:   3,
+		Admin:   true,
+		Latency: time.Second,
+		Time:    now,
+		IP:      net.ParseIP("10.0.0.1"),
+		Tags:    []string{"a", "b"},
+		Org:     &org,
+		Labels:  map[string]string{"env": "prod"},
+		Values:  map[uint64]uint64{1: 10},
+		Lazy:    func() string { return "lazy" },
+		Label: func(key string) (string, bool) {
+			return "label-" + key, key != "missing"
+		},
+		Index: func(i uint64) (uint64, error) {
+			if i == 0 {
+				return 0, ErrNoValue
+			}
+			return i * 2, nil
+		},
+	}
+	tests := []struct {
+		id       uint64
+		argKey   string
+		argIndex uint64
+		expected interface{}
+	}{
+		{0, "", 0, "alice"},
+		{1, "", 0, uint64(3)},
+		{2, "", 0, true},
+		{3, "", 0, time.Second},
+		{4, "", 0, now},
+		{5, "", 0, net.ParseIP("10.0.0.1")},
+		{6, "", 0, []string{"a", "b"}},
+		{7, "", 0, []net.IP(nil)},
+		{8, "", 0, "falcosecurity"},
+		{9, "env", 0, "prod"},
+		{9, "other", 0, nil},
+		{10, "", 1, uint64(10)},
+		{10, "", 2, nil},
+		{11, "", 0, "lazy"},
+		{12, "x", 0, "label-x"},
+		{12, "missing", 0, nil},
+		{13, "", 2, uint64(4)},
+		{13, "", 0, nil},
+	}
+	for _, test := range tests {
+		req := &testExtractRequest{fieldID: test.id, field: testSchema.Fields()[test.id].Name, argKey: test.argKey, argIndex: test.argIndex, argPresent: true}
+		if err := testSchema.Extract(req, v); err != nil {
+			t.Fatalf("%s: %v", req.field, err)
+		}
+		if test.expected == nil {
+			if req.set {
+				t.Errorf("%s(%s): expected no value, got %v", req.field, test.argKey, req.value)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(req.value, test.expected) {
+			t.Errorf("%s(%s): expected %v, got %v", req.field, test.argKey, test.expected, req.value)
+		}
+	}
+
+	// the nil pointers and functions have no value
+	for _, id := range []uint64{8, 11} {
+		req := &testExtractRequest{fieldID: id}
+		if err := testSchema.Extract(req, &testFields{}); err != nil || req.set {
+			t.Errorf("%d: expected no value, got %v (%v)", id, req.value, err)
+		}
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	v := &testFields{Index: func(uint64) (uint64, error) { return 0, errors.New("failed") }}
+	tests := []struct {
+		name string
+		req  *testExtractRequest
+		v    interface{}
+	}{
+		{"unknown field", &testExtractRequest{fieldID: 14}, v},
+		{"missing argument", &testExtractRequest{fieldID: 9}, v},
+		{"function error", &testExtractRequest{fieldID: 13, argPresent: true}, v},
+		{"wrong type", &testExtractRequest{fieldID: 0}, &struct{}{}},
+		{"not a pointer", &testExtractRequest{fieldID: 0}, testFields{}},
+		{"nil pointer", &testExtractRequest{fieldID: 0}, (*testFields)(nil)},
+	}
+	for _, test := range tests {
+		if err := testSchema.Extract(test.req, test.v); err == nil || test.req.set {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"not a pointer", testFields{}},
+		{"not a struct", new(string)},
+		{"nil", nil},
+		{"duplicate", (*struct {
+			A string `field:"a"`
+			B string `field:"a"`
+		})(nil)},
+		{"type", (*struct {
+			A int `field:"a"`
+		})(nil)},
+		{"arg tag", (*struct {
+			A map[string]string `field:"a" arg:"optional"`
+		})(nil)},
+		{"arg type", (*struct {
+			A map[int]string `field:"a"`
+		})(nil)},
+		{"required without arg", (*struct {
+			A string `field:"a" arg:"required"`
+		})(nil)},
+		{"function arguments", (*struct {
+			A func(string, string) string `field:"a"`
+		})(nil)},
+		{"function result", (*struct {
+			A func() (string, int) `field:"a"`
+		})(nil)},
+		{"function without result", (*struct {
+			A func() `field:"a"`
+		})(nil)},
+	}
+	for _, test := range tests {
+		if _, err := New(test.v); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected Must to panic")
+		}
+	}()
+	Must(nil)
+}
@@ -0,0 +1,205 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fuzz provides helpers for the native Go fuzz tests of the plugins.
+// The payloads received by the plugins come from upstream services and can
+// be malformed in any way, which must never make a plugin panic inside Falco:
+// errors are fine, panics are not. The fuzz tests run on their seed corpus
+// along with the other tests, and are fuzzed with:
+//
+//	go test ./pkg/<plugin> -run '^$' -fuzz FuzzExtract -fuzztime 1m
+package fuzz
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"unsafe"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+)
+
+// keyArgs and indexArgs are the arguments passed to the fields that accept
+// one, chosen to exercise the argument parsing of the plugins
+var (
+	keyArgs   = []string{"", "0", "a", "/", "/a/0", "/*/a", "~", "[", "a.b"}
+	indexArgs = []uint64{0, 1, 1 << 63}
+)
+
+// Extractor is a plugin supporting the field extraction capability
+type Extractor interface {
+	Fields() []sdk.FieldEntry
+	Extract(req sdk.ExtractRequest, evt sdk.EventReader) error
+}
+
+// AddDir adds each file of a directory to the seed corpus of a fuzz test
+// whose fuzz function takes a single []byte argument, e.g. the corpus of
+// the golden file tests. Files with the given extensions are skipped.
+func AddDir(f *testing.F, dir string, skipExts ...string) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		f.Fatal(err)
+	}
+files:
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		for _, ext := range skipExts {
+			if filepath.Ext(e.Name()) == ext {
+				continue files
+			}
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+}
+
+// Extract fuzzes the field extraction of a plugin. All its fields are
+// extracted from each input, with several arguments for the fields that
+// accept one.
+func Extract(f *testing.F, p Extractor) {
+	var reqs []*request
+	for id, e := range p.Fields() {
+		base := request{
+			fieldID:   uint64(id),
+			fieldType: fieldType(e.Type),
+			field:     e.Name,
+			isList:    e.IsList,
+		}
+		if !e.Arg.IsRequired {
+			req := base
+			reqs = append(reqs, &req)
+		}
+		if e.Arg.IsKey {
+			for _, arg := range keyArgs {
+				req := base
+				req.argKey = arg
+				req.argPresent = true
+				reqs = append(reqs, &req)
+			}
+		}
+		if e.Arg.IsIndex {
+			for _, arg := range indexArgs {
+				req := base
+				req.argIndex = arg
+				req.argPresent = true
+				reqs = append(reqs, &req)
+			}
+		}
+	}
+
+	var num uint64
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// each input is a new event, so that the plugins don't reuse what
+		// they cached for the previous one
+		num++
+		evt := &event{num: num, data: data}
+		for _, req := range reqs {
+			p.Extract(req, evt)
+		}
+	})
+}
+
+func fieldType(t string) uint32 {
+	switch t {
+	case "uint64":
+		return sdk.FieldTypeUint64
+	case "reltime":
+		return sdk.FieldTypeRelTime
+	case "abstime":
+		return sdk.FieldTypeAbsTime
+	case "bool":
+		return sdk.FieldTypeBool
+	case "ipaddr":
+		return sdk.FieldTypeIPAddr
+	case "ipnet":
+		return sdk.FieldTypeIPNet
+	default:
+		return sdk.FieldTypeCharBuf
+	}
+}
+
+// request implements sdk.ExtractRequest and discards the extracted values
+type request struct {
+	fieldID    uint64
+	fieldType  uint32
+	field      string
+	argKey     string
+	argIndex   uint64
+	argPresent bool
+	isList     bool
+}
+
+func (r *request) FieldID() uint64 {
+	return r.fieldID
+}
+
+func (r *request) FieldType() uint32 {
+	return r.fieldType
+}
+
+func (r *request) Field() string {
+	return r.field
+}
+
+func (r *request) ArgKey() string {
+	return r.argKey
+}
+
+func (r *request) ArgIndex() uint64 {
+	return r.argIndex
+}
+
+func (r *request) ArgPresent() bool {
+	return r.argPresent
+}
+
+func (r *request) IsList() bool {
+	return r.isList
+}
+
+func (r *request) SetValue(v interface{}) {
+	// do nothing
+}
+
+func (r *request) SetPtr(unsafe.Pointer) {
+	// do nothing
+}
+
+// event implements sdk.EventReader
+type event struct {
+	num  uint64
+	data []byte
+}
+
+func (e *event) EventNum() uint64 {
+	return e.num
+}
+
+func (e *event) Timestamp() uint64 {
+	return 0
+}
+
+func (e *event) Reader() io.ReadSeeker {
+	return bytes.NewReader(e.data)
+}
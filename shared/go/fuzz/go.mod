@@ -0,0 +1,5 @@
+module github.com/falcosecurity/plugins/shared/go/fuzz
+
+go 1.18
+
+require github.com/falcosecurity/plugin-sdk-go v0.7.3
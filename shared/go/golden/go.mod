@@ -0,0 +1,5 @@
+module github.com/falcosecurity/plugins/shared/go/golden
+
+go 1.15
+
+require github.com/falcosecurity/plugin-sdk-go v0.7.3
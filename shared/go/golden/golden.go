@@ -0,0 +1,341 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package golden provides a regression test runner for the field extraction
+// of the plugins. Each plugin ships a corpus of raw event payloads, one per
+// file, along with a golden file for each of them holding the values of the
+// fields expected to be extracted from it. The runner extracts the fields
+// from the payloads and compares them with the golden files, which are
+// created or updated instead when the tests run with the -update flag:
+//
+//	go test ./pkg/... -run TestExtractGolden -update
+package golden
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+)
+
+// Ext is the extension of the golden files, which are named after the
+// payload file they belong to
+const Ext = ".golden"
+
+// baseTimestamp is the timestamp of the first event of a corpus, the next
+// ones are one second apart so that the time-based fields are stable
+var baseTimestamp = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var update = flag.Bool("update", false, "create or update the golden files of the field extraction tests")
+
+// Extractor is a plugin supporting the field extraction capability
+type Extractor interface {
+	Fields() []sdk.FieldEntry
+	Extract(req sdk.ExtractRequest, evt sdk.EventReader) error
+}
+
+// Run extracts the given fields from each payload of the corpus directory
+// and compares their values with the golden file of the payload. Fields
+// are in the foo.bar or foo.bar[arg] form, and all the fields that don't
+// require an argument are extracted if none is given. Each payload runs
+// as a subtest named after its file.
+func Run(t *testing.T, p Extractor, dir string, fields ...string) {
+	if len(fields) == 0 {
+		fields = DefaultFields(p)
+	}
+	reqs, err := newRequests(p.Fields(), fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && !strings.HasSuffix(e.Name(), Ext) {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) == 0 {
+		t.Fatalf("no payload found in %s", dir)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		evt := &event{
+			num: uint64(i + 1),
+			ts:  baseTimestamp.Add(time.Duration(i) * time.Second),
+		}
+		path := filepath.Join(dir, name)
+		t.Run(name, func(t *testing.T) {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			evt.data = data
+			actual := extract(p, reqs, evt)
+			check(t, path+Ext, actual)
+		})
+	}
+}
+
+// extract returns the values extracted from an event by field, which are
+// nil for the fields that could not be extracted and hold the error for
+// the failed extractions
+func extract(p Extractor, reqs []*request, evt *event) map[string]interface{} {
+	res := make(map[string]interface{}, len(reqs))
+	for _, req := range reqs {
+		req.value = nil
+		if err := p.Extract(req, evt); err != nil {
+			res[req.name] = map[string]string{"error": err.Error()}
+			continue
+		}
+		res[req.name] = req.value
+	}
+	return res
+}
+
+// check compares the values extracted from a payload with its golden file,
+// or writes them to it in update mode
+func check(t *testing.T, path string, actual map[string]interface{}) {
+	data, err := json.MarshalIndent(actual, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, '\n')
+
+	if *update {
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expectedData, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Fatalf("missing golden file %s, run the tests with -update to create it", path)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(expectedData, data) {
+		return
+	}
+
+	// report the fields that differ one by one
+	var expected, got map[string]json.RawMessage
+	if err := json.Unmarshal(expectedData, &expected); err != nil {
+		t.Fatalf("invalid golden file %s: %s", path, err.Error())
+	}
+	json.Unmarshal(data, &got)
+	var keys []string
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	for k := range got {
+		if _, ok := expected[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e, g := compact(expected[k]), compact(got[k])
+		if e != g {
+			t.Errorf("%s: expected %s, got %s", k, e, g)
+		}
+	}
+}
+
+func compact(v json.RawMessage) string {
+	if v == nil {
+		return "<missing>"
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, v); err != nil {
+		return string(v)
+	}
+	return buf.String()
+}
+
+// DefaultFields returns all the fields of a plugin that don't require an
+// argument, to which the fields with arguments can be appended
+func DefaultFields(p Extractor) []string {
+	var res []string
+	for _, e := range p.Fields() {
+		if !e.Arg.IsRequired {
+			res = append(res, e.Name)
+		}
+	}
+	return res
+}
+
+// newRequests returns the extraction requests of the given fields
+func newRequests(entries []sdk.FieldEntry, fields []string) ([]*request, error) {
+
+	var res []*request
+	for _, f := range fields {
+		req := &request{name: f, field: f}
+		if i := strings.Index(f, "["); i > 0 && strings.HasSuffix(f, "]") {
+			req.field = f[:i]
+			req.argKey = f[i+1 : len(f)-1]
+			req.argPresent = true
+		}
+		found := false
+		for id, e := range entries {
+			if e.Name != req.field {
+				continue
+			}
+			found = true
+			req.fieldID = uint64(id)
+			req.fieldType = fieldType(e.Type)
+			req.isList = e.IsList
+			if req.argPresent && e.Arg.IsIndex {
+				idx, err := strconv.ParseUint(req.argKey, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("field %s requires a numeric argument", req.field)
+				}
+				req.argIndex = idx
+				req.argKey = ""
+			}
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("field %s is not supported by the plugin", req.field)
+		}
+		res = append(res, req)
+	}
+	return res, nil
+}
+
+func fieldType(t string) uint32 {
+	switch t {
+	case "uint64":
+		return sdk.FieldTypeUint64
+	case "reltime":
+		return sdk.FieldTypeRelTime
+	case "abstime":
+		return sdk.FieldTypeAbsTime
+	case "bool":
+		return sdk.FieldTypeBool
+	case "ipaddr":
+		return sdk.FieldTypeIPAddr
+	case "ipnet":
+		return sdk.FieldTypeIPNet
+	default:
+		return sdk.FieldTypeCharBuf
+	}
+}
+
+// request implements sdk.ExtractRequest and keeps the extracted value in a
+// form that is stable once marshaled in a golden file
+type request struct {
+	name       string
+	fieldID    uint64
+	fieldType  uint32
+	field      string
+	argKey     string
+	argIndex   uint64
+	argPresent bool
+	isList     bool
+	value      interface{}
+}
+
+func (r *request) FieldID() uint64 {
+	return r.fieldID
+}
+
+func (r *request) FieldType() uint32 {
+	return r.fieldType
+}
+
+func (r *request) Field() string {
+	return r.field
+}
+
+func (r *request) ArgKey() string {
+	return r.argKey
+}
+
+func (r *request) ArgIndex() uint64 {
+	return r.argIndex
+}
+
+func (r *request) ArgPresent() bool {
+	return r.argPresent
+}
+
+func (r *request) IsList() bool {
+	return r.isList
+}
+
+func (r *request) SetValue(v interface{}) {
+	switch value := v.(type) {
+	case time.Time:
+		r.value = value.UTC().Format(time.RFC3339Nano)
+	case *time.Time:
+		r.value = value.UTC().Format(time.RFC3339Nano)
+	case []time.Time:
+		var res []string
+		for _, t := range value {
+			res = append(res, t.UTC().Format(time.RFC3339Nano))
+		}
+		r.value = res
+	case time.Duration, *time.Duration, []time.Duration,
+		net.IP, *net.IP, []net.IP, net.IPNet, *net.IPNet, []net.IPNet:
+		r.value = fmt.Sprint(value)
+	default:
+		r.value = v
+	}
+}
+
+func (r *request) SetPtr(unsafe.Pointer) {
+	// do nothing
+}
+
+// event implements sdk.EventReader
+type event struct {
+	num  uint64
+	ts   time.Time
+	data []byte
+}
+
+func (e *event) EventNum() uint64 {
+	return e.num
+}
+
+func (e *event) Timestamp() uint64 {
+	return uint64(e.ts.UnixNano())
+}
+
+func (e *event) Reader() io.ReadSeeker {
+	return bytes.NewReader(e.data)
+}
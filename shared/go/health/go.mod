@@ -0,0 +1,7 @@
+module github.com/falcosecurity/plugins/shared/go/health
+
+go 1.15
+
+require github.com/falcosecurity/plugins/shared/go/mux v0.0.0-00010101000000-000000000000
+
+replace github.com/falcosecurity/plugins/shared/go/mux => ../mux
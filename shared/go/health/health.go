@@ -0,0 +1,347 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health provides the opt-in HTTP endpoint reporting the state of
+// the opened instances of a plugin, so that the Kubernetes probes and the
+// operators can detect a source that silently stopped producing events.
+//
+// Each instance reports its state through a Tracker: whether it is
+// connected to its upstream, the time of its last event, and the number of
+// consecutive errors since then. The endpoint answers with the state of all
+// the instances as json, with the status 200 when they are healthy and 503
+// otherwise. An instance is unhealthy when it reached maxErrors consecutive
+// errors (default 3), or when it produced no event for more than maxIdle
+// (disabled by default), both of them being set as query parameters, e.g.
+// /healthz?maxErrors=5&maxIdle=10m. The readiness endpoint, served under
+// <path>/ready, answers 200 once an instance is opened and all of them are
+// connected.
+//
+// A Tracker can also be watched for stalls, e.g. an ingestion goroutine
+// blocked on a call that never returns: an instance that recorded neither
+// an event nor a poll for longer than the timeout of its watchdog is
+// reported as stalled, and thus unhealthy, until its next activity, and the
+// plugin is notified so that it can log it and restart its ingestion loop.
+// The watchdogs run whether or not the endpoint is enabled.
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/falcosecurity/plugins/shared/go/mux"
+)
+
+const (
+	// DefaultPath is the path of the endpoint when none is configured
+	DefaultPath = "/healthz"
+
+	defaultMaxErrors = 3
+)
+
+// Server is a running health server
+type Server struct {
+	mount    *mux.Mount
+	mu       sync.Mutex
+	lastID   uint64
+	trackers map[uint64]*Tracker
+}
+
+// Start starts a health server listening on addr, e.g. :8081, and serving
+// the endpoint under path, or DefaultPath if empty. Unlike the debug server,
+// it can listen on any interface, since the probes don't come from the
+// loopback one. The address can be shared with the metrics endpoint of the
+// plugin, which is then served by the same listener.
+func Start(addr, path string) (*Server, error) {
+	if len(path) == 0 {
+		path = DefaultPath
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("health path %s does not start with /", path)
+	}
+	path = strings.TrimSuffix(path, "/")
+
+	s := &Server{trackers: map[uint64]*Tracker{}}
+	m, err := mux.Serve(addr, mux.Routes{
+		path:            http.HandlerFunc(s.serveHealth),
+		path + "/ready": http.HandlerFunc(s.serveReady),
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.mount = m
+	return s, nil
+}
+
+// Close stops the health server
+func (s *Server) Close() error {
+	return s.mount.Close()
+}
+
+// Track returns the tracker of a newly opened instance, which is reported
+// by the server until the tracker is closed. The server may be nil when the
+// endpoint is disabled, in which case the tracker is not reported anywhere.
+func (s *Server) Track() *Tracker {
+	t := &Tracker{opened: time.Now().UnixNano(), stop: make(chan struct{})}
+	if s == nil {
+		return t
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	t.id = s.lastID
+	t.srv = s
+	s.trackers[t.id] = t
+	return t
+}
+
+// Tracker records the state of an opened instance. Its methods are safe
+// for concurrent use, and cheap enough to be called for each event.
+type Tracker struct {
+	srv       *Server
+	id        uint64
+	opened    int64
+	connected int32
+	lastEvent int64
+	lastPoll  int64
+	errors    int64
+	stalled   int32
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// SetConnected records whether the instance is connected to its upstream.
+// A successful connection, e.g. a poll that returned no event, resets the
+// consecutive errors.
+func (t *Tracker) SetConnected(connected bool) {
+	var v int32
+	if connected {
+		v = 1
+		t.resetErrors()
+	}
+	atomic.StoreInt32(&t.connected, v)
+}
+
+// Event records that the instance produced an event, which resets its
+// consecutive errors
+func (t *Tracker) Event() {
+	atomic.StoreInt64(&t.lastEvent, time.Now().UnixNano())
+	t.resetErrors()
+}
+
+// Poll records that the instance polled its upstream, whether or not it got
+// events, so that an idle upstream is not mistaken for a stall
+func (t *Tracker) Poll() {
+	atomic.StoreInt64(&t.lastPoll, time.Now().UnixNano())
+}
+
+// Error records that the instance failed to read from its upstream
+func (t *Tracker) Error() {
+	atomic.AddInt64(&t.errors, 1)
+}
+
+func (t *Tracker) resetErrors() {
+	// the counter is only written when needed, since it's shared with the
+	// goroutines recording the errors
+	if atomic.LoadInt64(&t.errors) != 0 {
+		atomic.StoreInt64(&t.errors, 0)
+	}
+}
+
+// Watch starts the watchdog of the instance, which calls onStall from its
+// own goroutine each time the instance records neither an event nor a poll
+// for longer than timeout, with the time since its last activity. The
+// instance is reported as stalled until its next activity, and onStall is
+// called again if it stays idle for another timeout. The watchdog stops
+// when the tracker is closed.
+func (t *Tracker) Watch(timeout time.Duration, onStall func(idle time.Duration)) {
+	if timeout <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(watchdogPeriod(timeout))
+		defer ticker.Stop()
+		notified := t.lastActivity()
+		for {
+			select {
+			case <-t.stop:
+				return
+			case now := <-ticker.C:
+				last := t.lastActivity()
+				idle := now.Sub(time.Unix(0, last))
+				if idle <= timeout {
+					atomic.StoreInt32(&t.stalled, 0)
+					continue
+				}
+				atomic.StoreInt32(&t.stalled, 1)
+				// the instance is notified once per timeout of
+				// inactivity, counted from its last notification
+				if last > notified || now.Sub(time.Unix(0, notified)) > timeout {
+					notified = now.UnixNano()
+					onStall(idle)
+				}
+			}
+		}
+	}()
+}
+
+// watchdogPeriod returns how often a watchdog checks the activity of its
+// instance, which is a fraction of the timeout bounded to stay reactive
+// without busy looping
+func watchdogPeriod(timeout time.Duration) time.Duration {
+	p := timeout / 4
+	if p < 10*time.Millisecond {
+		p = 10 * time.Millisecond
+	}
+	if p > 10*time.Second {
+		p = 10 * time.Second
+	}
+	return p
+}
+
+// lastActivity returns the time of the last event or poll of the instance,
+// or of its opening if none
+func (t *Tracker) lastActivity() int64 {
+	res := t.opened
+	if v := atomic.LoadInt64(&t.lastEvent); v > res {
+		res = v
+	}
+	if v := atomic.LoadInt64(&t.lastPoll); v > res {
+		res = v
+	}
+	return res
+}
+
+// Close stops reporting the instance, and its watchdog
+func (t *Tracker) Close() {
+	t.stopOnce.Do(func() { close(t.stop) })
+	if t.srv == nil {
+		return
+	}
+	t.srv.mu.Lock()
+	defer t.srv.mu.Unlock()
+	delete(t.srv.trackers, t.id)
+}
+
+// state is the state of an instance as reported by the endpoint
+type state struct {
+	ID                uint64     `json:"id"`
+	Connected         bool       `json:"connected"`
+	OpenedAt          time.Time  `json:"openedAt"`
+	LastEventAt       *time.Time `json:"lastEventAt,omitempty"`
+	LastPollAt        *time.Time `json:"lastPollAt,omitempty"`
+	ConsecutiveErrors int64      `json:"consecutiveErrors"`
+	Stalled           bool       `json:"stalled,omitempty"`
+	Healthy           bool       `json:"healthy"`
+}
+
+type report struct {
+	Status    string  `json:"status"`
+	Instances []state `json:"instances"`
+}
+
+// states returns the state of all the instances, sorted by opening order
+func (s *Server) states() []state {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make([]state, 0, len(s.trackers))
+	for _, t := range s.trackers {
+		st := state{
+			ID:                t.id,
+			Connected:         atomic.LoadInt32(&t.connected) != 0,
+			OpenedAt:          time.Unix(0, t.opened),
+			ConsecutiveErrors: atomic.LoadInt64(&t.errors),
+			Stalled:           atomic.LoadInt32(&t.stalled) != 0,
+		}
+		if last := atomic.LoadInt64(&t.lastEvent); last != 0 {
+			at := time.Unix(0, last)
+			st.LastEventAt = &at
+		}
+		if last := atomic.LoadInt64(&t.lastPoll); last != 0 {
+			at := time.Unix(0, last)
+			st.LastPollAt = &at
+		}
+		res = append(res, st)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+func (s *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	maxErrors := int64(defaultMaxErrors)
+	var maxIdle time.Duration
+	var err error
+	if v := r.URL.Query().Get("maxErrors"); len(v) > 0 {
+		if maxErrors, err = strconv.ParseInt(v, 10, 64); err != nil || maxErrors <= 0 {
+			http.Error(w, "invalid maxErrors: "+v, http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("maxIdle"); len(v) > 0 {
+		if maxIdle, err = time.ParseDuration(v); err != nil || maxIdle <= 0 {
+			http.Error(w, "invalid maxIdle: "+v, http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now()
+	rep := report{Status: "ok", Instances: s.states()}
+	for i := range rep.Instances {
+		st := &rep.Instances[i]
+		st.Healthy = st.ConsecutiveErrors < maxErrors && !st.Stalled
+		if maxIdle > 0 {
+			// an instance is given maxIdle to produce its first event
+			last := st.OpenedAt
+			if st.LastEventAt != nil {
+				last = *st.LastEventAt
+			}
+			st.Healthy = st.Healthy && now.Sub(last) <= maxIdle
+		}
+		if !st.Healthy {
+			rep.Status = "unhealthy"
+		}
+	}
+	writeReport(w, &rep, rep.Status == "ok")
+}
+
+func (s *Server) serveReady(w http.ResponseWriter, r *http.Request) {
+	rep := report{Status: "ready", Instances: s.states()}
+	ready := len(rep.Instances) > 0
+	for i := range rep.Instances {
+		st := &rep.Instances[i]
+		st.Healthy = st.Connected
+		ready = ready && st.Connected
+	}
+	if !ready {
+		rep.Status = "not ready"
+	}
+	writeReport(w, &rep, ready)
+}
+
+func writeReport(w http.ResponseWriter, rep *report, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(rep)
+}
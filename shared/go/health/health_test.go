@@ -0,0 +1,256 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// freeAddr returns the address of a free loopback port
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// check returns the status and the report of a request to a handler
+func check(t *testing.T, h http.HandlerFunc, target string) (int, report) {
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", target, nil))
+	var rep report
+	if w.Code != http.StatusBadRequest {
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: expected a json response, got %s", target, ct)
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &rep); err != nil {
+			t.Fatalf("%s: %s", target, err)
+		}
+	}
+	return w.Code, rep
+}
+
+func TestServeHealth(t *testing.T) {
+	s := &Server{trackers: map[uint64]*Tracker{}}
+	if status, rep := check(t, s.serveHealth, "/healthz"); status != http.StatusOK || rep.Status != "ok" || len(rep.Instances) != 0 {
+		t.Errorf("expected no instance to be healthy, got %d %+v", status, rep)
+	}
+
+	t1, t2 := s.Track(), s.Track()
+	t1.SetConnected(true)
+	t1.Event()
+	t2.Poll()
+	for i := 0; i < defaultMaxErrors; i++ {
+		t2.Error()
+	}
+	status, rep := check(t, s.serveHealth, "/healthz")
+	if status != http.StatusServiceUnavailable || rep.Status != "unhealthy" || len(rep.Instances) != 2 {
+		t.Fatalf("expected the instance with errors to be unhealthy, got %d %+v", status, rep)
+	}
+	i1, i2 := rep.Instances[0], rep.Instances[1]
+	if i1.ID != t1.id || !i1.Connected || !i1.Healthy || i1.LastEventAt == nil || i1.LastPollAt != nil {
+		t.Errorf("unexpected state of the first instance %+v", i1)
+	}
+	if i2.ID != t2.id || i2.Connected || i2.Healthy || i2.ConsecutiveErrors != defaultMaxErrors || i2.LastPollAt == nil || i2.LastEventAt != nil {
+		t.Errorf("unexpected state of the second instance %+v", i2)
+	}
+
+	// the threshold can be raised, and the errors are reset by an event
+	if status, _ := check(t, s.serveHealth, "/healthz?maxErrors=4"); status != http.StatusOK {
+		t.Errorf("expected the instances to be healthy below maxErrors, got %d", status)
+	}
+	t2.SetConnected(true)
+	if status, _ := check(t, s.serveHealth, "/healthz"); status != http.StatusOK {
+		t.Errorf("expected the errors to be reset by a connection, got %d", status)
+	}
+
+	// the instances that produced no event for maxIdle are unhealthy,
+	// including the ones that never produced one since their opening
+	time.Sleep(20 * time.Millisecond)
+	t1.Event()
+	status, rep = check(t, s.serveHealth, "/healthz?maxIdle=10ms")
+	if status != http.StatusServiceUnavailable || !rep.Instances[0].Healthy || rep.Instances[1].Healthy {
+		t.Errorf("expected the idle instance to be unhealthy, got %d %+v", status, rep)
+	}
+	if status, _ := check(t, s.serveHealth, "/healthz?maxIdle=1h"); status != http.StatusOK {
+		t.Errorf("expected the instances to be healthy within maxIdle, got %d", status)
+	}
+
+	// the closed instances are not reported anymore
+	t2.Close()
+	t2.Close()
+	if _, rep := check(t, s.serveHealth, "/healthz"); len(rep.Instances) != 1 {
+		t.Errorf("expected the closed instance to be removed, got %+v", rep)
+	}
+
+	for _, target := range []string{"/healthz?maxErrors=0", "/healthz?maxErrors=a", "/healthz?maxIdle=-1s", "/healthz?maxIdle=1"} {
+		if status, _ := check(t, s.serveHealth, target); status != http.StatusBadRequest {
+			t.Errorf("%s: expected the status 400, got %d", target, status)
+		}
+	}
+}
+
+func TestServeReady(t *testing.T) {
+	s := &Server{trackers: map[uint64]*Tracker{}}
+	if status, rep := check(t, s.serveReady, "/healthz/ready"); status != http.StatusServiceUnavailable || rep.Status != "not ready" {
+		t.Errorf("expected not to be ready without instance, got %d %+v", status, rep)
+	}
+	t1, t2 := s.Track(), s.Track()
+	t1.SetConnected(true)
+	if status, rep := check(t, s.serveReady, "/healthz/ready"); status != http.StatusServiceUnavailable || !rep.Instances[0].Healthy || rep.Instances[1].Healthy {
+		t.Errorf("expected not to be ready until all the instances are connected, got %d %+v", status, rep)
+	}
+	t2.SetConnected(true)
+	if status, rep := check(t, s.serveReady, "/healthz/ready"); status != http.StatusOK || rep.Status != "ready" {
+		t.Errorf("expected to be ready, got %d %+v", status, rep)
+	}
+	t2.SetConnected(false)
+	if status, _ := check(t, s.serveReady, "/healthz/ready"); status != http.StatusServiceUnavailable {
+		t.Errorf("expected not to be ready once disconnected, got %d", status)
+	}
+}
+
+func TestStart(t *testing.T) {
+	addr := freeAddr(t)
+	s, err := Start(addr, "/health/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Track().SetConnected(true)
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	for _, path := range []string{"/health", "/health/ready"} {
+		res, err := client.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected the status 200, got %d", path, res.StatusCode)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the default path, and the invalid ones
+	s, err = Start(addr, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Get("http://" + addr + DefaultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected the default path to be served, got %d", res.StatusCode)
+	}
+	s.Close()
+	if _, err := Start(addr, "healthz"); err == nil {
+		t.Error("expected an error with a relative path")
+	}
+}
+
+func TestNilServer(t *testing.T) {
+	// the trackers of a disabled endpoint record the state without
+	// reporting it
+	tr := (*Server)(nil).Track()
+	tr.SetConnected(true)
+	tr.Event()
+	tr.Error()
+	if atomic.LoadInt64(&tr.errors) != 1 {
+		t.Errorf("expected the error to be recorded, got %d", tr.errors)
+	}
+	tr.Close()
+}
+
+func TestWatch(t *testing.T) {
+	s := &Server{trackers: map[uint64]*Tracker{}}
+	tr := s.Track()
+	defer tr.Close()
+	stalls := make(chan time.Duration, 16)
+	tr.Watch(50*time.Millisecond, func(idle time.Duration) {
+		stalls <- idle
+	})
+
+	// the idle instance is notified and reported as stalled
+	select {
+	case idle := <-stalls:
+		if idle <= 50*time.Millisecond {
+			t.Errorf("expected the idle time to exceed the timeout, got %s", idle)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a stall to be notified")
+	}
+	if status, rep := check(t, s.serveHealth, "/healthz"); status != http.StatusServiceUnavailable || !rep.Instances[0].Stalled {
+		t.Errorf("expected the instance to be stalled, got %d %+v", status, rep)
+	}
+
+	// its activity clears the stall, until the next timeout
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				tr.Poll()
+			}
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	for len(stalls) > 0 {
+		<-stalls
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+	if len(stalls) != 0 {
+		t.Errorf("expected no stall while polling, got %d", len(stalls))
+	}
+	if status, rep := check(t, s.serveHealth, "/healthz"); status != http.StatusOK || rep.Instances[0].Stalled {
+		t.Errorf("expected the stall to be cleared, got %d %+v", status, rep)
+	}
+
+	// the watchdog is disabled without timeout
+	(*Server)(nil).Track().Watch(0, func(time.Duration) {
+		t.Error("expected no watchdog")
+	})
+}
+
+func TestWatchdogPeriod(t *testing.T) {
+	tests := map[time.Duration]time.Duration{
+		time.Millisecond: 10 * time.Millisecond,
+		time.Second:      250 * time.Millisecond,
+		time.Hour:        10 * time.Second,
+	}
+	for timeout, expected := range tests {
+		if p := watchdogPeriod(timeout); p != expected {
+			t.Errorf("%s: expected %s, got %s", timeout, expected, p)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package httpclient builds the HTTP clients of the plugins calling HTTP
+// APIs, from a configuration block accepted identically by all of them in
+// their init configuration under the http property. It sets the proxy, the
+// CA bundle trusted in addition to the system ones, the client certificate
+// of mTLS, the timeout of the requests, and retries the requests failing
+// with a network error or a transient status with an exponential backoff.
+// The timeout applies to each attempt until the response headers are
+// received, so that the waits of the retries and of the middlewares, such as
+// a rate limiter paused until the quota of an API is restored, don't fail
+// the requests.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Middleware wraps the transport of a client, e.g. with a rate limiter
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// Config is the configuration block of the HTTP clients of a plugin
+type Config struct {
+	Proxy   string `json:"proxy" jsonschema:"title=Proxy,description=URL of the proxy of the requests (default: empty for the proxy set by the HTTP_PROXY and HTTPS_PROXY and NO_PROXY environment variables)"`
+	CA      string `json:"ca" jsonschema:"title=CA bundle,description=Path of a PEM file with the certificates of the authorities trusted in addition to the ones of the system (default: empty)"`
+	Cert    string `json:"cert" jsonschema:"title=Client certificate,description=Path of the PEM encoded client certificate for mTLS authentication (default: empty)"`
+	Key     string `json:"key" jsonschema:"title=Client key,description=Path of the PEM encoded private key of the client certificate (default: empty)"`
+	Timeout uint64 `json:"timeout" jsonschema:"title=Timeout,description=Timeout in seconds waiting for the response of each attempt of a request (default: 60)"`
+	Retries uint64 `json:"retries" jsonschema:"title=Retries,description=Number of times a request failing with a network error or a 429 or 502 or 503 or 504 status is retried (default: 3)"`
+	Backoff uint64 `json:"backoff" jsonschema:"title=Backoff,description=Delay in milliseconds before the first retry of a request which doubles at each retry (default: 500)"`
+}
+
+// Reset sets the configuration to its default values
+func (c *Config) Reset() {
+	*c = Config{
+		Timeout: 60,
+		Retries: 3,
+		Backoff: 500,
+	}
+}
+
+// New returns a client configured with c. The middlewares wrap its
+// transport in order, below the retries, so that they see each attempt.
+func New(c Config, middlewares ...Middleware) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.Proxy != "" {
+		u, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	tlsConfig, err := c.tls()
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+	transport.ResponseHeaderTimeout = time.Duration(c.Timeout) * time.Second
+
+	var rt http.RoundTripper = transport
+	for _, m := range middlewares {
+		rt = m(rt)
+	}
+	if c.Retries > 0 {
+		rt = &retryTransport{
+			base:    rt,
+			retries: c.Retries,
+			backoff: time.Duration(c.Backoff) * time.Millisecond,
+		}
+	}
+	return &http.Client{Transport: rt}, nil
+}
+
+// tls returns the TLS configuration of the transport, or nil for the
+// default one
+func (c *Config) tls() (*tls.Config, error) {
+	if c.CA == "" && c.Cert == "" && c.Key == "" {
+		return nil, nil
+	}
+	res := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.CA != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(c.CA)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", c.CA)
+		}
+		res.RootCAs = pool
+	}
+	if c.Cert != "" || c.Key != "" {
+		if c.Cert == "" || c.Key == "" {
+			return nil, fmt.Errorf("the client certificate and its key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, err
+		}
+		res.Certificates = []tls.Certificate{cert}
+	}
+	return res, nil
+}
@@ -0,0 +1,295 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package httpclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testConfig returns a configuration with short retries
+func testConfig() Config {
+	var c Config
+	c.Reset()
+	c.Timeout = 5
+	c.Backoff = 1
+	return c
+}
+
+// writePEM writes a PEM block in a file of dir and returns its path
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReset(t *testing.T) {
+	var c Config
+	c.Reset()
+	if c.Timeout != 60 || c.Retries != 3 || c.Backoff != 500 {
+		t.Errorf("unexpected defaults %+v", c)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		body     bool
+		retries  uint64
+		expected int
+		requests int32
+	}{
+		{"success", []int{200}, false, 3, 200, 1},
+		{"transient", []int{503, 429, 502, 200}, false, 3, 200, 4},
+		{"exhausted", []int{504, 504, 504}, false, 2, 504, 3},
+		{"not transient", []int{500, 200}, false, 3, 500, 1},
+		{"body", []int{503, 200}, true, 3, 200, 2},
+		{"no retries", []int{503, 200}, false, 0, 503, 1},
+	}
+	for _, test := range tests {
+		var requests int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&requests, 1)
+			if test.body {
+				if b, _ := ioutil.ReadAll(r.Body); string(b) != "body" {
+					t.Errorf("%s: expected the body to be sent again, got %q", test.name, b)
+				}
+			}
+			w.WriteHeader(test.statuses[n-1])
+		}))
+		c := testConfig()
+		c.Retries = test.retries
+		client, err := New(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp *http.Response
+		if test.body {
+			resp, err = client.Post(srv.URL, "text/plain", strings.NewReader("body"))
+		} else {
+			resp, err = client.Get(srv.URL)
+		}
+		srv.Close()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.expected || requests != test.requests {
+			t.Errorf("%s: expected %d after %d requests, got %d after %d", test.name, test.expected, test.requests, resp.StatusCode, requests)
+		}
+	}
+}
+
+func TestRetriesBody(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	client, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a body that can't be read again is not retried
+	req, _ := http.NewRequest("POST", srv.URL, ioutil.NopCloser(strings.NewReader("body")))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if requests != 1 {
+		t.Errorf("expected a single request, got %d", requests)
+	}
+
+	// and the retries stop with the context
+	c := testConfig()
+	c.Backoff = 3600 * 1000
+	client, _ = New(c)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	if _, err := client.Do(req); err == nil {
+		t.Error("expected the context to stop the retries")
+	}
+}
+
+func TestMiddlewares(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Order") != "ab" {
+			t.Errorf("expected the middlewares to be applied in order, got %s", r.Header.Get("X-Order"))
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// the middlewares see each attempt
+	var attempts int32
+	middleware := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundTripper(func(req *http.Request) (*http.Response, error) {
+				if name == "b" {
+					atomic.AddInt32(&attempts, 1)
+				}
+				req = req.Clone(req.Context())
+				req.Header.Set("X-Order", name+req.Header.Get("X-Order"))
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	c := testConfig()
+	c.Retries = 2
+	client, err := New(c, middleware("a"), middleware("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.String() != "http://api.invalid/items" {
+			t.Errorf("unexpected proxied URL %s", r.URL)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer proxy.Close()
+
+	c := testConfig()
+	c.Proxy = proxy.URL
+	client, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get("http://api.invalid/items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("expected the response of the proxy, got %d", resp.StatusCode)
+	}
+
+	c.Proxy = "http://[::1"
+	if _, err := New(c); err == nil {
+		t.Error("expected an error for an invalid proxy")
+	}
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) != 1 || r.TLS.PeerCertificates[0].Subject.CommonName != "client" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// the server is not trusted without its CA
+	c := testConfig()
+	c.Retries = 0
+	client, _ := New(c)
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Error("expected the server not to be trusted")
+	}
+
+	// a self-signed client certificate
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.CA = writePEM(t, dir, "ca.pem", "CERTIFICATE", srv.Certificate().Raw)
+	c.Cert = writePEM(t, dir, "cert.pem", "CERTIFICATE", der)
+	c.Key = writePEM(t, dir, "key.pem", "EC PRIVATE KEY", keyDER)
+	client, err = New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the client certificate to be sent, got %d", resp.StatusCode)
+	}
+
+	invalid := []Config{
+		{CA: filepath.Join(dir, "missing.pem")},
+		{CA: writePEM(t, dir, "empty.pem", "NOTHING", nil)},
+		{Cert: c.Cert},
+		{Key: c.Key},
+		{Cert: c.Key, Key: c.Cert},
+	}
+	for _, config := range invalid {
+		if _, err := New(config); err == nil {
+			t.Errorf("%+v: expected an error", config)
+		}
+	}
+}
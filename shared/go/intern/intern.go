@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package intern provides the string interning used by the extractors for
+// the values that repeat constantly across events, such as event names,
+// user names or namespaces. Interning a value read from an event returns
+// the string already allocated for it, so that the steady state of the
+// extraction doesn't allocate for these values. Interned strings of equal
+// values share their data, which makes comparing them immediate.
+package intern
+
+import (
+	"hash/maphash"
+)
+
+const (
+	// DefaultSize is the number of slots of a Pool
+	DefaultSize = 4096
+	// MaxLen is the length of the longest values that are interned,
+	// longer values are unlikely to repeat and are just copied
+	MaxLen = 256
+)
+
+// Pool is a fixed-size table of interned strings, indexed by their hash.
+// A value replaces the one in its slot, if any, so that the memory used
+// is bounded and that the values seen once don't stay in the table,
+// while the frequent ones are most likely found there.
+// The zero value is an empty pool ready to use. A Pool is not safe for
+// concurrent use, which fits the extraction of a plugin.
+type Pool struct {
+	hash  maphash.Hash
+	slots []string
+}
+
+// Bytes returns the interned string of the given bytes. The returned string
+// doesn't reference b, which can be modified afterwards. A nil Pool just
+// copies b into a new string.
+func (p *Pool) Bytes(b []byte) string {
+	if p == nil || len(b) == 0 || len(b) > MaxLen {
+		return string(b)
+	}
+	if p.slots == nil {
+		p.slots = make([]string, DefaultSize)
+	}
+
+	p.hash.Reset()
+	p.hash.Write(b)
+	slot := &p.slots[p.hash.Sum64()%uint64(len(p.slots))]
+	// the conversion of the comparison doesn't allocate
+	if *slot != string(b) {
+		*slot = string(b)
+	}
+	return *slot
+}
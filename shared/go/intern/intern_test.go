@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package intern
+
+import (
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+// data returns the pointer to the bytes of a string
+func data(s string) uintptr {
+	return (*[2]uintptr)(unsafe.Pointer(&s))[0]
+}
+
+func TestBytes(t *testing.T) {
+	var p Pool
+	b := []byte("ConsoleLogin")
+	s1 := p.Bytes(b)
+	if s1 != "ConsoleLogin" {
+		t.Fatalf("expected ConsoleLogin, got %s", s1)
+	}
+
+	// the interned strings don't reference the bytes
+	copy(b, "xxxxxxxxxxxx")
+	if s1 != "ConsoleLogin" {
+		t.Errorf("expected the interned string to be unchanged, got %s", s1)
+	}
+
+	// the equal values share their data
+	s2 := p.Bytes([]byte("ConsoleLogin"))
+	if s2 != s1 || data(s2) != data(s1) {
+		t.Error("expected the interned string to be returned")
+	}
+
+	// the values that are too long, and the empty ones, are not interned
+	long := []byte(strings.Repeat("a", MaxLen+1))
+	if s := p.Bytes(long); s != string(long) || data(s) == data(p.Bytes(long)) {
+		t.Error("expected the long value to be copied")
+	}
+	if s := p.Bytes(nil); s != "" {
+		t.Errorf("expected an empty string, got %q", s)
+	}
+
+	// a nil pool copies the values
+	var nilPool *Pool
+	if s := nilPool.Bytes([]byte("a")); s != "a" {
+		t.Errorf("expected a, got %s", s)
+	}
+}
+
+func TestBytesReplace(t *testing.T) {
+	// the values replace the ones of their slot, which are still
+	// returned correctly afterwards
+	var p Pool
+	values := make([]string, 2*DefaultSize)
+	for i := range values {
+		values[i] = strings.Repeat("v", i%MaxLen+1) + string(rune('a'+i%26))
+		if s := p.Bytes([]byte(values[i])); s != values[i] {
+			t.Fatalf("expected %s, got %s", values[i], s)
+		}
+	}
+	if len(p.slots) != DefaultSize {
+		t.Errorf("expected %d slots, got %d", DefaultSize, len(p.slots))
+	}
+	for _, v := range values {
+		if s := p.Bytes([]byte(v)); s != v {
+			t.Errorf("expected %s, got %s", v, s)
+		}
+	}
+}
+
+func TestBytesAllocs(t *testing.T) {
+	var p Pool
+	b := []byte("kube-system")
+	p.Bytes(b)
+	if n := testing.AllocsPerRun(100, func() { p.Bytes(b) }); n != 0 {
+		t.Errorf("expected no allocation for an interned value, got %v", n)
+	}
+}
@@ -0,0 +1,5 @@
+module github.com/falcosecurity/plugins/shared/go/jsoncache
+
+go 1.15
+
+require github.com/valyala/fastjson v1.6.4
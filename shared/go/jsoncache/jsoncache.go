@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package jsoncache provides an event-scoped cache of the JSON document
+// parsed from the payload of an event, so that extracting several fields
+// from the same event reads and parses its payload only once, and the
+// lookup of the values at the paths given as field arguments, compiled
+// once from JSON pointers or dotted paths.
+package jsoncache
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/valyala/fastjson"
+)
+
+// Cache keeps the JSON document parsed from the last event. The zero value
+// is ready to use. A Cache must not be used concurrently, which is fine
+// for the extraction and the String functions of a plugin since the
+// framework never calls them concurrently.
+type Cache struct {
+	paths  Paths
+	parser fastjson.Parser
+	buf    bytes.Buffer
+	value  *fastjson.Value
+	evtNum uint64
+	valid  bool
+}
+
+// Get returns the JSON document of the event with the given number. The
+// payload is read from r and parsed only if the event is not the one
+// parsed last, otherwise the cached document is returned. The document
+// remains valid until the next call to Get with another event number.
+func (c *Cache) Get(evtNum uint64, r io.Reader) (*fastjson.Value, error) {
+	if c.valid && c.evtNum == evtNum {
+		return c.value, nil
+	}
+
+	c.valid = false
+	c.buf.Reset()
+	if _, err := c.buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	// some payloads are padded with null bytes, which are not valid json
+	value, err := c.parser.ParseBytes(bytes.TrimRight(c.buf.Bytes(), "\x00"))
+	if err != nil {
+		return nil, err
+	}
+	c.value = value
+	c.evtNum = evtNum
+	c.valid = true
+	return c.value, nil
+}
+
+// Lookup returns the first value at a path of the JSON document of the
+// event, or nil if none, with the path compiled once by CompilePath
+func (c *Cache) Lookup(evtNum uint64, r io.Reader, expr string) (*fastjson.Value, error) {
+	value, err := c.Get(evtNum, r)
+	if err != nil {
+		return nil, err
+	}
+	return c.paths.Get(expr).Get(value), nil
+}
+
+// LookupAll returns all the values at a path of the JSON document of the
+// event, like Lookup
+func (c *Cache) LookupAll(evtNum uint64, r io.Reader, expr string) ([]*fastjson.Value, error) {
+	value, err := c.Get(evtNum, r)
+	if err != nil {
+		return nil, err
+	}
+	return c.paths.Get(expr).All(value, nil), nil
+}
+
+// Reset drops the cached document, so that the next call to Get parses
+// the payload again
+func (c *Cache) Reset() {
+	c.valid = false
+	c.value = nil
+}
@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsoncache
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// countingReader counts the reads of a payload
+type countingReader struct {
+	r     io.Reader
+	reads *int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	*c.reads++
+	return c.r.Read(p)
+}
+
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+func TestCacheGet(t *testing.T) {
+	var c Cache
+	reads := 0
+	payload := func(s string) io.Reader {
+		return &countingReader{r: strings.NewReader(s), reads: &reads}
+	}
+
+	v, err := c.Get(1, payload(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := v.GetInt("a"); n != 1 {
+		t.Errorf("expected 1, got %d", n)
+	}
+
+	// the payload of the same event is neither read nor parsed again
+	reads = 0
+	v, err = c.Get(1, payload(`{"a":2}`))
+	if err != nil || reads != 0 || v.GetInt("a") != 1 {
+		t.Errorf("expected the cached document without read, got %v after %d reads (%v)", v, reads, err)
+	}
+
+	// another event is parsed, with its padding null bytes trimmed
+	v, err = c.Get(2, payload("{\"a\":2}\x00\x00"))
+	if err != nil || v.GetInt("a") != 2 {
+		t.Errorf("expected the document of the new event, got %v (%v)", v, err)
+	}
+
+	// the cache is dropped by Reset
+	c.Reset()
+	reads = 0
+	v, err = c.Get(2, payload(`{"a":3}`))
+	if err != nil || reads == 0 || v.GetInt("a") != 3 {
+		t.Errorf("expected the payload to be parsed again after Reset, got %v (%v)", v, err)
+	}
+}
+
+func TestCacheGetErrors(t *testing.T) {
+	var c Cache
+	if _, err := c.Get(1, strings.NewReader(`{"a":1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the failures invalidate the cached document, so that the next
+	// event with the same number is not answered with a stale one
+	if _, err := c.Get(2, strings.NewReader(`{"a":`)); err == nil {
+		t.Error("expected an error parsing an invalid payload")
+	}
+	if _, err := c.Get(1, errReader{}); err == nil {
+		t.Error("expected the read error")
+	}
+	if _, err := c.Get(1, strings.NewReader(`not json`)); err == nil {
+		t.Error("expected the payload to be parsed again after an error")
+	}
+}
+
+func TestCacheLookup(t *testing.T) {
+	var c Cache
+	payload := `{"target":[{"id":"a"},{"id":"b"}]}`
+	v, err := c.Lookup(1, strings.NewReader(payload), "target[1].id")
+	if err != nil || v == nil || String(v) != "b" {
+		t.Errorf("expected b, got %v (%v)", v, err)
+	}
+	v, err = c.Lookup(1, nil, "missing")
+	if err != nil || v != nil {
+		t.Errorf("expected no value, got %v (%v)", v, err)
+	}
+	all, err := c.LookupAll(1, nil, "/target/*/id")
+	if err != nil || len(all) != 2 || String(all[0]) != "a" || String(all[1]) != "b" {
+		t.Errorf("expected a and b, got %v (%v)", all, err)
+	}
+	if _, err := c.Lookup(2, strings.NewReader("{"), "a"); err == nil {
+		t.Error("expected an error looking up an invalid payload")
+	}
+	if _, err := c.LookupAll(2, strings.NewReader("{"), "a"); err == nil {
+		t.Error("expected an error looking up an invalid payload")
+	}
+}
+
+func TestCompilePath(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected Path
+	}{
+		{"", nil},
+		{"/", Path{}},
+		{"a.b", Path{{Key: "a"}, {Key: "b"}}},
+		{"a[0].b", Path{{Key: "a"}, {Key: "0"}, {Key: "b"}}},
+		{"a[*][1]", Path{{Key: "a"}, {Wildcard: true}, {Key: "1"}}},
+		{"*.b", Path{{Wildcard: true}, {Key: "b"}}},
+		{"/a/0/b", Path{{Key: "a"}, {Key: "0"}, {Key: "b"}}},
+		{"/a/*/b", Path{{Key: "a"}, {Wildcard: true}, {Key: "b"}}},
+		{"/a[*]/b", Path{{Key: "a"}, {Wildcard: true}, {Key: "b"}}},
+		// the escaped characters of the JSON pointers
+		{"/a~1b/c~0d/~01", Path{{Key: "a/b"}, {Key: "c~d"}, {Key: "~1"}}},
+		// the dots are separators in dotted paths only
+		{"/a.b", Path{{Key: "a.b"}}},
+	}
+	for _, test := range tests {
+		p := CompilePath(test.expr)
+		if len(p) != len(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.expr, test.expected, p)
+			continue
+		}
+		for i := range p {
+			if p[i] != test.expected[i] {
+				t.Errorf("%s: expected %v, got %v", test.expr, test.expected, p)
+				break
+			}
+		}
+	}
+}
+
+func TestPathGetAll(t *testing.T) {
+	var c Cache
+	doc := `{"a":{"b/c":1,"d~":2},"arr":[{"x":1},{"y":2},{"x":3,"z":[4,5]}],"s":"str","n":null}`
+	v, err := c.Get(1, strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expr  string
+		first string
+		all   []string
+	}{
+		{"/a/b~1c", "1", []string{"1"}},
+		{"/a/d~0", "2", []string{"2"}},
+		{"arr[1].y", "2", []string{"2"}},
+		{"/arr/*/x", "1", []string{"1", "3"}},
+		{"arr[*].x", "1", []string{"1", "3"}},
+		{"arr[*].z[*]", "4", []string{"4", "5"}},
+		{"/arr[*]/z/1", "5", []string{"5"}},
+		{"s", "str", []string{"str"}},
+		{"n", "null", []string{"null"}},
+		{"a", `{"b/c":1,"d~":2}`, []string{`{"b/c":1,"d~":2}`}},
+		{"/", doc, []string{doc}},
+		{"missing", "", nil},
+		{"arr[3]", "", nil},
+		// the wildcards only match arrays
+		{"a[*]", "", nil},
+		{"s.x", "", nil},
+	}
+	for _, test := range tests {
+		p := CompilePath(test.expr)
+		first := ""
+		if res := p.Get(v); res != nil {
+			first = String(res)
+		}
+		if first != test.first {
+			t.Errorf("%s: expected the first value %q, got %q", test.expr, test.first, first)
+		}
+		var all []string
+		for _, res := range p.All(v, nil) {
+			all = append(all, String(res))
+		}
+		if strings.Join(all, ",") != strings.Join(test.all, ",") || len(all) != len(test.all) {
+			t.Errorf("%s: expected the values %v, got %v", test.expr, test.all, all)
+		}
+	}
+}
+
+func TestPaths(t *testing.T) {
+	var c Paths
+	p := c.Get("a.b")
+	if len(p) != 2 || c.order.Len() != 1 {
+		t.Fatalf("expected the compiled path to be cached, got %v", p)
+	}
+	c.Get("a.b")
+	if c.order.Len() != 1 {
+		t.Errorf("expected the cached path to be reused, got %d entries", c.order.Len())
+	}
+
+	// the least recently used paths are evicted first
+	for i := 0; i < PathCacheSize; i++ {
+		if i == PathCacheSize/2 {
+			c.Get("a.b")
+		}
+		c.Get(strings.Repeat("x", i+1))
+	}
+	if c.order.Len() != PathCacheSize || len(c.entries) != PathCacheSize {
+		t.Errorf("expected %d entries, got %d", PathCacheSize, c.order.Len())
+	}
+	if _, ok := c.entries["a.b"]; !ok {
+		t.Error("expected the recently used path to be kept")
+	}
+	if _, ok := c.entries["x"]; ok {
+		t.Error("expected the least recently used path to be evicted")
+	}
+}
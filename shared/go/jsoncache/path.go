@@ -0,0 +1,186 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsoncache
+
+import (
+	"container/list"
+	"strings"
+
+	"github.com/valyala/fastjson"
+)
+
+// PathCacheSize is the maximum number of compiled paths kept by Paths,
+// which is far more than the distinct arguments used by a ruleset
+const PathCacheSize = 1024
+
+// Token is a reference token of a compiled path
+type Token struct {
+	// Key is the object key or the array index of the token
+	Key string
+	// Wildcard is true if the token matches all the elements of an
+	// array, in which case Key is empty
+	Wildcard bool
+}
+
+// Path is a path to the values of a JSON document, compiled once from a
+// field argument and walked at each extraction
+type Path []Token
+
+// CompilePath compiles a path, either a JSON pointer (RFC 6901) if it
+// starts with a slash, e.g. /target/0/alternateId, or a dotted path
+// otherwise, e.g. target[0].alternateId. The "*" token and the "[*]" suffix
+// of a token match all the elements of an array.
+func CompilePath(expr string) Path {
+	if strings.HasPrefix(expr, "/") {
+		return compilePointer(expr[1:])
+	}
+	return compileDotted(expr)
+}
+
+func compilePointer(expr string) Path {
+	if expr == "" {
+		return Path{}
+	}
+	keys := strings.Split(expr, "/")
+	res := make(Path, 0, len(keys))
+	for _, key := range keys {
+		if key == "*" {
+			res = append(res, Token{Wildcard: true})
+			continue
+		}
+		// the wildcard suffix matches the elements of the array at the
+		// key, so that it is walked as a token of its own
+		wildcard := strings.HasSuffix(key, "[*]")
+		key = strings.TrimSuffix(key, "[*]")
+		key = strings.Replace(key, "~1", "/", -1)
+		res = append(res, Token{Key: strings.Replace(key, "~0", "~", -1)})
+		if wildcard {
+			res = append(res, Token{Wildcard: true})
+		}
+	}
+	return res
+}
+
+func compileDotted(expr string) Path {
+	var res Path
+	for _, part := range strings.Split(expr, ".") {
+		// the array indices and wildcards follow the key of a part
+		// in brackets, e.g. containers[0] or containers[*]
+		key := part
+		var indices []string
+		if i := strings.IndexByte(part, '['); i >= 0 && strings.HasSuffix(part, "]") {
+			key = part[:i]
+			indices = strings.Split(part[i+1:len(part)-1], "][")
+		}
+		switch {
+		case key == "*":
+			res = append(res, Token{Wildcard: true})
+		case key != "":
+			res = append(res, Token{Key: key})
+		}
+		for _, index := range indices {
+			if index == "*" {
+				res = append(res, Token{Wildcard: true})
+				continue
+			}
+			res = append(res, Token{Key: index})
+		}
+	}
+	return res
+}
+
+// Get returns the first value matched by the path, or nil if none
+func (p Path) Get(v *fastjson.Value) *fastjson.Value {
+	if res := p.walk(v, nil, true); len(res) > 0 {
+		return res[0]
+	}
+	return nil
+}
+
+// All appends to res all the values matched by the path
+func (p Path) All(v *fastjson.Value, res []*fastjson.Value) []*fastjson.Value {
+	return p.walk(v, res, false)
+}
+
+func (p Path) walk(v *fastjson.Value, res []*fastjson.Value, first bool) []*fastjson.Value {
+	for i, t := range p {
+		if !t.Wildcard {
+			// fastjson gets the elements of the arrays by their
+			// index as a key
+			if v = v.Get(t.Key); v == nil {
+				return res
+			}
+			continue
+		}
+		arr, err := v.Array()
+		if err != nil {
+			return res
+		}
+		for _, elem := range arr {
+			n := len(res)
+			res = p[i+1:].walk(elem, res, first)
+			if first && len(res) > n {
+				return res
+			}
+		}
+		return res
+	}
+	return append(res, v)
+}
+
+// Paths is a LRU cache of the paths compiled from the field arguments, so
+// that they are not parsed again at every extraction. The zero value is an
+// empty cache ready to use. Like Cache, it must not be used concurrently.
+type Paths struct {
+	entries map[string]*list.Element
+	order   list.List
+}
+
+type pathEntry struct {
+	expr string
+	path Path
+}
+
+// Get returns the compiled path of an expression, compiling it with
+// CompilePath only if it is not in the cache already
+func (c *Paths) Get(expr string) Path {
+	if e, ok := c.entries[expr]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*pathEntry).path
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+	}
+	path := CompilePath(expr)
+	c.entries[expr] = c.order.PushFront(&pathEntry{expr: expr, path: path})
+	if c.order.Len() > PathCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*pathEntry).expr)
+	}
+	return path
+}
+
+// String returns the string representation of a value, which is its
+// content for the strings and its JSON encoding otherwise
+func String(v *fastjson.Value) string {
+	if v.Type() == fastjson.TypeString {
+		return string(v.GetStringBytes())
+	}
+	return string(v.MarshalTo(nil))
+}
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consumer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// TLSConfig represents the information needed to establish a mTLS
+// connection with the brokers
+type TLSConfig struct {
+	CaCertPath   string `json:"caCertPath" jsonschema:"title=Ca Cert Path,description=Path to the Kafka server's public certificate."`
+	UserCertPath string `json:"userCertPath" jsonschema:"title=User Cert Path,description=Path to the user's public certificate."`
+	UserKeyPath  string `json:"userKeyPath" jsonschema:"title=User Key Path,description=Path to the user's private key."`
+}
+
+// SASLConfig represents the credentials of the SASL authentication to the
+// brokers
+type SASLConfig struct {
+	Mechanism string `json:"mechanism" jsonschema:"title=SASL Mechanism,description=The SASL mechanism among PLAIN and SCRAM-SHA-256 and SCRAM-SHA-512 (default: empty for no SASL authentication).,enum=,enum=PLAIN,enum=SCRAM-SHA-256,enum=SCRAM-SHA-512"`
+	Username  string `json:"username" jsonschema:"title=SASL Username,description=The SASL username."`
+	Password  string `json:"password" secret:"true" jsonschema:"title=SASL Password,description=The SASL password.,writeOnly=true"`
+}
+
+// NewDialer returns the dialer of the brokers with the given
+// authentication, or nil for the default one without authentication
+func NewDialer(tlsConfig TLSConfig, saslConfig SASLConfig) (*kafka.Dialer, error) {
+	t, err := newTLS(tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	m, err := newSASL(saslConfig)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil && m == nil {
+		return nil, nil
+	}
+	dialer := *kafka.DefaultDialer
+	dialer.TLS = t
+	dialer.SASLMechanism = m
+	return &dialer, nil
+}
+
+func newTLS(cfg TLSConfig) (*tls.Config, error) {
+	if len(cfg.CaCertPath) == 0 {
+		return nil, nil
+	}
+
+	caPEM, err := os.ReadFile(cfg.CaCertPath)
+	if err != nil {
+		return nil, err
+	}
+	caCertPool := x509.NewCertPool()
+	if ok := caCertPool.AppendCertsFromPEM(caPEM); !ok {
+		return nil, fmt.Errorf("no certificate found in %s", cfg.CaCertPath)
+	}
+	res := &tls.Config{RootCAs: caCertPool}
+
+	// the client certificate is optional, e.g. with SASL authentication
+	if len(cfg.UserCertPath) > 0 {
+		certificate, err := tls.LoadX509KeyPair(cfg.UserCertPath, cfg.UserKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		res.Certificates = []tls.Certificate{certificate}
+	}
+	return res, nil
+}
+
+func newSASL(cfg SASLConfig) (sasl.Mechanism, error) {
+	switch strings.ToUpper(cfg.Mechanism) {
+	case "":
+		return nil, nil
+	case "PLAIN":
+		return plain.Mechanism{Username: cfg.Username, Password: cfg.Password}, nil
+	case "SCRAM-SHA-256":
+		return scram.Mechanism(scram.SHA256, cfg.Username, cfg.Password)
+	case "SCRAM-SHA-512":
+		return scram.Mechanism(scram.SHA512, cfg.Username, cfg.Password)
+	}
+	return nil, fmt.Errorf("unknown SASL mechanism %q, must be one of PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512", cfg.Mechanism)
+}
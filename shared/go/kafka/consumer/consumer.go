@@ -0,0 +1,186 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package consumer provides the Kafka consumer group shared by the plugins
+// ingesting events from Kafka topics. The consumers of a group split the
+// partitions of the topics between them, and commit the offset of each
+// message once it has been handed to Falco, so that a message is not lost
+// if the plugin stops in between. The partitions are rebalanced by the
+// brokers when consumers join or leave the group.
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/segmentio/kafka-go"
+)
+
+// Config is the configuration of a Group
+type Config struct {
+	Brokers []string
+	GroupID string
+	Topics  []string
+	// TLS and SASL are the optional authentication to the brokers
+	TLS  TLSConfig
+	SASL SASLConfig
+	// Consumers is the number of consumers reading the partitions of the
+	// topics concurrently, at least 1
+	Consumers int
+}
+
+// Handler is notified of the messages of a Group and of its errors
+type Handler struct {
+	// OnFetch is called with each message fetched from the brokers
+	OnFetch func(msg kafka.Message)
+	// OnPush is called with each message once it has been handed to Falco
+	OnPush func(msg kafka.Message)
+	// Decode returns the payload of the event of a message, e.g. decoded
+	// from a binary encoding, or its value if nil
+	Decode func(msg kafka.Message) ([]byte, error)
+	// OnDecodeError is called with the messages Decode fails on, and
+	// returns nil to skip the message, committing its offset, or the error
+	// ending the event stream, which is the one of Decode if nil
+	OnDecodeError func(msg kafka.Message, err error) error
+	// OnError is called with the fetch and commit errors, and returns the
+	// error ending the event stream
+	OnError func(err error) error
+}
+
+// Group is a group of consumers of the same consumer group
+type Group struct {
+	readers []*kafka.Reader
+}
+
+// NewGroup returns a Group of consumers joining the consumer group of the
+// given configuration
+func NewGroup(cfg Config) (*Group, error) {
+	if cfg.Consumers < 1 {
+		return nil, errors.New("consumers must be greater than 0")
+	}
+	dialer, err := NewDialer(cfg.TLS, cfg.SASL)
+	if err != nil {
+		return nil, err
+	}
+	g := &Group{}
+	rc := kafka.ReaderConfig{
+		Brokers:     cfg.Brokers,
+		GroupID:     cfg.GroupID,
+		GroupTopics: cfg.Topics,
+		Dialer:      dialer,
+	}
+	// kafka.NewReader panics with an invalid configuration
+	if err := rc.Validate(); err != nil {
+		return nil, err
+	}
+	for i := 0; i < cfg.Consumers; i++ {
+		g.readers = append(g.readers, kafka.NewReader(rc))
+	}
+	return g, nil
+}
+
+// Events starts consuming and returns the channel of the events of the
+// messages, which is meant to be passed to source.NewPushInstance. Each
+// partition is assigned to a single consumer, so the messages of a
+// partition, and thus the ones sharing the same key, keep their order. A
+// consumer stops at its first error, which is sent on the channel. The
+// channel is closed once all the consumers stop or the context is done.
+func (g *Group) Events(ctx context.Context, h Handler) <-chan source.PushEvent {
+	c := make(chan source.PushEvent)
+
+	fail := func(err error) {
+		if ctx.Err() != nil {
+			return
+		}
+		if h.OnError != nil {
+			err = h.OnError(err)
+		}
+		select {
+		case c <- source.PushEvent{Err: err}:
+		case <-ctx.Done():
+		}
+	}
+
+	consume := func(reader *kafka.Reader) {
+		for {
+			msg, err := reader.FetchMessage(ctx)
+			if err != nil {
+				fail(err)
+				return
+			}
+			if h.OnFetch != nil {
+				h.OnFetch(msg)
+			}
+
+			data, skip := msg.Value, false
+			if h.Decode != nil {
+				data, err = h.Decode(msg)
+				if err != nil && h.OnDecodeError != nil {
+					err, skip = h.OnDecodeError(msg, err), true
+				}
+				if err != nil {
+					fail(err)
+					return
+				}
+			}
+
+			if !skip {
+				select {
+				case c <- source.PushEvent{Data: data, Timestamp: msg.Time}:
+					if h.OnPush != nil {
+						h.OnPush(msg)
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if err := reader.CommitMessages(ctx, msg); err != nil {
+				fail(err)
+				return
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, reader := range g.readers {
+		wg.Add(1)
+		go func(reader *kafka.Reader) {
+			defer wg.Done()
+			consume(reader)
+		}(reader)
+	}
+	go func() {
+		wg.Wait()
+		close(c)
+	}()
+	return c
+}
+
+// Close leaves the consumer group, returning the first error if any
+func (g *Group) Close() error {
+	var res error
+	for _, reader := range g.readers {
+		if err := reader.Close(); err != nil && res == nil {
+			res = err
+		}
+	}
+	g.readers = nil
+	return res
+}
@@ -0,0 +1,8 @@
+module github.com/falcosecurity/plugins/shared/go/kafka/consumer
+
+go 1.16
+
+require (
+	github.com/falcosecurity/plugin-sdk-go v0.7.4
+	github.com/segmentio/kafka-go v0.4.47
+)
@@ -0,0 +1,595 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package loader loads plugins from their shared libraries, and exercises
+// them through their plugin API, like Falco does. It is used by the tools
+// testing and recording the plugins.
+package loader
+
+// note: the loader of the plugin-sdk-go only supports the static symbols of
+// the plugin API, so the loader of falcosecurity/libs is used here along with
+// wrappers around the function pointers of its vtable
+
+/*
+#cgo linux LDFLAGS: -ldl
+
+#include "plugin_loader.h"
+#include <stdlib.h>
+
+uint32_t __plugin_max_errlen = PLUGIN_MAX_ERRLEN;
+
+static const char* __get_str(const char *(*f)())
+{
+	if (!f) return "";
+	return f();
+}
+
+static uint32_t __get_u32(uint32_t (*f)())
+{
+	if (!f) return 0;
+	return f();
+}
+
+static ss_plugin_schema_type __get_init_schema_type(plugin_api* p)
+{
+	ss_plugin_schema_type t = SS_PLUGIN_SCHEMA_NONE;
+	if (p->get_init_schema) p->get_init_schema(&t);
+	return t;
+}
+
+static const char* __get_init_schema(plugin_api* p)
+{
+	ss_plugin_schema_type t = SS_PLUGIN_SCHEMA_NONE;
+	const char* s = NULL;
+	if (p->get_init_schema) s = p->get_init_schema(&t);
+	if (t != SS_PLUGIN_SCHEMA_JSON || !s) return "";
+	return s;
+}
+
+static ss_plugin_t* __init(plugin_api* p, const ss_plugin_init_input *in, ss_plugin_rc *rc)
+{
+	return p->init(in, rc);
+}
+
+static void __destroy(plugin_api* p, ss_plugin_t* s)
+{
+	p->destroy(s);
+}
+
+static const char* __get_last_err(plugin_api* p, ss_plugin_t* s)
+{
+	return p->get_last_error(s);
+}
+
+static ss_instance_t* __open(plugin_api* p, ss_plugin_t* s, const char* o, ss_plugin_rc* r)
+{
+	return p->open(s, o, r);
+}
+
+static void __close(plugin_api* p, ss_plugin_t* s, ss_instance_t* h)
+{
+	p->close(s, h);
+}
+
+static ss_plugin_rc __next_batch(plugin_api* p, ss_plugin_t* s, ss_instance_t* h, uint32_t *n, ss_plugin_event ***e)
+{
+	return p->next_batch(s, h, n, e);
+}
+
+static const char* __event_to_string(plugin_api* p, ss_plugin_t *s, const ss_plugin_event_input *e)
+{
+	if (!p->event_to_string) return "";
+	return p->event_to_string(s, e);
+}
+
+static ss_plugin_rc __extract_fields(plugin_api* p, ss_plugin_t *s, const ss_plugin_event_input *e, ss_plugin_field_extract_input *in)
+{
+	return p->extract_fields(s, e, in);
+}
+
+static ss_plugin_event* __batch_get(ss_plugin_event **e, uint32_t i)
+{
+	return e[i];
+}
+
+static ss_plugin_extract_field* __field_get(ss_plugin_extract_field *f, uint32_t i)
+{
+	return &f[i];
+}
+*/
+import "C"
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+)
+
+const (
+	// evtHeaderSize is the size of the packed ss_plugin_event header
+	evtHeaderSize = 26
+	// pluginEventType is the type of the events generated by plugins
+	pluginEventType = 322
+)
+
+// ErrEOF is returned by NextBatch at the end of the event stream
+var ErrEOF = errors.New("EOF")
+
+// Plugin is a plugin loaded from a shared library, which is exercised
+// through the function pointers of its plugin API vtable
+type Plugin struct {
+	handle   *C.plugin_handle_t
+	state    *C.ss_plugin_t
+	instance *C.ss_instance_t
+	caps     C.plugin_caps_t
+	evtSrc   *C.char
+
+	Name        string
+	Version     string
+	ID          uint32
+	EventSource string
+	Fields      []sdk.FieldEntry
+}
+
+// Event is an event returned by NextBatch. Its memory belongs to the
+// plugin until the next call to NextBatch.
+type Event struct {
+	Num       uint64
+	Timestamp time.Time
+	Data      []byte
+	evt       *C.ss_plugin_event
+}
+
+// Field is a field requested for extraction, e.g. foo.bar or foo.bar[arg]
+type Field struct {
+	Name     string
+	Arg      string
+	ArgIndex uint64
+	HasArg   bool
+	Entry    sdk.FieldEntry
+	id       uint32
+}
+
+// LoadPlugin loads the plugin shared library at the given path
+func LoadPlugin(path string) (*Plugin, error) {
+	errBuf := (*C.char)(C.malloc(C.size_t(C.__plugin_max_errlen)))
+	defer C.free(unsafe.Pointer(errBuf))
+
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	p := &Plugin{}
+	p.handle = C.plugin_load(cPath, errBuf)
+	if p.handle == nil {
+		return nil, errors.New(C.GoString(errBuf))
+	}
+	if !C.plugin_check_required_api_version(p.handle, errBuf) ||
+		!C.plugin_check_required_symbols(p.handle, errBuf) {
+		p.Unload()
+		return nil, errors.New(C.GoString(errBuf))
+	}
+	// a capability can be reported as broken while the others are
+	// usable, e.g. with extraction-only plugins built with the Go SDK
+	p.caps = C.plugin_get_capabilities(p.handle, errBuf)
+	if p.caps&(C.CAP_SOURCING|C.CAP_EXTRACTION) == 0 {
+		err := errors.New("plugin supports no capability")
+		if p.caps&C.CAP_BROKEN != 0 {
+			err = fmt.Errorf("%s, %s", err.Error(), C.GoString(errBuf))
+		}
+		p.Unload()
+		return nil, err
+	}
+
+	p.Name = C.GoString(C.__get_str(p.handle.api.get_name))
+	p.Version = C.GoString(C.__get_str(p.handle.api.get_version))
+	p.ID = uint32(C.__get_u32(p.handle.api.anon0.get_id))
+	p.EventSource = C.GoString(C.__get_str(p.handle.api.anon0.get_event_source))
+	p.evtSrc = C.CString(p.EventSource)
+	if p.HasCapExtraction() {
+		str := C.GoString(C.__get_str(p.handle.api.anon1.get_fields))
+		if err := json.Unmarshal([]byte(str), &p.Fields); err != nil {
+			p.Unload()
+			return nil, fmt.Errorf("get_fields does not return a well-formed json array: %s", err.Error())
+		}
+	}
+	return p, nil
+}
+
+// Info is the info of a plugin, read without initializing it
+type Info struct {
+	Name               string
+	Version            string
+	RequiredAPIVersion string
+}
+
+// LoadInfo reads the info of the plugin shared library at the given path.
+// Unlike LoadPlugin, it doesn't check that the plugin API version required
+// by the plugin is supported by the loader.
+func LoadInfo(path string) (*Info, error) {
+	errBuf := (*C.char)(C.malloc(C.size_t(C.__plugin_max_errlen)))
+	defer C.free(unsafe.Pointer(errBuf))
+
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	h := C.plugin_load(cPath, errBuf)
+	if h == nil {
+		return nil, errors.New(C.GoString(errBuf))
+	}
+	defer C.plugin_unload(h)
+	return &Info{
+		Name:               C.GoString(C.__get_str(h.api.get_name)),
+		Version:            C.GoString(C.__get_str(h.api.get_version)),
+		RequiredAPIVersion: C.GoString(C.__get_str(h.api.get_required_api_version)),
+	}, nil
+}
+
+// SetEventSource sets the source of the events passed to the plugin for
+// field extraction, which defaults to the one of the plugin
+func (p *Plugin) SetEventSource(src string) {
+	C.free(unsafe.Pointer(p.evtSrc))
+	p.EventSource = src
+	p.evtSrc = C.CString(src)
+}
+
+// HasCapSourcing returns true if the plugin supports the event sourcing
+// capability
+func (p *Plugin) HasCapSourcing() bool {
+	return p.caps&C.CAP_SOURCING != 0
+}
+
+// HasCapExtraction returns true if the plugin supports the field extraction
+// capability
+func (p *Plugin) HasCapExtraction() bool {
+	return p.caps&C.CAP_EXTRACTION != 0
+}
+
+// InitSchema returns the json schema of the init config of the plugin, or
+// an empty string if the plugin has none
+func (p *Plugin) InitSchema() string {
+	return C.GoString(C.__get_init_schema(&p.handle.api))
+}
+
+// Init initializes the plugin with the given config. Like in Falco, an
+// empty config is passed as an empty json object to the plugins having a
+// json schema.
+func (p *Plugin) Init(config string) error {
+	if len(config) == 0 && C.__get_init_schema_type(&p.handle.api) == C.SS_PLUGIN_SCHEMA_JSON {
+		config = "{}"
+	}
+	in := C.ss_plugin_init_input{}
+	in.config = C.CString(config)
+	defer C.free(unsafe.Pointer(in.config))
+	rc := C.ss_plugin_rc(sdk.SSPluginSuccess)
+	p.state = (*C.ss_plugin_t)(C.__init(&p.handle.api, &in, &rc))
+	if rc != C.ss_plugin_rc(sdk.SSPluginSuccess) {
+		// the state is not destroyed, since the Go SDK panics when
+		// destroying a plugin whose init failed
+		err := p.lastError()
+		p.state = nil
+		return err
+	}
+	return nil
+}
+
+// Open opens an event stream with the given open params
+func (p *Plugin) Open(params string) error {
+	if !p.HasCapSourcing() {
+		return errors.New("plugin does not support event sourcing capability")
+	}
+	cParams := C.CString(params)
+	defer C.free(unsafe.Pointer(cParams))
+	rc := C.ss_plugin_rc(sdk.SSPluginSuccess)
+	p.instance = (*C.ss_instance_t)(C.__open(&p.handle.api, unsafe.Pointer(p.state), cParams, &rc))
+	if rc != C.ss_plugin_rc(sdk.SSPluginSuccess) {
+		p.instance = nil
+		return p.lastError()
+	}
+	return nil
+}
+
+// NextBatch returns the next batch of events of the open event stream.
+// It returns sdk.ErrTimeout if no event is available yet, and ErrEOF
+// along with the last events once the stream is over.
+func (p *Plugin) NextBatch(evtNum uint64) ([]Event, error) {
+	var n C.uint32_t
+	var evts **C.ss_plugin_event
+	rc := C.__next_batch(&p.handle.api, unsafe.Pointer(p.state), unsafe.Pointer(p.instance), &n, &evts)
+	switch int32(rc) {
+	case sdk.SSPluginSuccess:
+	case sdk.SSPluginTimeout:
+		if n == 0 {
+			return nil, sdk.ErrTimeout
+		}
+	case sdk.SSPluginEOF:
+	default:
+		return nil, p.lastError()
+	}
+
+	res := make([]Event, 0, int(n))
+	for i := C.uint32_t(0); i < n; i++ {
+		evt := C.__batch_get(evts, i)
+		res = append(res, Event{
+			Num:       evtNum + uint64(i),
+			Timestamp: time.Unix(0, int64(evt.ts)),
+			Data:      eventData(C.GoBytes(unsafe.Pointer(evt), C.int(evt.len))),
+			evt:       evt,
+		})
+	}
+	if int32(rc) == sdk.SSPluginEOF {
+		return res, ErrEOF
+	}
+	return res, nil
+}
+
+// eventData returns the payload of a raw plugin event, which is its second
+// parameter after the plugin ID. The header is read byte by byte since it
+// is packed and not all its members are visible from Go.
+func eventData(raw []byte) []byte {
+	if len(raw) < evtHeaderSize {
+		return nil
+	}
+	nparams := int(binary.LittleEndian.Uint32(raw[evtHeaderSize-4:]))
+	if nparams < 2 || len(raw) < evtHeaderSize+4*nparams {
+		return nil
+	}
+	lens := raw[evtHeaderSize : evtHeaderSize+4*nparams]
+	offset := evtHeaderSize + 4*nparams + int(binary.LittleEndian.Uint32(lens[0:]))
+	size := int(binary.LittleEndian.Uint32(lens[4:]))
+	if offset+size > len(raw) {
+		return nil
+	}
+	return raw[offset : offset+size]
+}
+
+// NewEvent returns a plugin event with the given payload, which lets
+// extract from events that don't come from the plugin itself. The event
+// must be released with Free.
+func (p *Plugin) NewEvent(num uint64, ts time.Time, data []byte) *Event {
+	size := evtHeaderSize + 4*2 + 4 + len(data)
+	raw := make([]byte, size)
+	binary.LittleEndian.PutUint64(raw[0:], uint64(ts.UnixNano()))
+	binary.LittleEndian.PutUint64(raw[8:], ^uint64(0))
+	binary.LittleEndian.PutUint32(raw[16:], uint32(size))
+	binary.LittleEndian.PutUint16(raw[20:], pluginEventType)
+	binary.LittleEndian.PutUint32(raw[22:], 2)
+	binary.LittleEndian.PutUint32(raw[26:], 4)
+	binary.LittleEndian.PutUint32(raw[30:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(raw[34:], p.ID)
+	copy(raw[38:], data)
+	return &Event{
+		Num:       num,
+		Timestamp: ts,
+		Data:      data,
+		evt:       (*C.ss_plugin_event)(C.CBytes(raw)),
+	}
+}
+
+// Free releases an event returned by NewEvent
+func (e *Event) Free() {
+	C.free(unsafe.Pointer(e.evt))
+	e.evt = nil
+}
+
+func (p *Plugin) eventInput(e *Event) C.ss_plugin_event_input {
+	in := C.ss_plugin_event_input{}
+	in.evt = e.evt
+	in.evtnum = C.uint64_t(e.Num)
+	in.evtsrc = p.evtSrc
+	return in
+}
+
+// EventToString returns the string representation of an event, if the
+// plugin provides one
+func (p *Plugin) EventToString(e *Event) string {
+	in := p.eventInput(e)
+	return C.GoString(C.__event_to_string(&p.handle.api, unsafe.Pointer(p.state), &in))
+}
+
+// ParseField parses a field of the plugin in the form foo.bar or
+// foo.bar[arg]
+func (p *Plugin) ParseField(s string) (*Field, error) {
+	f := &Field{Name: s}
+	if i := strings.Index(s, "["); i > 0 && strings.HasSuffix(s, "]") {
+		f.Name = s[:i]
+		f.Arg = s[i+1 : len(s)-1]
+		f.HasArg = true
+	}
+	for i, entry := range p.Fields {
+		if entry.Name != f.Name {
+			continue
+		}
+		f.Entry = entry
+		f.id = uint32(i)
+		if f.HasArg && !entry.Arg.IsKey && !entry.Arg.IsIndex {
+			return nil, fmt.Errorf("field %s does not accept an argument", f.Name)
+		}
+		if !f.HasArg && entry.Arg.IsRequired {
+			return nil, fmt.Errorf("field %s requires an argument", f.Name)
+		}
+		if f.HasArg && entry.Arg.IsIndex {
+			idx, err := strconv.ParseUint(f.Arg, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("field %s requires a numeric argument", f.Name)
+			}
+			f.ArgIndex = idx
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("field %s is not supported by the plugin", f.Name)
+}
+
+// Extract extracts the given fields from an event. A nil value means that
+// the field could not be extracted from it.
+func (p *Plugin) Extract(e *Event, fields []*Field) ([][]string, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	cFields := (*C.ss_plugin_extract_field)(C.calloc(C.size_t(len(fields)), C.sizeof_ss_plugin_extract_field))
+	defer C.free(unsafe.Pointer(cFields))
+	var cStrs []*C.char
+	defer func() {
+		for _, s := range cStrs {
+			C.free(unsafe.Pointer(s))
+		}
+	}()
+
+	for i, f := range fields {
+		cf := C.__field_get(cFields, C.uint32_t(i))
+		cf.field_id = C.uint32_t(f.id)
+		cf.field = C.CString(f.Name)
+		cStrs = append(cStrs, cf.field)
+		if f.HasArg {
+			cf.arg_present = C.ss_plugin_bool(1)
+			if f.Entry.Arg.IsKey {
+				cf.arg_key = C.CString(f.Arg)
+				cStrs = append(cStrs, cf.arg_key)
+			} else {
+				cf.arg_index = C.uint64_t(f.ArgIndex)
+			}
+		}
+		cf.ftype = C.uint32_t(fieldType(f.Entry.Type))
+		if f.Entry.IsList {
+			cf.flist = C.ss_plugin_bool(1)
+		}
+	}
+
+	// the fields are extracted one at a time like Falco does, since the
+	// plugins can reuse the memory of the values of a same field
+	evtIn := p.eventInput(e)
+	res := make([][]string, len(fields))
+	for i, f := range fields {
+		cf := C.__field_get(cFields, C.uint32_t(i))
+		in := C.ss_plugin_field_extract_input{}
+		in.num_fields = 1
+		in.fields = cf
+		rc := C.__extract_fields(&p.handle.api, unsafe.Pointer(p.state), &evtIn, &in)
+		if rc != C.ss_plugin_rc(sdk.SSPluginSuccess) {
+			return nil, p.lastError()
+		}
+		if cf.res_len > 0 {
+			res[i] = fieldValues(cf, fieldType(f.Entry.Type))
+		}
+	}
+	return res, nil
+}
+
+func fieldType(t string) uint32 {
+	switch t {
+	case "uint64":
+		return sdk.FieldTypeUint64
+	case "reltime":
+		return sdk.FieldTypeRelTime
+	case "abstime":
+		return sdk.FieldTypeAbsTime
+	case "bool":
+		return sdk.FieldTypeBool
+	case "ipaddr":
+		return sdk.FieldTypeIPAddr
+	case "ipnet":
+		return sdk.FieldTypeIPNet
+	default:
+		return sdk.FieldTypeCharBuf
+	}
+}
+
+// fieldValues returns the values extracted in a ss_plugin_extract_field,
+// whose res member is a union of pointers to arrays
+func fieldValues(cf *C.ss_plugin_extract_field, ftype uint32) []string {
+	n := int(cf.res_len)
+	res := make([]string, 0, n)
+	ptr := *(*unsafe.Pointer)(unsafe.Pointer(&cf.res))
+	switch ftype {
+	case sdk.FieldTypeCharBuf:
+		for _, s := range unsafe.Slice((**C.char)(ptr), n) {
+			res = append(res, C.GoString(s))
+		}
+	case sdk.FieldTypeUint64:
+		for _, v := range unsafe.Slice((*uint64)(ptr), n) {
+			res = append(res, strconv.FormatUint(v, 10))
+		}
+	case sdk.FieldTypeRelTime:
+		for _, v := range unsafe.Slice((*uint64)(ptr), n) {
+			res = append(res, time.Duration(v).String())
+		}
+	case sdk.FieldTypeAbsTime:
+		for _, v := range unsafe.Slice((*uint64)(ptr), n) {
+			res = append(res, time.Unix(0, int64(v)).UTC().Format(time.RFC3339Nano))
+		}
+	case sdk.FieldTypeBool:
+		for _, v := range unsafe.Slice((*uint32)(ptr), n) {
+			res = append(res, strconv.FormatBool(v != 0))
+		}
+	case sdk.FieldTypeIPAddr, sdk.FieldTypeIPNet:
+		for _, b := range unsafe.Slice((*C.ss_plugin_byte_buffer)(ptr), n) {
+			res = append(res, net.IP(C.GoBytes(b.ptr, C.int(b.len))).String())
+		}
+	}
+	return res
+}
+
+// Close closes the open event stream, if any
+func (p *Plugin) Close() {
+	if p.instance != nil {
+		C.__close(&p.handle.api, unsafe.Pointer(p.state), unsafe.Pointer(p.instance))
+		p.instance = nil
+	}
+}
+
+// Destroy closes the event stream and destroys the plugin state, after
+// which the plugin can be initialized again
+func (p *Plugin) Destroy() {
+	p.Close()
+	p.destroy()
+}
+
+// Unload closes the event stream, destroys the plugin and unloads the
+// shared library
+func (p *Plugin) Unload() {
+	p.Destroy()
+	if p.evtSrc != nil {
+		C.free(unsafe.Pointer(p.evtSrc))
+		p.evtSrc = nil
+	}
+	if p.handle != nil {
+		C.plugin_unload(p.handle)
+		p.handle = nil
+	}
+}
+
+func (p *Plugin) destroy() {
+	if p.state != nil {
+		C.__destroy(&p.handle.api, unsafe.Pointer(p.state))
+		p.state = nil
+	}
+}
+
+func (p *Plugin) lastError() error {
+	if p.state == nil {
+		return errors.New("unknown initialization error")
+	}
+	str := C.GoString(C.__get_last_err(&p.handle.api, unsafe.Pointer(p.state)))
+	if len(str) == 0 {
+		return errors.New("unknown error")
+	}
+	return errors.New(str)
+}
@@ -0,0 +1,10 @@
+module github.com/falcosecurity/plugins/shared/go/metrics
+
+go 1.15
+
+require (
+	github.com/falcosecurity/plugin-sdk-go v0.7.3
+	github.com/falcosecurity/plugins/shared/go/mux v0.0.0-00010101000000-000000000000
+)
+
+replace github.com/falcosecurity/plugins/shared/go/mux => ../mux
@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync/atomic"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+)
+
+// instance records the batches returned by the instance it wraps
+type instance struct {
+	source.Instance
+	m *Metrics
+}
+
+func (i *instance) NextBatch(pState sdk.PluginState, evts sdk.EventWriters) (int, error) {
+	n, err := i.Instance.NextBatch(pState, evts)
+	if n > 0 {
+		atomic.AddUint64(&i.m.batches, 1)
+	}
+	return n, err
+}
+
+func (i *instance) Close() {
+	if c, ok := i.Instance.(sdk.Closer); ok {
+		c.Close()
+	}
+}
+
+// progressInstance is an instance whose wrapped instance reports its
+// progress
+type progressInstance struct {
+	*instance
+	sdk.Progresser
+}
+
+// Instance returns an instance recording in m the batches of events returned
+// by inst, e.g. return metrics.Instance(inst, p.metrics) at the end of Open.
+// The optional interfaces of inst are kept, and a nil m returns inst as it
+// is.
+func Instance(inst source.Instance, m *Metrics) source.Instance {
+	if m == nil || inst == nil {
+		return inst
+	}
+	i := &instance{Instance: inst, m: m}
+	if p, ok := inst.(sdk.Progresser); ok {
+		return &progressInstance{instance: i, Progresser: p}
+	}
+	return i
+}
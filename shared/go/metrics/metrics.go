@@ -0,0 +1,278 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics provides the Prometheus metrics shared by all the plugins,
+// with a consistent naming scheme and a plugin label:
+//
+//   - falco_plugin_events_total: the events ingested
+//   - falco_plugin_bytes_total: the bytes of the events ingested
+//   - falco_plugin_batches_total: the batches of events returned to Falco,
+//     recorded by the instances wrapped with Instance
+//   - falco_plugin_upstream_errors_total: the errors reading from upstream
+//   - falco_plugin_errors_total: the errors by category, labeled with kind
+//   - falco_plugin_dead_letters_total: the records routed to the dead-letter
+//     sink of the plugin, see the dlq package
+//   - falco_plugin_ingestion_lag_seconds: the delay between the timestamp of
+//     the last event and its ingestion
+//   - falco_plugin_extraction_duration_seconds: the latency of the field
+//     extractions
+//
+// All the plugins of a Falco process are exposed on a single endpoint, by
+// configuring them with the same address. Since each plugin runs its own Go
+// runtime, the first plugin to listen on the address serves the endpoint,
+// and the other ones register with it a loopback listener from which their
+// metrics are collected at each scrape, see Start.
+package metrics
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultPath is the path of the endpoint when none is configured
+	DefaultPath = "/metrics"
+
+	namespace = "falco_plugin_"
+)
+
+// extractionBuckets are the upper bounds of the buckets of the extraction
+// latency histogram, in seconds
+var extractionBuckets = []float64{1e-6, 2.5e-6, 5e-6, 1e-5, 2.5e-5, 5e-5, 1e-4, 2.5e-4, 5e-4, 1e-3, 1e-2}
+
+// Metrics holds the metrics of a plugin. A nil *Metrics records nothing, so
+// that the plugins can record their metrics unconditionally when the
+// endpoint is disabled.
+type Metrics struct {
+	plugin    string
+	srv       *server
+	events    uint64
+	bytes     uint64
+	batches   uint64
+	errors    uint64
+	dead      uint64
+	lag       int64
+	extracts  uint64
+	extractNs uint64
+	buckets   []uint64
+	failures  sync.Map // kind -> *uint64
+}
+
+// Start returns the metrics of a plugin, exposed on the endpoint at
+// addr, e.g. :9090, and path, or DefaultPath if empty. The plugins of a
+// Falco process configured with the same address share the endpoint, and
+// the address can be shared with the health endpoint of the plugin.
+func Start(addr, path, plugin string) (*Metrics, error) {
+	if len(path) == 0 {
+		path = DefaultPath
+	}
+	m := &Metrics{
+		plugin:  plugin,
+		buckets: make([]uint64, len(extractionBuckets)),
+	}
+	srv, err := register(addr, path, m)
+	if err != nil {
+		return nil, err
+	}
+	m.srv = srv
+	return m, nil
+}
+
+// Close stops exposing the metrics
+func (m *Metrics) Close() error {
+	if m == nil {
+		return nil
+	}
+	return m.srv.unregister(m)
+}
+
+// Ingested records an event of the given size, produced at the given time
+// if known
+func (m *Metrics) Ingested(size int, timestamp time.Time) {
+	if m == nil {
+		return
+	}
+	atomic.AddUint64(&m.events, 1)
+	atomic.AddUint64(&m.bytes, uint64(size))
+	if !timestamp.IsZero() {
+		atomic.StoreInt64(&m.lag, int64(time.Since(timestamp)))
+	}
+}
+
+// UpstreamError records an error reading from the upstream of the plugin
+func (m *Metrics) UpstreamError() {
+	if m == nil {
+		return
+	}
+	atomic.AddUint64(&m.errors, 1)
+}
+
+// Failure records an error of the given category, see the errkind package
+func (m *Metrics) Failure(kind string) {
+	if m == nil {
+		return
+	}
+	v, ok := m.failures.Load(kind)
+	if !ok {
+		v, _ = m.failures.LoadOrStore(kind, new(uint64))
+	}
+	atomic.AddUint64(v.(*uint64), 1)
+}
+
+// DeadLetter records a record routed to the dead-letter sink of the plugin
+func (m *Metrics) DeadLetter() {
+	if m == nil {
+		return
+	}
+	atomic.AddUint64(&m.dead, 1)
+}
+
+// ObserveExtraction records a field extraction started at the given time.
+// It's meant to be deferred at the beginning of the extraction, e.g.
+// defer m.ObserveExtraction(time.Now()), only when the metrics are enabled
+// to not pay for reading the clock otherwise.
+func (m *Metrics) ObserveExtraction(start time.Time) {
+	if m == nil {
+		return
+	}
+	d := time.Since(start)
+	atomic.AddUint64(&m.extracts, 1)
+	atomic.AddUint64(&m.extractNs, uint64(d))
+	s := d.Seconds()
+	for i, le := range extractionBuckets {
+		if s <= le {
+			atomic.AddUint64(&m.buckets[i], 1)
+			break
+		}
+	}
+}
+
+// sample is a value of a metric family, as collected from a plugin
+type sample struct {
+	Name   string  `json:"name"`
+	Labels string  `json:"labels"`
+	Value  float64 `json:"value"`
+}
+
+// family is a metric family along with its samples
+type family struct {
+	Name    string   `json:"name"`
+	Help    string   `json:"help"`
+	Type    string   `json:"type"`
+	Samples []sample `json:"samples"`
+}
+
+// families returns the current values of the metrics
+func (m *Metrics) families() []family {
+	label := `plugin="` + escapeLabel(m.plugin) + `"`
+	counter := func(name, help string, v uint64) family {
+		return family{Name: namespace + name, Help: help, Type: "counter",
+			Samples: []sample{{Name: namespace + name, Labels: label, Value: float64(v)}}}
+	}
+
+	res := []family{
+		counter("events_total", "Events ingested by the plugin.", atomic.LoadUint64(&m.events)),
+		counter("bytes_total", "Bytes of the events ingested by the plugin.", atomic.LoadUint64(&m.bytes)),
+		counter("batches_total", "Batches of events returned by the plugin to Falco.", atomic.LoadUint64(&m.batches)),
+		counter("upstream_errors_total", "Errors of the plugin reading from its upstream.", atomic.LoadUint64(&m.errors)),
+		counter("dead_letters_total", "Records routed by the plugin to its dead-letter sink.", atomic.LoadUint64(&m.dead)),
+		{Name: namespace + "ingestion_lag_seconds", Help: "Delay between the timestamp of the last event ingested by the plugin and its ingestion.", Type: "gauge",
+			Samples: []sample{{Name: namespace + "ingestion_lag_seconds", Labels: label, Value: time.Duration(atomic.LoadInt64(&m.lag)).Seconds()}}},
+	}
+
+	failures := family{Name: namespace + "errors_total", Help: "Errors of the plugin by category.", Type: "counter"}
+	m.failures.Range(func(k, v interface{}) bool {
+		failures.Samples = append(failures.Samples, sample{Name: failures.Name, Labels: label + `,kind="` + escapeLabel(k.(string)) + `"`, Value: float64(atomic.LoadUint64(v.(*uint64)))})
+		return true
+	})
+	if len(failures.Samples) > 0 {
+		sort.Slice(failures.Samples, func(i, j int) bool { return failures.Samples[i].Labels < failures.Samples[j].Labels })
+		res = append(res, failures)
+	}
+
+	name := namespace + "extraction_duration_seconds"
+	hist := family{Name: name, Help: "Latency of the field extractions of the plugin.", Type: "histogram"}
+	var cumulative uint64
+	for i, le := range extractionBuckets {
+		cumulative += atomic.LoadUint64(&m.buckets[i])
+		hist.Samples = append(hist.Samples, sample{Name: name + "_bucket", Labels: label + `,le="` + formatFloat(le) + `"`, Value: float64(cumulative)})
+	}
+	count := atomic.LoadUint64(&m.extracts)
+	hist.Samples = append(hist.Samples,
+		sample{Name: name + "_bucket", Labels: label + `,le="+Inf"`, Value: float64(count)},
+		sample{Name: name + "_sum", Labels: label, Value: time.Duration(atomic.LoadUint64(&m.extractNs)).Seconds()},
+		sample{Name: name + "_count", Labels: label, Value: float64(count)})
+	return append(res, hist)
+}
+
+// merge merges the samples of the families sharing the same name, which
+// must appear only once in the exposition format
+func merge(fams []family) []family {
+	var res []family
+	index := map[string]int{}
+	for _, f := range fams {
+		if i, ok := index[f.Name]; ok {
+			res[i].Samples = append(res[i].Samples, f.Samples...)
+			continue
+		}
+		index[f.Name] = len(res)
+		res = append(res, f)
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// appendText appends the families in the Prometheus text exposition format
+func appendText(b []byte, fams []family) []byte {
+	for _, f := range fams {
+		b = append(b, "# HELP "...)
+		b = append(b, f.Name...)
+		b = append(b, ' ')
+		b = append(b, f.Help...)
+		b = append(b, "\n# TYPE "...)
+		b = append(b, f.Name...)
+		b = append(b, ' ')
+		b = append(b, f.Type...)
+		b = append(b, '\n')
+		for _, s := range f.Samples {
+			b = append(b, s.Name...)
+			if len(s.Labels) > 0 {
+				b = append(b, '{')
+				b = append(b, s.Labels...)
+				b = append(b, '}')
+			}
+			b = append(b, ' ')
+			b = append(b, formatFloat(s.Value)...)
+			b = append(b, '\n')
+		}
+	}
+	return b
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
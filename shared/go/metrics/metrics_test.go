@@ -0,0 +1,259 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+)
+
+// newTestMetrics returns metrics that are not exposed on any endpoint
+func newTestMetrics(plugin string) *Metrics {
+	return &Metrics{plugin: plugin, buckets: make([]uint64, len(extractionBuckets))}
+}
+
+// testInstance is an instance returning batches of n events
+type testInstance struct {
+	source.BaseInstance
+	n      int
+	closed bool
+}
+
+func (i *testInstance) NextBatch(pState sdk.PluginState, evts sdk.EventWriters) (int, error) {
+	if i.n == 0 {
+		return 0, sdk.ErrTimeout
+	}
+	return i.n, nil
+}
+
+func (i *testInstance) Close() {
+	i.closed = true
+}
+
+type testProgressInstance struct {
+	testInstance
+}
+
+func (i *testProgressInstance) Progress(pState sdk.PluginState) (float64, string) {
+	return 0.5, "50%"
+}
+
+func TestText(t *testing.T) {
+	m := newTestMetrics(`te"st`)
+	m.Ingested(10, time.Time{})
+	m.Ingested(5, time.Now().Add(-2*time.Second))
+	m.UpstreamError()
+	m.Failure("auth")
+	m.Failure("auth")
+	m.Failure("parse")
+	m.DeadLetter()
+	m.ObserveExtraction(time.Now())
+	m.ObserveExtraction(time.Now().Add(-time.Second))
+	text := string(appendText(nil, merge(m.families())))
+
+	label := `{plugin="te\"st"}`
+	for _, expected := range []string{
+		"# HELP falco_plugin_events_total Events ingested by the plugin.\n# TYPE falco_plugin_events_total counter\nfalco_plugin_events_total" + label + " 2\n",
+		"falco_plugin_bytes_total" + label + " 15\n",
+		"falco_plugin_batches_total" + label + " 0\n",
+		"falco_plugin_upstream_errors_total" + label + " 1\n",
+		"falco_plugin_dead_letters_total" + label + " 1\n",
+		"# TYPE falco_plugin_errors_total counter\nfalco_plugin_errors_total{plugin=\"te\\\"st\",kind=\"auth\"} 2\nfalco_plugin_errors_total{plugin=\"te\\\"st\",kind=\"parse\"} 1\n",
+		"# TYPE falco_plugin_ingestion_lag_seconds gauge\n",
+		"# TYPE falco_plugin_extraction_duration_seconds histogram\n",
+		"falco_plugin_extraction_duration_seconds_bucket{plugin=\"te\\\"st\",le=\"1e-06\"} ",
+		"falco_plugin_extraction_duration_seconds_bucket{plugin=\"te\\\"st\",le=\"0.01\"} 1\n",
+		"falco_plugin_extraction_duration_seconds_bucket{plugin=\"te\\\"st\",le=\"+Inf\"} 2\n",
+		"falco_plugin_extraction_duration_seconds_count" + label + " 2\n",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("expected %q in:\n%s", expected, text)
+		}
+	}
+	if lag := m.families()[5].Samples[0].Value; lag < 2 || lag > 60 {
+		t.Errorf("expected the lag of the last event, got %v", lag)
+	}
+	if !strings.HasPrefix(text, "# HELP falco_plugin_batches_total") {
+		t.Errorf("expected the families to be sorted by name, got:\n%s", text)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a, b := newTestMetrics("a"), newTestMetrics("b")
+	b.Failure("auth")
+	text := string(appendText(nil, merge(append(a.families(), b.families()...))))
+
+	// each family appears once, with the samples of both plugins
+	if n := strings.Count(text, "# TYPE falco_plugin_events_total"); n != 1 {
+		t.Errorf("expected the family once, got %d times", n)
+	}
+	if !strings.Contains(text, "falco_plugin_events_total{plugin=\"a\"} 0\nfalco_plugin_events_total{plugin=\"b\"} 0\n") {
+		t.Errorf("expected the samples of both plugins in:\n%s", text)
+	}
+	if !strings.Contains(text, "falco_plugin_errors_total{plugin=\"b\",kind=\"auth\"} 1\n") {
+		t.Errorf("expected the errors of b in:\n%s", text)
+	}
+}
+
+func TestNil(t *testing.T) {
+	var m *Metrics
+	m.Ingested(1, time.Now())
+	m.UpstreamError()
+	m.Failure("auth")
+	m.DeadLetter()
+	m.ObserveExtraction(time.Now())
+	if err := m.Close(); err != nil {
+		t.Error(err)
+	}
+	inst := &testInstance{}
+	if Instance(inst, nil) != inst {
+		t.Error("expected the instance to be returned as it is")
+	}
+}
+
+func TestInstance(t *testing.T) {
+	m := newTestMetrics("test")
+	inst := &testInstance{n: 2}
+	wrapped := Instance(inst, m)
+	if _, ok := wrapped.(sdk.Progresser); ok {
+		t.Error("expected the wrapped instance not to report its progress")
+	}
+	wrapped.NextBatch(nil, nil)
+	wrapped.NextBatch(nil, nil)
+	inst.n = 0
+	if _, err := wrapped.NextBatch(nil, nil); !errors.Is(err, sdk.ErrTimeout) {
+		t.Errorf("expected the error of the instance, got %v", err)
+	}
+	if m.batches != 2 {
+		t.Errorf("expected the non-empty batches to be counted, got %d", m.batches)
+	}
+	wrapped.(sdk.Closer).Close()
+	if !inst.closed {
+		t.Error("expected the instance to be closed")
+	}
+
+	// the optional interfaces are kept
+	p := Instance(&testProgressInstance{}, m)
+	if pr, ok := p.(sdk.Progresser); !ok {
+		t.Error("expected the wrapped instance to report its progress")
+	} else if v, s := pr.Progress(nil); v != 0.5 || s != "50%" {
+		t.Errorf("expected the progress of the instance, got %v %s", v, s)
+	}
+}
+
+func TestFollower(t *testing.T) {
+	// the endpoint served by the plugin of another Go runtime, whose
+	// listener is not shared with the plugins of this one
+	leader := &server{path: DefaultPath, metrics: map[*Metrics]struct{}{}, targets: map[string]struct{}{}, leader: true}
+	a := newTestMetrics("a")
+	a.Ingested(1, time.Time{})
+	leader.metrics[a] = struct{}{}
+	mux := http.NewServeMux()
+	mux.HandleFunc(DefaultPath, leader.serveMetrics)
+	mux.HandleFunc(DefaultPath+"/targets", leader.serveTargets)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+
+	// the plugin registers as a follower, whose metrics are collected at
+	// each scrape
+	b, err := Start(addr, "", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.srv.leader || len(leader.targets) != 1 {
+		t.Fatalf("expected the plugin to register as a follower, got %v", leader.targets)
+	}
+	b.Ingested(1, time.Time{})
+	b.Ingested(1, time.Time{})
+	status, body := get(addr, DefaultPath)
+	if status != http.StatusOK || !strings.Contains(body, "falco_plugin_events_total{plugin=\"a\"} 1\nfalco_plugin_events_total{plugin=\"b\"} 2\n") {
+		t.Errorf("expected the metrics of both plugins, got %d:\n%s", status, body)
+	}
+
+	// the follower unregisters when closed
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(leader.targets) != 0 {
+		t.Errorf("expected the follower to unregister, got %v", leader.targets)
+	}
+
+	// the followers that stopped are removed at the next scrape
+	leader.targets["127.0.0.1:1"] = struct{}{}
+	if status, _ := get(addr, DefaultPath); status != http.StatusOK || len(leader.targets) != 0 {
+		t.Errorf("expected the unreachable follower to be removed, got %d %v", status, leader.targets)
+	}
+}
+
+func TestServeTargets(t *testing.T) {
+	s := &server{targets: map[string]struct{}{}}
+	tests := []struct {
+		method   string
+		remote   string
+		body     string
+		expected int
+	}{
+		{"POST", "127.0.0.1:1234", "127.0.0.1:5000", http.StatusNoContent},
+		{"POST", "127.0.0.1:1234", "10.0.0.1:5000", http.StatusBadRequest},
+		{"POST", "127.0.0.1:1234", "localhost:5000", http.StatusBadRequest},
+		{"POST", "127.0.0.1:1234", strings.Repeat("1", 300), http.StatusBadRequest},
+		{"POST", "10.0.0.2:1234", "127.0.0.1:5001", http.StatusForbidden},
+		{"PUT", "127.0.0.1:1234", "127.0.0.1:5000", http.StatusMethodNotAllowed},
+		{"DELETE", "[::1]:1234", "127.0.0.1:5000", http.StatusNoContent},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "/metrics/targets", strings.NewReader(test.body))
+		req.RemoteAddr = test.remote
+		w := httptest.NewRecorder()
+		s.serveTargets(w, req)
+		if w.Code != test.expected {
+			t.Errorf("%s %s from %s: expected the status %d, got %d", test.method, test.body, test.remote, test.expected, w.Code)
+		}
+	}
+	if len(s.targets) != 0 {
+		t.Errorf("expected the target to be unregistered, got %v", s.targets)
+	}
+
+	// the requests received on the address they come from are accepted
+	req := httptest.NewRequest("POST", "/metrics/targets", strings.NewReader("127.0.0.1:5000"))
+	req.RemoteAddr = "10.0.0.2:1234"
+	req = req.WithContext(contextWithLocalAddr(req, &net.TCPAddr{IP: net.ParseIP("10.0.0.2")}))
+	w := httptest.NewRecorder()
+	s.serveTargets(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected the request from the same host to be accepted, got %d", w.Code)
+	}
+}
+
+func TestStartErrors(t *testing.T) {
+	if _, err := Start(freeAddr(t), "metrics", "test"); err == nil {
+		t.Error("expected an error with a relative path")
+	}
+	if _, err := Start("invalid", "", "test"); err == nil {
+		t.Error("expected an error with an invalid address")
+	}
+}
@@ -0,0 +1,340 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/falcosecurity/plugins/shared/go/mux"
+)
+
+const (
+	shutdownTimeout   = 5 * time.Second
+	scrapeTimeout     = 2 * time.Second
+	heartbeatInterval = 5 * time.Second
+	contentType       = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	serversMu sync.Mutex
+	servers   = map[string]*server{}
+	client    = &http.Client{Timeout: scrapeTimeout}
+)
+
+// server exposes the metrics of the plugins of the Go runtime that are
+// configured with the same endpoint. The leader serves the endpoint on the
+// configured address, along with the other endpoints of the plugin served
+// there such as the health one, and collects the metrics of the followers,
+// which are the plugins of the other Go runtimes of the process, i.e. the
+// other shared libraries, at each scrape. A follower listens on a loopback
+// address registered with the leader, and registers again periodically so
+// that it takes over the endpoint if the leader is destroyed.
+type server struct {
+	key     string
+	addr    string
+	path    string
+	mu      sync.Mutex
+	metrics map[*Metrics]struct{}
+	targets map[string]struct{}
+	http    *http.Server
+	mount   *mux.Mount
+	leader  bool
+	self    string
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func register(addr, path string, m *Metrics) (*server, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("metrics path %s does not start with /", path)
+	}
+	path = strings.TrimSuffix(path, "/")
+
+	serversMu.Lock()
+	defer serversMu.Unlock()
+	key := addr + path
+	s, ok := servers[key]
+	if !ok {
+		s = &server{
+			key:     key,
+			addr:    addr,
+			path:    path,
+			metrics: map[*Metrics]struct{}{},
+			targets: map[string]struct{}{},
+		}
+		if err := s.start(); err != nil {
+			return nil, err
+		}
+		servers[key] = s
+	}
+	s.mu.Lock()
+	s.metrics[m] = struct{}{}
+	s.mu.Unlock()
+	return s, nil
+}
+
+func (s *server) unregister(m *Metrics) error {
+	serversMu.Lock()
+	defer serversMu.Unlock()
+	s.mu.Lock()
+	delete(s.metrics, m)
+	n := len(s.metrics)
+	s.mu.Unlock()
+	if n > 0 {
+		return nil
+	}
+	delete(servers, s.key)
+	return s.close()
+}
+
+func (s *server) start() error {
+	err := s.lead()
+	if err == nil || !errors.Is(err, syscall.EADDRINUSE) {
+		return err
+	}
+
+	// the endpoint is expected to be served by another plugin of the process
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	s.self = ln.Addr().String()
+	if err = s.register(http.MethodPost); err != nil {
+		ln.Close()
+		return fmt.Errorf("metrics address %s is not served by a plugin: %s", s.addr, err.Error())
+	}
+	m := http.NewServeMux()
+	m.HandleFunc(s.path+"/snapshot", s.serveSnapshot)
+	s.http = &http.Server{Handler: m}
+	go s.http.Serve(ln)
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.heartbeat()
+	return nil
+}
+
+// lead serves the endpoint on the configured address
+func (s *server) lead() error {
+	m, err := mux.Serve(s.addr, mux.Routes{
+		s.path:              http.HandlerFunc(s.serveMetrics),
+		s.path + "/targets": http.HandlerFunc(s.serveTargets),
+	})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.leader = true
+	s.mount = m
+	s.mu.Unlock()
+	return nil
+}
+
+// heartbeat registers the follower again periodically, and takes over the
+// endpoint when the leader stopped serving it
+func (s *server) heartbeat() {
+	defer close(s.done)
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if s.register(http.MethodPost) == nil {
+				continue
+			}
+			if s.lead() != nil {
+				continue
+			}
+			s.mu.Lock()
+			follower := s.http
+			s.http = nil
+			s.mu.Unlock()
+			shutdown(follower)
+			return
+		}
+	}
+}
+
+func (s *server) close() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.leader {
+		return s.mount.Close()
+	}
+	s.register(http.MethodDelete)
+	return shutdown(s.http)
+}
+
+func shutdown(srv *http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
+
+// register registers or unregisters the follower with the leader
+func (s *server) register(method string) error {
+	host, port, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); len(host) == 0 || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	url := "http://" + net.JoinHostPort(host, port) + s.path + "/targets"
+	req, err := http.NewRequest(method, url, strings.NewReader(s.self))
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// families returns the metrics of the plugins of the Go runtime
+func (s *server) families() []family {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []family
+	for m := range s.metrics {
+		res = append(res, m.families()...)
+	}
+	return res
+}
+
+func (s *server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	fams := s.families()
+	s.mu.Lock()
+	targets := make([]string, 0, len(s.targets))
+	for t := range s.targets {
+		targets = append(targets, t)
+	}
+	s.mu.Unlock()
+
+	for _, t := range targets {
+		f, err := scrape(t, s.path)
+		if err != nil {
+			// the follower is registered again by its next heartbeat if
+			// it's still running
+			s.mu.Lock()
+			delete(s.targets, t)
+			s.mu.Unlock()
+			continue
+		}
+		fams = append(fams, f...)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(appendText(nil, merge(fams)))
+}
+
+func scrape(target, path string) ([]family, error) {
+	res, err := client.Get("http://" + target + path + "/snapshot")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	var fams []family
+	err = json.NewDecoder(res.Body).Decode(&fams)
+	return fams, err
+}
+
+func (s *server) serveSnapshot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.families())
+}
+
+// serveTargets registers and unregisters the followers, which must be
+// running on the same host and listening on a loopback address
+func (s *server) serveTargets(w http.ResponseWriter, r *http.Request) {
+	if !sameHost(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 256))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	target := string(bytes.TrimSpace(body))
+	host, _, err := net.SplitHostPort(target)
+	if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+		http.Error(w, "invalid target: "+target, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPost:
+		s.targets[target] = struct{}{}
+	case http.MethodDelete:
+		delete(s.targets, target)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sameHost returns true if the request comes from the loopback interface or
+// from the address it's been received on
+func sameHost(r *http.Request) bool {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(remote)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	if local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if tcp, ok := local.(*net.TCPAddr); ok {
+			return tcp.IP.Equal(ip)
+		}
+	}
+	return false
+}
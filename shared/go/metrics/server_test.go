@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/falcosecurity/plugins/shared/go/mux"
+)
+
+// freeAddr returns the address of a free loopback port
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// get returns the status and the body of a request to the given address,
+// or the status 0 if the address is not served
+func get(addr, path string) (int, string) {
+	c := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	res, err := c.Get("http://" + addr + path)
+	if err != nil {
+		return 0, ""
+	}
+	defer res.Body.Close()
+	b, _ := ioutil.ReadAll(res.Body)
+	return res.StatusCode, string(b)
+}
+
+func TestSharedListener(t *testing.T) {
+	// the endpoint is served along with the other endpoints of the
+	// plugin configured with the same address, e.g. the health one
+	addr := freeAddr(t)
+	health, err := mux.Serve(addr, mux.Routes{"/healthz": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer health.Close()
+	m, err := Start(addr, "", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.srv.leader {
+		t.Error("expected the plugin to serve the endpoint")
+	}
+	m.Ingested(10, time.Time{})
+	if status, body := get(addr, DefaultPath); status != http.StatusOK || !strings.Contains(body, `falco_plugin_events_total{plugin="test"} 1`) {
+		t.Errorf("expected the metrics, got %d %s", status, body)
+	}
+	if status, body := get(addr, "/healthz"); status != http.StatusOK || body != "ok" {
+		t.Errorf("expected the health endpoint, got %d %s", status, body)
+	}
+
+	// closing the metrics leaves the other endpoints served
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := get(addr, DefaultPath); status != http.StatusNotFound {
+		t.Errorf("expected the metrics not to be served anymore, got %d", status)
+	}
+	if status, _ := get(addr, "/healthz"); status != http.StatusOK {
+		t.Errorf("expected the health endpoint to be still served, got %d", status)
+	}
+}
+
+// contextWithLocalAddr returns the context of a request received on the
+// given local address
+func contextWithLocalAddr(req *http.Request, addr net.Addr) context.Context {
+	return context.WithValue(req.Context(), http.LocalAddrContextKey, addr)
+}
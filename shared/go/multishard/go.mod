@@ -0,0 +1,13 @@
+module github.com/falcosecurity/plugins/shared/go/multishard
+
+go 1.16
+
+require (
+	github.com/falcosecurity/plugin-sdk-go v0.7.3
+	github.com/falcosecurity/plugins/shared/go/batch v0.0.0-00010101000000-000000000000
+	github.com/falcosecurity/plugins/shared/go/checkpoint v0.0.0-00010101000000-000000000000
+)
+
+replace github.com/falcosecurity/plugins/shared/go/batch => ../batch
+
+replace github.com/falcosecurity/plugins/shared/go/checkpoint => ../checkpoint
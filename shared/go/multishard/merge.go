@@ -0,0 +1,231 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multishard
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/batch"
+)
+
+// item is an event waiting to be merged, with the cursor to save once it is
+// handed to the instance if it's the last event of its poll
+type item struct {
+	evt    source.PushEvent
+	cursor *string
+}
+
+// shard is the state of a shard of a stream
+type shard struct {
+	Shard
+	cursor string        // cursor of the next poll, only used by the worker
+	space  chan struct{} // signaled when an event of the queue is merged
+
+	// guarded by the mutex of the fanIn
+	queue   []item
+	polling bool
+	since   time.Time // start of the poll in progress
+}
+
+// fanIn merges the events of the shards of a stream
+type fanIn struct {
+	opts   Options
+	buf    *batch.Buffer
+	shards []*shard
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	wake   chan struct{} // signaled when a shard changes
+	mu     sync.Mutex    // guards the queues of the shards
+}
+
+func (f *fanIn) signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// poll is the worker polling a shard
+func (f *fanIn) poll(ctx context.Context, s *shard) {
+	defer f.wg.Done()
+	emit := func(evt source.PushEvent) bool {
+		evt.Err = nil
+		return f.enqueue(ctx, s, item{evt: evt})
+	}
+	for {
+		cursor, err := s.Poll(ctx, s.cursor, emit)
+		if ctx.Err() != nil {
+			return
+		}
+		if cursor != "" {
+			s.cursor = cursor
+			f.commit(s, cursor)
+		}
+		f.setPolling(s, false)
+
+		if err != nil && f.opts.OnError != nil {
+			err = f.opts.OnError(s.Name, err)
+		}
+		if err != nil {
+			// the error ends the stream once the events emitted
+			// before it are merged
+			f.enqueue(ctx, s, item{evt: source.PushEvent{Err: err}})
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(f.opts.Interval()):
+		}
+		f.setPolling(s, true)
+	}
+}
+
+func (f *fanIn) setPolling(s *shard, polling bool) {
+	f.mu.Lock()
+	s.polling = polling
+	s.since = time.Now()
+	f.mu.Unlock()
+	f.signal(f.wake)
+}
+
+// enqueue adds an event to the queue of a shard, waiting for room
+func (f *fanIn) enqueue(ctx context.Context, s *shard, it item) bool {
+	for {
+		f.mu.Lock()
+		if len(s.queue) < f.opts.QueueSize {
+			s.queue = append(s.queue, it)
+			f.mu.Unlock()
+			f.signal(f.wake)
+			return true
+		}
+		f.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return false
+		case <-s.space:
+		}
+	}
+}
+
+// commit saves the cursor of a poll once its events are merged. The queue
+// only holds the events of the last poll, since a shard is polled again only
+// after the poll ends, so the cursor is attached to its last event, or saved
+// right away if they are all merged already.
+func (f *fanIn) commit(s *shard, cursor string) {
+	f.mu.Lock()
+	if n := len(s.queue); n > 0 {
+		s.queue[n-1].cursor = &cursor
+		f.mu.Unlock()
+		return
+	}
+	f.mu.Unlock()
+	f.save(s.Shard, cursor)
+}
+
+// merge hands the events of the shards to the instance in their time order
+func (f *fanIn) merge(ctx context.Context) {
+	defer f.wg.Done()
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		f.mu.Lock()
+		s, wait := f.next(time.Now())
+		var it item
+		if s != nil {
+			it = s.queue[0]
+			s.queue[0] = item{}
+			s.queue = s.queue[1:]
+		}
+		f.mu.Unlock()
+
+		if s == nil {
+			var deadline <-chan time.Time
+			if wait > 0 {
+				timer.Reset(wait)
+				deadline = timer.C
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-f.wake:
+			case <-deadline:
+			}
+			if wait > 0 && !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			continue
+		}
+
+		f.signal(s.space)
+		if !f.buf.Push(it.evt) {
+			return
+		}
+		if it.evt.Err != nil {
+			// the stream ends with the error, so the shards stop
+			f.cancel()
+			return
+		}
+		if it.cursor != nil {
+			f.save(s.Shard, *it.cursor)
+		}
+	}
+}
+
+// next returns the shard of the oldest event waiting, unless a shard being
+// polled has no event waiting since less than the maximum delay, in which
+// case it returns how long to wait for it. The events without time, and
+// the errors, are the oldest.
+func (f *fanIn) next(now time.Time) (*shard, time.Duration) {
+	var res *shard
+	var wait time.Duration
+	for _, s := range f.shards {
+		if len(s.queue) == 0 {
+			if s.polling {
+				if d := f.opts.MaxDelay - now.Sub(s.since); d > 0 && (wait == 0 || d < wait) {
+					wait = d
+				}
+			}
+			continue
+		}
+		if res == nil || before(s.queue[0].evt, res.queue[0].evt) {
+			res = s
+		}
+	}
+	if res == nil {
+		return nil, 0
+	}
+	if wait > 0 && !res.queue[0].evt.Timestamp.IsZero() && res.queue[0].evt.Err == nil {
+		return nil, wait
+	}
+	return res, 0
+}
+
+func before(a, b source.PushEvent) bool {
+	if a.Err != nil || a.Timestamp.IsZero() {
+		return b.Err == nil && !b.Timestamp.IsZero()
+	}
+	return b.Err == nil && !b.Timestamp.IsZero() && a.Timestamp.Before(b.Timestamp)
+}
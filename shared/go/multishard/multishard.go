@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package multishard runs the polling workers of the shards of an event
+// source, such as the regions, accounts or organizations read by a single
+// instance of a plugin, and merges their events into a single stream
+// ordered by their time. Each shard is polled from a cursor, e.g. the time
+// of its last event, which is saved in a checkpoint store once the events
+// of the poll are handed to the instance, so that each shard resumes where
+// it stopped after a restart.
+//
+// The events are merged by their time as they arrive: the oldest event
+// waiting is returned first, once all the shards being polled have one
+// waiting too, or after a short delay, so that a slow shard doesn't stall
+// the others. The order is thus exact across the shards polled at the same
+// time, and best effort for the events returned late by their upstream.
+package multishard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/batch"
+	"github.com/falcosecurity/plugins/shared/go/checkpoint"
+)
+
+const (
+	DefaultInterval  = 10 * time.Second // between two polls of a shard
+	DefaultMaxDelay  = time.Second      // wait for the events of a shard being polled
+	DefaultQueueSize = 1000             // events waiting to be merged per shard
+)
+
+// Emit sends an event of a shard to the stream, waiting for room if the
+// events of the shard are not merged fast enough. The Err of the event is
+// ignored. It returns false once the stream is closed, and the poll should
+// then stop.
+type Emit func(evt source.PushEvent) bool
+
+// Shard is a source of events polled by its own worker
+type Shard struct {
+	// Name identifies the shard in the checkpoints and in the errors, and
+	// must be unique among the shards of a stream
+	Name string
+	// Cursor is the cursor of the first poll if none is saved
+	Cursor string
+	// Poll emits the events of the shard from cursor in their time order,
+	// and returns the cursor of the next poll. On error, the returned
+	// cursor, if not empty, still moves the shard past the events emitted.
+	// The context is canceled when the stream is closed.
+	Poll func(ctx context.Context, cursor string, emit Emit) (string, error)
+}
+
+// Options are the options of a stream
+type Options struct {
+	// Interval returns the delay between two polls of a shard, which can
+	// change at runtime, or DefaultInterval if nil
+	Interval func() time.Duration
+	// Checkpoints is the store of the cursors of the shards, under the
+	// key made of Prefix and of the name of the shard, if not nil
+	Checkpoints checkpoint.Store
+	Prefix      string
+	// MaxDelay is how long the events of the other shards wait for the
+	// ones of a shard being polled, DefaultMaxDelay if 0
+	MaxDelay time.Duration
+	// QueueSize is the number of events of a shard waiting to be merged,
+	// DefaultQueueSize if 0
+	QueueSize int
+	// Buffer are the options of the buffer of the events, if not nil
+	Buffer *batch.BufferOptions
+	// OnError is called with the errors of the polls, and returns nil to
+	// poll the shard again at the next interval, or the error ending the
+	// stream. The errors end the stream if nil.
+	OnError func(shard string, err error) error
+	// Logf logs the failures of the checkpoints, if not nil
+	Logf func(format string, v ...interface{})
+	// OnClose is called when the instance is closed, once the workers
+	// stopped, if not nil
+	OnClose func()
+}
+
+// Open starts polling the shards, and returns an instance returning their
+// merged events
+func Open(shards []Shard, opts Options) (source.Instance, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("multishard: no shard given")
+	}
+	if opts.Interval == nil {
+		opts.Interval = func() time.Duration { return DefaultInterval }
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = DefaultMaxDelay
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.Logf == nil {
+		opts.Logf = func(format string, v ...interface{}) {}
+	}
+
+	f := &fanIn{
+		opts: opts,
+		buf:  batch.NewBuffer(opts.Buffer),
+		wake: make(chan struct{}, 1),
+	}
+	// the shards are polling from the start, so that the first events
+	// wait for the ones of the shards not started yet
+	now := time.Now()
+	names := make(map[string]bool)
+	for _, s := range shards {
+		if s.Poll == nil {
+			return nil, fmt.Errorf("multishard: no poll function for shard %s", s.Name)
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("multishard: duplicate shard %s", s.Name)
+		}
+		names[s.Name] = true
+		f.shards = append(f.shards, &shard{
+			Shard:   s,
+			cursor:  f.load(s),
+			space:   make(chan struct{}, 1),
+			polling: true,
+			since:   now,
+		})
+	}
+
+	var ctx context.Context
+	ctx, f.cancel = context.WithCancel(context.Background())
+	for _, s := range f.shards {
+		f.wg.Add(1)
+		go f.poll(ctx, s)
+	}
+	f.wg.Add(1)
+	go f.merge(ctx)
+
+	inst, err := batch.NewInstance(f.buf, f.close)
+	if err != nil {
+		f.close()
+		return nil, err
+	}
+	return inst, nil
+}
+
+// key returns the checkpoint key of a shard
+func (f *fanIn) key(s Shard) string {
+	return checkpoint.Key(f.opts.Prefix, s.Name)
+}
+
+// load returns the cursor saved for a shard, or its initial one
+func (f *fanIn) load(s Shard) string {
+	if f.opts.Checkpoints == nil {
+		return s.Cursor
+	}
+	cursor, ok, err := f.opts.Checkpoints.Load(f.key(s))
+	if err != nil {
+		f.opts.Logf("failed to load the checkpoint of %s: %s", s.Name, err.Error())
+		return s.Cursor
+	}
+	if !ok {
+		return s.Cursor
+	}
+	return cursor
+}
+
+// save saves the cursor of a shard. The failures are only logged, since they
+// don't prevent the polling.
+func (f *fanIn) save(s Shard, cursor string) {
+	if f.opts.Checkpoints == nil || cursor == "" {
+		return
+	}
+	if err := f.opts.Checkpoints.Save(f.key(s), cursor); err != nil {
+		f.opts.Logf("failed to save the checkpoint of %s: %s", s.Name, err.Error())
+	}
+}
+
+func (f *fanIn) close() {
+	f.cancel()
+	f.buf.Close()
+	f.wg.Wait()
+	if f.opts.OnClose != nil {
+		f.opts.OnClose()
+	}
+}
@@ -0,0 +1,346 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multishard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/batch"
+)
+
+type testEventWriter struct {
+	data bytes.Buffer
+}
+
+func (t *testEventWriter) Writer() io.Writer {
+	t.data.Reset()
+	return &t.data
+}
+
+func (t *testEventWriter) SetTimestamp(value uint64) {
+	// do nothing
+}
+
+type testEventWriters struct {
+	evts []*testEventWriter
+}
+
+func newTestEventWriters(size int) *testEventWriters {
+	res := &testEventWriters{}
+	for i := 0; i < size; i++ {
+		res.evts = append(res.evts, &testEventWriter{})
+	}
+	return res
+}
+
+func (t *testEventWriters) Get(eventIndex int) sdk.EventWriter {
+	return t.evts[eventIndex]
+}
+
+func (t *testEventWriters) Len() int {
+	return len(t.evts)
+}
+
+func (t *testEventWriters) ArrayPtr() unsafe.Pointer {
+	return nil
+}
+
+func (t *testEventWriters) Free() {
+	// do nothing
+}
+
+// testStore is an in-memory checkpoint store
+type testStore struct {
+	mu      sync.Mutex
+	cursors map[string]string
+}
+
+func (s *testStore) Load(key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.cursors[key]
+	return c, ok, nil
+}
+
+func (s *testStore) Save(key, cursor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cursors[key] = cursor
+	return nil
+}
+
+func (s *testStore) Close() error {
+	return nil
+}
+
+func (s *testStore) get(key string) string {
+	c, _, _ := s.Load(key)
+	return c
+}
+
+var t0 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// event returns an event of the given data, at t0 plus the given seconds
+func event(data string, sec int) source.PushEvent {
+	return source.PushEvent{Data: []byte(data), Timestamp: t0.Add(time.Duration(sec) * time.Second)}
+}
+
+// emitAll returns a poll function emitting the events once, then waiting
+// for the stream to be closed
+func emitAll(evts ...source.PushEvent) func(ctx context.Context, cursor string, emit Emit) (string, error) {
+	done := false
+	return func(ctx context.Context, cursor string, emit Emit) (string, error) {
+		if done {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}
+		done = true
+		for _, evt := range evts {
+			if !emit(evt) {
+				return "", nil
+			}
+		}
+		return "end", nil
+	}
+}
+
+// readEvents returns the data of the next n events of an instance, or the
+// error ending its stream
+func readEvents(t *testing.T, inst source.Instance, n int) ([]string, error) {
+	evts := newTestEventWriters(4)
+	var res []string
+	deadline := time.Now().Add(5 * time.Second)
+	for len(res) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out after %d events", len(res))
+		}
+		count, err := inst.NextBatch(nil, evts)
+		for i := 0; i < count; i++ {
+			res = append(res, evts.evts[i].data.String())
+		}
+		if err != nil && err != sdk.ErrTimeout {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+func openTest(t *testing.T, shards []Shard, opts Options) source.Instance {
+	if opts.Interval == nil {
+		opts.Interval = func() time.Duration { return time.Hour }
+	}
+	inst, err := Open(shards, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(inst.(sdk.Closer).Close)
+	return inst
+}
+
+func TestOpenErrors(t *testing.T) {
+	poll := emitAll()
+	tests := map[string][]Shard{
+		"no shard":        nil,
+		"no poll":         {{Name: "a"}},
+		"duplicate shard": {{Name: "a", Poll: poll}, {Name: "a", Poll: poll}},
+	}
+	for name, shards := range tests {
+		if _, err := Open(shards, Options{}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestMergeOrder(t *testing.T) {
+	// the second shard is slower to emit its events, which are older
+	slow := func(ctx context.Context, cursor string, emit Emit) (string, error) {
+		time.Sleep(50 * time.Millisecond)
+		return emitAll(event("b1", 1), event("b4", 4), event("b5", 5))(ctx, cursor, emit)
+	}
+	inst := openTest(t, []Shard{
+		{Name: "a", Poll: emitAll(event("a2", 2), event("a3", 3), event("a6", 6))},
+		{Name: "b", Poll: slow},
+	}, Options{MaxDelay: 5 * time.Second})
+	evts, err := readEvents(t, inst, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(evts, ",") != "b1,a2,a3,b4,b5,a6" {
+		t.Errorf("expected the events in their time order, got %v", evts)
+	}
+}
+
+func TestMaxDelay(t *testing.T) {
+	release := make(chan struct{})
+	blocked := func(ctx context.Context, cursor string, emit Emit) (string, error) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return "", nil
+		}
+		emit(event("b1", 1))
+		<-ctx.Done()
+		return "", nil
+	}
+	inst := openTest(t, []Shard{
+		{Name: "a", Poll: emitAll(event("a2", 2))},
+		{Name: "b", Poll: blocked},
+	}, Options{MaxDelay: 50 * time.Millisecond})
+
+	// the events of a shard don't wait more than MaxDelay for the others
+	start := time.Now()
+	evts, err := readEvents(t, inst, 1)
+	if err != nil || strings.Join(evts, ",") != "a2" {
+		t.Fatalf("expected the event of the first shard, got %v (%v)", evts, err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("expected the event to wait for the other shard, got it after %s", elapsed)
+	}
+
+	// the older events returned late are still returned, out of order
+	close(release)
+	evts, err = readEvents(t, inst, 1)
+	if err != nil || strings.Join(evts, ",") != "b1" {
+		t.Errorf("expected the late event, got %v (%v)", evts, err)
+	}
+}
+
+func TestCursorCommit(t *testing.T) {
+	store := &testStore{cursors: map[string]string{"test/b": "saved"}}
+	polled := make(chan string, 2)
+	poll := func(name string, evts ...source.PushEvent) func(ctx context.Context, cursor string, emit Emit) (string, error) {
+		p := emitAll(evts...)
+		return func(ctx context.Context, cursor string, emit Emit) (string, error) {
+			res, err := p(ctx, cursor, emit)
+			if err == nil {
+				polled <- name + ":" + cursor
+			}
+			return res, err
+		}
+	}
+	inst := openTest(t, []Shard{
+		{Name: "a", Cursor: "initial", Poll: poll("a", event("a1", 1), event("a2", 2), event("a3", 3))},
+		{Name: "b", Cursor: "initial", Poll: poll("b")},
+	}, Options{
+		Checkpoints: store,
+		Prefix:      "test",
+		Buffer:      &batch.BufferOptions{Size: 1},
+	})
+
+	// the shards are polled from their saved cursor, or their initial one
+	cursors := map[string]bool{<-polled: true, <-polled: true}
+	if !cursors["a:initial"] || !cursors["b:saved"] {
+		t.Fatalf("unexpected cursors of the polls: %v", cursors)
+	}
+
+	// the cursor is saved once all the events of the poll are handed to
+	// the instance, and right away without event
+	time.Sleep(50 * time.Millisecond)
+	if c := store.get("test/a"); c != "" {
+		t.Errorf("expected no cursor saved before the events are read, got %s", c)
+	}
+	if c := store.get("test/b"); c != "end" {
+		t.Errorf("expected the cursor of the poll without event to be saved, got %s", c)
+	}
+	if _, err := readEvents(t, inst, 3); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); store.get("test/a") != "end"; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the cursor to be saved once the events are read")
+		}
+	}
+}
+
+func TestPollErrors(t *testing.T) {
+	failure := errors.New("failure")
+	failing := func(ctx context.Context, cursor string, emit Emit) (string, error) {
+		emit(event("a1", 1))
+		return "", failure
+	}
+
+	// the errors end the stream after the events emitted before them
+	inst := openTest(t, []Shard{{Name: "a", Poll: failing}}, Options{})
+	evts, err := readEvents(t, inst, 2)
+	if err != failure || strings.Join(evts, ",") != "a1" {
+		t.Errorf("expected an event then the error, got %v (%v)", evts, err)
+	}
+
+	// or the shard is polled again if OnError ignores them
+	var mu sync.Mutex
+	var errs []string
+	inst = openTest(t, []Shard{{Name: "a", Poll: failing}}, Options{
+		Interval: func() time.Duration { return time.Millisecond },
+		OnError: func(shard string, err error) error {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, shard+": "+err.Error())
+			return nil
+		},
+	})
+	evts, err = readEvents(t, inst, 3)
+	if err != nil || strings.Join(evts, ",") != "a1,a1,a1" {
+		t.Errorf("expected the events of several polls, got %v (%v)", evts, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) < 2 || errs[0] != "a: failure" {
+		t.Errorf("expected the errors of the polls, got %v", errs)
+	}
+}
+
+func TestClose(t *testing.T) {
+	stopped := make(chan struct{})
+	closed := make(chan struct{})
+	forever := func(ctx context.Context, cursor string, emit Emit) (string, error) {
+		defer close(stopped)
+		for i := 0; emit(event("a", i)); i++ {
+		}
+		return "", nil
+	}
+	inst, err := Open([]Shard{{Name: "a", Poll: forever}}, Options{
+		QueueSize: 2,
+		OnClose:   func() { close(closed) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readEvents(t, inst, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	// closing stops the polls waiting for room
+	inst.(sdk.Closer).Close()
+	for _, c := range []chan struct{}{stopped, closed} {
+		select {
+		case <-c:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the instance to stop")
+		}
+	}
+}
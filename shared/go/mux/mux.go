@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mux provides the HTTP listeners shared by the endpoints of a
+// plugin, such as the health and the metrics ones, so that the endpoints
+// configured with the same address are served by a single listener rather
+// than failing to listen on it.
+//
+// The listeners are shared within the Go runtime of a plugin only. The
+// plugins of a Falco process each run their own Go runtime, and can't share
+// a listener, see the metrics package for how they share their endpoint.
+package mux
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// Routes are the handlers of an endpoint by path. The paths are matched
+// exactly, without the subtree matching of http.ServeMux.
+type Routes map[string]http.Handler
+
+var (
+	listenersMu sync.Mutex
+	listeners   = map[string]*listener{}
+)
+
+// listener is a listener serving the routes of the endpoints mounted on
+// its address
+type listener struct {
+	addr   string
+	srv    *http.Server
+	ln     net.Listener
+	mu     sync.RWMutex
+	routes Routes
+}
+
+// Mount is a set of routes served on an address
+type Mount struct {
+	l     *listener
+	paths []string
+	once  sync.Once
+}
+
+// Serve serves the routes on addr, e.g. :8081, until the returned Mount is
+// closed. The first routes of an address start listening on it, and the
+// following ones are added to the same listener. The network errors of the
+// listener are returned as they are, so that the callers can tell an
+// address in use with errors.Is.
+func Serve(addr string, routes Routes) (*Mount, error) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	l, ok := listeners[addr]
+	if !ok {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		l = &listener{addr: addr, ln: ln, routes: Routes{}}
+		l.srv = &http.Server{Handler: l}
+		go l.srv.Serve(ln)
+		listeners[addr] = l
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	m := &Mount{l: l}
+	for path := range routes {
+		if _, ok := l.routes[path]; ok {
+			return nil, fmt.Errorf("path %s is already served on %s", path, addr)
+		}
+	}
+	for path, h := range routes {
+		l.routes[path] = h
+		m.paths = append(m.paths, path)
+	}
+	return m, nil
+}
+
+// Close stops serving the routes, and stops listening once no route is
+// served on the address anymore
+func (m *Mount) Close() error {
+	var err error
+	m.once.Do(func() {
+		listenersMu.Lock()
+		defer listenersMu.Unlock()
+		m.l.mu.Lock()
+		for _, path := range m.paths {
+			delete(m.l.routes, path)
+		}
+		n := len(m.l.routes)
+		m.l.mu.Unlock()
+		if n > 0 {
+			return
+		}
+		delete(listeners, m.l.addr)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err = m.l.srv.Shutdown(ctx)
+		// the listener is not closed by Shutdown if the server is closed
+		// before it started serving it
+		m.l.ln.Close()
+	})
+	return err
+}
+
+func (l *listener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.RLock()
+	h, ok := l.routes[r.URL.Path]
+	l.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mux
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+)
+
+// freeAddr returns the address of a free loopback port
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func text(s string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(s))
+	})
+}
+
+// get returns the status and the body of a request to the given address,
+// or the status 0 if the address is not served
+func get(addr, path string) (int, string) {
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	res, err := client.Get("http://" + addr + path)
+	if err != nil {
+		return 0, ""
+	}
+	defer res.Body.Close()
+	b, _ := ioutil.ReadAll(res.Body)
+	return res.StatusCode, string(b)
+}
+
+func TestServe(t *testing.T) {
+	addr := freeAddr(t)
+	health, err := Serve(addr, Routes{"/healthz": text("health"), "/healthz/ready": text("ready")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer health.Close()
+	metrics, err := Serve(addr, Routes{"/metrics": text("metrics")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer metrics.Close()
+
+	// the routes of both mounts are served by the same listener, and
+	// the paths are matched exactly
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/healthz", http.StatusOK, "health"},
+		{"/healthz/ready", http.StatusOK, "ready"},
+		{"/metrics", http.StatusOK, "metrics"},
+		{"/metrics/", http.StatusNotFound, ""},
+		{"/", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		status, body := get(addr, test.path)
+		if status != test.status || (status == http.StatusOK && body != test.body) {
+			t.Errorf("%s: expected %d %s, got %d %s", test.path, test.status, test.body, status, body)
+		}
+	}
+
+	// the paths can't be served twice on an address
+	if _, err := Serve(addr, Routes{"/other": text("other"), "/metrics": text("other")}); err == nil {
+		t.Error("expected an error serving a path twice")
+	}
+	if status, _ := get(addr, "/other"); status != http.StatusNotFound {
+		t.Errorf("expected the routes of the failed mount not to be served, got %d", status)
+	}
+
+	// closing a mount only removes its routes
+	if err := health.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := health.Close(); err != nil {
+		t.Errorf("expected closing a mount twice to be a no-op, got %s", err)
+	}
+	if status, _ := get(addr, "/healthz"); status != http.StatusNotFound {
+		t.Errorf("expected the closed routes not to be served, got %d", status)
+	}
+	if status, body := get(addr, "/metrics"); status != http.StatusOK || body != "metrics" {
+		t.Errorf("expected the other routes to be served, got %d %s", status, body)
+	}
+
+	// the listener is stopped once the last mount is closed, and the
+	// address can be served again
+	if err := metrics.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := get(addr, "/metrics"); status != 0 {
+		t.Errorf("expected the address not to be served anymore, got %d", status)
+	}
+	m, err := Serve(addr, Routes{"/metrics": text("again")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if status, body := get(addr, "/metrics"); status != http.StatusOK || body != "again" {
+		t.Errorf("expected the address to be served again, got %d %s", status, body)
+	}
+}
+
+func TestServeAddrInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	_, err = Serve(ln.Addr().String(), Routes{"/metrics": text("metrics")})
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		t.Errorf("expected the address to be in use, got %v", err)
+	}
+	if _, err := Serve("invalid", Routes{"/metrics": text("metrics")}); err == nil {
+		t.Error("expected an error with an invalid address")
+	}
+}
@@ -0,0 +1,7 @@
+module github.com/falcosecurity/plugins/shared/go/pagination
+
+go 1.15
+
+require github.com/falcosecurity/plugins/shared/go/ratelimit v0.0.0-00010101000000-000000000000
+
+replace github.com/falcosecurity/plugins/shared/go/ratelimit => ../ratelimit
@@ -0,0 +1,301 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package pagination iterates over the pages of the REST APIs polled by the
+// plugins, whatever their pagination scheme: the next link of the Link
+// header (RFC 8288) as with GitHub and Okta, an opaque cursor returned in
+// the page and sent back as a query parameter, or an offset and a limit.
+// The plugins only provide the function decoding the items of a page, and
+// the Paginator sends the requests, waits for the rate limit of the API if
+// a ratelimit.Limiter is given, and retries the pages rejected with a 429
+// Too Many Requests status once the Limiter is restored.
+package pagination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/falcosecurity/plugins/shared/go/ratelimit"
+)
+
+// Mode is the pagination scheme of an API
+type Mode int
+
+const (
+	// Link follows the URL of the next link of the Link header of the
+	// responses, until a response has none
+	Link Mode = iota
+	// Cursor sets the CursorParam query parameter to the cursor returned by
+	// the decoding of each page, until a page returns no cursor
+	Cursor
+	// Offset increments the OffsetParam query parameter by the number of
+	// items of each page, until a page has less than Limit items
+	Offset
+)
+
+// maxRetries is the number of times a page rejected with a 429 Too Many
+// Requests status is requested again before giving up
+const maxRetries = 5
+
+// Page is what the decoding of a page returns
+type Page struct {
+	// Items is the number of items of the page, which moves the offset
+	Items int
+	// Cursor is the cursor of the next page, empty for the last one
+	Cursor string
+}
+
+// Decode decodes the items of a page from a response with a 2xx status.
+// The body is closed by the Paginator.
+type Decode func(resp *http.Response) (Page, error)
+
+// Options are the options of a Paginator
+type Options struct {
+	// Mode is the pagination scheme of the API
+	Mode Mode
+	// CursorParam is the query parameter of the cursor, for Cursor
+	CursorParam string
+	// OffsetParam is the query parameter of the offset, for Offset
+	OffsetParam string
+	// LimitParam is the query parameter of the page size, set to Limit if
+	// both are set
+	LimitParam string
+	// Limit is the page size, which ends the iteration on a shorter page
+	// for Offset
+	Limit int
+	// Limiter throttles the requests, if not nil. It's not needed when the
+	// client is already throttled by a ratelimit.Transport.
+	Limiter *ratelimit.Limiter
+	// MaxPages stops the iteration after as many pages, if not 0, to let
+	// the plugins return their events between the pages of a long backlog
+	MaxPages int
+}
+
+// StatusError is the error of a response with a status other than 2xx. It
+// has the StatusCode method recognized by the errkind package.
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return "unexpected status: " + e.Status
+}
+
+// StatusCode returns the HTTP status code of the response
+func (e *StatusError) StatusCode() int {
+	return e.Code
+}
+
+// Paginator iterates over the pages of an API. It isn't safe for
+// concurrent use.
+type Paginator struct {
+	client *http.Client
+	opts   Options
+	req    *http.Request
+	offset int
+	pages  int
+	done   bool
+}
+
+// New returns a Paginator starting with the request req, to which the
+// limit and the offset are added for the Offset mode, and sending the
+// requests with client, or http.DefaultClient if nil
+func New(client *http.Client, req *http.Request, opts Options) (*Paginator, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	switch opts.Mode {
+	case Link:
+	case Cursor:
+		if opts.CursorParam == "" {
+			return nil, errors.New("pagination: the cursor mode requires CursorParam")
+		}
+	case Offset:
+		if opts.OffsetParam == "" || opts.Limit <= 0 {
+			return nil, errors.New("pagination: the offset mode requires OffsetParam and Limit")
+		}
+	default:
+		return nil, fmt.Errorf("pagination: unknown mode %d", opts.Mode)
+	}
+	p := &Paginator{client: client, opts: opts, req: req}
+	if opts.LimitParam != "" && opts.Limit > 0 {
+		p.req = withParam(req, opts.LimitParam, strconv.Itoa(opts.Limit))
+	}
+	if opts.Mode == Offset {
+		if v, err := strconv.Atoi(req.URL.Query().Get(opts.OffsetParam)); err == nil {
+			p.offset = v
+		}
+		p.req = withParam(p.req, opts.OffsetParam, strconv.Itoa(p.offset))
+	}
+	return p, nil
+}
+
+// More returns true if there are pages left, false after the last page or
+// once MaxPages pages have been decoded
+func (p *Paginator) More() bool {
+	return !p.done && (p.opts.MaxPages <= 0 || p.pages < p.opts.MaxPages)
+}
+
+// Request returns the request of the next page, which can be saved to
+// resume the iteration later, e.g. in a checkpoint
+func (p *Paginator) Request() *http.Request {
+	return p.req
+}
+
+// Next requests the next page and decodes it with decode. The errors of
+// the requests, of the decoding, and the responses with a status other
+// than 2xx, as a *StatusError, are returned as is, and the same page is
+// requested again by the next call.
+func (p *Paginator) Next(ctx context.Context, decode Decode) error {
+	if p.done {
+		return io.EOF
+	}
+	resp, err := p.do(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+	page, err := decode(resp)
+	if err != nil {
+		return err
+	}
+	p.pages++
+	p.advance(resp, page)
+	return nil
+}
+
+// do sends the request of the current page, waiting for the Limiter and
+// retrying the 429 Too Many Requests responses once it's restored
+func (p *Paginator) do(ctx context.Context) (*http.Response, error) {
+	req := p.req.WithContext(ctx)
+	for retry := 0; ; retry++ {
+		if p.opts.Limiter != nil {
+			if err := p.opts.Limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if p.opts.Limiter != nil {
+			p.opts.Limiter.Update(resp)
+		}
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests || p.opts.Limiter == nil || retry == maxRetries {
+			return nil, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+		}
+	}
+}
+
+// advance moves the request to the next page, or marks the iteration done
+func (p *Paginator) advance(resp *http.Response, page Page) {
+	switch p.opts.Mode {
+	case Link:
+		next := NextLink(resp.Header)
+		if next == "" {
+			p.done = true
+			return
+		}
+		u, err := resp.Request.URL.Parse(next)
+		if err != nil {
+			p.done = true
+			return
+		}
+		req := p.req.Clone(p.req.Context())
+		req.URL = u
+		req.Host = ""
+		p.req = req
+	case Cursor:
+		if page.Cursor == "" {
+			p.done = true
+			return
+		}
+		p.req = withParam(p.req, p.opts.CursorParam, page.Cursor)
+	case Offset:
+		p.offset += page.Items
+		if page.Items < p.opts.Limit {
+			p.done = true
+			return
+		}
+		p.req = withParam(p.req, p.opts.OffsetParam, strconv.Itoa(p.offset))
+	}
+}
+
+// All decodes all the pages of the request req with decode, up to
+// MaxPages if set, and stops at the first error
+func All(ctx context.Context, client *http.Client, req *http.Request, opts Options, decode Decode) error {
+	p, err := New(client, req, opts)
+	if err != nil {
+		return err
+	}
+	for p.More() {
+		if err := p.Next(ctx, decode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withParam returns a copy of req with the query parameter key set to value
+func withParam(req *http.Request, key, value string) *http.Request {
+	res := req.Clone(req.Context())
+	values := res.URL.Query()
+	values.Set(key, value)
+	res.URL.RawQuery = values.Encode()
+	return res
+}
+
+// NextLink returns the URL of the next link of the Link headers, e.g.
+// <https://api.github.com/user/repos?page=3>; rel="next", or an empty
+// string if there is none
+func NextLink(h http.Header) string {
+	for _, header := range h.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(kv[0], "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(kv[1], `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,278 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pagination
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/falcosecurity/plugins/shared/go/ratelimit"
+)
+
+// testItems are the items served by the test APIs
+var testItems = []string{"a", "b", "c", "d", "e"}
+
+// decodeItems decodes the items of a page in res, and the cursor of the
+// next page
+func decodeItems(res *[]string) Decode {
+	return func(resp *http.Response) (Page, error) {
+		var page struct {
+			Items []string `json:"items"`
+			Next  string   `json:"next"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			return Page{}, err
+		}
+		*res = append(*res, page.Items...)
+		return Page{Items: len(page.Items), Cursor: page.Next}, nil
+	}
+}
+
+// servePage writes the items of testItems from an offset
+func servePage(w http.ResponseWriter, offset, limit int, next string) {
+	end := offset + limit
+	if end > len(testItems) {
+		end = len(testItems)
+	}
+	var items []string
+	if offset < end {
+		items = testItems[offset:end]
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"items": items, "next": next})
+}
+
+func newRequest(t *testing.T, url string) *http.Request {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestLink(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token" {
+			t.Error("expected the headers of the first request")
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 2 {
+			w.Header().Set("Link", fmt.Sprintf(`</items?page=%d>; rel="next", </items?page=2>; rel="last"`, page+1))
+		}
+		servePage(w, page*2, 2, "")
+	}))
+	defer srv.Close()
+
+	req := newRequest(t, srv.URL+"/items")
+	req.Header.Set("Authorization", "token")
+	var items []string
+	if err := All(context.Background(), nil, req, Options{Mode: Link}, decodeItems(&items)); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(items, "") != "abcde" {
+		t.Errorf("expected all the items, got %v", items)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("limit") != "2" || r.URL.Query().Get("filter") != "x" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		offset, _ := strconv.Atoi(r.URL.Query().Get("after"))
+		next := ""
+		if offset+2 < len(testItems) {
+			next = strconv.Itoa(offset + 2)
+		}
+		servePage(w, offset, 2, next)
+	}))
+	defer srv.Close()
+
+	opts := Options{Mode: Cursor, CursorParam: "after", LimitParam: "limit", Limit: 2, MaxPages: 2}
+	p, err := New(srv.Client(), newRequest(t, srv.URL+"/items?filter=x"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []string
+	for p.More() {
+		if err := p.Next(context.Background(), decodeItems(&items)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the iteration stops after MaxPages pages, and can be resumed from
+	// the request of the next page
+	if strings.Join(items, "") != "abcd" {
+		t.Errorf("expected the items of 2 pages, got %v", items)
+	}
+	if after := p.Request().URL.Query().Get("after"); after != "4" {
+		t.Errorf("expected the cursor of the next page, got %s", after)
+	}
+	p, err = New(srv.Client(), p.Request(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p.More() {
+		if err := p.Next(context.Background(), decodeItems(&items)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Join(items, "") != "abcde" {
+		t.Errorf("expected all the items, got %v", items)
+	}
+	if err := p.Next(context.Background(), decodeItems(&items)); err != io.EOF {
+		t.Errorf("expected io.EOF after the last page, got %v", err)
+	}
+}
+
+func TestOffset(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("count"))
+		servePage(w, offset, limit, "")
+	}))
+	defer srv.Close()
+
+	// the iteration starts from the offset of the request, and stops at
+	// the first short page
+	var items []string
+	opts := Options{Mode: Offset, OffsetParam: "offset", LimitParam: "count", Limit: 2}
+	if err := All(context.Background(), srv.Client(), newRequest(t, srv.URL+"/items?offset=1"), opts, decodeItems(&items)); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(items, "") != "bcde" || requests != 3 {
+		t.Errorf("expected the items from the offset in 3 requests, got %v in %d", items, requests)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	fail := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		servePage(w, 0, 5, "")
+	}))
+	defer srv.Close()
+
+	p, err := New(srv.Client(), newRequest(t, srv.URL), Options{Mode: Link})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []string
+	err = p.Next(context.Background(), decodeItems(&items))
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode() != http.StatusForbidden {
+		t.Fatalf("expected a status error, got %v", err)
+	}
+
+	// the failed page is requested again, and so is a page that can't be
+	// decoded
+	fail = false
+	decodeErr := errors.New("decode")
+	if err := p.Next(context.Background(), func(*http.Response) (Page, error) { return Page{}, decodeErr }); err != decodeErr {
+		t.Fatalf("expected the decoding error, got %v", err)
+	}
+	if !p.More() {
+		t.Fatal("expected the page to be requested again")
+	}
+	if err := p.Next(context.Background(), decodeItems(&items)); err != nil || len(items) != 5 || p.More() {
+		t.Errorf("expected all the items, got %v (%v)", items, err)
+	}
+
+	for _, opts := range []Options{{Mode: Cursor}, {Mode: Offset, OffsetParam: "offset"}, {Mode: 3}} {
+		if _, err := New(nil, newRequest(t, srv.URL), opts); err == nil {
+			t.Errorf("%+v: expected an error", opts)
+		}
+	}
+}
+
+func TestTooManyRequests(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		servePage(w, 0, 5, "")
+	}))
+	defer srv.Close()
+
+	// the page is retried once the limiter is restored
+	var items []string
+	opts := Options{Mode: Link, Limiter: ratelimit.New(0, 1)}
+	if err := All(context.Background(), srv.Client(), newRequest(t, srv.URL), opts, decodeItems(&items)); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 5 || requests != 2 {
+		t.Errorf("expected the page to be retried, got %v in %d requests", items, requests)
+	}
+
+	// without a limiter the status is returned
+	requests = 0
+	err := All(context.Background(), srv.Client(), newRequest(t, srv.URL), Options{Mode: Link}, decodeItems(&items))
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected a status error, got %v", err)
+	}
+
+	// and the wait of the limiter is stopped by the context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	limiter := ratelimit.New(0, 1)
+	limiter.Pause(time.Hour)
+	opts.Limiter = limiter
+	if err := All(ctx, srv.Client(), newRequest(t, srv.URL), opts, decodeItems(&items)); err != context.DeadlineExceeded {
+		t.Errorf("expected the context error, got %v", err)
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	tests := []struct {
+		header   []string
+		expected string
+	}{
+		{[]string{`<https://api.github.com/user/repos?page=3>; rel="next", <https://api.github.com/user/repos?page=50>; rel="last"`}, "https://api.github.com/user/repos?page=3"},
+		{[]string{`<https://a/1>; rel="self"`, `<https://a/2>; REL=next`}, "https://a/2"},
+		{[]string{`<https://a/2>; rel="prev next"`}, "https://a/2"},
+		{[]string{`<https://a/1>; rel="last"`}, ""},
+		{[]string{`https://a/1; rel="next"`}, ""},
+		{nil, ""},
+	}
+	for _, test := range tests {
+		h := http.Header{}
+		for _, v := range test.header {
+			h.Add("Link", v)
+		}
+		if res := NextLink(h); res != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.header, test.expected, res)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proto
+
+import (
+	"bytes"
+	"io"
+)
+
+// Cache keeps the last event decoded from the payload of an event, so that
+// extracting several fields from the same event reads and decodes its
+// payload only once, like jsoncache does for JSON. The zero value is ready
+// to use. A Cache must not be used concurrently.
+type Cache struct {
+	buf    bytes.Buffer
+	event  Event
+	evtNum uint64
+	valid  bool
+	isPB   bool
+}
+
+// Get returns the decoded event of the event with the given number, or nil
+// if its payload is not encoded with the envelope, in which case only its
+// first bytes are read from r. The payload is read and decoded only if the
+// event is not the one decoded last. The event remains valid until the next
+// call to Get with another event number.
+func (c *Cache) Get(evtNum uint64, r io.Reader) (*Event, error) {
+	if c.valid && c.evtNum == evtNum {
+		if !c.isPB {
+			return nil, nil
+		}
+		return &c.event, nil
+	}
+
+	c.valid = false
+	c.buf.Reset()
+	if _, err := io.CopyN(&c.buf, r, int64(len(header))); err != nil && err != io.EOF {
+		return nil, err
+	}
+	c.isPB = IsEvent(c.buf.Bytes())
+	if c.isPB {
+		if _, err := c.buf.ReadFrom(r); err != nil {
+			return nil, err
+		}
+		if err := c.event.Unmarshal(c.buf.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	c.evtNum = evtNum
+	c.valid = true
+	if !c.isPB {
+		return nil, nil
+	}
+	return &c.event, nil
+}
+
+// Reset drops the cached event, so that the next call to Get decodes the
+// payload again
+func (c *Cache) Reset() {
+	c.valid = false
+}
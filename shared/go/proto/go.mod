@@ -0,0 +1,5 @@
+module github.com/falcosecurity/plugins/shared/go/proto
+
+go 1.15
+
+require google.golang.org/protobuf v1.34.2
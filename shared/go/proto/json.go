@@ -0,0 +1,197 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// node is a member of the JSON object rendered from the attributes
+type node struct {
+	name     string
+	value    *Value
+	children []*node
+}
+
+func (n *node) child(name string) *node {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	c := &node{name: name}
+	n.children = append(n.children, c)
+	return c
+}
+
+func (n *node) appendJSON(dst []byte) []byte {
+	if n.value != nil {
+		return n.value.AppendJSON(dst)
+	}
+	dst = append(dst, '{')
+	for i, c := range n.children {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendJSONString(dst, []byte(c.name))
+		dst = append(dst, ':')
+		dst = c.appendJSON(dst)
+	}
+	return append(dst, '}')
+}
+
+// insert adds a value to the tree of the members, unless it is hidden by
+// a value whose pointer is a prefix of its own, or it hides other ones
+func (n *node) insert(tokens []string, v *Value) {
+	for _, t := range tokens {
+		if n.value != nil {
+			return
+		}
+		n = n.child(t)
+	}
+	if n.value == nil && len(n.children) == 0 {
+		n.value = v
+	}
+}
+
+// AppendJSON appends the JSON encoding of the event to dst, which is the
+// object having each attribute at its JSON pointer. The members keep the
+// order of the attributes, and an attribute hides the ones whose pointer
+// is nested in its own.
+func (e *Event) AppendJSON(dst []byte) []byte {
+	root := &node{}
+	for i := range e.attrs {
+		if tokens := pointerTokens(string(e.attrs[i].key)); len(tokens) > 0 {
+			root.insert(tokens, &e.attrs[i].Value)
+		}
+	}
+	return root.appendJSON(dst)
+}
+
+// Lookup returns the value at a JSON pointer, which is either the value of
+// the attribute with this key or the JSON object made of the attributes
+// nested in it, as rendered by AppendJSON
+func (e *Event) Lookup(pointer string) (Value, bool) {
+	if v, ok := e.Get(pointer); ok {
+		return v, true
+	}
+	prefix := []byte(pointer + "/")
+	var root *node
+	for i := range e.attrs {
+		if bytes.HasPrefix(e.attrs[i].key, prefix) {
+			if root == nil {
+				root = &node{}
+			}
+			root.insert(pointerTokens(string(e.attrs[i].key[len(prefix)-1:])), &e.attrs[i].Value)
+		}
+	}
+	if root == nil {
+		return Value{}, false
+	}
+	return Value{kind: KindJSON, raw: root.appendJSON(nil)}, true
+}
+
+// pointerTokens returns the reference tokens of a JSON pointer. The keys
+// that are not pointers are a single token.
+func pointerTokens(key string) []string {
+	if !strings.HasPrefix(key, "/") {
+		if key == "" {
+			return nil
+		}
+		return []string{key}
+	}
+	tokens := strings.Split(key[1:], "/")
+	for i, t := range tokens {
+		if strings.Contains(t, "~") {
+			t = strings.Replace(t, "~1", "/", -1)
+			tokens[i] = strings.Replace(t, "~0", "~", -1)
+		}
+	}
+	return tokens
+}
+
+// Flatten appends the members of a JSON object as attributes, descending
+// into the nested objects. The arrays, the nulls and the empty objects are
+// appended as JSON values, and the numbers as integers when they are.
+func (b *Builder) Flatten(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil {
+		return err
+	} else if t != json.Delim('{') {
+		return fmt.Errorf("not a JSON object")
+	}
+	return b.flatten(dec, "")
+}
+
+func (b *Builder) flatten(dec *json.Decoder, prefix string) error {
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := prefix + Pointer(t.(string))
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		switch raw[0] {
+		case '{':
+			nested := json.NewDecoder(bytes.NewReader(raw))
+			nested.UseNumber()
+			nested.Token()
+			if !nested.More() {
+				b.JSON(key, []byte("{}"))
+				continue
+			}
+			if err := b.flatten(nested, key); err != nil {
+				return err
+			}
+		case '"':
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return err
+			}
+			b.String(key, s)
+		case 't', 'f':
+			b.Bool(key, raw[0] == 't')
+		case '[', 'n':
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, raw); err != nil {
+				return err
+			}
+			b.JSON(key, buf.Bytes())
+		default:
+			if n, err := strconv.ParseInt(string(raw), 10, 64); err == nil {
+				b.Int(key, n)
+				continue
+			}
+			f, err := strconv.ParseFloat(string(raw), 64)
+			if err != nil {
+				return err
+			}
+			b.Double(key, f)
+		}
+	}
+	return nil
+}
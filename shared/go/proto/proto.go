@@ -0,0 +1,339 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package proto implements a compact protobuf envelope for the payloads of
+// the events of the high-volume sources, which can be used instead of JSON
+// to save the cost of its encoding and decoding. The schema of the envelope
+// is in event.proto: an event is a flat list of typed attributes, each keyed
+// by the JSON pointer (RFC 6901) the value would have in the JSON encoding
+// of the event, e.g. /resource/attributes/service.name. This way the
+// extractors look up the same keys with both encodings, and the events can
+// be rendered as JSON when needed.
+//
+// The wire format is encoded and decoded by hand, so that the plugins don't
+// depend on a protobuf runtime for this.
+package proto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Version is the version of the envelope
+const Version = 1
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// field numbers of the Event and Attribute messages
+const (
+	fieldVersion    = 1
+	fieldAttributes = 2
+
+	fieldKey = 1
+)
+
+// Kind is the type of the value of an attribute, which is the number of
+// its field in the Attribute message
+type Kind uint8
+
+const (
+	KindString Kind = 2
+	KindBool   Kind = 3
+	KindInt    Kind = 4
+	KindDouble Kind = 5
+	KindBytes  Kind = 6
+	KindJSON   Kind = 7
+)
+
+// header is the encoding of the version field, which starts every event
+var header = []byte{fieldVersion<<3 | wireVarint, Version}
+
+var errTruncated = errors.New("truncated protobuf event")
+
+// IsEvent returns true if the data starts like an event encoded with the
+// envelope, which never happens with JSON
+func IsEvent(data []byte) bool {
+	return len(data) >= len(header) && data[0] == header[0] && data[1] == header[1]
+}
+
+// Pointer returns the JSON pointer made of the given reference tokens,
+// e.g. /resource/attributes/service.name for "resource", "attributes" and
+// "service.name"
+func Pointer(tokens ...string) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		b.WriteByte('/')
+		if strings.ContainsAny(t, "~/") {
+			t = strings.Replace(t, "~", "~0", -1)
+			t = strings.Replace(t, "/", "~1", -1)
+		}
+		b.WriteString(t)
+	}
+	return b.String()
+}
+
+// Builder encodes an event by appending its attributes one after the
+// other. The zero value is ready to use.
+type Builder struct {
+	buf []byte
+}
+
+// Reset drops the attributes appended so far, keeping the allocated memory
+func (b *Builder) Reset() {
+	b.buf = b.buf[:0]
+}
+
+// Bytes returns the encoding of the event, which remains valid until the
+// next call to Reset
+func (b *Builder) Bytes() []byte {
+	if len(b.buf) == 0 {
+		b.buf = append(b.buf, header...)
+	}
+	return b.buf
+}
+
+// Len returns the size of the encoding of the event
+func (b *Builder) Len() int {
+	return len(b.Bytes())
+}
+
+// String appends a string attribute
+func (b *Builder) String(key, v string) {
+	b.appendBytes(key, KindString, v)
+}
+
+// Bool appends a bool attribute
+func (b *Builder) Bool(key string, v bool) {
+	var n uint64
+	if v {
+		n = 1
+	}
+	b.appendVarint(key, KindBool, n)
+}
+
+// Int appends an integer attribute
+func (b *Builder) Int(key string, v int64) {
+	b.appendVarint(key, KindInt, uint64(v))
+}
+
+// Double appends a floating point attribute
+func (b *Builder) Double(key string, v float64) {
+	b.appendAttribute(key, 1+8)
+	b.buf = append(b.buf, byte(KindDouble)<<3|wireFixed64)
+	b.buf = appendFixed64(b.buf, math.Float64bits(v))
+}
+
+// Binary appends a bytes attribute, which is rendered in base64 as JSON
+func (b *Builder) Binary(key string, v []byte) {
+	b.appendBytes(key, KindBytes, string(v))
+}
+
+// JSON appends an attribute holding a JSON encoded value, typically an
+// array or an object that is not worth flattening
+func (b *Builder) JSON(key string, v []byte) {
+	b.appendBytes(key, KindJSON, string(v))
+}
+
+// Merge appends the attributes of another encoded event, e.g. the ones
+// shared by several events and encoded once for all of them
+func (b *Builder) Merge(data []byte) {
+	if IsEvent(data) {
+		b.Bytes()
+		b.buf = append(b.buf, data[len(header):]...)
+	}
+}
+
+func (b *Builder) appendVarint(key string, k Kind, v uint64) {
+	b.appendAttribute(key, 1+varintSize(v))
+	b.buf = append(b.buf, byte(k)<<3|wireVarint)
+	b.buf = appendVarint(b.buf, v)
+}
+
+func (b *Builder) appendBytes(key string, k Kind, v string) {
+	b.appendAttribute(key, 1+varintSize(uint64(len(v)))+len(v))
+	b.buf = append(b.buf, byte(k)<<3|wireBytes)
+	b.buf = appendVarint(b.buf, uint64(len(v)))
+	b.buf = append(b.buf, v...)
+}
+
+// appendAttribute appends the header of an Attribute message along with
+// its key, leaving the given number of bytes for its value
+func (b *Builder) appendAttribute(key string, valueSize int) {
+	b.Bytes()
+	keySize := 1 + varintSize(uint64(len(key))) + len(key)
+	b.buf = append(b.buf, fieldAttributes<<3|wireBytes)
+	b.buf = appendVarint(b.buf, uint64(keySize+valueSize))
+	b.buf = append(b.buf, fieldKey<<3|wireBytes)
+	b.buf = appendVarint(b.buf, uint64(len(key)))
+	b.buf = append(b.buf, key...)
+}
+
+// Attribute is an attribute of a decoded event
+type Attribute struct {
+	key   []byte
+	Value Value
+}
+
+// Key returns the JSON pointer of the attribute
+func (a *Attribute) Key() string {
+	return string(a.key)
+}
+
+// Event is a decoded event. The zero value is ready to use, and an Event
+// can be reused to decode several events to save allocations.
+type Event struct {
+	attrs []Attribute
+}
+
+// Unmarshal decodes an event, replacing the attributes decoded before. The
+// event references data, which must not be modified while the event is in
+// use. The unknown fields are skipped.
+func (e *Event) Unmarshal(data []byte) error {
+	e.attrs = e.attrs[:0]
+	if !IsEvent(data) {
+		return fmt.Errorf("not a protobuf event of version %d", Version)
+	}
+	data = data[len(header):]
+	for len(data) > 0 {
+		num, wire, value, rest, err := consumeField(data)
+		if err != nil {
+			return err
+		}
+		data = rest
+		switch {
+		case num == fieldVersion && wire == wireVarint:
+			if v, _ := binary.Uvarint(value); v != Version {
+				return fmt.Errorf("unsupported protobuf event version: %d", v)
+			}
+		case num == fieldAttributes && wire == wireBytes:
+			attr, err := decodeAttribute(value)
+			if err != nil {
+				return err
+			}
+			e.attrs = append(e.attrs, attr)
+		}
+	}
+	return nil
+}
+
+// Attributes returns the attributes of the event, in their encoding order
+func (e *Event) Attributes() []Attribute {
+	return e.attrs
+}
+
+// Get returns the value of the first attribute with the given key
+func (e *Event) Get(key string) (Value, bool) {
+	for i := range e.attrs {
+		if string(e.attrs[i].key) == key {
+			return e.attrs[i].Value, true
+		}
+	}
+	return Value{}, false
+}
+
+func decodeAttribute(data []byte) (Attribute, error) {
+	var res Attribute
+	for len(data) > 0 {
+		num, wire, value, rest, err := consumeField(data)
+		if err != nil {
+			return res, err
+		}
+		data = rest
+		switch k := Kind(num); {
+		case num == fieldKey && wire == wireBytes:
+			res.key = value
+		case (k == KindString || k == KindBytes || k == KindJSON) && wire == wireBytes:
+			res.Value = Value{kind: k, raw: value}
+		case (k == KindBool || k == KindInt) && wire == wireVarint:
+			n, _ := binary.Uvarint(value)
+			res.Value = Value{kind: k, num: n}
+		case k == KindDouble && wire == wireFixed64:
+			res.Value = Value{kind: k, num: binary.LittleEndian.Uint64(value)}
+		}
+	}
+	return res, nil
+}
+
+// consumeField decodes the field at the start of data, and returns its
+// number, its wire type, its value and the data following it. The value of
+// the varints is their encoding, and the one of the length-delimited
+// fields is their content.
+func consumeField(data []byte) (num uint64, wire int, value, rest []byte, err error) {
+	tag, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, 0, nil, nil, errTruncated
+	}
+	data = data[n:]
+	num, wire = tag>>3, int(tag&7)
+	if num == 0 {
+		return 0, 0, nil, nil, errors.New("invalid protobuf field number: 0")
+	}
+	switch wire {
+	case wireVarint:
+		if _, n = binary.Uvarint(data); n <= 0 {
+			return 0, 0, nil, nil, errTruncated
+		}
+	case wireFixed64:
+		n = 8
+	case wireFixed32:
+		n = 4
+	case wireBytes:
+		size, m := binary.Uvarint(data)
+		if m <= 0 || size > uint64(len(data)-m) {
+			return 0, 0, nil, nil, errTruncated
+		}
+		data = data[m:]
+		n = int(size)
+	default:
+		return 0, 0, nil, nil, fmt.Errorf("unsupported protobuf wire type: %d", wire)
+	}
+	if n > len(data) {
+		return 0, 0, nil, nil, errTruncated
+	}
+	return num, wire, data[:n], data[n:], nil
+}
+
+func varintSize(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendFixed64(b []byte, v uint64) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24),
+		byte(v>>32), byte(v>>40), byte(v>>48), byte(v>>56))
+}
@@ -0,0 +1,390 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proto
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	pb "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// eventDescriptor returns the descriptor of the Event message of
+// event.proto, for the reference implementation of protobuf
+func eventDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, oneof bool) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     pb.String(name),
+			JsonName: pb.String(name),
+			Number:   pb.Int32(num),
+			Type:     typ.Enum(),
+			Label:    label.Enum(),
+		}
+		if typ == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+			f.TypeName = pb.String(".falcosecurity.plugins.event.v1.Attribute")
+		}
+		if oneof {
+			f.OneofIndex = pb.Int32(0)
+		}
+		return f
+	}
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    pb.String("event.proto"),
+		Package: pb.String("falcosecurity.plugins.event.v1"),
+		Syntax:  pb.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: pb.String("Event"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("version", 1, descriptorpb.FieldDescriptorProto_TYPE_UINT32, optional, false),
+					field("attributes", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_LABEL_REPEATED, false),
+				},
+			},
+			{
+				Name: pb.String("Attribute"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, false),
+					field("string_value", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, true),
+					field("bool_value", 3, descriptorpb.FieldDescriptorProto_TYPE_BOOL, optional, true),
+					field("int_value", 4, descriptorpb.FieldDescriptorProto_TYPE_INT64, optional, true),
+					field("double_value", 5, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, optional, true),
+					field("bytes_value", 6, descriptorpb.FieldDescriptorProto_TYPE_BYTES, optional, true),
+					field("json_value", 7, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, true),
+				},
+				OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: pb.String("value")}},
+			},
+		},
+	}
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd.Messages().ByName("Event")
+}
+
+// testEvent returns an event with attributes of all the kinds
+func testEvent() *Builder {
+	var b Builder
+	b.String("/name", "alice")
+	b.String("/empty", "")
+	b.Bool("/admin", true)
+	b.Bool("/guest", false)
+	b.Int("/age", 42)
+	b.Int("/negative", -1)
+	b.Int("/max", math.MaxInt64)
+	b.Double("/score", 1.5)
+	b.Double("/nan", math.NaN())
+	b.Binary("/raw", []byte{0, 1, 0xff})
+	b.JSON("/tags", []byte(`["a","b"]`))
+	b.String("/"+strings.Repeat("k", 200), strings.Repeat("v", 300))
+	return &b
+}
+
+const testEventJSON = `{"version":1,"attributes":[` +
+	`{"key":"/name","string_value":"alice"},{"key":"/empty","string_value":""},` +
+	`{"key":"/admin","bool_value":true},{"key":"/guest","bool_value":false},` +
+	`{"key":"/age","int_value":"42"},{"key":"/negative","int_value":"-1"},{"key":"/max","int_value":"9223372036854775807"},` +
+	`{"key":"/score","double_value":1.5},{"key":"/nan","double_value":"NaN"},` +
+	`{"key":"/raw","bytes_value":"AAH/"},{"key":"/tags","json_value":"[\"a\",\"b\"]"}]}`
+
+func TestBuilderReference(t *testing.T) {
+	desc := eventDescriptor(t)
+	b := testEvent()
+
+	// the encoding is decoded by the reference implementation, with the
+	// values in their field of the oneof
+	msg := dynamicpb.NewMessage(desc)
+	if err := pb.Unmarshal(b.Bytes(), msg); err != nil {
+		t.Fatal(err)
+	}
+	expected := dynamicpb.NewMessage(desc)
+	if err := protojson.Unmarshal([]byte(testEventJSON), expected); err != nil {
+		t.Fatal(err)
+	}
+	attrs := expected.Get(desc.Fields().ByName("attributes")).List()
+	long := dynamicpb.NewMessage(desc.Fields().ByName("attributes").Message())
+	long.Set(long.Descriptor().Fields().ByName("key"), protoreflect.ValueOfString("/"+strings.Repeat("k", 200)))
+	long.Set(long.Descriptor().Fields().ByName("string_value"), protoreflect.ValueOfString(strings.Repeat("v", 300)))
+	attrs.Append(protoreflect.ValueOfMessage(long))
+	if !pb.Equal(msg, expected) {
+		t.Errorf("expected %v, got %v", expected, msg)
+	}
+	if b.Len() != len(b.Bytes()) || b.Len() != pb.Size(expected) {
+		t.Errorf("expected the size %d, got %d", pb.Size(expected), b.Len())
+	}
+
+	// and the encoding of the reference implementation is decoded the
+	// same way
+	data, err := pb.MarshalOptions{Deterministic: true}.Marshal(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var evt, ref Event
+	if err := evt.Unmarshal(b.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := ref.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if a, b := evt.AppendJSON(nil), ref.AppendJSON(nil); !bytes.Equal(a, b) {
+		t.Errorf("expected %s, got %s", a, b)
+	}
+}
+
+func TestEventValues(t *testing.T) {
+	var evt Event
+	if err := evt.Unmarshal(testEvent().Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if len(evt.Attributes()) != 12 || evt.Attributes()[0].Key() != "/name" {
+		t.Fatalf("unexpected attributes %v", evt.Attributes())
+	}
+	get := func(key string) Value {
+		v, ok := evt.Get(key)
+		if !ok {
+			t.Fatalf("expected the attribute %s", key)
+		}
+		return v
+	}
+	if v := get("/name"); v.Kind() != KindString || v.String() != "alice" {
+		t.Errorf("unexpected string %v", v)
+	}
+	if b, ok := get("/admin").Bool(); !ok || !b {
+		t.Error("expected true")
+	}
+	if n, ok := get("/negative").Int(); !ok || n != -1 {
+		t.Errorf("expected -1, got %d", n)
+	}
+	if n, ok := get("/max").Int(); !ok || n != math.MaxInt64 {
+		t.Errorf("expected the max int, got %d", n)
+	}
+	if f, ok := get("/score").Double(); !ok || f != 1.5 {
+		t.Errorf("expected 1.5, got %f", f)
+	}
+	if raw, ok := get("/raw").Raw(); !ok || !bytes.Equal(raw, []byte{0, 1, 0xff}) || get("/raw").String() != "AAH/" {
+		t.Errorf("unexpected bytes %v", raw)
+	}
+	if s := get("/nan").String(); s != "NaN" {
+		t.Errorf("expected NaN unquoted, got %s", s)
+	}
+	if _, ok := get("/name").Int(); ok {
+		t.Error("expected a string not to be an int")
+	}
+	if _, ok := evt.Get("/missing"); ok {
+		t.Error("expected no missing attribute")
+	}
+	if v := (Value{}); v.String() != "" || string(v.AppendJSON(nil)) != "null" {
+		t.Error("expected an empty value")
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	valid := testEvent().Bytes()
+	tests := map[string][]byte{
+		"json":           []byte(`{"version":1}`),
+		"version":        {0x08, 0x02},
+		"later version":  append(append([]byte(nil), valid...), 0x08, 0x02),
+		"truncated":      valid[:len(valid)-1],
+		"field number 0": append([]byte{0x08, 0x01}, 0x00, 0x00),
+		"wire type":      append([]byte{0x08, 0x01}, 0x13),
+		"varint":         append([]byte{0x08, 0x01}, 0x18, 0x80),
+	}
+	for name, data := range tests {
+		var evt Event
+		if err := evt.Unmarshal(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// the unknown fields are skipped
+	data := append(append([]byte(nil), valid...), 0x18, 0x01, 0x21, 1, 2, 3, 4, 5, 6, 7, 8, 0x2d, 1, 2, 3, 4)
+	var evt Event
+	if err := evt.Unmarshal(data); err != nil || len(evt.Attributes()) != 12 {
+		t.Errorf("expected the unknown fields to be skipped, got %v", err)
+	}
+	if !IsEvent(valid) || IsEvent([]byte("{}")) || IsEvent(nil) {
+		t.Error("unexpected IsEvent")
+	}
+}
+
+func TestFlattenJSON(t *testing.T) {
+	tests := []struct {
+		in, expected string
+	}{
+		{`{"a":"x","b":{"c":1,"d":{"e":true}},"f":[1,{"g":2}],"h":null}`, ""},
+		{`{"a/b":{"c~d":-1.25e-7},"e":{},"f":1e300,"g":12345678901234567890}`, `{"a/b":{"c~d":-1.25e-7},"e":{},"f":1e+300,"g":12345678901234567000}`},
+		{`{"s":"\u0000<>& é\"\\"}`, ""},
+	}
+	for _, test := range tests {
+		var b Builder
+		if err := b.Flatten([]byte(test.in)); err != nil {
+			t.Fatal(err)
+		}
+		var evt Event
+		if err := evt.Unmarshal(b.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		res := evt.AppendJSON(nil)
+
+		// the rendering is the same JSON value, and the one encoding/json
+		// renders once decoded
+		expected := test.expected
+		if expected == "" {
+			expected = test.in
+		}
+		var a, e interface{}
+		if err := json.Unmarshal(res, &a); err != nil {
+			t.Fatalf("invalid JSON %s: %v", res, err)
+		}
+		json.Unmarshal([]byte(expected), &e)
+		ja, _ := json.Marshal(a)
+		je, _ := json.Marshal(e)
+		if !bytes.Equal(ja, je) {
+			t.Errorf("expected %s, got %s", expected, res)
+		}
+	}
+
+	for _, in := range []string{`[1]`, `{"a":`, `{"a":1e999}`} {
+		var b Builder
+		if err := b.Flatten([]byte(in)); err == nil {
+			t.Errorf("%s: expected an error", in)
+		}
+	}
+}
+
+func TestAppendJSONFloat(t *testing.T) {
+	// the floats are rendered like encoding/json does
+	for _, f := range []float64{0, 1, -1.5, 1e20, 1e21, 1e-6, 1e-7, 123456789.125, -2.5e-10, math.MaxFloat64, math.SmallestNonzeroFloat64} {
+		expected, _ := json.Marshal(f)
+		if res := appendJSONFloat(nil, f); !bytes.Equal(res, expected) {
+			t.Errorf("%g: expected %s, got %s", f, expected, res)
+		}
+	}
+	if res := appendJSONFloat(nil, math.Inf(-1)); string(res) != `"-Inf"` {
+		t.Errorf("expected -Inf as a string, got %s", res)
+	}
+}
+
+func TestAppendJSONString(t *testing.T) {
+	for _, s := range []string{"", "abc", "\"\\\n\r\t\x00\x1f", "<>&", "é ", "\xff\xfe"} {
+		var res string
+		if err := json.Unmarshal(appendJSONString(nil, []byte(s)), &res); err != nil {
+			t.Fatalf("%q: %v", s, err)
+		}
+		// the invalid bytes are replaced like encoding/json does
+		var expected string
+		b, _ := json.Marshal(s)
+		json.Unmarshal(b, &expected)
+		if res != expected {
+			t.Errorf("expected %q, got %q", expected, res)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	var b Builder
+	b.String("/a/b", "x")
+	b.Int("/a/c/d", 1)
+	b.String("/e", "y")
+	// hidden by /e
+	b.String("/e/f", "z")
+	var evt Event
+	if err := evt.Unmarshal(b.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if res := string(evt.AppendJSON(nil)); res != `{"a":{"b":"x","c":{"d":1}},"e":"y"}` {
+		t.Errorf("unexpected JSON %s", res)
+	}
+	if v, ok := evt.Lookup("/a"); !ok || v.Kind() != KindJSON || v.String() != `{"b":"x","c":{"d":1}}` {
+		t.Errorf("unexpected object %v", v)
+	}
+	if v, ok := evt.Lookup("/a/b"); !ok || v.String() != "x" {
+		t.Errorf("unexpected value %v", v)
+	}
+	if _, ok := evt.Lookup("/x"); ok {
+		t.Error("expected no value")
+	}
+}
+
+func TestPointer(t *testing.T) {
+	if p := Pointer("resource", "attributes", "service.name"); p != "/resource/attributes/service.name" {
+		t.Errorf("unexpected pointer %s", p)
+	}
+	if p := Pointer("a/b", "c~d"); p != "/a~1b/c~0d" {
+		t.Errorf("unexpected pointer %s", p)
+	}
+	for key, expected := range map[string]string{"/a~1b/c~0d": "a/b,c~d", "plain": "plain", "": ""} {
+		if tokens := strings.Join(pointerTokens(key), ","); tokens != expected {
+			t.Errorf("%s: expected %s, got %s", key, expected, tokens)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	var shared, b Builder
+	shared.String("/resource", "r")
+	b.Int("/n", 1)
+	b.Merge(shared.Bytes())
+	b.Merge([]byte("{}"))
+	var evt Event
+	if err := evt.Unmarshal(b.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if res := string(evt.AppendJSON(nil)); res != `{"n":1,"resource":"r"}` {
+		t.Errorf("unexpected JSON %s", res)
+	}
+	b.Reset()
+	if !bytes.Equal(b.Bytes(), header) {
+		t.Error("expected an empty event")
+	}
+}
+
+func TestCache(t *testing.T) {
+	data := testEvent().Bytes()
+	var c Cache
+	evt, err := c.Get(1, bytes.NewReader(data))
+	if err != nil || evt == nil || len(evt.Attributes()) != 12 {
+		t.Fatalf("unexpected event %v (%v)", evt, err)
+	}
+	// the payload is not read again for the same event
+	if evt, err := c.Get(1, bytes.NewReader(nil)); err != nil || evt == nil {
+		t.Errorf("expected the cached event, got %v", err)
+	}
+	c.Reset()
+	if _, err := c.Get(1, bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Error("expected the payload to be decoded again")
+	}
+
+	// only the first bytes of the other payloads are read
+	r := bytes.NewReader([]byte(`{"a":1}`))
+	if evt, err := c.Get(2, r); err != nil || evt != nil || r.Len() != 5 {
+		t.Errorf("expected no event, got %v (%v)", evt, err)
+	}
+	if evt, err := c.Get(2, bytes.NewReader(data)); err != nil || evt != nil {
+		t.Errorf("expected the cached result, got %v (%v)", evt, err)
+	}
+}
@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proto
+
+import (
+	"encoding/base64"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Value is the value of an attribute
+type Value struct {
+	kind Kind
+	raw  []byte
+	num  uint64
+}
+
+// Kind returns the type of the value, which is 0 for the attributes
+// without a value
+func (v Value) Kind() Kind {
+	return v.kind
+}
+
+// Int returns the value of the integer attributes
+func (v Value) Int() (int64, bool) {
+	return int64(v.num), v.kind == KindInt
+}
+
+// Double returns the value of the floating point attributes
+func (v Value) Double() (float64, bool) {
+	return math.Float64frombits(v.num), v.kind == KindDouble
+}
+
+// Bool returns the value of the bool attributes
+func (v Value) Bool() (bool, bool) {
+	return v.num != 0, v.kind == KindBool
+}
+
+// Raw returns the content of the string, bytes and JSON attributes
+func (v Value) Raw() ([]byte, bool) {
+	return v.raw, v.kind == KindString || v.kind == KindBytes || v.kind == KindJSON
+}
+
+// String returns the string representation of the value, which is its
+// content for the strings and the JSON values, and its JSON encoding
+// otherwise
+func (v Value) String() string {
+	switch v.kind {
+	case KindString, KindJSON:
+		return string(v.raw)
+	case KindBytes:
+		return base64.StdEncoding.EncodeToString(v.raw)
+	case KindDouble:
+		// the doubles that can't be represented in JSON are not quoted
+		f := math.Float64frombits(v.num)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+	case 0:
+		return ""
+	}
+	return string(v.AppendJSON(nil))
+}
+
+// AppendJSON appends the JSON encoding of the value to dst, which is null
+// for the attributes without a value. The doubles that can't be
+// represented in JSON are encoded as strings.
+func (v Value) AppendJSON(dst []byte) []byte {
+	switch v.kind {
+	case KindString:
+		return appendJSONString(dst, v.raw)
+	case KindBool:
+		return strconv.AppendBool(dst, v.num != 0)
+	case KindInt:
+		return strconv.AppendInt(dst, int64(v.num), 10)
+	case KindDouble:
+		return appendJSONFloat(dst, math.Float64frombits(v.num))
+	case KindBytes:
+		dst = append(dst, '"')
+		dst = append(dst, base64.StdEncoding.EncodeToString(v.raw)...)
+		return append(dst, '"')
+	case KindJSON:
+		if len(v.raw) > 0 {
+			return append(dst, v.raw...)
+		}
+	}
+	return append(dst, "null"...)
+}
+
+// appendJSONFloat encodes a float like encoding/json does, so that the
+// values are rendered the same way with both encodings
+func appendJSONFloat(dst []byte, f float64) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		dst = append(dst, '"')
+		dst = strconv.AppendFloat(dst, f, 'g', -1, 64)
+		return append(dst, '"')
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	start := len(dst)
+	dst = strconv.AppendFloat(dst, f, format, -1, 64)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		if n := len(dst) - start; n >= 4 && dst[len(dst)-4] == 'e' && dst[len(dst)-3] == '-' && dst[len(dst)-2] == '0' {
+			dst[len(dst)-2] = dst[len(dst)-1]
+			dst = dst[:len(dst)-1]
+		}
+	}
+	return dst
+}
+
+const hex = "0123456789abcdef"
+
+// appendJSONString appends a quoted JSON string, replacing the invalid
+// UTF-8 sequences with the replacement character
+func appendJSONString(dst, s []byte) []byte {
+	dst = append(dst, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				dst = append(dst, '\\', c)
+			case c == '\n':
+				dst = append(dst, '\\', 'n')
+			case c == '\r':
+				dst = append(dst, '\\', 'r')
+			case c == '\t':
+				dst = append(dst, '\\', 't')
+			case c < 0x20:
+				dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			default:
+				dst = append(dst, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, "\ufffd"...)
+		} else {
+			dst = append(dst, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(dst, '"')
+}
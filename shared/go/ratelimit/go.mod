@@ -0,0 +1,3 @@
+module github.com/falcosecurity/plugins/shared/go/ratelimit
+
+go 1.15
@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ratelimit provides the throttling of the calls made by the plugins
+// polling SaaS APIs. A Limiter is a token bucket enforcing the documented
+// quota of an API, in calls per minute with a burst, and is paused by the
+// Retry-After and rate-limit headers of its responses, so that the plugins
+// wait for their quota to be restored instead of being banned.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultPause is how long a Limiter is paused by a 429 Too Many Requests
+// response without any header telling when to retry
+const DefaultPause = time.Minute
+
+// Limiter is a token bucket throttling the calls to an API. It is safe
+// for concurrent use.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second, 0 for no quota
+	burst  float64
+	tokens float64
+	last   time.Time
+	until  time.Time // no call is allowed before, after a rate-limit response
+}
+
+// New returns a Limiter allowing perMinute calls per minute, and up to burst
+// calls at once after an idle period. A perMinute of 0 enforces no quota,
+// and the Limiter only waits when paused by the headers of the responses.
+func New(perMinute float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:   perMinute / 60,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a call is allowed, or the context is done
+func (l *Limiter) Wait(ctx context.Context) error {
+	delay := l.reserve(time.Now())
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token and returns how long to wait before using it
+func (l *Limiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var delay time.Duration
+	if now.Before(l.until) {
+		delay = l.until.Sub(now)
+	}
+	if l.rate > 0 {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		l.tokens--
+		if l.tokens < 0 {
+			if d := time.Duration(-l.tokens / l.rate * float64(time.Second)); d > delay {
+				delay = d
+			}
+		}
+	}
+	return delay
+}
+
+// cancel gives back the token taken by a call that was not made
+func (l *Limiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate > 0 {
+		l.tokens = math.Min(l.burst, l.tokens+1)
+	}
+}
+
+// Pause prevents any call for the given duration
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.until) {
+		l.until = until
+	}
+}
+
+// Update pauses the Limiter according to a response of the API: until the
+// time given by its Retry-After header, or by its rate-limit headers once
+// the quota is exhausted. A 429 Too Many Requests response without any of
+// them pauses the Limiter for DefaultPause.
+func (l *Limiter) Update(resp *http.Response) {
+	if d, ok := Delay(resp.Header, time.Now()); ok {
+		l.Pause(d)
+		return
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		l.Pause(DefaultPause)
+	}
+}
+
+// Delay returns how long to wait before the next call according to the
+// headers of a response, if they tell so. Retry-After is either a number of
+// seconds or an HTTP date. The rate-limit headers are considered when their
+// remaining count is 0: X-Rate-Limit-Reset for Okta, X-RateLimit-Reset for
+// GitHub, and RateLimit-Reset, holding either a number of seconds or a Unix
+// time.
+func Delay(h http.Header, now time.Time) (time.Duration, bool) {
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Duration(secs) * time.Second, true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return t.Sub(now), true
+		}
+	}
+	for _, prefix := range []string{"X-Rate-Limit-", "X-RateLimit-", "RateLimit-"} {
+		if h.Get(prefix+"Remaining") != "0" {
+			continue
+		}
+		reset, err := strconv.ParseInt(h.Get(prefix+"Reset"), 10, 64)
+		if err != nil {
+			continue
+		}
+		// the values below a year of seconds are relative
+		if reset < 365*24*3600 {
+			return time.Duration(reset) * time.Second, true
+		}
+		return time.Unix(reset, 0).Sub(now), true
+	}
+	return 0, false
+}
+
+// transport is an http.RoundTripper throttled by a Limiter
+type transport struct {
+	limiter *Limiter
+	base    http.RoundTripper
+}
+
+// Transport returns an http.RoundTripper waiting for the Limiter before each
+// request sent with base, or http.DefaultTransport if nil, and updating it
+// with each response
+func Transport(l *Limiter, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{limiter: l, base: base}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.limiter.Update(resp)
+	return resp, nil
+}
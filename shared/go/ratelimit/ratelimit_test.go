@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReserve(t *testing.T) {
+	// 60 calls per minute with a burst of 2
+	l := New(60, 2)
+	now := l.last
+	for i, expected := range []time.Duration{0, 0, time.Second, 2 * time.Second} {
+		if d := l.reserve(now); d != expected {
+			t.Errorf("call %d: expected a delay of %s, got %s", i, expected, d)
+		}
+	}
+
+	// the tokens are restored over time, up to the burst
+	l = New(60, 2)
+	now = l.last.Add(time.Hour)
+	for i, expected := range []time.Duration{0, 0, time.Second} {
+		if d := l.reserve(now); d != expected {
+			t.Errorf("call %d: expected a delay of %s, got %s", i, expected, d)
+		}
+	}
+
+	// the token of a canceled call is given back
+	l = New(60, 1)
+	now = l.last
+	l.reserve(now)
+	l.cancel()
+	if d := l.reserve(now); d != 0 {
+		t.Errorf("expected no delay, got %s", d)
+	}
+
+	// no quota only waits for the pauses
+	l = New(0, 0)
+	for i := 0; i < 100; i++ {
+		if d := l.reserve(time.Now()); d != 0 {
+			t.Fatalf("expected no delay, got %s", d)
+		}
+	}
+	l.Pause(time.Minute)
+	l.Pause(time.Second)
+	if d := l.reserve(time.Now()); d <= 59*time.Second || d > time.Minute {
+		t.Errorf("expected the longest pause, got %s", d)
+	}
+}
+
+func TestWait(t *testing.T) {
+	l := New(0, 1)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	l.Pause(20 * time.Millisecond)
+	start := time.Now()
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 15*time.Millisecond {
+		t.Errorf("expected to wait for the pause, waited %s", d)
+	}
+
+	l.Pause(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected the context error, got %v", err)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		header   map[string]string
+		expected time.Duration
+		ok       bool
+	}{
+		{"retry after seconds", map[string]string{"Retry-After": "30"}, 30 * time.Second, true},
+		{"retry after date", map[string]string{"Retry-After": now.Add(time.Minute).Format(http.TimeFormat)}, time.Minute, true},
+		{"okta", map[string]string{"X-Rate-Limit-Remaining": "0", "X-Rate-Limit-Reset": strconv.FormatInt(now.Add(10*time.Second).Unix(), 10)}, 10 * time.Second, true},
+		{"github", map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(now.Add(time.Hour).Unix(), 10)}, time.Hour, true},
+		{"relative", map[string]string{"RateLimit-Remaining": "0", "RateLimit-Reset": "5"}, 5 * time.Second, true},
+		{"remaining", map[string]string{"X-RateLimit-Remaining": "10", "X-RateLimit-Reset": "5"}, 0, false},
+		{"invalid reset", map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "soon"}, 0, false},
+		{"invalid retry after", map[string]string{"Retry-After": "soon"}, 0, false},
+		{"none", nil, 0, false},
+	}
+	for _, test := range tests {
+		h := http.Header{}
+		for k, v := range test.header {
+			h.Set(k, v)
+		}
+		d, ok := Delay(h, now)
+		if d != test.expected || ok != test.ok {
+			t.Errorf("%s: expected %s %v, got %s %v", test.name, test.expected, test.ok, d, ok)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		status   int
+		header   map[string]string
+		expected time.Duration
+	}{
+		{http.StatusOK, nil, 0},
+		{http.StatusOK, map[string]string{"Retry-After": "30"}, 30 * time.Second},
+		{http.StatusTooManyRequests, nil, DefaultPause},
+		{http.StatusTooManyRequests, map[string]string{"Retry-After": "5"}, 5 * time.Second},
+	}
+	for _, test := range tests {
+		l := New(0, 1)
+		resp := &http.Response{StatusCode: test.status, Header: http.Header{}}
+		for k, v := range test.header {
+			resp.Header.Set(k, v)
+		}
+		l.Update(resp)
+		d := l.reserve(time.Now())
+		if d > test.expected || d < test.expected-time.Second {
+			t.Errorf("%d %v: expected a pause of %s, got %s", test.status, test.header, test.expected, d)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "3600")
+	}))
+	defer srv.Close()
+
+	// the response pauses the limiter, which then stops the next request
+	l := New(0, 1)
+	client := &http.Client{Transport: Transport(l, nil)}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	if _, err := client.Do(req); err == nil {
+		t.Error("expected the request to wait for the pause")
+	}
+	if requests != 1 {
+		t.Errorf("expected a single request, got %d", requests)
+	}
+}
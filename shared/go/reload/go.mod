@@ -0,0 +1,3 @@
+module github.com/falcosecurity/plugins/shared/go/reload
+
+go 1.15
@@ -0,0 +1,186 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package reload provides the hot-reload of the settings of a plugin that
+// can change at runtime, such as credentials or filters, so that they are
+// applied without restarting Falco and losing the position of the sources
+// in their upstream.
+//
+// A plugin declares its reloadable settings with the reload tag of the
+// fields of its config, e.g. `json:"jitter" reload:"true"`. They are read
+// from a json file, with the same property names as the init config. Watch
+// applies the content of the file when the plugin is initialized, and then
+// checks the file periodically to apply it again each time it changes. The
+// content is usually decoded with Decode on top of a copy of the init
+// config, so that removing a setting from the file restores its init value.
+// An invalid content is logged and ignored, leaving the previous settings
+// in effect.
+package reload
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Interval is the delay between two checks of the watched files
+const Interval = 5 * time.Second
+
+// Watcher is a running watch of a file
+type Watcher struct {
+	path  string
+	apply func(data []byte) error
+	logf  func(format string, v ...interface{})
+	sum   [sha256.Size]byte
+	err   string
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// Watch applies the content of the file at path, and then starts applying
+// it again each time it changes. The errors of the first application are
+// returned, while the following ones are logged with logf, along with the
+// successful reloads.
+func Watch(path string, apply func(data []byte) error, logf func(format string, v ...interface{})) (*Watcher, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = apply(data); err != nil {
+		return nil, fmt.Errorf("invalid reload file %s: %s", path, err.Error())
+	}
+
+	w := &Watcher{
+		path:  path,
+		apply: apply,
+		logf:  logf,
+		sum:   sha256.Sum256(data),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go w.watch()
+	return w, nil
+}
+
+// Close stops watching the file
+func (w *Watcher) Close() {
+	close(w.stop)
+	<-w.done
+}
+
+func (w *Watcher) watch() {
+	defer close(w.done)
+	ticker := time.NewTicker(Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// check applies the content of the file if it changed. The content is
+// compared rather than the modification time, since the files mounted from
+// a Kubernetes ConfigMap are replaced through a symlink.
+func (w *Watcher) check() {
+	data, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		w.fail(err)
+		return
+	}
+	sum := sha256.Sum256(data)
+	if sum == w.sum {
+		return
+	}
+	// an invalid content is only applied again once it changes
+	w.sum = sum
+	if err = w.apply(data); err != nil {
+		w.fail(err)
+		return
+	}
+	w.err = ""
+	w.logf("reloaded settings from %s", w.path)
+}
+
+// fail logs an error, unless it's the same as the previous one, to not
+// repeat it at each check while the file is not fixed
+func (w *Watcher) fail(err error) {
+	if msg := err.Error(); msg != w.err {
+		w.err = msg
+		w.logf("can't reload settings from %s, keeping the previous ones: %s", w.path, msg)
+	}
+}
+
+// Decode decodes the json object data into the struct pointed to by v,
+// which is usually a copy of the init config of the plugin, and returns an
+// error if it sets properties whose fields are not tagged as reloadable.
+// The fields set are replaced rather than merged, so that the maps of the
+// copy are not shared with the init config.
+func Decode(data []byte, v interface{}) error {
+	var props map[string]json.RawMessage
+	if err := json.Unmarshal(data, &props); err != nil {
+		return err
+	}
+	fields := reloadable(v)
+	var invalid []string
+	for name := range props {
+		if _, ok := fields[name]; !ok {
+			invalid = append(invalid, name)
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return fmt.Errorf("properties can't be reloaded: %s", strings.Join(invalid, ", "))
+	}
+
+	val := reflect.ValueOf(v).Elem()
+	for name, raw := range props {
+		f := val.Field(fields[name])
+		f.Set(reflect.Zero(f.Type()))
+		if err := json.Unmarshal(raw, f.Addr().Interface()); err != nil {
+			return fmt.Errorf("invalid property %s: %s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+// reloadable returns the index of the fields of the struct pointed to by v
+// that are tagged as reloadable, by json name
+func reloadable(v interface{}) map[string]int {
+	res := map[string]int{}
+	t := reflect.TypeOf(v).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("reload") != "true" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if len(name) == 0 {
+			name = f.Name
+		}
+		res[name] = i
+	}
+	return res
+}
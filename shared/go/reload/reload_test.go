@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reload
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testConfig struct {
+	Jitter  int               `json:"jitter" reload:"true"`
+	Filters map[string]string `json:"filters,omitempty" reload:"true"`
+	Name    string            `reload:"true"`
+	Addr    string            `json:"addr"`
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected testConfig
+		err      string
+	}{
+		{`{"jitter":2}`, testConfig{Jitter: 2, Filters: map[string]string{"a": "1"}, Name: "n", Addr: "init"}, ""},
+		// the maps are replaced rather than merged
+		{`{"filters":{"b":"2"}}`, testConfig{Jitter: 1, Filters: map[string]string{"b": "2"}, Name: "n", Addr: "init"}, ""},
+		{`{"Name":"other"}`, testConfig{Jitter: 1, Filters: map[string]string{"a": "1"}, Name: "other", Addr: "init"}, ""},
+		{`{"addr":"other","name":"other","jitter":2}`, testConfig{}, "properties can't be reloaded: addr, name"},
+		{`{"jitter":"2"}`, testConfig{}, "invalid property jitter: "},
+		{`[]`, testConfig{}, "cannot unmarshal"},
+	}
+	for _, test := range tests {
+		init := testConfig{Jitter: 1, Filters: map[string]string{"a": "1"}, Name: "n", Addr: "init"}
+		c := init
+		err := Decode([]byte(test.data), &c)
+		if len(test.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected the error %q, got %v", test.data, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.data, err.Error())
+			continue
+		}
+		if fmt.Sprint(c) != fmt.Sprint(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.data, test.expected, c)
+		}
+		// the init config is left as it is
+		if init.Filters["a"] != "1" || len(init.Filters) != 1 {
+			t.Errorf("%s: expected the init config to be unchanged, got %v", test.data, init)
+		}
+	}
+}
+
+// testWatch returns a watcher of a file with the given content, and the
+// contents it applied and the messages it logged
+func testWatch(t *testing.T, content string) (w *Watcher, path string, applied, logs *[]string) {
+	path = filepath.Join(t.TempDir(), "reload.json")
+	write(t, path, content)
+	applied, logs = &[]string{}, &[]string{}
+	w, err := Watch(path, func(data []byte) error {
+		if strings.Contains(string(data), "invalid") {
+			return errors.New(string(data))
+		}
+		*applied = append(*applied, string(data))
+		return nil
+	}, func(format string, v ...interface{}) {
+		*logs = append(*logs, fmt.Sprintf(format, v...))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(w.Close)
+	return w, path, applied, logs
+}
+
+func write(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	w, path, applied, logs := testWatch(t, "a")
+
+	// the checks are called directly rather than waiting for the ticker,
+	// and the content is only applied when it changes
+	w.check()
+	write(t, path, "b")
+	w.check()
+	w.check()
+	if strings.Join(*applied, ",") != "a,b" {
+		t.Errorf("expected the contents to be applied once, got %v", *applied)
+	}
+
+	// the errors are logged once until they change, and an invalid content
+	// is not applied again
+	write(t, path, "invalid 1")
+	w.check()
+	w.check()
+	write(t, path, "invalid 2")
+	w.check()
+	write(t, path, "c")
+	w.check()
+	expected := []string{
+		"reloaded settings from " + path,
+		"can't reload settings from " + path + ", keeping the previous ones: invalid 1",
+		"can't reload settings from " + path + ", keeping the previous ones: invalid 2",
+		"reloaded settings from " + path,
+	}
+	if strings.Join(*logs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected the logs %q, got %q", expected, *logs)
+	}
+	if strings.Join(*applied, ",") != "a,b,c" {
+		t.Errorf("expected the valid contents to be applied, got %v", *applied)
+	}
+
+	// the file can disappear, e.g. while its ConfigMap is updated
+	w.path = filepath.Join(filepath.Dir(path), "missing")
+	w.check()
+	w.check()
+	if len(*logs) != 5 || !strings.HasPrefix((*logs)[4], "can't reload settings from "+w.path) {
+		t.Errorf("expected the missing file to be logged once, got %q", *logs)
+	}
+}
+
+func TestWatchErrors(t *testing.T) {
+	dir := t.TempDir()
+	apply := func(data []byte) error { return errors.New("invalid") }
+	logf := func(format string, v ...interface{}) {}
+	if _, err := Watch(filepath.Join(dir, "missing"), apply, logf); err == nil {
+		t.Error("expected an error with a missing file")
+	}
+	path := filepath.Join(dir, "reload.json")
+	write(t, path, "{}")
+	if _, err := Watch(path, apply, logf); err == nil || err.Error() != "invalid reload file "+path+": invalid" {
+		t.Errorf("expected the error of the first application, got %v", err)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/falcosecurity/plugins/shared/go/replay
+
+go 1.15
@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package replay defines the format of the bundles of event payloads
+// recorded from the source plugins, so that they can be attached to bug
+// reports and replayed later on.
+//
+// A bundle is a gzipped JSON lines file. Its first line is the header
+// describing the recording, and each of the following lines is an event
+// with its original timestamp. The payloads that are valid JSON are stored
+// as is, so that bundles can be inspected and edited with the usual tools,
+// and the other ones are base64 encoded.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// Version is the version of the bundle format
+	Version = 1
+
+	// Ext is the extension of the bundle files
+	Ext = ".jsonl.gz"
+
+	// maxLineSize is the maximum size of a line of a bundle
+	maxLineSize = 64 * 1024 * 1024
+)
+
+// Header describes a recording
+type Header struct {
+	Version       int       `json:"version"`
+	Plugin        string    `json:"plugin"`
+	PluginVersion string    `json:"pluginVersion"`
+	PluginID      uint32    `json:"pluginId"`
+	EventSource   string    `json:"eventSource"`
+	RecordedAt    time.Time `json:"recordedAt"`
+	Scrubbed      []string  `json:"scrubbed,omitempty"`
+}
+
+// Event is a recorded event
+type Event struct {
+	Timestamp time.Time
+	Data      []byte
+}
+
+// event is the JSON representation of Event, where only one of JSON and
+// Data is set
+type event struct {
+	Timestamp time.Time       `json:"ts"`
+	JSON      json.RawMessage `json:"json,omitempty"`
+	Data      []byte          `json:"data,omitempty"`
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	res := event{Timestamp: e.Timestamp.UTC()}
+	if json.Valid(e.Data) {
+		res.JSON = e.Data
+	} else {
+		res.Data = e.Data
+	}
+	// the payloads are kept as close as possible to the original ones,
+	// so HTML characters are not escaped
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(res); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var evt event
+	if err := json.Unmarshal(b, &evt); err != nil {
+		return err
+	}
+	e.Timestamp = evt.Timestamp
+	e.Data = evt.Data
+	if len(evt.JSON) > 0 {
+		e.Data = evt.JSON
+	}
+	return nil
+}
+
+// Writer writes a bundle
+type Writer struct {
+	gz  *gzip.Writer
+	enc *json.Encoder
+}
+
+// NewWriter starts writing a bundle, beginning with its header. The version
+// of the header is set by the Writer.
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	gz := gzip.NewWriter(w)
+	res := &Writer{gz: gz, enc: json.NewEncoder(gz)}
+	res.enc.SetEscapeHTML(false)
+	h.Version = Version
+	if err := res.enc.Encode(h); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Write appends an event to the bundle
+func (w *Writer) Write(e Event) error {
+	return w.enc.Encode(e)
+}
+
+// Close flushes the bundle. It doesn't close the underlying io.Writer.
+func (w *Writer) Close() error {
+	return w.gz.Close()
+}
+
+// Reader reads a bundle
+type Reader struct {
+	gz      *gzip.Reader
+	scanner *bufio.Scanner
+	header  Header
+}
+
+// NewReader starts reading a bundle, and reads its header
+func NewReader(r io.Reader) (*Reader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	res := &Reader{gz: gz, scanner: bufio.NewScanner(gz)}
+	res.scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	if !res.scanner.Scan() {
+		if err := res.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("empty replay bundle")
+	}
+	if err := json.Unmarshal(res.scanner.Bytes(), &res.header); err != nil {
+		return nil, fmt.Errorf("invalid replay bundle header: %s", err.Error())
+	}
+	if res.header.Version != Version {
+		return nil, fmt.Errorf("unsupported replay bundle version: %d", res.header.Version)
+	}
+	return res, nil
+}
+
+// Header returns the header of the bundle
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Next returns the next event of the bundle, or io.EOF once all of them
+// have been read
+func (r *Reader) Next() (Event, error) {
+	var res Event
+	for r.scanner.Scan() {
+		if len(r.scanner.Bytes()) == 0 {
+			continue
+		}
+		err := json.Unmarshal(r.scanner.Bytes(), &res)
+		return res, err
+	}
+	if err := r.scanner.Err(); err != nil {
+		return res, err
+	}
+	return res, io.EOF
+}
+
+// Close stops reading the bundle. It doesn't close the underlying io.Reader.
+func (r *Reader) Close() error {
+	return r.gz.Close()
+}
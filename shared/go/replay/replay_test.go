@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gzipped returns the gzipped lines of a bundle
+func gzipped(lines ...string) []byte {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	gz.Write([]byte(strings.Join(lines, "\n")))
+	gz.Close()
+	return b.Bytes()
+}
+
+func TestWriteRead(t *testing.T) {
+	h := Header{
+		Plugin:        "test",
+		PluginVersion: "1.0.0",
+		PluginID:      999,
+		EventSource:   "test",
+		RecordedAt:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Scrubbed:      []string{"/user"},
+	}
+	loc := time.FixedZone("test", 3600)
+	events := []Event{
+		{Timestamp: time.Date(2024, 1, 1, 1, 0, 0, 1, loc), Data: []byte(`{"a":"<b>"}`)},
+		{Timestamp: time.Date(2024, 1, 1, 0, 0, 1, 0, time.UTC), Data: []byte("\x00\xffnot json")},
+		{Timestamp: time.Date(2024, 1, 1, 0, 0, 2, 0, time.UTC), Data: []byte(`[1, 2]`)},
+	}
+
+	var b bytes.Buffer
+	w, err := NewWriter(&b, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range events {
+		if err := w.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the JSON payloads are stored as is, the others in base64
+	gz, err := gzip.NewReader(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := ioutil.ReadAll(gz)
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	expected := []string{
+		`{"ts":"2024-01-01T00:00:00.000000001Z","json":{"a":"<b>"}}`,
+		`{"ts":"2024-01-01T00:00:01Z","data":"AP9ub3QganNvbg=="}`,
+		`{"ts":"2024-01-01T00:00:02Z","json":[1,2]}`,
+	}
+	if len(lines) != 4 || !reflect.DeepEqual(lines[1:], expected) {
+		t.Errorf("expected the lines %v, got %v", expected, lines[1:])
+	}
+
+	r, err := NewReader(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	h.Version = Version
+	if !reflect.DeepEqual(r.Header(), h) {
+		t.Errorf("expected the header %+v, got %+v", h, r.Header())
+	}
+	for i, expected := range events {
+		e, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !e.Timestamp.Equal(expected.Timestamp) {
+			t.Errorf("%d: expected the timestamp %s, got %s", i, expected.Timestamp, e.Timestamp)
+		}
+		// the JSON payloads are compacted by the encoder
+		data := string(expected.Data)
+		if i == 2 {
+			data = `[1,2]`
+		}
+		if string(e.Data) != data {
+			t.Errorf("%d: expected the data %q, got %q", i, data, e.Data)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	header := `{"version":1,"plugin":"test"}`
+	tests := []struct {
+		name   string
+		bundle []byte
+	}{
+		{"not gzipped", []byte(header)},
+		{"empty", gzipped("")},
+		{"invalid header", gzipped("{")},
+		{"unsupported version", gzipped(`{"version":2}`)},
+	}
+	for _, test := range tests {
+		if _, err := NewReader(bytes.NewReader(test.bundle)); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+
+	// the empty lines are skipped, the invalid events are reported
+	r, err := NewReader(bytes.NewReader(gzipped(header, "", `{"ts":"2024-01-01T00:00:00Z","json":1}`, "{")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, err := r.Next(); err != nil || string(e.Data) != "1" {
+		t.Errorf("expected the event, got %q (%v)", e.Data, err)
+	}
+	if _, err := r.Next(); err == nil || err == io.EOF {
+		t.Errorf("expected an error reading an invalid event, got %v", err)
+	}
+
+	// the truncated bundles are reported
+	b := gzipped(header, `{"ts":"2024-01-01T00:00:00Z","json":1}`)
+	if r, err = NewReader(bytes.NewReader(b[:len(b)-4])); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); err == nil || err == io.EOF {
+		t.Errorf("expected an error reading a truncated bundle, got %v", err)
+	}
+}
+
+func TestScrub(t *testing.T) {
+	s, err := NewScrubber([]string{"/user", "/target/*/id", "/a~1b", "/obj", "/missing/x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := `{"user":"alice","target":[{"id":"x","type":"t"},{"id":"alice"}],"a/b":1,"obj":{"k":["v",null,true]},"keep":"<v>"}`
+	res := string(s.Scrub([]byte(payload)))
+	alice := s.hash("alice")
+	if !strings.HasPrefix(alice, scrubPrefix) || len(alice) != len(scrubPrefix)+16 {
+		t.Fatalf("unexpected hash %s", alice)
+	}
+	expected := `{"a/b":"` + s.hash(1) + `","keep":"<v>","obj":{"k":["` + s.hash("v") + `",null,"` + s.hash(true) + `"]},` +
+		`"target":[{"id":"` + s.hash("x") + `","type":"t"},{"id":"` + alice + `"}],"user":"` + alice + `"}`
+	if res != expected {
+		t.Errorf("expected %s, got %s", expected, res)
+	}
+
+	// the payloads without the fields, or not JSON, are left unchanged,
+	// even if not compact
+	for _, payload := range []string{`{"other": 1}`, `not json`, `"user"`, `{"user":null}`, `[{"user":"a"}]`} {
+		if res := s.Scrub([]byte(payload)); string(res) != payload {
+			t.Errorf("expected %s to be unchanged, got %s", payload, res)
+		}
+	}
+
+	// the salt is random, so that two scrubbers hash differently
+	other, err := NewScrubber([]string{"/user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.hash("alice") == alice {
+		t.Error("expected the hashes of distinct scrubbers to differ")
+	}
+
+	// the array indices and the scrubbers without paths
+	s, err = NewScrubber([]string{"/1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := string(s.Scrub([]byte(`["a","b"]`))); res != `["a","`+s.hash("b")+`"]` {
+		t.Errorf("expected the second element to be scrubbed, got %s", res)
+	}
+	s, err = NewScrubber(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := string(s.Scrub([]byte(`{"a": 1}`))); res != `{"a": 1}` {
+		t.Errorf("expected the payload to be unchanged, got %s", res)
+	}
+
+	if _, err := NewScrubber([]string{"user"}); err == nil {
+		t.Error("expected an error with a relative pointer")
+	}
+}
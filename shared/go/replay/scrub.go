@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replay
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// scrubPrefix is the prefix of the values replaced by a Scrubber
+const scrubPrefix = "scrubbed-"
+
+// Scrubber replaces the values of sensitive fields of JSON payloads, such
+// as IP addresses or user names, before they are written in a bundle.
+//
+// The fields are selected with JSON pointers (RFC 6901), in which the *
+// token matches every key of an object or every element of an array, e.g.
+// /userIdentity/arn or /target/*/alternateId. The selected objects and
+// arrays are scrubbed value by value, so that the payloads keep their shape.
+// Each value is replaced with a salted hash of itself, so that the events
+// sharing a value still do after being scrubbed, while the salt is random
+// and never written so that the original values can't be guessed back.
+type Scrubber struct {
+	paths [][]string
+	salt  []byte
+}
+
+// NewScrubber returns a Scrubber replacing the values of the given JSON
+// pointers
+func NewScrubber(pointers []string) (*Scrubber, error) {
+	res := &Scrubber{salt: make([]byte, 32)}
+	if _, err := rand.Read(res.salt); err != nil {
+		return nil, err
+	}
+	for _, p := range pointers {
+		path, err := parsePointer(p)
+		if err != nil {
+			return nil, err
+		}
+		res.paths = append(res.paths, path)
+	}
+	return res, nil
+}
+
+func parsePointer(p string) ([]string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q: must start with /", p)
+	}
+	res := strings.Split(p[1:], "/")
+	for i, t := range res {
+		res[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return res, nil
+}
+
+// Scrub returns a payload with the values of the fields replaced. Payloads
+// that are not JSON objects or arrays, or that have none of the fields, are
+// returned unchanged.
+func (s *Scrubber) Scrub(data []byte) []byte {
+	if len(s.paths) == 0 {
+		return data
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return data
+	}
+	changed := false
+	for _, path := range s.paths {
+		var c bool
+		v, c = s.scrub(v, path)
+		changed = changed || c
+	}
+	if !changed {
+		return data
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return data
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// scrub replaces the values matching a path in v, and returns v along with
+// whether any value was replaced
+func (s *Scrubber) scrub(v interface{}, path []string) (interface{}, bool) {
+	if len(path) == 0 {
+		return s.scrubAll(v)
+	}
+	changed := false
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if path[0] == "*" || path[0] == k {
+				var c bool
+				val[k], c = s.scrub(child, path[1:])
+				changed = changed || c
+			}
+		}
+	case []interface{}:
+		for i, child := range val {
+			if path[0] == "*" || path[0] == strconv.Itoa(i) {
+				var c bool
+				val[i], c = s.scrub(child, path[1:])
+				changed = changed || c
+			}
+		}
+	}
+	return v, changed
+}
+
+// scrubAll replaces every value in v, keeping the structure of the objects
+// and arrays so that the payloads keep the same shape, and returns v along
+// with whether any value was replaced
+func (s *Scrubber) scrubAll(v interface{}) (interface{}, bool) {
+	changed := false
+	switch val := v.(type) {
+	case nil:
+		return v, false
+	case map[string]interface{}:
+		for k, child := range val {
+			var c bool
+			val[k], c = s.scrubAll(child)
+			changed = changed || c
+		}
+	case []interface{}:
+		for i, child := range val {
+			var c bool
+			val[i], c = s.scrubAll(child)
+			changed = changed || c
+		}
+	default:
+		return s.hash(v), true
+	}
+	return v, changed
+}
+
+// hash returns the salted hash of a value
+func (s *Scrubber) hash(v interface{}) string {
+	b, _ := json.Marshal(v)
+	h := sha256.New()
+	h.Write(s.salt)
+	h.Write(b)
+	return scrubPrefix + hex.EncodeToString(h.Sum(nil))[:16]
+}
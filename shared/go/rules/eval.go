@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Extractor returns the values of a field for the evaluated event, and
+// false if the field cannot be extracted from it
+type Extractor func(field string) ([]string, bool)
+
+// Eval evaluates a condition, extracting the values of its fields with the
+// given extractor. Like in Falco, a check on a field that cannot be
+// extracted is false, unless negated.
+func Eval(n Node, extract Extractor) bool {
+	switch n := n.(type) {
+	case *And:
+		for _, c := range n.Children {
+			if !Eval(c, extract) {
+				return false
+			}
+		}
+		return true
+	case *Or:
+		for _, c := range n.Children {
+			if Eval(c, extract) {
+				return true
+			}
+		}
+		return false
+	case *Not:
+		return !Eval(n.Child, extract)
+	case *Check:
+		values, ok := extract(n.Field)
+		return ok && n.Match(values)
+	}
+	return false
+}
+
+// Match returns true if the values of a field satisfy the check. The
+// operators comparing a single value use the first one of the list fields.
+func (c *Check) Match(values []string) bool {
+	if len(values) == 0 {
+		return false
+	}
+	switch c.Op {
+	case "exists":
+		return true
+	case "in":
+		for _, v := range values {
+			if !contains(c.Values, v) {
+				return false
+			}
+		}
+		return true
+	case "intersects":
+		for _, v := range values {
+			if contains(c.Values, v) {
+				return true
+			}
+		}
+		return false
+	case "pmatch":
+		for _, v := range values {
+			for _, prefix := range c.Values {
+				if v == prefix || strings.HasPrefix(v, strings.TrimSuffix(prefix, "/")+"/") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	v, arg := values[0], c.Values[0]
+	switch c.Op {
+	case "=", "==":
+		return equal(v, arg)
+	case "!=":
+		return !equal(v, arg)
+	case "<", "<=", ">", ">=":
+		a, err1 := strconv.ParseFloat(v, 64)
+		b, err2 := strconv.ParseFloat(arg, 64)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		switch c.Op {
+		case "<":
+			return a < b
+		case "<=":
+			return a <= b
+		case ">":
+			return a > b
+		default:
+			return a >= b
+		}
+	case "contains", "bcontains":
+		return strings.Contains(v, arg)
+	case "icontains":
+		return strings.Contains(strings.ToLower(v), strings.ToLower(arg))
+	case "startswith", "bstartswith":
+		return strings.HasPrefix(v, arg)
+	case "endswith":
+		return strings.HasSuffix(v, arg)
+	case "glob":
+		ok, _ := path.Match(arg, v)
+		return ok
+	case "iglob":
+		ok, _ := path.Match(strings.ToLower(arg), strings.ToLower(v))
+		return ok
+	case "regex":
+		ok, _ := regexp.MatchString(arg, v)
+		return ok
+	}
+	return false
+}
+
+// equal compares two values as numbers if they are both numbers, and as
+// strings otherwise
+func equal(a, b string) bool {
+	x, err1 := strconv.ParseFloat(a, 64)
+	y, err2 := strconv.ParseFloat(b, 64)
+	if err1 == nil && err2 == nil {
+		return x == y
+	}
+	return a == b
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if equal(s, v) {
+			return true
+		}
+	}
+	return false
+}
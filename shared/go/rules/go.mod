@@ -0,0 +1,5 @@
+module github.com/falcosecurity/plugins/shared/go/rules
+
+go 1.15
+
+require gopkg.in/yaml.v2 v2.4.0
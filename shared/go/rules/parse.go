@@ -0,0 +1,341 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Node is a node of the syntax tree of a condition
+type Node interface {
+	fields(res []string) []string
+}
+
+// And is true if all its children are true
+type And struct {
+	Children []Node
+}
+
+// Or is true if any of its children is true
+type Or struct {
+	Children []Node
+}
+
+// Not is true if its child is false
+type Not struct {
+	Child Node
+}
+
+// Check compares the values of a field with the given values. The unary
+// operators, e.g. exists, have no values.
+type Check struct {
+	Field  string
+	Op     string
+	Values []string
+}
+
+func (n *And) fields(res []string) []string {
+	for _, c := range n.Children {
+		res = c.fields(res)
+	}
+	return res
+}
+
+func (n *Or) fields(res []string) []string {
+	for _, c := range n.Children {
+		res = c.fields(res)
+	}
+	return res
+}
+
+func (n *Not) fields(res []string) []string {
+	return n.Child.fields(res)
+}
+
+func (n *Check) fields(res []string) []string {
+	return append(res, n.Field)
+}
+
+// Fields returns the fields referenced by a condition, in order. A field
+// referenced more than once is repeated, since each reference is extracted
+// separately by Falco.
+func Fields(n Node) []string {
+	return n.fields(nil)
+}
+
+var (
+	unaryOps = map[string]bool{
+		"exists": true,
+	}
+	binaryOps = map[string]bool{
+		"=": true, "==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+		"contains": true, "icontains": true, "bcontains": true,
+		"startswith": true, "bstartswith": true, "endswith": true,
+		"glob": true, "iglob": true, "regex": true,
+	}
+	listOps = map[string]bool{
+		"in": true, "intersects": true, "pmatch": true,
+	}
+)
+
+// token is a token of a condition. Quoted strings are never keywords,
+// operators or macro names.
+type token struct {
+	text   string
+	quoted bool
+}
+
+func tokenize(cond string) ([]token, error) {
+	var res []token
+	for i := 0; i < len(cond); {
+		c := cond[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == ',':
+			res = append(res, token{text: string(c)})
+			i++
+		case c == '=' || c == '!' || c == '<' || c == '>':
+			j := i + 1
+			if j < len(cond) && cond[j] == '=' {
+				j++
+			}
+			res = append(res, token{text: cond[i:j]})
+			i = j
+		case c == '"' || c == '\'':
+			j := strings.IndexByte(cond[i+1:], c)
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			res = append(res, token{text: cond[i+1 : i+1+j], quoted: true})
+			i += j + 2
+		default:
+			j := i
+			for j < len(cond) && !strings.ContainsRune(" \t\n\r(),=!<>\"'", rune(cond[j])) {
+				// the arguments of the fields can hold any character
+				if cond[j] == '[' {
+					if k := strings.IndexByte(cond[j:], ']'); k > 0 {
+						j += k
+					}
+				}
+				j++
+			}
+			res = append(res, token{text: cond[i:j]})
+			i = j
+		}
+	}
+	return res, nil
+}
+
+// parser is a recursive descent parser of conditions, which expands the
+// macros and the lists of its ruleset
+type parser struct {
+	ruleset   *Ruleset
+	tokens    []token
+	pos       int
+	expanding map[string]bool
+}
+
+// Parse parses a condition, expanding its macros and lists
+func (r *Ruleset) Parse(cond string) (Node, error) {
+	return r.parse(cond, map[string]bool{})
+}
+
+func (r *Ruleset) parse(cond string, expanding map[string]bool) (Node, error) {
+	tokens, err := tokenize(cond)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{ruleset: r, tokens: tokens, expanding: expanding}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) next() (token, error) {
+	t, ok := p.peek()
+	if !ok {
+		return t, fmt.Errorf("unexpected end of condition")
+	}
+	p.pos++
+	return t, nil
+}
+
+func (p *parser) accept(keyword string) bool {
+	if t, ok := p.peek(); ok && !t.quoted && t.text == keyword {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (Node, error) {
+	n, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	res := &Or{Children: []Node{n}}
+	for p.accept("or") {
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		res.Children = append(res.Children, n)
+	}
+	if len(res.Children) == 1 {
+		return res.Children[0], nil
+	}
+	return res, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	n, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	res := &And{Children: []Node{n}}
+	for p.accept("and") {
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		res.Children = append(res.Children, n)
+	}
+	if len(res.Children) == 1 {
+		return res.Children[0], nil
+	}
+	return res, nil
+}
+
+func (p *parser) parseNot() (Node, error) {
+	if p.accept("not") {
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Child: n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	if p.accept("(") {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return n, nil
+	}
+
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.quoted {
+		return nil, fmt.Errorf("unexpected string %q", t.text)
+	}
+	if cond, ok := p.ruleset.macros[t.text]; ok {
+		if p.expanding[t.text] {
+			return nil, fmt.Errorf("macro %s references itself", t.text)
+		}
+		p.expanding[t.text] = true
+		defer delete(p.expanding, t.text)
+		n, err := p.ruleset.parse(cond, p.expanding)
+		if err != nil {
+			return nil, fmt.Errorf("macro %s: %s", t.text, err.Error())
+		}
+		return n, nil
+	}
+
+	check := &Check{Field: t.text}
+	op, err := p.next()
+	if err != nil || op.quoted {
+		return nil, fmt.Errorf("missing operator after %s", t.text)
+	}
+	check.Op = op.text
+	switch {
+	case unaryOps[op.text]:
+	case binaryOps[op.text]:
+		v, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		check.Values = []string{v.text}
+	case listOps[op.text]:
+		if check.Values, err = p.parseList(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported operator %q after %s", op.text, t.text)
+	}
+	return check, nil
+}
+
+// parseList parses a list of values, expanding the lists it references
+func (p *parser) parseList() ([]string, error) {
+	if !p.accept("(") {
+		return nil, fmt.Errorf("missing list of values")
+	}
+	var res []string
+	for !p.accept(")") {
+		t, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if !t.quoted && t.text == "," {
+			continue
+		}
+		if values, ok := p.ruleset.lists[t.text]; ok && !t.quoted {
+			res = append(res, p.ruleset.expandList(values, map[string]bool{t.text: true})...)
+			continue
+		}
+		res = append(res, t.text)
+	}
+	return res, nil
+}
+
+// expandList expands the lists referenced by the values of a list
+func (r *Ruleset) expandList(values []string, expanding map[string]bool) []string {
+	var res []string
+	for _, v := range values {
+		if nested, ok := r.lists[v]; ok && !expanding[v] {
+			expanding[v] = true
+			res = append(res, r.expandList(nested, expanding)...)
+			delete(expanding, v)
+			continue
+		}
+		res = append(res, v)
+	}
+	return res
+}
@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rules loads Falco rules files, and parses and evaluates the
+// conditions of their rules. It supports the subset of the rules language
+// used by the rules of the plugins: the conditions made of checks on plugin
+// fields, combined with and, or, not, macros and lists. It is used by the
+// tools exercising the plugins with the fields referenced by the rules.
+package rules
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// item is an item of a rules file
+type item struct {
+	Rule      string        `yaml:"rule"`
+	Macro     string        `yaml:"macro"`
+	List      string        `yaml:"list"`
+	Condition string        `yaml:"condition"`
+	Output    string        `yaml:"output"`
+	Source    string        `yaml:"source"`
+	Items     []interface{} `yaml:"items"`
+	Enabled   *bool         `yaml:"enabled"`
+	Append    bool          `yaml:"append"`
+}
+
+// Rule is a rule of a rules file
+type Rule struct {
+	Name      string
+	Condition string
+	Output    string
+	Source    string
+	Enabled   bool
+}
+
+// Ruleset holds the rules, macros and lists of a set of rules files
+type Ruleset struct {
+	Rules  []*Rule
+	macros map[string]string
+	lists  map[string][]string
+}
+
+// Load reads the given rules files, in order. The items with append set
+// are appended to the ones defined before them. The rules with no source
+// are the ones of the syscall source, like in Falco.
+func Load(paths ...string) (*Ruleset, error) {
+	r := &Ruleset{
+		macros: map[string]string{},
+		lists:  map[string][]string{},
+	}
+	rules := map[string]*Rule{}
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var items []item
+		if err := yaml.Unmarshal(b, &items); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err.Error())
+		}
+		for _, it := range items {
+			switch {
+			case len(it.List) > 0:
+				var values []string
+				for _, v := range it.Items {
+					values = append(values, fmt.Sprint(v))
+				}
+				if it.Append {
+					values = append(r.lists[it.List], values...)
+				}
+				r.lists[it.List] = values
+			case len(it.Macro) > 0:
+				if it.Append {
+					it.Condition = r.macros[it.Macro] + " " + it.Condition
+				}
+				r.macros[it.Macro] = it.Condition
+			case len(it.Rule) > 0:
+				rule, ok := rules[it.Rule]
+				if !ok {
+					if it.Append {
+						return nil, fmt.Errorf("%s: rule %s appended before being defined", path, it.Rule)
+					}
+					rule = &Rule{Name: it.Rule, Source: "syscall", Enabled: true}
+					rules[it.Rule] = rule
+					r.Rules = append(r.Rules, rule)
+				}
+				if it.Append {
+					rule.Condition += " " + it.Condition
+					continue
+				}
+				if it.Enabled != nil {
+					rule.Enabled = *it.Enabled
+				}
+				// the items with no condition only enable or disable a
+				// rule defined before them
+				if ok && len(it.Condition) == 0 {
+					continue
+				}
+				rule.Condition = it.Condition
+				rule.Output = it.Output
+				if len(it.Source) > 0 {
+					rule.Source = it.Source
+				}
+			}
+		}
+	}
+	return r, nil
+}
+
+// BySource returns the enabled rules of the given event source
+func (r *Ruleset) BySource(source string) []*Rule {
+	var res []*Rule
+	for _, rule := range r.Rules {
+		if rule.Enabled && rule.Source == source {
+			res = append(res, rule)
+		}
+	}
+	return res
+}
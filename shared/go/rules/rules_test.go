@@ -0,0 +1,325 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRules = `
+- list: users
+  items: [root, admin]
+- list: privileged
+  items: [users, 0]
+- macro: is_privileged
+  condition: test.user in (privileged)
+- macro: is_write
+  condition: test.op = write
+- rule: Privileged write
+  condition: is_write and is_privileged
+  output: write by %test.user
+  source: test
+- rule: Syscall rule
+  condition: evt.type = open
+  output: open
+- rule: Disabled rule
+  condition: test.op exists
+  output: disabled
+  source: test
+  enabled: false
+`
+
+const testOverrides = `
+- list: users
+  items: [operator]
+  append: true
+- macro: is_write
+  condition: or test.op = delete
+  append: true
+- rule: Privileged write
+  condition: and not test.path startswith /tmp
+  append: true
+- rule: Disabled rule
+  enabled: true
+`
+
+// writeRules writes the given rules files in a temporary directory and
+// returns their paths
+func writeRules(t *testing.T, contents ...string) []string {
+	dir := t.TempDir()
+	var res []string
+	for i, c := range contents {
+		path := filepath.Join(dir, string(rune('a'+i))+".yaml")
+		if err := ioutil.WriteFile(path, []byte(c), 0644); err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, path)
+	}
+	return res
+}
+
+// testExtractor returns an extractor of the given field values
+func testExtractor(values map[string][]string) Extractor {
+	return func(field string) ([]string, bool) {
+		v, ok := values[field]
+		return v, ok
+	}
+}
+
+func TestLoad(t *testing.T) {
+	r, err := Load(writeRules(t, testRules, testOverrides)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Rules) != 3 {
+		t.Fatalf("expected 3 rules, got %d", len(r.Rules))
+	}
+
+	rule := r.Rules[0]
+	if rule.Name != "Privileged write" || rule.Source != "test" || !rule.Enabled || rule.Output != "write by %test.user" {
+		t.Errorf("unexpected rule %+v", rule)
+	}
+	if rule.Condition != "is_write and is_privileged and not test.path startswith /tmp" {
+		t.Errorf("expected the appended condition, got %s", rule.Condition)
+	}
+	// the rules without source are the ones of the syscall source
+	if r.Rules[1].Source != "syscall" {
+		t.Errorf("expected the syscall source, got %s", r.Rules[1].Source)
+	}
+	// the items without condition only enable the rules
+	if !r.Rules[2].Enabled || r.Rules[2].Condition != "test.op exists" {
+		t.Errorf("expected the rule to be enabled with its condition, got %+v", r.Rules[2])
+	}
+	if !reflect.DeepEqual(r.lists["users"], []string{"root", "admin", "operator"}) {
+		t.Errorf("expected the appended list, got %v", r.lists["users"])
+	}
+	if r.macros["is_write"] != "test.op = write or test.op = delete" {
+		t.Errorf("expected the appended macro, got %s", r.macros["is_write"])
+	}
+
+	var names []string
+	for _, rule := range r.BySource("test") {
+		names = append(names, rule.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Privileged write", "Disabled rule"}) {
+		t.Errorf("unexpected rules of the test source %v", names)
+	}
+	r.Rules[2].Enabled = false
+	if n := len(r.BySource("test")); n != 1 {
+		t.Errorf("expected the disabled rules to be skipped, got %d rules", n)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for name, contents := range map[string]string{
+		"invalid yaml":    "- rule: [",
+		"appended rule":   "- rule: r\n  condition: a exists\n  append: true",
+		"not a rule list": "rule: r",
+	} {
+		if _, err := Load(writeRules(t, contents)...); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected an error loading a missing file")
+	}
+}
+
+func TestParse(t *testing.T) {
+	r, err := Load(writeRules(t, testRules, testOverrides)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		cond     string
+		expected Node
+	}{
+		{"a.b exists", &Check{Field: "a.b", Op: "exists"}},
+		{"a.b[x y] = 'v w'", &Check{Field: "a.b[x y]", Op: "=", Values: []string{"v w"}}},
+		{"a!=1", &Check{Field: "a", Op: "!=", Values: []string{"1"}}},
+		{"a in (1, \"2\", users)", &Check{Field: "a", Op: "in", Values: []string{"1", "2", "root", "admin", "operator"}}},
+		// the lists are expanded recursively, the quoted values are not
+		{"a pmatch (privileged, 'users')", &Check{Field: "a", Op: "pmatch", Values: []string{"root", "admin", "operator", "0", "users"}}},
+		{"not a exists", &Not{Child: &Check{Field: "a", Op: "exists"}}},
+		{"a exists and b exists or c exists", &Or{Children: []Node{
+			&And{Children: []Node{&Check{Field: "a", Op: "exists"}, &Check{Field: "b", Op: "exists"}}},
+			&Check{Field: "c", Op: "exists"},
+		}}},
+		{"a exists and (b exists or c exists)", &And{Children: []Node{
+			&Check{Field: "a", Op: "exists"},
+			&Or{Children: []Node{&Check{Field: "b", Op: "exists"}, &Check{Field: "c", Op: "exists"}}},
+		}}},
+		{"is_write", &Or{Children: []Node{
+			&Check{Field: "test.op", Op: "=", Values: []string{"write"}},
+			&Check{Field: "test.op", Op: "=", Values: []string{"delete"}},
+		}}},
+	}
+	for _, test := range tests {
+		n, err := r.Parse(test.cond)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.cond, err)
+			continue
+		}
+		if !reflect.DeepEqual(n, test.expected) {
+			t.Errorf("%s: expected %#v, got %#v", test.cond, test.expected, n)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	r, err := Load(writeRules(t, `
+- macro: loop
+  condition: a exists and loop
+- macro: broken
+  condition: a =
+`)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"a = 'b":          "unterminated string",
+		"a exists)":       "unexpected \")\"",
+		"(a exists":       "missing closing parenthesis",
+		"a":               "missing operator after a",
+		"a 'exists'":      "missing operator after a",
+		"a like b":        "unsupported operator",
+		"a =":             "unexpected end of condition",
+		"a in b":          "missing list of values",
+		"a in (b":         "unexpected end of condition",
+		"'a' exists":      "unexpected string",
+		"loop":            "macro loop references itself",
+		"broken or a = b": "macro broken: unexpected end",
+		"":                "unexpected end of condition",
+	}
+	for cond, expected := range tests {
+		_, err := r.Parse(cond)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", cond, expected, err)
+		}
+	}
+
+	// a macro can be used more than once in a condition
+	r.macros["twice"] = "a exists"
+	if _, err := r.Parse("twice and (twice or b exists)"); err != nil {
+		t.Errorf("expected the macro to be expanded twice, got %s", err)
+	}
+}
+
+func TestFields(t *testing.T) {
+	r, err := Load(writeRules(t, testRules)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := r.Parse(r.Rules[0].Condition + " and test.op != read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the fields referenced more than once are repeated
+	expected := []string{"test.op", "test.user", "test.op"}
+	if f := Fields(n); !reflect.DeepEqual(f, expected) {
+		t.Errorf("expected the fields %v, got %v", expected, f)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		op       string
+		args     []string
+		values   []string
+		expected bool
+	}{
+		{"exists", nil, []string{""}, true},
+		{"exists", nil, nil, false},
+		{"=", []string{"a"}, []string{"a"}, true},
+		{"==", []string{"a"}, []string{"b"}, false},
+		// the numbers are compared as numbers
+		{"=", []string{"1"}, []string{"1.0"}, true},
+		{"!=", []string{"1"}, []string{"01"}, false},
+		{"!=", []string{"a"}, []string{"b"}, true},
+		// the single value operators use the first value of the lists
+		{"=", []string{"a"}, []string{"a", "b"}, true},
+		{"=", []string{"b"}, []string{"a", "b"}, false},
+		{"<", []string{"10"}, []string{"9"}, true},
+		{"<=", []string{"10"}, []string{"10"}, true},
+		{">", []string{"10"}, []string{"9"}, false},
+		{">=", []string{"10"}, []string{"11"}, true},
+		{"<", []string{"10"}, []string{"a"}, false},
+		{"contains", []string{"bc"}, []string{"abcd"}, true},
+		{"bcontains", []string{"x"}, []string{"abcd"}, false},
+		{"icontains", []string{"BC"}, []string{"aBcd"}, true},
+		{"startswith", []string{"ab"}, []string{"abcd"}, true},
+		{"bstartswith", []string{"bc"}, []string{"abcd"}, false},
+		{"endswith", []string{"cd"}, []string{"abcd"}, true},
+		{"glob", []string{"a*d"}, []string{"abcd"}, true},
+		{"glob", []string{"A*d"}, []string{"abcd"}, false},
+		{"iglob", []string{"A*D"}, []string{"abcd"}, true},
+		{"regex", []string{"^a.c"}, []string{"abcd"}, true},
+		{"regex", []string{"^b"}, []string{"abcd"}, false},
+		{"regex", []string{"("}, []string{"abcd"}, false},
+		{"in", []string{"a", "b"}, []string{"a", "b"}, true},
+		{"in", []string{"a", "b"}, []string{"a", "c"}, false},
+		{"in", []string{"1"}, []string{"1.0"}, true},
+		{"intersects", []string{"a", "b"}, []string{"c", "b"}, true},
+		{"intersects", []string{"a", "b"}, []string{"c"}, false},
+		{"pmatch", []string{"/etc"}, []string{"/etc/passwd"}, true},
+		{"pmatch", []string{"/etc/"}, []string{"/etc"}, false},
+		{"pmatch", []string{"/etc"}, []string{"/etc"}, true},
+		{"pmatch", []string{"/etc"}, []string{"/etcd/a"}, false},
+		{"unknown", []string{"a"}, []string{"a"}, false},
+	}
+	for _, test := range tests {
+		c := &Check{Field: "f", Op: test.op, Values: test.args}
+		if res := c.Match(test.values); res != test.expected {
+			t.Errorf("%s %v on %v: expected %v, got %v", test.op, test.args, test.values, test.expected, res)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	r, err := Load(writeRules(t, testRules, testOverrides)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := r.Parse(r.Rules[0].Condition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		values   map[string][]string
+		expected bool
+	}{
+		{"match", map[string][]string{"test.op": {"write"}, "test.user": {"root"}, "test.path": {"/etc"}}, true},
+		{"appended macro", map[string][]string{"test.op": {"delete"}, "test.user": {"operator"}, "test.path": {"/etc"}}, true},
+		{"other user", map[string][]string{"test.op": {"write"}, "test.user": {"bob"}, "test.path": {"/etc"}}, false},
+		{"other op", map[string][]string{"test.op": {"read"}, "test.user": {"root"}, "test.path": {"/etc"}}, false},
+		{"excluded path", map[string][]string{"test.op": {"write"}, "test.user": {"root"}, "test.path": {"/tmp/a"}}, false},
+		// a negated check on a field that cannot be extracted is true
+		{"missing path", map[string][]string{"test.op": {"write"}, "test.user": {"0"}}, true},
+		{"missing user", map[string][]string{"test.op": {"write"}, "test.path": {"/etc"}}, false},
+	}
+	for _, test := range tests {
+		if res := Eval(n, testExtractor(test.values)); res != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, res)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schemaregistry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// maxReferenceDepth bounds the chains of references, which are cyclic in an
+// invalid registry
+const maxReferenceDepth = 32
+
+// avroDecoder returns the decoder of an Avro schema, rendering the unions as
+// their plain value rather than as an object keyed by their type. The codecs
+// only know the named types they define, so the ones of the references are
+// inlined where they are first used.
+func (c *Client) avroDecoder(ctx context.Context, s *Schema) (func([]byte) ([]byte, error), error) {
+	text := s.Schema
+	if len(s.References) > 0 {
+		var schema interface{}
+		if err := json.Unmarshal([]byte(text), &schema); err != nil {
+			return nil, err
+		}
+		named := make(map[string]interface{})
+		if err := c.avroReferences(ctx, s.References, named, 0); err != nil {
+			return nil, err
+		}
+		schema = inlineAvro(schema, "", named, make(map[string]bool))
+		b, err := json.Marshal(schema)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+
+	codec, err := goavro.NewCodecForStandardJSONFull(text)
+	if err != nil {
+		return nil, err
+	}
+	return func(payload []byte) ([]byte, error) {
+		native, rest, err := codec.NativeFromBinary(payload)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) > 0 {
+			return nil, fmt.Errorf("%d trailing bytes", len(rest))
+		}
+		return codec.TextualFromNative(nil, native)
+	}, nil
+}
+
+// avroReferences fetches the schemas of the references, and of their own
+// references, in named by the full name of their type
+func (c *Client) avroReferences(ctx context.Context, refs []Reference, named map[string]interface{}, depth int) error {
+	if depth >= maxReferenceDepth {
+		return fmt.Errorf("references nested more than %d times", maxReferenceDepth)
+	}
+	for _, ref := range refs {
+		if _, ok := named[ref.Name]; ok {
+			continue
+		}
+		res, err := c.reference(ctx, ref)
+		if err != nil {
+			return err
+		}
+		var schema interface{}
+		if err := json.Unmarshal([]byte(res.Schema), &schema); err != nil {
+			return fmt.Errorf("invalid reference %s: %w", ref.Name, err)
+		}
+		named[ref.Name] = schema
+		if err := c.avroReferences(ctx, res.References, named, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inlineAvro replaces the first use of each named type of the references
+// with its definition. The schema is walked in the order the codecs parse
+// it, with ns the enclosing namespace, and defined the full names of the
+// types defined so far.
+func inlineAvro(schema interface{}, ns string, named map[string]interface{}, defined map[string]bool) interface{} {
+	switch v := schema.(type) {
+	case string:
+		full := v
+		if !strings.Contains(v, ".") && ns != "" {
+			full = ns + "." + v
+		}
+		for _, name := range []string{full, v} {
+			if def, ok := named[name]; ok && !defined[name] {
+				defined[name] = true
+				return inlineAvro(def, "", named, defined)
+			}
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = inlineAvro(v[i], ns, named, defined)
+		}
+		return v
+	case map[string]interface{}:
+		if name, ok := v["name"].(string); ok {
+			full := name
+			if !strings.Contains(name, ".") {
+				if namespace, ok := v["namespace"].(string); ok {
+					ns = namespace
+				}
+				if ns != "" {
+					full = ns + "." + name
+				}
+			}
+			defined[full] = true
+			if i := strings.LastIndex(full, "."); i >= 0 {
+				ns = full[:i]
+			} else {
+				ns = ""
+			}
+		}
+		for _, key := range []string{"type", "items", "values"} {
+			if t, ok := v[key]; ok {
+				v[key] = inlineAvro(t, ns, named, defined)
+			}
+		}
+		if fields, ok := v["fields"].([]interface{}); ok {
+			for _, f := range fields {
+				if field, ok := f.(map[string]interface{}); ok {
+					field["type"] = inlineAvro(field["type"], ns, named, defined)
+				}
+			}
+		}
+		return v
+	}
+	return schema
+}
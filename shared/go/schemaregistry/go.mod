@@ -0,0 +1,17 @@
+module github.com/falcosecurity/plugins/shared/go/schemaregistry
+
+go 1.21
+
+require (
+	github.com/bufbuild/protocompile v0.14.1
+	github.com/falcosecurity/plugins/shared/go/httpclient v0.0.0-00010101000000-000000000000
+	github.com/linkedin/goavro/v2 v2.13.1
+	google.golang.org/protobuf v1.34.2
+)
+
+require (
+	github.com/golang/snappy v0.0.1 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+)
+
+replace github.com/falcosecurity/plugins/shared/go/httpclient => ../httpclient
@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schemaregistry
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protobufDecoder returns the decoder of a Protobuf schema, rendering the
+// fields with their name in the schema. The schema is compiled with the
+// ones of its references, imported by their name, and with the well-known
+// types.
+func (c *Client) protobufDecoder(ctx context.Context, s *Schema) (func([]byte) ([]byte, error), error) {
+	name := fmt.Sprintf("schema-%d.proto", s.ID)
+	sources := map[string]string{name: s.Schema}
+	if err := c.protobufReferences(ctx, s.References, sources, 0); err != nil {
+		return nil, err
+	}
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(sources),
+		}),
+	}
+	files, err := compiler.Compile(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	file := files[0]
+	marshal := protojson.MarshalOptions{UseProtoNames: true}
+
+	return func(payload []byte) ([]byte, error) {
+		desc, payload, err := messageDescriptor(file, payload)
+		if err != nil {
+			return nil, err
+		}
+		msg := dynamicpb.NewMessage(desc)
+		if err := proto.Unmarshal(payload, msg); err != nil {
+			return nil, err
+		}
+		return marshal.Marshal(msg)
+	}, nil
+}
+
+// protobufReferences fetches the schemas of the references, and of their own
+// references, in sources by their import path
+func (c *Client) protobufReferences(ctx context.Context, refs []Reference, sources map[string]string, depth int) error {
+	if depth >= maxReferenceDepth {
+		return fmt.Errorf("references nested more than %d times", maxReferenceDepth)
+	}
+	for _, ref := range refs {
+		if _, ok := sources[ref.Name]; ok {
+			continue
+		}
+		res, err := c.reference(ctx, ref)
+		if err != nil {
+			return err
+		}
+		sources[ref.Name] = res.Schema
+		if err := c.protobufReferences(ctx, res.References, sources, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// messageDescriptor returns the descriptor of the message type of a payload,
+// and the payload without the indexes of the type. The payloads of the
+// Protobuf serializers start with the path of their type in the schema, as
+// the indexes of the message and of its nested messages, encoded as zigzag
+// varints after their count. A count of 0 stands for the first message.
+func messageDescriptor(file protoreflect.FileDescriptor, payload []byte) (protoreflect.MessageDescriptor, []byte, error) {
+	readVarint := func() (int, error) {
+		v, n := binary.Varint(payload)
+		if n <= 0 {
+			return 0, errors.New("invalid message indexes")
+		}
+		payload = payload[n:]
+		return int(v), nil
+	}
+
+	count, err := readVarint()
+	if err != nil {
+		return nil, nil, err
+	}
+	if count == 0 {
+		if file.Messages().Len() == 0 {
+			return nil, nil, errors.New("no message in schema")
+		}
+		return file.Messages().Get(0), payload, nil
+	}
+	if count < 0 || count > 100 {
+		return nil, nil, errors.New("invalid message indexes")
+	}
+
+	var desc protoreflect.MessageDescriptor
+	messages := file.Messages()
+	for i := 0; i < count; i++ {
+		index, err := readVarint()
+		if err != nil {
+			return nil, nil, err
+		}
+		if index < 0 || index >= messages.Len() {
+			return nil, nil, fmt.Errorf("message index %d out of range", index)
+		}
+		desc = messages.Get(index)
+		messages = desc.Messages()
+	}
+	return desc, payload, nil
+}
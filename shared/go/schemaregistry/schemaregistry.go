@@ -0,0 +1,314 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package schemaregistry decodes the messages framed with the ID of their
+// schema in a Confluent Schema Registry, the wire format of the Confluent
+// serializers, into the JSON payloads of the events of the plugins. The
+// schemas are fetched from the registry the first time their ID is seen,
+// and cached for the lifetime of the Client, since a schema ID never
+// changes. The Avro and Protobuf schemas are supported, including their
+// references to the schemas of other subjects, and the JSON ones, whose
+// payload is returned as is.
+package schemaregistry
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/falcosecurity/plugins/shared/go/httpclient"
+)
+
+// The types of the schemas
+const (
+	Avro     = "AVRO"
+	Protobuf = "PROTOBUF"
+	JSON     = "JSON"
+)
+
+// magic is the first byte of the framed messages, followed by the ID of
+// their schema as a big-endian 32 bits integer
+const magic = 0
+
+// failureTTL is how long the lookup of a schema that failed is not retried,
+// so that the messages of an unknown schema don't flood the registry
+const failureTTL = time.Minute
+
+var (
+	// ErrNotFramed is returned by Decode for the payloads that are not
+	// framed with a schema ID, e.g. the ones of the producers writing
+	// plain JSON in the same topic
+	ErrNotFramed = errors.New("payload not framed with a schema ID")
+	// ErrInvalid is wrapped by the errors of the messages that can't be
+	// decoded, e.g. a payload not matching its schema or an unknown schema
+	// ID, as opposed to the errors reaching the registry, which can be
+	// retried
+	ErrInvalid = errors.New("invalid message")
+)
+
+// Config is the configuration block of the client of the registry
+type Config struct {
+	URL      string            `json:"url" jsonschema:"title=URL,description=URL of the Confluent Schema Registry of the schemas of the messages (default: empty for disabled)"`
+	Username string            `json:"username" jsonschema:"title=Username,description=Username of the basic authentication to the registry (default: empty)"`
+	Password string            `json:"password" secret:"true" jsonschema:"title=Password,description=Password of the basic authentication to the registry (default: empty),writeOnly=true"`
+	HTTP     httpclient.Config `json:"http" jsonschema:"title=HTTP,description=Configuration of the HTTP client of the registry"`
+}
+
+// Reset sets the configuration to its default values
+func (c *Config) Reset() {
+	*c = Config{}
+	c.HTTP.Reset()
+}
+
+// Reference is a reference of a schema to the schema of another subject
+type Reference struct {
+	// Name is the name of the reference, i.e. the import path of a
+	// Protobuf schema or the full name of an Avro type
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+// Schema is a schema of the registry
+type Schema struct {
+	ID         int
+	Type       string
+	Schema     string
+	References []Reference
+
+	decode func(payload []byte) ([]byte, error)
+}
+
+// Error is an error response of the registry
+type Error struct {
+	Status  int    `json:"-"`
+	Code    int    `json:"error_code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("schema registry error %d: %s", e.Code, e.Message)
+}
+
+// StatusCode returns the HTTP status of the response, which categorizes the
+// error for the errkind package
+func (e *Error) StatusCode() int {
+	return e.Status
+}
+
+type failure struct {
+	err   error
+	until time.Time
+}
+
+// Client fetches and caches the schemas of a registry. It can be used
+// concurrently.
+type Client struct {
+	url      string
+	username string
+	password string
+	http     *http.Client
+
+	mu       sync.Mutex
+	schemas  map[int]*Schema
+	failures map[int]failure
+}
+
+// New returns a Client of the registry configured with c
+func New(c Config) (*Client, error) {
+	if c.URL == "" {
+		return nil, errors.New("no schema registry URL provided")
+	}
+	if _, err := url.Parse(c.URL); err != nil {
+		return nil, fmt.Errorf("invalid schema registry URL: %w", err)
+	}
+	client, err := httpclient.New(c.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		url:      strings.TrimSuffix(c.URL, "/"),
+		username: c.Username,
+		password: c.Password,
+		http:     client,
+		schemas:  make(map[int]*Schema),
+		failures: make(map[int]failure),
+	}, nil
+}
+
+// SchemaID returns the ID of the schema of a framed payload, and the
+// payload without its frame
+func SchemaID(data []byte) (int, []byte, error) {
+	if len(data) < 5 || data[0] != magic {
+		return 0, nil, ErrNotFramed
+	}
+	return int(binary.BigEndian.Uint32(data[1:5])), data[5:], nil
+}
+
+// Decode returns the JSON payload of a framed message, decoded with its
+// schema. It returns ErrNotFramed if the message is not framed.
+func (c *Client) Decode(ctx context.Context, data []byte) ([]byte, error) {
+	id, payload, err := SchemaID(data)
+	if err != nil {
+		return nil, err
+	}
+	s, err := c.Schema(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.decode(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't decode payload of schema %d: %w", ErrInvalid, id, err)
+	}
+	return res, nil
+}
+
+// Schema returns the schema with the given ID, fetching it from the
+// registry the first time
+func (c *Client) Schema(ctx context.Context, id int) (*Schema, error) {
+	c.mu.Lock()
+	s, ok := c.schemas[id]
+	f, failed := c.failures[id]
+	c.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+	if failed && time.Now().Before(f.until) {
+		return nil, f.err
+	}
+
+	// the schemas are fetched without holding the lock, so that the
+	// lookups of the cached ones don't wait, and the rare concurrent
+	// fetches of the same schema simply agree
+	s, err := c.fetch(ctx, id)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		if errors.Is(err, ErrInvalid) {
+			c.failures[id] = failure{err: err, until: time.Now().Add(failureTTL)}
+		}
+		return nil, err
+	}
+	delete(c.failures, id)
+	c.schemas[id] = s
+	return s, nil
+}
+
+// schemaResponse is the response of the registry to the lookup of a
+// schema, by ID or by subject and version
+type schemaResponse struct {
+	ID         int         `json:"id"`
+	SchemaType string      `json:"schemaType"`
+	Schema     string      `json:"schema"`
+	References []Reference `json:"references"`
+}
+
+func (c *Client) fetch(ctx context.Context, id int) (*Schema, error) {
+	var res schemaResponse
+	if err := c.get(ctx, fmt.Sprintf("/schemas/ids/%d", id), &res); err != nil {
+		var regErr *Error
+		if errors.As(err, &regErr) && regErr.Status == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: unknown schema %d: %w", ErrInvalid, id, err)
+		}
+		return nil, err
+	}
+
+	s := &Schema{
+		ID:         id,
+		Type:       res.SchemaType,
+		Schema:     res.Schema,
+		References: res.References,
+	}
+	if s.Type == "" {
+		// the type is omitted for the Avro schemas
+		s.Type = Avro
+	}
+
+	var err error
+	switch s.Type {
+	case Avro:
+		s.decode, err = c.avroDecoder(ctx, s)
+	case Protobuf:
+		s.decode, err = c.protobufDecoder(ctx, s)
+	case JSON:
+		s.decode = func(payload []byte) ([]byte, error) { return payload, nil }
+	default:
+		err = fmt.Errorf("unsupported schema type %q", s.Type)
+	}
+	if err != nil {
+		// a missing reference makes the schema invalid as well
+		var regErr *Error
+		if !errors.As(err, &regErr) || regErr.Status == http.StatusNotFound {
+			err = fmt.Errorf("%w: invalid schema %d: %w", ErrInvalid, id, err)
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// reference returns the schema of a reference, with its own references
+func (c *Client) reference(ctx context.Context, ref Reference) (*schemaResponse, error) {
+	version := "latest"
+	if ref.Version > 0 {
+		version = fmt.Sprint(ref.Version)
+	}
+	var res schemaResponse
+	path := fmt.Sprintf("/subjects/%s/versions/%s", url.PathEscape(ref.Subject), version)
+	if err := c.get(ctx, path, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// get decodes the JSON response of a GET request to the registry in res
+func (c *Client) get(ctx context.Context, path string, res interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json, application/json")
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		regErr := &Error{Status: resp.StatusCode}
+		if json.Unmarshal(body, regErr) != nil || regErr.Message == "" {
+			regErr.Code = resp.StatusCode
+			regErr.Message = resp.Status
+		}
+		return regErr
+	}
+	return json.Unmarshal(body, res)
+}
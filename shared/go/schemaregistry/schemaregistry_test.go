@@ -0,0 +1,342 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schemaregistry
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	testAvroAddress = `{"type":"record","name":"Address","namespace":"com.example","fields":[{"name":"city","type":"string"}]}`
+	testAvroUser    = `{"type":"record","name":"User","namespace":"com.example","fields":[` +
+		`{"name":"name","type":"string"},{"name":"age","type":["null","int"]},{"name":"address","type":"Address"}]}`
+	testProtoAddress = `syntax = "proto3";
+package example;
+message Address { string city = 1; }`
+	testProtoUser = `syntax = "proto3";
+package example;
+import "address.proto";
+import "google/protobuf/timestamp.proto";
+message User {
+  string user_name = 1;
+  Address address = 2;
+  google.protobuf.Timestamp created = 3;
+  message Login { string ip = 1; }
+}
+message Other { int32 n = 1; }`
+)
+
+// fakeRegistry serves the schemas of a registry and counts the lookups
+type fakeRegistry struct {
+	mu       sync.Mutex
+	schemas  map[string]string // responses by path
+	requests map[string]int
+	status   int // status of all the responses, if set
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[r.URL.Path]++
+	if user, pass, _ := r.BasicAuth(); user != "user" || pass != "pass" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error_code":401,"message":"unauthorized"}`)
+		return
+	}
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		return
+	}
+	res, ok := f.schemas[r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error_code":40403,"message":"Schema not found"}`)
+		return
+	}
+	fmt.Fprint(w, res)
+}
+
+func (f *fakeRegistry) count(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[path]
+}
+
+// schemaResponse returns the response of the registry to a schema lookup
+func testSchemaResponse(typ, schema string, refs ...Reference) string {
+	b, _ := json.Marshal(schemaResponse{SchemaType: typ, Schema: schema, References: refs})
+	return string(b)
+}
+
+func newTestRegistry(t *testing.T) (*Client, *fakeRegistry) {
+	f := &fakeRegistry{
+		requests: make(map[string]int),
+		schemas: map[string]string{
+			"/schemas/ids/1":                          testSchemaResponse("", testAvroUser, Reference{Name: "com.example.Address", Subject: "address", Version: 1}),
+			"/subjects/address/versions/1":            testSchemaResponse("", testAvroAddress),
+			"/schemas/ids/2":                          testSchemaResponse(Protobuf, testProtoUser, Reference{Name: "address.proto", Subject: "address-proto"}),
+			"/subjects/address-proto/versions/latest": testSchemaResponse(Protobuf, testProtoAddress),
+			"/schemas/ids/3":                          testSchemaResponse(JSON, `{"type":"object"}`),
+			"/schemas/ids/4":                          testSchemaResponse("XML", ""),
+			"/schemas/ids/5":                          testSchemaResponse("", `{"type":"record"}`),
+			"/schemas/ids/6":                          testSchemaResponse("", testAvroUser, Reference{Name: "com.example.Address", Subject: "missing"}),
+		},
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	var c Config
+	c.Reset()
+	c.URL = srv.URL + "/"
+	c.Username = "user"
+	c.Password = "pass"
+	c.HTTP.Retries = 0
+	client, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, f
+}
+
+// frame returns a payload framed with a schema ID and the given prefix,
+// like the Confluent serializers do
+func frame(id int, prefix, payload []byte) []byte {
+	res := []byte{magic, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(res[1:], uint32(id))
+	return append(append(res, prefix...), payload...)
+}
+
+// messageIndexes encodes the indexes of a message type like the Protobuf
+// serializers do
+func messageIndexes(indexes ...int) []byte {
+	res := binary.AppendVarint(nil, int64(len(indexes)))
+	for _, i := range indexes {
+		res = binary.AppendVarint(res, int64(i))
+	}
+	return res
+}
+
+func assertJSON(t *testing.T, name string, res []byte, expected string) {
+	t.Helper()
+	var a, b interface{}
+	if err := json.Unmarshal(res, &a); err != nil {
+		t.Fatalf("%s: invalid JSON %s: %v", name, res, err)
+	}
+	if err := json.Unmarshal([]byte(expected), &b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("%s: expected %s, got %s", name, expected, res)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(Config{}); err == nil {
+		t.Error("expected an error without URL")
+	}
+	if _, err := New(Config{URL: "http://[::1"}); err == nil {
+		t.Error("expected an error with an invalid URL")
+	}
+}
+
+func TestSchemaID(t *testing.T) {
+	id, payload, err := SchemaID(frame(258, nil, []byte("data")))
+	if err != nil || id != 258 || string(payload) != "data" {
+		t.Errorf("unexpected schema ID %d and payload %q (%v)", id, payload, err)
+	}
+	for _, data := range [][]byte{nil, {magic, 0, 0, 0}, []byte(`{"a":1}`)} {
+		if _, _, err := SchemaID(data); err != ErrNotFramed {
+			t.Errorf("%q: expected ErrNotFramed, got %v", data, err)
+		}
+	}
+}
+
+func TestDecodeAvro(t *testing.T) {
+	client, f := newTestRegistry(t)
+
+	// the payload is encoded by the reference implementation with the
+	// referenced type inlined
+	codec, err := goavro.NewCodec(strings.Replace(testAvroUser, `"type":"Address"`, `"type":`+testAvroAddress, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		native   map[string]interface{}
+		expected string
+	}{
+		{
+			map[string]interface{}{"name": "alice", "age": goavro.Union("int", 42), "address": map[string]interface{}{"city": "Paris"}},
+			`{"name":"alice","age":42,"address":{"city":"Paris"}}`,
+		},
+		{
+			map[string]interface{}{"name": "bob", "age": nil, "address": map[string]interface{}{"city": ""}},
+			`{"name":"bob","age":null,"address":{"city":""}}`,
+		},
+	}
+	for _, test := range tests {
+		payload, err := codec.BinaryFromNative(nil, test.native)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := client.Decode(context.Background(), frame(1, nil, payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertJSON(t, "avro", res, test.expected)
+
+		// the trailing bytes are invalid
+		if _, err := client.Decode(context.Background(), frame(1, nil, append(payload, 0))); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected an invalid message, got %v", err)
+		}
+	}
+
+	// the schema and its reference are fetched once
+	if n := f.count("/schemas/ids/1") + f.count("/subjects/address/versions/1"); n != 2 {
+		t.Errorf("expected the schemas to be fetched once, got %d requests", n)
+	}
+	s, err := client.Schema(context.Background(), 1)
+	if err != nil || s.Type != Avro || len(s.References) != 1 {
+		t.Errorf("unexpected schema %+v (%v)", s, err)
+	}
+}
+
+func TestDecodeProtobuf(t *testing.T) {
+	client, _ := newTestRegistry(t)
+
+	// the payloads are encoded by the reference implementation
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{"user.proto": testProtoUser, "address.proto": testProtoAddress}),
+		}),
+	}
+	files, err := compiler.Compile(context.Background(), "user.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(desc protoreflect.MessageDescriptor, text string) []byte {
+		msg := dynamicpb.NewMessage(desc)
+		if err := protojson.Unmarshal([]byte(text), msg); err != nil {
+			t.Fatal(err)
+		}
+		b, err := proto.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	user := files[0].Messages().Get(0)
+	tests := []struct {
+		name     string
+		indexes  []byte
+		desc     protoreflect.MessageDescriptor
+		text     string
+		expected string
+	}{
+		// the first message is encoded with a single 0
+		{"first", []byte{0}, user, `{"user_name":"alice","address":{"city":"Paris"},"created":"2024-01-01T00:00:00Z"}`, ""},
+		{"first by index", messageIndexes(0), user, `{"user_name":"bob"}`, ""},
+		{"second", messageIndexes(1), files[0].Messages().Get(1), `{"n":3}`, ""},
+		{"nested", messageIndexes(0, 0), user.Messages().Get(0), `{"ip":"10.0.0.1"}`, ""},
+	}
+	for _, test := range tests {
+		res, err := client.Decode(context.Background(), frame(2, test.indexes, encode(test.desc, test.text)))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		// the fields keep their name in the schema
+		assertJSON(t, test.name, res, test.text)
+	}
+
+	for _, indexes := range [][]byte{nil, messageIndexes(2), messageIndexes(0, 1), {0x80}} {
+		if _, err := client.Decode(context.Background(), frame(2, indexes, nil)); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%v: expected an invalid message, got %v", indexes, err)
+		}
+	}
+	if _, err := client.Decode(context.Background(), frame(2, []byte{0}, []byte{0xff})); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected an invalid message, got %v", err)
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	client, _ := newTestRegistry(t)
+	res, err := client.Decode(context.Background(), frame(3, nil, []byte(`{"a":1}`)))
+	if err != nil || string(res) != `{"a":1}` {
+		t.Errorf("expected the payload as is, got %s (%v)", res, err)
+	}
+	if _, err := client.Decode(context.Background(), []byte(`{"a":1}`)); err != ErrNotFramed {
+		t.Errorf("expected ErrNotFramed, got %v", err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	client, f := newTestRegistry(t)
+
+	// the unknown and invalid schemas are invalid messages, and are not
+	// fetched again for a while
+	for _, id := range []int{4, 5, 6, 7} {
+		for i := 0; i < 2; i++ {
+			if _, err := client.Decode(context.Background(), frame(id, nil, nil)); !errors.Is(err, ErrInvalid) {
+				t.Errorf("schema %d: expected an invalid message, got %v", id, err)
+			}
+		}
+		if n := f.count(fmt.Sprintf("/schemas/ids/%d", id)); n != 1 {
+			t.Errorf("schema %d: expected the schema to be fetched once, got %d requests", id, n)
+		}
+	}
+
+	// the errors of the registry are retried
+	f.status = http.StatusInternalServerError
+	for i := 0; i < 2; i++ {
+		_, err := client.Decode(context.Background(), frame(1, nil, nil))
+		var regErr *Error
+		if !errors.As(err, &regErr) || regErr.StatusCode() != http.StatusInternalServerError || errors.Is(err, ErrInvalid) {
+			t.Errorf("expected a registry error, got %v", err)
+		}
+	}
+	if n := f.count("/schemas/ids/1"); n != 2 {
+		t.Errorf("expected the schema to be fetched again, got %d requests", n)
+	}
+	f.status = 0
+	if _, err := client.Schema(context.Background(), 1); err != nil {
+		t.Error(err)
+	}
+
+	// the error responses are decoded
+	client.password = "other"
+	_, err := client.Schema(context.Background(), 2)
+	var regErr *Error
+	if !errors.As(err, &regErr) || regErr.Code != 401 || regErr.Message != "unauthorized" {
+		t.Errorf("expected an authentication error, got %v", err)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/falcosecurity/plugins/shared/go/secrets
+
+go 1.15
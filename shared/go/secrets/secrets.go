@@ -0,0 +1,323 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package secrets resolves the placeholders of the configs of the plugins,
+// so that the secrets don't have to be written in clear in falco.yaml:
+//
+//   - ${NAME} or ${env:NAME} is replaced with the value of the NAME
+//     environment variable, or with default if it is not set and the
+//     placeholder is ${NAME:-default}, and $${ escapes a literal ${
+//   - file://<path> or ${file:<path>} is replaced with the content of the
+//     file, without its trailing newlines, e.g. a mounted Kubernetes secret
+//   - vault://<path>#<key> or ${vault:<path>#<key>} is replaced with the
+//     key of a secret read from HashiCorp Vault, see Vault
+//
+// The file:// and vault:// references are whole values, and they can
+// themselves contain ${NAME} placeholders, while the placeholders can be
+// embedded in a value, e.g. Bearer ${file:/run/secrets/token}. The errors
+// never quote the resolved values.
+//
+// Only the config fields holding secrets are resolved, which are tagged with
+// secret:"true", so that the other values are never rewritten. They are
+// also marked with writeOnly=true in their jsonschema tag, so that their
+// schema tells the tools showing the configs to hide them, and Redact and
+// Scrub hide their values from the configs and the messages that are
+// logged.
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	filePrefix  = "file://"
+	vaultPrefix = "vault://"
+)
+
+// Expand resolves the placeholders of a single value. The errors of the
+// file:// and vault:// references quote them as written, since their
+// placeholders may have been resolved to secrets.
+func Expand(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, filePrefix):
+		path, err := expand(strings.TrimPrefix(s, filePrefix), true)
+		if err != nil {
+			return "", err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			var pathErr *os.PathError
+			if errors.As(err, &pathErr) {
+				err = pathErr.Err
+			}
+			return "", fmt.Errorf("reading %s: %s", s, err.Error())
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	case strings.HasPrefix(s, vaultPrefix):
+		ref, err := expand(strings.TrimPrefix(s, vaultPrefix), true)
+		if err != nil {
+			return "", err
+		}
+		v, err := Vault(ref)
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %s", s, err.Error())
+		}
+		return v, nil
+	}
+	return expand(s, true)
+}
+
+// ExpandEnv only replaces the ${NAME} and ${env:NAME} placeholders of a
+// value. It suits the open params, in which the file:// scheme may already
+// have a meaning.
+func ExpandEnv(s string) (string, error) {
+	return expand(s, false)
+}
+
+// expand replaces the placeholders of a value, and the ones referencing
+// files and Vault secrets if refs is true
+func expand(s string, refs bool) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i])
+			b.WriteString("{")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated placeholder: %s", s[i:])
+		}
+		b.WriteString(s[:i])
+		name := s[i+2 : i+end]
+		s = s[i+end+1:]
+		if scheme := strings.SplitN(name, ":", 2); len(scheme) == 2 && (scheme[0] == "file" || scheme[0] == "vault") {
+			if !refs {
+				return "", fmt.Errorf("%s references are only supported in the init config", scheme[0])
+			}
+			v, err := Expand(scheme[0] + "://" + scheme[1])
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(v)
+			continue
+		}
+		name = strings.TrimPrefix(name, "env:")
+		def, hasDef := "", false
+		if j := strings.Index(name, ":-"); j >= 0 {
+			name, def, hasDef = name[:j], name[j+2:], true
+		}
+		v, ok := os.LookupEnv(name)
+		if !ok || (v == "" && hasDef) {
+			if !hasDef {
+				return "", fmt.Errorf("environment variable %s is not set", name)
+			}
+			v = def
+		}
+		b.WriteString(v)
+	}
+}
+
+// Redacted replaces the values of the secrets in the redacted configs and
+// messages
+const Redacted = "<redacted>"
+
+// Resolve resolves the placeholders of the secrets of a config, which is a
+// pointer to a struct. The secrets are the string values of the fields
+// tagged with secret:"true", including the ones of the slices, the maps and
+// the structs of such fields, and the other values are kept as they are,
+// even if they look like placeholders. The nested structs and pointers, the
+// slices and the maps are walked to find the tagged fields. The errors name
+// the JSON key of the field that could not be resolved.
+func Resolve(cfg interface{}) error {
+	return walk(reflect.ValueOf(cfg), "", false, func(v reflect.Value, path string) error {
+		s, err := Expand(v.String())
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err.Error())
+		}
+		v.SetString(s)
+		return nil
+	})
+}
+
+// Redact returns the JSON encoding of a config in which the values of the
+// secrets, as defined by Resolve, are replaced with Redacted, so that the
+// config can be logged or reported. The config itself is left unchanged.
+func Redact(cfg interface{}) (string, error) {
+	cp, err := copyConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+	err = walk(cp, "", false, func(v reflect.Value, path string) error {
+		if v.Len() > 0 {
+			v.SetString(Redacted)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(cp.Interface()); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// Scrub returns a message, such as an error returned by a client of an
+// upstream, in which the values of the secrets of a config, as defined by
+// Resolve, are replaced with Redacted.
+func Scrub(msg string, cfg interface{}) string {
+	cp, err := copyConfig(cfg)
+	if err != nil {
+		return msg
+	}
+	var values []string
+	walk(cp, "", false, func(v reflect.Value, path string) error {
+		if v.Len() > 0 {
+			values = append(values, v.String())
+		}
+		return nil
+	})
+	// the longest values first, in case one contains another
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	for _, s := range values {
+		msg = strings.ReplaceAll(msg, s, Redacted)
+	}
+	return msg
+}
+
+// copyConfig returns a pointer to a deep copy of the exported fields of a
+// config, made through its JSON encoding
+func copyConfig(cfg interface{}) (reflect.Value, error) {
+	typ := reflect.TypeOf(cfg)
+	if typ == nil {
+		return reflect.Value{}, errors.New("nil config")
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	cp := reflect.New(typ)
+	if err := json.Unmarshal(b, cp.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return cp, nil
+}
+
+// walk calls fn on the settable string values of the secrets found in v,
+// secret telling whether v is itself part of a secret
+func walk(v reflect.Value, path string, secret bool, fn func(v reflect.Value, path string) error) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return walk(v.Elem(), path, secret, fn)
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if !v.CanSet() {
+			return walk(v.Elem(), path, secret, fn)
+		}
+		// the dynamic value of an interface is not addressable, so it
+		// is walked in a copy
+		cp := reflect.New(v.Elem().Type()).Elem()
+		cp.Set(v.Elem())
+		if err := walk(cp, path, secret, fn); err != nil {
+			return err
+		}
+		v.Set(cp)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if (f.PkgPath != "" && !f.Anonymous) || f.Tag.Get("json") == "-" {
+				continue // unexported or not part of the config
+			}
+			fpath := path
+			if !f.Anonymous {
+				fpath = join(path, jsonName(f))
+			}
+			if err := walk(v.Field(i), fpath, secret || f.Tag.Get("secret") == "true", fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := walk(v.Index(i), fmt.Sprintf("%s[%d]", path, i), secret, fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			val := iter.Value()
+			// the values of a map are not addressable, so they are
+			// walked in a copy
+			cp := reflect.New(val.Type()).Elem()
+			cp.Set(val)
+			if err := walk(cp, join(path, fmt.Sprint(iter.Key())), secret, fn); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), cp)
+		}
+	case reflect.String:
+		if !secret || !v.CanSet() {
+			return nil
+		}
+		return fn(v, path)
+	}
+	return nil
+}
+
+// jsonName returns the JSON key of a struct field
+func jsonName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" {
+		return name
+	}
+	return f.Name
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,306 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secrets
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSecret = "s3cr3t"
+
+// setenv sets environment variables for the duration of a test
+func setenv(t *testing.T, kv ...string) {
+	for i := 0; i+1 < len(kv); i += 2 {
+		name := kv[i]
+		prev, ok := os.LookupEnv(name)
+		os.Setenv(name, kv[i+1])
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(name, prev)
+			} else {
+				os.Unsetenv(name)
+			}
+		})
+	}
+}
+
+// writeFile writes a file in a temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExpand(t *testing.T) {
+	setenv(t, "SECRETS_TEST", testSecret, "SECRETS_TEST_EMPTY", "", "SECRETS_TEST_REF", "file:///nonexistent")
+	tests := map[string]string{
+		"plain":                          "plain",
+		"${SECRETS_TEST}":                testSecret,
+		"${env:SECRETS_TEST}":            testSecret,
+		"Bearer ${SECRETS_TEST}!":        "Bearer " + testSecret + "!",
+		"${SECRETS_TEST}${SECRETS_TEST}": testSecret + testSecret,
+		"${SECRETS_TEST_UNSET:-default}": "default",
+		"${SECRETS_TEST_EMPTY:-default}": "default",
+		"${SECRETS_TEST:-default}":       testSecret,
+		"${SECRETS_TEST_UNSET:-}":        "",
+		"${SECRETS_TEST_EMPTY}":          "",
+		"$${SECRETS_TEST}":               "${SECRETS_TEST}",
+		"a $${b} ${SECRETS_TEST}":        "a ${b} " + testSecret,
+		"$":                              "$",
+		"{SECRETS_TEST}":                 "{SECRETS_TEST}",
+		"${SECRETS_TEST_REF}":            "file:///nonexistent",
+	}
+	for value, expected := range tests {
+		if res, err := Expand(value); err != nil || res != expected {
+			t.Errorf("%q: expected %q, got %q (%v)", value, expected, res, err)
+		}
+	}
+}
+
+func TestExpandErrors(t *testing.T) {
+	setenv(t, "SECRETS_TEST", testSecret)
+	tests := map[string]string{
+		"${SECRETS_TEST_UNSET}":               "environment variable SECRETS_TEST_UNSET is not set",
+		"${SECRETS_TEST":                      "unterminated placeholder: ${SECRETS_TEST",
+		"${SECRETS_TEST} ${":                  "unterminated placeholder: ${",
+		"file:///nonexistent/${SECRETS_TEST}": "reading file:///nonexistent/${SECRETS_TEST}: no such file or directory",
+		"${file:/nonexistent}":                "reading file:///nonexistent: no such file or directory",
+		"vault://${SECRETS_TEST}":             "reading vault://${SECRETS_TEST}: invalid vault reference, expected vault://<path>#<key>",
+	}
+	for value, expected := range tests {
+		res, err := Expand(value)
+		if err == nil {
+			t.Errorf("%q: expected an error, got %q", value, res)
+			continue
+		}
+		if err.Error() != expected {
+			t.Errorf("%q: expected the error %q, got %q", value, expected, err.Error())
+		}
+		if strings.Contains(err.Error(), testSecret) {
+			t.Errorf("%q: the error quotes the resolved value: %s", value, err.Error())
+		}
+	}
+}
+
+func TestExpandFile(t *testing.T) {
+	path := writeFile(t, "token", testSecret+"\n\r\n")
+	setenv(t, "SECRETS_TEST_DIR", filepath.Dir(path))
+	tests := map[string]string{
+		"file://" + path:                              testSecret,
+		"file://${SECRETS_TEST_DIR}/token":            testSecret,
+		"Bearer ${file:" + path + "}":                 "Bearer " + testSecret,
+		"${file:${SECRETS_TEST_DIR}/token":            "",
+		" file://" + path:                             " file://" + path,
+		"file://" + writeFile(t, "lines", "a\nb\n\n"): "a\nb",
+		"file://" + writeFile(t, "spaces", " a \n"):   " a ",
+	}
+	for value, expected := range tests {
+		res, err := Expand(value)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %q", value, res)
+			}
+			continue
+		}
+		if err != nil || res != expected {
+			t.Errorf("%q: expected %q, got %q (%v)", value, expected, res, err)
+		}
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	setenv(t, "SECRETS_TEST", testSecret)
+	if res, err := ExpandEnv("${SECRETS_TEST} $${x}"); err != nil || res != testSecret+" ${x}" {
+		t.Errorf("expected the environment variable, got %q (%v)", res, err)
+	}
+
+	// the file:// values are left as they are, and the file and vault
+	// references are rejected
+	if res, err := ExpandEnv("file:///etc/hosts"); err != nil || res != "file:///etc/hosts" {
+		t.Errorf("expected the file:// value to be kept, got %q (%v)", res, err)
+	}
+	for _, value := range []string{"${file:/etc/hosts}", "${vault:secret/data/falco#token}"} {
+		if res, err := ExpandEnv(value); err == nil || !strings.Contains(err.Error(), "only supported in the init config") {
+			t.Errorf("%q: expected the reference to be rejected, got %q (%v)", value, res, err)
+		}
+	}
+}
+
+type testName string
+
+type testNested struct {
+	Token string `json:"token" secret:"true"`
+	Plain string `json:"plain"`
+}
+
+type testEmbedded struct {
+	Embedded string `json:"embedded" secret:"true"`
+}
+
+type testConfig struct {
+	testEmbedded
+	Token    string                 `json:"token" secret:"true"`
+	Plain    string                 `json:"plain"`
+	Named    testName               `json:"named" secret:"true"`
+	Nested   testNested             `json:"nested"`
+	Ptr      *testNested            `json:"ptr"`
+	Nil      *testNested            `json:"nil"`
+	List     []string               `json:"list" secret:"true"`
+	Map      map[string]string      `json:"map" secret:"true"`
+	NamedMap map[string]testName    `json:"namedMap" secret:"true"`
+	Structs  map[string]testNested  `json:"structs"`
+	Any      map[string]interface{} `json:"any" secret:"true"`
+	Anys     []interface{}          `json:"anys"`
+	Number   int                    `json:"number"`
+	Ignored  string                 `json:"-" secret:"true"`
+	private  string
+}
+
+func TestResolve(t *testing.T) {
+	setenv(t, "SECRETS_TEST", testSecret)
+	cfg := testConfig{
+		testEmbedded: testEmbedded{Embedded: "${SECRETS_TEST}"},
+		Token:        "${SECRETS_TEST}",
+		Plain:        "${SECRETS_TEST}",
+		Named:        "${SECRETS_TEST}",
+		Nested:       testNested{Token: "${SECRETS_TEST}", Plain: "file:///nonexistent"},
+		Ptr:          &testNested{Token: "${SECRETS_TEST}"},
+		List:         []string{"a", "${SECRETS_TEST}"},
+		Map:          map[string]string{"a": "${SECRETS_TEST}"},
+		NamedMap:     map[string]testName{"a": "${SECRETS_TEST}"},
+		Structs:      map[string]testNested{"a": {Token: "${SECRETS_TEST}", Plain: "${SECRETS_TEST}"}},
+		Any:          map[string]interface{}{"a": "${SECRETS_TEST}", "b": 1},
+		Anys:         []interface{}{"${SECRETS_TEST}", testNested{Token: "${SECRETS_TEST}"}},
+		Number:       1,
+		Ignored:      "${SECRETS_TEST}",
+		private:      "${SECRETS_TEST}",
+	}
+	if err := Resolve(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	resolved := []string{
+		cfg.Embedded, cfg.Token, string(cfg.Named), cfg.Nested.Token, cfg.Ptr.Token,
+		cfg.List[1], cfg.Map["a"], string(cfg.NamedMap["a"]), cfg.Structs["a"].Token,
+		cfg.Any["a"].(string), cfg.Anys[1].(testNested).Token,
+	}
+	for i, v := range resolved {
+		if v != testSecret {
+			t.Errorf("value %d: expected the value to be resolved, got %q", i, v)
+		}
+	}
+	if cfg.List[0] != "a" || cfg.Any["b"] != 1 || cfg.Nil != nil {
+		t.Errorf("expected the other values to be kept")
+	}
+
+	// the values of the fields that are not secrets are never rewritten,
+	// even if they look like placeholders
+	kept := []string{cfg.Plain, cfg.Nested.Plain, cfg.Structs["a"].Plain, cfg.Anys[0].(string), cfg.Ignored, cfg.private}
+	for i, v := range kept {
+		if v != "${SECRETS_TEST}" && v != "file:///nonexistent" {
+			t.Errorf("value %d: expected the value to be kept, got %q", i, v)
+		}
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	setenv(t, "SECRETS_TEST", testSecret)
+	tests := []struct {
+		cfg      testConfig
+		expected string
+	}{
+		{testConfig{Token: "${SECRETS_TEST_UNSET}"}, "token: environment variable SECRETS_TEST_UNSET is not set"},
+		{testConfig{Nested: testNested{Token: "${"}}, "nested.token: unterminated placeholder: ${"},
+		{testConfig{List: []string{"a", "${SECRETS_TEST_UNSET}"}}, "list[1]: environment variable SECRETS_TEST_UNSET is not set"},
+		{testConfig{Map: map[string]string{"a": "${SECRETS_TEST_UNSET}"}}, "map.a: environment variable SECRETS_TEST_UNSET is not set"},
+		{testConfig{Structs: map[string]testNested{"a": {Token: "${SECRETS_TEST_UNSET}"}}}, "structs.a.token: environment variable SECRETS_TEST_UNSET is not set"},
+		{testConfig{Token: "file:///nonexistent/${SECRETS_TEST}"}, "token: reading file:///nonexistent/${SECRETS_TEST}: no such file or directory"},
+	}
+	for _, test := range tests {
+		err := Resolve(&test.cfg)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("expected the error %q, got %v", test.expected, err)
+		}
+		if err != nil && strings.Contains(err.Error(), testSecret) {
+			t.Errorf("the error quotes the resolved value: %s", err.Error())
+		}
+	}
+
+	// the values of the fields that are not secrets can't fail
+	cfg := testConfig{Plain: "${SECRETS_TEST_UNSET}", Nested: testNested{Plain: "file:///nonexistent"}}
+	if err := Resolve(&cfg); err != nil {
+		t.Errorf("expected the values that are not secrets to be ignored, got %v", err)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	cfg := testConfig{
+		testEmbedded: testEmbedded{Embedded: testSecret},
+		Token:        testSecret,
+		Plain:        "plain",
+		Nested:       testNested{Token: testSecret, Plain: "plain"},
+		List:         []string{testSecret, ""},
+		Map:          map[string]string{"a": testSecret},
+		Structs:      map[string]testNested{"a": {Token: testSecret}},
+		Any:          map[string]interface{}{"a": testSecret, "b": 1},
+		Number:       1,
+	}
+	dump, err := Redact(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(dump, testSecret) {
+		t.Errorf("the dump of the config shows a secret: %s", dump)
+	}
+	var redacted testConfig
+	if err := json.Unmarshal([]byte(dump), &redacted); err != nil {
+		t.Fatalf("expected a json dump, got %s", dump)
+	}
+	if redacted.Token != Redacted || redacted.Nested.Token != Redacted || redacted.Map["a"] != Redacted || redacted.Any["a"] != Redacted {
+		t.Errorf("expected the secrets to be redacted, got %s", dump)
+	}
+	// the empty secrets are shown as empty, and the other values as they are
+	if redacted.List[1] != "" || redacted.Plain != "plain" || redacted.Nested.Plain != "plain" || redacted.Number != 1 {
+		t.Errorf("expected the other values to be kept, got %s", dump)
+	}
+	// the config itself is left unchanged
+	if cfg.Token != testSecret || cfg.Map["a"] != testSecret || cfg.Any["a"] != testSecret {
+		t.Errorf("expected the config to be unchanged, got %+v", cfg)
+	}
+}
+
+func TestScrub(t *testing.T) {
+	setenv(t, "SECRETS_TEST", testSecret)
+	cfg := testConfig{Token: "${SECRETS_TEST}", Map: map[string]string{"a": testSecret + "-longer"}, Plain: "plain"}
+	if err := Resolve(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	msg := Scrub("GET https://api/?token="+testSecret+"&other="+testSecret+"-longer failed for plain", &cfg)
+	if expected := "GET https://api/?token=" + Redacted + "&other=" + Redacted + " failed for plain"; msg != expected {
+		t.Errorf("expected %q, got %q", expected, msg)
+	}
+	if msg := Scrub("no secret", &testConfig{}); msg != "no secret" {
+		t.Errorf("expected the message to be kept, got %q", msg)
+	}
+}
@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secrets
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const vaultTimeout = 10 * time.Second
+
+// Vault reads the key of a secret from HashiCorp Vault, with a reference
+// in the <path>#<key> form, e.g. secret/data/falco#api_token. The path is
+// the API path of the secret, which includes data/ for the KV version 2
+// secrets engine. The server is configured with the standard environment
+// variables of the Vault CLI: VAULT_ADDR, VAULT_TOKEN, VAULT_NAMESPACE and
+// VAULT_CACERT. The errors don't quote the reference, which is quoted by
+// Expand as written in the config.
+func Vault(ref string) (string, error) {
+	i := strings.LastIndexByte(ref, '#')
+	if i <= 0 || i == len(ref)-1 {
+		return "", fmt.Errorf("invalid vault reference, expected vault://<path>#<key>")
+	}
+	path, key := strings.Trim(ref[:i], "/"), ref[i+1:]
+
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("environment variable VAULT_ADDR is not set")
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	client, err := vaultClient()
+	if err != nil {
+		return "", err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("reading vault secret: %s", res.Status)
+	}
+
+	// the KV version 2 secrets are nested in a second data object
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("reading vault secret: %s", err.Error())
+	}
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+	v, ok := data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret has no string key")
+	}
+	return v, nil
+}
+
+func vaultClient() (*http.Client, error) {
+	client := &http.Client{Timeout: vaultTimeout}
+	if caFile := os.Getenv("VAULT_CACERT"); caFile != "" {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", caFile)
+		}
+		client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}
+	}
+	return client, nil
+}
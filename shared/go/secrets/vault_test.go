@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secrets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Vault-Token") != "token" || req.Header.Get("X-Vault-Namespace") != "ns" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		switch req.URL.Path {
+		case "/v1/secret/data/falco":
+			w.Write([]byte(`{"data":{"data":{"token":"` + testSecret + `"},"metadata":{"version":1}}}`))
+		case "/v1/kv/falco":
+			w.Write([]byte(`{"data":{"token":"` + testSecret + `","number":1}}`))
+		case "/v1/kv/invalid":
+			w.Write([]byte(`{`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+	setenv(t, "VAULT_ADDR", srv.URL+"/", "VAULT_TOKEN", "token", "VAULT_NAMESPACE", "ns", "SECRETS_TEST_PATH", "secret/data/falco")
+
+	// the KV version 1 and 2 secrets are supported
+	tests := map[string]string{
+		"vault://secret/data/falco#token":    testSecret,
+		"vault:///kv/falco/#token":           testSecret,
+		"vault://${SECRETS_TEST_PATH}#token": testSecret,
+		"Bearer ${vault:kv/falco#token}":     "Bearer " + testSecret,
+	}
+	for value, expected := range tests {
+		if res, err := Expand(value); err != nil || res != expected {
+			t.Errorf("%q: expected %q, got %q (%v)", value, expected, res, err)
+		}
+	}
+
+	errs := map[string]string{
+		"vault://kv/falco#number":  "vault secret has no string key",
+		"vault://kv/falco#missing": "vault secret has no string key",
+		"vault://kv/missing#token": "404 Not Found",
+		"vault://kv/invalid#token": "unexpected EOF",
+		"vault://kv/falco":         "invalid vault reference",
+		"vault://kv/falco#":        "invalid vault reference",
+	}
+	for value, expected := range errs {
+		res, err := Expand(value)
+		if err == nil || !strings.HasPrefix(err.Error(), "reading "+value+": ") || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected the error %q, got %q (%v)", value, expected, res, err)
+		}
+	}
+
+	setenv(t, "VAULT_TOKEN", "other")
+	if _, err := Expand("vault://kv/falco#token"); err == nil || !strings.Contains(err.Error(), "403 Forbidden") {
+		t.Errorf("expected the request to be denied, got %v", err)
+	}
+	setenv(t, "VAULT_ADDR", "")
+	if _, err := Expand("vault://kv/falco#token"); err == nil || !strings.Contains(err.Error(), "VAULT_ADDR is not set") {
+		t.Errorf("expected VAULT_ADDR to be required, got %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tail
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+const (
+	// readSize is the size of the blocks read from a file, each call of
+	// read reading at most one of them
+	readSize = 64 * 1024
+	// lastSize is the size of the content remembered at the end of what was
+	// read, to tell a rewritten file from a touched one
+	lastSize = 64
+)
+
+// file is a followed file
+type file struct {
+	path    string
+	f       *os.File
+	info    os.FileInfo
+	offset  int64
+	buf     []byte
+	partial []byte // the last line read, until its line ending is
+	last    []byte // the last bytes read, before offset
+	removed bool
+	// rotated is the file replaced at the path by the last read, if any
+	rotated os.FileInfo
+}
+
+// openFile opens a file to follow, from its end if atEnd is true
+func openFile(path string, atEnd bool) (*file, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, os.ErrInvalid
+	}
+	res := &file{path: path, f: f, info: info}
+	if atEnd {
+		res.offset, err = f.Seek(0, io.SeekEnd)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		res.last = make([]byte, lastSize)
+		if res.offset < lastSize {
+			res.last = res.last[:res.offset]
+		}
+		if _, err := f.ReadAt(res.last, res.offset-int64(len(res.last))); err != nil {
+			res.last = nil
+		}
+	}
+	return res, nil
+}
+
+// read returns the complete lines of the next block of the file, and true
+// if there's more to read right away. A file renamed or removed by a
+// rotation is read to its end, then the file created at its path is followed
+// from its beginning. A truncated file is read again from its beginning.
+func (f *file) read() ([][]byte, bool, error) {
+	lines, eof, err := f.readBlock()
+	if err != nil || !eof {
+		return lines, err == nil, err
+	}
+	info, err := os.Stat(f.path)
+	switch {
+	case os.IsNotExist(err):
+		f.removed = true
+		return f.flush(lines), false, nil
+	case err != nil:
+		return nil, false, err
+	case !os.SameFile(info, f.info):
+		// rotated: the rest of the old file has just been read
+		lines = f.flush(lines)
+		next, err := openFile(f.path, false)
+		if err != nil {
+			return lines, false, nil // retried at the next call
+		}
+		f.close()
+		rotated := f.info
+		*f = *next
+		f.rotated = rotated
+		return lines, true, nil
+	case f.truncated(info):
+		// the lines written since are read from the beginning, even if
+		// they have the size of the former content
+		f.info = info
+		f.offset = 0
+		f.partial = nil
+		f.last = nil
+		if _, err := f.f.Seek(0, io.SeekStart); err != nil {
+			return nil, false, err
+		}
+		return lines, true, nil
+	}
+	f.info = info
+	return lines, false, nil
+}
+
+// truncated returns true if the file was truncated since it was read to its
+// end. A file rewritten with the size of its former content is told from a
+// file only touched by comparing the last bytes read with its content.
+func (f *file) truncated(info os.FileInfo) bool {
+	if info.Size() < f.offset {
+		return true
+	}
+	if info.Size() > f.offset || !info.ModTime().After(f.info.ModTime()) || len(f.last) == 0 {
+		return false
+	}
+	data := make([]byte, len(f.last))
+	if _, err := f.f.ReadAt(data, f.offset-int64(len(data))); err != nil {
+		return true
+	}
+	return !bytes.Equal(data, f.last)
+}
+
+// readBlock reads the next block of the file, and returns its complete
+// lines, and true if the end of the file is reached
+func (f *file) readBlock() ([][]byte, bool, error) {
+	if f.buf == nil {
+		f.buf = make([]byte, readSize)
+	}
+	n, err := f.f.Read(f.buf)
+	var lines [][]byte
+	if n > 0 {
+		f.offset += int64(n)
+		data := f.buf[:n]
+		f.last = append(f.last, data...)
+		if len(f.last) > lastSize {
+			f.last = append([]byte(nil), f.last[len(f.last)-lastSize:]...)
+		}
+		for {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				f.partial = append(f.partial, data...)
+				break
+			}
+			line := append(f.partial, data[:i]...)
+			f.partial = nil
+			lines = append(lines, bytes.TrimSuffix(line, []byte("\r")))
+			data = data[i+1:]
+		}
+	}
+	if err == io.EOF {
+		return lines, true, nil
+	}
+	return lines, false, err
+}
+
+// flush adds the last line of a file that won't be written anymore, even
+// without its line ending
+func (f *file) flush(lines [][]byte) [][]byte {
+	if len(f.partial) > 0 {
+		lines = append(lines, f.partial)
+		f.partial = nil
+	}
+	return lines
+}
+
+func (f *file) close() {
+	f.f.Close()
+}
@@ -0,0 +1,5 @@
+module github.com/falcosecurity/plugins/shared/go/tail
+
+go 1.16
+
+require github.com/fsnotify/fsnotify v1.6.0
@@ -0,0 +1,285 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tail follows the log files matching a glob pattern, like tail -F,
+// for the plugins reading their events from files. The files are watched
+// with inotify, with a polling fallback on the file systems not supporting
+// it, and followed across their rotations, whether they are renamed or
+// truncated. The files created after the start are read from their
+// beginning, and the lines of all the files can be merged by timestamp.
+package tail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	DefaultPoll       time.Duration = time.Second // polling interval of the files
+	DefaultBufferSize uint64        = 200         // buffer size of the channel that transmits the lines to the plugin
+)
+
+// Options represents the options of the tailing
+type Options struct {
+	// FromStart reads the files existing at the start from their beginning,
+	// instead of only their new lines
+	FromStart bool
+	// Poll is the interval at which the files are checked for new lines
+	// when inotify is not available, and for new files in any case
+	Poll time.Duration
+	// BufferSize is the size of the channel of the lines
+	BufferSize uint64
+	// Timestamp returns the timestamp of a line, if any. When set, the
+	// lines of the blocks read from all the files at once are sent ordered
+	// by timestamp, which merges the files written concurrently.
+	Timestamp func(line []byte) (time.Time, bool)
+}
+
+func (options *Options) setDefault() {
+	if options.Poll == 0 {
+		options.Poll = DefaultPoll
+	}
+	if options.BufferSize == 0 {
+		options.BufferSize = DefaultBufferSize
+	}
+}
+
+// Line is a line of a file, without its line ending
+type Line struct {
+	File string
+	Data []byte
+	// Time is the timestamp of the line, if Options.Timestamp is set
+	Time time.Time
+}
+
+// Open follows the files matching the pattern until the context is done,
+// and sends their lines on the returned channel. The first error stops the
+// tailing and is sent on the error channel. Both channels are closed once
+// the tailing stops. The pattern is validated before anything is read.
+func Open(ctx context.Context, pattern string, options *Options) (chan *Line, chan error, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, nil, err
+	}
+	var opts Options
+	if options != nil {
+		opts = *options
+	}
+	opts.setDefault()
+
+	t := &tailer{
+		pattern: pattern,
+		options: opts,
+		files:   make(map[string]*file),
+	}
+	// inotify is optional, the files are polled without it
+	if w, err := fsnotify.NewWatcher(); err == nil {
+		t.watcher = w
+		t.watched = make(map[string]bool)
+	}
+
+	lineC := make(chan *Line, opts.BufferSize)
+	errC := make(chan error, 1)
+	go func() {
+		defer close(lineC)
+		defer close(errC)
+		defer t.close()
+		if err := t.run(ctx, lineC); err != nil && ctx.Err() == nil {
+			errC <- err
+		}
+	}()
+	return lineC, errC, nil
+}
+
+// tailer follows the files matching a pattern
+type tailer struct {
+	pattern string
+	options Options
+	files   map[string]*file
+	watcher *fsnotify.Watcher
+	watched map[string]bool // the directories watched with inotify
+	// done are the files already read to their end, which are only
+	// followed from their end if they match the pattern again after
+	// being renamed by a rotation
+	done []os.FileInfo
+}
+
+// maxDone is the number of files read to their end that are remembered
+const maxDone = 64
+
+// closedC is always ready to be received from
+var closedC = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+func (t *tailer) run(ctx context.Context, lineC chan<- *Line) error {
+	if err := t.scan(!t.options.FromStart); err != nil {
+		return err
+	}
+	var events chan fsnotify.Event
+	var errors chan error
+	poll := t.options.Poll
+	if t.watcher != nil {
+		events = t.watcher.Events
+		errors = t.watcher.Errors
+	}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		more, err := t.read(ctx, lineC)
+		if err != nil {
+			return err
+		}
+		// the files with more to read are read again right away, while
+		// still handling the new files
+		var next <-chan struct{}
+		if more {
+			next = closedC
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-next:
+		case ev := <-events:
+			if ev.Op&fsnotify.Create != 0 {
+				if err := t.scan(false); err != nil {
+					return err
+				}
+			}
+		case err := <-errors:
+			return err
+		case <-ticker.C:
+			if err := t.scan(false); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// scan starts following the new files matching the pattern, from their end
+// if atEnd is true, and watches their directories with inotify
+func (t *tailer) scan(atEnd bool) error {
+	paths, err := filepath.Glob(t.pattern)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if _, ok := t.files[path]; ok {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || t.following(info) {
+			continue
+		}
+		f, err := openFile(path, atEnd || t.isDone(info))
+		if err != nil {
+			// the file was removed or is a directory
+			continue
+		}
+		t.files[path] = f
+		if dir := filepath.Dir(path); t.watcher != nil && !t.watched[dir] {
+			if err := t.watcher.Add(dir); err == nil {
+				t.watched[dir] = true
+			}
+		}
+	}
+	return nil
+}
+
+// read sends the lines of the next block of each file, merged by timestamp
+// if requested, and stops following the files that were removed. It returns
+// true if any of the files has more to read right away.
+func (t *tailer) read(ctx context.Context, lineC chan<- *Line) (bool, error) {
+	var lines []*Line
+	more := false
+	for path, f := range t.files {
+		res, fmore, err := f.read()
+		if err != nil {
+			return false, err
+		}
+		more = more || fmore
+		if f.rotated != nil {
+			t.setDone(f.rotated)
+			f.rotated = nil
+		}
+		if f.removed {
+			t.setDone(f.info)
+			f.close()
+			delete(t.files, path)
+		}
+		for _, data := range res {
+			lines = append(lines, &Line{File: path, Data: data})
+		}
+	}
+	if t.options.Timestamp != nil {
+		for _, l := range lines {
+			l.Time, _ = t.options.Timestamp(l.Data)
+		}
+		sort.SliceStable(lines, func(i, j int) bool {
+			return lines[i].Time.Before(lines[j].Time)
+		})
+	}
+	for _, l := range lines {
+		select {
+		case lineC <- l:
+		case <-ctx.Done():
+			return false, nil
+		}
+	}
+	return more, nil
+}
+
+// following returns true if a file is already followed at another path
+func (t *tailer) following(info os.FileInfo) bool {
+	for _, f := range t.files {
+		if os.SameFile(f.info, info) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tailer) isDone(info os.FileInfo) bool {
+	for _, d := range t.done {
+		if os.SameFile(d, info) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tailer) setDone(info os.FileInfo) {
+	t.done = append(t.done, info)
+	if len(t.done) > maxDone {
+		t.done = t.done[1:]
+	}
+}
+
+func (t *tailer) close() {
+	if t.watcher != nil {
+		t.watcher.Close()
+	}
+	for _, f := range t.files {
+		f.close()
+	}
+}
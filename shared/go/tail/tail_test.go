@@ -0,0 +1,245 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tailDir follows the files matching pattern in a temporary directory
+func tailDir(t *testing.T, pattern string, options *Options) (string, chan *Line, func()) {
+	dir := t.TempDir()
+	if options == nil {
+		options = &Options{}
+	}
+	options.Poll = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	lineC, errC, err := Open(ctx, filepath.Join(dir, pattern), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, lineC, func() {
+		cancel()
+		for range lineC {
+		}
+		if err := <-errC; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// expectLines receives the given lines, then checks that no other line
+// follows them
+func expectLines(t *testing.T, lineC chan *Line, expected ...string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for _, e := range expected {
+		select {
+		case l := <-lineC:
+			if string(l.Data) != e {
+				t.Fatalf("expected line %q, got %q", e, l.Data)
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for line %q", e)
+		}
+	}
+	select {
+	case l := <-lineC:
+		t.Fatalf("unexpected line %q", l.Data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func appendFile(t *testing.T, path, content string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFromStart(t *testing.T) {
+	dir, lineC, stop := tailDir(t, "*.log", &Options{FromStart: true})
+	defer stop()
+	writeFile(t, filepath.Join(dir, "a.log"), "1\r\n2\n3")
+	expectLines(t, lineC, "1", "2")
+	appendFile(t, filepath.Join(dir, "a.log"), "\n4\n")
+	expectLines(t, lineC, "3", "4")
+}
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "old.log"), "old\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lineC, _, err := Open(ctx, filepath.Join(dir, "*.log"), &Options{Poll: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the existing files are followed from their end, and the new ones
+	// matching the pattern from their beginning
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, filepath.Join(dir, "old.log"), "appended\n")
+	expectLines(t, lineC, "appended")
+	writeFile(t, filepath.Join(dir, "other.txt"), "ignored\n")
+	writeFile(t, filepath.Join(dir, "new.log"), "new\n")
+	expectLines(t, lineC, "new")
+
+	if _, _, err := Open(ctx, "[", nil); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	dir, lineC, stop := tailDir(t, "a.log", &Options{FromStart: true})
+	defer stop()
+	path := filepath.Join(dir, "a.log")
+	writeFile(t, path, "1\n")
+	expectLines(t, lineC, "1")
+
+	// the rest of the renamed file is read, including its last line
+	// without line ending, then the new file from its beginning
+	appendFile(t, path, "2\n3")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "4\n")
+	expectLines(t, lineC, "2", "3", "4")
+}
+
+func TestRotationMatchingPattern(t *testing.T) {
+	dir, lineC, stop := tailDir(t, "a.log*", &Options{FromStart: true})
+	defer stop()
+	path := filepath.Join(dir, "a.log")
+	writeFile(t, path, "1\n")
+	expectLines(t, lineC, "1")
+
+	// the renamed file matching the pattern is not read again
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "2\n")
+	expectLines(t, lineC, "2")
+}
+
+func TestTruncation(t *testing.T) {
+	dir, lineC, stop := tailDir(t, "a.log", &Options{FromStart: true})
+	defer stop()
+	path := filepath.Join(dir, "a.log")
+	writeFile(t, path, "first\n")
+	expectLines(t, lineC, "first")
+
+	// smaller than the former content
+	writeFile(t, path, "2\n")
+	expectLines(t, lineC, "2")
+
+	// the size of the former content
+	time.Sleep(20 * time.Millisecond)
+	writeFile(t, path, "3\n")
+	expectLines(t, lineC, "3")
+}
+
+func TestTouch(t *testing.T) {
+	dir, lineC, stop := tailDir(t, "a.log", &Options{FromStart: true})
+	defer stop()
+	path := filepath.Join(dir, "a.log")
+	writeFile(t, path, "1\n")
+	expectLines(t, lineC, "1")
+
+	// a touched file is not read again
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	expectLines(t, lineC)
+	appendFile(t, path, "2\n")
+	expectLines(t, lineC, "2")
+}
+
+func TestLargeFile(t *testing.T) {
+	dir, lineC, stop := tailDir(t, "a.log", &Options{FromStart: true, BufferSize: 1})
+	defer stop()
+
+	// the file is read and sent by blocks, across several blocks
+	var lines []string
+	var sb strings.Builder
+	for i := 0; sb.Len() < 3*readSize; i++ {
+		line := fmt.Sprintf("line %d %s", i, strings.Repeat("x", 100))
+		lines = append(lines, line)
+		sb.WriteString(line + "\n")
+	}
+	writeFile(t, filepath.Join(dir, "a.log"), sb.String())
+	expectLines(t, lineC, lines...)
+}
+
+func TestFileReadBlocks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.log")
+	writeFile(t, path, strings.Repeat("x", readSize)+"\n")
+	f, err := openFile(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.close()
+
+	// a line spanning two blocks is returned with the second one
+	lines, more, err := f.read()
+	if err != nil || len(lines) != 0 || !more {
+		t.Fatalf("expected no line and more to read, got %d lines, %v, %v", len(lines), more, err)
+	}
+	lines, _, err = f.read()
+	if err != nil || len(lines) != 1 || len(lines[0]) != readSize {
+		t.Fatalf("expected a line of %d bytes, got %d lines (%v)", readSize, len(lines), err)
+	}
+}
+
+func TestMergeByTimestamp(t *testing.T) {
+	// the files exist at the start, so that their lines are read at once
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.log"), "2024-01-01T00:00:01Z\n2024-01-01T00:00:03Z\n")
+	writeFile(t, filepath.Join(dir, "b.log"), "2024-01-01T00:00:02Z\n2024-01-01T00:00:04Z\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lineC, _, err := Open(ctx, filepath.Join(dir, "*.log"), &Options{
+		FromStart: true,
+		Poll:      10 * time.Millisecond,
+		Timestamp: func(line []byte) (time.Time, bool) {
+			ts, err := time.Parse(time.RFC3339, string(line))
+			return ts, err == nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLines(t, lineC, "2024-01-01T00:00:01Z", "2024-01-01T00:00:02Z", "2024-01-01T00:00:03Z", "2024-01-01T00:00:04Z")
+}
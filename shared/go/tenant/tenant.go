@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tenant provides the multi-tenant open parameters of the plugins
+// polling SaaS APIs, so that a single instance reads the events of several
+// organizations, each with its own credentials, rather than running an
+// instance per organization.
+//
+// The tenants are given to the open params as a JSON array of objects, each
+// with a unique name and the settings of the plugin for the tenant, e.g.
+// [{"name":"acme","api_token":"..."}]. The events of the tenants are
+// multiplexed in the event source, with the name of their tenant added to
+// their JSON under Key.
+package tenant
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Key is the property of the events holding the name of their tenant
+const Key = "tenant"
+
+// IsList returns true if the open params are a list of tenants
+func IsList(params string) bool {
+	return strings.HasPrefix(strings.TrimSpace(params), "[")
+}
+
+// Parse decodes the list of tenants of the open params into v, a pointer to
+// a slice of the struct holding the settings of a tenant. Each of the
+// tenants must have a unique and non-empty name.
+func Parse(params string, v interface{}) error {
+	var names []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(params), &names); err != nil {
+		return fmt.Errorf("invalid list of tenants: %s", err.Error())
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("invalid list of tenants: no tenant given")
+	}
+	seen := map[string]bool{}
+	for i, n := range names {
+		if n.Name == "" {
+			return fmt.Errorf("invalid list of tenants: missing name of tenant %d", i)
+		}
+		if seen[n.Name] {
+			return fmt.Errorf("invalid list of tenants: duplicate tenant %s", n.Name)
+		}
+		seen[n.Name] = true
+	}
+	if err := json.Unmarshal([]byte(params), v); err != nil {
+		return fmt.Errorf("invalid list of tenants: %s", err.Error())
+	}
+	return nil
+}
+
+// Embed returns a copy of the JSON object of an event with the name of its
+// tenant added under Key
+func Embed(data []byte, name string) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) < 2 || data[0] != '{' || data[len(data)-1] != '}' {
+		return nil, fmt.Errorf("event of tenant %s is not a JSON object", name)
+	}
+	value, err := json.Marshal(name)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]byte, 0, len(data)+len(Key)+len(value)+4)
+	res = append(res, data[:len(data)-1]...)
+	if len(bytes.TrimSpace(data[1:len(data)-1])) > 0 {
+		res = append(res, ',')
+	}
+	res = append(res, '"')
+	res = append(res, Key...)
+	res = append(res, '"', ':')
+	res = append(res, value...)
+	return append(res, '}'), nil
+}
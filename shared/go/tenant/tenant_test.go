@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tenant
+
+import (
+	"strings"
+	"testing"
+)
+
+type testTenant struct {
+	Name     string `json:"name"`
+	APIToken string `json:"api_token"`
+}
+
+func TestIsList(t *testing.T) {
+	tests := map[string]bool{
+		`[{"name":"a"}]`:   true,
+		"\n  [":            true,
+		`{"api_token":""}`: false,
+		"":                 false,
+		"a=b":              false,
+	}
+	for params, expected := range tests {
+		if res := IsList(params); res != expected {
+			t.Errorf("%q: expected %v, got %v", params, expected, res)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	var tenants []testTenant
+	err := Parse(`[{"name":"acme","api_token":"a"},{"name":"other","api_token":"b"}]`, &tenants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tenants) != 2 || tenants[0] != (testTenant{"acme", "a"}) || tenants[1] != (testTenant{"other", "b"}) {
+		t.Errorf("unexpected tenants %+v", tenants)
+	}
+
+	tests := map[string]string{
+		`[]`:                           "no tenant given",
+		`[{"api_token":"a"}]`:          "missing name of tenant 0",
+		`[{"name":"a"},{"name":""}]`:   "missing name of tenant 1",
+		`[{"name":"a"},{"name":"a"}]`:  "duplicate tenant a",
+		`[{"name":1}]`:                 "cannot unmarshal",
+		`[{"name":"a","api_token":1}]`: "cannot unmarshal",
+		`{"name":"a"}`:                 "cannot unmarshal",
+		`[`:                            "unexpected end",
+	}
+	for params, expected := range tests {
+		var tenants []testTenant
+		err := Parse(params, &tenants)
+		if err == nil || !strings.HasPrefix(err.Error(), "invalid list of tenants: ") || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", params, expected, err)
+		}
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected string
+	}{
+		{`{"a":1}`, `{"a":1,"tenant":"acme"}`},
+		{` {"a":{"b":2}} `, `{"a":{"b":2},"tenant":"acme"}`},
+		{`{}`, `{"tenant":"acme"}`},
+		{`{ }`, `{ "tenant":"acme"}`},
+	}
+	for _, test := range tests {
+		res, err := Embed([]byte(test.data), "acme")
+		if err != nil || string(res) != test.expected {
+			t.Errorf("%s: expected %s, got %s (%v)", test.data, test.expected, res, err)
+		}
+	}
+
+	// the name is escaped
+	res, err := Embed([]byte(`{}`), `a"b`)
+	if err != nil || string(res) != `{"tenant":"a\"b"}` {
+		t.Errorf("expected the escaped name, got %s (%v)", res, err)
+	}
+
+	for _, data := range []string{``, `{`, `[1]`, `"a"`, `1`} {
+		if _, err := Embed([]byte(data), "acme"); err == nil {
+			t.Errorf("%s: expected an error embedding the tenant", data)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cloudevents decodes the webhook messages wrapped in CloudEvents 1.0
+// envelopes, see https://github.com/cloudevents/spec, so that the push-based
+// plugins can receive their native payloads from an event mesh. The binary,
+// structured and batched content modes of the HTTP protocol binding are
+// supported. The attributes of the envelope are embedded in the JSON of the
+// events, from which they are extracted as the ce.* fields shared by all the
+// plugins.
+package cloudevents
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	// SpecVersion is the version of the CloudEvents specification supported
+	SpecVersion = "1.0"
+	// Key is the key of the envelope embedded in the JSON of the events
+	Key = "cloudevent"
+
+	headerPrefix      = "Ce-"
+	structuredType    = "application/cloudevents+json"
+	batchType         = "application/cloudevents-batch+json"
+	specVersionAttr   = "specversion"
+	dataAttr          = "data"
+	dataBase64Attr    = "data_base64"
+	contentTypeAttr   = "datacontenttype"
+	contentTypeHeader = "Content-Type"
+)
+
+// Envelope holds the context attributes of a CloudEvent
+type Envelope struct {
+	SpecVersion     string            `json:"specversion"`
+	ID              string            `json:"id"`
+	Source          string            `json:"source"`
+	Type            string            `json:"type"`
+	Subject         string            `json:"subject,omitempty"`
+	Time            string            `json:"time,omitempty"`
+	DataContentType string            `json:"datacontenttype,omitempty"`
+	DataSchema      string            `json:"dataschema,omitempty"`
+	Extensions      map[string]string `json:"extensions,omitempty"`
+}
+
+// Message is a payload received by a webhook, along with the envelope it
+// was wrapped in, if any
+type Message struct {
+	Envelope *Envelope
+	Data     []byte
+}
+
+// IsCloudEvent returns true if a request carries CloudEvents, in any of the
+// content modes
+func IsCloudEvent(r *http.Request) bool {
+	if r.Header.Get(headerPrefix+specVersionAttr) != "" {
+		return true
+	}
+	switch mediaType(r.Header.Get(contentTypeHeader)) {
+	case structuredType, batchType:
+		return true
+	}
+	return false
+}
+
+// Decode returns the messages carried by the body of a webhook request. A
+// request not carrying CloudEvents gives a single message with a nil
+// envelope and the body as data.
+func Decode(r *http.Request, body []byte) ([]Message, error) {
+	if r.Header.Get(headerPrefix+specVersionAttr) != "" {
+		e, err := decodeBinary(r.Header)
+		if err != nil {
+			return nil, err
+		}
+		return []Message{{Envelope: e, Data: body}}, nil
+	}
+	switch mediaType(r.Header.Get(contentTypeHeader)) {
+	case structuredType:
+		m, err := decodeStructured(body)
+		if err != nil {
+			return nil, err
+		}
+		return []Message{m}, nil
+	case batchType:
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return nil, fmt.Errorf("invalid cloudevents batch: %s", err.Error())
+		}
+		res := make([]Message, 0, len(batch))
+		for _, b := range batch {
+			m, err := decodeStructured(b)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, m)
+		}
+		return res, nil
+	}
+	return []Message{{Data: body}}, nil
+}
+
+// Payloads returns the payloads carried by the body of a webhook request,
+// which are the data of its messages with their envelopes embedded
+func Payloads(r *http.Request, body []byte) ([][]byte, error) {
+	msgs, err := Decode(r, body)
+	if err != nil {
+		return nil, err
+	}
+	res := make([][]byte, 0, len(msgs))
+	for _, m := range msgs {
+		data, err := Embed(m.Data, m.Envelope)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, data)
+	}
+	return res, nil
+}
+
+// decodeBinary reads the attributes of a CloudEvent in binary content mode
+// from the ce-* headers of a request
+func decodeBinary(h http.Header) (*Envelope, error) {
+	attrs := map[string]string{}
+	for name, values := range h {
+		if len(values) == 0 || !strings.HasPrefix(http.CanonicalHeaderKey(name), headerPrefix) {
+			continue
+		}
+		// header values are percent-encoded by the HTTP binding
+		v, err := url.PathUnescape(values[0])
+		if err != nil {
+			v = values[0]
+		}
+		attrs[strings.ToLower(name[len(headerPrefix):])] = v
+	}
+	if ct := h.Get(contentTypeHeader); ct != "" {
+		attrs[contentTypeAttr] = ct
+	}
+	return newEnvelope(attrs)
+}
+
+// decodeStructured reads a CloudEvent in structured content mode, in which
+// the attributes and the data are members of a JSON object
+func decodeStructured(b []byte) (Message, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return Message{}, fmt.Errorf("invalid cloudevent: %s", err.Error())
+	}
+	attrs := map[string]string{}
+	for name, raw := range obj {
+		if name == dataAttr || name == dataBase64Attr {
+			continue
+		}
+		var s string
+		if json.Unmarshal(raw, &s) != nil {
+			// extension attributes can be of other JSON types
+			s = string(raw)
+		}
+		attrs[name] = s
+	}
+	e, err := newEnvelope(attrs)
+	if err != nil {
+		return Message{}, err
+	}
+
+	m := Message{Envelope: e}
+	if raw, ok := obj[dataBase64Attr]; ok {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return Message{}, fmt.Errorf("invalid cloudevent data_base64: %s", err.Error())
+		}
+		if m.Data, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return Message{}, fmt.Errorf("invalid cloudevent data_base64: %s", err.Error())
+		}
+	} else if raw, ok := obj[dataAttr]; ok {
+		m.Data = raw
+		// the data of other media types is encoded as a JSON string
+		var s string
+		if !isJSON(e.DataContentType) && json.Unmarshal(raw, &s) == nil {
+			m.Data = []byte(s)
+		}
+	}
+	return m, nil
+}
+
+// newEnvelope returns the envelope of the given attributes, and checks the
+// ones required by the specification
+func newEnvelope(attrs map[string]string) (*Envelope, error) {
+	e := &Envelope{}
+	for name, v := range attrs {
+		switch name {
+		case specVersionAttr:
+			e.SpecVersion = v
+		case "id":
+			e.ID = v
+		case "source":
+			e.Source = v
+		case "type":
+			e.Type = v
+		case "subject":
+			e.Subject = v
+		case "time":
+			e.Time = v
+		case contentTypeAttr:
+			e.DataContentType = v
+		case "dataschema":
+			e.DataSchema = v
+		default:
+			if e.Extensions == nil {
+				e.Extensions = map[string]string{}
+			}
+			e.Extensions[name] = v
+		}
+	}
+	if e.SpecVersion != SpecVersion {
+		return nil, fmt.Errorf("unsupported cloudevents specversion %q, must be %s", e.SpecVersion, SpecVersion)
+	}
+	var missing []string
+	for name, v := range map[string]string{"id": e.ID, "source": e.Source, "type": e.Type} {
+		if v == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("cloudevent is missing required attributes: %s", strings.Join(missing, ", "))
+	}
+	return e, nil
+}
+
+// Embed returns a copy of the JSON object of an event with the envelope
+// added under Key. A nil envelope returns the data as it is.
+func Embed(data []byte, e *Envelope) ([]byte, error) {
+	if e == nil {
+		return data, nil
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) < 2 || data[0] != '{' || data[len(data)-1] != '}' {
+		return nil, fmt.Errorf("cloudevent data is not a JSON object")
+	}
+	env, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]byte, 0, len(data)+len(Key)+len(env)+4)
+	res = append(res, data[:len(data)-1]...)
+	if len(bytes.TrimSpace(data[1:len(data)-1])) > 0 {
+		res = append(res, ',')
+	}
+	res = append(res, '"')
+	res = append(res, Key...)
+	res = append(res, '"', ':')
+	res = append(res, env...)
+	return append(res, '}'), nil
+}
+
+func mediaType(contentType string) string {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return t
+}
+
+// isJSON returns true if the data of the given content type is JSON, which
+// is the default when the content type is not set
+func isJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	t := mediaType(contentType)
+	return t == "application/json" || t == "text/json" || strings.HasSuffix(t, "+json")
+}
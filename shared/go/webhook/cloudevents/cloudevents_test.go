@@ -0,0 +1,305 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudevents
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/valyala/fastjson"
+)
+
+type testExtractRequest struct {
+	field  string
+	argKey string
+	value  interface{}
+	set    bool
+}
+
+func (t *testExtractRequest) FieldID() uint64 {
+	return 0
+}
+
+func (t *testExtractRequest) FieldType() uint32 {
+	return 0
+}
+
+func (t *testExtractRequest) Field() string {
+	return t.field
+}
+
+func (t *testExtractRequest) ArgKey() string {
+	return t.argKey
+}
+
+func (t *testExtractRequest) ArgIndex() uint64 {
+	return 0
+}
+
+func (t *testExtractRequest) ArgPresent() bool {
+	return len(t.argKey) > 0
+}
+
+func (t *testExtractRequest) IsList() bool {
+	return false
+}
+
+func (t *testExtractRequest) SetValue(v interface{}) {
+	t.value = v
+	t.set = true
+}
+
+func (t *testExtractRequest) SetPtr(unsafe.Pointer) {
+	// do nothing
+}
+
+var testEnvelope = &Envelope{SpecVersion: "1.0", ID: "1", Source: "mesh", Type: "test"}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   []string
+		body     string
+		event    bool
+		expected []Message
+	}{
+		{
+			name:     "plain",
+			header:   []string{"Content-Type", "application/json"},
+			body:     `{"a":1}`,
+			expected: []Message{{Data: []byte(`{"a":1}`)}},
+		},
+		{
+			name: "binary",
+			header: []string{"Ce-Specversion", "1.0", "Ce-Id", "1", "Ce-Source", "mesh", "Ce-Type", "test",
+				"Ce-Subject", "a%20b", "Ce-Traceparent", "00-1", "Ce-Invalid", "%zz", "Content-Type", "application/json"},
+			body:  `{"a":1}`,
+			event: true,
+			expected: []Message{{
+				Envelope: &Envelope{SpecVersion: "1.0", ID: "1", Source: "mesh", Type: "test", Subject: "a b", DataContentType: "application/json",
+					Extensions: map[string]string{"traceparent": "00-1", "invalid": "%zz"}},
+				Data: []byte(`{"a":1}`),
+			}},
+		},
+		{
+			name:     "structured",
+			header:   []string{"Content-Type", "application/cloudevents+json; charset=utf-8"},
+			body:     `{"specversion":"1.0","id":"1","source":"mesh","type":"test","time":"2024-01-01T00:00:00Z","data":{"a":1}}`,
+			event:    true,
+			expected: []Message{{Envelope: &Envelope{SpecVersion: "1.0", ID: "1", Source: "mesh", Type: "test", Time: "2024-01-01T00:00:00Z"}, Data: []byte(`{"a":1}`)}},
+		},
+		{
+			name:   "structured with extensions",
+			header: []string{"Content-Type", "application/cloudevents+json"},
+			body:   `{"specversion":"1.0","id":"1","source":"mesh","type":"test","dataschema":"s","seq":2,"flag":true}`,
+			event:  true,
+			expected: []Message{{Envelope: &Envelope{SpecVersion: "1.0", ID: "1", Source: "mesh", Type: "test", DataSchema: "s",
+				Extensions: map[string]string{"seq": "2", "flag": "true"}}}},
+		},
+		{
+			name:   "structured text data",
+			header: []string{"Content-Type", "application/cloudevents+json"},
+			body:   `{"specversion":"1.0","id":"1","source":"mesh","type":"test","datacontenttype":"text/plain","data":"a\nb"}`,
+			event:  true,
+			expected: []Message{{Envelope: &Envelope{SpecVersion: "1.0", ID: "1", Source: "mesh", Type: "test", DataContentType: "text/plain"},
+				Data: []byte("a\nb")}},
+		},
+		{
+			name:   "structured json string data",
+			header: []string{"Content-Type", "application/cloudevents+json"},
+			body:   `{"specversion":"1.0","id":"1","source":"mesh","type":"test","datacontenttype":"application/vnd+json","data":"a"}`,
+			event:  true,
+			expected: []Message{{Envelope: &Envelope{SpecVersion: "1.0", ID: "1", Source: "mesh", Type: "test", DataContentType: "application/vnd+json"},
+				Data: []byte(`"a"`)}},
+		},
+		{
+			name:     "structured base64 data",
+			header:   []string{"Content-Type", "application/cloudevents+json"},
+			body:     `{"specversion":"1.0","id":"1","source":"mesh","type":"test","data_base64":"eyJhIjoxfQ=="}`,
+			event:    true,
+			expected: []Message{{Envelope: testEnvelope, Data: []byte(`{"a":1}`)}},
+		},
+		{
+			name:   "batch",
+			header: []string{"Content-Type", "application/cloudevents-batch+json"},
+			body: `[{"specversion":"1.0","id":"1","source":"mesh","type":"test","data":{"a":1}},` +
+				`{"specversion":"1.0","id":"2","source":"mesh","type":"test","data":{"a":2}}]`,
+			event: true,
+			expected: []Message{
+				{Envelope: testEnvelope, Data: []byte(`{"a":1}`)},
+				{Envelope: &Envelope{SpecVersion: "1.0", ID: "2", Source: "mesh", Type: "test"}, Data: []byte(`{"a":2}`)},
+			},
+		},
+		{
+			name:     "empty batch",
+			header:   []string{"Content-Type", "application/cloudevents-batch+json"},
+			body:     `[]`,
+			event:    true,
+			expected: []Message{},
+		},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+		for i := 0; i+1 < len(test.header); i += 2 {
+			req.Header.Set(test.header[i], test.header[i+1])
+		}
+		if IsCloudEvent(req) != test.event {
+			t.Errorf("%s: expected IsCloudEvent to be %v", test.name, test.event)
+		}
+		msgs, err := Decode(req, []byte(test.body))
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(msgs, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, msgs)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   []string
+		body     string
+		expected string
+	}{
+		{"binary version", []string{"Ce-Specversion", "0.3", "Ce-Id", "1", "Ce-Source", "s", "Ce-Type", "t"}, `{}`, `unsupported cloudevents specversion "0.3"`},
+		{"binary missing", []string{"Ce-Specversion", "1.0", "Ce-Source", "s"}, `{}`, "missing required attributes: id, type"},
+		{"structured json", []string{"Content-Type", structuredType}, `{`, "invalid cloudevent"},
+		{"structured missing", []string{"Content-Type", structuredType}, `{"specversion":"1.0"}`, "missing required attributes: id, source, type"},
+		{"structured base64", []string{"Content-Type", structuredType}, `{"specversion":"1.0","id":"1","source":"s","type":"t","data_base64":"!"}`, "invalid cloudevent data_base64"},
+		{"structured base64 type", []string{"Content-Type", structuredType}, `{"specversion":"1.0","id":"1","source":"s","type":"t","data_base64":1}`, "invalid cloudevent data_base64"},
+		{"batch json", []string{"Content-Type", batchType}, `{}`, "invalid cloudevents batch"},
+		{"batch event", []string{"Content-Type", batchType}, `[{"specversion":"1.0","id":"1","source":"s","type":"t"},{}]`, "unsupported cloudevents specversion"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+		for i := 0; i+1 < len(test.header); i += 2 {
+			req.Header.Set(test.header[i], test.header[i+1])
+		}
+		_, err := Decode(req, []byte(test.body))
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	env := `"cloudevent":{"specversion":"1.0","id":"1","source":"mesh","type":"test"}`
+	tests := []struct {
+		data     string
+		expected string
+	}{
+		{`{"a":1}`, `{"a":1,` + env + `}`},
+		{` {} `, `{` + env + `}`},
+	}
+	for _, test := range tests {
+		res, err := Embed([]byte(test.data), testEnvelope)
+		if err != nil || string(res) != test.expected {
+			t.Errorf("%s: expected %s, got %s (%v)", test.data, test.expected, res, err)
+		}
+	}
+	if res, err := Embed([]byte("not json"), nil); err != nil || string(res) != "not json" {
+		t.Errorf("expected the data without envelope to be unchanged, got %s (%v)", res, err)
+	}
+	for _, data := range []string{"", "[1]", "a", "{"} {
+		if _, err := Embed([]byte(data), testEnvelope); err == nil {
+			t.Errorf("%q: expected an error embedding the envelope", data)
+		}
+	}
+}
+
+func TestPayloads(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("Content-Type", batchType)
+	body := `[{"specversion":"1.0","id":"1","source":"mesh","type":"test","data":{"a":1}},` +
+		`{"specversion":"1.0","id":"1","source":"mesh","type":"test","data":{"a":2}}]`
+	payloads, err := Payloads(req, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := `"cloudevent":{"specversion":"1.0","id":"1","source":"mesh","type":"test"}`
+	if len(payloads) != 2 || string(payloads[0]) != `{"a":1,`+env+`}` || string(payloads[1]) != `{"a":2,`+env+`}` {
+		t.Errorf("unexpected payloads %q", payloads)
+	}
+
+	// the request is rejected if any of its events isn't an object
+	body = `[{"specversion":"1.0","id":"1","source":"mesh","type":"test","data":{"a":1}},` +
+		`{"specversion":"1.0","id":"1","source":"mesh","type":"test","data":[1]}]`
+	if _, err := Payloads(req, []byte(body)); err == nil {
+		t.Error("expected an error with an event that isn't an object")
+	}
+
+	// the plain requests are passed as they are
+	req = httptest.NewRequest("POST", "/", nil)
+	if payloads, err := Payloads(req, []byte("raw")); err != nil || len(payloads) != 1 || string(payloads[0]) != "raw" {
+		t.Errorf("expected the raw payload, got %q (%v)", payloads, err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	names := map[string]bool{}
+	for _, f := range Fields() {
+		if !IsField(f.Name) {
+			t.Errorf("expected %s to be a field of the envelopes", f.Name)
+		}
+		names[f.Name] = true
+	}
+	if IsField("okta.uuid") {
+		t.Error("expected okta.uuid not to be a field of the envelopes")
+	}
+
+	data := `{"a":1,"cloudevent":{"specversion":"1.0","id":"1","source":"mesh","type":"test","subject":"s","extensions":{"traceparent":"00-1"}}}`
+	jdata := fastjson.MustParse(data)
+	tests := []struct {
+		field    string
+		argKey   string
+		expected interface{}
+	}{
+		{"ce.specversion", "", "1.0"},
+		{"ce.id", "", "1"},
+		{"ce.source", "", "mesh"},
+		{"ce.type", "", "test"},
+		{"ce.subject", "", "s"},
+		{"ce.time", "", nil},
+		{"ce.extension", "traceparent", "00-1"},
+		{"ce.extension", "missing", nil},
+	}
+	for _, test := range tests {
+		if !names[test.field] {
+			t.Errorf("%s: expected a field entry", test.field)
+		}
+		req := &testExtractRequest{field: test.field, argKey: test.argKey}
+		if err := Extract(req, jdata); err != nil {
+			t.Errorf("%s: unexpected error %s", test.field, err)
+		}
+		if req.value != test.expected {
+			t.Errorf("%s[%s]: expected %v, got %v", test.field, test.argKey, test.expected, req.value)
+		}
+	}
+
+	// nothing is extracted from the events received without envelope
+	req := &testExtractRequest{field: "ce.id"}
+	if err := Extract(req, fastjson.MustParse(`{"a":1}`)); err != nil || req.set {
+		t.Errorf("expected no value, got %v (%v)", req.value, err)
+	}
+}
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudevents
+
+import (
+	"strings"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+	"github.com/valyala/fastjson"
+)
+
+// FieldPrefix is the prefix of the fields of the envelopes
+const FieldPrefix = "ce."
+
+// Fields returns the fields extracted from the envelopes, to be added to
+// the fields of a plugin
+func Fields() []sdk.FieldEntry {
+	return []sdk.FieldEntry{
+		{Type: "string", Name: "ce.specversion", Display: "CloudEvents Spec Version", Desc: "The CloudEvents specification version of the envelope the event was received in. The ce.* fields are not available for the events not received as CloudEvents."},
+		{Type: "string", Name: "ce.id", Display: "CloudEvent ID", Desc: "The id attribute of the CloudEvents envelope."},
+		{Type: "string", Name: "ce.source", Display: "CloudEvent Source", Desc: "The source attribute of the CloudEvents envelope."},
+		{Type: "string", Name: "ce.type", Display: "CloudEvent Type", Desc: "The type attribute of the CloudEvents envelope."},
+		{Type: "string", Name: "ce.subject", Display: "CloudEvent Subject", Desc: "The subject attribute of the CloudEvents envelope."},
+		{Type: "string", Name: "ce.time", Display: "CloudEvent Time", Desc: "The time attribute of the CloudEvents envelope."},
+		{Type: "string", Name: "ce.datacontenttype", Display: "CloudEvent Data Content Type", Desc: "The datacontenttype attribute of the CloudEvents envelope."},
+		{Type: "string", Name: "ce.dataschema", Display: "CloudEvent Data Schema", Desc: "The dataschema attribute of the CloudEvents envelope."},
+		{
+			Type:    "string",
+			Name:    "ce.extension",
+			Display: "CloudEvent Extension",
+			Desc:    "The value of an extension attribute of the CloudEvents envelope (e.g. ce.extension[traceparent]).",
+			Arg:     sdk.FieldEntryArg{IsRequired: true, IsKey: true},
+		},
+	}
+}
+
+// IsField returns true if a field is one of the fields of the envelopes
+func IsField(name string) bool {
+	return strings.HasPrefix(name, FieldPrefix)
+}
+
+// Extract extracts a field of the envelope embedded in the JSON of an
+// event. Nothing is extracted from the events that were not received as
+// CloudEvents.
+func Extract(req sdk.ExtractRequest, jdata *fastjson.Value) error {
+	env := jdata.Get(Key)
+	if env == nil {
+		return nil
+	}
+	var v *fastjson.Value
+	if req.Field() == "ce.extension" {
+		v = env.Get("extensions", req.ArgKey())
+	} else {
+		v = env.Get(strings.TrimPrefix(req.Field(), FieldPrefix))
+	}
+	if v != nil && v.Type() == fastjson.TypeString {
+		req.SetValue(string(v.GetStringBytes()))
+	}
+	return nil
+}
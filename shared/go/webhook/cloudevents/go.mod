@@ -0,0 +1,8 @@
+module github.com/falcosecurity/plugins/shared/go/webhook/cloudevents
+
+go 1.15
+
+require (
+	github.com/falcosecurity/plugin-sdk-go v0.7.3
+	github.com/valyala/fastjson v1.6.4
+)
@@ -0,0 +1,3 @@
+module github.com/falcosecurity/plugins/shared/go/webhook/queue
+
+go 1.15
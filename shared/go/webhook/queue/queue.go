@@ -0,0 +1,224 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package queue provides the bounded queue used by the webhook receivers of
+// the push-based plugins, between the HTTP handlers and the event source.
+// When the queue is full, for example because Falco consumes the events
+// slower than they are received, an overflow policy decides whether the
+// receiver waits, drops the oldest payloads or rejects the new ones.
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Policy is the behavior of a Queue when it's full
+type Policy string
+
+const (
+	// PolicyBlock waits until there is room in the queue
+	PolicyBlock Policy = "block"
+	// PolicyDropOldest drops the oldest payload of the queue to make room
+	PolicyDropOldest Policy = "drop_oldest"
+	// PolicyReject rejects the new payload, which is expected to be
+	// answered with a 429 Too Many Requests status
+	PolicyReject Policy = "reject"
+)
+
+// ParsePolicy returns the Policy with the given name, an empty name
+// being the default PolicyBlock
+func ParsePolicy(name string) (Policy, error) {
+	switch p := Policy(name); p {
+	case "":
+		return PolicyBlock, nil
+	case PolicyBlock, PolicyDropOldest, PolicyReject:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown overflow policy %q, must be one of %s, %s or %s", name, PolicyBlock, PolicyDropOldest, PolicyReject)
+}
+
+// Stats is a snapshot of the state of a Queue
+type Stats struct {
+	Depth    int
+	Capacity int
+	Dropped  uint64
+	Rejected uint64
+}
+
+// Queue is a bounded queue of payloads
+type Queue struct {
+	ch       chan []byte
+	policy   Policy
+	mu       sync.Mutex
+	done     chan struct{}
+	once     sync.Once
+	dropped  uint64
+	rejected uint64
+}
+
+// New returns a Queue holding up to size payloads, which must be at least 1
+// for PolicyDropOldest to make room in a full queue
+func New(size int, policy Policy) *Queue {
+	return &Queue{
+		ch:     make(chan []byte, size),
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+}
+
+// Push adds a payload to the queue following its overflow policy. It
+// returns false if the payload was rejected or if the queue is closed.
+func (q *Queue) Push(b []byte) bool {
+	if q.policy == PolicyBlock {
+		return q.Put(b)
+	}
+	// producers are serialized so that a payload made room for, or the
+	// room checked for by PushAll, can't be taken by another producer
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.push(b)
+}
+
+// PushAll adds the payloads of a single request to the queue following
+// its overflow policy, either all of them or none. With PolicyReject, the
+// payloads are all rejected unless there is room for every one of them,
+// so that a request answered with 429 can be retried without duplicating
+// the payloads already queued. It returns false if the payloads were
+// rejected or if the queue is closed.
+func (q *Queue) PushAll(bs [][]byte) bool {
+	if q.policy == PolicyBlock {
+		for _, b := range bs {
+			if !q.Put(b) {
+				return false
+			}
+		}
+		return true
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// the consumers can only make more room while the lock is held
+	if q.policy == PolicyReject && cap(q.ch)-len(q.ch) < len(bs) {
+		atomic.AddUint64(&q.rejected, uint64(len(bs)))
+		return false
+	}
+	for _, b := range bs {
+		if !q.push(b) {
+			return false
+		}
+	}
+	return true
+}
+
+// push adds a payload to the queue with PolicyReject or PolicyDropOldest,
+// with the producers lock held
+func (q *Queue) push(b []byte) bool {
+	switch q.policy {
+	case PolicyReject:
+		select {
+		case <-q.done:
+			return false
+		case q.ch <- b:
+			return true
+		default:
+			atomic.AddUint64(&q.rejected, 1)
+			return false
+		}
+	case PolicyDropOldest:
+		for {
+			select {
+			case <-q.done:
+				return false
+			case q.ch <- b:
+				return true
+			default:
+			}
+			select {
+			case <-q.ch:
+				atomic.AddUint64(&q.dropped, 1)
+			default:
+			}
+		}
+	}
+	return q.Put(b)
+}
+
+// Put adds a payload to the queue waiting until there is room regardless
+// of the overflow policy. The payload can still be dropped by a later Push
+// with PolicyDropOldest, so the messages that must not be lost, such as
+// errors, are better sent apart. It returns false if the queue is closed.
+func (q *Queue) Put(b []byte) bool {
+	select {
+	case <-q.done:
+		return false
+	case q.ch <- b:
+		return true
+	}
+}
+
+// C returns the channel to receive the payloads from
+func (q *Queue) C() <-chan []byte {
+	return q.ch
+}
+
+// Done returns a channel that is closed when the queue is closed
+func (q *Queue) Done() <-chan struct{} {
+	return q.done
+}
+
+// Close closes the queue, making all the pending and future calls to Push
+// and Put return false. It can be called more than once.
+func (q *Queue) Close() {
+	q.once.Do(func() { close(q.done) })
+}
+
+// Stats returns the current depth and counters of the queue
+func (q *Queue) Stats() Stats {
+	return Stats{
+		Depth:    len(q.ch),
+		Capacity: cap(q.ch),
+		Dropped:  atomic.LoadUint64(&q.dropped),
+		Rejected: atomic.LoadUint64(&q.rejected),
+	}
+}
+
+// Report logs the stats of the queue every interval until the context is
+// done, only when payloads have been dropped or rejected since the last
+// report so that a healthy queue stays silent
+func (q *Queue) Report(ctx context.Context, interval time.Duration, logf func(format string, v ...interface{})) {
+	var last Stats
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.done:
+			return
+		case <-ticker.C:
+			s := q.Stats()
+			if s.Dropped != last.Dropped || s.Rejected != last.Rejected {
+				logf("webhook queue overflow: depth=%d/%d dropped=%d (+%d) rejected=%d (+%d)",
+					s.Depth, s.Capacity, s.Dropped, s.Dropped-last.Dropped, s.Rejected, s.Rejected-last.Rejected)
+			}
+			last = s
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// drain returns the payloads waiting in the queue
+func drain(q *Queue) []string {
+	var res []string
+	for {
+		select {
+		case b := <-q.C():
+			res = append(res, string(b))
+		default:
+			return res
+		}
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := map[string]Policy{
+		"":            PolicyBlock,
+		"block":       PolicyBlock,
+		"drop_oldest": PolicyDropOldest,
+		"reject":      PolicyReject,
+	}
+	for name, expected := range tests {
+		if p, err := ParsePolicy(name); err != nil || p != expected {
+			t.Errorf("%q: expected %s, got %s (%v)", name, expected, p, err)
+		}
+	}
+	if _, err := ParsePolicy("drop"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestPolicyBlock(t *testing.T) {
+	q := New(1, PolicyBlock)
+	if !q.Push([]byte("a")) {
+		t.Fatal("expected the payload to be pushed")
+	}
+
+	// the producer waits for room
+	res := make(chan bool)
+	go func() { res <- q.Push([]byte("b")) }()
+	select {
+	case <-res:
+		t.Fatal("expected the push to wait for room")
+	case <-time.After(20 * time.Millisecond):
+	}
+	<-q.C()
+	if ok := <-res; !ok {
+		t.Fatal("expected the payload to be pushed once there is room")
+	}
+	if p := strings.Join(drain(q), ","); p != "b" {
+		t.Errorf("expected the second payload, got %s", p)
+	}
+}
+
+func TestPolicyDropOldest(t *testing.T) {
+	q := New(2, PolicyDropOldest)
+	for _, p := range []string{"a", "b", "c", "d"} {
+		if !q.Push([]byte(p)) {
+			t.Fatalf("expected %s to be pushed", p)
+		}
+	}
+	if p := strings.Join(drain(q), ","); p != "c,d" {
+		t.Errorf("expected the newest payloads, got %s", p)
+	}
+	if s := q.Stats(); s.Dropped != 2 || s.Rejected != 0 {
+		t.Errorf("expected 2 dropped payloads, got %+v", s)
+	}
+}
+
+func TestPolicyReject(t *testing.T) {
+	q := New(2, PolicyReject)
+	for i, p := range []string{"a", "b", "c", "d"} {
+		if ok := q.Push([]byte(p)); ok != (i < 2) {
+			t.Fatalf("unexpected result pushing %s: %v", p, ok)
+		}
+	}
+	if p := strings.Join(drain(q), ","); p != "a,b" {
+		t.Errorf("expected the oldest payloads, got %s", p)
+	}
+	if s := q.Stats(); s.Dropped != 0 || s.Rejected != 2 || s.Capacity != 2 {
+		t.Errorf("expected 2 rejected payloads, got %+v", s)
+	}
+}
+
+func TestPushAll(t *testing.T) {
+	// the payloads are rejected together if there is no room for all
+	q := New(3, PolicyReject)
+	if !q.PushAll([][]byte{[]byte("a"), []byte("b")}) {
+		t.Fatal("expected the payloads to be pushed")
+	}
+	if q.PushAll([][]byte{[]byte("c"), []byte("d")}) {
+		t.Fatal("expected the payloads to be rejected")
+	}
+	if !q.PushAll([][]byte{[]byte("e")}) {
+		t.Fatal("expected the payload to be pushed")
+	}
+	if p := strings.Join(drain(q), ","); p != "a,b,e" {
+		t.Errorf("expected none of the rejected payloads, got %s", p)
+	}
+	if s := q.Stats(); s.Rejected != 2 {
+		t.Errorf("expected 2 rejected payloads, got %+v", s)
+	}
+
+	// the other policies push them one by one
+	q = New(2, PolicyDropOldest)
+	if !q.PushAll([][]byte{[]byte("a"), []byte("b"), []byte("c")}) {
+		t.Fatal("expected the payloads to be pushed")
+	}
+	if p := strings.Join(drain(q), ","); p != "b,c" {
+		t.Errorf("expected the newest payloads, got %s", p)
+	}
+	q = New(1, PolicyBlock)
+	q.Close()
+	if q.PushAll([][]byte{[]byte("a")}) {
+		t.Error("expected the payloads to be rejected by a closed queue")
+	}
+}
+
+func TestPut(t *testing.T) {
+	// Put waits for room whatever the policy
+	q := New(1, PolicyReject)
+	q.Push([]byte("a"))
+	res := make(chan bool)
+	go func() { res <- q.Put([]byte("error")) }()
+	select {
+	case <-res:
+		t.Fatal("expected the put to wait for room")
+	case <-time.After(20 * time.Millisecond):
+	}
+	<-q.C()
+	if ok := <-res; !ok || q.Stats().Rejected != 0 {
+		t.Fatal("expected the payload to be put once there is room")
+	}
+}
+
+func TestClose(t *testing.T) {
+	for _, policy := range []Policy{PolicyBlock, PolicyDropOldest, PolicyReject} {
+		q := New(1, policy)
+		q.Push([]byte("a"))
+
+		// closing unblocks the producers waiting for room, which only
+		// Push does with PolicyBlock
+		res := make(chan bool, 2)
+		pending := 1
+		go func() { res <- q.Put([]byte("b")) }()
+		if policy == PolicyBlock {
+			pending++
+			go func() { res <- q.Push([]byte("c")) }()
+		}
+		time.Sleep(10 * time.Millisecond)
+		q.Close()
+		q.Close()
+		for i := 0; i < pending; i++ {
+			select {
+			case ok := <-res:
+				if ok {
+					t.Errorf("%s: expected the pending calls to fail", policy)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s: expected the pending calls to return", policy)
+			}
+		}
+		select {
+		case <-q.Done():
+		default:
+			t.Errorf("%s: expected the queue to be done", policy)
+		}
+	}
+}
+
+func TestConcurrentDropOldest(t *testing.T) {
+	q := New(4, PolicyDropOldest)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if !q.Push([]byte("a")) {
+					t.Error("expected the payloads to be pushed")
+					return
+				}
+			}
+		}()
+	}
+
+	// every payload is either received or dropped
+	received := 0
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for {
+		select {
+		case <-q.C():
+			received++
+			continue
+		case <-done:
+		}
+		break
+	}
+	received += len(drain(q))
+	if total := uint64(received) + q.Stats().Dropped; total != 4000 {
+		t.Errorf("expected 4000 payloads received or dropped, got %d", total)
+	}
+}
+
+func TestReport(t *testing.T) {
+	q := New(1, PolicyReject)
+	var mu sync.Mutex
+	var logs []string
+	logf := func(format string, v ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, format)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Report(ctx, time.Millisecond, logf)
+	}()
+
+	// a healthy queue stays silent, and the overflows are logged once
+	time.Sleep(20 * time.Millisecond)
+	q.Push([]byte("a"))
+	q.Push([]byte("b"))
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logs) != 1 {
+		t.Errorf("expected a single report, got %d", len(logs))
+	}
+}
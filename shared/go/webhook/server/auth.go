@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// Authenticator returns true if a request with the given body is
+// authenticated
+type Authenticator func(req *http.Request, body []byte) bool
+
+// Token authenticates the requests whose header has the given value
+func Token(header, token string) Authenticator {
+	return func(req *http.Request, body []byte) bool {
+		return subtle.ConstantTimeCompare([]byte(req.Header.Get(header)), []byte(token)) == 1
+	}
+}
+
+// HMAC authenticates the requests whose header is the hex-encoded HMAC of
+// their body with the given secret, optionally preceded by prefix, e.g.
+// "sha256=". The hash defaults to SHA-256 if nil.
+func HMAC(header, prefix string, secret []byte, h func() hash.Hash) Authenticator {
+	if h == nil {
+		h = sha256.New
+	}
+	return func(req *http.Request, body []byte) bool {
+		sig := req.Header.Get(header)
+		if !strings.HasPrefix(sig, prefix) {
+			return false
+		}
+		expected, err := hex.DecodeString(strings.TrimPrefix(sig, prefix))
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(h, secret)
+		mac.Write(body)
+		return hmac.Equal(mac.Sum(nil), expected)
+	}
+}
+
+// Any authenticates the requests authenticated by any of the given
+// authenticators
+func Any(auths ...Authenticator) Authenticator {
+	return func(req *http.Request, body []byte) bool {
+		for _, a := range auths {
+			if a(req, body) {
+				return true
+			}
+		}
+		return false
+	}
+}
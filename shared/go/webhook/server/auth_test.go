@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http/httptest"
+	"testing"
+)
+
+func sign(h func() hash.Hash, secret, body string) string {
+	mac := hmac.New(h, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestToken(t *testing.T) {
+	auth := Any(Token("X-Token", "secret"), Token("Authorization", "Bearer bearer"))
+	tests := []struct {
+		header   string
+		value    string
+		expected bool
+	}{
+		{"X-Token", "secret", true},
+		{"X-Token", "other", false},
+		{"Authorization", "Bearer bearer", true},
+		{"Authorization", "bearer", false},
+		{"Authorization", "Bearer other", false},
+		{"X-Other", "secret", false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(test.header, test.value)
+		if res := auth(req, nil); res != test.expected {
+			t.Errorf("%s: %s: expected %v, got %v", test.header, test.value, test.expected, res)
+		}
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	body := `{"test":true}`
+	tests := []struct {
+		name     string
+		auth     Authenticator
+		sig      string
+		expected bool
+	}{
+		{"sha256", HMAC("X-Sig", "sha256=", []byte("secret"), nil), "sha256=" + sign(sha256.New, "secret", body), true},
+		{"sha1", HMAC("X-Sig", "", []byte("secret"), sha1.New), sign(sha1.New, "secret", body), true},
+		{"missing prefix", HMAC("X-Sig", "sha256=", []byte("secret"), nil), sign(sha256.New, "secret", body), false},
+		{"wrong secret", HMAC("X-Sig", "sha256=", []byte("secret"), nil), "sha256=" + sign(sha256.New, "other", body), false},
+		{"wrong hash", HMAC("X-Sig", "", []byte("secret"), nil), sign(sha1.New, "secret", body), false},
+		{"not hex", HMAC("X-Sig", "", []byte("secret"), nil), "zz", false},
+		{"missing", HMAC("X-Sig", "", []byte("secret"), nil), "", false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("X-Sig", test.sig)
+		if res := test.auth(req, []byte(body)); res != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, res)
+		}
+	}
+}
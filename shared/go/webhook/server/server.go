@@ -0,0 +1,260 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package server provides the HTTP(S) webhook listener embedded by the
+// push-based plugins. The requests are authenticated, split into payloads
+// and buffered in a bounded queue, so that they are answered as soon as
+// possible, while the payloads are parsed into events on the side of the
+// event source. The plugins only provide the parsing of their payloads.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/webhook/queue"
+)
+
+const (
+	// DefaultMaxBodySize is the default limit of the size of the requests
+	DefaultMaxBodySize = 10 * 1024 * 1024
+	// DefaultQueueSize is the default number of payloads buffered
+	DefaultQueueSize = 64
+
+	shutdownTimeout = 5 * time.Second
+)
+
+var (
+	// ErrBadRequest is wrapped by the errors of the malformed requests
+	ErrBadRequest = errors.New("bad request")
+	// ErrUnauthorized is wrapped by the errors of the requests failing
+	// the authentication
+	ErrUnauthorized = errors.New("authentication failed")
+)
+
+// Config is the configuration of a Server
+type Config struct {
+	// Address is the address to listen on, e.g. :9765
+	Address string
+	// Endpoint is the path of the webhook, e.g. /webhook
+	Endpoint string
+	// CertFile enables TLS if set. KeyFile is the private key, which
+	// defaults to CertFile for the PEM files concatenating both.
+	CertFile string
+	KeyFile  string
+	// MaxBodySize limits the size of the requests, 0 for the default
+	MaxBodySize int64
+	// QueueSize is the number of payloads buffered, 0 for the default,
+	// and Overflow the behavior of the queue when it's full
+	QueueSize int
+	Overflow  queue.Policy
+	// Auth authenticates the requests, nil for no authentication
+	Auth Authenticator
+	// Accept checks a request before its body is read, e.g. its content
+	// type. The requests are answered with 400 if it returns an error.
+	Accept func(req *http.Request) error
+	// Decode splits the body of a request into payloads, nil for the body
+	// as a single payload
+	Decode func(req *http.Request, body []byte) ([][]byte, error)
+	// Verify answers the GET requests, e.g. the one-time verification of
+	// the endpoint by the sender, nil to reject them
+	Verify http.HandlerFunc
+	// OnListen is called when the server starts and stops listening
+	OnListen func(listening bool)
+	// OnRequestError is called with the errors of the rejected requests,
+	// wrapping ErrBadRequest or ErrUnauthorized, e.g. to log and count them
+	OnRequestError func(err error)
+	// OnServeError is called with the error stopping the server, and
+	// returns the error ending the event stream
+	OnServeError func(err error) error
+	// ReportInterval is the interval of the logs of the queue overflows
+	// with Logf, 0 for no logs
+	ReportInterval time.Duration
+	Logf           func(format string, v ...interface{})
+}
+
+// Server is a webhook listener
+type Server struct {
+	cfg    Config
+	srv    *http.Server
+	queue  *queue.Queue
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New returns a Server with the given configuration, which starts
+// listening with Events
+func New(cfg Config) *Server {
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = DefaultMaxBodySize
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.Overflow == "" {
+		cfg.Overflow = queue.PolicyBlock
+	}
+	if cfg.KeyFile == "" {
+		cfg.KeyFile = cfg.CertFile
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		cfg:    cfg,
+		queue:  queue.New(cfg.QueueSize, cfg.Overflow),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	m := http.NewServeMux()
+	m.Handle(cfg.Endpoint, s)
+	s.srv = &http.Server{Addr: cfg.Address, Handler: m}
+	return s
+}
+
+// ServeHTTP handles a webhook request, pushing its payloads to the queue
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+	case http.MethodGet:
+		if s.cfg.Verify != nil {
+			s.cfg.Verify(w, req)
+			return
+		}
+		fallthrough
+	default:
+		http.Error(w, fmt.Sprintf("%s method not allowed", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	if s.cfg.Accept != nil {
+		if err := s.cfg.Accept(req); err != nil {
+			s.reject(w, http.StatusBadRequest, fmt.Errorf("%w: %s", ErrBadRequest, err.Error()))
+			return
+		}
+	}
+	req.Body = http.MaxBytesReader(w, req.Body, s.cfg.MaxBodySize)
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		s.reject(w, http.StatusBadRequest, fmt.Errorf("%w: %s", ErrBadRequest, err.Error()))
+		return
+	}
+	if s.cfg.Auth != nil && !s.cfg.Auth(req, body) {
+		s.reject(w, http.StatusUnauthorized, fmt.Errorf("%w, skipping message from %s", ErrUnauthorized, req.RemoteAddr))
+		return
+	}
+	payloads := [][]byte{body}
+	if s.cfg.Decode != nil {
+		payloads, err = s.cfg.Decode(req, body)
+		if err != nil {
+			s.reject(w, http.StatusBadRequest, fmt.Errorf("%w: %s", ErrBadRequest, err.Error()))
+			return
+		}
+	}
+	// the payloads are queued all together or rejected all together,
+	// so that a rejected request can be retried without duplicates
+	if !s.queue.PushAll(payloads) {
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) reject(w http.ResponseWriter, status int, err error) {
+	if s.cfg.OnRequestError != nil {
+		s.cfg.OnRequestError(err)
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// Events starts listening and returns the channel of the events produced
+// by handle from each payload received, which is meant to be passed to
+// source.NewPushInstance. The channel receives the error stopping the
+// server, if any, and is closed once the server is closed. The channel is
+// not drained after the server is closed, so handle must give up sending
+// once ctx is done:
+//
+//	select {
+//	case c <- evt:
+//	case <-ctx.Done():
+//		return
+//	}
+func (s *Server) Events(handle func(ctx context.Context, payload []byte, c chan<- source.PushEvent)) <-chan source.PushEvent {
+	c := make(chan source.PushEvent)
+
+	go func() {
+		defer s.queue.Close()
+		var err error
+		s.listening(true)
+		if s.cfg.CertFile != "" {
+			err = s.srv.ListenAndServeTLS(s.cfg.CertFile, s.cfg.KeyFile)
+		} else {
+			err = s.srv.ListenAndServe()
+		}
+		s.listening(false)
+		if err != nil && err != http.ErrServerClosed {
+			if s.cfg.OnServeError != nil {
+				err = s.cfg.OnServeError(err)
+			}
+			select {
+			case c <- source.PushEvent{Err: err}:
+			case <-s.ctx.Done():
+			}
+		}
+	}()
+
+	go func() {
+		defer close(c)
+		for {
+			select {
+			case p := <-s.queue.C():
+				handle(s.ctx, p, c)
+			case <-s.queue.Done():
+				return
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if s.cfg.ReportInterval > 0 && s.cfg.Logf != nil {
+		go s.queue.Report(s.ctx, s.cfg.ReportInterval, s.cfg.Logf)
+	}
+	return c
+}
+
+func (s *Server) listening(listening bool) {
+	if s.cfg.OnListen != nil {
+		s.cfg.OnListen(listening)
+	}
+}
+
+// Stats returns the current state of the queue of the server
+func (s *Server) Stats() queue.Stats {
+	return s.queue.Stats()
+}
+
+// Close shuts the server down gracefully and closes its event channel
+func (s *Server) Close() {
+	ctx, cancel := context.WithTimeout(s.ctx, shutdownTimeout)
+	defer cancel()
+	s.srv.Shutdown(ctx)
+	s.cancel()
+	s.queue.Close()
+}
@@ -0,0 +1,305 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2024 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/source"
+	"github.com/falcosecurity/plugins/shared/go/webhook/queue"
+)
+
+// serve returns the status of a request handled by the server
+func serve(s *Server, method, body string, header ...string) int {
+	req := httptest.NewRequest(method, "/webhook", strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w.Code
+}
+
+// drain returns the payloads waiting in the queue of the server
+func drain(s *Server) []string {
+	var res []string
+	for {
+		select {
+		case p := <-s.queue.C():
+			res = append(res, string(p))
+		default:
+			return res
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	s := New(Config{
+		Endpoint:    "/webhook",
+		MaxBodySize: 16,
+		Auth:        Token("X-Token", "secret"),
+		Accept: func(req *http.Request) error {
+			if req.Header.Get("Content-Type") != "text/plain" {
+				return errors.New("unsupported content type")
+			}
+			return nil
+		},
+		Decode: func(req *http.Request, body []byte) ([][]byte, error) {
+			if len(body) == 0 {
+				return nil, errors.New("empty body")
+			}
+			return [][]byte{body, body}, nil
+		},
+		Verify: func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		},
+		OnRequestError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	})
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		header   []string
+		expected int
+		err      error
+	}{
+		{"valid", "POST", "a", []string{"X-Token", "secret", "Content-Type", "text/plain"}, http.StatusOK, nil},
+		{"verify", "GET", "", nil, http.StatusAccepted, nil},
+		{"method", "PUT", "", nil, http.StatusMethodNotAllowed, nil},
+		{"not accepted", "POST", "a", []string{"X-Token", "secret"}, http.StatusBadRequest, ErrBadRequest},
+		{"too large", "POST", strings.Repeat("a", 17), []string{"X-Token", "secret", "Content-Type", "text/plain"}, http.StatusBadRequest, ErrBadRequest},
+		{"unauthorized", "POST", "a", []string{"X-Token", "other", "Content-Type", "text/plain"}, http.StatusUnauthorized, ErrUnauthorized},
+		{"not decoded", "POST", "", []string{"X-Token", "secret", "Content-Type", "text/plain"}, http.StatusBadRequest, ErrBadRequest},
+	}
+	for _, test := range tests {
+		mu.Lock()
+		errs = nil
+		mu.Unlock()
+		if status := serve(s, test.method, test.body, test.header...); status != test.expected {
+			t.Errorf("%s: expected the status %d, got %d", test.name, test.expected, status)
+		}
+		mu.Lock()
+		if test.err == nil && len(errs) > 0 {
+			t.Errorf("%s: unexpected error %v", test.name, errs[0])
+		}
+		if test.err != nil && (len(errs) != 1 || !errors.Is(errs[0], test.err)) {
+			t.Errorf("%s: expected the error %v, got %v", test.name, test.err, errs)
+		}
+		mu.Unlock()
+	}
+
+	// the payloads of the valid request only are queued
+	if p := strings.Join(drain(s), ","); p != "a,a" {
+		t.Errorf("expected the decoded payloads, got %s", p)
+	}
+}
+
+func TestServeHTTPDefaults(t *testing.T) {
+	s := New(Config{Endpoint: "/webhook", QueueSize: 1, Overflow: queue.PolicyReject})
+	if status := serve(s, "GET", ""); status != http.StatusMethodNotAllowed {
+		t.Errorf("expected the GET requests to be rejected without Verify, got %d", status)
+	}
+
+	// a full queue answers with 429 with PolicyReject
+	if status := serve(s, "POST", "a"); status != http.StatusOK {
+		t.Fatalf("expected the request to be accepted, got %d", status)
+	}
+	if status := serve(s, "POST", "b"); status != http.StatusTooManyRequests {
+		t.Errorf("expected the request to be rejected by the full queue, got %d", status)
+	}
+	if st := s.Stats(); st.Depth != 1 || st.Rejected != 1 {
+		t.Errorf("unexpected stats of the queue: %+v", st)
+	}
+	if p := strings.Join(drain(s), ","); p != "a" {
+		t.Errorf("expected the body as a single payload, got %s", p)
+	}
+}
+
+func TestServeHTTPPartial(t *testing.T) {
+	// the payloads of a request are rejected together if they don't all
+	// fit in the queue, so that the retries don't duplicate them
+	s := New(Config{
+		Endpoint:  "/webhook",
+		QueueSize: 3,
+		Overflow:  queue.PolicyReject,
+		Decode: func(req *http.Request, body []byte) ([][]byte, error) {
+			var res [][]byte
+			for _, p := range strings.Split(string(body), ",") {
+				res = append(res, []byte(p))
+			}
+			return res, nil
+		},
+	})
+	if status := serve(s, "POST", "a,b"); status != http.StatusOK {
+		t.Fatalf("expected the request to be accepted, got %d", status)
+	}
+	if status := serve(s, "POST", "c,d"); status != http.StatusTooManyRequests {
+		t.Fatalf("expected the request to be rejected, got %d", status)
+	}
+	if status := serve(s, "POST", "e"); status != http.StatusOK {
+		t.Fatalf("expected the request to be accepted, got %d", status)
+	}
+	if p := strings.Join(drain(s), ","); p != "a,b,e" {
+		t.Errorf("expected none of the payloads of the rejected request, got %s", p)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	var mu sync.Mutex
+	var listening []bool
+	s := New(Config{
+		Address:  "127.0.0.1:0",
+		Endpoint: "/webhook",
+		OnListen: func(l bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			listening = append(listening, l)
+		},
+	})
+	c := s.Events(func(ctx context.Context, payload []byte, c chan<- source.PushEvent) {
+		select {
+		case c <- source.PushEvent{Data: payload}:
+		case <-ctx.Done():
+		}
+	})
+	for _, p := range []string{"a", "b"} {
+		if status := serve(s, "POST", p); status != http.StatusOK {
+			t.Fatalf("expected the request to be accepted, got %d", status)
+		}
+		select {
+		case evt := <-c:
+			if string(evt.Data) != p || evt.Err != nil {
+				t.Fatalf("expected the event %s, got %s (%v)", p, evt.Data, evt.Err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected an event")
+		}
+	}
+
+	// the channel is closed with the server
+	s.Close()
+	for deadline := time.After(5 * time.Second); ; {
+		select {
+		case _, ok := <-c:
+			if ok {
+				continue
+			}
+		case <-deadline:
+			t.Fatal("expected the channel to be closed")
+		}
+		break
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		mu.Lock()
+		n := len(listening)
+		mu.Unlock()
+		if n == 2 || time.Now().After(deadline) {
+			break
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(listening) != 2 || !listening[0] || listening[1] {
+		t.Errorf("expected the server to start then stop listening, got %v", listening)
+	}
+}
+
+func TestEventsClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+	s := New(Config{Address: "127.0.0.1:0", Endpoint: "/webhook", QueueSize: 4})
+	handled := make(chan struct{}, 4)
+	s.Events(func(ctx context.Context, payload []byte, c chan<- source.PushEvent) {
+		handled <- struct{}{}
+		select {
+		case c <- source.PushEvent{Data: payload}:
+		case <-ctx.Done():
+		}
+	})
+	for _, p := range []string{"a", "b", "c"} {
+		if status := serve(s, "POST", p); status != http.StatusOK {
+			t.Fatalf("expected the request to be accepted, got %d", status)
+		}
+	}
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a payload to be handled")
+	}
+
+	// closing the server without draining its events leaves no
+	// goroutine blocked on sending them
+	s.Close()
+	n := runtime.NumGoroutine()
+	for deadline := time.Now().Add(5 * time.Second); n > before && time.Now().Before(deadline); n = runtime.NumGoroutine() {
+		time.Sleep(time.Millisecond)
+	}
+	if n > before {
+		buf := make([]byte, 1<<16)
+		t.Errorf("expected %d goroutines at most, got %d:\n%s", before, n, buf[:runtime.Stack(buf, true)])
+	}
+}
+
+func TestEventsServeError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// the error stopping the server is sent once, as returned by
+	// OnServeError
+	failure := errors.New("failure")
+	s := New(Config{
+		Address:      l.Addr().String(),
+		Endpoint:     "/webhook",
+		OnServeError: func(err error) error { return failure },
+	})
+	defer s.Close()
+	c := s.Events(func(ctx context.Context, payload []byte, c chan<- source.PushEvent) {})
+	select {
+	case evt := <-c:
+		if evt.Err != failure {
+			t.Errorf("expected the error of OnServeError, got %v", evt.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an error")
+	}
+	select {
+	case _, ok := <-c:
+		if ok {
+			t.Error("expected the channel to be closed after the error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the channel to be closed")
+	}
+}